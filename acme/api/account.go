@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/mail"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/logging"
 )
 
@@ -30,6 +33,32 @@ func validateContacts(cs []string) error {
 	return nil
 }
 
+// validateContactPolicy validates the contacts of an account against the
+// contact policy of the provisioner.
+func validateContactPolicy(p *provisioner.ACMEContactPolicy, cs []string) error {
+	if p == nil {
+		return nil
+	}
+	if p.Require && len(cs) == 0 {
+		return acme.NewError(acme.ErrorInvalidContactType, "at least one contact is required")
+	}
+	for _, c := range cs {
+		email, ok := strings.CutPrefix(c, "mailto:")
+		if !ok {
+			return acme.NewError(acme.ErrorUnsupportedContactType, "contact '%s' is not a mailto URL", c)
+		}
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return acme.NewError(acme.ErrorInvalidContactType, "contact '%s' is not a valid email address", c)
+		}
+		domain := email[strings.LastIndex(email, "@")+1:]
+		if !p.IsDomainAllowed(domain) {
+			return acme.NewError(acme.ErrorInvalidContactType, "contact '%s' domain is not allowed", c)
+		}
+	}
+	return nil
+}
+
 // Validate validates a new-account request body.
 func (n *NewAccountRequest) Validate() error {
 	if n.OnlyReturnExisting && len(n.Contact) > 0 {
@@ -125,6 +154,11 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := validateContactPolicy(prov.Contacts, nar.Contact); err != nil {
+			render.Error(w, err)
+			return
+		}
+
 		eak, err := validateExternalAccountBinding(ctx, &nar)
 		if err != nil {
 			render.Error(w, err)
@@ -195,6 +229,17 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 			render.Error(w, err)
 			return
 		}
+		if len(uar.Contact) > 0 {
+			prov, err := acmeProvisionerFromContext(ctx)
+			if err != nil {
+				render.Error(w, err)
+				return
+			}
+			if err := validateContactPolicy(prov.Contacts, uar.Contact); err != nil {
+				render.Error(w, err)
+				return
+			}
+		}
 		if len(uar.Status) > 0 || len(uar.Contact) > 0 {
 			if len(uar.Status) > 0 {
 				acc.Status = uar.Status
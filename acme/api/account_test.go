@@ -53,6 +53,20 @@ func (*fakeProvisioner) GetID() string                                 { return
 func (*fakeProvisioner) GetName() string                               { return "" }
 func (*fakeProvisioner) DefaultTLSCertDuration() time.Duration         { return 0 }
 func (*fakeProvisioner) GetOptions() *provisioner.Options              { return nil }
+func (*fakeProvisioner) GetRetryAfter() time.Duration                  { return 0 }
+func (*fakeProvisioner) GetAttestationExtensions() []provisioner.ACMEAttestationExtension {
+	return nil
+}
+func (*fakeProvisioner) GetAttestationMode() provisioner.ACMEAttestationMode {
+	return provisioner.ACMEAttestationEnforced
+}
+func (*fakeProvisioner) GetHTTP01Header() http.Header { return nil }
+func (*fakeProvisioner) GetIPIdentifierOptions() *provisioner.ACMEIPIdentifierOptions {
+	return nil
+}
+func (*fakeProvisioner) GetProfileOptions(string) (*provisioner.Options, bool) {
+	return nil, false
+}
 
 func newProv() acme.Provisioner {
 	// Initialize provisioners
@@ -277,6 +291,45 @@ func TestUpdateAccountRequest_Validate(t *testing.T) {
 	}
 }
 
+func Test_validateContactPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *provisioner.ACMEContactPolicy
+		contacts []string
+		err      *acme.Error
+	}{
+		{"ok no policy", nil, []string{"foo"}, nil},
+		{"ok no contacts", &provisioner.ACMEContactPolicy{}, nil, nil},
+		{"ok", &provisioner.ACMEContactPolicy{Require: true}, []string{"mailto:jane@example.com"}, nil},
+		{"ok allowed domain", &provisioner.ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, []string{"mailto:jane@example.com", "mailto:joe@eng.EXAMPLE.com"}, nil},
+		{"fail required", &provisioner.ACMEContactPolicy{Require: true}, nil,
+			acme.NewError(acme.ErrorInvalidContactType, "at least one contact is required")},
+		{"fail scheme", &provisioner.ACMEContactPolicy{}, []string{"tel:+12025550100"},
+			acme.NewError(acme.ErrorUnsupportedContactType, "contact 'tel:+12025550100' is not a mailto URL")},
+		{"fail email", &provisioner.ACMEContactPolicy{}, []string{"mailto:jane"},
+			acme.NewError(acme.ErrorInvalidContactType, "contact 'mailto:jane' is not a valid email address")},
+		{"fail email with name", &provisioner.ACMEContactPolicy{}, []string{"mailto:Jane <jane@example.com>"},
+			acme.NewError(acme.ErrorInvalidContactType, "contact 'mailto:Jane <jane@example.com>' is not a valid email address")},
+		{"fail domain", &provisioner.ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, []string{"mailto:jane@example.com", "mailto:jane@badexample.com"},
+			acme.NewError(acme.ErrorInvalidContactType, "contact 'mailto:jane@badexample.com' domain is not allowed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateContactPolicy(tt.policy, tt.contacts)
+			if tt.err == nil {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, tt.err.Type, ae.Type)
+				assert.Equals(t, tt.err.Detail, ae.Detail)
+				assert.Equals(t, tt.err.Status, ae.Status)
+			}
+		})
+	}
+}
+
 func TestHandler_GetOrdersByAccountID(t *testing.T) {
 	accID := "account-id"
 
@@ -516,6 +569,26 @@ func TestHandler_NewAccount(t *testing.T) {
 				err:        acme.NewError(acme.ErrorExternalAccountRequiredType, "no external account binding provided"),
 			}
 		},
+		"fail/contact-policy": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"mailto:jane@example.org"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			prov := newACMEProv(t)
+			prov.Contacts = &provisioner.ACMEContactPolicy{AllowedDomains: []string{"example.com"}}
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorInvalidContactType, "contact 'mailto:jane@example.org' domain is not allowed"),
+			}
+		},
 		"fail/db.CreateAccount-error": func(t *testing.T) test {
 			nar := &NewAccountRequest{
 				Contact: []string{"foo", "bar"},
@@ -915,6 +988,24 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 				err:        acme.NewError(acme.ErrorMalformedType, "contact cannot be empty string"),
 			}
 		},
+		"fail/contact-policy": func(t *testing.T) test {
+			uar := &UpdateAccountRequest{
+				Contact: []string{"tel:+12025550100"},
+			}
+			b, err := json.Marshal(uar)
+			assert.FatalError(t, err)
+			prov := newACMEProv(t)
+			prov.Contacts = &provisioner.ACMEContactPolicy{}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorUnsupportedContactType, "contact 'tel:+12025550100' is not a mailto URL"),
+			}
+		},
 		"fail/db.UpdateAccount-error": func(t *testing.T) test {
 			uar := &UpdateAccountRequest{
 				Status: "deactivated",
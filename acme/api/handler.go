@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -192,10 +194,11 @@ func GetNonce(w http.ResponseWriter, r *http.Request) {
 }
 
 type Meta struct {
-	TermsOfService          string   `json:"termsOfService,omitempty"`
-	Website                 string   `json:"website,omitempty"`
-	CaaIdentities           []string `json:"caaIdentities,omitempty"`
-	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+	TermsOfService          string            `json:"termsOfService,omitempty"`
+	Website                 string            `json:"website,omitempty"`
+	CaaIdentities           []string          `json:"caaIdentities,omitempty"`
+	ExternalAccountRequired bool              `json:"externalAccountRequired,omitempty"`
+	Profiles                map[string]string `json:"profiles,omitempty"`
 }
 
 // Directory represents an ACME directory for configuring clients.
@@ -249,11 +252,25 @@ func createMetaObject(p *provisioner.ACME) *Meta {
 			Website:                 p.Website,
 			CaaIdentities:           p.CaaIdentities,
 			ExternalAccountRequired: p.RequireEAB,
+			Profiles:                createProfilesObject(p),
 		}
 	}
 	return nil
 }
 
+// createProfilesObject returns the names and descriptions of the profiles
+// configured in the ACME provisioner, or nil if there are none.
+func createProfilesObject(p *provisioner.ACME) map[string]string {
+	if len(p.Profiles) == 0 {
+		return nil
+	}
+	profiles := make(map[string]string, len(p.Profiles))
+	for _, profile := range p.Profiles {
+		profiles[profile.Name] = profile.Description
+	}
+	return profiles
+}
+
 // shouldAddMetaObject returns whether or not the ACME provisioner
 // has properties configured that must be added to the ACME directory object.
 func shouldAddMetaObject(p *provisioner.ACME) bool {
@@ -266,6 +283,8 @@ func shouldAddMetaObject(p *provisioner.ACME) bool {
 		return true
 	case p.RequireEAB:
 		return true
+	case len(p.Profiles) > 0:
+		return true
 	default:
 		return false
 	}
@@ -288,6 +307,11 @@ func GetAuthorization(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, err)
 		return
 	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
 	az, err := db.GetAuthorization(ctx, chi.URLParam(r, "authzID"))
 	if err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error retrieving authorization"))
@@ -306,9 +330,21 @@ func GetAuthorization(w http.ResponseWriter, r *http.Request) {
 	linker.LinkAuthorization(ctx, az)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	setRetryAfter(w, prov, az.Status)
 	render.JSON(w, az)
 }
 
+// setRetryAfter sets the Retry-After header if the provisioner has it
+// configured and the status of the resource is still pending or processing.
+func setRetryAfter(w http.ResponseWriter, prov acme.Provisioner, status acme.Status) {
+	if status != acme.StatusPending && status != acme.StatusProcessing {
+		return
+	}
+	if d := prov.GetRetryAfter(); d > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+	}
+}
+
 // GetChallenge ACME api for retrieving a Challenge.
 func GetChallenge(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -350,6 +386,16 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, err)
 		return
 	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if !prov.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(ch.Type)) {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"challenge '%s' of type %s is not enabled", ch.ID, ch.Type))
+		return
+	}
 	if err = ch.Validate(ctx, db, jwk, payload.value); err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error validating challenge"))
 		return
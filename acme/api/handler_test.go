@@ -170,6 +170,34 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/profiles": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.Profiles = []provisioner.ACMEProfile{
+				{Name: "tlsserver", Description: "TLS server certificate"},
+				{Name: "tlsclient"},
+			}
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				Meta: &Meta{
+					Profiles: map[string]string{
+						"tlsserver": "TLS server certificate",
+						"tlsclient": "",
+					},
+				},
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -238,6 +266,8 @@ func TestHandler_GetAuthorization(t *testing.T) {
 	}
 	prov := newProv()
 	provName := url.PathEscape(prov.GetName())
+	retryProv := newProv().(*provisioner.ACME)
+	retryProv.RetryAfter = &provisioner.Duration{Duration: 1500 * time.Millisecond}
 	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 
 	// Request with chi context
@@ -250,6 +280,7 @@ func TestHandler_GetAuthorization(t *testing.T) {
 		db         acme.DB
 		ctx        context.Context
 		statusCode int
+		retryAfter []string
 		err        *acme.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
@@ -273,7 +304,8 @@ func TestHandler_GetAuthorization(t *testing.T) {
 		},
 		"fail/db.GetAuthorization-error": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
-			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
 			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
 			return test{
 				db: &acme.MockDB{
@@ -286,7 +318,8 @@ func TestHandler_GetAuthorization(t *testing.T) {
 		},
 		"fail/account-id-mismatch": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
-			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
 			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
 			return test{
 				db: &acme.MockDB{
@@ -304,7 +337,8 @@ func TestHandler_GetAuthorization(t *testing.T) {
 		},
 		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
-			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
 			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
 			return test{
 				db: &acme.MockDB{
@@ -342,6 +376,23 @@ func TestHandler_GetAuthorization(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/retry-after": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := acme.NewProvisionerContext(context.Background(), retryProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						assert.Equals(t, id, az.ID)
+						return &az, nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 200,
+				retryAfter: []string{"2"},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -375,11 +426,38 @@ func TestHandler_GetAuthorization(t *testing.T) {
 				assert.Equals(t, bytes.TrimSpace(body), expB)
 				assert.Equals(t, res.Header["Location"], []string{u})
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+				assert.Equals(t, res.Header["Retry-After"], tc.retryAfter)
 			}
 		})
 	}
 }
 
+func Test_setRetryAfter(t *testing.T) {
+	prov := &acme.MockProvisioner{
+		MgetRetryAfter: func() time.Duration { return 1500 * time.Millisecond },
+	}
+	tests := []struct {
+		name   string
+		prov   acme.Provisioner
+		status acme.Status
+		want   string
+	}{
+		{"pending", prov, acme.StatusPending, "2"},
+		{"processing", prov, acme.StatusProcessing, "2"},
+		{"ready", prov, acme.StatusReady, ""},
+		{"valid", prov, acme.StatusValid, ""},
+		{"invalid", prov, acme.StatusInvalid, ""},
+		{"not configured", &acme.MockProvisioner{}, acme.StatusPending, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			setRetryAfter(w, tt.prov, tt.status)
+			assert.Equals(t, tt.want, w.Header().Get("Retry-After"))
+		})
+	}
+}
+
 func TestHandler_GetCertificate(t *testing.T) {
 	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
 	assert.FatalError(t, err)
@@ -653,6 +731,38 @@ func TestHandler_GetChallenge(t *testing.T) {
 				err:        acme.NewErrorISE("nil jwk"),
 			}
 		},
+		"fail/challenge-disabled": func(t *testing.T) test {
+			dnsProv := newProv()
+			dnsProv.(*provisioner.ACME).Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+			acc := &acme.Account{ID: "accID"}
+			ctx := acme.NewProvisionerContext(context.Background(), dnsProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{isEmptyJSON: true})
+			_jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			_pub := _jwk.Public()
+			ctx = context.WithValue(ctx, jwkContextKey, &_pub)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			return test{
+				db: &acme.MockDB{
+					MockGetChallenge: func(ctx context.Context, chID, azID string) (*acme.Challenge, error) {
+						return &acme.Challenge{
+							ID:        "chID",
+							Status:    acme.StatusPending,
+							Type:      acme.HTTP01,
+							AccountID: "accID",
+						}, nil
+					},
+					MockUpdateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						t.Errorf("updateChallenge should not be called")
+						return nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "challenge 'chID' of type http-01 is not enabled"),
+			}
+		},
 		"fail/validate-challenge-error": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
@@ -26,6 +26,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -134,6 +135,13 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if nor.Profile != "" {
+		if _, ok := prov.GetProfileOptions(nor.Profile); !ok {
+			render.Error(w, acme.NewError(acme.ErrorInvalidProfileType, "profile %q is not supported", nor.Profile))
+			return
+		}
+	}
+
 	var eak *acme.ExternalAccountKey
 	if acmeProv.RequireEAB {
 		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
@@ -178,6 +186,7 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Profile:          nor.Profile,
 	}
 
 	for i, identifier := range o.Identifiers {
@@ -320,6 +329,7 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 	linker.LinkOrder(ctx, o)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
+	setRetryAfter(w, prov, o.Status)
 	render.JSON(w, o)
 }
 
@@ -918,6 +918,29 @@ func TestHandler_NewOrder(t *testing.T) {
 				err: acme.NewErrorISE("error retrieving external account binding key: force"),
 			}
 		},
+		"fail/invalid-profile": func(t *testing.T) test {
+			acmeProv := newACMEProv(t)
+			acmeProv.Profiles = []provisioner.ACMEProfile{{Name: "tlsserver"}}
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				Profile: "tlsclient",
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), acmeProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err:        acme.NewError(acme.ErrorInvalidProfileType, `profile "tlsclient" is not supported`),
+			}
+		},
 		"fail/db.GetExternalAccountKeyByAccountID-error": func(t *testing.T) test {
 			acmeProv := newACMEProv(t)
 			acmeProv.RequireEAB = true
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -112,14 +113,22 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
 	u := &url.URL{Scheme: "http", Host: http01ChallengeHost(ch.Value), Path: fmt.Sprintf("/.well-known/acme-challenge/%s", ch.Token)}
 
+	// Use the port and the Host header configured for IP identifiers.
+	var host string
+	if o := ipIdentifierOptions(ctx, ch); o != nil && o.HTTP01Port != 0 {
+		u.Host += ":" + strconv.Itoa(o.HTTP01Port)
+		if o.HTTP01HostHeader == provisioner.HostHeaderIP {
+			host = http01ChallengeHost(ch.Value)
+		}
+	}
+
 	// Append insecure port if set.
 	// Only used for testing purposes.
 	if InsecurePortHTTP01 != 0 {
-		u.Host += ":" + strconv.Itoa(InsecurePortHTTP01)
+		u.Host = http01ChallengeHost(ch.Value) + ":" + strconv.Itoa(InsecurePortHTTP01)
 	}
 
-	vc := MustClientFromContext(ctx)
-	resp, err := vc.Get(u.String())
+	resp, err := http01Get(ctx, u.String(), host)
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
 			"error doing http GET for url %s", u))
@@ -157,6 +166,42 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 	return nil
 }
 
+// http01Get issues the http-01 validation request, adding the headers
+// configured in the provisioner and the given Host header if the client
+// supports them.
+func http01Get(ctx context.Context, u, host string) (*http.Response, error) {
+	vc := MustClientFromContext(ctx)
+	if hc, ok := vc.(HeaderClient); ok {
+		var h http.Header
+		if p, ok := ProvisionerFromContext(ctx); ok {
+			h = p.GetHTTP01Header()
+		}
+		if host != "" {
+			if h == nil {
+				h = make(http.Header)
+			}
+			h.Set("Host", host)
+		}
+		if len(h) > 0 {
+			return hc.GetWithHeader(u, h)
+		}
+	}
+	return vc.Get(u)
+}
+
+// ipIdentifierOptions returns the options of the provisioner in the context
+// for IP identifiers, or nil if the challenge is not for an IP identifier or
+// the options are not configured.
+func ipIdentifierOptions(ctx context.Context, ch *Challenge) *provisioner.ACMEIPIdentifierOptions {
+	if net.ParseIP(ch.Value) == nil {
+		return nil
+	}
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		return p.GetIPIdentifierOptions()
+	}
+	return nil
+}
+
 // http01ChallengeHost checks if a Challenge value is an IPv6 address
 // and adds square brackets if that's the case, so that it can be used
 // as a hostname. Returns the original Challenge value as the host to
@@ -193,10 +238,12 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 	var hostPort string
 
 	// Allow to change TLS port for testing purposes.
-	if port := InsecurePortTLSALPN01; port == 0 {
-		hostPort = net.JoinHostPort(ch.Value, "443")
-	} else {
+	if port := InsecurePortTLSALPN01; port != 0 {
 		hostPort = net.JoinHostPort(ch.Value, strconv.Itoa(port))
+	} else if o := ipIdentifierOptions(ctx, ch); o != nil && o.TLSALPN01Port != 0 {
+		hostPort = net.JoinHostPort(ch.Value, strconv.Itoa(o.TLSALPN01Port))
+	} else {
+		hostPort = net.JoinHostPort(ch.Value, "443")
 	}
 
 	vc := MustClientFromContext(ctx)
@@ -360,13 +407,20 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 		return WrapErrorISE(err, "error loading authorization")
 	}
 
+	// The permanent identifier cannot be authorized without an attestation
+	// if the attestation mode is off.
+	if attestationMode(ctx) == provisioner.ACMEAttestationOff {
+		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
+			"device attestation is disabled by the provisioner"))
+	}
+
 	// Parse payload.
 	var p payloadType
 	if err := json.Unmarshal(payload, &p); err != nil {
 		return WrapErrorISE(err, "error unmarshalling JSON")
 	}
 	if p.Error != "" {
-		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
+		return storeAttestationError(ctx, db, ch, az, NewError(ErrorRejectedIdentifierType,
 			"payload contained error: %v", p.Error))
 	}
 
@@ -384,7 +438,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 	prov := MustProvisionerFromContext(ctx)
 	if !prov.IsAttestationFormatEnabled(ctx, provisioner.ACMEAttestationFormat(format)) {
 		if format != "apple" && format != "step" && format != "tpm" {
-			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
+			return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
 		}
 
 		return storeError(ctx, db, ch, true,
@@ -400,7 +454,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				if acmeError.Status == 500 {
 					return acmeError
 				}
-				return storeError(ctx, db, ch, true, acmeError)
+				return storeAttestationError(ctx, db, ch, az, acmeError)
 			}
 			return WrapErrorISE(err, "error validating attestation")
 		}
@@ -409,7 +463,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 		if len(data.Nonce) != 0 {
 			sum := sha256.Sum256([]byte(ch.Token))
 			if subtle.ConstantTimeCompare(data.Nonce, sum[:]) != 1 {
-				return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "challenge token does not match"))
+				return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "challenge token does not match"))
 			}
 		}
 
@@ -423,11 +477,17 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				Identifier{Type: "permanent-identifier", Value: ch.Value},
 				"challenge identifier %q doesn't match any of the attested hardware identifiers %q", ch.Value, []string{data.UDID, data.SerialNumber},
 			)
-			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
+			return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
 		}
 
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		az.Attestation = map[string]string{
+			string(provisioner.AttestationFormatField):       format,
+			string(provisioner.AttestationSerialNumberField): data.SerialNumber,
+			string(provisioner.AttestationUDIDField):         data.UDID,
+			string(provisioner.AttestationSEPVersionField):   data.SEPVersion,
+		}
 	case "step":
 		data, err := doStepAttestationFormat(ctx, prov, ch, jwk, &att)
 		if err != nil {
@@ -436,7 +496,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				if acmeError.Status == 500 {
 					return acmeError
 				}
-				return storeError(ctx, db, ch, true, acmeError)
+				return storeAttestationError(ctx, db, ch, az, acmeError)
 			}
 			return WrapErrorISE(err, "error validating attestation")
 		}
@@ -451,11 +511,15 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				Identifier{Type: "permanent-identifier", Value: ch.Value},
 				"challenge identifier %q doesn't match the attested hardware identifier %q", ch.Value, data.SerialNumber,
 			)
-			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
+			return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
 		}
 
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		az.Attestation = map[string]string{
+			string(provisioner.AttestationFormatField):       format,
+			string(provisioner.AttestationSerialNumberField): data.SerialNumber,
+		}
 
 	case "tpm":
 		data, err := doTPMAttestationFormat(ctx, prov, ch, jwk, &att)
@@ -465,7 +529,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				if acmeError.Status == 500 {
 					return acmeError
 				}
-				return storeError(ctx, db, ch, true, acmeError)
+				return storeAttestationError(ctx, db, ch, az, acmeError)
 			}
 			return WrapErrorISE(err, "error validating attestation")
 		}
@@ -481,24 +545,60 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 				Identifier{Type: "permanent-identifier", Value: ch.Value},
 				"challenge identifier %q doesn't match any of the attested hardware identifiers %q", ch.Value, data.PermanentIdentifiers,
 			)
-			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
+			return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
 		}
 
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		az.Attestation = map[string]string{
+			string(provisioner.AttestationFormatField):              format,
+			string(provisioner.AttestationPermanentIdentifierField): ch.Value,
+		}
 	default:
-		return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
+		return storeAttestationError(ctx, db, ch, az, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
 	}
 
+	az.Attestation[string(provisioner.AttestationResultField)] = string(provisioner.AttestationPass)
+	return storeDeviceAttestation(ctx, db, ch, az)
+}
+
+// storeAttestationError stores the error of a device-attest-01 challenge that
+// failed to verify the attestation. If the attestation mode is permissive, the
+// challenge is marked as valid instead, and the failed result is stored in the
+// authorization. The order will not add the permanent identifier of a failed
+// attestation to the certificate.
+func storeAttestationError(ctx context.Context, db DB, ch *Challenge, az *Authorization, err *Error) error {
+	if attestationMode(ctx) != provisioner.ACMEAttestationPermissive {
+		return storeError(ctx, db, ch, true, err)
+	}
+	az.Fingerprint = ""
+	az.Attestation = map[string]string{
+		string(provisioner.AttestationResultField): string(provisioner.AttestationFail),
+	}
+	return storeDeviceAttestation(ctx, db, ch, az)
+}
+
+// attestationMode returns the attestation mode of the provisioner in the
+// context, or the default mode if it is not set.
+func attestationMode(ctx context.Context) provisioner.ACMEAttestationMode {
+	if prov, ok := ProvisionerFromContext(ctx); ok {
+		return prov.GetAttestationMode()
+	}
+	return provisioner.ACMEAttestationEnforced
+}
+
+// storeDeviceAttestation marks the device-attest-01 challenge as valid and
+// stores it, together with the attested fields in the authorization.
+func storeDeviceAttestation(ctx context.Context, db DB, ch *Challenge, az *Authorization) error {
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
 
-	// Store the fingerprint in the authorization.
+	// Store the fingerprint and the attested fields in the authorization.
 	//
 	// TODO: add method to update authorization and challenge atomically.
-	if az.Fingerprint != "" {
+	if az.Fingerprint != "" || len(az.Attestation) > 0 {
 		if err := db.UpdateAuthorization(ctx, az); err != nil {
 			return WrapErrorISE(err, "error updating authorization")
 		}
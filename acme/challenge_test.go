@@ -53,6 +53,15 @@ func (m *mockClient) TLSDial(network, addr string, tlsConfig *tls.Config) (*tls.
 	return m.tlsDial(network, addr, tlsConfig)
 }
 
+type mockHeaderClient struct {
+	mockClient
+	getWithHeader func(url string, header http.Header) (*http.Response, error)
+}
+
+func (m *mockHeaderClient) GetWithHeader(url string, header http.Header) (*http.Response, error) {
+	return m.getWithHeader(url, header)
+}
+
 func fatalError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
@@ -839,6 +848,7 @@ func TestChallenge_Validate(t *testing.T) {
 						assert.NoError(t, err)
 						assert.Equal(t, "azID", az.ID)
 						assert.Equal(t, fingerprint, az.Fingerprint)
+						assert.Equal(t, map[string]string{"format": "step", "serialNumber": "1234", "result": "pass"}, az.Attestation)
 						return nil
 					},
 					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
@@ -895,6 +905,143 @@ func (errReader) Close() error {
 	return nil
 }
 
+func Test_http01Get(t *testing.T) {
+	header := http.Header{"X-Validator": []string{"secret"}}
+	prov := &MockProvisioner{
+		MgetHTTP01Header: func() http.Header { return header },
+	}
+	var gotHeader http.Header
+	var withHeader bool
+	vc := &mockHeaderClient{
+		mockClient: mockClient{
+			get: func(url string) (*http.Response, error) {
+				withHeader = false
+				return &http.Response{Body: http.NoBody}, nil
+			},
+		},
+		getWithHeader: func(url string, h http.Header) (*http.Response, error) {
+			withHeader, gotHeader = true, h
+			return &http.Response{Body: http.NoBody}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		withHeader bool
+	}{
+		{"ok with header", NewProvisionerContext(NewClientContext(context.Background(), vc), prov), true},
+		{"ok without header", NewProvisionerContext(NewClientContext(context.Background(), vc), &MockProvisioner{}), false},
+		{"ok without provisioner", NewClientContext(context.Background(), vc), false},
+		{"ok without header client", NewProvisionerContext(NewClientContext(context.Background(), &vc.mockClient), prov), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHeader, gotHeader = false, nil
+			resp, err := http01Get(tt.ctx, "http://zap.internal/.well-known/acme-challenge/token", "")
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.withHeader, withHeader)
+			if tt.withHeader {
+				assert.Equal(t, header, gotHeader)
+			}
+		})
+	}
+}
+
+func TestHTTP01Validate_ipIdentifierOptions(t *testing.T) {
+	jwk, keyAuth := mustAccountAndKeyAuthorization(t, "token")
+	var gotURL string
+	var gotHeader http.Header
+	vc := &mockHeaderClient{
+		mockClient: mockClient{
+			get: func(url string) (*http.Response, error) {
+				gotURL, gotHeader = url, nil
+				return &http.Response{Body: io.NopCloser(strings.NewReader(keyAuth))}, nil
+			},
+		},
+		getWithHeader: func(url string, h http.Header) (*http.Response, error) {
+			gotURL, gotHeader = url, h
+			return &http.Response{Body: io.NopCloser(strings.NewReader(keyAuth))}, nil
+		},
+	}
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		opts       *provisioner.ACMEIPIdentifierOptions
+		wantURL    string
+		wantHeader http.Header
+	}{
+		{"ok default", "192.0.2.1", nil, "http://192.0.2.1/.well-known/acme-challenge/token", nil},
+		{"ok port", "192.0.2.1", &provisioner.ACMEIPIdentifierOptions{HTTP01Port: 8080}, "http://192.0.2.1:8080/.well-known/acme-challenge/token", nil},
+		{"ok ip host header", "192.0.2.1", &provisioner.ACMEIPIdentifierOptions{HTTP01Port: 8080, HTTP01HostHeader: provisioner.HostHeaderIP},
+			"http://192.0.2.1:8080/.well-known/acme-challenge/token", http.Header{"Host": []string{"192.0.2.1"}}},
+		{"ok ipv6 host header", "2001:db8::1", &provisioner.ACMEIPIdentifierOptions{HTTP01Port: 8080, HTTP01HostHeader: provisioner.HostHeaderIP},
+			"http://[2001:db8::1]:8080/.well-known/acme-challenge/token", http.Header{"Host": []string{"[2001:db8::1]"}}},
+		{"ok ip-port host header", "192.0.2.1", &provisioner.ACMEIPIdentifierOptions{HTTP01Port: 8080, HTTP01HostHeader: provisioner.HostHeaderIPPort},
+			"http://192.0.2.1:8080/.well-known/acme-challenge/token", nil},
+		{"ok dns", "zap.internal", &provisioner.ACMEIPIdentifierOptions{HTTP01Port: 8080, HTTP01HostHeader: provisioner.HostHeaderIP},
+			"http://zap.internal/.well-known/acme-challenge/token", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &MockProvisioner{
+				MgetIPIdentifierOptions: func() *provisioner.ACMEIPIdentifierOptions { return tt.opts },
+			}
+			ctx := NewProvisionerContext(NewClientContext(context.Background(), vc), prov)
+			ch := &Challenge{ID: "chID", Token: "token", Value: tt.value, Status: StatusPending}
+			require.NoError(t, http01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+			assert.Equal(t, tt.wantURL, gotURL)
+			assert.Equal(t, tt.wantHeader, gotHeader)
+		})
+	}
+}
+
+func TestTLSALPN01Validate_ipIdentifierOptions(t *testing.T) {
+	var gotAddr string
+	vc := &mockClient{
+		tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+			gotAddr = addr
+			return nil, errors.New("force")
+		},
+	}
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		opts     *provisioner.ACMEIPIdentifierOptions
+		wantAddr string
+	}{
+		{"ok default", "192.0.2.1", nil, "192.0.2.1:443"},
+		{"ok port", "192.0.2.1", &provisioner.ACMEIPIdentifierOptions{TLSALPN01Port: 8443}, "192.0.2.1:8443"},
+		{"ok ipv6 port", "2001:db8::1", &provisioner.ACMEIPIdentifierOptions{TLSALPN01Port: 8443}, "[2001:db8::1]:8443"},
+		{"ok dns", "zap.internal", &provisioner.ACMEIPIdentifierOptions{TLSALPN01Port: 8443}, "zap.internal:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &MockProvisioner{
+				MgetIPIdentifierOptions: func() *provisioner.ACMEIPIdentifierOptions { return tt.opts },
+			}
+			ctx := NewProvisionerContext(NewClientContext(context.Background(), vc), prov)
+			ch := &Challenge{ID: "chID", Token: "token", Value: tt.value, Status: StatusPending}
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, nil))
+			assert.Equal(t, tt.wantAddr, gotAddr)
+		})
+	}
+}
+
 func TestHTTP01Validate(t *testing.T) {
 	type test struct {
 		vc  Client
@@ -3403,6 +3550,83 @@ func Test_deviceAttest01Validate(t *testing.T) {
 				wantErr: nil,
 			}
 		},
+		"ok/permissive-attestation-error": func(t *testing.T) test {
+			ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+				MgetAttestationMode: func() provisioner.ACMEAttestationMode {
+					return provisioner.ACMEAttestationPermissive
+				},
+			})
+			return test{
+				args: args{
+					ctx: ctx,
+					ch: &Challenge{
+						ID:              "chID",
+						AuthorizationID: "azID",
+						Token:           "token",
+						Type:            "device-attest-01",
+						Status:          StatusPending,
+						Value:           "12345678",
+					},
+					payload: errorPayload,
+					db: &MockDB{
+						MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+							assert.Equal(t, "azID", id)
+							return &Authorization{ID: "azID"}, nil
+						},
+						MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+							assert.Equal(t, "azID", az.ID)
+							assert.Equal(t, "", az.Fingerprint)
+							assert.Equal(t, map[string]string{"result": "fail"}, az.Attestation)
+							return nil
+						},
+						MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+							assert.Equal(t, "chID", updch.ID)
+							assert.Equal(t, StatusValid, updch.Status)
+							assert.Nil(t, updch.Error)
+							return nil
+						},
+					},
+				},
+				wantErr: nil,
+			}
+		},
+		"fail/attestation-mode-off": func(t *testing.T) test {
+			ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+				MgetAttestationMode: func() provisioner.ACMEAttestationMode {
+					return provisioner.ACMEAttestationOff
+				},
+			})
+			return test{
+				args: args{
+					ctx: ctx,
+					ch: &Challenge{
+						ID:              "chID",
+						AuthorizationID: "azID",
+						Token:           "token",
+						Type:            "device-attest-01",
+						Status:          StatusPending,
+						Value:           "12345678",
+					},
+					payload: []byte(invalidPayload),
+					db: &MockDB{
+						MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+							assert.Equal(t, "azID", id)
+							return &Authorization{ID: "azID"}, nil
+						},
+						MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+							assert.Equal(t, "chID", updch.ID)
+							assert.Equal(t, StatusInvalid, updch.Status)
+							if assert.NotNil(t, updch.Error) {
+								assert.Equal(t, "urn:ietf:params:acme:error:rejectedIdentifier", updch.Error.Type)
+								assert.Equal(t, "device attestation is disabled by the provisioner", updch.Error.Err.Error())
+							}
+							return nil
+						},
+					},
+				},
+				wantErr: nil,
+			}
+		},
 		"fail/base64-decode": func(t *testing.T) test {
 			return test{
 				args: args{
@@ -4002,7 +4226,11 @@ func Test_deviceAttest01Validate(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			tc := run(t)
 
-			if err := deviceAttest01Validate(tc.args.ctx, tc.args.ch, tc.args.db, tc.args.jwk, tc.args.payload); err != nil {
+			ctx := tc.args.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := deviceAttest01Validate(ctx, tc.args.ch, tc.args.db, tc.args.jwk, tc.args.payload); err != nil {
 				if assert.Error(t, tc.wantErr) {
 					assert.ErrorContains(t, err, tc.wantErr.Error())
 				}
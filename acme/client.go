@@ -3,11 +3,16 @@ package acme
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
 )
 
+// UserAgent is the default User-Agent header sent on the http-01 validation
+// requests.
+var UserAgent = "step-ca-acme-validator/1.0"
+
 // Client is the interface used to verify ACME challenges.
 type Client interface {
 	// Get issues an HTTP GET to the specified URL.
@@ -21,6 +26,15 @@ type Client interface {
 	TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error)
 }
 
+// HeaderClient is implemented by clients that can send custom headers on the
+// http-01 validation requests.
+type HeaderClient interface {
+	// GetWithHeader issues an HTTP GET to the specified URL with the given
+	// headers added to the request. A Host header replaces the host of the
+	// request.
+	GetWithHeader(url string, header http.Header) (*http.Response, error)
+}
+
 type clientKey struct{}
 
 // NewClientContext adds the given client to the context.
@@ -45,31 +59,96 @@ func MustClientFromContext(ctx context.Context) Client {
 }
 
 type client struct {
-	http   *http.Client
-	dialer *net.Dialer
+	http       *http.Client
+	dialer     *net.Dialer
+	sourceAddr net.IP
+}
+
+// ClientOption is the type used to modify the Client created with NewClient.
+type ClientOption func(c *clientOptions)
+
+type clientOptions struct {
+	sourceAddr net.IP
+}
+
+// WithSourceAddress binds the outbound connections used to validate the
+// http-01 and tls-alpn-01 challenges to the given local IP address.
+func WithSourceAddress(ip net.IP) ClientOption {
+	return func(o *clientOptions) {
+		o.sourceAddr = ip
+	}
+}
+
+// CheckSourceAddress verifies that the given IP address is available on the
+// local host and that it can be used as the source of outbound connections.
+func CheckSourceAddress(ip net.IP) error {
+	l, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return fmt.Errorf("acme validation source address %s is not available: %w", ip, err)
+	}
+	return l.Close()
 }
 
 // NewClient returns an implementation of Client for verifying ACME challenges.
-func NewClient() Client {
+func NewClient(opts ...ClientOption) Client {
+	o := new(clientOptions)
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+	dialContext := dialer.DialContext
+	if o.sourceAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: o.sourceAddr}
+		dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("error connecting to %s from source address %s: %w", addr, o.sourceAddr, err)
+			}
+			return conn, nil
+		}
+	}
+
 	return &client{
 		http: &http.Client{
 			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
+				Proxy:       http.ProxyFromEnvironment,
+				DialContext: dialContext,
 				TLSClientConfig: &tls.Config{
 					//nolint:gosec // used on tls-alpn-01 challenge
 					InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
 				},
 			},
 		},
-		dialer: &net.Dialer{
-			Timeout: 30 * time.Second,
-		},
+		dialer:     dialer,
+		sourceAddr: o.sourceAddr,
 	}
 }
 
 func (c *client) Get(url string) (*http.Response, error) {
-	return c.http.Get(url)
+	return c.GetWithHeader(url, nil)
+}
+
+func (c *client) GetWithHeader(url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for k, v := range header {
+		// The Host header is sent from the request Host.
+		if http.CanonicalHeaderKey(k) == "Host" {
+			if len(v) > 0 {
+				req.Host = v[0]
+			}
+			continue
+		}
+		req.Header[k] = v
+	}
+	return c.http.Do(req)
 }
 
 func (c *client) LookupTxt(name string) ([]string, error) {
@@ -77,5 +156,9 @@ func (c *client) LookupTxt(name string) ([]string, error) {
 }
 
 func (c *client) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
-	return tls.DialWithDialer(c.dialer, network, addr, config)
+	conn, err := tls.DialWithDialer(c.dialer, network, addr, config)
+	if err != nil && c.sourceAddr != nil {
+		return nil, fmt.Errorf("error connecting to %s from source address %s: %w", addr, c.sourceAddr, err)
+	}
+	return conn, err
 }
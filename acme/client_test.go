@@ -0,0 +1,91 @@
+package acme
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSourceAddress(t *testing.T) {
+	assert.NoError(t, CheckSourceAddress(net.ParseIP("127.0.0.1")))
+	// 192.0.2.0/24 is reserved for documentation (RFC 5737).
+	err := CheckSourceAddress(net.ParseIP("192.0.2.1"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "acme validation source address 192.0.2.1 is not available")
+	}
+}
+
+func TestNewClient_withSourceAddress(t *testing.T) {
+	var remoteAddr string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(WithSourceAddress(net.ParseIP("127.0.0.1")))
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	host, _, err := net.SplitHostPort(remoteAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+
+	conn, err := c.TLSDial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}) //nolint:gosec // test server
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.TCPAddr).IP.String())
+	conn.Close()
+
+	// Unavailable source address.
+	c = NewClient(WithSourceAddress(net.ParseIP("192.0.2.1")))
+	_, err = c.Get(srv.URL)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "from source address 192.0.2.1")
+	}
+	_, err = c.TLSDial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}) //nolint:gosec // test server
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "from source address 192.0.2.1")
+	}
+}
+
+func TestClient_GetWithHeader(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient()
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, UserAgent, header.Get("User-Agent"))
+
+	resp, err = c.(HeaderClient).GetWithHeader(srv.URL, http.Header{
+		"User-Agent":  []string{"my-validator/1.0"},
+		"X-Validator": []string{"secret"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "my-validator/1.0", header.Get("User-Agent"))
+	assert.Equal(t, "secret", header.Get("X-Validator"))
+
+	var host string
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		io.WriteString(w, "ok")
+	})
+	resp, err = c.(HeaderClient).GetWithHeader(srv.URL, http.Header{
+		"Host": []string{"192.0.2.1"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "192.0.2.1", host)
+}
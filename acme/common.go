@@ -3,6 +3,7 @@ package acme
 import (
 	"context"
 	"crypto/x509"
+	"net/http"
 	"time"
 
 	"github.com/smallstep/certificates/authority"
@@ -78,6 +79,12 @@ type Provisioner interface {
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
 	GetOptions() *provisioner.Options
+	GetRetryAfter() time.Duration
+	GetAttestationExtensions() []provisioner.ACMEAttestationExtension
+	GetAttestationMode() provisioner.ACMEAttestationMode
+	GetHTTP01Header() http.Header
+	GetIPIdentifierOptions() *provisioner.ACMEIPIdentifierOptions
+	GetProfileOptions(name string) (*provisioner.Options, bool)
 }
 
 type provisionerKey struct{}
@@ -120,6 +127,12 @@ type MockProvisioner struct {
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
 	MdefaultTLSCertDuration   func() time.Duration
 	MgetOptions               func() *provisioner.Options
+	MgetRetryAfter            func() time.Duration
+	MgetAttestationExtensions func() []provisioner.ACMEAttestationExtension
+	MgetAttestationMode       func() provisioner.ACMEAttestationMode
+	MgetHTTP01Header          func() http.Header
+	MgetIPIdentifierOptions   func() *provisioner.ACMEIPIdentifierOptions
+	MgetProfileOptions        func(name string) (*provisioner.Options, bool)
 }
 
 // GetName mock
@@ -193,6 +206,54 @@ func (m *MockProvisioner) GetOptions() *provisioner.Options {
 	return m.Mret1.(*provisioner.Options)
 }
 
+// GetRetryAfter mock
+func (m *MockProvisioner) GetRetryAfter() time.Duration {
+	if m.MgetRetryAfter != nil {
+		return m.MgetRetryAfter()
+	}
+	return 0
+}
+
+// GetAttestationExtensions mock
+func (m *MockProvisioner) GetAttestationExtensions() []provisioner.ACMEAttestationExtension {
+	if m.MgetAttestationExtensions != nil {
+		return m.MgetAttestationExtensions()
+	}
+	return nil
+}
+
+// GetAttestationMode mock
+func (m *MockProvisioner) GetAttestationMode() provisioner.ACMEAttestationMode {
+	if m.MgetAttestationMode != nil {
+		return m.MgetAttestationMode()
+	}
+	return provisioner.ACMEAttestationEnforced
+}
+
+// GetHTTP01Header mock
+func (m *MockProvisioner) GetHTTP01Header() http.Header {
+	if m.MgetHTTP01Header != nil {
+		return m.MgetHTTP01Header()
+	}
+	return nil
+}
+
+// GetIPIdentifierOptions mock
+func (m *MockProvisioner) GetIPIdentifierOptions() *provisioner.ACMEIPIdentifierOptions {
+	if m.MgetIPIdentifierOptions != nil {
+		return m.MgetIPIdentifierOptions()
+	}
+	return nil
+}
+
+// GetProfileOptions mock
+func (m *MockProvisioner) GetProfileOptions(name string) (*provisioner.Options, bool) {
+	if m.MgetProfileOptions != nil {
+		return m.MgetProfileOptions(name)
+	}
+	return nil, false
+}
+
 // GetID mock
 func (m *MockProvisioner) GetID() string {
 	if m.MgetID != nil {
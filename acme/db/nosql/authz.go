@@ -12,17 +12,18 @@ import (
 
 // dbAuthz is the base authz type that others build from.
 type dbAuthz struct {
-	ID           string          `json:"id"`
-	AccountID    string          `json:"accountID"`
-	Identifier   acme.Identifier `json:"identifier"`
-	Status       acme.Status     `json:"status"`
-	Token        string          `json:"token"`
-	Fingerprint  string          `json:"fingerprint,omitempty"`
-	ChallengeIDs []string        `json:"challengeIDs"`
-	Wildcard     bool            `json:"wildcard"`
-	CreatedAt    time.Time       `json:"createdAt"`
-	ExpiresAt    time.Time       `json:"expiresAt"`
-	Error        *acme.Error     `json:"error"`
+	ID           string            `json:"id"`
+	AccountID    string            `json:"accountID"`
+	Identifier   acme.Identifier   `json:"identifier"`
+	Status       acme.Status       `json:"status"`
+	Token        string            `json:"token"`
+	Fingerprint  string            `json:"fingerprint,omitempty"`
+	Attestation  map[string]string `json:"attestation,omitempty"`
+	ChallengeIDs []string          `json:"challengeIDs"`
+	Wildcard     bool              `json:"wildcard"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	ExpiresAt    time.Time         `json:"expiresAt"`
+	Error        *acme.Error       `json:"error"`
 }
 
 func (ba *dbAuthz) clone() *dbAuthz {
@@ -71,6 +72,7 @@ func (db *DB) GetAuthorization(ctx context.Context, id string) (*acme.Authorizat
 		ExpiresAt:   dbaz.ExpiresAt,
 		Token:       dbaz.Token,
 		Fingerprint: dbaz.Fingerprint,
+		Attestation: dbaz.Attestation,
 		Error:       dbaz.Error,
 	}, nil
 }
@@ -116,6 +118,7 @@ func (db *DB) UpdateAuthorization(ctx context.Context, az *acme.Authorization) e
 	nu := old.clone()
 	nu.Status = az.Status
 	nu.Fingerprint = az.Fingerprint
+	nu.Attestation = az.Attestation
 	nu.Error = az.Error
 	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
 }
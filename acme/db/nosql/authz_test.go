@@ -554,6 +554,7 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 				Wildcard:    dbaz.Wildcard,
 				ExpiresAt:   dbaz.ExpiresAt,
 				Fingerprint: "fingerprint",
+				Attestation: map[string]string{"format": "step", "serialNumber": "1234"},
 				Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
 			}
 			return test{
@@ -585,6 +586,7 @@ func TestDB_UpdateAuthorization(t *testing.T) {
 						assert.Equals(t, dbNew.CreatedAt, dbaz.CreatedAt)
 						assert.Equals(t, dbNew.ExpiresAt, dbaz.ExpiresAt)
 						assert.Equals(t, dbNew.Fingerprint, dbaz.Fingerprint)
+						assert.Equals(t, dbNew.Attestation, map[string]string{"format": "step", "serialNumber": "1234"})
 						assert.Equals(t, dbNew.Error.Error(), acme.NewError(acme.ErrorMalformedType, "The request message was malformed").Error())
 						return nu, true, nil
 					},
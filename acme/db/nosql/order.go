@@ -23,6 +23,7 @@ type dbOrder struct {
 	Status           acme.Status       `json:"status"`
 	NotBefore        time.Time         `json:"notBefore,omitempty"`
 	NotAfter         time.Time         `json:"notAfter,omitempty"`
+	Profile          string            `json:"profile,omitempty"`
 	CreatedAt        time.Time         `json:"createdAt"`
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
@@ -66,6 +67,7 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		Identifiers:      dbo.Identifiers,
 		NotBefore:        dbo.NotBefore,
 		NotAfter:         dbo.NotAfter,
+		Profile:          dbo.Profile,
 		AuthorizationIDs: dbo.AuthorizationIDs,
 		Error:            dbo.Error,
 	}
@@ -92,6 +94,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		Identifiers:      o.Identifiers,
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
+		Profile:          o.Profile,
 		AuthorizationIDs: o.AuthorizationIDs,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
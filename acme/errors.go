@@ -65,6 +65,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorInvalidProfileType the requested profile is not supported
+	ErrorInvalidProfileType
 )
 
 // String returns the string representation of the acme problem type,
@@ -121,6 +123,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorInvalidProfileType:
+		return "invalidProfile"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -266,6 +270,11 @@ var (
 			details: "Visit the “instance” URL and take actions specified there",
 			status:  400,
 		},
+		ErrorInvalidProfileType: {
+			typ:     officialACMEPrefix + ErrorInvalidProfileType.String(),
+			details: "The requested profile is not supported by the server",
+			status:  400,
+		},
 		ErrorServerInternalType: errorServerInternalMetadata,
 	}
 )
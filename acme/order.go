@@ -44,6 +44,7 @@ type Order struct {
 	Identifiers       []Identifier `json:"identifiers"`
 	NotBefore         time.Time    `json:"notBefore"`
 	NotAfter          time.Time    `json:"notAfter"`
+	Profile           string       `json:"profile,omitempty"`
 	Error             *Error       `json:"error,omitempty"`
 	AuthorizationIDs  []string     `json:"-"`
 	AuthorizationURLs []string     `json:"authorizations"`
@@ -148,6 +149,40 @@ func (o *Order) getAuthorizationFingerprint(ctx context.Context, db DB) (string,
 	return "", nil
 }
 
+// getAuthorizationAttestation returns the fields of the verified device
+// attestation from the list of authorizations. These fields are used on the
+// device-attest-01 flow to add custom extensions to the certificate.
+func (o *Order) getAuthorizationAttestation(ctx context.Context, db DB) (map[string]string, error) {
+	for _, azID := range o.AuthorizationIDs {
+		az, err := db.GetAuthorization(ctx, azID)
+		if err != nil {
+			return nil, WrapErrorISE(err, "error getting authorization %q", azID)
+		}
+		if len(az.Attestation) > 0 {
+			return az.Attestation, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkAuthorizationChallenges returns an error if an authorization of the
+// order was validated with a challenge that is not enabled in the provisioner,
+// e.g. because it was disabled after the validation.
+func (o *Order) checkAuthorizationChallenges(ctx context.Context, db DB, p Provisioner) error {
+	for _, azID := range o.AuthorizationIDs {
+		az, err := db.GetAuthorization(ctx, azID)
+		if err != nil {
+			return WrapErrorISE(err, "error getting authorization %q", azID)
+		}
+		for _, ch := range az.Challenges {
+			if ch.Status == StatusValid && !p.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(ch.Type)) {
+				return NewError(ErrorUnauthorizedType, "order %s was validated with the %s challenge, which is not enabled", o.ID, ch.Type)
+			}
+		}
+	}
+	return nil
+}
+
 // Finalize signs a certificate if the necessary conditions for Order completion
 // have been met.
 //
@@ -173,6 +208,11 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		return NewErrorISE("unexpected status %s for order %s", o.Status, o.ID)
 	}
 
+	// Reject the orders validated with challenges that are not enabled.
+	if err := o.checkAuthorizationChallenges(ctx, db, p); err != nil {
+		return err
+	}
+
 	// Get key fingerprint if any. And then compare it with the CSR fingerprint.
 	//
 	// In device-attest-01 challenges we should check that the keys in the CSR
@@ -222,13 +262,34 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	var defaultTemplate string
 	if permanentIdentifier != "" {
 		defaultTemplate = x509util.DefaultAttestedLeafTemplate
-		data.SetSubjectAlternativeNames(x509util.SubjectAlternativeName{
-			Type:  x509util.PermanentIdentifierType,
-			Value: permanentIdentifier,
-		})
-		extraOptions = append(extraOptions, provisioner.AttestationData{
-			PermanentIdentifier: permanentIdentifier,
-		})
+		fields, err := o.getAuthorizationAttestation(ctx, db)
+		if err != nil {
+			return err
+		}
+		result := provisioner.ACMEAttestationResult(fields[string(provisioner.AttestationResultField)])
+		if result == provisioner.AttestationFail {
+			// In permissive mode the device-attest-01 challenge is valid even
+			// if the attestation cannot be verified, but the permanent
+			// identifier has not been proven, and it is not added to the
+			// certificate.
+			data.SetCommonName("")
+		} else {
+			data.SetSubjectAlternativeNames(x509util.SubjectAlternativeName{
+				Type:  x509util.PermanentIdentifierType,
+				Value: permanentIdentifier,
+			})
+			extraOptions = append(extraOptions, provisioner.AttestationData{
+				PermanentIdentifier: permanentIdentifier,
+			})
+		}
+		// Add the custom extensions with the attested fields, and pass the
+		// result of the attestation to the provisioner.
+		if exts := p.GetAttestationExtensions(); len(exts) > 0 {
+			extraOptions = append(extraOptions, provisioner.NewAttestationExtensionsModifier(exts, fields))
+		}
+		if result != "" {
+			ctx = provisioner.NewContextWithAttestationResult(ctx, result)
+		}
 	} else {
 		defaultTemplate = x509util.DefaultLeafTemplate
 		sans, err := o.sans(csr)
@@ -238,6 +299,17 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		data.SetSubjectAlternativeNames(sans...)
 	}
 
+	// Get the options of the profile selected by the order, the profile is
+	// also applied by the ACME provisioner.
+	var profileOptions *provisioner.Options
+	if o.Profile != "" {
+		var ok bool
+		if profileOptions, ok = p.GetProfileOptions(o.Profile); !ok {
+			return NewError(ErrorInvalidProfileType, "profile %q is not supported", o.Profile)
+		}
+		ctx = provisioner.NewContextWithACMEProfile(ctx, o.Profile)
+	}
+
 	// Get authorizations from the ACME provisioner.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 	signOps, err := p.AuthorizeSign(ctx, "")
@@ -253,7 +325,11 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		}
 	}
 
-	templateOptions, err := provisioner.CustomTemplateOptions(p.GetOptions(), data, defaultTemplate)
+	options := profileOptions
+	if o.Profile == "" {
+		options = p.GetOptions()
+	}
+	templateOptions, err := provisioner.CustomTemplateOptions(options, data, defaultTemplate)
 	if err != nil {
 		return WrapErrorISE(err, "error creating template options from ACME provisioner")
 	}
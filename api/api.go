@@ -21,6 +21,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/sshutil"
 	"golang.org/x/crypto/ssh"
 
@@ -40,9 +41,12 @@ type Authority interface {
 	// context specifies the Authorize[Sign|Revoke|etc.] method.
 	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error)
+	ValidateToken(ctx context.Context, ott string) (provisioner.Interface, *authority.Claims, error)
+	ValidateTokens(ctx context.Context, otts []string) ([]authority.TokenValidation, error)
 	GetTLSOptions() *config.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
 	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	PreviewSign(ctx context.Context, ott string, cr *x509.CertificateRequest, opts provisioner.SignOptions) (*x509.Certificate, error)
 	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
 	RenewContext(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -54,7 +58,15 @@ type Authority interface {
 	GetRoots() ([]*x509.Certificate, error)
 	GetFederation() ([]*x509.Certificate, error)
 	Version() authority.Version
+	IsReady() bool
 	GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error)
+	GetOCSPResponse(req []byte) ([]byte, error)
+	GetResponseSigningKeys() *jose.JSONWebKeySet
+	CheckResponseSigner() error
+	SignResponse(payload []byte) (string, error)
+	IsIdempotencyEnabled() bool
+	LoadIdempotentCertificate(ctx context.Context, key string) ([]*x509.Certificate, bool, error)
+	StoreIdempotentCertificate(ctx context.Context, key string, chain []*x509.Certificate) error
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -255,22 +267,66 @@ func scepFromProvisioner(p *provisioner.SCEP) *models.SCEP {
 	}
 }
 
+// k8sCSRFromProvisioner returns a copy of the K8sCSR provisioner with the
+// bearer token redacted.
+func k8sCSRFromProvisioner(p *provisioner.K8sCSR) *provisioner.K8sCSR {
+	cp := *p
+	if cp.Token != "" {
+		cp.Token = redacted
+	}
+	return &cp
+}
+
+// k8sSAFromProvisioner returns a copy of the K8sSA provisioner with the bearer
+// token of the TokenReview configuration redacted.
+func k8sSAFromProvisioner(p *provisioner.K8sSA) *provisioner.K8sSA {
+	cp := *p
+	if p.TokenReview != nil && p.TokenReview.Token != "" {
+		tr := *p.TokenReview
+		tr.Token = redacted
+		cp.TokenReview = &tr
+	}
+	return &cp
+}
+
+// emailFromProvisioner returns a copy of the Email provisioner with the SMTP
+// password redacted.
+func emailFromProvisioner(p *provisioner.Email) *provisioner.Email {
+	cp := *p
+	if p.SMTP != nil && p.SMTP.Password != "" {
+		smtp := *p.SMTP
+		smtp.Password = redacted
+		cp.SMTP = &smtp
+	}
+	return &cp
+}
+
 // MarshalJSON implements json.Marshaler. It marshals the ProvisionersResponse
 // into a byte slice.
 //
 // Special treatment is given to the SCEP provisioner, as it contains a
 // challenge secret that MUST NOT be leaked in (public) HTTP responses. The
-// challenge value is thus redacted in HTTP responses.
+// challenge value is thus redacted in HTTP responses. The same applies to the
+// bearer tokens of the K8sCSR and K8sSA provisioners, and to the SMTP password
+// of the Email provisioners. The encrypted keys of the
+// JWK provisioners that are references to secrets are removed.
 func (p ProvisionersResponse) MarshalJSON() ([]byte, error) {
 	var responseProvisioners provisioner.List
 	for _, item := range p.Provisioners {
-		scepProv, ok := item.(*provisioner.SCEP)
-		if !ok {
+		switch prov := item.(type) {
+		case *provisioner.SCEP:
+			responseProvisioners = append(responseProvisioners, scepFromProvisioner(prov))
+		case *provisioner.JWK:
+			responseProvisioners = append(responseProvisioners, prov.WithoutSecretReferences())
+		case *provisioner.K8sCSR:
+			responseProvisioners = append(responseProvisioners, k8sCSRFromProvisioner(prov))
+		case *provisioner.K8sSA:
+			responseProvisioners = append(responseProvisioners, k8sSAFromProvisioner(prov))
+		case *provisioner.Email:
+			responseProvisioners = append(responseProvisioners, emailFromProvisioner(prov))
+		default:
 			responseProvisioners = append(responseProvisioners, item)
-			continue
 		}
-
-		responseProvisioners = append(responseProvisioners, scepFromProvisioner(scepProv))
 	}
 
 	var list = struct {
@@ -320,16 +376,27 @@ func New(Authority) RouterHandler {
 func Route(r Router) {
 	r.MethodFunc("GET", "/version", Version)
 	r.MethodFunc("GET", "/health", Health)
+	r.MethodFunc("GET", "/ready", Ready)
 	r.MethodFunc("GET", "/root/{sha}", Root)
 	r.MethodFunc("POST", "/sign", Sign)
+	r.MethodFunc("POST", "/validate", Validate)
+	r.MethodFunc("POST", "/validate/batch", ValidateBatch)
+	r.MethodFunc("POST", "/sign/preview", PreviewSign)
 	r.MethodFunc("POST", "/renew", Renew)
 	r.MethodFunc("POST", "/rekey", Rekey)
 	r.MethodFunc("POST", "/revoke", Revoke)
 	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/ocsp/*", OCSP)
+	r.MethodFunc("POST", "/ocsp", OCSP)
 	r.MethodFunc("GET", "/provisioners", Provisioners)
 	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", ProvisionerKey)
+	r.MethodFunc("GET", "/provisioners/{name}/pop-nonce", ProofOfPossessionNonce)
+	r.MethodFunc("POST", "/provisioners/{name}/email-code", EmailCode)
+	r.MethodFunc("POST", "/provisioners/{name}/email-code/redeem", EmailRedeem)
+	r.MethodFunc("POST", "/provisioners/{name}/k8s-csr", K8sCSRSign)
 	r.MethodFunc("GET", "/roots", Roots)
 	r.MethodFunc("GET", "/roots.pem", RootsPEM)
+	r.MethodFunc("GET", "/response-keys", ResponseKeys)
 	r.MethodFunc("GET", "/federation", Federation)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
@@ -364,6 +431,17 @@ func Health(w http.ResponseWriter, _ *http.Request) {
 	render.JSON(w, HealthResponse{Status: "ok"})
 }
 
+// Ready is an HTTP handler that returns if the server is ready to sign
+// certificates. A server is not ready if the warm-up of the KMS signers has
+// failed.
+func Ready(w http.ResponseWriter, r *http.Request) {
+	if !mustAuthority(r.Context()).IsReady() {
+		render.JSONStatus(w, HealthResponse{Status: "not ready"}, http.StatusServiceUnavailable)
+		return
+	}
+	render.JSON(w, HealthResponse{Status: "ok"})
+}
+
 // Root is an HTTP handler that using the SHA256 from the URL, returns the root
 // certificate for the given SHA256.
 func Root(w http.ResponseWriter, r *http.Request) {
@@ -486,6 +564,24 @@ type stepProvisioner struct {
 	CredentialID []byte
 }
 
+// newClientAddrContext returns a new context with the address of the client of
+// the request, used by the provisioners that restrict the source networks.
+func newClientAddrContext(ctx context.Context, r *http.Request) context.Context {
+	return provisioner.NewContextWithClientAddr(ctx, &provisioner.ClientAddr{
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Values("X-Forwarded-For"),
+	})
+}
+
+// newTLSVersionContext returns a new context with the TLS version negotiated in
+// the connection of the request, if the request has been received over TLS.
+func newTLSVersionContext(ctx context.Context, r *http.Request) context.Context {
+	if r.TLS == nil {
+		return ctx
+	}
+	return provisioner.NewContextWithTLSVersion(ctx, r.TLS.Version)
+}
+
 func logOtt(w http.ResponseWriter, token string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		rl.WithFields(map[string]interface{}{
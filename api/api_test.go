@@ -187,9 +187,12 @@ type mockAuthority struct {
 	err                          error
 	authorize                    func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	authorizeRenewToken          func(ctx context.Context, ott string) (*x509.Certificate, error)
+	validateToken                func(ctx context.Context, ott string) (provisioner.Interface, *authority.Claims, error)
+	validateTokens               func(ctx context.Context, otts []string) ([]authority.TokenValidation, error)
 	getTLSOptions                func() *authority.TLSOptions
 	root                         func(shasum string) (*x509.Certificate, error)
 	signWithContext              func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	previewSign                  func(ctx context.Context, ott string, cr *x509.CertificateRequest, opts provisioner.SignOptions) (*x509.Certificate, error)
 	renew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
 	rekey                        func(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	renewContext                 func(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -201,6 +204,13 @@ type mockAuthority struct {
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
 	getCRL                       func() (*authority.CertificateRevocationListInfo, error)
+	getOCSPResponse              func(req []byte) ([]byte, error)
+	getResponseSigningKeys       func() *jose.JSONWebKeySet
+	checkResponseSigner          func() error
+	signResponse                 func(payload []byte) (string, error)
+	isIdempotencyEnabled         func() bool
+	loadIdempotentCertificate    func(ctx context.Context, key string) ([]*x509.Certificate, bool, error)
+	storeIdempotentCertificate   func(ctx context.Context, key string, chain []*x509.Certificate) error
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -212,6 +222,7 @@ type mockAuthority struct {
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
 	version                      func() authority.Version
+	isReady                      func() bool
 }
 
 func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error) {
@@ -222,6 +233,55 @@ func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRe
 	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
 }
 
+func (m *mockAuthority) GetOCSPResponse(req []byte) ([]byte, error) {
+	if m.getOCSPResponse != nil {
+		return m.getOCSPResponse(req)
+	}
+	return nil, m.err
+}
+
+func (m *mockAuthority) GetResponseSigningKeys() *jose.JSONWebKeySet {
+	if m.getResponseSigningKeys != nil {
+		return m.getResponseSigningKeys()
+	}
+	return nil
+}
+
+func (m *mockAuthority) CheckResponseSigner() error {
+	if m.checkResponseSigner != nil {
+		return m.checkResponseSigner()
+	}
+	return nil
+}
+
+func (m *mockAuthority) SignResponse(payload []byte) (string, error) {
+	if m.signResponse != nil {
+		return m.signResponse(payload)
+	}
+	return "", m.err
+}
+
+func (m *mockAuthority) IsIdempotencyEnabled() bool {
+	if m.isIdempotencyEnabled != nil {
+		return m.isIdempotencyEnabled()
+	}
+	return false
+}
+
+func (m *mockAuthority) LoadIdempotentCertificate(ctx context.Context, key string) ([]*x509.Certificate, bool, error) {
+	if m.loadIdempotentCertificate != nil {
+		return m.loadIdempotentCertificate(ctx, key)
+	}
+	return nil, false, m.err
+}
+
+func (m *mockAuthority) StoreIdempotentCertificate(ctx context.Context, key string, chain []*x509.Certificate) error {
+	if m.storeIdempotentCertificate != nil {
+		return m.storeIdempotentCertificate(ctx, key, chain)
+	}
+	return m.err
+}
+
 // TODO: remove once Authorize is deprecated.
 func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	if m.authorize != nil {
@@ -230,6 +290,20 @@ func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisione
 	return m.ret1.([]provisioner.SignOption), m.err
 }
 
+func (m *mockAuthority) ValidateToken(ctx context.Context, ott string) (provisioner.Interface, *authority.Claims, error) {
+	if m.validateToken != nil {
+		return m.validateToken(ctx, ott)
+	}
+	return m.ret1.(provisioner.Interface), m.ret2.(*authority.Claims), m.err
+}
+
+func (m *mockAuthority) ValidateTokens(ctx context.Context, otts []string) ([]authority.TokenValidation, error) {
+	if m.validateTokens != nil {
+		return m.validateTokens(ctx, otts)
+	}
+	return m.ret1.([]authority.TokenValidation), m.err
+}
+
 func (m *mockAuthority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
 	if m.authorizeRenewToken != nil {
 		return m.authorizeRenewToken(ctx, ott)
@@ -258,6 +332,13 @@ func (m *mockAuthority) SignWithContext(ctx context.Context, cr *x509.Certificat
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) PreviewSign(ctx context.Context, ott string, cr *x509.CertificateRequest, opts provisioner.SignOptions) (*x509.Certificate, error) {
+	if m.previewSign != nil {
+		return m.previewSign(ctx, ott, cr, opts)
+	}
+	return m.ret1.(*x509.Certificate), m.err
+}
+
 func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
 	if m.renew != nil {
 		return m.renew(cert)
@@ -405,6 +486,13 @@ func (m *mockAuthority) Version() authority.Version {
 	return m.ret1.(authority.Version)
 }
 
+func (m *mockAuthority) IsReady() bool {
+	if m.isReady != nil {
+		return m.isReady()
+	}
+	return true
+}
+
 func TestNewCertificate(t *testing.T) {
 	cert := parseCertificate(rootPEM)
 	if !reflect.DeepEqual(Certificate{Certificate: cert}, NewCertificate(cert)) {
@@ -635,15 +723,19 @@ func TestSignRequest_Validate(t *testing.T) {
 		OTT       string
 		NotBefore time.Time
 		NotAfter  time.Time
+		Format    string
 	}
 	tests := []struct {
 		name   string
 		fields fields
 		err    error
 	}{
-		{"missing csr", fields{CertificateRequest{}, "foobarzar", time.Time{}, time.Time{}}, errors.New("missing csr")},
-		{"invalid csr", fields{CertificateRequest{bad}, "foobarzar", time.Time{}, time.Time{}}, errors.New("invalid csr")},
-		{"missing ott", fields{CertificateRequest{csr}, "", time.Time{}, time.Time{}}, errors.New("missing ott")},
+		{"missing csr", fields{CertificateRequest{}, "foobarzar", time.Time{}, time.Time{}, ""}, errors.New("missing csr")},
+		{"invalid csr", fields{CertificateRequest{bad}, "foobarzar", time.Time{}, time.Time{}, ""}, errors.New("invalid csr")},
+		{"missing ott", fields{CertificateRequest{csr}, "", time.Time{}, time.Time{}, ""}, errors.New("missing ott")},
+		{"ok jws", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, JWSFormat}, nil},
+		{"unsupported format", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, "pkcs12"}, errors.New("unsupported format \"pkcs12\"")},
+		{"ok pem-bundle", fields{CertificateRequest{csr}, "foobarzar", time.Time{}, time.Time{}, PEMBundleFormat}, nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -652,6 +744,7 @@ func TestSignRequest_Validate(t *testing.T) {
 				OTT:       tt.fields.OTT,
 				NotAfter:  NewTimeDuration(tt.fields.NotAfter),
 				NotBefore: NewTimeDuration(tt.fields.NotBefore),
+				Format:    tt.fields.Format,
 			}
 			if err := s.Validate(); err != nil {
 				if assert.NotNil(t, tt.err) {
@@ -834,6 +927,42 @@ func Test_Health(t *testing.T) {
 	}
 }
 
+func Test_Ready(t *testing.T) {
+	tests := []struct {
+		name       string
+		ready      bool
+		statusCode int
+		expected   []byte
+	}{
+		{"ok", true, 200, []byte("{\"status\":\"ok\"}\n")},
+		{"not ready", false, 503, []byte("{\"status\":\"not ready\"}\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{isReady: func() bool {
+				return tt.ready
+			}})
+			req := httptest.NewRequest("GET", "http://example.com/ready", http.NoBody)
+			w := httptest.NewRecorder()
+			Ready(w, req)
+
+			res := w.Result()
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Ready StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Ready unexpected error = %v", err)
+			}
+			if !bytes.Equal(body, tt.expected) {
+				t.Errorf("caHandler.Ready Body = %s, wants %s", body, tt.expected)
+			}
+		})
+	}
+}
+
 func Test_Root(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -890,9 +1019,16 @@ func Test_Sign(t *testing.T) {
 		OTT:    "",
 	})
 	require.NoError(t, err)
+	pemBundle, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+		Format: PEMBundleFormat,
+	})
+	require.NoError(t, err)
 
 	expected1 := []byte(`{"crt":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
 	expected2 := []byte(`{"crt":"` + strings.ReplaceAll(stepCertPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(stepCertPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
+	expected3 := []byte(certPEM + "\n" + rootPEM)
 
 	tests := []struct {
 		name         string
@@ -907,6 +1043,7 @@ func Test_Sign(t *testing.T) {
 	}{
 		{"ok", string(valid), nil, nil, parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected1},
 		{"ok with Provisioner", string(valid), nil, nil, parseCertificate(stepCertPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected2},
+		{"ok pem-bundle", string(pemBundle), nil, nil, parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusCreated, expected3},
 		{"json read error", "{", nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"validate error", string(invalid), nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"authorize error", string(valid), nil, fmt.Errorf("an error"), nil, nil, nil, http.StatusUnauthorized, nil},
@@ -947,6 +1084,248 @@ func Test_Sign(t *testing.T) {
 	}
 }
 
+func Test_Sign_jws(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	body, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+		Format: JWSFormat,
+	})
+	require.NoError(t, err)
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, nil)
+	require.NoError(t, err)
+	pub := jwk.Public()
+	keys := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{pub}}
+
+	cert, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		keys       *jose.JSONWebKeySet
+		checkErr   error
+		signErr    error
+		statusCode int
+	}{
+		{"ok", keys, nil, nil, http.StatusCreated},
+		{"fail not configured", nil, nil, nil, http.StatusBadRequest},
+		{"fail response signer unavailable", keys, errs.New(http.StatusServiceUnavailable, "an error"), nil, http.StatusServiceUnavailable},
+		{"fail sign response", keys, nil, errs.InternalServer("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signed bool
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					return nil, nil
+				},
+				signWithContext: func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					signed = true
+					return []*x509.Certificate{cert, root}, nil
+				},
+				checkResponseSigner: func() error {
+					return tt.checkErr
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+				getResponseSigningKeys: func() *jose.JSONWebKeySet {
+					return tt.keys
+				},
+				signResponse: func(payload []byte) (string, error) {
+					if tt.signErr != nil {
+						return "", tt.signErr
+					}
+					jws, err := signer.Sign(payload)
+					if err != nil {
+						return "", err
+					}
+					return jws.CompactSerialize()
+				},
+			})
+			req := httptest.NewRequest("POST", "http://example.com/sign", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			Sign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.keys == nil || tt.checkErr != nil {
+				// The certificate is not issued.
+				assert.False(t, signed)
+			}
+			if tt.statusCode >= http.StatusBadRequest {
+				return
+			}
+
+			assert.Equal(t, "application/jose", res.Header.Get("Content-Type"))
+			jws, err := jose.ParseJWS(string(b))
+			require.NoError(t, err)
+			payload, err := jws.Verify(pub)
+			require.NoError(t, err)
+			var got SignResponsePayload
+			require.NoError(t, json.Unmarshal(payload, &got))
+			assert.Equal(t, cert, got.ServerPEM.Certificate)
+			assert.Equal(t, root, got.CaPEM.Certificate)
+			assert.Equal(t, cert.SerialNumber.String(), got.SerialNumber)
+			assert.True(t, cert.NotBefore.Equal(got.NotBefore))
+			assert.True(t, cert.NotAfter.Equal(got.NotAfter))
+			assert.NotNil(t, got.IssuedAt)
+		})
+	}
+}
+
+func Test_Sign_idempotency(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	body, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+	})
+	require.NoError(t, err)
+	otherToken, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "zarbarfoo",
+	})
+	require.NoError(t, err)
+	badToken, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "badtoken",
+	})
+	require.NoError(t, err)
+
+	root := parseCertificate(rootPEM)
+	certs := []*x509.Certificate{parseCertificate(certPEM), parseCertificate(stepCertPEM)}
+	cache := authority.NewMemoryIdempotencyCache(0)
+	var signed int
+	mockMustAuthority(t, &mockAuthority{
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			if ott == "badtoken" {
+				return nil, errs.Unauthorized("invalid token")
+			}
+			return nil, nil
+		},
+		signWithContext: func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			cert := certs[signed%len(certs)]
+			signed++
+			return []*x509.Certificate{cert, root}, nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+		isIdempotencyEnabled: func() bool {
+			return true
+		},
+		loadIdempotentCertificate: func(ctx context.Context, key string) ([]*x509.Certificate, bool, error) {
+			return cache.Load(ctx, key)
+		},
+		storeIdempotentCertificate: func(ctx context.Context, key string, chain []*x509.Certificate) error {
+			return cache.Store(ctx, key, chain, time.Now().Add(time.Minute))
+		},
+	})
+
+	sign := func(t *testing.T, body []byte, idempotencyKey string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", "http://example.com/sign", bytes.NewReader(body))
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		w := httptest.NewRecorder()
+		Sign(logging.NewResponseLogger(w), req)
+		return w.Result()
+	}
+	serverCert := func(t *testing.T, res *http.Response) *x509.Certificate {
+		t.Helper()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		var sr SignResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&sr))
+		res.Body.Close()
+		return sr.ServerPEM.Certificate
+	}
+
+	// The first request signs a new certificate, and the retry returns it.
+	res := sign(t, body, "")
+	assert.Empty(t, res.Header.Get(IdempotentReplayedHeader))
+	first := serverCert(t, res)
+	assert.Equal(t, certs[0], first)
+	res = sign(t, body, "")
+	assert.Equal(t, "true", res.Header.Get(IdempotentReplayedHeader))
+	assert.Equal(t, first, serverCert(t, res))
+	assert.Equal(t, 1, signed)
+
+	// A new request signs a new certificate.
+	res = sign(t, otherToken, "")
+	assert.Empty(t, res.Header.Get(IdempotentReplayedHeader))
+	assert.Equal(t, certs[1], serverCert(t, res))
+	assert.Equal(t, 2, signed)
+
+	// Retries with the same idempotency key return the same certificate.
+	res = sign(t, body, "request-1")
+	second := serverCert(t, res)
+	assert.Equal(t, certs[0], second)
+	res = sign(t, body, "request-1")
+	assert.Equal(t, "true", res.Header.Get(IdempotentReplayedHeader))
+	assert.Equal(t, second, serverCert(t, res))
+	assert.Equal(t, 3, signed)
+
+	// The idempotency key does not return the certificate to other tokens.
+	res = sign(t, badToken, "request-1")
+	res.Body.Close()
+	assert.Empty(t, res.Header.Get(IdempotentReplayedHeader))
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, 3, signed)
+
+	// Invalid idempotency keys are rejected.
+	res = sign(t, body, "request 1")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = sign(t, body, strings.Repeat("a", 256))
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, 3, signed)
+}
+
+func Test_ResponseKeys(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keys := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}}
+
+	tests := []struct {
+		name       string
+		keys       *jose.JSONWebKeySet
+		statusCode int
+	}{
+		{"ok", keys, http.StatusOK},
+		{"fail not configured", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getResponseSigningKeys: func() *jose.JSONWebKeySet {
+					return tt.keys
+				},
+			})
+			req := httptest.NewRequest("GET", "http://example.com/response-keys", http.NoBody)
+			w := httptest.NewRecorder()
+			ResponseKeys(w, req)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode == http.StatusOK {
+				var got jose.JSONWebKeySet
+				require.NoError(t, json.Unmarshal(b, &got))
+				assert.Equal(t, keys.Keys[0].KeyID, got.Keys[0].KeyID)
+				assert.Equal(t, keys.Keys[0].Key, got.Keys[0].Key)
+			}
+		})
+	}
+}
+
 func Test_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1092,6 +1471,62 @@ func Test_Renew(t *testing.T) {
 	}
 }
 
+func Test_Renew_renewalsRemaining(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	root := parseCertificate(rootPEM)
+	newLeaf := func(t *testing.T, budget *provisioner.RenewalBudget) *x509.Certificate {
+		t.Helper()
+		tmpl := &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "Leaf certificate"},
+			PublicKey: pub,
+			NotBefore: time.Now(),
+			NotAfter:  time.Now().Add(time.Hour),
+		}
+		if budget != nil {
+			ext, err := provisioner.NewRenewalBudgetExtension(*budget)
+			require.NoError(t, err)
+			tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, ext)
+		}
+		cert, err := x509util.CreateCertificate(tmpl, tmpl, pub, priv)
+		require.NoError(t, err)
+		return cert
+	}
+
+	one, zero := 1, 0
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want *int
+	}{
+		{"ok", newLeaf(t, &provisioner.RenewalBudget{Renewals: 2, MaxRenewals: 3}), &one},
+		{"ok last", newLeaf(t, &provisioner.RenewalBudget{Renewals: 3, MaxRenewals: 3}), &zero},
+		{"ok without budget", newLeaf(t, nil), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				ret1: tt.cert, ret2: root,
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			})
+			req := httptest.NewRequest("POST", "http://example.com/renew", http.NoBody)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			w := httptest.NewRecorder()
+			Renew(logging.NewResponseLogger(w), req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, http.StatusCreated, res.StatusCode)
+
+			var got SignResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, tt.want, got.RenewalsRemaining)
+		})
+	}
+}
+
 func Test_Rekey(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1559,6 +1994,32 @@ func TestProvisionersResponse_MarshalJSON(t *testing.T) {
 				Name:         "step-cli",
 				Type:         "JWK",
 			},
+			&provisioner.K8sCSR{
+				Type:         "K8sCSR",
+				Name:         "kubernetes",
+				APIServerURL: "https://kubernetes.default.svc",
+				Token:        "provisioner-token",
+				SignerName:   "ca.example.com/issuer",
+			},
+			&provisioner.K8sSA{
+				Type: "K8sSA",
+				Name: "k8s-sa",
+				TokenReview: &provisioner.K8sSATokenReview{
+					APIServerURL: "https://kubernetes.default.svc",
+					Token:        "token-review-token",
+				},
+			},
+			&provisioner.Email{
+				Type:    "Email",
+				Name:    "contractors",
+				Domains: []string{"example.com"},
+				SMTP: &provisioner.EmailSMTPOptions{
+					Address:  "smtp.example.com:587",
+					From:     "ca@example.com",
+					Username: "ca",
+					Password: "smtp-password",
+				},
+			},
 		},
 		NextCursor: "next",
 	}
@@ -1593,6 +2054,32 @@ func TestProvisionersResponse_MarshalJSON(t *testing.T) {
 				},
 				"encryptedKey": "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIiwicDJjIjoxMDAwMDAsInAycyI6IlhOdmYxQjgxSUlLMFA2NUkwcmtGTGcifQ.XaN9zcPQeWt49zchUDm34FECUTHfQTn_.tmNHPQDqR3ebsWfd.9WZr3YVdeOyJh36vvx0VlRtluhvYp4K7jJ1KGDr1qypwZ3ziBVSNbYYQ71du7fTtrnfG1wgGTVR39tWSzBU-zwQ5hdV3rpMAaEbod5zeW6SHd95H3Bvcb43YiiqJFNL5sGZzFb7FqzVmpsZ1efiv6sZaGDHtnCAL6r12UG5EZuqGfM0jGCZitUz2m9TUKXJL5DJ7MOYbFfkCEsUBPDm_TInliSVn2kMJhFa0VOe5wZk5YOuYM3lNYW64HGtbf-llN2Xk-4O9TfeSPizBx9ZqGpeu8pz13efUDT2WL9tWo6-0UE-CrG0bScm8lFTncTkHcu49_a5NaUBkYlBjEiw.thPcx3t1AUcWuEygXIY3Fg",
 			},
+			{
+				"type":         "K8sCSR",
+				"name":         "kubernetes",
+				"apiServerURL": "https://kubernetes.default.svc",
+				"token":        "*** REDACTED ***",
+				"signerName":   "ca.example.com/issuer",
+			},
+			{
+				"type": "K8sSA",
+				"name": "k8s-sa",
+				"tokenReview": map[string]any{
+					"apiServerURL": "https://kubernetes.default.svc",
+					"token":        "*** REDACTED ***",
+				},
+			},
+			{
+				"type":    "Email",
+				"name":    "contractors",
+				"domains": []string{"example.com"},
+				"smtp": map[string]any{
+					"address":  "smtp.example.com:587",
+					"from":     "ca@example.com",
+					"username": "ca",
+					"password": "*** REDACTED ***",
+				},
+			},
 		},
 		"nextCursor": "next",
 	}
@@ -1625,6 +2112,32 @@ func TestProvisionersResponse_MarshalJSON(t *testing.T) {
 			Name:         "step-cli",
 			Type:         "JWK",
 		},
+		&provisioner.K8sCSR{
+			Type:         "K8sCSR",
+			Name:         "kubernetes",
+			APIServerURL: "https://kubernetes.default.svc",
+			Token:        "provisioner-token",
+			SignerName:   "ca.example.com/issuer",
+		},
+		&provisioner.K8sSA{
+			Type: "K8sSA",
+			Name: "k8s-sa",
+			TokenReview: &provisioner.K8sSATokenReview{
+				APIServerURL: "https://kubernetes.default.svc",
+				Token:        "token-review-token",
+			},
+		},
+		&provisioner.Email{
+			Type:    "Email",
+			Name:    "contractors",
+			Domains: []string{"example.com"},
+			SMTP: &provisioner.EmailSMTPOptions{
+				Address:  "smtp.example.com:587",
+				From:     "ca@example.com",
+				Username: "ca",
+				Password: "smtp-password",
+			},
+		},
 	}
 
 	// MarshalJSON must not affect the struct properties itself
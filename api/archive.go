@@ -0,0 +1,156 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// Media types that can be requested with the Accept header to get the
+// certificate, the intermediates and the root as separate files.
+const (
+	ZipMediaType = "application/zip"
+	TarMediaType = "application/x-tar"
+)
+
+// Names of the files in a certificate archive.
+const (
+	ArchiveLeafName  = "leaf.crt"
+	ArchiveChainName = "chain.crt"
+	ArchiveRootName  = "root.crt"
+)
+
+// acceptedArchive returns the first archive media type in the Accept header of
+// the request, or an empty string if no archive has been requested.
+func acceptedArchive(r *http.Request) string {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case ZipMediaType, TarMediaType:
+			return mediaType
+		}
+	}
+	return ""
+}
+
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+// writeArchive writes the leaf certificate, the intermediates and the root
+// that issued the chain as separate PEM files in an archive of the given media
+// type. The chain and root files are omitted if they are not available.
+func writeArchive(w http.ResponseWriter, r *http.Request, mediaType string, certChain []*x509.Certificate, status int) {
+	roots, err := mustAuthority(r.Context()).GetRoots()
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err, errs.WithMessage("error getting roots")))
+		return
+	}
+
+	files := []archiveFile{
+		{ArchiveLeafName, encodeCertificates(certChain[:1])},
+	}
+	if len(certChain) > 1 {
+		files = append(files, archiveFile{ArchiveChainName, encodeCertificates(certChain[1:])})
+	}
+	if root := findRoot(certChain[len(certChain)-1], roots); root != nil {
+		files = append(files, archiveFile{ArchiveRootName, encodeCertificates([]*x509.Certificate{root})})
+	}
+
+	var buf bytes.Buffer
+	switch mediaType {
+	case TarMediaType:
+		err = writeTar(&buf, files, certChain[0])
+	default:
+		err = writeZip(&buf, files, certChain[0])
+	}
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err, errs.WithMessage("error creating archive")))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Error(w, err)
+	}
+}
+
+// writeTar writes the files in a tar archive. The modification time of the
+// files is the start of the validity of the leaf.
+func writeTar(buf *bytes.Buffer, files []archiveFile, leaf *x509.Certificate) error {
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0644,
+			Size:     int64(len(f.data)),
+			ModTime:  leaf.NotBefore,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeZip writes the files in a zip archive. The modification time of the
+// files is the start of the validity of the leaf.
+func writeZip(buf *bytes.Buffer, files []archiveFile, leaf *x509.Certificate) error {
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: leaf.NotBefore,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// findRoot returns the root that issued the given certificate, or nil if the
+// certificate is not issued by one of the roots or is a root itself.
+func findRoot(cert *x509.Certificate, roots []*x509.Certificate) *x509.Certificate {
+	for _, root := range roots {
+		if bytes.Equal(cert.Raw, root.Raw) {
+			return nil
+		}
+		if cert.CheckSignatureFrom(root) == nil {
+			return root
+		}
+	}
+	return nil
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	return b
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+)
+
+func Test_acceptedArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"json", "application/json", ""},
+		{"zip", "application/zip", ZipMediaType},
+		{"tar", "application/x-tar", TarMediaType},
+		{"first", "application/json, application/x-tar;q=0.5, application/zip", TarMediaType},
+		{"rejected", "application/zip;q=0, application/json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/sign", http.NoBody)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			assert.Equal(t, tt.want, acceptedArchive(r))
+		})
+	}
+}
+
+func Test_writeArchive(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		DNSNames:  []string{"test.smallstep.com"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+
+	certChain := []*x509.Certificate{leaf, ca.Intermediate}
+	mockMustAuthority(t, &mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{ca.Root}, nil
+		},
+	})
+	want := map[string][]byte{
+		ArchiveLeafName:  encodeCertificates([]*x509.Certificate{leaf}),
+		ArchiveChainName: encodeCertificates([]*x509.Certificate{ca.Intermediate}),
+		ArchiveRootName:  encodeCertificates([]*x509.Certificate{ca.Root}),
+	}
+
+	readZip := func(t *testing.T, b []byte) map[string][]byte {
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			files[f.Name], err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+		return files
+	}
+	readTar := func(t *testing.T, b []byte) map[string][]byte {
+		tr := tar.NewReader(bytes.NewReader(b))
+		files := map[string][]byte{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			files[hdr.Name], err = io.ReadAll(tr)
+			require.NoError(t, err)
+		}
+		return files
+	}
+
+	tests := []struct {
+		name      string
+		mediaType string
+		read      func(*testing.T, []byte) map[string][]byte
+	}{
+		{"zip", ZipMediaType, readZip},
+		{"tar", TarMediaType, readTar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/sign", http.NoBody)
+			w := httptest.NewRecorder()
+			writeArchive(w, r, tt.mediaType, certChain, http.StatusCreated)
+			res := w.Result()
+			assert.Equal(t, http.StatusCreated, res.StatusCode)
+			assert.Equal(t, tt.mediaType, res.Header.Get("Content-Type"))
+			assert.Equal(t, want, tt.read(t, w.Body.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// EmailCodeRequest is the request body of the email code request.
+type EmailCodeRequest struct {
+	Email string `json:"email"`
+}
+
+// Validate checks the fields of the EmailCodeRequest.
+func (r *EmailCodeRequest) Validate() error {
+	if r.Email == "" {
+		return errs.BadRequest("missing email")
+	}
+	return nil
+}
+
+// EmailCodeResponse is the response object of the email code request.
+type EmailCodeResponse struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// EmailRedeemRequest is the request body used to redeem an email code for a
+// certificate.
+type EmailRedeemRequest struct {
+	Email     string             `json:"email"`
+	Code      string             `json:"code"`
+	CsrPEM    CertificateRequest `json:"csr"`
+	NotAfter  TimeDuration       `json:"notAfter,omitempty"`
+	NotBefore TimeDuration       `json:"notBefore,omitempty"`
+}
+
+// Validate checks the fields of the EmailRedeemRequest.
+func (r *EmailRedeemRequest) Validate() error {
+	switch {
+	case r.Email == "":
+		return errs.BadRequest("missing email")
+	case r.Code == "":
+		return errs.BadRequest("missing code")
+	case r.CsrPEM.CertificateRequest == nil:
+		return errs.BadRequest("missing csr")
+	}
+	if err := r.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return errs.BadRequestErr(err, "invalid csr")
+	}
+	return nil
+}
+
+// loadEmailProvisioner returns the provisioner with the name in the URL if it
+// sends email codes.
+func loadEmailProvisioner(r *http.Request) (provisioner.Interface, provisioner.EmailCodeSender, error) {
+	name := chi.URLParam(r, "name")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		return nil, nil, errs.NotFoundErr(err)
+	}
+	sender, ok := p.(provisioner.EmailCodeSender)
+	if !ok {
+		return nil, nil, errs.BadRequest("provisioner %q does not support email codes", name)
+	}
+	return p, sender, nil
+}
+
+// EmailCode sends a one-time code to the email address in the body using the
+// given provisioner. The code can be redeemed for a certificate with
+// EmailRedeem.
+func EmailCode(w http.ResponseWriter, r *http.Request) {
+	var body EmailCodeRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	_, sender, err := loadEmailProvisioner(r)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	ctx := newClientAddrContext(r.Context(), r)
+	expiresAt, err := sender.SendEmailCode(ctx, body.Email)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	render.JSONStatus(w, &EmailCodeResponse{
+		ExpiresAt: expiresAt,
+	}, http.StatusAccepted)
+}
+
+// EmailRedeem redeems a one-time code sent with EmailCode and creates a new
+// certificate for the email address with the information in the certificate
+// request.
+func EmailRedeem(w http.ResponseWriter, r *http.Request) {
+	var body EmailRedeemRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	p, _, err := loadEmailProvisioner(r)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := authority.NewWarningsContext(r.Context())
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = newClientAddrContext(ctx, r)
+	ctx = newTLSVersionContext(ctx, r)
+	ctx = provisioner.NewContextWithEmail(ctx, body.Email)
+	signOpts, err := p.AuthorizeSign(ctx, body.Code)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	a := mustAuthority(ctx)
+	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, provisioner.SignOptions{
+		NotBefore: body.NotBefore,
+		NotAfter:  body.NotAfter,
+	}, signOpts...)
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error signing certificate"))
+		return
+	}
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	render.JSONStatus(w, &SignResponse{
+		ServerPEM:    certChainPEM[0],
+		CaPEM:        caPEM,
+		CertChainPEM: certChainPEM,
+		TLSOptions:   a.GetTLSOptions(),
+		Warnings:     authority.WarningsFromContext(ctx),
+	}, http.StatusCreated)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+type emailProvisioner struct {
+	provisioner.Interface
+	expiresAt time.Time
+	err       error
+	authorize func(ctx context.Context, code string) ([]provisioner.SignOption, error)
+}
+
+func (p *emailProvisioner) SendEmailCode(_ context.Context, email string) (time.Time, error) {
+	if email != "jane@example.com" {
+		return time.Time{}, errs.Forbidden("email domain is not allowed")
+	}
+	return p.expiresAt, p.err
+}
+
+func (p *emailProvisioner) AuthorizeSign(ctx context.Context, code string) ([]provisioner.SignOption, error) {
+	return p.authorize(ctx, code)
+}
+
+func newEmailRequest(t *testing.T, url, body string) *http.Request {
+	t.Helper()
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("name", "contractors")
+	req := httptest.NewRequest("POST", url, strings.NewReader(body))
+	return req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+}
+
+func Test_EmailCode(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute).Truncate(time.Second).UTC()
+	tests := []struct {
+		name       string
+		body       string
+		prov       provisioner.Interface
+		err        error
+		statusCode int
+	}{
+		{"ok", `{"email":"jane@example.com"}`, &emailProvisioner{expiresAt: expiresAt}, nil, http.StatusAccepted},
+		{"fail/read", `{`, nil, nil, http.StatusBadRequest},
+		{"fail/validate", `{}`, nil, nil, http.StatusBadRequest},
+		{"fail/not-found", `{"email":"jane@example.com"}`, nil, errors.New("provisioner not found"), http.StatusNotFound},
+		{"fail/not-supported", `{"email":"jane@example.com"}`, &provisioner.SSHPOP{}, nil, http.StatusBadRequest},
+		{"fail/domain", `{"email":"jane@other.com"}`, &emailProvisioner{expiresAt: expiresAt}, nil, http.StatusForbidden},
+		{"fail/send", `{"email":"jane@example.com"}`, &emailProvisioner{err: errs.InternalServer("error sending code")}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					assert.Equal(t, "contractors", name)
+					return tt.prov, tt.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			EmailCode(w, newEmailRequest(t, "http://example.com/provisioners/contractors/email-code", tt.body))
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusAccepted {
+				var got EmailCodeResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.True(t, expiresAt.Equal(got.ExpiresAt))
+			}
+		})
+	}
+}
+
+func Test_EmailRedeem(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(EmailRedeemRequest{
+		Email:  "jane@example.com",
+		Code:   "12345678",
+		CsrPEM: CertificateRequest{csr},
+	})
+	require.NoError(t, err)
+	missingCode, err := json.Marshal(EmailRedeemRequest{
+		Email:  "jane@example.com",
+		CsrPEM: CertificateRequest{csr},
+	})
+	require.NoError(t, err)
+
+	authorize := func(ctx context.Context, code string) ([]provisioner.SignOption, error) {
+		email, ok := provisioner.EmailFromContext(ctx)
+		if !ok || email != "jane@example.com" || code != "12345678" {
+			return nil, errs.Unauthorized("code is not valid")
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		prov       provisioner.Interface
+		signErr    error
+		statusCode int
+	}{
+		{"ok", string(valid), &emailProvisioner{authorize: authorize}, nil, http.StatusCreated},
+		{"fail/read", `{`, &emailProvisioner{authorize: authorize}, nil, http.StatusBadRequest},
+		{"fail/validate", string(missingCode), &emailProvisioner{authorize: authorize}, nil, http.StatusBadRequest},
+		{"fail/not-supported", string(valid), &provisioner.SSHPOP{}, nil, http.StatusBadRequest},
+		{"fail/authorize", strings.Replace(string(valid), "12345678", "87654321", 1), &emailProvisioner{authorize: authorize}, nil, http.StatusUnauthorized},
+		{"fail/sign", string(valid), &emailProvisioner{authorize: authorize}, errors.New("an error"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					return tt.prov, nil
+				},
+				signWithContext: func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					if tt.signErr != nil {
+						return nil, tt.signErr
+					}
+					return []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			EmailRedeem(logging.NewResponseLogger(w), newEmailRequest(t, "http://example.com/provisioners/contractors/email-code/redeem", tt.body))
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusCreated {
+				var got SignResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, parseCertificate(certPEM), got.ServerPEM.Certificate)
+				assert.Len(t, got.CertChainPEM, 2)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// K8sCSRSignRequest is the request body used to get a certificate for an
+// approved Kubernetes CertificateSigningRequest.
+type K8sCSRSignRequest struct {
+	CSRName   string             `json:"csrName"`
+	CsrPEM    CertificateRequest `json:"csr"`
+	NotAfter  TimeDuration       `json:"notAfter,omitempty"`
+	NotBefore TimeDuration       `json:"notBefore,omitempty"`
+}
+
+// Validate checks the fields of the K8sCSRSignRequest.
+func (r *K8sCSRSignRequest) Validate() error {
+	switch {
+	case r.CSRName == "":
+		return errs.BadRequest("missing csrName")
+	case r.CsrPEM.CertificateRequest == nil:
+		return errs.BadRequest("missing csr")
+	}
+	if err := r.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return errs.BadRequestErr(err, "invalid csr")
+	}
+	return nil
+}
+
+// K8sCSRSign creates a new certificate for the Kubernetes
+// CertificateSigningRequest in the body, using the K8sCSR provisioner in the
+// URL. The CertificateSigningRequest must be approved, and the certificate
+// request in the body must be the one in the CertificateSigningRequest.
+func K8sCSRSign(w http.ResponseWriter, r *http.Request) {
+	var body K8sCSRSignRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, errs.NotFoundErr(err))
+		return
+	}
+	if p.GetType() != provisioner.TypeK8sCSR {
+		render.Error(w, errs.BadRequest("provisioner %q does not support kubernetes certificate signing requests", name))
+		return
+	}
+
+	ctx := authority.NewWarningsContext(r.Context())
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = newClientAddrContext(ctx, r)
+	ctx = newTLSVersionContext(ctx, r)
+	signOpts, err := p.AuthorizeSign(ctx, body.CSRName)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	a := mustAuthority(ctx)
+	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, provisioner.SignOptions{
+		NotBefore: body.NotBefore,
+		NotAfter:  body.NotAfter,
+	}, signOpts...)
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error signing certificate"))
+		return
+	}
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	render.JSONStatus(w, &SignResponse{
+		ServerPEM:    certChainPEM[0],
+		CaPEM:        caPEM,
+		CertChainPEM: certChainPEM,
+		TLSOptions:   a.GetTLSOptions(),
+		Warnings:     authority.WarningsFromContext(ctx),
+	}, http.StatusCreated)
+}
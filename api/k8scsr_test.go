@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+type k8sCSRProvisioner struct {
+	provisioner.Interface
+}
+
+func (p *k8sCSRProvisioner) GetType() provisioner.Type {
+	return provisioner.TypeK8sCSR
+}
+
+func (p *k8sCSRProvisioner) AuthorizeSign(_ context.Context, name string) ([]provisioner.SignOption, error) {
+	if name != "web-1" {
+		return nil, errs.Unauthorized("certificate signing request is not approved")
+	}
+	return nil, nil
+}
+
+func Test_K8sCSRSign(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(K8sCSRSignRequest{
+		CSRName: "web-1",
+		CsrPEM:  CertificateRequest{csr},
+	})
+	require.NoError(t, err)
+	missingName, err := json.Marshal(K8sCSRSignRequest{
+		CsrPEM: CertificateRequest{csr},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		prov       provisioner.Interface
+		loadErr    error
+		signErr    error
+		statusCode int
+	}{
+		{"ok", string(valid), &k8sCSRProvisioner{}, nil, nil, http.StatusCreated},
+		{"fail/read", `{`, &k8sCSRProvisioner{}, nil, nil, http.StatusBadRequest},
+		{"fail/validate", string(missingName), &k8sCSRProvisioner{}, nil, nil, http.StatusBadRequest},
+		{"fail/not-found", string(valid), nil, errors.New("provisioner not found"), nil, http.StatusNotFound},
+		{"fail/not-supported", string(valid), &provisioner.SSHPOP{}, nil, nil, http.StatusBadRequest},
+		{"fail/authorize", strings.Replace(string(valid), "web-1", "web-2", 1), &k8sCSRProvisioner{}, nil, nil, http.StatusUnauthorized},
+		{"fail/sign", string(valid), &k8sCSRProvisioner{}, nil, errors.New("an error"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					assert.Equal(t, "kubernetes", name)
+					return tt.prov, tt.loadErr
+				},
+				signWithContext: func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					if tt.signErr != nil {
+						return nil, tt.signErr
+					}
+					return []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("name", "kubernetes")
+			req := httptest.NewRequest("POST", "http://example.com/provisioners/kubernetes/k8s-csr", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+
+			w := httptest.NewRecorder()
+			K8sCSRSign(logging.NewResponseLogger(w), req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusCreated {
+				var got SignResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, parseCertificate(certPEM), got.ServerPEM.Certificate)
+				assert.Len(t, got.CertChainPEM, 2)
+			}
+		})
+	}
+}
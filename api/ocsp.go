@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// maxOCSPRequestSize is the maximum size of an OCSP request sent using the
+// POST method.
+const maxOCSPRequestSize = 10 * 1024
+
+// OCSP is an HTTP handler that returns the OCSP response for an OCSP request.
+// As defined in RFC 6960, the request is sent as the body of a POST, or base64
+// and url encoded in the path of a GET.
+func OCSP(w http.ResponseWriter, r *http.Request) {
+	var req []byte
+	if r.Method == http.MethodGet {
+		s, err := url.PathUnescape(chi.URLParam(r, "*"))
+		if err == nil {
+			req, err = base64.StdEncoding.DecodeString(s)
+		}
+		if err != nil {
+			writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+	} else {
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+		if err != nil {
+			render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+			return
+		}
+		req = b
+	}
+
+	resp, err := mustAuthority(r.Context()).GetOCSPResponse(req)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	writeOCSPResponse(w, resp)
+}
+
+func writeOCSPResponse(w http.ResponseWriter, resp []byte) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	if _, err := w.Write(resp); err != nil {
+		log.Error(w, err)
+	}
+}
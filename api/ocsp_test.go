@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_OCSP(t *testing.T) {
+	ocspReq := []byte{0xfb, 0xff, 0x01}
+	ocspResp := []byte{1, 2, 3, 4}
+	tests := []struct {
+		name              string
+		method            string
+		param             string
+		body              []byte
+		err               error
+		statusCode        int
+		expectedBody      []byte
+		expectedErrorJSON string
+	}{
+		{"ok/get", "GET", "%2B%2F8B", nil, nil, http.StatusOK, ocspResp, ""},
+		{"ok/get-unescaped", "GET", "+/8B", nil, nil, http.StatusOK, ocspResp, ""},
+		{"ok/post", "POST", "", ocspReq, nil, http.StatusOK, ocspResp, ""},
+		{"ok/get-malformed", "GET", "not-base64", nil, nil, http.StatusOK, ocsp.MalformedRequestErrorResponse, ""},
+		{"fail/not-found", "POST", "", ocspReq, errs.NotFound("OCSP responder is not configured"), http.StatusNotFound, nil, `{"status":404,"message":"The requested resource could not be found. Please see the certificate authority logs for more info."}`},
+		{"fail/internal", "POST", "", ocspReq, errs.Wrap(http.StatusInternalServerError, errors.New("failure"), "authority.GetOCSPResponse"), http.StatusInternalServerError, nil, `{"status":500,"message":"The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info."}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getOCSPResponse: func(req []byte) ([]byte, error) {
+					assert.Equal(t, ocspReq, req)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return ocspResp, nil
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			url := "http://example.com/ocsp"
+			if tt.method == "GET" {
+				chiCtx.URLParams.Add("*", tt.param)
+				url += "/" + tt.param
+			}
+			req := httptest.NewRequest(tt.method, url, bytes.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			OCSP(w, req)
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			if tt.statusCode >= 300 {
+				assert.JSONEq(t, tt.expectedErrorJSON, string(bytes.TrimSpace(body)))
+				return
+			}
+
+			assert.Equal(t, "application/ocsp-response", res.Header.Get("Content-Type"))
+			assert.Equal(t, tt.expectedBody, body)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// ProofOfPossessionNonceResponse is the response object of the proof of
+// possession nonce request.
+type ProofOfPossessionNonceResponse struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ProofOfPossessionNonce returns a new nonce issued by the given provisioner.
+// The client must sign it with the key of the CSR and add it to the sign token
+// if the provisioner requires the proof of possession of the CSR key.
+func ProofOfPossessionNonce(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, errs.NotFoundErr(err))
+		return
+	}
+	noncer, ok := p.(provisioner.ProofOfPossessionNoncer)
+	if !ok {
+		render.Error(w, errs.BadRequest("provisioner %q does not support proof of possession", name))
+		return
+	}
+	nonce, expiresAt, err := noncer.NewProofOfPossessionNonce()
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	render.JSON(w, &ProofOfPossessionNonceResponse{
+		Nonce:     nonce,
+		ExpiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+type popProvisioner struct {
+	provisioner.Interface
+	nonce     string
+	expiresAt time.Time
+	err       error
+}
+
+func (p *popProvisioner) NewProofOfPossessionNonce() (string, time.Time, error) {
+	return p.nonce, p.expiresAt, p.err
+}
+
+func Test_ProofOfPossessionNonce(t *testing.T) {
+	expiresAt := time.Now().Add(5 * time.Minute).Truncate(time.Second).UTC()
+	tests := []struct {
+		name       string
+		prov       provisioner.Interface
+		err        error
+		statusCode int
+		want       *ProofOfPossessionNonceResponse
+	}{
+		{"ok", &popProvisioner{nonce: "the-nonce", expiresAt: expiresAt}, nil, http.StatusOK, &ProofOfPossessionNonceResponse{Nonce: "the-nonce", ExpiresAt: expiresAt}},
+		{"fail/not-found", nil, errors.New("provisioner not found"), http.StatusNotFound, nil},
+		{"fail/not-supported", &provisioner.SSHPOP{}, nil, http.StatusBadRequest, nil},
+		{"fail/not-enabled", &popProvisioner{err: errs.BadRequest("proof of possession is not enabled")}, nil, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					assert.Equal(t, "my-provisioner", name)
+					return tt.prov, tt.err
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("name", "my-provisioner")
+			req := httptest.NewRequest("GET", "http://example.com/provisioners/my-provisioner/pop-nonce", http.NoBody)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			ProofOfPossessionNonce(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.want != nil {
+				var got ProofOfPossessionNonceResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, tt.want.Nonce, got.Nonce)
+				assert.True(t, tt.want.ExpiresAt.Equal(got.ExpiresAt))
+			}
+		})
+	}
+}
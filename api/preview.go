@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// PreviewSignResponse is the response object of the sign preview request. It
+// contains the fields of the certificate that would be issued for the sign
+// request.
+type PreviewSignResponse struct {
+	Subject               x509util.Subject            `json:"subject"`
+	DNSNames              []string                    `json:"dnsNames,omitempty"`
+	EmailAddresses        []string                    `json:"emailAddresses,omitempty"`
+	IPAddresses           []net.IP                    `json:"ipAddresses,omitempty"`
+	URIs                  x509util.MultiURL           `json:"uris,omitempty"`
+	NotBefore             time.Time                   `json:"notBefore"`
+	NotAfter              time.Time                   `json:"notAfter"`
+	KeyUsage              x509util.KeyUsage           `json:"keyUsage"`
+	ExtKeyUsage           x509util.ExtKeyUsage        `json:"extKeyUsage,omitempty"`
+	UnknownExtKeyUsage    x509util.UnknownExtKeyUsage `json:"unknownExtKeyUsage,omitempty"`
+	BasicConstraints      *x509util.BasicConstraints  `json:"basicConstraints,omitempty"`
+	OCSPServer            []string                    `json:"ocspServer,omitempty"`
+	IssuingCertificateURL []string                    `json:"issuingCertificateURL,omitempty"`
+	CRLDistributionPoints []string                    `json:"crlDistributionPoints,omitempty"`
+	PolicyIdentifiers     x509util.PolicyIdentifiers  `json:"policyIdentifiers,omitempty"`
+	Extensions            []x509util.Extension        `json:"extensions,omitempty"`
+	SignatureAlgorithm    x509util.SignatureAlgorithm `json:"signatureAlgorithm"`
+	PublicKeyAlgorithm    string                      `json:"publicKeyAlgorithm"`
+}
+
+// newPreviewSignResponse returns the response with the fields of the given
+// unsigned certificate.
+func newPreviewSignResponse(cert *x509.Certificate) *PreviewSignResponse {
+	resp := &PreviewSignResponse{
+		Subject: x509util.Subject{
+			Country:            cert.Subject.Country,
+			Organization:       cert.Subject.Organization,
+			OrganizationalUnit: cert.Subject.OrganizationalUnit,
+			Locality:           cert.Subject.Locality,
+			Province:           cert.Subject.Province,
+			StreetAddress:      cert.Subject.StreetAddress,
+			PostalCode:         cert.Subject.PostalCode,
+			SerialNumber:       cert.Subject.SerialNumber,
+			CommonName:         cert.Subject.CommonName,
+			ExtraNames:         x509util.NewExtraNames(cert.Subject.ExtraNames),
+		},
+		DNSNames:              cert.DNSNames,
+		EmailAddresses:        cert.EmailAddresses,
+		IPAddresses:           cert.IPAddresses,
+		URIs:                  cert.URIs,
+		NotBefore:             cert.NotBefore.UTC(),
+		NotAfter:              cert.NotAfter.UTC(),
+		KeyUsage:              x509util.KeyUsage(cert.KeyUsage),
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		UnknownExtKeyUsage:    cert.UnknownExtKeyUsage,
+		OCSPServer:            cert.OCSPServer,
+		IssuingCertificateURL: cert.IssuingCertificateURL,
+		CRLDistributionPoints: cert.CRLDistributionPoints,
+		PolicyIdentifiers:     cert.PolicyIdentifiers,
+		SignatureAlgorithm:    x509util.SignatureAlgorithm(cert.SignatureAlgorithm),
+		PublicKeyAlgorithm:    cert.PublicKeyAlgorithm.String(),
+	}
+	if cert.BasicConstraintsValid {
+		resp.BasicConstraints = &x509util.BasicConstraints{
+			IsCA:       cert.IsCA,
+			MaxPathLen: cert.MaxPathLen,
+		}
+	}
+	for _, ext := range cert.ExtraExtensions {
+		resp.Extensions = append(resp.Extensions, x509util.Extension{
+			ID:       x509util.ObjectIdentifier(ext.Id),
+			Critical: ext.Critical,
+			Value:    ext.Value,
+		})
+	}
+	return resp
+}
+
+// PreviewSign is an HTTP handler that reads a sign request and returns the
+// certificate that the CA would issue for it, without signing it. The request
+// is authorized like a sign request in a dry run, but the token is not marked
+// as used, so it can still be used to sign the certificate. The number of
+// previews with the same token is rate limited.
+func PreviewSign(w http.ResponseWriter, r *http.Request) {
+	var body SignRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	opts := provisioner.SignOptions{
+		NotBefore:          body.NotBefore,
+		NotAfter:           body.NotAfter,
+		TemplateData:       body.TemplateData,
+		SignatureAlgorithm: body.SignatureAlgorithm,
+	}
+
+	ctx := newClientAddrContext(r.Context(), r)
+	ctx = newTLSVersionContext(ctx, r)
+	cert, err := mustAuthority(ctx).PreviewSign(ctx, body.OTT, body.CsrPEM.CertificateRequest, opts)
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error previewing certificate"))
+		return
+	}
+
+	render.JSON(w, newPreviewSignResponse(cert))
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_PreviewSign(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+	})
+	require.NoError(t, err)
+	invalid, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+	})
+	require.NoError(t, err)
+
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test.example.com"},
+		DNSNames:              []string{"test.example.com"},
+		IPAddresses:           []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: []int{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}, Value: []byte("provisioner")},
+		},
+		PublicKeyAlgorithm: x509.ECDSA,
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		err        error
+		statusCode int
+	}{
+		{"ok", string(valid), nil, http.StatusOK},
+		{"fail json", "{", nil, http.StatusBadRequest},
+		{"fail validate", string(invalid), nil, http.StatusBadRequest},
+		{"fail preview", string(valid), errs.Unauthorized("force"), http.StatusUnauthorized},
+		{"fail other", string(valid), errors.New("force"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				previewSign: func(ctx context.Context, ott string, cr *x509.CertificateRequest, opts provisioner.SignOptions) (*x509.Certificate, error) {
+					assert.Equal(t, "foobarzar", ott)
+					assert.Equal(t, csr.Raw, cr.Raw)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return cert, nil
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/sign/preview", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			PreviewSign(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var got PreviewSignResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, "test.example.com", got.Subject.CommonName)
+				assert.Equal(t, []string{"test.example.com"}, got.DNSNames)
+				assert.True(t, got.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")))
+				assert.Equal(t, notBefore, got.NotBefore)
+				assert.Equal(t, notBefore.Add(24*time.Hour), got.NotAfter)
+				assert.Equal(t, x509util.KeyUsage(x509.KeyUsageDigitalSignature), got.KeyUsage)
+				assert.Equal(t, x509util.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, got.ExtKeyUsage)
+				assert.Equal(t, &x509util.BasicConstraints{IsCA: false, MaxPathLen: 0}, got.BasicConstraints)
+				if assert.Len(t, got.Extensions, 1) {
+					assert.Equal(t, x509util.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}, got.Extensions[0].ID)
+					assert.Equal(t, []byte("provisioner"), got.Extensions[0].Value)
+				}
+				assert.Equal(t, "ECDSA", got.PublicKeyAlgorithm)
+			}
+		})
+	}
+}
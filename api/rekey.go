@@ -57,10 +57,15 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	LogCertificate(w, certChain[0])
+	if mediaType := acceptedArchive(r); mediaType != "" {
+		writeArchive(w, r, mediaType, certChain, http.StatusCreated)
+		return
+	}
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:         certChainPEM[0],
+		CaPEM:             caPEM,
+		CertChainPEM:      certChainPEM,
+		TLSOptions:        a.GetTLSOptions(),
+		RenewalsRemaining: renewalsRemaining(certChain[0]),
 	}, http.StatusCreated)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -18,7 +19,7 @@ const (
 // Renew uses the information of certificate in the TLS connection to create a
 // new one.
 func Renew(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := authority.NewWarningsContext(r.Context())
 
 	// Get the leaf certificate from the peer or the token.
 	cert, token, err := getPeerCertificate(r)
@@ -45,14 +46,31 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 	}
 
 	LogCertificate(w, certChain[0])
+	if mediaType := acceptedArchive(r); mediaType != "" {
+		writeArchive(w, r, mediaType, certChain, http.StatusCreated)
+		return
+	}
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:         certChainPEM[0],
+		CaPEM:             caPEM,
+		CertChainPEM:      certChainPEM,
+		TLSOptions:        a.GetTLSOptions(),
+		Warnings:          authority.WarningsFromContext(ctx),
+		RenewalsRemaining: renewalsRemaining(certChain[0]),
 	}, http.StatusCreated)
 }
 
+// renewalsRemaining returns the number of renewals left for the given
+// certificate, or nil if the certificate does not have a renewal budget.
+func renewalsRemaining(cert *x509.Certificate) *int {
+	b, ok := provisioner.GetRenewalBudget(cert)
+	if !ok {
+		return nil
+	}
+	remaining := b.Remaining()
+	return &remaining
+}
+
 func getPeerCertificate(r *http.Request) (*x509.Certificate, string, error) {
 	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
 		return r.TLS.PeerCertificates[0], "", nil
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/log"
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
@@ -14,13 +21,39 @@ import (
 
 // SignRequest is the request body for a certificate signature request.
 type SignRequest struct {
-	CsrPEM       CertificateRequest `json:"csr"`
-	OTT          string             `json:"ott"`
-	NotAfter     TimeDuration       `json:"notAfter,omitempty"`
-	NotBefore    TimeDuration       `json:"notBefore,omitempty"`
-	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+	CsrPEM             CertificateRequest `json:"csr"`
+	OTT                string             `json:"ott"`
+	NotAfter           TimeDuration       `json:"notAfter,omitempty"`
+	NotBefore          TimeDuration       `json:"notBefore,omitempty"`
+	TemplateData       json.RawMessage    `json:"templateData,omitempty"`
+	Format             string             `json:"format,omitempty"`
+	SignatureAlgorithm string             `json:"signatureAlgorithm,omitempty"`
+	AlternateChain     bool               `json:"alternateChain,omitempty"`
+	Signer             string             `json:"signer,omitempty"`
 }
 
+// PEMBundleFormat is the SignRequest format used to return the leaf and the
+// intermediate certificates as a single PEM payload instead of a JSON object.
+//
+// The bundle does not include a private key. The sign endpoint only accepts
+// certificate requests, so the key is always generated and kept by the client,
+// and there is no CA generated key, encrypted or not, to add to the payload.
+const PEMBundleFormat = "pem-bundle"
+
+// IdempotencyKeyHeader is the header with the key used to identify the
+// retries of a sign request. The token of the request is always part of the
+// identity of the request, the header can only narrow it.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is the header set in the responses of the retried
+// sign requests that return a certificate signed before.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// JWSFormat is the SignRequest format used to return the SignResponse and the
+// issuance metadata as a JWS signed by the CA. The signature can be verified
+// with the keys published in the /response-keys endpoint.
+const JWSFormat = "jws"
+
 // Validate checks the fields of the SignRequest and returns nil if they are ok
 // or an error if something is wrong.
 func (s *SignRequest) Validate() error {
@@ -33,17 +66,34 @@ func (s *SignRequest) Validate() error {
 	if s.OTT == "" {
 		return errs.BadRequest("missing ott")
 	}
+	if s.Format != "" && s.Format != PEMBundleFormat && s.Format != JWSFormat {
+		return errs.BadRequest("unsupported format %q", s.Format)
+	}
 
 	return nil
 }
 
 // SignResponse is the response object of the certificate signature request.
 type SignResponse struct {
-	ServerPEM    Certificate          `json:"crt"`
-	CaPEM        Certificate          `json:"ca"`
-	CertChainPEM []Certificate        `json:"certChain"`
-	TLSOptions   *config.TLSOptions   `json:"tlsOptions,omitempty"`
-	TLS          *tls.ConnectionState `json:"-"`
+	ServerPEM    Certificate        `json:"crt"`
+	CaPEM        Certificate        `json:"ca"`
+	CertChainPEM []Certificate      `json:"certChain"`
+	TLSOptions   *config.TLSOptions `json:"tlsOptions,omitempty"`
+	Warnings     []string           `json:"warnings,omitempty"`
+	// RenewalsRemaining is the number of renewals left for the certificate,
+	// it is only set by renewals when the provisioner limits them.
+	RenewalsRemaining *int                 `json:"renewalsRemaining,omitempty"`
+	TLS               *tls.ConnectionState `json:"-"`
+}
+
+// SignResponsePayload is the payload of the JWS returned when the JWSFormat is
+// requested.
+type SignResponsePayload struct {
+	SignResponse
+	SerialNumber string            `json:"serialNumber"`
+	NotBefore    time.Time         `json:"notBefore"`
+	NotAfter     time.Time         `json:"notAfter"`
+	IssuedAt     *jose.NumericDate `json:"iat"`
 }
 
 // Sign is an HTTP handler that reads a certificate request and an
@@ -63,26 +113,76 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := provisioner.SignOptions{
-		NotBefore:    body.NotBefore,
-		NotAfter:     body.NotAfter,
-		TemplateData: body.TemplateData,
+		NotBefore:          body.NotBefore,
+		NotAfter:           body.NotAfter,
+		TemplateData:       body.TemplateData,
+		SignatureAlgorithm: body.SignatureAlgorithm,
+		AlternateChain:     body.AlternateChain,
+		Signer:             body.Signer,
 	}
 
-	ctx := r.Context()
+	ctx := authority.NewWarningsContext(r.Context())
 	a := mustAuthority(ctx)
+	if body.Format == JWSFormat && a.GetResponseSigningKeys() == nil {
+		render.Error(w, errs.BadRequest("format %q is not supported by this CA", JWSFormat))
+		return
+	}
+
+	// Return the certificate signed before if the request is a retry.
+	var idempotencyKey string
+	if a.IsIdempotencyEnabled() {
+		var err error
+		idempotencyKey, err = authority.NewIdempotencyKey(r.Header.Get(IdempotencyKeyHeader), body.OTT, body.CsrPEM.CertificateRequest)
+		if err != nil {
+			render.Error(w, errs.BadRequestErr(err, err.Error()))
+			return
+		}
+		certChain, ok, err := a.LoadIdempotentCertificate(ctx, idempotencyKey)
+		if err != nil {
+			render.Error(w, err)
+			return
+		}
+		if ok {
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			writeSignResponse(ctx, w, r, a, &body, certChain)
+			return
+		}
+	}
 
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = newClientAddrContext(ctx, r)
+	ctx = newTLSVersionContext(ctx, r)
 	signOpts, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
 		render.Error(w, errs.UnauthorizedErr(err))
 		return
 	}
 
+	// Do not issue the certificate if the response cannot be signed.
+	if body.Format == JWSFormat {
+		if err := a.CheckResponseSigner(); err != nil {
+			render.Error(w, err)
+			return
+		}
+	}
+
 	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
 		render.Error(w, errs.ForbiddenErr(err, "error signing certificate"))
 		return
 	}
+	if idempotencyKey != "" {
+		if err := a.StoreIdempotentCertificate(ctx, idempotencyKey, certChain); err != nil {
+			log.Error(w, err)
+		}
+	}
+
+	writeSignResponse(ctx, w, r, a, &body, certChain)
+}
+
+// writeSignResponse writes the response of a sign request in the format
+// requested.
+func writeSignResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, a Authority, body *SignRequest, certChain []*x509.Certificate) {
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
@@ -90,10 +190,72 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	LogCertificate(w, certChain[0])
-	render.JSONStatus(w, &SignResponse{
+	if body.Format == PEMBundleFormat {
+		writePEMBundle(w, certChain, http.StatusCreated)
+		return
+	}
+	if mediaType := acceptedArchive(r); mediaType != "" {
+		writeArchive(w, r, mediaType, certChain, http.StatusCreated)
+		return
+	}
+	resp := SignResponse{
 		ServerPEM:    certChainPEM[0],
 		CaPEM:        caPEM,
 		CertChainPEM: certChainPEM,
 		TLSOptions:   a.GetTLSOptions(),
-	}, http.StatusCreated)
+		Warnings:     authority.WarningsFromContext(ctx),
+	}
+	if body.Format == JWSFormat {
+		writeJWS(w, a, &resp, certChain[0], http.StatusCreated)
+		return
+	}
+	render.JSONStatus(w, &resp, http.StatusCreated)
+}
+
+// writeJWS writes the SignResponse and the metadata of the certificate as a
+// JWS signed by the authority.
+func writeJWS(w http.ResponseWriter, a Authority, resp *SignResponse, cert *x509.Certificate, status int) {
+	payload, err := json.Marshal(SignResponsePayload{
+		SignResponse: *resp,
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore.UTC(),
+		NotAfter:     cert.NotAfter.UTC(),
+		IssuedAt:     jose.NewNumericDate(time.Now()),
+	})
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+	jws, err := a.SignResponse(payload)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jose")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(jws)); err != nil {
+		log.Error(w, err)
+	}
+}
+
+// ResponseKeys is an HTTP handler that returns the public keys used to sign
+// the responses requested in the JWS format.
+func ResponseKeys(w http.ResponseWriter, r *http.Request) {
+	keys := mustAuthority(r.Context()).GetResponseSigningKeys()
+	if keys == nil {
+		render.Error(w, errs.NotFound("response signer is not configured"))
+		return
+	}
+	render.JSON(w, keys)
+}
+
+// writePEMBundle writes the leaf certificate followed by its chain as a single
+// PEM payload.
+func writePEMBundle(w http.ResponseWriter, certChain []*x509.Certificate, status int) {
+	b := encodeCertificates(certChain)
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		log.Error(w, err)
+	}
 }
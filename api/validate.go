@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// maxValidateBatchRequestSize is the maximum size of the body of a batch
+// validation request.
+const maxValidateBatchRequestSize = 1 << 20
+
+// ValidateRequest is the request body for a token validation request.
+type ValidateRequest struct {
+	OTT string `json:"ott"`
+}
+
+// Validate checks the fields of the ValidateRequest and returns nil if they
+// are ok or an error if something is wrong.
+func (r *ValidateRequest) Validate() error {
+	if r.OTT == "" {
+		return errs.BadRequest("missing ott")
+	}
+	return nil
+}
+
+// ValidateResponse is the response object of a token validation request. It
+// contains the provisioner that accepted the token and the claims in it.
+type ValidateResponse struct {
+	Provisioner     string            `json:"provisioner"`
+	ProvisionerType string            `json:"provisionerType"`
+	Claims          *authority.Claims `json:"claims"`
+}
+
+// Validate checks that a sign token would be accepted by the CA without
+// issuing a certificate. The token is not marked as used, so it can still be
+// used to sign a certificate.
+func Validate(w http.ResponseWriter, r *http.Request) {
+	var body ValidateRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := newClientAddrContext(r.Context(), r)
+	logOtt(w, body.OTT)
+	p, claims, err := mustAuthority(ctx).ValidateToken(ctx, body.OTT)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	render.JSON(w, &ValidateResponse{
+		Provisioner:     p.GetName(),
+		ProvisionerType: p.GetType().String(),
+		Claims:          claims,
+	})
+}
+
+// ValidateBatchRequest is the request body for a batch token validation
+// request.
+type ValidateBatchRequest struct {
+	OTTs []string `json:"otts"`
+}
+
+// Validate checks the fields of the ValidateBatchRequest and returns nil if
+// they are ok or an error if something is wrong.
+func (r *ValidateBatchRequest) Validate() error {
+	switch {
+	case len(r.OTTs) == 0:
+		return errs.BadRequest("missing otts")
+	case len(r.OTTs) > authority.MaxValidateTokens:
+		return errs.BadRequest("cannot validate more than %d tokens", authority.MaxValidateTokens)
+	default:
+		return nil
+	}
+}
+
+// ValidateBatchResult is the result of the validation of one of the tokens in
+// a batch validation request. If the token is not valid, OK is false and
+// Reason contains the reason of the failure.
+type ValidateBatchResult struct {
+	OK              bool              `json:"ok"`
+	Reason          string            `json:"reason,omitempty"`
+	Provisioner     string            `json:"provisioner,omitempty"`
+	ProvisionerType string            `json:"provisionerType,omitempty"`
+	Claims          *authority.Claims `json:"claims,omitempty"`
+}
+
+// ValidateBatchResponse is the response object of a batch token validation
+// request. The results are in the same order than the tokens in the request.
+type ValidateBatchResponse struct {
+	Results []ValidateBatchResult `json:"results"`
+}
+
+// ValidateBatch checks a batch of sign tokens like Validate does. A token that
+// is not valid does not fail the request, the failure is reported in its
+// result. The request must be authenticated with a client certificate issued
+// by the CA.
+func ValidateBatch(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		render.Error(w, errs.Unauthorized("missing client certificate"))
+		return
+	}
+
+	var body ValidateBatchRequest
+	if err := read.JSON(io.LimitReader(r.Body, maxValidateBatchRequestSize), &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := newClientAddrContext(r.Context(), r)
+	validations, err := mustAuthority(ctx).ValidateTokens(ctx, body.OTTs)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	results := make([]ValidateBatchResult, len(validations))
+	for i, v := range validations {
+		if v.Err != nil {
+			results[i] = ValidateBatchResult{
+				Reason: validationReason(v.Err),
+			}
+			continue
+		}
+		results[i] = ValidateBatchResult{
+			OK:              true,
+			Provisioner:     v.Provisioner.GetName(),
+			ProvisionerType: v.Provisioner.GetType().String(),
+			Claims:          v.Claims,
+		}
+	}
+
+	render.JSON(w, &ValidateBatchResponse{
+		Results: results,
+	})
+}
+
+// validationReason returns the reason of the failure of a token validation.
+// Only the reasons returned by the provisioners are exposed, other failures
+// are reported as unknown.
+func validationReason(err error) string {
+	var ae *provisioner.AuthorizeError
+	if errors.As(err, &ae) {
+		return ae.Reason.String()
+	}
+	return provisioner.ReasonUnknown.String()
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+func TestValidate(t *testing.T) {
+	prov := &provisioner.JWK{Type: "JWK", Name: "jwk"}
+	claims := &authority.Claims{
+		Claims: jose.Claims{Subject: "test.smallstep.com", Issuer: "jwk"},
+		SANs:   []string{"test.smallstep.com"},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		statusCode int
+		want       *ValidateResponse
+	}{
+		{"ok", `{"ott":"the-ott"}`, nil, http.StatusOK, &ValidateResponse{
+			Provisioner:     "jwk",
+			ProvisionerType: "JWK",
+			Claims:          claims,
+		}},
+		{"fail/json", `{"ott"`, nil, http.StatusBadRequest, nil},
+		{"fail/missing-ott", `{}`, nil, http.StatusBadRequest, nil},
+		{"fail/validate", `{"ott":"the-ott"}`, errors.New("force"), http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				validateToken: func(ctx context.Context, ott string) (provisioner.Interface, *authority.Claims, error) {
+					assert.Equal(t, "the-ott", ott)
+					addr, ok := provisioner.ClientAddrFromContext(ctx)
+					if assert.True(t, ok) {
+						assert.Equal(t, "192.0.2.1:1234", addr.RemoteAddr)
+					}
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return prov, claims, nil
+				},
+			})
+			r := httptest.NewRequest("POST", "/validate", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			Validate(logging.NewResponseLogger(w), r)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.want != nil {
+				var got ValidateResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, tt.want, &got)
+			}
+		})
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	prov := &provisioner.JWK{Type: "JWK", Name: "jwk"}
+	claims := &authority.Claims{
+		Claims: jose.Claims{Subject: "test.smallstep.com", Issuer: "jwk"},
+		SANs:   []string{"test.smallstep.com"},
+	}
+	validations := []authority.TokenValidation{
+		{Provisioner: prov, Claims: claims},
+		{Err: errs.UnauthorizedErr(&provisioner.AuthorizeError{Reason: provisioner.ReasonTokenExpired, Err: errors.New("token is expired")})},
+		{Err: errs.Unauthorized("provisioner not found")},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		statusCode int
+		want       *ValidateBatchResponse
+	}{
+		{"ok", `{"otts":["ott-1","ott-2","ott-3"]}`, nil, http.StatusOK, &ValidateBatchResponse{
+			Results: []ValidateBatchResult{
+				{OK: true, Provisioner: "jwk", ProvisionerType: "JWK", Claims: claims},
+				{Reason: "tokenExpired"},
+				{Reason: "unknown"},
+			},
+		}},
+		{"fail/json", `{"otts"`, nil, http.StatusBadRequest, nil},
+		{"fail/missing-otts", `{"otts":[]}`, nil, http.StatusBadRequest, nil},
+		{"fail/too-many-otts", `{"otts":[` + strings.Repeat(`"ott",`, authority.MaxValidateTokens) + `"ott"]}`, nil, http.StatusBadRequest, nil},
+		{"fail/validate", `{"otts":["ott-1","ott-2","ott-3"]}`, errs.BadRequest("force"), http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				validateTokens: func(ctx context.Context, otts []string) ([]authority.TokenValidation, error) {
+					assert.Equal(t, []string{"ott-1", "ott-2", "ott-3"}, otts)
+					_, ok := provisioner.ClientAddrFromContext(ctx)
+					assert.True(t, ok)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return validations, nil
+				},
+			})
+			r := httptest.NewRequest("POST", "/validate/batch", strings.NewReader(tt.body))
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}
+			w := httptest.NewRecorder()
+			ValidateBatch(logging.NewResponseLogger(w), r)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.want != nil {
+				var got ValidateBatchResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, tt.want, &got)
+			}
+		})
+	}
+
+	t.Run("fail/missing-client-certificate", func(t *testing.T) {
+		mockMustAuthority(t, &mockAuthority{})
+		r := httptest.NewRequest("POST", "/validate/batch", strings.NewReader(`{"otts":["ott-1"]}`))
+		w := httptest.NewRecorder()
+		ValidateBatch(logging.NewResponseLogger(w), r)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+}
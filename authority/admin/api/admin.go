@@ -29,6 +29,8 @@ type adminAuthority interface {
 	LoadProvisionerByID(id string) (provisioner.Interface, error)
 	UpdateProvisioner(ctx context.Context, nu *linkedca.Provisioner) error
 	RemoveProvisioner(ctx context.Context, id string) error
+	GetProvisionerFreeze(prov provisioner.Interface) *provisioner.Freeze
+	SetProvisionerFreeze(prov provisioner.Interface, f *provisioner.Freeze) error
 	GetAuthorityPolicy(ctx context.Context) (*linkedca.Policy, error)
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
@@ -39,6 +39,8 @@ type mockAdminAuthority struct {
 	MockLoadProvisionerByID   func(id string) (provisioner.Interface, error)
 	MockUpdateProvisioner     func(ctx context.Context, nu *linkedca.Provisioner) error
 	MockRemoveProvisioner     func(ctx context.Context, id string) error
+	MockGetProvisionerFreeze  func(prov provisioner.Interface) *provisioner.Freeze
+	MockSetProvisionerFreeze  func(prov provisioner.Interface, f *provisioner.Freeze) error
 
 	MockGetAuthorityPolicy    func(ctx context.Context) (*linkedca.Policy, error)
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
@@ -165,6 +167,23 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) GetProvisionerFreeze(prov provisioner.Interface) *provisioner.Freeze {
+	if m.MockGetProvisionerFreeze != nil {
+		return m.MockGetProvisionerFreeze(prov)
+	}
+	if f, ok := m.MockRet1.(*provisioner.Freeze); ok {
+		return f
+	}
+	return nil
+}
+
+func (m *mockAdminAuthority) SetProvisionerFreeze(prov provisioner.Interface, f *provisioner.Freeze) error {
+	if m.MockSetProvisionerFreeze != nil {
+		return m.MockSetProvisionerFreeze(prov, f)
+	}
+	return m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
@@ -83,6 +83,9 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("POST", "/provisioners", authnz(CreateProvisioner))
 	r.MethodFunc("PUT", "/provisioners/{name}", authnz(UpdateProvisioner))
 	r.MethodFunc("DELETE", "/provisioners/{name}", authnz(DeleteProvisioner))
+	r.MethodFunc("GET", "/provisioners/{name}/freeze", authnz(GetProvisionerFreeze))
+	r.MethodFunc("PUT", "/provisioners/{name}/freeze", authnz(UpdateProvisionerFreeze))
+	r.MethodFunc("DELETE", "/provisioners/{name}/freeze", authnz(DeleteProvisionerFreeze))
 
 	// Admins
 	r.MethodFunc("GET", "/admins/{id}", authnz(GetAdmin))
@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -201,6 +202,88 @@ func UpdateProvisioner(w http.ResponseWriter, r *http.Request) {
 	render.ProtoJSON(w, nu)
 }
 
+// ProvisionerFreezeResponse is the type for GET, PUT and DELETE
+// /admin/provisioners/{name}/freeze responses.
+type ProvisionerFreezeResponse struct {
+	Frozen       bool       `json:"frozen"`
+	Until        *time.Time `json:"until,omitempty"`
+	AllowRenewal bool       `json:"allowRenewal"`
+}
+
+func newProvisionerFreezeResponse(f *provisioner.Freeze) *ProvisionerFreezeResponse {
+	if !f.IsActive(time.Now()) {
+		return &ProvisionerFreezeResponse{}
+	}
+	return &ProvisionerFreezeResponse{
+		Frozen:       true,
+		Until:        f.Until,
+		AllowRenewal: f.AllowRenewal,
+	}
+}
+
+// GetProvisionerFreeze returns the freeze of the issuance of certificates with
+// the requested provisioner.
+func GetProvisionerFreeze(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(r.Context())
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error loading provisioner %s", name))
+		return
+	}
+
+	render.JSON(w, newProvisionerFreezeResponse(auth.GetProvisionerFreeze(p)))
+}
+
+// UpdateProvisionerFreeze freezes the issuance of certificates with the
+// requested provisioner. The freeze is persisted if the database supports it.
+func UpdateProvisionerFreeze(w http.ResponseWriter, r *http.Request) {
+	var body provisioner.Freeze
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if body.Until != nil && !body.Until.After(time.Now()) {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "freeze until must be in the future"))
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(r.Context())
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error loading provisioner %s", name))
+		return
+	}
+
+	if err := auth.SetProvisionerFreeze(p, &body); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error freezing provisioner %s", name))
+		return
+	}
+	render.JSON(w, newProvisionerFreezeResponse(&body))
+}
+
+// DeleteProvisionerFreeze lifts the freeze of the issuance of certificates with
+// the requested provisioner, including the one in the provisioner claims.
+func DeleteProvisionerFreeze(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(r.Context())
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error loading provisioner %s", name))
+		return
+	}
+
+	if err := auth.SetProvisionerFreeze(p, nil); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error lifting freeze of provisioner %s", name))
+		return
+	}
+	render.JSON(w, newProvisionerFreezeResponse(nil))
+}
+
 // validateTemplates validates the X.509 and SSH templates and template data if set.
 func validateTemplates(x509, ssh *linkedca.Template) error {
 	if x509 != nil {
@@ -1186,6 +1186,189 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 	}
 }
 
+func TestHandler_ProvisionerFreeze(t *testing.T) {
+	prov := &provisioner.OIDC{
+		ID:   "provID",
+		Name: "provName",
+		Type: "OIDC",
+	}
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	type test struct {
+		handler    http.HandlerFunc
+		method     string
+		body       string
+		loadErr    error
+		setErr     error
+		freeze     *provisioner.Freeze
+		statusCode int
+		wantSet    bool
+		wantFreeze *provisioner.Freeze
+		want       ProvisionerFreezeResponse
+		err        string
+	}
+	var tests = map[string]test{
+		"ok/get": {
+			handler:    GetProvisionerFreeze,
+			method:     "GET",
+			freeze:     &provisioner.Freeze{Until: &until, AllowRenewal: true},
+			statusCode: 200,
+			want:       ProvisionerFreezeResponse{Frozen: true, Until: &until, AllowRenewal: true},
+		},
+		"ok/get-not-frozen": {
+			handler:    GetProvisionerFreeze,
+			method:     "GET",
+			statusCode: 200,
+			want:       ProvisionerFreezeResponse{},
+		},
+		"ok/get-expired": {
+			handler:    GetProvisionerFreeze,
+			method:     "GET",
+			freeze:     &provisioner.Freeze{Until: &past},
+			statusCode: 200,
+			want:       ProvisionerFreezeResponse{},
+		},
+		"fail/get-load": {
+			handler:    GetProvisionerFreeze,
+			method:     "GET",
+			loadErr:    errors.New("force"),
+			statusCode: 500,
+			err:        "error loading provisioner provName: force",
+		},
+		"ok/put": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{"until":"` + until.Format(time.RFC3339) + `","allowRenewal":true}`,
+			statusCode: 200,
+			wantSet:    true,
+			wantFreeze: &provisioner.Freeze{Until: &until, AllowRenewal: true},
+			want:       ProvisionerFreezeResponse{Frozen: true, Until: &until, AllowRenewal: true},
+		},
+		"ok/put-until-lifted": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{}`,
+			statusCode: 200,
+			wantSet:    true,
+			wantFreeze: &provisioner.Freeze{},
+			want:       ProvisionerFreezeResponse{Frozen: true},
+		},
+		"fail/put-body": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{`,
+			statusCode: 400,
+			err:        "error reading request body: error decoding json: unexpected EOF",
+		},
+		"fail/put-past": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{"until":"` + past.Format(time.RFC3339) + `"}`,
+			statusCode: 400,
+			err:        "freeze until must be in the future",
+		},
+		"fail/put-load": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{}`,
+			loadErr:    errors.New("force"),
+			statusCode: 500,
+			err:        "error loading provisioner provName: force",
+		},
+		"ok/delete": {
+			handler:    DeleteProvisionerFreeze,
+			method:     "DELETE",
+			freeze:     &provisioner.Freeze{},
+			statusCode: 200,
+			wantSet:    true,
+			want:       ProvisionerFreezeResponse{},
+		},
+		"fail/put-store": {
+			handler:    UpdateProvisionerFreeze,
+			method:     "PUT",
+			body:       `{}`,
+			setErr:     errors.New("force"),
+			statusCode: 500,
+			wantSet:    true,
+			wantFreeze: &provisioner.Freeze{},
+			err:        "error freezing provisioner provName: force",
+		},
+		"fail/delete-store": {
+			handler:    DeleteProvisionerFreeze,
+			method:     "DELETE",
+			setErr:     errors.New("force"),
+			statusCode: 500,
+			wantSet:    true,
+			err:        "error lifting freeze of provisioner provName: force",
+		},
+		"fail/delete-load": {
+			handler:    DeleteProvisionerFreeze,
+			method:     "DELETE",
+			loadErr:    errors.New("force"),
+			statusCode: 500,
+			err:        "error loading provisioner provName: force",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var set bool
+			auth := &mockAdminAuthority{
+				MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					assert.Equals(t, "provName", name)
+					if tc.loadErr != nil {
+						return nil, tc.loadErr
+					}
+					return prov, nil
+				},
+				MockGetProvisionerFreeze: func(p provisioner.Interface) *provisioner.Freeze {
+					assert.Equals(t, prov, p)
+					return tc.freeze
+				},
+				MockSetProvisionerFreeze: func(p provisioner.Interface, f *provisioner.Freeze) error {
+					assert.Equals(t, prov, p)
+					assert.Equals(t, tc.wantFreeze, f)
+					set = true
+					return tc.setErr
+				},
+			}
+			mockMustAuthority(t, auth)
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("name", "provName")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest(tc.method, "/foo", strings.NewReader(tc.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			tc.handler(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			assert.Equals(t, tc.wantSet, set)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err, adminErr.Message)
+				return
+			}
+
+			var response ProvisionerFreezeResponse
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, tc.want.Frozen, response.Frozen)
+			assert.Equals(t, tc.want.AllowRenewal, response.AllowRenewal)
+			if tc.want.Until == nil {
+				assert.Nil(t, response.Until)
+			} else if assert.NotNil(t, response.Until) {
+				assert.True(t, tc.want.Until.Equal(*response.Until))
+			}
+		})
+	}
+}
+
 func Test_validateTemplates(t *testing.T) {
 	type args struct {
 		x509 *linkedca.Template
@@ -0,0 +1,206 @@
+package authority
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// AuditDecisionAllow is the decision of an authorized request.
+	AuditDecisionAllow = "allow"
+	// AuditDecisionDeny is the decision of a request that was not authorized.
+	AuditDecisionDeny = "deny"
+)
+
+// AuditEvent is the record of an authorization decision. It never contains
+// the token, only the token ID used to prevent its reuse, or the SHA256 of the
+// token if the provisioner does not define one. DryRun is set for the
+// authorizations that do not issue a certificate, like the token validations.
+type AuditEvent struct {
+	Time            time.Time `json:"time"`
+	Method          string    `json:"method"`
+	ProvisionerID   string    `json:"provisionerID,omitempty"`
+	ProvisionerName string    `json:"provisionerName,omitempty"`
+	ProvisionerType string    `json:"provisionerType,omitempty"`
+	TokenID         string    `json:"tokenID"`
+	Subject         string    `json:"subject,omitempty"`
+	SANs            []string  `json:"sans,omitempty"`
+	Decision        string    `json:"decision"`
+	DryRun          bool      `json:"dryRun,omitempty"`
+	Reason          string    `json:"reason,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// AuditLogger is the interface used to record the authorization decisions of
+// the sign, SSH sign and revoke requests. Implementations must be safe for
+// concurrent use.
+type AuditLogger interface {
+	LogAuthorization(ctx context.Context, event *AuditEvent)
+}
+
+// auditRecord is an AuditEvent written by the JSON audit logger. The records
+// are hash-chained: PrevHash is the Hash of the previous record, and Hash is
+// the SHA256 of the JSON of the record without the Hash.
+type auditRecord struct {
+	*AuditEvent
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// hash returns the hash of the record.
+func (r *auditRecord) hash() (string, error) {
+	b, err := json.Marshal(auditRecord{
+		AuditEvent: r.AuditEvent,
+		PrevHash:   r.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// jsonAuditLogger is an AuditLogger that writes each event as a line of JSON.
+type jsonAuditLogger struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	lastHash string
+}
+
+// NewJSONAuditLogger returns an AuditLogger that writes the events as lines of
+// JSON to w. If w is nil, the events are written to the standard error. The
+// lines are hash-chained, and they can be verified with VerifyAuditLog.
+func NewJSONAuditLogger(w io.Writer) AuditLogger {
+	if w == nil {
+		w = os.Stderr
+	}
+	return &jsonAuditLogger{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// LogAuthorization implements the AuditLogger interface.
+func (l *jsonAuditLogger) LogAuthorization(_ context.Context, event *AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := &auditRecord{
+		AuditEvent: event,
+		PrevHash:   l.lastHash,
+	}
+	hash, err := r.hash()
+	if err != nil {
+		return
+	}
+	r.Hash = hash
+	// There's nothing to do if the event cannot be written.
+	if err := l.enc.Encode(r); err == nil {
+		l.lastHash = hash
+	}
+}
+
+// VerifyAuditLog verifies the hash chain of the records written by the JSON
+// audit logger. It returns -1 if the log is valid, or the index of the first
+// record that has been modified, or that does not follow the previous one,
+// with the error found. A record without a previous hash starts a new chain,
+// like the first record written after a restart of the authority, so the log
+// must begin with the start of a chain.
+func VerifyAuditLog(r io.Reader) (int, error) {
+	var lastHash string
+	dec := json.NewDecoder(r)
+	for i := 0; ; i++ {
+		rec := &auditRecord{AuditEvent: new(AuditEvent)}
+		if err := dec.Decode(rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return -1, nil
+			}
+			return i, fmt.Errorf("error reading audit record %d: %w", i, err)
+		}
+		hash, err := rec.hash()
+		if err != nil {
+			return i, fmt.Errorf("error hashing audit record %d: %w", i, err)
+		}
+		switch {
+		case rec.Hash != hash:
+			return i, fmt.Errorf("audit record %d has been modified", i)
+		case rec.PrevHash != "" && rec.PrevHash != lastHash:
+			return i, fmt.Errorf("audit record %d does not follow the previous record", i)
+		}
+		lastHash = hash
+	}
+}
+
+// auditClaims are the claims of a token used in the audit events.
+type auditClaims struct {
+	jose.Claims
+	SANs []string `json:"sans,omitempty"`
+	Step *struct {
+		SSH *struct {
+			Principals []string `json:"principals"`
+		} `json:"ssh,omitempty"`
+	} `json:"step,omitempty"`
+}
+
+// auditAuthorization records the authorization decision of the given token, if
+// an audit logger is configured. The provisioner and the claims are extracted
+// from the token without validation, so they are also available for the
+// tokens that are not authorized.
+func (a *Authority) auditAuthorization(ctx context.Context, token string, err error) {
+	if a.auditLogger == nil {
+		return
+	}
+
+	event := &AuditEvent{
+		Time:     time.Now().UTC(),
+		Method:   provisioner.MethodFromContext(ctx).String(),
+		Decision: AuditDecisionAllow,
+		DryRun:   provisioner.DryRunFromContext(ctx),
+	}
+
+	if tok, err := jose.ParseSigned(token); err == nil {
+		var claims auditClaims
+		if err := tok.UnsafeClaimsWithoutVerification(&claims); err == nil {
+			event.Subject = claims.Subject
+			event.SANs = claims.SANs
+			if claims.Step != nil && claims.Step.SSH != nil {
+				event.SANs = claims.Step.SSH.Principals
+			}
+			if p, ok := a.provisioners.LoadByToken(tok, &claims.Claims); ok {
+				event.ProvisionerID = p.GetID()
+				event.ProvisionerName = p.GetName()
+				event.ProvisionerType = p.GetType().String()
+				if id, err := p.GetTokenID(token); err == nil {
+					event.TokenID = id
+				}
+			}
+		}
+	}
+	if event.TokenID == "" {
+		sum := sha256.Sum256([]byte(token))
+		event.TokenID = strings.ToLower(hex.EncodeToString(sum[:]))
+	}
+
+	if err != nil {
+		event.Decision = AuditDecisionDeny
+		event.Reason = provisioner.ReasonUnknown.String()
+		var ae *provisioner.AuthorizeError
+		if errors.As(err, &ae) {
+			event.Reason = ae.Reason.String()
+		}
+		event.Error = err.Error()
+	}
+
+	a.auditLogger.LogAuthorization(ctx, event)
+}
@@ -0,0 +1,234 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type recordingAuditLogger struct {
+	events []*AuditEvent
+}
+
+func (l *recordingAuditLogger) LogAuthorization(_ context.Context, event *AuditEvent) {
+	l.events = append(l.events, event)
+}
+
+func TestAuthority_auditAuthorization(t *testing.T) {
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	now := time.Now()
+	validToken := func(t *testing.T, aud string) string {
+		tok, err := generateToken("test.smallstep.com", "step-cli", aud, []string{"test.smallstep.com", "127.0.0.1"}, now, jwk)
+		require.NoError(t, err)
+		return tok
+	}
+	noSubjectToken, err := generateToken("", "step-cli", testAudiences.Sign[0], nil, now, jwk)
+	require.NoError(t, err)
+
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return strings.ToLower(hex.EncodeToString(sum[:]))
+	}
+	tokenID := func(t *testing.T, tok string) string {
+		jwt, err := jose.ParseSigned(tok)
+		require.NoError(t, err)
+		var claims jose.Claims
+		require.NoError(t, jwt.UnsafeClaimsWithoutVerification(&claims))
+		return claims.ID
+	}
+
+	signToken := validToken(t, testAudiences.Sign[0])
+	revokeToken := validToken(t, testAudiences.Revoke[0])
+
+	tests := []struct {
+		name      string
+		method    provisioner.Method
+		token     string
+		authorize func(a *Authority, ctx context.Context, token string) error
+		want      *AuditEvent
+	}{
+		{"ok sign", provisioner.SignMethod, signToken, func(a *Authority, ctx context.Context, token string) error {
+			_, err := a.authorizeSign(ctx, token)
+			return err
+		}, &AuditEvent{
+			Method:          "sign-method",
+			ProvisionerID:   "step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc",
+			ProvisionerName: "step-cli",
+			ProvisionerType: "JWK",
+			TokenID:         tokenID(t, signToken),
+			Subject:         "test.smallstep.com",
+			SANs:            []string{"test.smallstep.com", "127.0.0.1"},
+			Decision:        AuditDecisionAllow,
+		}},
+		{"ok validate", provisioner.SignMethod, signToken, func(a *Authority, ctx context.Context, token string) error {
+			_, _, err := a.ValidateToken(ctx, token)
+			return err
+		}, &AuditEvent{
+			Method:          "sign-method",
+			ProvisionerID:   "step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc",
+			ProvisionerName: "step-cli",
+			ProvisionerType: "JWK",
+			TokenID:         tokenID(t, signToken),
+			Subject:         "test.smallstep.com",
+			SANs:            []string{"test.smallstep.com", "127.0.0.1"},
+			Decision:        AuditDecisionAllow,
+			DryRun:          true,
+		}},
+		{"ok revoke", provisioner.RevokeMethod, revokeToken, func(a *Authority, ctx context.Context, token string) error {
+			return a.authorizeRevoke(ctx, token)
+		}, &AuditEvent{
+			Method:          "revoke-method",
+			ProvisionerID:   "step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc",
+			ProvisionerName: "step-cli",
+			ProvisionerType: "JWK",
+			TokenID:         tokenID(t, revokeToken),
+			Subject:         "test.smallstep.com",
+			SANs:            []string{"test.smallstep.com", "127.0.0.1"},
+			Decision:        AuditDecisionAllow,
+		}},
+		{"fail subject", provisioner.SignMethod, noSubjectToken, func(a *Authority, ctx context.Context, token string) error {
+			_, err := a.authorizeSign(ctx, token)
+			return err
+		}, &AuditEvent{
+			Method:          "sign-method",
+			ProvisionerID:   "step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc",
+			ProvisionerName: "step-cli",
+			ProvisionerType: "JWK",
+			TokenID:         tokenID(t, noSubjectToken),
+			Decision:        AuditDecisionDeny,
+			Reason:          "invalidSubject",
+		}},
+		{"fail malformed", provisioner.SSHSignMethod, "foo", func(a *Authority, ctx context.Context, token string) error {
+			_, err := a.authorizeSSHSign(ctx, token)
+			return err
+		}, &AuditEvent{
+			Method:   "ssh-sign-method",
+			TokenID:  hash("foo"),
+			Decision: AuditDecisionDeny,
+			Reason:   "unknown",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &recordingAuditLogger{}
+			a := testAuthority(t, WithAuditLogger(l))
+			ctx := provisioner.NewContextWithMethod(context.Background(), tt.method)
+
+			err := tt.authorize(a, ctx, tt.token)
+			require.Len(t, l.events, 1)
+			got := l.events[0]
+			assert.WithinDuration(t, time.Now(), got.Time, time.Minute)
+			if tt.want.Decision == AuditDecisionDeny {
+				require.Error(t, err)
+				assert.Equal(t, err.Error(), got.Error)
+			} else {
+				require.NoError(t, err)
+			}
+			got.Time = time.Time{}
+			got.Error = ""
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewJSONAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONAuditLogger(&buf)
+	l.LogAuthorization(context.Background(), &AuditEvent{
+		Time:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Method:        "sign-method",
+		ProvisionerID: "id",
+		TokenID:       "token-id",
+		Decision:      AuditDecisionDeny,
+		Reason:        "tokenExpired",
+	})
+	l.LogAuthorization(context.Background(), &AuditEvent{
+		Time:     time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		Method:   "revoke-method",
+		TokenID:  "token-id",
+		Decision: AuditDecisionAllow,
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	first := `{"time":"2024-01-02T03:04:05Z","method":"sign-method","provisionerID":"id","tokenID":"token-id","decision":"deny","reason":"tokenExpired"}`
+	firstHash := sha256.Sum256([]byte(first))
+	assert.Equal(t, strings.TrimSuffix(first, "}")+`,"hash":"`+hex.EncodeToString(firstHash[:])+`"}`, lines[0])
+	var event AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, AuditDecisionAllow, event.Decision)
+	var rec struct {
+		PrevHash string `json:"prevHash"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, hex.EncodeToString(firstHash[:]), rec.PrevHash)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	newLog := func(t *testing.T, restarts ...int) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		l := NewJSONAuditLogger(&buf)
+		for i := 0; i < 4; i++ {
+			for _, r := range restarts {
+				if r == i {
+					l = NewJSONAuditLogger(&buf)
+				}
+			}
+			l.LogAuthorization(context.Background(), &AuditEvent{
+				Time:     time.Date(2024, 1, 2, 3, 4, i, 0, time.UTC),
+				Method:   "sign-method",
+				TokenID:  fmt.Sprintf("token-%d", i),
+				SANs:     []string{"test.smallstep.com"},
+				Decision: AuditDecisionAllow,
+			})
+		}
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+	join := func(lines ...string) string {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	lines := newLog(t)
+	restarted := newLog(t, 2)
+	tests := []struct {
+		name    string
+		log     string
+		want    int
+		wantErr bool
+	}{
+		{"ok", join(lines...), -1, false},
+		{"ok empty", "", -1, false},
+		{"ok restart", join(restarted...), -1, false},
+		{"fail modified", join(lines[0], strings.Replace(lines[1], "token-1", "token-x", 1), lines[2], lines[3]), 1, true},
+		{"fail deleted", join(lines[0], lines[1], lines[3]), 2, true},
+		{"fail reordered", join(lines[0], lines[2], lines[1], lines[3]), 1, true},
+		{"fail truncated start", join(lines[1:]...), 0, true},
+		{"fail invalid", join(lines[0], "not-json"), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyAuditLog(strings.NewReader(tt.log))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -12,9 +12,12 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/kms"
@@ -60,6 +63,14 @@ type Authority struct {
 	intermediateX509Certs []*x509.Certificate
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
+	signConcurrency       *provisioner.ConcurrencyLimiter
+	signLimiters          *provisioner.ConcurrencyLimiters
+	x509Signers           map[string]*x509Signer
+	kmsSigners            []*kmsSigner
+	responseSigner        *responseSigner
+	ocspResponder         *ocspResponder
+	crlSigner             *crlSigner
+	ready                 atomic.Bool
 
 	// SCEP CA
 	scepOptions   *scep.Options
@@ -81,6 +92,9 @@ type Authority struct {
 	crlStopper chan struct{}
 	crlMutex   sync.Mutex
 
+	// Retries of the warm-up of the KMS signers
+	warmupStopper chan struct{}
+
 	// If true, do not re-initialize
 	initOnce  bool
 	startTime time.Time
@@ -92,6 +106,16 @@ type Authority struct {
 	getIdentityFunc       provisioner.GetIdentityFunc
 	authorizeRenewFunc    provisioner.AuthorizeRenewFunc
 	authorizeSSHRenewFunc provisioner.AuthorizeSSHRenewFunc
+	sanResolver           provisioner.SANResolver
+	keyBlocklist          provisioner.KeyBlocklist
+	tokenCache            provisioner.TokenCache
+	idempotencyCache      IdempotencyCache
+	rateLimiter           provisioner.RateLimiter
+	previewLimiter        provisioner.RateLimiter
+	emailCodeStore        provisioner.EmailCodeStore
+	emailSender           provisioner.EmailSender
+	secretResolvers       map[string]provisioner.SecretResolver
+	auditLogger           AuditLogger
 
 	// Constraints and Policy engines
 	constraintsEngine *constraints.Engine
@@ -99,6 +123,10 @@ type Authority struct {
 
 	adminMutex sync.RWMutex
 
+	// Freezes of the provisioners set with the admin API, indexed by
+	// provisioner id. They are loaded from the database on init.
+	provisionerFreezes sync.Map
+
 	// If true, do not initialize the authority
 	skipInit bool
 
@@ -107,6 +135,9 @@ type Authority struct {
 
 	// Called whenever applicable, in order to instrument the authority.
 	meter Meter
+
+	// Used to create the spans of the authorization and signing requests.
+	tracerProvider trace.TracerProvider
 }
 
 // Info contains information about the authority.
@@ -126,10 +157,11 @@ func New(cfg *config.Config, opts ...Option) (*Authority, error) {
 	}
 
 	var a = &Authority{
-		config:       cfg,
-		certificates: new(sync.Map),
-		validateSCEP: true,
-		meter:        noopMeter{},
+		config:         cfg,
+		certificates:   new(sync.Map),
+		validateSCEP:   true,
+		meter:          noopMeter{},
+		tracerProvider: noop.NewTracerProvider(),
 	}
 
 	// Apply options.
@@ -156,9 +188,10 @@ func New(cfg *config.Config, opts ...Option) (*Authority, error) {
 // project without the limitations of the config.
 func NewEmbedded(opts ...Option) (*Authority, error) {
 	a := &Authority{
-		config:       &config.Config{},
-		certificates: new(sync.Map),
-		meter:        noopMeter{},
+		config:         &config.Config{},
+		certificates:   new(sync.Map),
+		meter:          noopMeter{},
+		tracerProvider: noop.NewTracerProvider(),
 	}
 
 	// Apply options.
@@ -250,6 +283,9 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 	if err != nil {
 		return admin.WrapErrorISE(err, "error generating provisioner config")
 	}
+	// References to files and environment variables are only allowed in the
+	// provisioners of the configuration file.
+	provisionerConfig.LocalSecrets = a.config.AuthorityConfig.EnableLocalSecrets && !a.config.AuthorityConfig.EnableAdmin
 
 	// Create provisioner collection.
 	provClxn := provisioner.NewCollection(provisionerConfig.Audiences)
@@ -261,8 +297,13 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 			return err
 		}
 	}
-	// Create admin collection.
-	adminClxn := administrator.NewCollection(provClxn)
+	// Create admin collection. It uses the authority collection if it already
+	// exists, its provisioners are replaced below.
+	adminProvs := a.provisioners
+	if adminProvs == nil {
+		adminProvs = provClxn
+	}
+	adminClxn := administrator.NewCollection(adminProvs)
 	for _, adm := range adminList {
 		p, ok := provClxn.Load(adm.ProvisionerId)
 		if !ok {
@@ -274,8 +315,14 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 		}
 	}
 
+	// Replace the provisioners in a single step, so concurrent requests always
+	// see a consistent collection.
 	a.config.AuthorityConfig.Provisioners = provList
-	a.provisioners = provClxn
+	if a.provisioners == nil {
+		a.provisioners = provClxn
+	} else {
+		a.provisioners.Replace(provClxn)
+	}
 	a.config.AuthorityConfig.Admins = adminList
 	a.admins = adminClxn
 
@@ -330,6 +377,37 @@ func (a *Authority) init() error {
 		a.config.AuthorityConfig.EnableAdmin = true
 	}
 
+	// Limit the concurrent sign operations of the authority.
+	if a.signConcurrency == nil {
+		a.signConcurrency = provisioner.NewConcurrencyLimiter(a.config.AuthorityConfig.SignConcurrency)
+	}
+	if a.signLimiters == nil {
+		a.signLimiters = provisioner.NewConcurrencyLimiters()
+	}
+
+	// Keep the rate limits of the provisioners across reloads, the limiter
+	// keys are prefixed with the provisioner id.
+	if a.rateLimiter == nil {
+		a.rateLimiter = provisioner.NewMemoryRateLimiter(provisioner.DefaultRateLimiterSize)
+	}
+
+	// Limit the number of previews with the same token.
+	if a.previewLimiter == nil {
+		a.previewLimiter = provisioner.NewMemoryRateLimiter(provisioner.DefaultRateLimiterSize)
+	}
+
+	// Load the blocklist of compromised keys.
+	if a.keyBlocklist == nil && a.config.KeyBlocklist != nil {
+		if a.keyBlocklist, err = provisioner.NewFileKeyBlocklist(a.config.KeyBlocklist.File); err != nil {
+			return err
+		}
+	}
+
+	// Cache the certificates signed for a sign request.
+	if a.idempotencyCache == nil && a.config.Idempotency.IsEnabled() {
+		a.idempotencyCache = NewMemoryIdempotencyCache(a.config.Idempotency.Size)
+	}
+
 	// Initialize step-ca Database if it's not already initialized with WithDB.
 	// If a.config.DB is nil then a simple, barebones in memory DB will be used.
 	if a.db == nil {
@@ -418,7 +496,7 @@ func (a *Authority) init() error {
 			if err != nil {
 				return err
 			}
-			options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			options.Signer, err = a.createSigner(&kmsapi.CreateSignerRequest{
 				SigningKey: a.config.IntermediateKey,
 				Password:   a.password,
 			})
@@ -490,7 +568,7 @@ func (a *Authority) init() error {
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
 		if a.config.SSH.HostKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
 				SigningKey: a.config.SSH.HostKey,
 				Password:   a.sshHostPassword,
 			})
@@ -516,7 +594,7 @@ func (a *Authority) init() error {
 			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, a.sshCAHostCertSignKey.PublicKey())
 		}
 		if a.config.SSH.UserKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
 				SigningKey: a.config.SSH.UserKey,
 				Password:   a.sshUserPassword,
 			})
@@ -673,6 +751,12 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Load the named X.509 signers. The provisioners use their keys to
+	// validate the configured signature algorithms.
+	if err := a.initX509Signers(ctx); err != nil {
+		return err
+	}
+
 	// Load Provisioners and Admins
 	if err := a.ReloadAdminResources(ctx); err != nil {
 		return err
@@ -772,11 +856,36 @@ func (a *Authority) init() error {
 		a.constraintsEngine = constraints.New(constraintCerts...)
 	}
 
+	// Load the key used to sign JWS responses.
+	if err := a.initResponseSigner(); err != nil {
+		return err
+	}
+
+	// Load the delegated OCSP signing certificate and key.
+	if err := a.initOCSPResponder(); err != nil {
+		return err
+	}
+
+	// Load the delegated CRL signing certificate and key.
+	if err := a.initCRLSigner(); err != nil {
+		return err
+	}
+
+	// Log the authorization decisions if the audit log is enabled.
+	if a.auditLogger == nil && a.config.AuditLog {
+		a.auditLogger = NewJSONAuditLogger(nil)
+	}
+
 	// Load x509 and SSH Policy Engines
 	if err := a.reloadPolicyEngines(ctx); err != nil {
 		return err
 	}
 
+	// Restore the provisioner freezes set with the admin API.
+	if err := a.loadProvisionerFreezes(); err != nil {
+		return err
+	}
+
 	// Configure templates, currently only ssh templates are supported.
 	if a.sshCAHostCertSignKey != nil || a.sshCAUserCertSignKey != nil {
 		a.templates = a.config.Templates
@@ -801,6 +910,17 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Warm up the KMS signers before reporting the CA as ready.
+	if err := a.warmupSigners(); err != nil {
+		return err
+	}
+
+	// Verify the external dependencies of the provisioners, e.g. the key sets
+	// of the identity providers.
+	if err := a.checkProvisioners(ctx); err != nil {
+		return err
+	}
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -871,6 +991,7 @@ func (a *Authority) Shutdown() error {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	a.stopWarmup()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
@@ -884,6 +1005,7 @@ func (a *Authority) CloseForReload() {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	a.stopWarmup()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
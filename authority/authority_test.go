@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 )
@@ -578,3 +580,61 @@ func TestAuthority_GetID(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_ReloadAdminResources_concurrentSign(t *testing.T) {
+	a := testAuthority(t)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	csr := getCSR(t, priv)
+
+	done := make(chan struct{})
+	errCh := make(chan error, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+				opts, err := a.Authorize(ctx, token)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				now := time.Now()
+				if _, err := a.SignWithContext(ctx, csr, provisioner.SignOptions{
+					NotBefore: provisioner.NewTimeDuration(now),
+					NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+				}, opts...); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := a.ReloadAdminResources(context.Background()); err != nil {
+			errCh <- err
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+}
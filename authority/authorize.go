@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -202,7 +203,10 @@ func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
 			return errs.Wrap(http.StatusInternalServerError, err, "failed when attempting to store token")
 		}
 		if !ok {
-			return errs.Unauthorized("token already used")
+			return errs.UnauthorizedErr(&provisioner.AuthorizeError{
+				Reason: provisioner.ReasonTokenReused,
+				Err:    errors.New("token already used"),
+			})
 		}
 	}
 	return nil
@@ -246,18 +250,105 @@ func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.
 
 // authorizeSign loads the provisioner from the token and calls the provisioner
 // AuthorizeSign method. Returns a list of methods to apply to the signing flow.
-func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+func (a *Authority) authorizeSign(ctx context.Context, token string) (_ []provisioner.SignOption, err error) {
+	ctx, span := a.startSpan(ctx, "authority.authorizeSign")
+	defer func() { endAuthorizationSpan(span, err) }()
+	defer func() { a.auditAuthorization(ctx, token, err) }()
+
+	_, tokenSpan := a.startSpan(ctx, "authority.authorizeToken")
 	p, err := a.authorizeToken(ctx, token)
+	endSpan(tokenSpan, err)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
-	signOpts, err := p.AuthorizeSign(ctx, token)
+	setSpanProvisioner(span, p)
+	if err := a.checkProvisionerFreeze(p, false); err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeSign")
+	}
+	start := time.Now()
+	pctx, pspan := a.startSpan(ctx, "provisioner.AuthorizeSign")
+	setSpanProvisioner(pspan, p)
+	signOpts, err := p.AuthorizeSign(pctx, token)
+	endSpan(pspan, err)
+	a.meter.ProvisionerAuthorized("sign", p, time.Since(start), err)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
 	return signOpts, nil
 }
 
+// ValidateToken runs the same validations than the authorization of a sign
+// request without marking the token as used, and returns the provisioner that
+// should be used and the claims in the token. It can be used to check that a
+// token would be accepted by the CA without requesting a certificate. The
+// validation is a dry run: the SAN resolver and the webhooks are not called,
+// and the audit event is marked as a dry run.
+func (a *Authority) ValidateToken(ctx context.Context, token string) (provisioner.Interface, *Claims, error) {
+	var opts = []interface{}{errs.WithKeyVal("token", token)}
+
+	p, claims, err := a.getProvisionerFromToken(token)
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusUnauthorized, err, "authority.ValidateToken", opts...)
+	}
+
+	ctx = NewContextWithSkipTokenReuse(ctx)
+	ctx = provisioner.NewContextWithDryRun(ctx)
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	if _, err := a.authorizeSign(ctx, token); err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.ValidateToken", opts...)
+	}
+	return p, claims, nil
+}
+
+// MaxValidateTokens is the maximum number of tokens that can be validated in a
+// single call to ValidateTokens.
+const MaxValidateTokens = 100
+
+// validateTokensConcurrency is the maximum number of tokens validated
+// concurrently by ValidateTokens.
+const validateTokensConcurrency = 4
+
+// TokenValidation is the result of the validation of one of the tokens passed
+// to ValidateTokens. If the token is valid, Err is nil and the provisioner and
+// the claims are set.
+type TokenValidation struct {
+	Provisioner provisioner.Interface
+	Claims      *Claims
+	Err         error
+}
+
+// ValidateTokens runs ValidateToken on each of the given tokens and returns the
+// results in the same order. An invalid token does not prevent the validation
+// of the rest, the error is set in its result. It returns an error only if the
+// number of tokens exceeds MaxValidateTokens.
+func (a *Authority) ValidateTokens(ctx context.Context, tokens []string) ([]TokenValidation, error) {
+	if len(tokens) > MaxValidateTokens {
+		return nil, errs.BadRequest("cannot validate more than %d tokens", MaxValidateTokens)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]TokenValidation, len(tokens))
+	sem := make(chan struct{}, validateTokensConcurrency)
+	for i, token := range tokens {
+		if err := ctx.Err(); err != nil {
+			results[i].Err = errs.Wrap(http.StatusServiceUnavailable, err, "authority.ValidateTokens")
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, token string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			p, claims, err := a.ValidateToken(ctx, token)
+			results[i] = TokenValidation{Provisioner: p, Claims: claims, Err: err}
+		}(i, token)
+	}
+	wg.Wait()
+	return results, nil
+}
+
 // AuthorizeSign authorizes a signature request by validating and authenticating
 // a token that must be sent w/ the request.
 //
@@ -270,12 +361,17 @@ func (a *Authority) AuthorizeSign(token string) ([]provisioner.SignOption, error
 
 // authorizeRevoke locates the provisioner used to generate the authenticating
 // token and then performs the token validation flow.
-func (a *Authority) authorizeRevoke(ctx context.Context, token string) error {
+func (a *Authority) authorizeRevoke(ctx context.Context, token string) (err error) {
+	defer func() { a.auditAuthorization(ctx, token, err) }()
+
 	p, err := a.authorizeToken(ctx, token)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRevoke")
 	}
-	if err := p.AuthorizeRevoke(ctx, token); err != nil {
+	start := time.Now()
+	err = p.AuthorizeRevoke(ctx, token)
+	a.meter.ProvisionerAuthorized("revoke", p, time.Since(start), err)
+	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRevoke")
 	}
 	return nil
@@ -308,7 +404,13 @@ func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate)
 			return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
 		}
 	}
-	if err := p.AuthorizeRenew(ctx, cert); err != nil {
+	if err := a.checkProvisionerFreeze(p, true); err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeRenew", opts...)
+	}
+	start := time.Now()
+	err = p.AuthorizeRenew(ctx, cert)
+	a.meter.ProvisionerAuthorized("renew", p, time.Since(start), err)
+	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
 	return p, nil
@@ -339,12 +441,27 @@ func (a *Authority) authorizeSSHCertificate(_ context.Context, cert *ssh.Certifi
 // authorizeSSHSign loads the provisioner from the token, checks that it has not
 // been used again and calls the provisioner AuthorizeSSHSign method. Returns a
 // list of methods to apply to the signing flow.
-func (a *Authority) authorizeSSHSign(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+func (a *Authority) authorizeSSHSign(ctx context.Context, token string) (_ []provisioner.SignOption, err error) {
+	ctx, span := a.startSpan(ctx, "authority.authorizeSSHSign")
+	defer func() { endAuthorizationSpan(span, err) }()
+	defer func() { a.auditAuthorization(ctx, token, err) }()
+
+	_, tokenSpan := a.startSpan(ctx, "authority.authorizeToken")
 	p, err := a.authorizeToken(ctx, token)
+	endSpan(tokenSpan, err)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
-	signOpts, err := p.AuthorizeSSHSign(ctx, token)
+	setSpanProvisioner(span, p)
+	if err := a.checkProvisionerFreeze(p, false); err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeSSHSign")
+	}
+	start := time.Now()
+	pctx, pspan := a.startSpan(ctx, "provisioner.AuthorizeSSHSign")
+	setSpanProvisioner(pspan, p)
+	signOpts, err := p.AuthorizeSSHSign(pctx, token)
+	endSpan(pspan, err)
+	a.meter.ProvisionerAuthorized("sshSign", p, time.Since(start), err)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
@@ -358,6 +475,9 @@ func (a *Authority) authorizeSSHRenew(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
 	}
+	if err := a.checkProvisionerFreeze(p, true); err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeSSHRenew")
+	}
 	cert, err := p.AuthorizeSSHRenew(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
@@ -372,6 +492,9 @@ func (a *Authority) authorizeSSHRekey(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
 	}
+	if err := a.checkProvisionerFreeze(p, true); err != nil {
+		return nil, nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeSSHRekey")
+	}
 	cert, signOpts, err := p.AuthorizeSSHRekey(ctx, token)
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
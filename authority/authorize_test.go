@@ -491,13 +491,240 @@ func TestAuthority_authorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Equals(t, 10, len(got)) // number of provisioner.SignOptions returned
+					assert.Equals(t, 15, len(got)) // number of provisioner.SignOptions returned
 				}
 			}
 		})
 	}
 }
 
+type authorizeMeter struct {
+	noopMeter
+	methods []string
+	types   []string
+	errs    []error
+}
+
+func (m *authorizeMeter) ProvisionerAuthorized(method string, p provisioner.Interface, _ time.Duration, err error) {
+	m.methods = append(m.methods, method)
+	m.types = append(m.types, p.GetType().String())
+	m.errs = append(m.errs, err)
+}
+
+func TestAuthority_authorizeSign_meter(t *testing.T) {
+	a := testAuthority(t)
+	meter := new(authorizeMeter)
+	a.meter = meter
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+	newToken := func(sub, id string) string {
+		raw, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   sub,
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  []string{"https://example.com/sign"},
+			ID:        id,
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return raw
+	}
+
+	_, err = a.authorizeSign(context.Background(), newToken("test.smallstep.com", "meter-1"))
+	assert.FatalError(t, err)
+	_, err = a.authorizeSign(context.Background(), newToken("", "meter-2"))
+	assert.Error(t, err)
+	// Tokens that cannot be parsed never reach the provisioner.
+	_, err = a.authorizeSign(context.Background(), "foo")
+	assert.Error(t, err)
+
+	assert.Equals(t, []string{"sign", "sign"}, meter.methods)
+	assert.Equals(t, []string{"JWK", "JWK"}, meter.types)
+	if assert.Len(t, 2, meter.errs) {
+		assert.NoError(t, meter.errs[0])
+		assert.Error(t, meter.errs[1])
+	}
+}
+
+func TestAuthority_ValidateToken(t *testing.T) {
+	a := testAuthority(t)
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+
+	validIssuer := "step-cli"
+	validAudience := []string{"https://example.com/sign"}
+
+	type validateTest struct {
+		token string
+		err   error
+		code  int
+	}
+	tests := map[string]func(t *testing.T) *validateTest{
+		"fail/invalid-token": func(t *testing.T) *validateTest {
+			return &validateTest{
+				token: "foo",
+				err:   errors.New("authority.ValidateToken: error parsing token"),
+				code:  http.StatusUnauthorized,
+			}
+		},
+		"fail/invalid-subject": func(t *testing.T) *validateTest {
+			cl := jose.Claims{
+				Subject:   "",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "53",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return &validateTest{
+				token: raw,
+				err:   errors.New("authority.ValidateToken: authority.authorizeSign: jwk.AuthorizeSign: jwk.authorizeToken; jwk token subject cannot be empty"),
+				code:  http.StatusUnauthorized,
+			}
+		},
+		"ok": func(t *testing.T) *validateTest {
+			cl := jose.Claims{
+				Subject:   "test.smallstep.com",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "54",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return &validateTest{
+				token: raw,
+			}
+		},
+	}
+
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+
+			p, claims, err := a.ValidateToken(context.Background(), tc.token)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), tc.code)
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, validIssuer, p.GetName())
+				assert.Equals(t, "test.smallstep.com", claims.Subject)
+
+				// The token is not marked as used.
+				_, _, err := a.ValidateToken(context.Background(), tc.token)
+				assert.FatalError(t, err)
+				_, err = a.authorizeSign(context.Background(), tc.token)
+				assert.FatalError(t, err)
+			}
+		})
+	}
+}
+
+func TestAuthority_ValidateTokens(t *testing.T) {
+	a := testAuthority(t)
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+	newToken := func(sub string, expiry time.Time) string {
+		id, err := randutil.ASCII(64)
+		assert.FatalError(t, err)
+		raw, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   sub,
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(now.Add(-5 * time.Minute)),
+			Expiry:    jose.NewNumericDate(expiry),
+			Audience:  []string{"https://example.com/sign"},
+			ID:        id,
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return raw
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var tokens []string
+		for i := 0; i < 2*validateTokensConcurrency; i++ {
+			tokens = append(tokens, newToken(fmt.Sprintf("host-%d.smallstep.com", i), now.Add(time.Minute)))
+		}
+		tokens = append(tokens, "foo", newToken("", now.Add(time.Minute)), newToken("expired.smallstep.com", now.Add(-2*time.Minute)))
+
+		got, err := a.ValidateTokens(context.Background(), tokens)
+		assert.FatalError(t, err)
+		assert.Len(t, len(tokens), got)
+		for i := 0; i < 2*validateTokensConcurrency; i++ {
+			if assert.NoError(t, got[i].Err) {
+				assert.Equals(t, "step-cli", got[i].Provisioner.GetName())
+				assert.Equals(t, fmt.Sprintf("host-%d.smallstep.com", i), got[i].Claims.Subject)
+			}
+		}
+		failures := got[2*validateTokensConcurrency:]
+		for _, v := range failures {
+			assert.Error(t, v.Err)
+			assert.Nil(t, v.Provisioner)
+		}
+		var ae *provisioner.AuthorizeError
+		if assert.True(t, errors.As(failures[1].Err, &ae)) {
+			assert.Equals(t, provisioner.ReasonInvalidSubject, ae.Reason)
+		}
+		if assert.True(t, errors.As(failures[2].Err, &ae)) {
+			assert.Equals(t, provisioner.ReasonTokenExpired, ae.Reason)
+		}
+
+		// The tokens are not marked as used.
+		_, err = a.authorizeSign(context.Background(), tokens[0])
+		assert.FatalError(t, err)
+	})
+
+	t.Run("ok empty", func(t *testing.T) {
+		got, err := a.ValidateTokens(context.Background(), nil)
+		assert.FatalError(t, err)
+		assert.Len(t, 0, got)
+	})
+
+	t.Run("fail canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		got, err := a.ValidateTokens(ctx, []string{newToken("test.smallstep.com", now.Add(time.Minute))})
+		assert.FatalError(t, err)
+		assert.Error(t, got[0].Err)
+	})
+
+	t.Run("fail too many tokens", func(t *testing.T) {
+		_, err := a.ValidateTokens(context.Background(), make([]string, MaxValidateTokens+1))
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc)) {
+			assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+		}
+	})
+}
+
 func TestAuthority_Authorize(t *testing.T) {
 	a := testAuthority(t)
 
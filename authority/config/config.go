@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"time"
 
@@ -22,6 +23,14 @@ import (
 
 const (
 	legacyAuthority = "step-certificate-authority"
+
+	// MinSerialNumberLength is the minimum length, in octets, of the serial
+	// numbers generated by the authority. Serial numbers are positive, so one
+	// bit is lost, and 9 octets still provide more than 64 bits of entropy.
+	MinSerialNumberLength = 9
+	// MaxSerialNumberLength is the maximum length, in octets, of the serial
+	// numbers allowed by RFC 5280.
+	MaxSerialNumberLength = 20
 )
 
 var (
@@ -44,6 +53,8 @@ var (
 	// DefaultCRLExpiredDuration is the default duration in which expired
 	// certificates will remain in the CRL after expiration.
 	DefaultCRLExpiredDuration = time.Hour
+	// DefaultOCSPCacheDuration is the default duration of the OCSP responses.
+	DefaultOCSPCacheDuration = &provisioner.Duration{Duration: time.Hour}
 	// GlobalProvisionerClaims is the default duration that expired certificates
 	// remain in the CRL after expiration.
 	GlobalProvisionerClaims = provisioner.Claims{
@@ -65,38 +76,99 @@ var (
 
 // Config represents the CA configuration and it's mapped to a JSON object.
 type Config struct {
-	Root             multiString          `json:"root"`
-	FederatedRoots   []string             `json:"federatedRoots"`
-	IntermediateCert string               `json:"crt"`
-	IntermediateKey  string               `json:"key"`
-	Address          string               `json:"address"`
-	InsecureAddress  string               `json:"insecureAddress"`
-	DNSNames         []string             `json:"dnsNames"`
-	KMS              *kms.Options         `json:"kms,omitempty"`
-	SSH              *SSHConfig           `json:"ssh,omitempty"`
-	Logger           json.RawMessage      `json:"logger,omitempty"`
-	DB               *db.Config           `json:"db,omitempty"`
-	Monitoring       json.RawMessage      `json:"monitoring,omitempty"`
-	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
-	TLS              *TLSOptions          `json:"tls,omitempty"`
-	Password         string               `json:"password,omitempty"`
-	Templates        *templates.Templates `json:"templates,omitempty"`
-	CommonName       string               `json:"commonName,omitempty"`
-	CRL              *CRLConfig           `json:"crl,omitempty"`
-	MetricsAddress   string               `json:"metricsAddress,omitempty"`
-	SkipValidation   bool                 `json:"-"`
+	Root             multiString             `json:"root"`
+	FederatedRoots   []string                `json:"federatedRoots"`
+	IntermediateCert string                  `json:"crt"`
+	IntermediateKey  string                  `json:"key"`
+	Address          string                  `json:"address"`
+	InsecureAddress  string                  `json:"insecureAddress"`
+	DNSNames         []string                `json:"dnsNames"`
+	KMS              *kms.Options            `json:"kms,omitempty"`
+	KMSWarmup        *KMSWarmupConfig        `json:"kmsWarmup,omitempty"`
+	ProvisionerCheck *ProvisionerCheckConfig `json:"provisionerCheck,omitempty"`
+	SSH              *SSHConfig              `json:"ssh,omitempty"`
+	Logger           json.RawMessage         `json:"logger,omitempty"`
+	DB               *db.Config              `json:"db,omitempty"`
+	Monitoring       json.RawMessage         `json:"monitoring,omitempty"`
+	AuthorityConfig  *AuthConfig             `json:"authority,omitempty"`
+	TLS              *TLSOptions             `json:"tls,omitempty"`
+	Password         string                  `json:"password,omitempty"`
+	Templates        *templates.Templates    `json:"templates,omitempty"`
+	CommonName       string                  `json:"commonName,omitempty"`
+	CRL              *CRLConfig              `json:"crl,omitempty"`
+	OCSP             *OCSPConfig             `json:"ocsp,omitempty"`
+	Signers          []*SignerConfig         `json:"signers,omitempty"`
+	ResponseSigner   *ResponseSignerConfig   `json:"responseSigner,omitempty"`
+	Idempotency      *IdempotencyConfig      `json:"idempotency,omitempty"`
+	KeyBlocklist     *KeyBlocklistConfig     `json:"keyBlocklist,omitempty"`
+	ACME             *ACMEConfig             `json:"acme,omitempty"`
+	MetricsAddress   string                  `json:"metricsAddress,omitempty"`
+	AuditLog         bool                    `json:"auditLog,omitempty"`
+	SkipValidation   bool                    `json:"-"`
 
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
 }
 
-// CRLConfig represents config options for CRL generation
+// KMSWarmupConfig configures the warm-up of the KMS signers at startup. On
+// warm-up each signer signs a test digest. If Fatal is true, a failure stops
+// the CA from starting, otherwise a warning is logged and the CA is reported
+// as not ready until a retry of the warm-up, with an exponential backoff,
+// succeeds.
+type KMSWarmupConfig struct {
+	Fatal bool `json:"fatal,omitempty"`
+}
+
+// ProvisionerCheckConfig configures the check of the external dependencies of the
+// provisioners at startup, e.g. the key sets of the identity providers. If
+// Fatal is true, a failure stops the CA from starting, otherwise a warning is
+// logged.
+type ProvisionerCheckConfig struct {
+	Fatal bool `json:"fatal,omitempty"`
+}
+
+// ACMEConfig represents the global config options of the ACME server.
+type ACMEConfig struct {
+	// ValidationSourceAddress is the local IP address used as the source of
+	// the connections made to validate http-01 and tls-alpn-01 challenges.
+	ValidationSourceAddress string `json:"validationSourceAddress,omitempty"`
+}
+
+// GetValidationSourceAddress returns the parsed validation source address, or
+// nil if it is not configured.
+func (c *ACMEConfig) GetValidationSourceAddress() net.IP {
+	if c == nil || c.ValidationSourceAddress == "" {
+		return nil
+	}
+	return net.ParseIP(c.ValidationSourceAddress)
+}
+
+// Validate validates the ACME configuration.
+func (c *ACMEConfig) Validate() error {
+	if c == nil || c.ValidationSourceAddress == "" {
+		return nil
+	}
+	if net.ParseIP(c.ValidationSourceAddress) == nil {
+		return errors.Errorf("acme.validationSourceAddress %q is not a valid IP address", c.ValidationSourceAddress)
+	}
+	return nil
+}
+
+// CRLConfig represents config options for CRL generation. DistributionPoints
+// is the list of URLs added to the CRL Distribution Points extension of the
+// certificates if the template does not set them, the provisioners can
+// override them. If Certificate and Key are set, the CRL is signed with a
+// delegated CRL signing certificate with the same subject as the intermediate,
+// the Key is a path or a KMS URI.
 type CRLConfig struct {
-	Enabled          bool                  `json:"enabled"`
-	GenerateOnRevoke bool                  `json:"generateOnRevoke,omitempty"`
-	CacheDuration    *provisioner.Duration `json:"cacheDuration,omitempty"`
-	RenewPeriod      *provisioner.Duration `json:"renewPeriod,omitempty"`
-	IDPurl           string                `json:"idpURL,omitempty"`
+	Enabled            bool                  `json:"enabled"`
+	GenerateOnRevoke   bool                  `json:"generateOnRevoke,omitempty"`
+	CacheDuration      *provisioner.Duration `json:"cacheDuration,omitempty"`
+	RenewPeriod        *provisioner.Duration `json:"renewPeriod,omitempty"`
+	IDPurl             string                `json:"idpURL,omitempty"`
+	DistributionPoints []string              `json:"distributionPoints,omitempty"`
+	Certificate        string                `json:"certificate,omitempty"`
+	Key                string                `json:"key,omitempty"`
 }
 
 // IsEnabled returns if the CRL is enabled.
@@ -123,9 +195,32 @@ func (c *CRLConfig) Validate() error {
 		return errors.New("crl.cacheDuration must be greater than or equal to crl.renewPeriod")
 	}
 
+	if c.Certificate != "" && c.Key == "" {
+		return errors.New("crl.key cannot be empty if crl.certificate is set")
+	}
+
+	if c.Key != "" && c.Certificate == "" {
+		return errors.New("crl.certificate cannot be empty if crl.key is set")
+	}
+
+	for _, s := range c.DistributionPoints {
+		if u, err := url.Parse(s); err != nil || !u.IsAbs() {
+			return errors.Errorf("crl.distributionPoints %q is not a valid URL", s)
+		}
+	}
+
 	return nil
 }
 
+// GetDistributionPoints returns the default URLs of the CRL Distribution Points
+// extension of the certificates.
+func (c *CRLConfig) GetDistributionPoints() []string {
+	if c == nil {
+		return nil
+	}
+	return c.DistributionPoints
+}
+
 // TickerDuration the renewal ticker duration. This is set by renewPeriod, of it
 // is not set is ~2/3 of cacheDuration.
 func (c *CRLConfig) TickerDuration() time.Duration {
@@ -140,6 +235,161 @@ func (c *CRLConfig) TickerDuration() time.Duration {
 	return (c.CacheDuration.Duration / 3) * 2
 }
 
+// OCSPConfig represents the configuration of the OCSP responder. The
+// responses are signed with a delegated OCSP signing certificate issued by
+// the intermediate, and cached for CacheDuration. The Key is a path or a KMS
+// URI. If URL is set, it's added to the Authority Information Access extension
+// of the certificates.
+type OCSPConfig struct {
+	Enabled       bool                  `json:"enabled"`
+	Certificate   string                `json:"certificate,omitempty"`
+	Key           string                `json:"key,omitempty"`
+	CacheDuration *provisioner.Duration `json:"cacheDuration,omitempty"`
+	URL           string                `json:"url,omitempty"`
+}
+
+// IsEnabled returns if the OCSP responder is enabled.
+func (c *OCSPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// GetURL returns the URL of the OCSP responder added to the certificates.
+func (c *OCSPConfig) GetURL() string {
+	if c == nil {
+		return ""
+	}
+	return c.URL
+}
+
+// Validate validates the OCSP configuration.
+func (c *OCSPConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || !u.IsAbs() {
+			return errors.Errorf("ocsp.url %q is not a valid URL", c.URL)
+		}
+	}
+
+	switch {
+	case !c.Enabled:
+		return nil
+	case c.Certificate == "":
+		return errors.New("ocsp.certificate cannot be empty")
+	case c.Key == "":
+		return errors.New("ocsp.key cannot be empty")
+	case c.CacheDuration != nil && c.CacheDuration.Duration < 0:
+		return errors.New("ocsp.cacheDuration must be greater than or equal to 0")
+	}
+
+	return nil
+}
+
+// SignerConfig represents a named X.509 signer, an intermediate certificate and
+// key that provisioners can use instead of the default ones.
+type SignerConfig struct {
+	Name             string `json:"name"`
+	IntermediateCert string `json:"crt"`
+	IntermediateKey  string `json:"key"`
+}
+
+// Validate validates the signer configuration.
+func (c *SignerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("signer cannot be empty")
+	case c.Name == "":
+		return errors.New("signer name cannot be empty")
+	case c.IntermediateCert == "":
+		return errors.Errorf("signer %q crt cannot be empty", c.Name)
+	case c.IntermediateKey == "":
+		return errors.Errorf("signer %q key cannot be empty", c.Name)
+	default:
+		return nil
+	}
+}
+
+// ResponseSignerConfig represents the key used to sign the certificate
+// responses requested in the JWS format. The Certificate is a bundle with the
+// certificate of the key and its intermediates, and it must chain to one of
+// the roots of the CA. The public key and the certificates are published by
+// the CA, so clients can verify that the response was issued by it.
+type ResponseSignerConfig struct {
+	Certificate string `json:"certificate"`
+	Key         string `json:"key"`
+}
+
+// Validate validates the response signer configuration.
+func (c *ResponseSignerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Key == "":
+		return errors.New("responseSigner key cannot be empty")
+	case c.Certificate == "":
+		return errors.New("responseSigner certificate cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// IdempotencyConfig enables the cache of the certificates signed by the sign
+// endpoint. A retry of a sign request, with the same token, idempotency key
+// and certificate request, returns the certificate already signed if it is
+// retried within the Window. Size is the maximum number of
+// certificates kept by the default in-memory cache.
+type IdempotencyConfig struct {
+	Window *provisioner.Duration `json:"window"`
+	Size   int                   `json:"size,omitempty"`
+}
+
+// IsEnabled returns if the idempotency cache is enabled.
+func (c *IdempotencyConfig) IsEnabled() bool {
+	return c != nil
+}
+
+// GetWindow returns the time a signed certificate is kept in the cache.
+func (c *IdempotencyConfig) GetWindow() time.Duration {
+	if c == nil || c.Window == nil {
+		return 0
+	}
+	return c.Window.Duration
+}
+
+// Validate validates the idempotency configuration.
+func (c *IdempotencyConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.GetWindow() <= 0:
+		return errors.New("idempotency.window must be greater than 0")
+	case c.Size < 0:
+		return errors.New("idempotency.size cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// KeyBlocklistConfig configures the file with the fingerprints of the public
+// keys known to be compromised. The certificate requests with one of those
+// keys are rejected by all the provisioners, and so are the renewals and
+// rekeys of certificates with those keys. The file contains one SHA-256
+// fingerprint of the DER-encoded public key per line, and it's reloaded when
+// it's modified, with a delay of up to 10 seconds.
+type KeyBlocklistConfig struct {
+	File string `json:"file"`
+}
+
+// Validate validates the key blocklist configuration.
+func (c *KeyBlocklistConfig) Validate() error {
+	if c != nil && c.File == "" {
+		return errors.New("keyBlocklist.file cannot be empty")
+	}
+	return nil
+}
+
 // ASN1DN contains ASN1.DN attributes that are used in Subject and Issuer
 // x509 Certificate blocks.
 type ASN1DN struct {
@@ -158,17 +408,20 @@ type ASN1DN struct {
 // cas.Options.
 type AuthConfig struct {
 	*cas.Options
-	AuthorityID          string                `json:"authorityId,omitempty"`
-	DeploymentType       string                `json:"deploymentType,omitempty"`
-	Provisioners         provisioner.List      `json:"provisioners,omitempty"`
-	Admins               []*linkedca.Admin     `json:"-"`
-	Template             *ASN1DN               `json:"template,omitempty"`
-	Claims               *provisioner.Claims   `json:"claims,omitempty"`
-	Policy               *policy.Options       `json:"policy,omitempty"`
-	DisableIssuedAtCheck bool                  `json:"disableIssuedAtCheck,omitempty"`
-	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
-	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
-	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+	AuthorityID          string                              `json:"authorityId,omitempty"`
+	DeploymentType       string                              `json:"deploymentType,omitempty"`
+	Provisioners         provisioner.List                    `json:"provisioners,omitempty"`
+	Admins               []*linkedca.Admin                   `json:"-"`
+	Template             *ASN1DN                             `json:"template,omitempty"`
+	Claims               *provisioner.Claims                 `json:"claims,omitempty"`
+	Policy               *policy.Options                     `json:"policy,omitempty"`
+	DisableIssuedAtCheck bool                                `json:"disableIssuedAtCheck,omitempty"`
+	Backdate             *provisioner.Duration               `json:"backdate,omitempty"`
+	EnableAdmin          bool                                `json:"enableAdmin,omitempty"`
+	DisableGetSSHHosts   bool                                `json:"disableGetSSHHosts,omitempty"`
+	SerialNumberLength   int                                 `json:"serialNumberLength,omitempty"`
+	SignConcurrency      *provisioner.SignConcurrencyOptions `json:"signConcurrency,omitempty"`
+	EnableLocalSecrets   bool                                `json:"enableLocalSecrets,omitempty"`
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -211,6 +464,16 @@ func (c *AuthConfig) Validate(provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	// Serial numbers must be positive and at most 20 octets (RFC 5280), with
+	// at least 64 bits of entropy.
+	if c.SerialNumberLength != 0 && (c.SerialNumberLength < MinSerialNumberLength || c.SerialNumberLength > MaxSerialNumberLength) {
+		return errors.Errorf("authority.serialNumberLength must be between %d and %d", MinSerialNumberLength, MaxSerialNumberLength)
+	}
+
+	if err := c.SignConcurrency.Validate(); err != nil {
+		return errors.Wrap(err, "authority")
+	}
+
 	return nil
 }
 
@@ -255,6 +518,9 @@ func (c *Config) Init() {
 	if c.CRL != nil && c.CRL.Enabled && c.CRL.CacheDuration == nil {
 		c.CRL.CacheDuration = DefaultCRLCacheDuration
 	}
+	if c.OCSP != nil && c.OCSP.Enabled && c.OCSP.CacheDuration == nil {
+		c.OCSP.CacheDuration = DefaultOCSPCacheDuration
+	}
 	c.AuthorityConfig.init()
 }
 
@@ -377,6 +643,43 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate ocsp config: nil is ok
+	if err := c.OCSP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate acme config: nil is ok
+	if err := c.ACME.Validate(); err != nil {
+		return err
+	}
+
+	// Validate response signer: nil is ok
+	if err := c.ResponseSigner.Validate(); err != nil {
+		return err
+	}
+
+	// Validate idempotency config: nil is ok
+	if err := c.Idempotency.Validate(); err != nil {
+		return err
+	}
+
+	// Validate key blocklist config: nil is ok
+	if err := c.KeyBlocklist.Validate(); err != nil {
+		return err
+	}
+
+	// Validate named signers
+	signerNames := make(map[string]struct{}, len(c.Signers))
+	for _, s := range c.Signers {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if _, ok := signerNames[s.Name]; ok {
+			return errors.Errorf("signer %q is duplicated", s.Name)
+		}
+		signerNames[s.Name] = struct{}{}
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
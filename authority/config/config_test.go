@@ -72,6 +72,176 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("invalid address 127.0.0.1"),
 			}
 		},
+		"empty-signer-name": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					Signers: []*SignerConfig{
+						{IntermediateCert: "../testdata/secrets/intermediate_ca.crt", IntermediateKey: "../testdata/secrets/intermediate_ca_key"},
+					},
+				},
+				err: errors.New("signer name cannot be empty"),
+			}
+		},
+		"duplicated-signer": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					Signers: []*SignerConfig{
+						{Name: "bu1", IntermediateCert: "../testdata/secrets/intermediate_ca.crt", IntermediateKey: "../testdata/secrets/intermediate_ca_key"},
+						{Name: "bu1", IntermediateCert: "../testdata/secrets/intermediate_ca.crt", IntermediateKey: "../testdata/secrets/intermediate_ca_key"},
+					},
+				},
+				err: errors.New(`signer "bu1" is duplicated`),
+			}
+		},
+		"invalid-acme-validation-source-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					ACME:             &ACMEConfig{ValidationSourceAddress: "10.0.0"},
+				},
+				err: errors.New(`acme.validationSourceAddress "10.0.0" is not a valid IP address`),
+			}
+		},
+		"invalid-crl-distribution-points": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					CRL:              &CRLConfig{DistributionPoints: []string{"ca.smallstep.com/1.0/crl"}},
+				},
+				err: errors.New(`crl.distributionPoints "ca.smallstep.com/1.0/crl" is not a valid URL`),
+			}
+		},
+		"invalid-crl-key": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					CRL:              &CRLConfig{Enabled: true, Certificate: "crl.crt"},
+				},
+				err: errors.New(`crl.key cannot be empty if crl.certificate is set`),
+			}
+		},
+		"invalid-ocsp": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					OCSP:             &OCSPConfig{Enabled: true, Key: "ocsp.key"},
+				},
+				err: errors.New(`ocsp.certificate cannot be empty`),
+			}
+		},
+		"invalid-ocsp-url": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					OCSP:             &OCSPConfig{URL: "ca.smallstep.com/1.0/ocsp"},
+				},
+				err: errors.New(`ocsp.url "ca.smallstep.com/1.0/ocsp" is not a valid URL`),
+			}
+		},
+		"empty-response-signer-key": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					ResponseSigner:   &ResponseSignerConfig{},
+				},
+				err: errors.New("responseSigner key cannot be empty"),
+			}
+		},
+		"empty-response-signer-certificate": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					ResponseSigner:   &ResponseSignerConfig{Key: "response.key"},
+				},
+				err: errors.New("responseSigner certificate cannot be empty"),
+			}
+		},
+		"invalid-idempotency-window": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					Idempotency:      &IdempotencyConfig{},
+				},
+				err: errors.New("idempotency.window must be greater than 0"),
+			}
+		},
+		"empty-key-blocklist-file": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					KeyBlocklist:     &KeyBlocklistConfig{},
+				},
+				err: errors.New("keyBlocklist.file cannot be empty"),
+			}
+		},
 		"empty-root": func(t *testing.T) ConfigValidateTest {
 			return ConfigValidateTest{
 				config: &Config{
@@ -287,6 +457,51 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"ok-serial-number-length": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:       p,
+					SerialNumberLength: 16,
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-serial-number-length-too-short": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:       p,
+					SerialNumberLength: 8,
+				},
+				err: errors.New("authority.serialNumberLength must be between 9 and 20"),
+			}
+		},
+		"fail-serial-number-length-too-long": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:       p,
+					SerialNumberLength: 21,
+				},
+				err: errors.New("authority.serialNumberLength must be between 9 and 20"),
+			}
+		},
+		"ok-sign-concurrency": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:    p,
+					SignConcurrency: &provisioner.SignConcurrencyOptions{MaxConcurrent: 8, MaxQueued: 64},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-sign-concurrency": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:    p,
+					SignConcurrency: &provisioner.SignConcurrencyOptions{MaxConcurrent: 8, MaxQueued: -1},
+				},
+				err: errors.New("authority: signConcurrency maxQueued cannot be negative"),
+			}
+		},
 	}
 
 	for name, get := range tests {
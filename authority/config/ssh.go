@@ -8,13 +8,17 @@ import (
 )
 
 // SSHConfig contains the user and host keys.
+//
+// If AllowedProvisioners is set, only the provisioners with those names will be
+// able to issue SSH host and user certificates.
 type SSHConfig struct {
-	HostKey          string          `json:"hostKey"`
-	UserKey          string          `json:"userKey"`
-	Keys             []*SSHPublicKey `json:"keys,omitempty"`
-	AddUserPrincipal string          `json:"addUserPrincipal,omitempty"`
-	AddUserCommand   string          `json:"addUserCommand,omitempty"`
-	Bastion          *Bastion        `json:"bastion,omitempty"`
+	HostKey             string          `json:"hostKey"`
+	UserKey             string          `json:"userKey"`
+	Keys                []*SSHPublicKey `json:"keys,omitempty"`
+	AddUserPrincipal    string          `json:"addUserPrincipal,omitempty"`
+	AddUserCommand      string          `json:"addUserCommand,omitempty"`
+	Bastion             *Bastion        `json:"bastion,omitempty"`
+	AllowedProvisioners []string        `json:"allowedProvisioners,omitempty"`
 }
 
 // Bastion contains the custom properties used on bastion.
@@ -51,9 +55,28 @@ func (c *SSHConfig) Validate() error {
 			return err
 		}
 	}
+	for _, name := range c.AllowedProvisioners {
+		if name == "" {
+			return errors.New("ssh.allowedProvisioners cannot contain empty names")
+		}
+	}
 	return nil
 }
 
+// IsProvisionerAllowed returns true if the provisioner with the given name can
+// issue SSH certificates.
+func (c *SSHConfig) IsProvisionerAllowed(name string) bool {
+	if c == nil || len(c.AllowedProvisioners) == 0 {
+		return true
+	}
+	for _, s := range c.AllowedProvisioners {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
 // SSHPublicKey contains a public key used by federated CAs to keep old signing
 // keys for this ca.
 type SSHPublicKey struct {
@@ -0,0 +1,72 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+)
+
+// crlSigner signs the CRLs with a delegated CRL signing certificate instead of
+// the intermediate key.
+type crlSigner struct {
+	cert   *x509.Certificate
+	signer crypto.Signer
+}
+
+// initCRLSigner loads the delegated CRL signing certificate and its key. The
+// certificate must have the same subject as the intermediate, so the CRL can
+// be used to validate the certificates issued by it, and it must be issued by
+// one of the roots or intermediates. The key uses the same password as the
+// default intermediate key.
+func (a *Authority) initCRLSigner() error {
+	if !a.config.CRL.IsEnabled() || a.config.CRL.Certificate == "" {
+		return nil
+	}
+
+	cert, err := pemutil.ReadCertificate(a.config.CRL.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading CRL signer certificate")
+	}
+	if cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return errors.New("CRL signer certificate does not have the CRLSign key usage")
+	}
+
+	var sameSubject, issued bool
+	for _, crt := range a.intermediateX509Certs {
+		sameSubject = sameSubject || bytes.Equal(cert.RawSubject, crt.RawSubject)
+		issued = issued || cert.CheckSignatureFrom(crt) == nil
+	}
+	for _, crt := range a.rootX509Certs {
+		issued = issued || cert.CheckSignatureFrom(crt) == nil
+	}
+	if !sameSubject {
+		return errors.New("CRL signer certificate does not have the subject of the intermediate certificate")
+	}
+	if !issued {
+		return errors.New("CRL signer certificate is not issued by the root or intermediate certificates")
+	}
+
+	signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.CRL.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating CRL signer")
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("CRL signer key does not match the certificate")
+	}
+	if err := warmupSigner(signer); err != nil {
+		return errors.Wrap(err, "error signing with the CRL signer key")
+	}
+
+	a.crlSigner = &crlSigner{
+		cert:   cert,
+		signer: signer,
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// stubKMS is a KMS that returns the signers registered by URI.
+type stubKMS struct {
+	kmsapi.KeyManager
+	signers map[string]crypto.Signer
+}
+
+func (k *stubKMS) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	if s, ok := k.signers[req.SigningKey]; ok {
+		return s, nil
+	}
+	return nil, errors.New("key not found")
+}
+
+// newCRLSignerCertificate creates a delegated CRL signing certificate issued
+// by the given issuer and returns the path of the certificate and its key.
+func newCRLSignerCertificate(t *testing.T, subject pkix.Name, keyUsage x509.KeyUsage, issuer *x509.Certificate, issuerSigner crypto.Signer) (string, crypto.Signer) {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := x509util.CreateCertificate(&x509.Certificate{
+		Subject:               subject,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              keyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, issuer, signer.Public(), issuerSigner)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(t.TempDir(), "crl.crt")
+	_, err = pemutil.Serialize(cert, pemutil.ToFile(certFile, 0600))
+	require.NoError(t, err)
+	return certFile, signer
+}
+
+func TestAuthority_initCRLSigner(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+
+	subject := ca.Intermediate.Subject
+	certFile, signer := newCRLSignerCertificate(t, subject, x509.KeyUsageCRLSign, ca.Root, ca.RootSigner)
+	selfIssuedFile, selfIssuedSigner := newCRLSignerCertificate(t, subject, x509.KeyUsageCRLSign, ca.Intermediate, ca.Signer)
+	noKeyUsageFile, noKeyUsageSigner := newCRLSignerCertificate(t, subject, x509.KeyUsageDigitalSignature, ca.Root, ca.RootSigner)
+	otherSubjectFile, otherSubjectSigner := newCRLSignerCertificate(t, pkix.Name{CommonName: "CRL Signer"}, x509.KeyUsageCRLSign, ca.Root, ca.RootSigner)
+	otherIssuerFile, otherIssuerSigner := newCRLSignerCertificate(t, subject, x509.KeyUsageCRLSign, other.Root, other.RootSigner)
+
+	km := &stubKMS{signers: map[string]crypto.Signer{
+		"stubkms:name=crl":          signer,
+		"stubkms:name=self-issued":  selfIssuedSigner,
+		"stubkms:name=no-key-usage": noKeyUsageSigner,
+		"stubkms:name=subject":      otherSubjectSigner,
+		"stubkms:name=issuer":       otherIssuerSigner,
+		"stubkms:name=unavailable":  &failSigner{signer},
+	}}
+
+	tests := []struct {
+		name       string
+		config     *config.CRLConfig
+		wantSigner bool
+		wantErr    bool
+	}{
+		{"ok", &config.CRLConfig{Enabled: true, Certificate: certFile, Key: "stubkms:name=crl"}, true, false},
+		{"ok self-issued", &config.CRLConfig{Enabled: true, Certificate: selfIssuedFile, Key: "stubkms:name=self-issued"}, true, false},
+		{"ok intermediate key", &config.CRLConfig{Enabled: true}, false, false},
+		{"ok disabled", &config.CRLConfig{Certificate: certFile, Key: "stubkms:name=crl"}, false, false},
+		{"ok not configured", nil, false, false},
+		{"fail missing certificate", &config.CRLConfig{Enabled: true, Certificate: filepath.Join(t.TempDir(), "missing.crt"), Key: "stubkms:name=crl"}, false, true},
+		{"fail key usage", &config.CRLConfig{Enabled: true, Certificate: noKeyUsageFile, Key: "stubkms:name=no-key-usage"}, false, true},
+		{"fail subject", &config.CRLConfig{Enabled: true, Certificate: otherSubjectFile, Key: "stubkms:name=subject"}, false, true},
+		{"fail issuer", &config.CRLConfig{Enabled: true, Certificate: otherIssuerFile, Key: "stubkms:name=issuer"}, false, true},
+		{"fail missing key", &config.CRLConfig{Enabled: true, Certificate: certFile, Key: "stubkms:name=missing"}, false, true},
+		{"fail key mismatch", &config.CRLConfig{Enabled: true, Certificate: certFile, Key: "stubkms:name=self-issued"}, false, true},
+		{"fail kms unavailable", &config.CRLConfig{Enabled: true, Certificate: certFile, Key: "stubkms:name=unavailable"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config:                &config.Config{CRL: tt.config},
+				keyManager:            km,
+				rootX509Certs:         []*x509.Certificate{ca.Root},
+				intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+			}
+			err := a.initCRLSigner()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, a.crlSigner)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSigner, a.crlSigner != nil)
+		})
+	}
+}
+
+func TestAuthority_GenerateCertificateRevocationList_crlSigner(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	certFile, signer := newCRLSignerCertificate(t, ca.Intermediate.Subject, x509.KeyUsageCRLSign, ca.Root, ca.RootSigner)
+
+	var stored *db.CertificateRevocationListInfo
+	a := &Authority{
+		config: &config.Config{
+			DNSNames: []string{"ca.smallstep.com"},
+			CRL:      &config.CRLConfig{Enabled: true, Certificate: certFile, Key: "stubkms:name=crl", CacheDuration: config.DefaultCRLCacheDuration},
+		},
+		keyManager:            &stubKMS{signers: map[string]crypto.Signer{"stubkms:name=crl": signer}},
+		rootX509Certs:         []*x509.Certificate{ca.Root},
+		intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+		db: &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, database.ErrNotFound
+			},
+			MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+				return &[]db.RevokedCertificateInfo{
+					{Serial: "1234", RevokedAt: time.Now()},
+				}, nil
+			},
+			MStoreCRL: func(info *db.CertificateRevocationListInfo) error {
+				stored = info
+				return nil
+			},
+		},
+	}
+	require.NoError(t, a.initCRLSigner())
+
+	// The CRL is signed with the delegated key, without the CA service.
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	require.NotNil(t, stored)
+	crl, err := x509.ParseRevocationList(stored.DER)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Intermediate.RawSubject, crl.RawIssuer)
+	assert.Equal(t, []byte{1, 2, 3, 4}, crl.AuthorityKeyId)
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	assert.Equal(t, "1234", crl.RevokedCertificateEntries[0].SerialNumber.String())
+
+	crlCert, err := pemutil.ReadCertificate(certFile)
+	require.NoError(t, err)
+	assert.NoError(t, crl.CheckSignatureFrom(crlCert))
+	assert.Error(t, crl.CheckSignatureFrom(ca.Intermediate))
+}
@@ -0,0 +1,80 @@
+package authority
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// GetProvisionerFreeze returns the freeze of the issuance of certificates with
+// the given provisioner. A freeze set with SetProvisionerFreeze takes
+// precedence over the one in the provisioner claims. It returns nil if the
+// provisioner is not frozen.
+func (a *Authority) GetProvisionerFreeze(p provisioner.Interface) *provisioner.Freeze {
+	if v, ok := a.provisionerFreezes.Load(p.GetID()); ok {
+		return v.(*provisioner.Freeze)
+	}
+	if cg, ok := p.(provisioner.ClaimerGetter); ok {
+		if claimer := cg.GetClaimer(); claimer != nil {
+			return claimer.Freeze()
+		}
+	}
+	return nil
+}
+
+// SetProvisionerFreeze freezes the issuance of certificates with the given
+// provisioner, overriding the freeze in the provisioner claims. A nil freeze
+// lifts it. If the database supports it, the freeze is persisted, and it's
+// restored when the authority is restarted.
+func (a *Authority) SetProvisionerFreeze(p provisioner.Interface, f *provisioner.Freeze) error {
+	if fdb, ok := a.db.(db.ProvisionerFreezeDB); ok {
+		var err error
+		if f == nil {
+			err = fdb.DeleteProvisionerFreeze(p.GetID())
+		} else {
+			err = fdb.StoreProvisionerFreeze(p.GetID(), f)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error storing freeze of provisioner %s", p.GetName())
+		}
+	}
+	a.provisionerFreezes.Store(p.GetID(), f)
+	return nil
+}
+
+// loadProvisionerFreezes loads the freezes stored in the database, if the
+// database supports them.
+func (a *Authority) loadProvisionerFreezes() error {
+	fdb, ok := a.db.(db.ProvisionerFreezeDB)
+	if !ok {
+		return nil
+	}
+	freezes, err := fdb.GetProvisionerFreezes()
+	if err != nil {
+		return errors.Wrap(err, "error loading provisioner freezes")
+	}
+	for id, f := range freezes {
+		a.provisionerFreezes.Store(id, f)
+	}
+	return nil
+}
+
+// deleteProvisionerFreeze removes the freeze of a provisioner that is removed.
+func (a *Authority) deleteProvisionerFreeze(id string) error {
+	a.provisionerFreezes.Delete(id)
+	if fdb, ok := a.db.(db.ProvisionerFreezeDB); ok {
+		return fdb.DeleteProvisionerFreeze(id)
+	}
+	return nil
+}
+
+// checkProvisionerFreeze returns an error if the issuance of certificates with
+// the given provisioner is frozen. If renewal is true, the freeze might allow
+// the request.
+func (a *Authority) checkProvisionerFreeze(p provisioner.Interface, renewal bool) error {
+	if p == nil {
+		return nil
+	}
+	return a.GetProvisionerFreeze(p).Check(p.GetName(), renewal)
+}
@@ -0,0 +1,163 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_GetProvisionerFreeze(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	assert.Nil(t, a.GetProvisionerFreeze(p))
+
+	claimed := &provisioner.Freeze{AllowRenewal: true}
+	p.Claims.Freeze = claimed
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+	assert.Equal(t, claimed, a.GetProvisionerFreeze(p))
+
+	override := &provisioner.Freeze{}
+	require.NoError(t, a.SetProvisionerFreeze(p, override))
+	assert.Equal(t, override, a.GetProvisionerFreeze(p))
+
+	require.NoError(t, a.SetProvisionerFreeze(p, nil))
+	assert.Nil(t, a.GetProvisionerFreeze(p))
+}
+
+// freezeDB is an in-memory ProvisionerFreezeDB.
+type freezeDB struct {
+	db.MockAuthDB
+	freezes map[string]*provisioner.Freeze
+	err     error
+}
+
+func (d *freezeDB) GetProvisionerFreezes() (map[string]*provisioner.Freeze, error) {
+	return d.freezes, d.err
+}
+
+func (d *freezeDB) StoreProvisionerFreeze(id string, f *provisioner.Freeze) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.freezes[id] = f
+	return nil
+}
+
+func (d *freezeDB) DeleteProvisionerFreeze(id string) error {
+	if d.err != nil {
+		return d.err
+	}
+	delete(d.freezes, id)
+	return nil
+}
+
+func TestAuthority_SetProvisionerFreeze_persisted(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	fdb := &freezeDB{freezes: map[string]*provisioner.Freeze{}}
+	a.db = fdb
+
+	freeze := &provisioner.Freeze{AllowRenewal: true}
+	require.NoError(t, a.SetProvisionerFreeze(p, freeze))
+	assert.Equal(t, map[string]*provisioner.Freeze{p.GetID(): freeze}, fdb.freezes)
+
+	// A restarted authority restores the freeze.
+	restarted := testAuthority(t)
+	restarted.db = fdb
+	require.NoError(t, restarted.loadProvisionerFreezes())
+	assert.Equal(t, freeze, restarted.GetProvisionerFreeze(p))
+
+	require.NoError(t, a.SetProvisionerFreeze(p, nil))
+	assert.Empty(t, fdb.freezes)
+	assert.Nil(t, a.GetProvisionerFreeze(p))
+
+	// The freeze is not applied if it cannot be stored.
+	fdb.err = errors.New("force")
+	assert.Error(t, a.SetProvisionerFreeze(p, freeze))
+	assert.Nil(t, a.GetProvisionerFreeze(p))
+	assert.Error(t, restarted.loadProvisionerFreezes())
+}
+
+func TestAuthority_authorizeSign_freeze(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	require.NoError(t, err)
+
+	newToken := func(id string) string {
+		now := time.Now()
+		raw, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   "test.smallstep.com",
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  []string{"https://example.com/sign"},
+			ID:        id,
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return raw
+	}
+
+	until := time.Now().Add(time.Hour)
+	require.NoError(t, a.SetProvisionerFreeze(p, &provisioner.Freeze{Until: &until, AllowRenewal: true}))
+	_, err = a.authorizeSign(context.Background(), newToken("1"))
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+	assert.Contains(t, err.Error(), `provisioner "step-cli" is temporarily disabled until`)
+
+	expired := time.Now().Add(-time.Minute)
+	require.NoError(t, a.SetProvisionerFreeze(p, &provisioner.Freeze{Until: &expired}))
+	_, err = a.authorizeSign(context.Background(), newToken("2"))
+	assert.NoError(t, err)
+}
+
+func TestAuthority_Renew_freeze(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+
+	now := time.Now()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Hour), now.Add(time.Hour)),
+		withProvisionerOID("step-cli", p.Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	tests := []struct {
+		name    string
+		freeze  *provisioner.Freeze
+		wantErr bool
+	}{
+		{"ok not frozen", nil, false},
+		{"ok allow renewal", &provisioner.Freeze{AllowRenewal: true}, false},
+		{"fail frozen", &provisioner.Freeze{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, a.SetProvisionerFreeze(p, tt.freeze))
+			_, err := a.Renew(cert)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
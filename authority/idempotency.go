@@ -0,0 +1,205 @@
+package authority
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultIdempotencyCacheSize is the maximum number of certificates kept by
+// the default in-memory idempotency cache.
+const DefaultIdempotencyCacheSize = 10000
+
+// maxIdempotencyKeyLength is the maximum length of the idempotency keys sent
+// by the clients.
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyCache is the interface used to keep the certificates signed for
+// a sign request, so a retry of the same request returns the same certificate
+// instead of signing a new one. Implementations must be safe for concurrent
+// use.
+type IdempotencyCache interface {
+	// Load returns the certificate chain stored with the given key. It returns
+	// false if the key is not in the cache or it has expired.
+	Load(ctx context.Context, key string) ([]*x509.Certificate, bool, error)
+	// Store stores the certificate chain with the given key until the
+	// expiration time.
+	Store(ctx context.Context, key string, chain []*x509.Certificate, expiresAt time.Time) error
+}
+
+type memoryIdempotencyEntry struct {
+	key       string
+	chain     []*x509.Certificate
+	expiresAt time.Time
+}
+
+// memoryIdempotencyCache is an IdempotencyCache that keeps the certificates in
+// memory. When the cache is full, the least recently used certificate is
+// evicted.
+type memoryIdempotencyCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewMemoryIdempotencyCache returns an in-memory IdempotencyCache that keeps up
+// to size certificates.
+func NewMemoryIdempotencyCache(size int) IdempotencyCache {
+	if size <= 0 {
+		size = DefaultIdempotencyCacheSize
+	}
+	return &memoryIdempotencyCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Load implements the IdempotencyCache interface.
+func (c *memoryIdempotencyCache) Load(_ context.Context, key string) ([]*x509.Certificate, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*memoryIdempotencyEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(e)
+	return entry.chain, true, nil
+}
+
+// Store implements the IdempotencyCache interface.
+func (c *memoryIdempotencyCache) Store(_ context.Context, key string, chain []*x509.Certificate, expiresAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		entry := e.Value.(*memoryIdempotencyEntry)
+		entry.chain = chain
+		entry.expiresAt = expiresAt
+		return nil
+	}
+
+	c.items[key] = c.ll.PushFront(&memoryIdempotencyEntry{
+		key:       key,
+		chain:     chain,
+		expiresAt: expiresAt,
+	})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*memoryIdempotencyEntry).key)
+	}
+	return nil
+}
+
+// NewIdempotencyKey returns the key used to cache the certificate signed for a
+// sign request. It combines the token, the idempotency key sent by the client,
+// if any, and the certificate request, so a request with a different token or
+// certificate request always gets a new certificate. The token is always part
+// of the key because the cached certificate is returned before the token is
+// authorized, only the retries with the token that was verified when the
+// certificate was signed can get it. The idempotency key must have between 1
+// and 255 printable ASCII characters.
+func NewIdempotencyKey(idempotencyKey, token string, csr *x509.CertificateRequest) (string, error) {
+	switch {
+	case csr == nil:
+		return "", errors.New("certificate request cannot be empty")
+	case token == "":
+		return "", errors.New("token cannot be empty")
+	case idempotencyKey != "":
+		if err := validateIdempotencyKey(idempotencyKey); err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte("token:" + token))
+	h.Write([]byte{0})
+	h.Write([]byte("key:" + idempotencyKey))
+	h.Write([]byte{0})
+	h.Write(csr.Raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// validateIdempotencyKey returns an error if the idempotency key sent by the
+// client is too long or it contains characters other than printable ASCII.
+func validateIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return errors.Errorf("idempotency key cannot be longer than %d characters", maxIdempotencyKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return errors.New("idempotency key must contain only printable ASCII characters")
+		}
+	}
+	return nil
+}
+
+// IsIdempotencyEnabled returns true if the authority caches the certificates
+// signed for a sign request.
+func (a *Authority) IsIdempotencyEnabled() bool {
+	return a.idempotencyCache != nil && a.config.Idempotency.IsEnabled()
+}
+
+// LoadIdempotentCertificate returns the certificate chain signed before for
+// the given idempotency key. It returns false if the idempotency cache is not
+// enabled, if the key is not in the cache, or if the certificate has been
+// revoked.
+func (a *Authority) LoadIdempotentCertificate(ctx context.Context, key string) ([]*x509.Certificate, bool, error) {
+	if !a.IsIdempotencyEnabled() {
+		return nil, false, nil
+	}
+	chain, ok, err := a.idempotencyCache.Load(ctx, key)
+	if err != nil {
+		return nil, false, errs.Wrap(http.StatusInternalServerError, err, "authority.LoadIdempotentCertificate; error loading certificate")
+	}
+	if !ok || len(chain) == 0 {
+		return nil, false, nil
+	}
+	// Do not return the certificates revoked after they were signed.
+	revoked, err := a.IsRevoked(chain[0].SerialNumber.String())
+	if err != nil {
+		return nil, false, errs.Wrap(http.StatusInternalServerError, err, "authority.LoadIdempotentCertificate; error checking certificate")
+	}
+	if revoked {
+		return nil, false, nil
+	}
+	return chain, true, nil
+}
+
+// StoreIdempotentCertificate stores the certificate chain signed for the given
+// idempotency key. The certificate is kept for the configured window, but not
+// after it expires. It does nothing if the idempotency cache is not enabled.
+func (a *Authority) StoreIdempotentCertificate(ctx context.Context, key string, chain []*x509.Certificate) error {
+	if !a.IsIdempotencyEnabled() || len(chain) == 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(a.config.Idempotency.GetWindow())
+	if notAfter := chain[0].NotAfter; notAfter.Before(expiresAt) {
+		expiresAt = notAfter
+	}
+	if err := a.idempotencyCache.Store(ctx, key, chain, expiresAt); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.StoreIdempotentCertificate; error storing certificate")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func newIdempotencyChain(sn int64, notAfter time.Time) []*x509.Certificate {
+	return []*x509.Certificate{
+		{SerialNumber: big.NewInt(sn), NotAfter: notAfter},
+		{SerialNumber: big.NewInt(1)},
+	}
+}
+
+func TestNewMemoryIdempotencyCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemoryIdempotencyCache(2).(*memoryIdempotencyCache)
+	c.now = func() time.Time { return now }
+
+	chain1 := newIdempotencyChain(10, now.Add(time.Hour))
+	chain2 := newIdempotencyChain(20, now.Add(time.Hour))
+	chain3 := newIdempotencyChain(30, now.Add(time.Hour))
+
+	_, ok, err := c.Load(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Store(ctx, "key1", chain1, now.Add(time.Minute)))
+	require.NoError(t, c.Store(ctx, "key2", chain2, now.Add(time.Second)))
+	got, ok, err := c.Load(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, chain1, got)
+
+	// key2 is the least recently used key.
+	require.NoError(t, c.Store(ctx, "key3", chain3, now.Add(time.Minute)))
+	_, ok, err = c.Load(ctx, "key2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	got, ok, err = c.Load(ctx, "key3")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, chain3, got)
+
+	// Expired keys are removed.
+	c.now = func() time.Time { return now.Add(time.Minute) }
+	_, ok, err = c.Load(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.ll.Len())
+
+	// The default size is used with non-positive sizes.
+	assert.Equal(t, DefaultIdempotencyCacheSize, NewMemoryIdempotencyCache(0).(*memoryIdempotencyCache).size)
+}
+
+func TestNewIdempotencyKey(t *testing.T) {
+	csr1 := &x509.CertificateRequest{Raw: []byte("csr1")}
+	csr2 := &x509.CertificateRequest{Raw: []byte("csr2")}
+
+	key, err := NewIdempotencyKey("", "token", csr1)
+	require.NoError(t, err)
+	assert.Len(t, key, 64)
+
+	// Same requests get the same key.
+	same, err := NewIdempotencyKey("", "token", csr1)
+	require.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	// The token is always part of the key.
+	withKey, err := NewIdempotencyKey("request-1", "token", csr1)
+	require.NoError(t, err)
+	otherToken, err := NewIdempotencyKey("request-1", "other-token", csr1)
+	require.NoError(t, err)
+	assert.NotEqual(t, withKey, otherToken)
+
+	// Different requests get different keys.
+	for _, fn := range []func() (string, error){
+		func() (string, error) { return NewIdempotencyKey("", "other-token", csr1) },
+		func() (string, error) { return NewIdempotencyKey("", "token", csr2) },
+		func() (string, error) { return NewIdempotencyKey("request-1", "token", csr2) },
+		func() (string, error) { return NewIdempotencyKey("request-2", "token", csr1) },
+		func() (string, error) { return NewIdempotencyKey("token", "token", csr1) },
+	} {
+		other, err := fn()
+		require.NoError(t, err)
+		assert.NotEqual(t, key, other)
+		assert.NotEqual(t, withKey, other)
+	}
+
+	tests := []struct {
+		name           string
+		idempotencyKey string
+		token          string
+		csr            *x509.CertificateRequest
+	}{
+		{"fail csr", "request-1", "token", nil},
+		{"fail empty", "", "", csr1},
+		{"fail empty token", "request-1", "", csr1},
+		{"fail space", "request 1", "token", csr1},
+		{"fail control", "request\n1", "token", csr1},
+		{"fail non ascii", "request-ñ", "token", csr1},
+		{"fail length", strings.Repeat("a", 256), "token", csr1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewIdempotencyKey(tt.idempotencyKey, tt.token, tt.csr)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = NewIdempotencyKey(strings.Repeat("a", 255), "token", csr1)
+	assert.NoError(t, err)
+}
+
+func TestAuthority_IdempotentCertificate(t *testing.T) {
+	ctx := context.Background()
+	revoked := map[string]bool{}
+	newAuthority := func(cfg *config.IdempotencyConfig) *Authority {
+		return &Authority{
+			config: &Config{Idempotency: cfg},
+			db: &db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					if sn == "0" {
+						return false, errors.New("force")
+					}
+					return revoked[sn], nil
+				},
+			},
+			idempotencyCache: NewMemoryIdempotencyCache(0),
+		}
+	}
+	a := newAuthority(&config.IdempotencyConfig{
+		Window: &provisioner.Duration{Duration: time.Minute},
+	})
+	assert.True(t, a.IsIdempotencyEnabled())
+
+	// A retry returns the stored certificate and a new request does not.
+	chain := newIdempotencyChain(10, time.Now().Add(time.Hour))
+	require.NoError(t, a.StoreIdempotentCertificate(ctx, "key1", chain))
+	got, ok, err := a.LoadIdempotentCertificate(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, chain, got)
+	_, ok, err = a.LoadIdempotentCertificate(ctx, "key2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Revoked certificates are not returned.
+	revoked["10"] = true
+	_, ok, err = a.LoadIdempotentCertificate(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Certificates are not kept after they expire.
+	require.NoError(t, a.StoreIdempotentCertificate(ctx, "key3", newIdempotencyChain(20, time.Now().Add(-time.Second))))
+	_, ok, err = a.LoadIdempotentCertificate(ctx, "key3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Errors checking the revocation are returned.
+	require.NoError(t, a.StoreIdempotentCertificate(ctx, "key4", newIdempotencyChain(0, time.Now().Add(time.Hour))))
+	_, ok, err = a.LoadIdempotentCertificate(ctx, "key4")
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	// Nothing is cached if idempotency is not enabled.
+	a = newAuthority(nil)
+	assert.False(t, a.IsIdempotencyEnabled())
+	require.NoError(t, a.StoreIdempotentCertificate(ctx, "key1", newIdempotencyChain(30, time.Now().Add(time.Hour))))
+	_, ok, err = a.LoadIdempotentCertificate(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAuthority_init_idempotency(t *testing.T) {
+	a := testAuthority(t)
+	assert.False(t, a.IsIdempotencyEnabled())
+
+	cache := NewMemoryIdempotencyCache(1)
+	a = testAuthority(t, WithIdempotencyCache(cache))
+	assert.Equal(t, cache, a.idempotencyCache)
+	assert.False(t, a.IsIdempotencyEnabled())
+}
@@ -3,6 +3,7 @@ package authority
 import (
 	"crypto"
 	"io"
+	"time"
 
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
@@ -27,6 +28,10 @@ type Meter interface {
 	// X509WebhookEnriched is called whenever an X509 enriching webhook is called.
 	X509WebhookEnriched(provisioner.Interface, error)
 
+	// X509PolicyShadowed is called whenever an X509 policy in shadow mode is
+	// evaluated. The error is the one the policy would have returned.
+	X509PolicyShadowed(provisioner.Interface, error)
+
 	// SSHSigned is called whenever an SSH certificate is signed.
 	SSHSigned(provisioner.Interface, error)
 
@@ -42,24 +47,44 @@ type Meter interface {
 	// SSHWebhookEnriched is called whenever an SSH enriching webhook is called.
 	SSHWebhookEnriched(provisioner.Interface, error)
 
+	// SSHPolicyShadowed is called whenever an SSH policy in shadow mode is
+	// evaluated. The error is the one the policy would have returned.
+	SSHPolicyShadowed(provisioner.Interface, error)
+
+	// ProvisionerAuthorized is called whenever a provisioner authorizes, or
+	// refuses to authorize, a request. The method is one of "sign",
+	// "sshSign", "renew" or "revoke", and the duration is the time spent in
+	// the provisioner.
+	ProvisionerAuthorized(method string, p provisioner.Interface, d time.Duration, err error)
+
 	// KMSSigned is called per KMS signer signature.
 	KMSSigned(error)
+
+	// SignConcurrency is called whenever the number of in-flight or queued
+	// sign operations changes. The provisioner is nil for the limit of the
+	// authority.
+	SignConcurrency(p provisioner.Interface, inFlight, queued int)
 }
 
 // noopMeter implements a noop [Meter].
 type noopMeter struct{}
 
+func (noopMeter) SSHPolicyShadowed(provisioner.Interface, error)     {}
 func (noopMeter) SSHRekeyed(provisioner.Interface, error)            {}
 func (noopMeter) SSHRenewed(provisioner.Interface, error)            {}
 func (noopMeter) SSHSigned(provisioner.Interface, error)             {}
 func (noopMeter) SSHWebhookAuthorized(provisioner.Interface, error)  {}
 func (noopMeter) SSHWebhookEnriched(provisioner.Interface, error)    {}
+func (noopMeter) X509PolicyShadowed(provisioner.Interface, error)    {}
 func (noopMeter) X509Rekeyed(provisioner.Interface, error)           {}
 func (noopMeter) X509Renewed(provisioner.Interface, error)           {}
 func (noopMeter) X509Signed(provisioner.Interface, error)            {}
 func (noopMeter) X509WebhookAuthorized(provisioner.Interface, error) {}
 func (noopMeter) X509WebhookEnriched(provisioner.Interface, error)   {}
 func (noopMeter) KMSSigned(error)                                    {}
+func (noopMeter) SignConcurrency(provisioner.Interface, int, int)    {}
+
+func (noopMeter) ProvisionerAuthorized(string, provisioner.Interface, time.Duration, error) {}
 
 type instrumentedKeyManager struct {
 	kms.KeyManager
@@ -0,0 +1,275 @@
+package authority
+
+import (
+	"bytes"
+	"container/list"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// ocspCacheSize is the maximum number of OCSP responses cached. When the cache
+// is full, the least recently used response is evicted.
+const ocspCacheSize = 10000
+
+// ocspResponder signs the OCSP responses with a delegated OCSP signing
+// certificate and caches them until their next update.
+type ocspResponder struct {
+	issuer *x509.Certificate
+	cert   *x509.Certificate
+	signer crypto.Signer
+	ttl    time.Duration
+	mu     sync.Mutex
+	size   int
+	ll     *list.List
+	cache  map[string]*list.Element
+}
+
+type ocspCacheEntry struct {
+	sn        string
+	response  []byte
+	expiresAt time.Time
+}
+
+// initOCSPResponder loads the delegated OCSP signing certificate and its key.
+// The certificate must be issued by one of the intermediates, and the key uses
+// the same password as the default intermediate key.
+func (a *Authority) initOCSPResponder() error {
+	if !a.config.OCSP.IsEnabled() {
+		return nil
+	}
+
+	if _, ok := a.db.(db.RevokedCertificateDB); !ok {
+		return errors.New("OCSP responder requested, but database does not support it")
+	}
+
+	cert, err := pemutil.ReadCertificate(a.config.OCSP.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading OCSP responder certificate")
+	}
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageOCSPSigning) {
+		return errors.New("OCSP responder certificate does not have the OCSPSigning extended key usage")
+	}
+
+	var issuer *x509.Certificate
+	for _, crt := range a.intermediateX509Certs {
+		if cert.CheckSignatureFrom(crt) == nil {
+			issuer = crt
+			break
+		}
+	}
+	if issuer == nil {
+		return errors.New("OCSP responder certificate is not issued by the intermediate certificate")
+	}
+
+	signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.OCSP.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating OCSP responder signer")
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("OCSP responder key does not match the certificate")
+	}
+	if err := warmupSigner(signer); err != nil {
+		return errors.Wrap(err, "error signing with the OCSP responder key")
+	}
+
+	ttl := config.DefaultOCSPCacheDuration.Duration
+	if v := a.config.OCSP.CacheDuration; v != nil && v.Duration > 0 {
+		ttl = v.Duration
+	}
+
+	a.ocspResponder = &ocspResponder{
+		issuer: issuer,
+		cert:   cert,
+		signer: signer,
+		ttl:    ttl,
+		size:   ocspCacheSize,
+		ll:     list.New(),
+		cache:  make(map[string]*list.Element),
+	}
+	return nil
+}
+
+// GetOCSPResponse returns the DER encoded OCSP response for the given DER
+// encoded OCSP request. The status of the certificate is good if it is in the
+// database and it has not been revoked, revoked if it has been revoked, and
+// unknown otherwise. Malformed requests, and requests for certificates issued
+// by another CA, get an OCSP error response. The responses with the unknown
+// status are not cached.
+func (a *Authority) GetOCSPResponse(req []byte) ([]byte, error) {
+	r := a.ocspResponder
+	if r == nil {
+		return nil, errs.NotFound("authority.GetOCSPResponse; OCSP responder is not configured")
+	}
+
+	ocspReq, err := ocsp.ParseRequest(req)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+	if !r.isIssuer(ocspReq) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	sn := ocspReq.SerialNumber.String()
+	now := time.Now().Truncate(time.Second).UTC()
+	if b, ok := r.load(sn, now); ok {
+		return b, nil
+	}
+
+	template, err := a.getOCSPStatus(sn)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+	template.SerialNumber = ocspReq.SerialNumber
+	template.Certificate = r.cert
+	template.ThisUpdate = now
+	template.NextUpdate = now.Add(r.ttl)
+
+	b, err := ocsp.CreateResponse(r.issuer, r.cert, *template, r.signer)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse; error creating OCSP response")
+	}
+	if template.Status != ocsp.Unknown {
+		r.store(sn, b, template.NextUpdate)
+	}
+	return b, nil
+}
+
+// getOCSPStatus returns an OCSP response template with the status of the
+// certificate with the given serial number.
+func (a *Authority) getOCSPStatus(sn string) (*ocsp.Response, error) {
+	rdb, ok := a.db.(db.RevokedCertificateDB)
+	if !ok {
+		return nil, errors.New("database does not support OCSP")
+	}
+
+	rci, err := rdb.GetRevokedCertificate(sn)
+	switch {
+	case err == nil:
+		return &ocsp.Response{
+			Status:           ocsp.Revoked,
+			RevokedAt:        rci.RevokedAt,
+			RevocationReason: rci.ReasonCode,
+		}, nil
+	case !database.IsErrNotFound(err):
+		return nil, errors.Wrapf(err, "error checking revocation of serial number %s", sn)
+	}
+
+	_, err = a.db.GetCertificate(sn)
+	switch {
+	case err == nil:
+		return &ocsp.Response{Status: ocsp.Good}, nil
+	case database.IsErrNotFound(err), errors.Is(err, db.ErrNotImplemented):
+		return &ocsp.Response{Status: ocsp.Unknown}, nil
+	default:
+		return nil, errors.Wrapf(err, "error retrieving certificate with serial number %s", sn)
+	}
+}
+
+// clearOCSPResponse removes the cached OCSP response of the certificate with
+// the given serial number. It's called when a certificate is revoked.
+func (a *Authority) clearOCSPResponse(sn string) {
+	if r := a.ocspResponder; r != nil {
+		r.mu.Lock()
+		if e, ok := r.cache[sn]; ok {
+			r.ll.Remove(e)
+			delete(r.cache, sn)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// isIssuer returns true if the issuer name and key hashes of the request
+// match the issuer of the responder.
+func (r *ocspResponder) isIssuer(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(r.issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+// load returns the cached response for the given serial number if it has not
+// expired.
+func (r *ocspResponder) load(sn string, now time.Time) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.cache[sn]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*ocspCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		r.ll.Remove(e)
+		delete(r.cache, sn)
+		return nil, false
+	}
+	r.ll.MoveToFront(e)
+	return entry.response, true
+}
+
+// store caches the response for the given serial number. If the cache is full,
+// the least recently used response is evicted.
+func (r *ocspResponder) store(sn string, response []byte, expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.cache[sn]; ok {
+		r.ll.MoveToFront(e)
+		entry := e.Value.(*ocspCacheEntry)
+		entry.response = response
+		entry.expiresAt = expiresAt
+		return
+	}
+	r.cache[sn] = r.ll.PushFront(&ocspCacheEntry{
+		sn:        sn,
+		response:  response,
+		expiresAt: expiresAt,
+	})
+	for r.ll.Len() > r.size {
+		e := r.ll.Back()
+		r.ll.Remove(e)
+		delete(r.cache, e.Value.(*ocspCacheEntry).sn)
+	}
+}
+
+// hasExtKeyUsage returns true if the certificate has the given extended key
+// usage.
+func hasExtKeyUsage(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, v := range cert.ExtKeyUsage {
+		if v == eku {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package authority
+
+import (
+	"container/list"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/softkms"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// newOCSPResponderFiles creates a delegated OCSP signing certificate issued by
+// the given CA and returns the paths of the certificate and key.
+func newOCSPResponderFiles(t *testing.T, ca *minica.CA, ekus ...x509.ExtKeyUsage) (string, string, crypto.Signer) {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP Responder"},
+		PublicKey:   signer.Public(),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: ekus,
+	})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ocsp.crt")
+	_, err = pemutil.Serialize(cert, pemutil.ToFile(certFile, 0600))
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "ocsp.key")
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(keyFile, 0600))
+	require.NoError(t, err)
+	return certFile, keyFile, signer
+}
+
+func TestAuthority_initOCSPResponder(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+	km, err := softkms.New(context.Background(), kmsapi.Options{})
+	require.NoError(t, err)
+
+	certFile, keyFile, _ := newOCSPResponderFiles(t, ca, x509.ExtKeyUsageOCSPSigning)
+	noEKUCertFile, noEKUKeyFile, _ := newOCSPResponderFiles(t, ca, x509.ExtKeyUsageServerAuth)
+	otherCertFile, otherKeyFile, _ := newOCSPResponderFiles(t, other, x509.ExtKeyUsageOCSPSigning)
+
+	tests := []struct {
+		name    string
+		db      db.AuthDB
+		config  *config.OCSPConfig
+		wantTTL time.Duration
+		wantErr bool
+	}{
+		{"ok", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: keyFile}, time.Hour, false},
+		{"ok cache duration", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: keyFile, CacheDuration: &provisioner.Duration{Duration: time.Minute}}, time.Minute, false},
+		{"ok disabled", nil, &config.OCSPConfig{URL: "https://ca.smallstep.com/1.0/ocsp"}, 0, false},
+		{"ok not configured", nil, nil, 0, false},
+		{"fail database", nil, &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: keyFile}, 0, true},
+		{"fail missing certificate", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: filepath.Join(t.TempDir(), "missing.crt"), Key: keyFile}, 0, true},
+		{"fail extended key usage", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: noEKUCertFile, Key: noEKUKeyFile}, 0, true},
+		{"fail issuer", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: otherCertFile, Key: otherKeyFile}, 0, true},
+		{"fail key mismatch", &db.MockAuthDB{}, &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: otherKeyFile}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config:                &config.Config{OCSP: tt.config},
+				keyManager:            km,
+				intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+			}
+			if tt.db != nil {
+				a.db = tt.db
+			}
+			err := a.initOCSPResponder()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, a.ocspResponder)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantTTL == 0 {
+				assert.Nil(t, a.ocspResponder)
+				return
+			}
+			require.NotNil(t, a.ocspResponder)
+			assert.Equal(t, ca.Intermediate, a.ocspResponder.issuer)
+			assert.Equal(t, tt.wantTTL, a.ocspResponder.ttl)
+		})
+	}
+}
+
+func TestAuthority_initOCSPResponder_kms(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	certFile, _, signer := newOCSPResponderFiles(t, ca, x509.ExtKeyUsageOCSPSigning)
+	km := &stubKMS{signers: map[string]crypto.Signer{
+		"stubkms:name=ocsp":        signer,
+		"stubkms:name=unavailable": &failSigner{signer},
+	}}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"ok", "stubkms:name=ocsp", false},
+		{"fail missing key", "stubkms:name=missing", true},
+		{"fail kms unavailable", "stubkms:name=unavailable", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config:                &config.Config{OCSP: &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: tt.key}},
+				db:                    &db.MockAuthDB{},
+				keyManager:            km,
+				intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+			}
+			err := a.initOCSPResponder()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, a.ocspResponder)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, a.ocspResponder)
+			assert.Equal(t, signer, a.ocspResponder.signer)
+		})
+	}
+}
+
+func TestAuthority_GetOCSPResponse(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+	km, err := softkms.New(context.Background(), kmsapi.Options{})
+	require.NoError(t, err)
+	certFile, keyFile, _ := newOCSPResponderFiles(t, ca, x509.ExtKeyUsageOCSPSigning)
+
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	var revokedCalls int
+	mockDB := &db.MockAuthDB{
+		MGetRevokedCertificate: func(sn string) (*db.RevokedCertificateInfo, error) {
+			revokedCalls++
+			switch sn {
+			case "2":
+				return &db.RevokedCertificateInfo{Serial: sn, ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt}, nil
+			case "4":
+				return nil, errors.New("force")
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+		MGetCertificate: func(sn string) (*x509.Certificate, error) {
+			switch sn {
+			case "1", "2":
+				return &x509.Certificate{}, nil
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+	}
+
+	a := &Authority{
+		config: &config.Config{OCSP: &config.OCSPConfig{
+			Enabled: true, Certificate: certFile, Key: keyFile,
+		}},
+		keyManager:            km,
+		intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+		db:                    mockDB,
+	}
+	require.NoError(t, a.initOCSPResponder())
+
+	newRequest := func(t *testing.T, issuer *x509.Certificate, sn int64) []byte {
+		b, err := ocsp.CreateRequest(&x509.Certificate{SerialNumber: big.NewInt(sn)}, issuer, nil)
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("ok good", func(t *testing.T) {
+		b, err := a.GetOCSPResponse(newRequest(t, ca.Intermediate, 1))
+		require.NoError(t, err)
+		resp, err := ocsp.ParseResponse(b, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Good, resp.Status)
+		assert.Equal(t, big.NewInt(1), resp.SerialNumber)
+		assert.Equal(t, time.Hour, resp.NextUpdate.Sub(resp.ThisUpdate))
+	})
+
+	t.Run("ok revoked", func(t *testing.T) {
+		b, err := a.GetOCSPResponse(newRequest(t, ca.Intermediate, 2))
+		require.NoError(t, err)
+		resp, err := ocsp.ParseResponse(b, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Revoked, resp.Status)
+		assert.Equal(t, big.NewInt(2), resp.SerialNumber)
+		assert.Equal(t, ocsp.KeyCompromise, resp.RevocationReason)
+		assert.Equal(t, revokedAt, resp.RevokedAt)
+	})
+
+	t.Run("ok unknown", func(t *testing.T) {
+		b, err := a.GetOCSPResponse(newRequest(t, ca.Intermediate, 3))
+		require.NoError(t, err)
+		resp, err := ocsp.ParseResponse(b, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Unknown, resp.Status)
+		assert.Equal(t, big.NewInt(3), resp.SerialNumber)
+	})
+
+	t.Run("ok cached", func(t *testing.T) {
+		req := newRequest(t, ca.Intermediate, 1)
+		calls := revokedCalls
+		b1, err := a.GetOCSPResponse(req)
+		require.NoError(t, err)
+		b2, err := a.GetOCSPResponse(req)
+		require.NoError(t, err)
+		assert.Equal(t, b1, b2)
+		assert.Equal(t, calls, revokedCalls)
+
+		a.clearOCSPResponse("1")
+		_, err = a.GetOCSPResponse(req)
+		require.NoError(t, err)
+		assert.Equal(t, calls+1, revokedCalls)
+	})
+
+	t.Run("ok unknown not cached", func(t *testing.T) {
+		req := newRequest(t, ca.Intermediate, 3)
+		calls := revokedCalls
+		_, err := a.GetOCSPResponse(req)
+		require.NoError(t, err)
+		_, err = a.GetOCSPResponse(req)
+		require.NoError(t, err)
+		assert.Equal(t, calls+2, revokedCalls)
+		a.ocspResponder.mu.Lock()
+		_, ok := a.ocspResponder.cache["3"]
+		a.ocspResponder.mu.Unlock()
+		assert.False(t, ok)
+	})
+
+	t.Run("ok malformed", func(t *testing.T) {
+		b, err := a.GetOCSPResponse([]byte("not-a-request"))
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.MalformedRequestErrorResponse, b)
+	})
+
+	t.Run("ok unauthorized", func(t *testing.T) {
+		b, err := a.GetOCSPResponse(newRequest(t, other.Intermediate, 1))
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.UnauthorizedErrorResponse, b)
+	})
+
+	t.Run("fail database", func(t *testing.T) {
+		_, err := a.GetOCSPResponse(newRequest(t, ca.Intermediate, 4))
+		assert.Error(t, err)
+	})
+
+	t.Run("fail not configured", func(t *testing.T) {
+		a := &Authority{config: &config.Config{}}
+		_, err := a.GetOCSPResponse(newRequest(t, ca.Intermediate, 1))
+		assert.Error(t, err)
+	})
+}
+
+func Test_ocspResponder_cache(t *testing.T) {
+	now := time.Now()
+	r := &ocspResponder{
+		size:  2,
+		ll:    list.New(),
+		cache: make(map[string]*list.Element),
+	}
+
+	r.store("1", []byte("one"), now.Add(time.Hour))
+	r.store("2", []byte("two"), now.Add(time.Hour))
+	b, ok := r.load("1", now)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("one"), b)
+
+	// "2" is the least recently used response.
+	r.store("3", []byte("three"), now.Add(time.Hour))
+	assert.Equal(t, 2, r.ll.Len())
+	_, ok = r.load("2", now)
+	assert.False(t, ok)
+	_, ok = r.load("1", now)
+	assert.True(t, ok)
+	_, ok = r.load("3", now)
+	assert.True(t, ok)
+
+	// Expired responses are removed.
+	_, ok = r.load("1", now.Add(time.Hour))
+	assert.False(t, ok)
+	assert.Equal(t, 1, r.ll.Len())
+
+	a := &Authority{ocspResponder: r}
+	a.clearOCSPResponse("3")
+	_, ok = r.load("3", now)
+	assert.False(t, ok)
+	assert.Equal(t, 0, r.ll.Len())
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/kms"
@@ -130,6 +132,104 @@ func WithAuthorizeSSHRenewFunc(fn func(ctx context.Context, p *provisioner.Contr
 	}
 }
 
+// WithSANResolver sets a custom resolver that adds subject alternative names
+// to the X.509 certificates authorized by the provisioners.
+func WithSANResolver(r provisioner.SANResolver) Option {
+	return func(a *Authority) error {
+		a.sanResolver = r
+		return nil
+	}
+}
+
+// WithKeyBlocklist sets the blocklist used by the provisioners to reject the
+// certificate requests with public keys known to be compromised. It takes
+// precedence over the keyBlocklist configuration.
+func WithKeyBlocklist(b provisioner.KeyBlocklist) Option {
+	return func(a *Authority) error {
+		a.keyBlocklist = b
+		return nil
+	}
+}
+
+// WithTokenCache sets the cache used by the provisioners with replay
+// protection to reject the reuse of a token. By default each of those
+// provisioners uses an in-memory cache. Deployments with more than one CA
+// instance should use a cache shared by all of them, e.g. one backed by Redis
+// where Use is an atomic SET NX with an expiration at expiresAt.
+func WithTokenCache(c provisioner.TokenCache) Option {
+	return func(a *Authority) error {
+		a.tokenCache = c
+		return nil
+	}
+}
+
+// WithIdempotencyCache sets the cache used to return the same certificate to
+// the retries of a sign request. The cache is only used if idempotency is
+// enabled in the configuration, and by default it is an in-memory cache.
+// Deployments with more than one CA instance should use a cache shared by all
+// of them.
+func WithIdempotencyCache(c IdempotencyCache) Option {
+	return func(a *Authority) error {
+		a.idempotencyCache = c
+		return nil
+	}
+}
+
+// WithRateLimiter sets the rate limiter used by the provisioners with a rate
+// limit. By default the authority uses an in-memory rate limiter shared by all
+// the provisioners, that keeps the limits when the provisioners are reloaded.
+func WithRateLimiter(l provisioner.RateLimiter) Option {
+	return func(a *Authority) error {
+		a.rateLimiter = l
+		return nil
+	}
+}
+
+// WithEmailCodeStore sets the store used by the email provisioners to keep the
+// one-time codes. By default each of those provisioners uses an in-memory
+// store, so deployments with more than one CA instance should use a store
+// shared by all of them.
+func WithEmailCodeStore(s provisioner.EmailCodeStore) Option {
+	return func(a *Authority) error {
+		a.emailCodeStore = s
+		return nil
+	}
+}
+
+// WithEmailSender sets the sender used by the email provisioners without an
+// SMTP server to deliver the one-time codes.
+func WithEmailSender(s provisioner.EmailSender) Option {
+	return func(a *Authority) error {
+		a.emailSender = s
+		return nil
+	}
+}
+
+// WithSecretResolver sets the resolver used by the provisioners for the
+// references to secrets with the given scheme, e.g. "vault" for references
+// like vault://secret/data/step#encryptedKey. The resolvers set with this
+// option are available to all the provisioners, including the ones managed
+// with the admin API, unlike the default file and env resolvers.
+func WithSecretResolver(scheme string, r provisioner.SecretResolver) Option {
+	return func(a *Authority) error {
+		if a.secretResolvers == nil {
+			a.secretResolvers = make(map[string]provisioner.SecretResolver)
+		}
+		a.secretResolvers[scheme] = r
+		return nil
+	}
+}
+
+// WithAuditLogger sets the logger used to record the authorization decisions
+// of the sign, SSH sign and revoke requests. By default the decisions are only
+// logged if the auditLog option is enabled in the configuration.
+func WithAuditLogger(l AuditLogger) Option {
+	return func(a *Authority) error {
+		a.auditLogger = l
+		return nil
+	}
+}
+
 // WithSSHBastionFunc sets a custom function to get the bastion for a
 // given user-host pair.
 func WithSSHBastionFunc(fn func(ctx context.Context, user, host string) (*config.Bastion, error)) Option {
@@ -403,3 +503,18 @@ func WithMeter(m Meter) Option {
 		return
 	}
 }
+
+// WithTracerProvider is an option that sets the [trace.TracerProvider] used to
+// create the spans of the authorization and signing requests. By default, the
+// spans are not recorded.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+
+	return func(a *Authority) (_ error) {
+		a.tracerProvider = tp
+
+		return
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/smallstep/certificates/authority/admin"
 	authPolicy "github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/errs"
 	policy "github.com/smallstep/certificates/policy"
 )
 
@@ -241,6 +242,20 @@ func (a *Authority) reloadPolicyEngines(ctx context.Context) error {
 	return nil
 }
 
+// withPolicyViolations returns an errs.Option that adds the names rejected by
+// the name policy to the error response, if err is a NotAllowed policy error.
+func withPolicyViolations(err error) errs.Option {
+	return func(e *errs.Error) error {
+		var policyErr *policy.NamePolicyError
+		if errors.As(err, &policyErr) && policyErr.Reason == policy.NotAllowed {
+			e.ResponseDetails = map[string]any{
+				"violations": policyErr.GetViolations(),
+			}
+		}
+		return e
+	}
+}
+
 func isAllowed(engine authPolicy.X509Policy, sans []string) error {
 	if err := engine.AreSANsAllowed(sans); err != nil {
 		var policyErr *policy.NamePolicyError
@@ -2,17 +2,30 @@ package policy
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
 	"errors"
 	"fmt"
 
 	"golang.org/x/crypto/ssh"
 )
 
+var (
+	// oidExtensionExtendedKeyUsage is the object identifier of the extended
+	// key usage extension.
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	// oidExtKeyUsageAny is the object identifier of the anyExtendedKeyUsage
+	// extended key usage.
+	oidExtKeyUsageAny = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
 // Engine is a container for multiple policies.
 type Engine struct {
 	x509Policy    X509Policy
 	sshUserPolicy UserPolicy
 	sshHostPolicy HostPolicy
+	x509DenyAny   bool
+	x509Shadow    bool
+	sshShadow     bool
 }
 
 // New returns a new Engine using Options.
@@ -49,15 +62,41 @@ func New(options *Options) (*Engine, error) {
 		x509Policy:    x509Policy,
 		sshHostPolicy: sshHostPolicy,
 		sshUserPolicy: sshUserPolicy,
+		x509DenyAny:   options.GetX509Options().IsAnyExtendedKeyUsageDenied(),
+		x509Shadow:    options.GetX509Options().IsShadow(),
+		sshShadow:     options.GetSSHOptions().IsShadow(),
 	}, nil
 }
 
+// IsX509Shadow returns true if an X.509 policy is configured in shadow mode.
+// The result of the X.509 policy evaluation must then be recorded instead of
+// being enforced.
+func (e *Engine) IsX509Shadow() bool {
+	return e != nil && (e.x509Policy != nil || e.x509DenyAny) && e.x509Shadow
+}
+
+// IsSSHShadow returns true if an SSH user or host policy is configured in
+// shadow mode. The result of the SSH policy evaluation must then be recorded
+// instead of being enforced.
+func (e *Engine) IsSSHShadow() bool {
+	return e != nil && (e.sshHostPolicy != nil || e.sshUserPolicy != nil) && e.sshShadow
+}
+
 // IsX509CertificateAllowed evaluates an X.509 certificate against
 // the X.509 policy (if available) and returns an error if one of the
-// names in the certificate is not allowed.
+// names in the certificate is not allowed, or if the certificate has the
+// anyExtendedKeyUsage extended key usage and it is denied.
 func (e *Engine) IsX509CertificateAllowed(cert *x509.Certificate) error {
+	if e == nil {
+		return nil
+	}
+
+	if e.x509DenyAny && hasAnyExtendedKeyUsage(cert) {
+		return errors.New("certificate with anyExtendedKeyUsage is not allowed")
+	}
+
 	// return early if there's no policy to evaluate
-	if e == nil || e.x509Policy == nil {
+	if e.x509Policy == nil {
 		return nil
 	}
 
@@ -65,6 +104,39 @@ func (e *Engine) IsX509CertificateAllowed(cert *x509.Certificate) error {
 	return e.x509Policy.IsX509CertificateAllowed(cert)
 }
 
+// hasAnyExtendedKeyUsage returns true if the certificate has the
+// anyExtendedKeyUsage extended key usage, either as a known or as an unknown
+// extended key usage, or in an extended key usage extension in the extra
+// extensions, that replaces the other ones when the certificate is created.
+// An extra extension that cannot be parsed is considered to have it.
+func hasAnyExtendedKeyUsage(cert *x509.Certificate) bool {
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			continue
+		}
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(ext.Value, &oids); err != nil || len(rest) > 0 {
+			return true
+		}
+		for _, oid := range oids {
+			if oid.Equal(oidExtKeyUsageAny) {
+				return true
+			}
+		}
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		if oid.Equal(oidExtKeyUsageAny) {
+			return true
+		}
+	}
+	return false
+}
+
 // AreSANsAllowed evaluates the slice of SANs against the X.509 policy
 // (if available) and returns an error if one of the SANs is not allowed.
 func (e *Engine) AreSANsAllowed(sans []string) error {
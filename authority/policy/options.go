@@ -45,6 +45,15 @@ type X509PolicyOptions struct {
 	// AllowWildcardNames indicates if literal wildcard names
 	// like *.example.com are allowed. Defaults to false.
 	AllowWildcardNames bool `json:"allowWildcardNames,omitempty"`
+
+	// DenyAnyExtendedKeyUsage indicates that certificates with the
+	// anyExtendedKeyUsage extended key usage are not allowed. Defaults to
+	// false.
+	DenyAnyExtendedKeyUsage bool `json:"denyAnyExtendedKeyUsage,omitempty"`
+
+	// Shadow indicates that the policy is evaluated but not enforced.
+	// Certificates that would be denied are logged and signed as usual.
+	Shadow bool `json:"shadow,omitempty"`
 }
 
 // X509NameOptions models the X509 name policy configuration.
@@ -91,6 +100,18 @@ func (o *X509PolicyOptions) AreWildcardNamesAllowed() bool {
 	return o.AllowWildcardNames
 }
 
+// IsAnyExtendedKeyUsageDenied returns whether the authority denies
+// certificates with the anyExtendedKeyUsage extended key usage.
+func (o *X509PolicyOptions) IsAnyExtendedKeyUsageDenied() bool {
+	return o != nil && o.DenyAnyExtendedKeyUsage
+}
+
+// IsShadow returns whether the x509 policy is evaluated in shadow
+// mode, without denying any certificate.
+func (o *X509PolicyOptions) IsShadow() bool {
+	return o != nil && o.Shadow
+}
+
 // SSHPolicyOptionsInterface is an interface for providers of
 // SSH user and host name policy configuration.
 type SSHPolicyOptionsInterface interface {
@@ -107,6 +128,16 @@ type SSHPolicyOptions struct {
 	User *SSHUserCertificateOptions `json:"user,omitempty"`
 	// Host contains SSH host certificate options.
 	Host *SSHHostCertificateOptions `json:"host,omitempty"`
+	// Shadow indicates that the user and host policies are evaluated but
+	// not enforced. Certificates that would be denied are logged and signed
+	// as usual.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// IsShadow returns whether the SSH policies are evaluated in shadow
+// mode, without denying any certificate.
+func (o *SSHPolicyOptions) IsShadow() bool {
+	return o != nil && o.Shadow
 }
 
 // GetAllowedUserNameOptions returns the SSH allowed user name policy
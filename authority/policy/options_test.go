@@ -1,6 +1,9 @@
 package policy
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"testing"
 )
 
@@ -43,3 +46,157 @@ func TestX509PolicyOptions_IsWildcardLiteralAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_IsShadow(t *testing.T) {
+	names := &X509NameOptions{DNSDomains: []string{"*.local"}}
+	sshNames := &SSHNameOptions{Principals: []string{"root"}}
+	tests := []struct {
+		name     string
+		options  *Options
+		wantX509 bool
+		wantSSH  bool
+	}{
+		{
+			name:    "nil-options",
+			options: nil,
+		},
+		{
+			name: "not-set",
+			options: &Options{
+				X509: &X509PolicyOptions{AllowedNames: names},
+				SSH:  &SSHPolicyOptions{User: &SSHUserCertificateOptions{DeniedNames: sshNames}},
+			},
+		},
+		{
+			name: "set-without-names",
+			options: &Options{
+				X509: &X509PolicyOptions{Shadow: true},
+				SSH:  &SSHPolicyOptions{Shadow: true},
+			},
+		},
+		{
+			name: "set-deny-any-extended-key-usage",
+			options: &Options{
+				X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true, Shadow: true},
+			},
+			wantX509: true,
+		},
+		{
+			name: "set-x509",
+			options: &Options{
+				X509: &X509PolicyOptions{AllowedNames: names, Shadow: true},
+				SSH:  &SSHPolicyOptions{User: &SSHUserCertificateOptions{DeniedNames: sshNames}},
+			},
+			wantX509: true,
+		},
+		{
+			name: "set-ssh",
+			options: &Options{
+				X509: &X509PolicyOptions{AllowedNames: names},
+				SSH:  &SSHPolicyOptions{User: &SSHUserCertificateOptions{DeniedNames: sshNames}, Shadow: true},
+			},
+			wantSSH: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.options)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := e.IsX509Shadow(); got != tt.wantX509 {
+				t.Errorf("Engine.IsX509Shadow() = %v, want %v", got, tt.wantX509)
+			}
+			if got := e.IsSSHShadow(); got != tt.wantSSH {
+				t.Errorf("Engine.IsSSHShadow() = %v, want %v", got, tt.wantSSH)
+			}
+		})
+	}
+}
+
+func mustMarshalOIDs(t *testing.T, oids ...asn1.ObjectIdentifier) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(oids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestEngine_IsX509CertificateAllowed_anyExtendedKeyUsage(t *testing.T) {
+	names := &X509NameOptions{DNSDomains: []string{"*.local"}}
+	tests := []struct {
+		name    string
+		options *Options
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{
+			name:    "ok/permissive",
+			options: &Options{X509: &X509PolicyOptions{}},
+			cert:    &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}},
+		},
+		{
+			name:    "ok/specific",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert:    &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}},
+		},
+		{
+			name:    "ok/names",
+			options: &Options{X509: &X509PolicyOptions{AllowedNames: names, DenyAnyExtendedKeyUsage: true}},
+			cert:    &x509.Certificate{DNSNames: []string{"foo.local"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}},
+		},
+		{
+			name:    "fail/any",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert:    &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageAny}},
+			wantErr: true,
+		},
+		{
+			name:    "fail/unknown-any",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert:    &x509.Certificate{UnknownExtKeyUsage: []asn1.ObjectIdentifier{{2, 5, 29, 37, 0}}},
+			wantErr: true,
+		},
+		{
+			name:    "ok/extra-extension",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert: &x509.Certificate{ExtraExtensions: []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: mustMarshalOIDs(t, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1})},
+			}},
+		},
+		{
+			name:    "fail/extra-extension",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert: &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, ExtraExtensions: []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: mustMarshalOIDs(t, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, asn1.ObjectIdentifier{2, 5, 29, 37, 0})},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "fail/extra-extension-invalid",
+			options: &Options{X509: &X509PolicyOptions{DenyAnyExtendedKeyUsage: true}},
+			cert: &x509.Certificate{ExtraExtensions: []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: []byte("invalid")},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "fail/names",
+			options: &Options{X509: &X509PolicyOptions{AllowedNames: names, DenyAnyExtendedKeyUsage: true}},
+			cert:    &x509.Certificate{DNSNames: []string{"foo.local"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.options)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := e.IsX509CertificateAllowed(tt.cert); (err != nil) != tt.wantErr {
+				t.Errorf("Engine.IsX509CertificateAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
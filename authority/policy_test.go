@@ -17,6 +17,8 @@ import (
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	namepolicy "github.com/smallstep/certificates/policy"
 )
 
 func TestAuthority_checkPolicy(t *testing.T) {
@@ -866,6 +868,23 @@ func TestAuthority_reloadPolicyEngines(t *testing.T) {
 	}
 }
 
+func Test_withPolicyViolations(t *testing.T) {
+	notAllowed := &namepolicy.NamePolicyError{Reason: namepolicy.NotAllowed, NameType: namepolicy.DNSNameType, Name: "bad.local", Rule: namepolicy.DeniedRule, Constraint: "bad.local"}
+	e := errs.ApplyOptions(errs.ForbiddenErr(notAllowed, "error validating certificate"), withPolicyViolations(notAllowed))
+	var ee *errs.Error
+	if assert.True(t, errors.As(e, &ee)) {
+		assert.Equal(t, 403, ee.StatusCode())
+		assert.Equal(t, map[string]any{"violations": notAllowed.GetViolations()}, ee.ResponseDetails)
+	}
+
+	cannotParse := &namepolicy.NamePolicyError{Reason: namepolicy.CannotParseDomain, NameType: namepolicy.DNSNameType, Name: "*.*.local"}
+	e = errs.ApplyOptions(errs.ForbiddenErr(cannotParse, "error validating certificate"), withPolicyViolations(cannotParse))
+	if assert.True(t, errors.As(e, &ee)) {
+		assert.Equal(t, 403, ee.StatusCode())
+		assert.Nil(t, ee.ResponseDetails)
+	}
+}
+
 func TestAuthority_checkAuthorityPolicy(t *testing.T) {
 	type fields struct {
 		provisioners *provisioner.Collection
@@ -3,14 +3,21 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/smallstep/certificates/errs"
 )
 
 // ACMEChallenge represents the supported acme challenges.
@@ -76,6 +83,77 @@ func (f ACMEAttestationFormat) Validate() error {
 	}
 }
 
+// ACMEAttestationMode defines how the device-attest-01 challenge handles the
+// device attestations.
+type ACMEAttestationMode string
+
+const (
+	// ACMEAttestationOff disables the device attestations, the
+	// device-attest-01 challenge is always rejected, and certificates with a
+	// permanent identifier are not issued in this mode.
+	ACMEAttestationOff ACMEAttestationMode = "off"
+	// ACMEAttestationPermissive verifies the device attestations, but the
+	// device-attest-01 challenge is valid even if the verification fails. The
+	// result of the verification is added to the certificate, and the
+	// permanent identifier is only added if the verification passes.
+	ACMEAttestationPermissive ACMEAttestationMode = "permissive"
+	// ACMEAttestationEnforced rejects the device-attest-01 challenge if the
+	// device attestation cannot be verified. This is the default mode.
+	ACMEAttestationEnforced ACMEAttestationMode = "enforced"
+)
+
+// Validate returns an error if the attestation mode is not supported.
+func (m ACMEAttestationMode) Validate() error {
+	switch m {
+	case "", ACMEAttestationOff, ACMEAttestationPermissive, ACMEAttestationEnforced:
+		return nil
+	default:
+		return fmt.Errorf("acme attestation mode %q is not supported", m)
+	}
+}
+
+// ACMEAttestationResult is the result of the verification of a device
+// attestation, "pass" or "fail".
+type ACMEAttestationResult string
+
+const (
+	// AttestationPass is the result of a verified device attestation.
+	AttestationPass ACMEAttestationResult = "pass"
+	// AttestationFail is the result of a device attestation that could not be
+	// verified.
+	AttestationFail ACMEAttestationResult = "fail"
+)
+
+type attestationResultKey struct{}
+
+type acmeProfileKey struct{}
+
+// NewContextWithACMEProfile creates a new context with the name of the
+// profile selected by the order being finalized.
+func NewContextWithACMEProfile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, acmeProfileKey{}, name)
+}
+
+// ACMEProfileFromContext returns the name of the profile stored in the given
+// context.
+func ACMEProfileFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(acmeProfileKey{}).(string)
+	return name, ok && name != ""
+}
+
+// NewContextWithAttestationResult creates a new context with the result of
+// the device attestation of the order being finalized.
+func NewContextWithAttestationResult(ctx context.Context, result ACMEAttestationResult) context.Context {
+	return context.WithValue(ctx, attestationResultKey{}, result)
+}
+
+// AttestationResultFromContext returns the result of the device attestation
+// stored in the given context.
+func AttestationResultFromContext(ctx context.Context) (ACMEAttestationResult, bool) {
+	result, ok := ctx.Value(attestationResultKey{}).(ACMEAttestationResult)
+	return result, ok && result != ""
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
@@ -102,7 +180,9 @@ type ACME struct {
 	RequireEAB bool `json:"requireEAB,omitempty"`
 	// Challenges contains the enabled challenges for this provisioner. If this
 	// value is not set the default http-01, dns-01 and tls-alpn-01 challenges
-	// will be enabled, device-attest-01 will be disabled.
+	// will be enabled, device-attest-01 will be disabled. Challenges that are
+	// not enabled are not offered in new authorizations, cannot be validated,
+	// and orders validated with them cannot be finalized.
 	Challenges []ACMEChallenge `json:"challenges,omitempty"`
 	// AttestationFormats contains the enabled attestation formats for this
 	// provisioner. If this value is not set the default apple, step and tpm
@@ -111,9 +191,47 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
-	Claims              *Claims  `json:"claims,omitempty"`
-	Options             *Options `json:"options,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// AttestationMode defines how the device-attest-01 challenge handles the
+	// device attestations, "off", "permissive" or "enforced". In permissive
+	// mode the challenge is valid even if the attestation cannot be verified,
+	// and the result of the verification is added to the certificate, so it
+	// can be used to migrate devices without attestation. The permanent
+	// identifier of an attestation that cannot be verified is not added to
+	// the certificate. Defaults to "enforced".
+	AttestationMode ACMEAttestationMode `json:"attestationMode,omitempty"`
+	// RetryAfter is the value of the Retry-After header sent on pending or
+	// processing orders and authorizations, so clients can back off while
+	// polling.
+	// Defaults to not sending the header.
+	RetryAfter *Duration `json:"retryAfter,omitempty"`
+	// Identifiers contains the policy evaluated on the identifiers of new
+	// orders. It can be used to reject orders for reserved or special-use
+	// domains, like .local or .internal, or for wildcard names that should
+	// not be issued by this provisioner.
+	Identifiers *ACMEIdentifierPolicy `json:"identifiers,omitempty"`
+	// Contacts contains the policy evaluated on the contacts of new and
+	// updated accounts. If set, all contacts must be valid mailto URLs.
+	Contacts *ACMEContactPolicy `json:"contacts,omitempty"`
+	// AttestationExtensions maps fields of a verified device attestation to
+	// custom extensions in the certificate. They are only added to
+	// certificates issued after a device-attest-01 challenge, so this option
+	// requires that challenge to be enabled.
+	AttestationExtensions []ACMEAttestationExtension `json:"attestationExtensions,omitempty"`
+	// HTTP01 contains the user-agent and other headers sent on the http-01
+	// validation requests. They can be used by web application firewalls to
+	// identify and allow the validator.
+	HTTP01 *ACMEHTTP01Options `json:"http01,omitempty"`
+	// IPIdentifiers contains the options used on orders with IP identifiers.
+	// IP identifiers are allowed by default if the http-01 or tls-alpn-01
+	// challenge is enabled, and those challenges use the default ports.
+	IPIdentifiers *ACMEIPIdentifierOptions `json:"ipIdentifiers,omitempty"`
+	// Profiles contains the certificate profiles that ACME clients can select
+	// in new-order requests. The names and descriptions of the profiles are
+	// advertised in the meta object of the ACME directory.
+	Profiles            []ACMEProfile `json:"profiles,omitempty"`
+	Claims              *Claims       `json:"claims,omitempty"`
+	Options             *Options      `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
 	ctl                 *Controller
 }
@@ -147,6 +265,16 @@ func (p *ACME) GetType() Type {
 	return TypeACME
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *ACME) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *ACME) GetController() *Controller {
+	return p.ctl
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *ACME) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -163,6 +291,62 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.ctl.Claimer.DefaultTLSCertDuration()
 }
 
+// GetRetryAfter returns the value of the Retry-After header sent on pending or
+// processing orders and authorizations, or 0 if it is not configured.
+func (p *ACME) GetRetryAfter() time.Duration {
+	if p.RetryAfter == nil {
+		return 0
+	}
+	return p.RetryAfter.Duration
+}
+
+// GetAttestationExtensions returns the extensions that are added from the
+// fields of a verified device attestation.
+func (p *ACME) GetAttestationExtensions() []ACMEAttestationExtension {
+	return p.AttestationExtensions
+}
+
+// GetAttestationMode returns the mode used to verify the device attestations.
+// It defaults to enforced.
+func (p *ACME) GetAttestationMode() ACMEAttestationMode {
+	if p.AttestationMode == "" {
+		return ACMEAttestationEnforced
+	}
+	return p.AttestationMode
+}
+
+// GetHTTP01Header returns the headers sent on the http-01 validation requests,
+// or nil if they are not configured.
+func (p *ACME) GetHTTP01Header() http.Header {
+	return p.HTTP01.Header()
+}
+
+// isIPChallengeEnabled returns true if one of the challenges that can
+// validate an IP identifier, http-01 or tls-alpn-01, is enabled.
+func (p *ACME) isIPChallengeEnabled(ctx context.Context) bool {
+	return p.IsChallengeEnabled(ctx, HTTP_01) || p.IsChallengeEnabled(ctx, TLS_ALPN_01)
+}
+
+// GetIPIdentifierOptions returns the options used on orders with IP
+// identifiers, or nil if they are not configured.
+func (p *ACME) GetIPIdentifierOptions() *ACMEIPIdentifierOptions {
+	return p.IPIdentifiers
+}
+
+// GetProfileOptions returns the options used to sign the certificates of the
+// given profile. It returns false if the profile is not configured.
+func (p *ACME) GetProfileOptions(name string) (*Options, bool) {
+	for _, profile := range p.Profiles {
+		if profile.Name == name {
+			if profile.Options == nil {
+				return p.Options, true
+			}
+			return profile.Options, true
+		}
+	}
+	return nil, false
+}
+
 // Init initializes and validates the fields of an ACME type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -170,6 +354,8 @@ func (p *ACME) Init(config Config) (err error) {
 		return errors.New("provisioner type cannot be empty")
 	case p.Name == "":
 		return errors.New("provisioner name cannot be empty")
+	case p.RetryAfter != nil && p.RetryAfter.Duration < 0:
+		return errors.New("provisioner retryAfter cannot be negative")
 	}
 
 	for _, c := range p.Challenges {
@@ -177,11 +363,56 @@ func (p *ACME) Init(config Config) (err error) {
 			return err
 		}
 	}
+	if err := p.Identifiers.Validate(); err != nil {
+		return err
+	}
+	if err := p.Contacts.Validate(); err != nil {
+		return err
+	}
+	if err := p.HTTP01.Validate(); err != nil {
+		return err
+	}
+	if err := p.IPIdentifiers.Validate(); err != nil {
+		return err
+	}
 	for _, f := range p.AttestationFormats {
 		if err := f.Validate(); err != nil {
 			return err
 		}
 	}
+	if p.IPIdentifiers.hasChallengeOptions() && !p.isIPChallengeEnabled(context.Background()) {
+		return errors.New("provisioner ipIdentifiers requires the http-01 or tls-alpn-01 challenge")
+	}
+	if len(p.AttestationExtensions) > 0 && !p.IsChallengeEnabled(context.Background(), DEVICE_ATTEST_01) {
+		return errors.New("provisioner attestationExtensions requires the device-attest-01 challenge")
+	}
+	if err := p.AttestationMode.Validate(); err != nil {
+		return err
+	}
+	// The off mode rejects the device-attest-01 challenge, so it can be used
+	// without it.
+	if p.AttestationMode != "" && p.AttestationMode != ACMEAttestationOff && !p.IsChallengeEnabled(context.Background(), DEVICE_ATTEST_01) {
+		return errors.Errorf("provisioner attestationMode %q requires the device-attest-01 challenge", p.AttestationMode)
+	}
+	for _, e := range p.AttestationExtensions {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool, len(p.Profiles))
+	for i := range p.Profiles {
+		profile := &p.Profiles[i]
+		if err := profile.Validate(); err != nil {
+			return err
+		}
+		if names[profile.Name] {
+			return errors.Errorf("provisioner profiles contains duplicated profile %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.extKeyUsages, err = parseExtKeyUsages(profile.ExtKeyUsages); err != nil {
+			return errors.Errorf("provisioner profile %q contains invalid extKeyUsages", profile.Name)
+		}
+	}
 
 	// Parse attestation roots.
 	// The pool will be nil if there are no roots.
@@ -206,8 +437,20 @@ func (p *ACME) Init(config Config) (err error) {
 		}
 	}
 
-	p.ctl, err = NewController(p, p.Claims, config, p.Options)
-	return
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return err
+	}
+
+	// The duration of the profiles must be allowed by the claims.
+	for _, profile := range p.Profiles {
+		if d := profile.getDuration(0); d != 0 {
+			minDur, maxDur := p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()
+			if d < minDur || d > maxDur {
+				return errors.Errorf("provisioner profile %q duration must be between %s and %s", profile.Name, minDur, maxDur)
+			}
+		}
+	}
+	return nil
 }
 
 // ACMEIdentifierType encodes ACME Identifier types
@@ -228,7 +471,14 @@ type ACMEIdentifier struct {
 
 // AuthorizeOrderIdentifier verifies the provisioner is allowed to issue a
 // certificate for an ACME Order Identifier.
-func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdentifier) error {
+func (p *ACME) AuthorizeOrderIdentifier(ctx context.Context, identifier ACMEIdentifier) error {
+	if identifier.Type == IP && (!p.IPIdentifiers.IsEnabled() || !p.isIPChallengeEnabled(ctx)) {
+		return fmt.Errorf("ip identifier %q is not allowed", identifier.Value)
+	}
+	if err := p.Identifiers.authorize(identifier); err != nil {
+		return err
+	}
+
 	x509Policy := p.ctl.getPolicy().getX509()
 
 	// identifier is allowed if no policy is configured
@@ -253,21 +503,69 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 // AuthorizeSign does not do any validation, because all validation is handled
 // in the ACME protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
-func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+func (p *ACME) AuthorizeSign(ctx context.Context, _ string) ([]SignOption, error) {
+	profile, err := p.profileFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []SignOption{
 		p,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeACME, p.Name, "").WithControllerOptions(p.ctl),
 		newForceCNOption(p.ForceCN),
-		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		profileDefaultDuration(profile.getDuration(p.ctl.Claimer.DefaultTLSCertDuration())),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
 	}
+	opts = append(opts, p.ctl.newX509SignOptions()...)
+	opts = append(opts, profile.newExtKeyUsageOptions()...)
+
+	attestationOpts, err := p.newAttestationResultOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, attestationOpts...), nil
+}
+
+// profileFromContext returns the profile selected by the order being
+// finalized, or nil if the order does not select one. It returns an error if
+// the profile is not configured, this can happen if the profile is removed
+// after the order is created.
+func (p *ACME) profileFromContext(ctx context.Context) (*ACMEProfile, error) {
+	name, ok := ACMEProfileFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	for i := range p.Profiles {
+		if p.Profiles[i].Name == name {
+			return &p.Profiles[i], nil
+		}
+	}
+	return nil, errs.BadRequest("acme.AuthorizeSign; profile %q is not supported by provisioner %q", name, p.Name)
+}
 
-	return opts, nil
+// newAttestationResultOptions returns the SignOption that adds the result of
+// the device attestation in the context to the certificate in permissive
+// mode. In enforced mode it returns an error if the attestation failed, this
+// can happen if the mode is changed after the challenge is validated.
+func (p *ACME) newAttestationResultOptions(ctx context.Context) ([]SignOption, error) {
+	result, ok := AttestationResultFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	switch p.GetAttestationMode() {
+	case ACMEAttestationPermissive:
+		return []SignOption{newAttestationResultModifier(result)}, nil
+	case ACMEAttestationEnforced:
+		if result != AttestationPass {
+			return nil, errs.Forbidden("acme.AuthorizeSign; device attestation for provisioner %q could not be verified", p.Name)
+		}
+	}
+	return nil, nil
 }
 
 // AuthorizeRevoke is called just before the certificate is to be revoked by
@@ -330,3 +628,373 @@ func (p *ACME) IsAttestationFormatEnabled(_ context.Context, format ACMEAttestat
 func (p *ACME) GetAttestationRoots() (*x509.CertPool, bool) {
 	return p.attestationRootPool, p.attestationRootPool != nil
 }
+
+// ACMEIdentifierPolicy is the policy evaluated on the DNS identifiers of new
+// ACME orders. Suffixes are matched on label boundaries, so "local" matches
+// "local" and "foo.local", but not "foolocal".
+type ACMEIdentifierPolicy struct {
+	// AllowedSuffixes, if set, restricts the DNS identifiers to the ones
+	// matching one of the given suffixes.
+	AllowedSuffixes []string `json:"allowedSuffixes,omitempty"`
+	// DeniedSuffixes rejects the DNS identifiers matching one of the given
+	// suffixes, e.g. local or internal.
+	DeniedSuffixes []string `json:"deniedSuffixes,omitempty"`
+	// DisableWildcards rejects all wildcard DNS identifiers.
+	DisableWildcards bool `json:"disableWildcards,omitempty"`
+}
+
+// Validate returns an error if the identifier policy is not valid.
+func (p *ACMEIdentifierPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, s := range p.AllowedSuffixes {
+		if normalizeSuffix(s) == "" {
+			return errors.New("provisioner identifiers.allowedSuffixes cannot contain empty values")
+		}
+	}
+	for _, s := range p.DeniedSuffixes {
+		if normalizeSuffix(s) == "" {
+			return errors.New("provisioner identifiers.deniedSuffixes cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// authorize returns an error if the given identifier is not allowed by the
+// policy. Besides the configured suffixes, wildcards are only allowed as the
+// leftmost label of a name with at least two other labels, so "*.com" or
+// "foo.*.example.com" are rejected.
+func (p *ACMEIdentifierPolicy) authorize(identifier ACMEIdentifier) error {
+	if p == nil || identifier.Type != DNS {
+		return nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(identifier.Value, "."))
+	if strings.HasPrefix(name, "*.") {
+		if p.DisableWildcards {
+			return fmt.Errorf("wildcard identifier %q is not allowed", identifier.Value)
+		}
+		name = strings.TrimPrefix(name, "*.")
+		if !strings.Contains(name, ".") {
+			return fmt.Errorf("wildcard identifier %q is not allowed on a top-level domain", identifier.Value)
+		}
+	}
+	if strings.Contains(name, "*") {
+		return fmt.Errorf("identifier %q has an invalid wildcard", identifier.Value)
+	}
+
+	for _, s := range p.DeniedSuffixes {
+		if hasDomainSuffix(name, s) {
+			return fmt.Errorf("identifier %q is not allowed", identifier.Value)
+		}
+	}
+	if len(p.AllowedSuffixes) > 0 {
+		for _, s := range p.AllowedSuffixes {
+			if hasDomainSuffix(name, s) {
+				return nil
+			}
+		}
+		return fmt.Errorf("identifier %q is not allowed", identifier.Value)
+	}
+
+	return nil
+}
+
+func normalizeSuffix(s string) string {
+	return strings.ToLower(strings.Trim(s, "."))
+}
+
+func hasDomainSuffix(name, suffix string) bool {
+	suffix = normalizeSuffix(suffix)
+	return name == suffix || strings.HasSuffix(name, "."+suffix)
+}
+
+// ACMEContactPolicy is the policy evaluated on the contacts of ACME accounts.
+type ACMEContactPolicy struct {
+	// Require makes the contact mandatory when an account is created.
+	Require bool `json:"require,omitempty"`
+	// AllowedDomains, if set, restricts the email addresses in the contacts
+	// to the given domains or their subdomains.
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+}
+
+// Validate returns an error if the contact policy is not valid.
+func (p *ACMEContactPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, d := range p.AllowedDomains {
+		if normalizeSuffix(d) == "" {
+			return errors.New("provisioner contacts.allowedDomains cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// IsDomainAllowed returns true if an email address in the given domain can be
+// used as an account contact.
+func (p *ACMEContactPolicy) IsDomainAllowed(domain string) bool {
+	if p == nil || len(p.AllowedDomains) == 0 {
+		return true
+	}
+	domain = strings.ToLower(domain)
+	for _, d := range p.AllowedDomains {
+		if hasDomainSuffix(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ACMEProfile is a certificate profile that ACME clients can select in a
+// new-order request. If the profile defines its own options, they are used
+// instead of the provisioner options to sign the certificate.
+//
+// Duration replaces the default duration of the certificates, and it must be
+// allowed by the claims of the provisioner. ExtKeyUsages sets exactly the
+// extended key usages of the certificates, e.g. "serverAuth" or "clientAuth",
+// replacing the ones added by the template.
+type ACMEProfile struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description,omitempty"`
+	Duration     *Duration `json:"duration,omitempty"`
+	ExtKeyUsages []string  `json:"extKeyUsages,omitempty"`
+	Options      *Options  `json:"options,omitempty"`
+	extKeyUsages []x509.ExtKeyUsage
+}
+
+// Validate returns an error if the profile is not valid.
+func (p ACMEProfile) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("provisioner profiles cannot contain a profile without name")
+	case p.Duration != nil && p.Duration.Duration <= 0:
+		return errors.Errorf("provisioner profile %q duration must be greater than 0", p.Name)
+	default:
+		return nil
+	}
+}
+
+// getDuration returns the default duration of the certificates of the
+// profile, or the given default if the profile does not set one.
+func (p *ACMEProfile) getDuration(def time.Duration) time.Duration {
+	if p == nil || p.Duration == nil {
+		return def
+	}
+	return p.Duration.Duration
+}
+
+// newExtKeyUsageOptions returns the SignOption that sets the extended key
+// usages of the profile. It returns no options if the profile does not set
+// them.
+func (p *ACMEProfile) newExtKeyUsageOptions() []SignOption {
+	if p == nil || len(p.extKeyUsages) == 0 {
+		return nil
+	}
+	return []SignOption{extKeyUsageModifier(p.extKeyUsages)}
+}
+
+// ACMEHTTP01Options contains the options used on the http-01 validation
+// requests.
+type ACMEHTTP01Options struct {
+	// UserAgent replaces the default User-Agent header.
+	UserAgent string `json:"userAgent,omitempty"`
+	// Headers contains additional headers, e.g. a header with a secret value
+	// that a firewall can match to allow the requests.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Validate returns an error if the http-01 options are not valid.
+func (o *ACMEHTTP01Options) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if !httpguts.ValidHeaderFieldValue(o.UserAgent) {
+		return errors.New("provisioner http01.userAgent is not a valid header value")
+	}
+	for k, v := range o.Headers {
+		switch {
+		case !httpguts.ValidHeaderFieldName(k):
+			return errors.Errorf("provisioner http01.headers contains an invalid header name %q", k)
+		case strings.EqualFold(k, "Host"), strings.EqualFold(k, "User-Agent"):
+			return errors.Errorf("provisioner http01.headers cannot contain the header %q", k)
+		case !httpguts.ValidHeaderFieldValue(v):
+			return errors.Errorf("provisioner http01.headers contains an invalid value for header %q", k)
+		}
+	}
+	return nil
+}
+
+// Header returns the headers to send on the http-01 validation requests, or
+// nil if there are none.
+func (o *ACMEHTTP01Options) Header() http.Header {
+	if o == nil || (o.UserAgent == "" && len(o.Headers) == 0) {
+		return nil
+	}
+	h := make(http.Header, len(o.Headers)+1)
+	for k, v := range o.Headers {
+		h.Set(k, v)
+	}
+	if o.UserAgent != "" {
+		h.Set("User-Agent", o.UserAgent)
+	}
+	return h
+}
+
+// ACMEHostHeaderForm is the form of the Host header sent on the http-01
+// validation requests of IP identifiers.
+type ACMEHostHeaderForm string
+
+const (
+	// HostHeaderIP sends the IP address without the port in the Host header.
+	HostHeaderIP ACMEHostHeaderForm = "ip"
+	// HostHeaderIPPort sends the IP address and the port, if it is not the
+	// default one, in the Host header. This is the default form.
+	HostHeaderIPPort ACMEHostHeaderForm = "ip-port"
+)
+
+// ACMEIPIdentifierOptions contains the options used on orders with IP
+// identifiers. They can be used by devices that do not have a DNS name and
+// cannot serve the challenges on the default ports.
+type ACMEIPIdentifierOptions struct {
+	// Disable rejects new orders with IP identifiers.
+	Disable bool `json:"disable,omitempty"`
+	// HTTP01Port is the port used on the http-01 validation requests. Defaults
+	// to 80.
+	HTTP01Port int `json:"http01Port,omitempty"`
+	// HTTP01HostHeader is the form of the Host header sent on the http-01
+	// validation requests, "ip" or "ip-port". Defaults to "ip-port".
+	HTTP01HostHeader ACMEHostHeaderForm `json:"http01HostHeader,omitempty"`
+	// TLSALPN01Port is the port used on the tls-alpn-01 validation requests.
+	// Defaults to 443.
+	TLSALPN01Port int `json:"tlsALPN01Port,omitempty"`
+}
+
+// Validate returns an error if the IP identifier options are not valid.
+func (o *ACMEIPIdentifierOptions) Validate() error {
+	switch {
+	case o == nil:
+		return nil
+	case o.Disable && (o.HTTP01Port != 0 || o.HTTP01HostHeader != "" || o.TLSALPN01Port != 0):
+		return errors.New("provisioner ipIdentifiers challenge options require IP identifiers to be enabled")
+	case o.HTTP01Port < 0 || o.HTTP01Port > 65535:
+		return errors.Errorf("provisioner ipIdentifiers.http01Port %d is not a valid port", o.HTTP01Port)
+	case o.TLSALPN01Port < 0 || o.TLSALPN01Port > 65535:
+		return errors.Errorf("provisioner ipIdentifiers.tlsALPN01Port %d is not a valid port", o.TLSALPN01Port)
+	}
+	switch o.HTTP01HostHeader {
+	case "", HostHeaderIP, HostHeaderIPPort:
+		return nil
+	default:
+		return errors.Errorf("provisioner ipIdentifiers.http01HostHeader %q is not supported", o.HTTP01HostHeader)
+	}
+}
+
+// IsEnabled returns true if orders with IP identifiers are allowed.
+func (o *ACMEIPIdentifierOptions) IsEnabled() bool {
+	return o == nil || !o.Disable
+}
+
+// hasChallengeOptions returns true if any of the http-01 or tls-alpn-01
+// options is set. Nil and empty options are the same.
+func (o *ACMEIPIdentifierOptions) hasChallengeOptions() bool {
+	return o != nil && (o.HTTP01Port != 0 || o.HTTP01HostHeader != "" || o.TLSALPN01Port != 0)
+}
+
+// ACMEAttestationField is the name of a field of a verified device attestation.
+type ACMEAttestationField string
+
+const (
+	// AttestationFormatField is the attestation format, apple, step or tpm.
+	AttestationFormatField ACMEAttestationField = "format"
+	// AttestationSerialNumberField is the serial number of the device.
+	AttestationSerialNumberField ACMEAttestationField = "serialNumber"
+	// AttestationUDIDField is the unique device identifier of Apple devices.
+	AttestationUDIDField ACMEAttestationField = "udid"
+	// AttestationSEPVersionField is the secure enclave processor OS version of
+	// Apple devices.
+	AttestationSEPVersionField ACMEAttestationField = "sepVersion"
+	// AttestationPermanentIdentifierField is the permanent identifier
+	// attested by a TPM.
+	AttestationPermanentIdentifierField ACMEAttestationField = "permanentIdentifier"
+	// AttestationResultField is the result of the verification of the device
+	// attestation, "pass" or "fail".
+	AttestationResultField ACMEAttestationField = "result"
+)
+
+// ACMEAttestationExtension maps a field of a verified device attestation to a
+// custom certificate extension. The value of the field is encoded as an ASN.1
+// UTF8String.
+type ACMEAttestationExtension struct {
+	Field    ACMEAttestationField      `json:"field"`
+	ID       x509util.ObjectIdentifier `json:"id"`
+	Critical bool                      `json:"critical,omitempty"`
+}
+
+// Validate returns an error if the attestation extension is not valid.
+func (e ACMEAttestationExtension) Validate() error {
+	switch e.Field {
+	case AttestationFormatField, AttestationSerialNumberField, AttestationUDIDField,
+		AttestationSEPVersionField, AttestationPermanentIdentifierField, AttestationResultField:
+	default:
+		return fmt.Errorf("acme attestation field %q is not supported", e.Field)
+	}
+	if len(e.ID) == 0 {
+		return fmt.Errorf("acme attestation extension for %q must have an id", e.Field)
+	}
+	return nil
+}
+
+// NewAttestationExtensionsModifier returns a CertificateModifier that adds the
+// given extensions with the values in the attestation fields. Fields that are
+// not present in the attestation are skipped.
+func NewAttestationExtensionsModifier(exts []ACMEAttestationExtension, fields map[string]string) CertificateModifierFunc {
+	return func(cert *x509.Certificate, _ SignOptions) error {
+		for _, e := range exts {
+			v, ok := fields[string(e.Field)]
+			if !ok || v == "" {
+				continue
+			}
+			value, err := asn1.MarshalWithParams(v, "utf8")
+			if err != nil {
+				return errors.Wrapf(err, "error marshaling attestation field %q", e.Field)
+			}
+			ext := pkix.Extension{
+				Id:       asn1.ObjectIdentifier(e.ID),
+				Critical: e.Critical,
+				Value:    value,
+			}
+			setExtraExtension(cert, ext)
+		}
+		return nil
+	}
+}
+
+// newAttestationResultModifier returns a CertificateModifierFunc that adds the
+// attestation result extension to the certificate.
+func newAttestationResultModifier(result ACMEAttestationResult) CertificateModifierFunc {
+	return func(cert *x509.Certificate, _ SignOptions) error {
+		ext, err := NewAttestationResultExtension(result)
+		if err != nil {
+			return err
+		}
+		setExtraExtension(cert, ext)
+		return nil
+	}
+}
+
+// setExtraExtension adds the given extension to the certificate, replacing the
+// extension with the same id if it is already set.
+func setExtraExtension(cert *x509.Certificate, ext pkix.Extension) {
+	var found bool
+	for i := range cert.ExtraExtensions {
+		if cert.ExtraExtensions[i].Id.Equal(ext.Id) {
+			cert.ExtraExtensions[i] = ext
+			found = true
+		}
+	}
+	if !found {
+		cert.ExtraExtensions = append(cert.ExtraExtensions, ext)
+	}
+}
@@ -5,9 +5,17 @@ package provisioner
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"go.step.sm/crypto/x509util"
 )
 
 func TestACME_GetAttestationRoots(t *testing.T) {
@@ -80,3 +88,495 @@ func TestACME_GetAttestationRoots(t *testing.T) {
 		})
 	}
 }
+
+func TestACMEIdentifierPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *ACMEIdentifierPolicy
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ACMEIdentifierPolicy{AllowedSuffixes: []string{"example.com"}, DeniedSuffixes: []string{".local", "internal"}}, false},
+		{"fail allowed", &ACMEIdentifierPolicy{AllowedSuffixes: []string{"example.com", "."}}, true},
+		{"fail denied", &ACMEIdentifierPolicy{DeniedSuffixes: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ACMEIdentifierPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeOrderIdentifier_identifiers(t *testing.T) {
+	dns := func(v string) ACMEIdentifier { return ACMEIdentifier{Type: DNS, Value: v} }
+	denied := &ACMEIdentifierPolicy{DeniedSuffixes: []string{".local", "internal"}}
+	allowed := &ACMEIdentifierPolicy{AllowedSuffixes: []string{"example.com"}}
+	noWildcards := &ACMEIdentifierPolicy{DisableWildcards: true}
+
+	tests := []struct {
+		name       string
+		policy     *ACMEIdentifierPolicy
+		identifier ACMEIdentifier
+		wantErr    bool
+	}{
+		{"ok no policy", nil, dns("*.local"), false},
+		{"ok denied", denied, dns("foo.example.com"), false},
+		{"ok denied wildcard", denied, dns("*.example.com"), false},
+		{"ok denied ip", denied, ACMEIdentifier{Type: IP, Value: "10.0.0.1"}, false},
+		{"ok denied label boundary", denied, dns("foolocal"), false},
+		{"ok allowed", allowed, dns("example.com"), false},
+		{"ok allowed subdomain", allowed, dns("*.foo.example.com"), false},
+		{"ok no wildcards", noWildcards, dns("foo.example.com"), false},
+		{"fail denied", denied, dns("printer.local"), true},
+		{"fail denied uppercase", denied, dns("Printer.LOCAL."), true},
+		{"fail denied apex", denied, dns("internal"), true},
+		{"fail denied wildcard", denied, dns("*.corp.internal"), true},
+		{"fail allowed", allowed, dns("example.org"), true},
+		{"fail allowed label boundary", allowed, dns("badexample.com"), true},
+		{"fail wildcard tld", denied, dns("*.com"), true},
+		{"fail wildcard not leftmost", denied, dns("foo.*.example.com"), true},
+		{"fail wildcard only", denied, dns("*"), true},
+		{"fail no wildcards", noWildcards, dns("*.example.com"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{
+				Type:        "ACME",
+				Name:        "acme",
+				Identifiers: tt.policy,
+			}
+			if err := p.Init(Config{
+				Claims:    globalProvisionerClaims,
+				Audiences: testAudiences,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.AuthorizeOrderIdentifier(context.Background(), tt.identifier); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.AuthorizeOrderIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACMEContactPolicy(t *testing.T) {
+	if err := (&ACMEContactPolicy{AllowedDomains: []string{"example.com", ""}}).Validate(); err == nil {
+		t.Error("ACMEContactPolicy.Validate() error = nil, wantErr true")
+	}
+
+	tests := []struct {
+		name   string
+		policy *ACMEContactPolicy
+		domain string
+		want   bool
+	}{
+		{"ok nil", nil, "example.org", true},
+		{"ok no domains", &ACMEContactPolicy{Require: true}, "example.org", true},
+		{"ok domain", &ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, "example.com", true},
+		{"ok subdomain", &ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, "Eng.Example.com", true},
+		{"fail", &ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, "example.org", false},
+		{"fail label boundary", &ACMEContactPolicy{AllowedDomains: []string{"example.com"}}, "badexample.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.policy.IsDomainAllowed(tt.domain); got != tt.want {
+				t.Errorf("ACMEContactPolicy.IsDomainAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_Init_attestationExtensions(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	ext := ACMEAttestationExtension{Field: AttestationSerialNumberField, ID: x509util.ObjectIdentifier{1, 2, 3, 4}}
+	tests := []struct {
+		name    string
+		p       *ACME
+		wantErr bool
+	}{
+		{"ok", &ACME{Type: "ACME", Name: "acme", Challenges: []ACMEChallenge{DEVICE_ATTEST_01}, AttestationExtensions: []ACMEAttestationExtension{ext}}, false},
+		{"fail challenge", &ACME{Type: "ACME", Name: "acme", AttestationExtensions: []ACMEAttestationExtension{ext}}, true},
+		{"fail field", &ACME{Type: "ACME", Name: "acme", Challenges: []ACMEChallenge{DEVICE_ATTEST_01}, AttestationExtensions: []ACMEAttestationExtension{
+			{Field: "model", ID: x509util.ObjectIdentifier{1, 2, 3, 4}},
+		}}, true},
+		{"fail id", &ACME{Type: "ACME", Name: "acme", Challenges: []ACMEChallenge{DEVICE_ATTEST_01}, AttestationExtensions: []ACMEAttestationExtension{
+			{Field: AttestationUDIDField},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_Init_http01(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name    string
+		http01  *ACMEHTTP01Options
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ACMEHTTP01Options{UserAgent: "my-validator/1.0", Headers: map[string]string{"X-Validator": "secret"}}, false},
+		{"fail user-agent", &ACMEHTTP01Options{UserAgent: "my-validator\r\n"}, true},
+		{"fail header name", &ACMEHTTP01Options{Headers: map[string]string{"X Validator": "secret"}}, true},
+		{"fail header value", &ACMEHTTP01Options{Headers: map[string]string{"X-Validator": "secret\n"}}, true},
+		{"fail host", &ACMEHTTP01Options{Headers: map[string]string{"host": "example.com"}}, true},
+		{"fail user-agent header", &ACMEHTTP01Options{Headers: map[string]string{"User-Agent": "my-validator/1.0"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", HTTP01: tt.http01}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_GetHTTP01Header(t *testing.T) {
+	tests := []struct {
+		name   string
+		http01 *ACMEHTTP01Options
+		want   http.Header
+	}{
+		{"nil", nil, nil},
+		{"empty", &ACMEHTTP01Options{}, nil},
+		{"ok", &ACMEHTTP01Options{UserAgent: "my-validator/1.0", Headers: map[string]string{"x-validator": "secret"}}, http.Header{
+			"User-Agent":  []string{"my-validator/1.0"},
+			"X-Validator": []string{"secret"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{HTTP01: tt.http01}
+			if got := p.GetHTTP01Header(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ACME.GetHTTP01Header() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_Init_ipIdentifiers(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name    string
+		opts    *ACMEIPIdentifierOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ACMEIPIdentifierOptions{HTTP01Port: 8080, HTTP01HostHeader: HostHeaderIP, TLSALPN01Port: 8443}, false},
+		{"ok ip-port", &ACMEIPIdentifierOptions{HTTP01HostHeader: HostHeaderIPPort}, false},
+		{"ok disable", &ACMEIPIdentifierOptions{Disable: true}, false},
+		{"fail disable with options", &ACMEIPIdentifierOptions{Disable: true, HTTP01Port: 8080}, true},
+		{"fail http01 port", &ACMEIPIdentifierOptions{HTTP01Port: 65536}, true},
+		{"fail tls-alpn-01 port", &ACMEIPIdentifierOptions{TLSALPN01Port: -1}, true},
+		{"fail host header", &ACMEIPIdentifierOptions{HTTP01HostHeader: "hostname"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", IPIdentifiers: tt.opts}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeOrderIdentifier_ipIdentifiers(t *testing.T) {
+	ip := ACMEIdentifier{Type: IP, Value: "10.0.0.1"}
+	dns := ACMEIdentifier{Type: DNS, Value: "example.com"}
+	tests := []struct {
+		name       string
+		opts       *ACMEIPIdentifierOptions
+		challenges []ACMEChallenge
+		identifier ACMEIdentifier
+		wantErr    bool
+	}{
+		{"ok nil", nil, nil, ip, false},
+		{"ok empty", &ACMEIPIdentifierOptions{}, nil, ip, false},
+		{"ok enabled", &ACMEIPIdentifierOptions{HTTP01Port: 8080}, nil, ip, false},
+		{"ok tls-alpn-01", nil, []ACMEChallenge{DNS_01, TLS_ALPN_01}, ip, false},
+		{"ok disabled dns", &ACMEIPIdentifierOptions{Disable: true}, nil, dns, false},
+		{"ok dns-01 dns", nil, []ACMEChallenge{DNS_01}, dns, false},
+		{"fail disabled", &ACMEIPIdentifierOptions{Disable: true}, nil, ip, true},
+		{"fail nil dns-01", nil, []ACMEChallenge{DNS_01}, ip, true},
+		{"fail empty dns-01", &ACMEIPIdentifierOptions{}, []ACMEChallenge{DNS_01}, ip, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", IPIdentifiers: tt.opts, Challenges: tt.challenges}
+			if err := p.Init(Config{
+				Claims:    globalProvisionerClaims,
+				Audiences: testAudiences,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.AuthorizeOrderIdentifier(context.Background(), tt.identifier); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.AuthorizeOrderIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_Init_profiles(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name     string
+		profiles []ACMEProfile
+		wantErr  bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", []ACMEProfile{{Name: "tlsserver", Description: "TLS server certificate"}, {Name: "tlsclient"}}, false},
+		{"ok duration and extKeyUsages", []ACMEProfile{
+			{Name: "tlsserver", Duration: &Duration{Duration: 24 * time.Hour}, ExtKeyUsages: []string{"serverAuth"}},
+			{Name: "tlsclient", Duration: &Duration{Duration: time.Hour}, ExtKeyUsages: []string{"clientAuth"}},
+		}, false},
+		{"fail empty name", []ACMEProfile{{Description: "TLS server certificate"}}, true},
+		{"fail duplicated", []ACMEProfile{{Name: "tlsserver"}, {Name: "tlsserver"}}, true},
+		{"fail zero duration", []ACMEProfile{{Name: "tlsserver", Duration: &Duration{}}}, true},
+		{"fail min duration", []ACMEProfile{{Name: "tlsserver", Duration: &Duration{Duration: time.Second}}}, true},
+		{"fail max duration", []ACMEProfile{{Name: "tlsserver", Duration: &Duration{Duration: 365 * 24 * time.Hour}}}, true},
+		{"fail extKeyUsages", []ACMEProfile{{Name: "tlsserver", ExtKeyUsages: []string{"fooAuth"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", Profiles: tt.profiles}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_GetProfileOptions(t *testing.T) {
+	options := &Options{X509: &X509Options{Template: `{"subject": {{ toJson .Subject }}}`}}
+	profileOptions := &Options{X509: &X509Options{Template: `{"subject": {{ toJson .Subject }}, "extKeyUsage": ["clientAuth"]}`}}
+	p := &ACME{
+		Options: options,
+		Profiles: []ACMEProfile{
+			{Name: "tlsserver"},
+			{Name: "tlsclient", Options: profileOptions},
+		},
+	}
+	tests := []struct {
+		name   string
+		want   *Options
+		wantOk bool
+	}{
+		{"tlsserver", options, true},
+		{"tlsclient", profileOptions, true},
+		{"unknown", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.GetProfileOptions(tt.name)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ACME.GetProfileOptions() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeSign_profile(t *testing.T) {
+	p := &ACME{
+		Type: "ACME", Name: "acme",
+		Profiles: []ACMEProfile{
+			{Name: "tlsserver"},
+			{Name: "tlsclient", Duration: &Duration{Duration: time.Hour}, ExtKeyUsages: []string{"clientAuth"}},
+		},
+	}
+	if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+		t.Fatal(err)
+	}
+	withProfile := func(name string) context.Context {
+		return NewContextWithACMEProfile(context.Background(), name)
+	}
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		wantDuration     time.Duration
+		wantExtKeyUsages []x509.ExtKeyUsage
+		wantErr          bool
+	}{
+		{"ok no profile", context.Background(), p.ctl.Claimer.DefaultTLSCertDuration(), nil, false},
+		{"ok default profile", withProfile("tlsserver"), p.ctl.Claimer.DefaultTLSCertDuration(), nil, false},
+		{"ok profile", withProfile("tlsclient"), time.Hour, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"fail unknown profile", withProfile("unknown"), 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSign(tt.ctx, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ACME.AuthorizeSign() error = nil, wantErr true")
+				}
+				assertStatusCode(t, http.StatusBadRequest, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("ACME.AuthorizeSign() error = %v", err)
+			}
+
+			cert := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+			var duration time.Duration
+			for _, o := range opts {
+				switch v := o.(type) {
+				case profileDefaultDuration:
+					duration = time.Duration(v)
+				case extKeyUsageModifier:
+					if err := v.Modify(cert, SignOptions{}); err != nil {
+						t.Fatalf("Modify() error = %v", err)
+					}
+				}
+			}
+			if duration != tt.wantDuration {
+				t.Errorf("ACME.AuthorizeSign() duration = %v, want %v", duration, tt.wantDuration)
+			}
+			if tt.wantExtKeyUsages != nil && !reflect.DeepEqual(cert.ExtKeyUsage, tt.wantExtKeyUsages) {
+				t.Errorf("ACME.AuthorizeSign() extKeyUsages = %v, want %v", cert.ExtKeyUsage, tt.wantExtKeyUsages)
+			}
+			if tt.wantExtKeyUsages == nil && !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+				t.Errorf("ACME.AuthorizeSign() extKeyUsages = %v, want unchanged", cert.ExtKeyUsage)
+			}
+		})
+	}
+}
+
+func TestNewAttestationExtensionsModifier(t *testing.T) {
+	exts := []ACMEAttestationExtension{
+		{Field: AttestationSerialNumberField, ID: x509util.ObjectIdentifier{1, 2, 3, 4}},
+		{Field: AttestationSEPVersionField, ID: x509util.ObjectIdentifier{1, 2, 3, 5}, Critical: true},
+		{Field: AttestationUDIDField, ID: x509util.ObjectIdentifier{1, 2, 3, 6}},
+	}
+	cert := &x509.Certificate{
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte("old")},
+		},
+	}
+	fields := map[string]string{
+		"serialNumber": "1234",
+		"sepVersion":   "17.0",
+	}
+	if err := NewAttestationExtensionsModifier(exts, fields).Modify(cert, SignOptions{}); err != nil {
+		t.Fatalf("Modify() error = %v", err)
+	}
+	want := []pkix.Extension{
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x0c, 0x04, '1', '2', '3', '4'}},
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 5}, Critical: true, Value: []byte{0x0c, 0x04, '1', '7', '.', '0'}},
+	}
+	if !reflect.DeepEqual(cert.ExtraExtensions, want) {
+		t.Errorf("Modify() ExtraExtensions = %v, want %v", cert.ExtraExtensions, want)
+	}
+}
+
+func TestACME_Init_attestationMode(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name       string
+		challenges []ACMEChallenge
+		mode       ACMEAttestationMode
+		want       ACMEAttestationMode
+		wantErr    bool
+	}{
+		{"ok default", nil, "", ACMEAttestationEnforced, false},
+		{"ok off", []ACMEChallenge{DEVICE_ATTEST_01}, ACMEAttestationOff, ACMEAttestationOff, false},
+		{"ok off without challenge", []ACMEChallenge{HTTP_01}, ACMEAttestationOff, ACMEAttestationOff, false},
+		{"ok permissive", []ACMEChallenge{DEVICE_ATTEST_01}, ACMEAttestationPermissive, ACMEAttestationPermissive, false},
+		{"ok enforced", []ACMEChallenge{DEVICE_ATTEST_01}, ACMEAttestationEnforced, ACMEAttestationEnforced, false},
+		{"fail mode", []ACMEChallenge{DEVICE_ATTEST_01}, "soft", "", true},
+		{"fail challenge", []ACMEChallenge{DNS_01}, ACMEAttestationPermissive, "", true},
+		{"fail enforced challenge", []ACMEChallenge{DNS_01}, ACMEAttestationEnforced, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", Challenges: tt.challenges, AttestationMode: tt.mode}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Fatalf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && p.GetAttestationMode() != tt.want {
+				t.Errorf("ACME.GetAttestationMode() = %v, want %v", p.GetAttestationMode(), tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeSign_attestationResult(t *testing.T) {
+	newACME := func(mode ACMEAttestationMode) *ACME {
+		p := &ACME{Type: "ACME", Name: "acme", Challenges: []ACMEChallenge{DEVICE_ATTEST_01}, AttestationMode: mode}
+		if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	withResult := func(result ACMEAttestationResult) context.Context {
+		return NewContextWithAttestationResult(context.Background(), result)
+	}
+
+	tests := []struct {
+		name    string
+		p       *ACME
+		ctx     context.Context
+		want    ACMEAttestationResult
+		wantErr bool
+	}{
+		{"ok no result", newACME(ACMEAttestationPermissive), context.Background(), "", false},
+		{"ok permissive pass", newACME(ACMEAttestationPermissive), withResult(AttestationPass), AttestationPass, false},
+		{"ok permissive fail", newACME(ACMEAttestationPermissive), withResult(AttestationFail), AttestationFail, false},
+		{"ok enforced pass", newACME(""), withResult(AttestationPass), "", false},
+		{"ok off fail", newACME(ACMEAttestationOff), withResult(AttestationFail), "", false},
+		{"fail enforced fail", newACME(ACMEAttestationEnforced), withResult(AttestationFail), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.p.AuthorizeSign(tt.ctx, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ACME.AuthorizeSign() error = nil, wantErr true")
+				}
+				assertStatusCode(t, http.StatusForbidden, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("ACME.AuthorizeSign() error = %v", err)
+			}
+
+			cert := &x509.Certificate{}
+			for _, o := range opts {
+				if m, ok := o.(CertificateModifierFunc); ok {
+					if err := m.Modify(cert, SignOptions{}); err != nil {
+						t.Fatalf("Modify() error = %v", err)
+					}
+				}
+			}
+			cert.Extensions = cert.ExtraExtensions
+			got, ok := GetAttestationResult(cert)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("GetAttestationResult() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
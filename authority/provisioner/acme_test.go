@@ -128,6 +128,12 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("acme challenge \"zar\" is not supported"),
 			}
 		},
+		"fail-ip-identifiers-challenges": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Challenges: []ACMEChallenge{DNS_01}, IPIdentifiers: &ACMEIPIdentifierOptions{HTTP01Port: 8080}},
+				err: errors.New("provisioner ipIdentifiers requires the http-01 or tls-alpn-01 challenge"),
+			}
+		},
 		"fail-bad-attestation-format": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "bar", AttestationFormats: []ACMEAttestationFormat{APPLE, "zar"}},
@@ -151,6 +157,21 @@ func TestACME_Init(t *testing.T) {
 				p: &ACME{Name: "foo", Type: "bar"},
 			}
 		},
+		"ok ip-identifiers-challenges": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", Challenges: []ACMEChallenge{DNS_01, TLS_ALPN_01}, IPIdentifiers: &ACMEIPIdentifierOptions{}},
+			}
+		},
+		"ok ip-identifiers-empty": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", Challenges: []ACMEChallenge{DNS_01}, IPIdentifiers: &ACMEIPIdentifierOptions{}},
+			}
+		},
+		"ok ip-identifiers-disabled": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", Challenges: []ACMEChallenge{DNS_01}, IPIdentifiers: &ACMEIPIdentifierOptions{Disable: true}},
+			}
+		},
 		"ok attestation": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{
@@ -290,6 +311,16 @@ func TestACME_AuthorizeSign(t *testing.T) {
 							assert.Equals(t, nil, v.policyEngine)
 						case *WebhookController:
 							assert.Len(t, 0, v.webhooks)
+						case X509SignerName:
+							assert.Equals(t, "", string(v))
+						case *uniqueSANOption:
+							assert.False(t, v.Enabled)
+						case *signatureAlgorithmOption:
+							assert.Len(t, 0, v.Allowed)
+						case DuplicateDNSNamesPolicy:
+							assert.Equals(t, "", string(v))
+						case X509SerialGenerator:
+							assert.Nil(t, v.SerialGenerator)
 						default:
 							assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 						}
@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/pemutil"
+)
+
+// X509AlternateChain is a SignOption with the alternate chain of the
+// certificates signed by a provisioner, e.g. a chain that terminates at an
+// older root that cross-signed the current one. The alternate chain is
+// returned instead of the default one if the sign request asks for it.
+type X509AlternateChain []*x509.Certificate
+
+// Select returns the given chain with the intermediates replaced by the
+// alternate chain. It returns false if the leaf of the chain is not signed by
+// the first certificate of the alternate chain.
+func (c X509AlternateChain) Select(chain []*x509.Certificate) ([]*x509.Certificate, bool) {
+	if len(c) == 0 || len(chain) == 0 {
+		return chain, false
+	}
+	leaf := chain[0]
+	if !bytes.Equal(leaf.RawIssuer, c[0].RawSubject) || leaf.CheckSignatureFrom(c[0]) != nil {
+		return chain, false
+	}
+	return append([]*x509.Certificate{leaf}, c...), true
+}
+
+// parseAlternateChain parses the PEM bundle with the alternate chain of a
+// provisioner and checks that every certificate in the chain is signed by the
+// next one. If the key of the signer is known, the first certificate must have
+// it, so the chain verifies the certificates signed by the provisioner. If the
+// roots are known, the chain must verify with one of them.
+func parseAlternateChain(b []byte, signerKey crypto.PublicKey, roots []*x509.Certificate) (X509AlternateChain, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	chain, err := pemutil.ParseCertificateBundle(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing x509.alternateChain")
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("x509.alternateChain does not contain any certificate")
+	}
+	for i, crt := range chain {
+		if !crt.IsCA {
+			return nil, errors.Errorf("x509.alternateChain certificate %q is not a CA", crt.Subject)
+		}
+		if i+1 < len(chain) {
+			if err := crt.CheckSignatureFrom(chain[i+1]); err != nil {
+				return nil, errors.Wrapf(err, "x509.alternateChain certificate %q is not signed by %q", crt.Subject, chain[i+1].Subject)
+			}
+		}
+	}
+	if k, ok := signerKey.(interface{ Equal(crypto.PublicKey) bool }); ok && !k.Equal(chain[0].PublicKey) {
+		return nil, errors.Errorf("x509.alternateChain certificate %q does not have the key of the signer", chain[0].Subject)
+	}
+	if len(roots) > 0 {
+		opts := x509.VerifyOptions{
+			Roots:         x509.NewCertPool(),
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		for _, crt := range roots {
+			opts.Roots.AddCert(crt)
+		}
+		for _, crt := range chain[1:] {
+			opts.Intermediates.AddCert(crt)
+		}
+		if _, err := chain[0].Verify(opts); err != nil {
+			return nil, errors.Wrap(err, "x509.alternateChain does not verify with the roots of the authority")
+		}
+	}
+	return chain, nil
+}
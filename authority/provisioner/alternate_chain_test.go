@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/minica"
+)
+
+func encodeCertificates(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	return b
+}
+
+// crossSign returns a copy of the given CA certificate signed by other.
+func crossSign(t *testing.T, crt *x509.Certificate, other *minica.CA) *x509.Certificate {
+	t.Helper()
+	cross, err := other.Sign(&x509.Certificate{
+		Subject:               crt.Subject,
+		PublicKey:             crt.PublicKey,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	assert.FatalError(t, err)
+	return cross
+}
+
+func Test_parseAlternateChain(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	old, err := minica.New()
+	assert.FatalError(t, err)
+	cross := crossSign(t, ca.Intermediate, old)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		PublicKey: key.Public(),
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signerKey crypto.PublicKey
+		roots     []*x509.Certificate
+		want      X509AlternateChain
+		wantErr   bool
+	}{
+		{"ok empty", nil, nil, nil, nil, false},
+		{"ok", encodeCertificates(cross, old.Intermediate), nil, nil, X509AlternateChain{cross, old.Intermediate}, false},
+		{"ok with root", encodeCertificates(cross, old.Intermediate, old.Root), nil, nil, X509AlternateChain{cross, old.Intermediate, old.Root}, false},
+		{"ok verified", encodeCertificates(cross, old.Intermediate), ca.Intermediate.PublicKey, []*x509.Certificate{ca.Root, old.Root}, X509AlternateChain{cross, old.Intermediate}, false},
+		{"ok verified with root", encodeCertificates(cross, old.Intermediate, old.Root), ca.Intermediate.PublicKey, []*x509.Certificate{old.Root}, X509AlternateChain{cross, old.Intermediate, old.Root}, false},
+		{"fail pem", []byte("not a chain"), nil, nil, nil, true},
+		{"fail no certificates", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("foo")}), nil, nil, nil, true},
+		{"fail not ca", encodeCertificates(leaf, ca.Intermediate), nil, nil, nil, true},
+		{"fail not signed", encodeCertificates(cross, ca.Intermediate), nil, nil, nil, true},
+		{"fail signer key", encodeCertificates(cross, old.Intermediate), old.Intermediate.PublicKey, nil, nil, true},
+		{"fail roots", encodeCertificates(cross, old.Intermediate), ca.Intermediate.PublicKey, []*x509.Certificate{ca.Root}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAlternateChain(tt.data, tt.signerKey, tt.roots)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAlternateChain() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestX509AlternateChain_Select(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	old, err := minica.New()
+	assert.FatalError(t, err)
+	other, err := minica.New()
+	assert.FatalError(t, err)
+	cross := crossSign(t, ca.Intermediate, old)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		PublicKey: key.Public(),
+	})
+	assert.FatalError(t, err)
+	chain := []*x509.Certificate{leaf, ca.Intermediate}
+
+	tests := []struct {
+		name   string
+		c      X509AlternateChain
+		chain  []*x509.Certificate
+		want   []*x509.Certificate
+		wantOK bool
+	}{
+		{"ok", X509AlternateChain{cross, old.Intermediate}, chain, []*x509.Certificate{leaf, cross, old.Intermediate}, true},
+		{"fail empty", nil, chain, chain, false},
+		{"fail empty chain", X509AlternateChain{cross}, nil, nil, false},
+		{"fail other issuer", X509AlternateChain{other.Intermediate}, chain, chain, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.c.Select(tt.chain)
+			assert.Equals(t, tt.wantOK, ok)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package provisioner
+
+import (
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// AuthorizeReason is the reason why a provisioner did not authorize a token.
+type AuthorizeReason int
+
+const (
+	// ReasonUnknown is the reason used when the failure is not classified.
+	ReasonUnknown AuthorizeReason = iota
+	// ReasonMalformedToken is used when the token cannot be parsed.
+	ReasonMalformedToken
+	// ReasonInvalidSignature is used when the signature or the certificate
+	// chain of the token cannot be verified.
+	ReasonInvalidSignature
+	// ReasonUnknownKey is used when the key that signed the token is not known
+	// by the provisioner. Keys are refreshed periodically, so this reason can
+	// be transient.
+	ReasonUnknownKey
+	// ReasonTokenExpired is used when the token has expired.
+	ReasonTokenExpired
+	// ReasonTokenNotYetValid is used when the token is not valid yet or it
+	// has been issued in the future.
+	ReasonTokenNotYetValid
+	// ReasonInvalidIssuer is used when the issuer claim is not valid.
+	ReasonInvalidIssuer
+	// ReasonInvalidAudience is used when the audience claim is not valid.
+	ReasonInvalidAudience
+	// ReasonInvalidSubject is used when the subject of the token, or the
+	// service account that created it, is empty or not allowed.
+	ReasonInvalidSubject
+	// ReasonInvalidClaims is used when any other claim of the token is not
+	// valid or not allowed.
+	ReasonInvalidClaims
+	// ReasonTokenReused is used when a one-time token has already been used.
+	ReasonTokenReused
+	// ReasonRateLimited is used when the rate limit of the provisioner has
+	// been exceeded.
+	ReasonRateLimited
+	// ReasonAddressNotAllowed is used when the request comes from a network
+	// address that is not allowed by the provisioner.
+	ReasonAddressNotAllowed
+	// ReasonInsecureConnection is used when the connection of the request
+	// does not use the minimum TLS version required by the provisioner.
+	ReasonInsecureConnection
+)
+
+var reasonNames = [...]string{
+	ReasonUnknown:            "unknown",
+	ReasonMalformedToken:     "malformedToken",
+	ReasonInvalidSignature:   "invalidSignature",
+	ReasonUnknownKey:         "unknownKey",
+	ReasonTokenExpired:       "tokenExpired",
+	ReasonTokenNotYetValid:   "tokenNotYetValid",
+	ReasonInvalidIssuer:      "invalidIssuer",
+	ReasonInvalidAudience:    "invalidAudience",
+	ReasonInvalidSubject:     "invalidSubject",
+	ReasonInvalidClaims:      "invalidClaims",
+	ReasonTokenReused:        "tokenReused",
+	ReasonRateLimited:        "rateLimited",
+	ReasonAddressNotAllowed:  "addressNotAllowed",
+	ReasonInsecureConnection: "insecureConnection",
+}
+
+// String returns the name of the reason.
+func (r AuthorizeReason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return reasonNames[ReasonUnknown]
+	}
+	return reasonNames[r]
+}
+
+// AuthorizeError is the error returned when a token is not authorized. It can
+// be extracted using errors.As from the errors returned by the Authorize
+// methods to know the reason of the failure. The error message is the one of
+// the wrapped error.
+type AuthorizeError struct {
+	Reason AuthorizeReason
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *AuthorizeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *AuthorizeError) Unwrap() error {
+	return e.Err
+}
+
+// authorizeErr adds the reason to the given error. If the error is an
+// *errs.Error, the reason is added to the underlying error, so the status code
+// and the messages of the error do not change.
+func authorizeErr(reason AuthorizeReason, err error) error {
+	var ee *errs.Error
+	if errors.As(err, &ee) {
+		ee.Err = &AuthorizeError{Reason: reason, Err: ee.Err}
+		return err
+	}
+	return &AuthorizeError{Reason: reason, Err: err}
+}
+
+// validationReason returns the reason for an error validating the registered
+// claims of a token.
+func validationReason(err error) AuthorizeReason {
+	switch {
+	case errors.Is(err, jose.ErrExpired):
+		return ReasonTokenExpired
+	case errors.Is(err, jose.ErrNotValidYet), errors.Is(err, jose.ErrIssuedInTheFuture):
+		return ReasonTokenNotYetValid
+	case errors.Is(err, jose.ErrInvalidIssuer):
+		return ReasonInvalidIssuer
+	case errors.Is(err, jose.ErrInvalidAudience):
+		return ReasonInvalidAudience
+	case errors.Is(err, jose.ErrInvalidSubject):
+		return ReasonInvalidSubject
+	default:
+		return ReasonInvalidClaims
+	}
+}
@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthorizeReason_String(t *testing.T) {
+	assert.Equals(t, "unknown", ReasonUnknown.String())
+	assert.Equals(t, "tokenExpired", ReasonTokenExpired.String())
+	assert.Equals(t, "tokenReused", ReasonTokenReused.String())
+	assert.Equals(t, "rateLimited", ReasonRateLimited.String())
+	assert.Equals(t, "unknown", AuthorizeReason(100).String())
+}
+
+func Test_authorizeErr(t *testing.T) {
+	err := authorizeErr(ReasonInvalidAudience, errs.Unauthorized("jwk.authorizeToken; invalid audience"))
+	assert.Equals(t, "jwk.authorizeToken; invalid audience", err.Error())
+
+	// The reason and the status code are kept by the authority wrappers.
+	wrapped := errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize")
+	wrapped = errs.UnauthorizedErr(wrapped)
+	var ae *AuthorizeError
+	assert.Fatal(t, errors.As(wrapped, &ae))
+	assert.Equals(t, ReasonInvalidAudience, ae.Reason)
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(wrapped, &sc))
+	assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+
+	err = authorizeErr(ReasonMalformedToken, errors.New("an error"))
+	assert.Equals(t, "an error", err.Error())
+	assert.Fatal(t, errors.As(err, &ae))
+	assert.Equals(t, ReasonMalformedToken, ae.Reason)
+}
+
+func Test_validationReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want AuthorizeReason
+	}{
+		{"expired", jose.ErrExpired, ReasonTokenExpired},
+		{"not valid yet", jose.ErrNotValidYet, ReasonTokenNotYetValid},
+		{"issued in the future", jose.ErrIssuedInTheFuture, ReasonTokenNotYetValid},
+		{"issuer", jose.ErrInvalidIssuer, ReasonInvalidIssuer},
+		{"audience", jose.ErrInvalidAudience, ReasonInvalidAudience},
+		{"subject", jose.ErrInvalidSubject, ReasonInvalidSubject},
+		{"other", jose.ErrInvalidID, ReasonInvalidClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, validationReason(tt.err))
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_reason(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	key1, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+
+	expired, err := generateToken("subject", p1.Name, testAudiences.Sign[0], "name@smallstep.com",
+		[]string{"test.smallstep.com"}, time.Now().Add(-24*time.Hour), key1)
+	assert.FatalError(t, err)
+	failAud, err := generateSimpleToken(p1.Name, "foobar", key1)
+	assert.FatalError(t, err)
+	failIss, err := generateSimpleToken("foobar", testAudiences.Sign[0], key1)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+		want  AuthorizeReason
+	}{
+		{"expired", expired, ReasonTokenExpired},
+		{"audience", failAud, ReasonInvalidAudience},
+		{"issuer", failIss, ReasonInvalidIssuer},
+		{"malformed", "foo", ReasonMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p1.AuthorizeSign(context.Background(), tt.token)
+			var ae *AuthorizeError
+			assert.Fatal(t, errors.As(err, &ae), "error is not an AuthorizeError")
+			assert.Equals(t, tt.want, ae.Reason)
+		})
+	}
+}
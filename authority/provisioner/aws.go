@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,9 +42,17 @@ const awsSignatureURL = "http://169.254.169.254/latest/dynamic/instance-identity
 // awsAPITokenURL is the url used to get the IMDSv2 API token
 const awsAPITokenURL = "http://169.254.169.254/latest/api/token" //nolint:gosec // no credentials here
 
-// awsAPITokenTTL is the default TTL to use when requesting IMDSv2 API tokens
-// -- we keep this short-lived since we get a new token with every call to readURL()
-const awsAPITokenTTL = "30"
+// awsAPITokenTTL is the default TTL to use when requesting IMDSv2 API tokens,
+// 21600 seconds (6 hours) is the maximum TTL accepted by AWS.
+const awsAPITokenTTL = "21600"
+
+// awsMaxAPITokenTTL is the maximum TTL of an IMDSv2 API token.
+const awsMaxAPITokenTTL = 6 * time.Hour
+
+// awsTokenLifetime is the lifetime of the tokens generated by GetIdentityToken.
+// The tokens are signed by the client, so it's also the maximum lifetime used
+// to bind the validity of the certificates to the token expiration.
+const awsTokenLifetime = 5 * time.Minute
 
 // awsMetadataTokenHeader is the header that must be passed with every IMDSv2 request
 const awsMetadataTokenHeader = "X-aws-ec2-metadata-token" //nolint:gosec // no credentials here
@@ -68,6 +77,10 @@ type awsConfig struct {
 	tokenTTL           string
 	certificates       []*x509.Certificate
 	signatureAlgorithm x509.SignatureAlgorithm
+	isSTSHost          func(host string) bool
+	stsClient          *http.Client
+	ec2URL             string
+	ec2Client          *http.Client
 }
 
 func newAWSConfig(certPath string) (*awsConfig, error) {
@@ -110,6 +123,7 @@ func newAWSConfig(certPath string) (*awsConfig, error) {
 		tokenTTL:           awsAPITokenTTL,
 		certificates:       certs,
 		signatureAlgorithm: awsSignatureAlgorithm,
+		isSTSHost:          awsSTSHostRegexp.MatchString,
 	}, nil
 }
 
@@ -121,10 +135,18 @@ type awsPayload struct {
 }
 
 type awsAmazonPayload struct {
-	Document  []byte `json:"document"`
-	Signature []byte `json:"signature"`
+	Document   []byte         `json:"document"`
+	Signature  []byte         `json:"signature"`
+	STSRequest *awsSTSRequest `json:"stsRequest,omitempty"`
 }
 
+// awsSPIFFEFields are the fields that can be used in the SPIFFE path template.
+var awsSPIFFEFields = []string{"AccountID", "Region", "AvailabilityZone", "InstanceID"}
+
+// awsSSHHostFields are the fields that can be used in the SSH host principals
+// templates.
+var awsSSHHostFields = []string{"AccountID", "Region", "AvailabilityZone", "InstanceID", "PrivateIP"}
+
 type awsInstanceIdentityDocument struct {
 	AccountID          string    `json:"accountId"`
 	Architecture       string    `json:"architecture"`
@@ -148,6 +170,15 @@ type awsInstanceIdentityDocument struct {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// If DisableCustomSANs is false, CustomSANsMode defines how the SANs in the CSR
+// are combined with the internal ones: "csr", the default, uses only the SANs
+// in the CSR, "merge" adds the internal SANs to the ones in the CSR, and
+// "token" uses only the internal SANs.
+//
+// If OverwriteCommonName and DisableCustomSANs are true, the common name in the
+// CSR is ignored and the certificate common name is set to the instance id.
+// By default a CSR with a different common name is rejected.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
@@ -155,25 +186,70 @@ type awsInstanceIdentityDocument struct {
 // If InstanceAge is set, only the instances with a pendingTime within the given
 // period will be accepted.
 //
+// If ReplayProtection is true, a token can only be used once during its
+// validity period, even if DisableTrustOnFirstUse is true.
+//
+// If AllowedRoles is set, the token must also contain in "amazon.stsRequest" a
+// pre-signed STS GetCallerIdentity POST request, with its "method", "url",
+// "headers" and "body". The CA sends the request to STS and only accepts the
+// instance if it uses one of the given IAM roles, e.g.
+// "arn:aws:iam::123456789012:role/name", and the role session is the instance
+// in the identity document. By default the role is not checked.
+//
+// IMDSTokenTTL can be used to specify the TTL of the IMDSv2 API tokens, it
+// must be a whole number of seconds between 1s and 6h, and it defaults to 6h.
+//
 // IIDRoots can be used to specify a path to the certificates used to verify the
 // identity certificate signature.
 //
+// If SPIFFE is set, a SPIFFE ID is added as a URI SAN. The path template can
+// use the fields AccountID, Region, AvailabilityZone and InstanceID.
+//
+// If BindToTokenExpiry is set, the certificates cannot be valid after the
+// expiration of the token plus the given offset. AWS tokens are signed by the
+// client, so the expiration is capped to 5 minutes after the request.
+//
+// If StrictIdentity is true, a CSR with a common name or SANs other than the
+// instance id, the private IP, or the internal DNS name is rejected, even if
+// DisableCustomSANs is false. By default it is disabled.
+//
+// If SSHHostPrincipals is set, the principals of the SSH host certificates are
+// generated from templates that can use the fields AccountID, Region,
+// AvailabilityZone, InstanceID and PrivateIP, and the principals requested
+// that are not generated are dropped.
+//
+// If InstanceTags is set, the SANs are also derived from the tags of the
+// instance, fetched with the DescribeInstances API. See AWSInstanceTagsOptions
+// for more details.
+//
 // Amazon Identity docs are available at
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 type AWS struct {
 	*base
-	ID                     string   `json:"-"`
-	Type                   string   `json:"type"`
-	Name                   string   `json:"name"`
-	Accounts               []string `json:"accounts"`
-	DisableCustomSANs      bool     `json:"disableCustomSANs"`
-	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
-	IMDSVersions           []string `json:"imdsVersions"`
-	InstanceAge            Duration `json:"instanceAge,omitempty"`
-	IIDRoots               string   `json:"iidRoots,omitempty"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	Options                *Options `json:"options,omitempty"`
+	ID                     string                    `json:"-"`
+	Type                   string                    `json:"type"`
+	Name                   string                    `json:"name"`
+	Accounts               []string                  `json:"accounts"`
+	DisableCustomSANs      bool                      `json:"disableCustomSANs"`
+	OverwriteCommonName    bool                      `json:"overwriteCommonName,omitempty"`
+	CustomSANsMode         CustomSANsMode            `json:"customSANsMode,omitempty"`
+	DisableTrustOnFirstUse bool                      `json:"disableTrustOnFirstUse"`
+	IMDSVersions           []string                  `json:"imdsVersions"`
+	IMDSTokenTTL           Duration                  `json:"imdsTokenTTL,omitempty"`
+	InstanceAge            Duration                  `json:"instanceAge,omitempty"`
+	IIDRoots               string                    `json:"iidRoots,omitempty"`
+	ReplayProtection       bool                      `json:"replayProtection,omitempty"`
+	AllowedRoles           []string                  `json:"allowedRoles,omitempty"`
+	SPIFFE                 *SPIFFEOptions            `json:"spiffe,omitempty"`
+	BindToTokenExpiry      *TokenExpiryOptions       `json:"bindToTokenExpiry,omitempty"`
+	StrictIdentity         bool                      `json:"strictIdentity,omitempty"`
+	MetadataRetry          *MetadataRetryOptions     `json:"metadataRetry,omitempty"`
+	InstanceTags           *AWSInstanceTagsOptions   `json:"instanceTags,omitempty"`
+	SSHHostPrincipals      *SSHHostPrincipalsOptions `json:"sshHostPrincipals,omitempty"`
+	Claims                 *Claims                   `json:"claims,omitempty"`
+	Options                *Options                  `json:"options,omitempty"`
 	config                 *awsConfig
+	roles                  []awsRoleARN
 	ctl                    *Controller
 }
 
@@ -210,6 +286,15 @@ func (p *AWS) GetTokenID(token string) (string, error) {
 	return strings.ToLower(hex.EncodeToString(sum[:])), nil
 }
 
+// useToken rejects the reuse of a token if replay protection is enabled.
+func (p *AWS) useToken(ctx context.Context, payload *awsPayload, token string) error {
+	if !p.ReplayProtection {
+		return nil
+	}
+	key := tokenReplayKey(p.GetIDForToken(), payload.document.InstanceID, payload.ID, token)
+	return p.ctl.useToken(ctx, key, tokenReplayExpiration(payload.Expiry))
+}
+
 // GetName returns the name of the provisioner.
 func (p *AWS) GetName() string {
 	return p.Name
@@ -220,6 +305,25 @@ func (p *AWS) GetType() Type {
 	return TypeAWS
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *AWS) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *AWS) GetController() *Controller {
+	return p.ctl
+}
+
+// GetCapabilities returns the certificates the provisioner can issue. AWS
+// instances can only request SSH host certificates.
+func (p *AWS) GetCapabilities() *Capabilities {
+	caps := newCapabilities(p.ctl.GetClaimer(), false, true)
+	caps.AllowCustomSANs = !p.DisableCustomSANs
+	caps.TrustOnFirstUse = !p.DisableTrustOnFirstUse
+	return caps
+}
+
 // GetEncryptedKey is not available in an AWS provisioner.
 func (p *AWS) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -228,20 +332,27 @@ func (p *AWS) GetEncryptedKey() (kid, key string, ok bool) {
 // GetIdentityToken retrieves the identity document and it's signature and
 // generates a token with them.
 func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
+	return p.GetIdentityTokenWithContext(context.Background(), subject, caURL)
+}
+
+// GetIdentityTokenWithContext retrieves the identity document and it's
+// signature with the given context and generates a token with them. The
+// requests to the metadata service are retried if MetadataRetry is configured.
+func (p *AWS) GetIdentityTokenWithContext(ctx context.Context, subject, caURL string) (string, error) {
 	// Initialize the config if this method is used from the cli.
 	if err := p.assertConfig(); err != nil {
 		return "", err
 	}
 
 	var idoc awsInstanceIdentityDocument
-	doc, err := p.readURL(p.config.identityURL)
+	doc, err := p.readURL(ctx, p.config.identityURL)
 	if err != nil {
 		return "", errors.Wrap(err, "error retrieving identity document:\n  Are you in an AWS VM?\n  Is the metadata service enabled?\n  Are you using the proper metadata service version?")
 	}
 	if err := json.Unmarshal(doc, &idoc); err != nil {
 		return "", errors.Wrap(err, "error unmarshaling identity document")
 	}
-	sig, err := p.readURL(p.config.signatureURL)
+	sig, err := p.readURL(ctx, p.config.signatureURL)
 	if err != nil {
 		return "", errors.Wrap(err, "error retrieving identity document:\n  Are you in an AWS VM?\n  Is the metadata service enabled?\n  Are you using the proper metadata service version?")
 	}
@@ -279,7 +390,7 @@ func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
 			Issuer:    awsIssuer,
 			Subject:   subject,
 			Audience:  []string{audience},
-			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Expiry:    jose.NewNumericDate(now.Add(awsTokenLifetime)),
 			NotBefore: jose.NewNumericDate(now),
 			IssuedAt:  jose.NewNumericDate(now),
 			ID:        strings.ToLower(hex.EncodeToString(sum[:])),
@@ -300,36 +411,59 @@ func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
 
 // Init validates and initializes the AWS provisioner.
 func (p *AWS) Init(config Config) (err error) {
-	switch {
-	case p.Type == "":
-		return errors.New("provisioner type cannot be empty")
-	case p.Name == "":
-		return errors.New("provisioner name cannot be empty")
-	case p.InstanceAge.Value() < 0:
-		return errors.New("provisioner instanceAge cannot be negative")
-	}
+	var v configValidator
+	v.check(p.Type == "", "type", "provisioner type cannot be empty")
+	v.check(p.Name == "", "name", "provisioner name cannot be empty")
+	v.check(p.InstanceAge.Value() < 0, "instanceAge", "provisioner instanceAge cannot be negative")
+	v.add("customSANsMode", p.CustomSANsMode.Validate())
+	v.add("spiffe", p.SPIFFE.init(awsSPIFFEFields))
+	v.add("sshHostPrincipals", p.SSHHostPrincipals.init(awsSSHHostFields))
+	v.add("bindToTokenExpiry", p.BindToTokenExpiry.init())
+	v.add("metadataRetry", p.MetadataRetry.init())
+	v.add("instanceTags", p.InstanceTags.init())
+	v.check(p.OverwriteCommonName && !p.DisableCustomSANs, "overwriteCommonName", "provisioner overwriteCommonName requires disableCustomSANs")
 
 	// Add default config
 	if p.config, err = newAWSConfig(p.IIDRoots); err != nil {
-		return err
+		v.add("iidRoots", err)
 	}
 
 	// validate IMDS versions
 	if len(p.IMDSVersions) == 0 {
 		p.IMDSVersions = []string{"v2", "v1"}
 	}
-	for _, v := range p.IMDSVersions {
-		switch v {
+	for _, s := range p.IMDSVersions {
+		switch s {
 		case "v1":
 			// valid
 		case "v2":
 			// valid
 		default:
-			return errors.Errorf("%s: not a supported AWS Instance Metadata Service version", v)
+			v.add("imdsVersions", errors.Errorf("%s: not a supported AWS Instance Metadata Service version", s))
+		}
+	}
+	if d := p.IMDSTokenTTL.Value(); d != 0 && (d < time.Second || d > awsMaxAPITokenTTL || d%time.Second != 0) {
+		v.add("imdsTokenTTL", errors.Errorf("provisioner imdsTokenTTL must be a whole number of seconds between 1s and %s", awsMaxAPITokenTTL))
+	}
+
+	// Parse the allowed roles
+	p.roles = nil
+	for _, s := range p.AllowedRoles {
+		role, err := parseAWSRoleARN(s)
+		if err != nil {
+			v.add("allowedRoles", errors.Wrap(err, "provisioner allowedRoles is not valid"))
+			continue
 		}
+		p.roles = append(p.roles, role)
+	}
+	if err := v.err(); err != nil {
+		return err
 	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ReplayProtection && config.TokenCache == nil {
+		config.TokenCache = NewMemoryTokenCache(DefaultTokenCacheSize)
+	}
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -341,6 +475,18 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
 	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, payload.Claims.Subject, payload.document.InstanceID); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+	if err := p.useToken(ctx, payload, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+	if err := p.authorizeRole(ctx, payload); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
 
 	doc := payload.document
 
@@ -351,12 +497,27 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		data.SetToken(v)
 	}
 
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "aws.AuthorizeSign")
+	}
+
+	// Restrict the subject alternative names to the ones in the manifest.
+	manifestOpts, err := p.ctl.newSANManifestOptions(doc.InstanceID)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "aws.AuthorizeSign")
+	}
+	so = append(so, manifestOpts...)
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
 	// Enforce known CN and default DNS and IP if configured.
 	// By default we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
-	var so []SignOption
+	var cnOption SignOption = commonNameValidator(payload.Claims.Subject)
+	dnsName := fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region)
 	if p.DisableCustomSANs {
-		dnsName := fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region)
 		so = append(so,
 			dnsNamesValidator([]string{dnsName}),
 			ipAddressesValidator([]net.IP{
@@ -368,7 +529,46 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 		// Template options
 		data.SetSANs([]string{dnsName, doc.PrivateIP})
+
+		if p.OverwriteCommonName {
+			cnOption = commonNameModifier(payload.Claims.Subject)
+		}
+	} else {
+		so = append(so, customSANsOptions(p.CustomSANsMode, data, []string{dnsName, doc.PrivateIP})...)
+	}
+	if p.StrictIdentity {
+		so = append(so, newStrictIdentityValidator(
+			[]string{doc.InstanceID},
+			[]string{dnsName, doc.PrivateIP},
+		))
+	}
+
+	// Add the SPIFFE ID if configured.
+	spiffeOptions, err := p.SPIFFE.newOptions(map[string]string{
+		"AccountID":        doc.AccountID,
+		"Region":           doc.Region,
+		"AvailabilityZone": doc.AvailabilityZone,
+		"InstanceID":       doc.InstanceID,
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "aws.AuthorizeSign")
+	}
+	so = append(so, spiffeOptions...)
+
+	// Add the SANs derived from the instance tags if configured.
+	tagsOptions, err := p.newInstanceTagsOptions(ctx, doc)
+	if err != nil {
+		return nil, err
 	}
+	so = append(so, tagsOptions...)
+
+	// Bind the validity to the token expiration if configured. The "exp" claim
+	// is chosen by the client, so it's capped to the default token lifetime.
+	expiryOptions, err := p.BindToTokenExpiry.newCappedOptions(payload.Claims, time.Now().Add(awsTokenLifetime))
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.AuthorizeSign")
+	}
+	so = append(so, expiryOptions...)
 
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
@@ -383,8 +583,8 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		commonNameValidator(payload.Claims.Subject),
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		cnOption,
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -424,7 +624,7 @@ func (p *AWS) checkSignature(signed, signature []byte) error {
 // readURL does a GET request to the given url and returns the body. It's not
 // using pkg/errors to avoid verbose errors, the caller should use it and write
 // the appropriate error.
-func (p *AWS) readURL(url string) ([]byte, error) {
+func (p *AWS) readURL(ctx context.Context, url string) ([]byte, error) {
 	var resp *http.Response
 	var err error
 
@@ -436,15 +636,20 @@ func (p *AWS) readURL(url string) ([]byte, error) {
 	for _, v := range p.IMDSVersions {
 		switch v {
 		case "v1":
-			resp, err = p.readURLv1(url)
+			resp, err = p.readURLv1(ctx, url)
 			if err == nil && resp.StatusCode < 400 {
 				return p.readResponseBody(resp)
 			}
 		case "v2":
-			resp, err = p.readURLv2(url)
+			resp, err = p.readURLv2(ctx, url)
 			if err == nil && resp.StatusCode < 400 {
 				return p.readResponseBody(resp)
 			}
+			// Only fall back to the next version if IMDSv2 is not available.
+			var terr *awsTokenError
+			if errors.As(err, &terr) && terr.StatusCode != http.StatusNotFound {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("%s: not a supported AWS Instance Metadata Service version", v)
 		}
@@ -462,21 +667,21 @@ func (p *AWS) readURL(url string) ([]byte, error) {
 		resp.StatusCode)
 }
 
-func (p *AWS) readURLv1(url string) (*http.Response, error) {
+func (p *AWS) readURLv1(ctx context.Context, url string) (*http.Response, error) {
 	client := http.Client{}
 
 	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	resp, err := p.MetadataRetry.do(ctx, &client, req)
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
-func (p *AWS) readURLv2(url string) (*http.Response, error) {
+func (p *AWS) readURLv2(ctx context.Context, url string) (*http.Response, error) {
 	client := http.Client{}
 
 	// first get the token
@@ -484,14 +689,14 @@ func (p *AWS) readURLv2(url string) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set(awsMetadataTokenTTLHeader, p.config.tokenTTL)
-	resp, err := client.Do(req)
+	req.Header.Set(awsMetadataTokenTTLHeader, p.getTokenTTL())
+	resp, err := p.MetadataRetry.do(ctx, &client, req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("request for API token returned non-successful status code %d", resp.StatusCode)
+		return nil, &awsTokenError{StatusCode: resp.StatusCode}
 	}
 	token, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -504,13 +709,31 @@ func (p *AWS) readURLv2(url string) (*http.Response, error) {
 		return nil, err
 	}
 	req.Header.Set(awsMetadataTokenHeader, string(token))
-	resp, err = client.Do(req)
+	resp, err = p.MetadataRetry.do(ctx, &client, req)
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
+// getTokenTTL returns the TTL in seconds of the IMDSv2 API tokens.
+func (p *AWS) getTokenTTL() string {
+	if d := p.IMDSTokenTTL.Value(); d > 0 {
+		return strconv.FormatInt(int64(d/time.Second), 10)
+	}
+	return p.config.tokenTTL
+}
+
+// awsTokenError is the error returned when the request for an IMDSv2 API
+// token returns a non-successful status code.
+type awsTokenError struct {
+	StatusCode int
+}
+
+func (e *awsTokenError) Error() string {
+	return fmt.Sprintf("request for API token returned non-successful status code %d", e.StatusCode)
+}
+
 func (p *AWS) readResponseBody(resp *http.Response) ([]byte, error) {
 	defer resp.Body.Close()
 	b, err := io.ReadAll(resp.Body)
@@ -526,7 +749,7 @@ func (p *AWS) readResponseBody(resp *http.Response) ([]byte, error) {
 func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; error parsing aws token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; error parsing aws token"))
 	}
 	if len(jwt.Headers) == 0 {
 		return nil, errs.InternalServer("aws.authorizeToken; error parsing token, header is missing")
@@ -534,33 +757,33 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 
 	var unsafeClaims awsPayload
 	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling claims")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling claims"))
 	}
 
 	var payload awsPayload
 	if err := jwt.Claims(unsafeClaims.Amazon.Signature, &payload); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying claims")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying claims"))
 	}
 
 	// Validate identity document signature
 	if err := p.checkSignature(payload.Amazon.Document, payload.Amazon.Signature); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token signature")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token signature"))
 	}
 
 	var doc awsInstanceIdentityDocument
 	if err := json.Unmarshal(payload.Amazon.Document, &doc); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling aws identity document")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling aws identity document"))
 	}
 
 	switch {
 	case doc.AccountID == "":
-		return nil, errs.Unauthorized("aws.authorizeToken; aws identity document accountId cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; aws identity document accountId cannot be empty"))
 	case doc.InstanceID == "":
-		return nil, errs.Unauthorized("aws.authorizeToken; aws identity document instanceId cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; aws identity document instanceId cannot be empty"))
 	case doc.PrivateIP == "":
-		return nil, errs.Unauthorized("aws.authorizeToken; aws identity document privateIp cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; aws identity document privateIp cannot be empty"))
 	case doc.Region == "":
-		return nil, errs.Unauthorized("aws.authorizeToken; aws identity document region cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; aws identity document region cannot be empty"))
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
@@ -570,12 +793,12 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 		Issuer: awsIssuer,
 		Time:   now,
 	}, time.Minute); err != nil {
-		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token")
+		return nil, authorizeErr(validationReason(err), errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token"))
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
-		return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid audience claim (aud)")
+		return nil, authorizeErr(ReasonInvalidAudience, errs.Unauthorized("aws.authorizeToken; invalid token - invalid audience claim (aud)"))
 	}
 
 	// Validate subject, it has to be known if disableCustomSANs is enabled
@@ -583,7 +806,7 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 		if payload.Subject != doc.InstanceID &&
 			payload.Subject != doc.PrivateIP &&
 			payload.Subject != fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region) {
-			return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid subject claim (sub)")
+			return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("aws.authorizeToken; invalid token - invalid subject claim (sub)"))
 		}
 	}
 
@@ -597,14 +820,14 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("aws.authorizeToken; invalid aws identity document - accountId is not valid")
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; invalid aws identity document - accountId is not valid"))
 		}
 	}
 
 	// validate instance age
 	if d := p.InstanceAge.Value(); d > 0 {
 		if now.Sub(doc.PendingTime) > d {
-			return nil, errs.Unauthorized("aws.authorizeToken; aws identity document pendingTime is too old")
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeToken; aws identity document pendingTime is too old"))
 		}
 	}
 
@@ -613,7 +836,7 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; ssh ca is disabled for aws provisioner '%s'", p.GetName())
 	}
@@ -621,6 +844,12 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
+	}
+	if err := p.authorizeRole(ctx, claims); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
+	}
 
 	doc := claims.document
 	signOptions := []SignOption{}
@@ -631,15 +860,29 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 
 	// Validated principals.
-	principals := []string{
+	principals, principalsOptions, err := p.SSHHostPrincipals.newOptions(map[string]string{
+		"AccountID":        doc.AccountID,
+		"Region":           doc.Region,
+		"AvailabilityZone": doc.AvailabilityZone,
+		"InstanceID":       doc.InstanceID,
+		"PrivateIP":        doc.PrivateIP,
+	}, []string{
 		doc.PrivateIP,
 		fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region),
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "aws.AuthorizeSSHSign")
 	}
 
-	// Only enforce known principals if disable custom sans is true.
-	if p.DisableCustomSANs {
+	// Only enforce known principals if disable custom sans is true. The
+	// requested principals are restricted to the generated ones if
+	// SSHHostPrincipals is set.
+	switch {
+	case principalsOptions != nil:
+		signOptions = append(signOptions, principalsOptions...)
+	case p.DisableCustomSANs:
 		defaults.Principals = principals
-	} else {
+	default:
 		// Check that at least one principal is sent in the request.
 		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
 			Principals: true,
@@ -658,6 +901,9 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Validate user SignSSHOptions.
@@ -671,7 +917,7 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil, p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -0,0 +1,190 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// awsSTSHostRegexp matches the hosts of the global, regional and FIPS STS
+// endpoints where the pre-signed GetCallerIdentity requests can be sent.
+var awsSTSHostRegexp = regexp.MustCompile(`^sts(-fips)?(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+// awsSTSTimeout is the timeout used to send the GetCallerIdentity request.
+const awsSTSTimeout = 10 * time.Second
+
+// awsSTSMaxResponseSize is the maximum size of the GetCallerIdentity response.
+const awsSTSMaxResponseSize = 64 * 1024
+
+// awsSTSRequest is a pre-signed STS GetCallerIdentity request. The CA sends the
+// request to STS to get the ARN of the IAM role used by the instance.
+type awsSTSRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers"`
+	Body    []byte              `json:"body"`
+}
+
+type awsGetCallerIdentityResponse struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResponse"`
+	Result  struct {
+		Arn     string `xml:"Arn"`
+		UserID  string `xml:"UserId"`
+		Account string `xml:"Account"`
+	} `xml:"GetCallerIdentityResult"`
+}
+
+// awsRoleARN is the partition, account and name of an IAM role.
+type awsRoleARN struct {
+	partition string
+	account   string
+	name      string
+}
+
+// parseAWSRoleARN parses an IAM role ARN, e.g.
+// "arn:aws:iam::123456789012:role/path/name". The path of the role is ignored.
+func parseAWSRoleARN(s string) (awsRoleARN, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[2] != "iam" || parts[4] == "" {
+		return awsRoleARN{}, errors.Errorf("%q is not a valid IAM role ARN", s)
+	}
+	resource := strings.Split(parts[5], "/")
+	if len(resource) < 2 || resource[0] != "role" || resource[len(resource)-1] == "" {
+		return awsRoleARN{}, errors.Errorf("%q is not a valid IAM role ARN", s)
+	}
+	return awsRoleARN{
+		partition: parts[1],
+		account:   parts[4],
+		name:      resource[len(resource)-1],
+	}, nil
+}
+
+// parseAWSAssumedRoleARN parses the ARN of an assumed role session, e.g.
+// "arn:aws:sts::123456789012:assumed-role/name/i-0123456789abcdef0", and
+// returns the role and the session name.
+func parseAWSAssumedRoleARN(s string) (awsRoleARN, string, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[2] != "sts" || parts[4] == "" {
+		return awsRoleARN{}, "", errors.Errorf("%q is not an assumed role ARN", s)
+	}
+	resource := strings.Split(parts[5], "/")
+	if len(resource) != 3 || resource[0] != "assumed-role" || resource[1] == "" || resource[2] == "" {
+		return awsRoleARN{}, "", errors.Errorf("%q is not an assumed role ARN", s)
+	}
+	return awsRoleARN{
+		partition: parts[1],
+		account:   parts[4],
+		name:      resource[1],
+	}, resource[2], nil
+}
+
+// authorizeRole validates the pre-signed STS request in the token and checks
+// that the instance uses one of the allowed roles. The session of the role must
+// be the instance in the identity document. It does nothing if the provisioner
+// does not restrict the roles.
+func (p *AWS) authorizeRole(ctx context.Context, payload *awsPayload) error {
+	if len(p.roles) == 0 {
+		return nil
+	}
+	if payload.Amazon.STSRequest == nil {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeRole; aws token does not contain an sts request"))
+	}
+
+	arn, err := p.getCallerIdentity(ctx, payload.Amazon.STSRequest)
+	if err != nil {
+		return authorizeErr(ReasonInvalidClaims, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeRole; error validating sts request"))
+	}
+	role, session, err := parseAWSAssumedRoleARN(arn)
+	if err != nil {
+		return authorizeErr(ReasonInvalidClaims, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeRole; invalid sts caller identity"))
+	}
+
+	doc := payload.document
+	switch {
+	case role.account != doc.AccountID:
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeRole; sts caller identity account does not match the aws identity document"))
+	case session != doc.InstanceID:
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeRole; sts caller identity session does not match the aws identity document"))
+	}
+	for _, r := range p.roles {
+		if r == role {
+			return nil
+		}
+	}
+	return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("aws.authorizeRole; role %q is not allowed", role.name))
+}
+
+// getCallerIdentity sends the pre-signed GetCallerIdentity request to STS and
+// returns the ARN of the caller. Only POST requests to STS endpoints are sent.
+func (p *AWS) getCallerIdentity(ctx context.Context, r *awsSTSRequest) (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing sts request url")
+	}
+	isSTSHost := p.config.isSTSHost
+	if isSTSHost == nil {
+		isSTSHost = awsSTSHostRegexp.MatchString
+	}
+	if u.Scheme != "https" || !isSTSHost(u.Hostname()) || u.User != nil {
+		return "", errors.Errorf("sts request url %q is not an sts endpoint", r.URL)
+	}
+	if r.Method != http.MethodPost {
+		return "", errors.Errorf("sts request method %q is not supported", r.Method)
+	}
+	values, err := url.ParseQuery(string(r.Body))
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing sts request body")
+	}
+	if values.Get("Action") != "GetCallerIdentity" {
+		return "", errors.New("sts request is not a GetCallerIdentity request")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, awsSTSTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(r.Body))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating sts request")
+	}
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, "Host") {
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	client := p.config.stsClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error sending sts request")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, awsSTSMaxResponseSize))
+	if err != nil {
+		return "", errors.Wrap(err, "error reading sts response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("sts request returned non-successful status code %d", resp.StatusCode)
+	}
+
+	var identity awsGetCallerIdentityResponse
+	if err := xml.Unmarshal(b, &identity); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling sts response")
+	}
+	if identity.Result.Arn == "" {
+		return "", errors.New("sts response does not contain the caller arn")
+	}
+	return identity.Result.Arn, nil
+}
@@ -0,0 +1,302 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultAWSInstanceTagsCacheDuration is the default time the tags of an
+// instance are cached.
+const DefaultAWSInstanceTagsCacheDuration = time.Minute
+
+// awsEC2Timeout is the timeout used to send the DescribeInstances request and
+// to retrieve the credentials.
+const awsEC2Timeout = 10 * time.Second
+
+// awsEC2MaxResponseSize is the maximum size of the DescribeInstances response.
+const awsEC2MaxResponseSize = 1024 * 1024
+
+// awsEC2APIVersion is the version of the EC2 query API.
+const awsEC2APIVersion = "2016-11-15"
+
+// AWSInstanceTagsOptions adds SANs derived from the tags of the EC2 instances
+// to the certificates. After validating the identity document, the provisioner
+// calls DescribeInstances in the region of the instance, and each one of the
+// SANs templates is executed with the AccountID, Region, AvailabilityZone,
+// InstanceID and Tags of the instance. A missing tag is an empty string, and
+// the templates that result in an empty string are skipped, so SANs can be
+// added conditionally, e.g. "{{ with .Tags.service }}{{ . }}.internal{{ end }}".
+//
+// The credentials are loaded from the default chain of the AWS SDK, using the
+// given Profile if set, and they must allow ec2:DescribeInstances on the
+// instances. The tags are cached for CacheDuration, one minute by default. If
+// the API is not available the request is rejected, or, if FailOpen is true,
+// the certificate is signed without the SANs of the tags.
+type AWSInstanceTagsOptions struct {
+	SANs          []string `json:"sans"`
+	Profile       string   `json:"profile,omitempty"`
+	CacheDuration Duration `json:"cacheDuration,omitempty"`
+	FailOpen      bool     `json:"failOpen,omitempty"`
+	templates     []*template.Template
+	credentials   aws.CredentialsProvider
+	cache         *awsInstanceTagsCache
+}
+
+// awsInstanceTagsData is the data of the SANs templates.
+type awsInstanceTagsData struct {
+	AccountID        string
+	Region           string
+	AvailabilityZone string
+	InstanceID       string
+	Tags             map[string]string
+}
+
+// init validates the options, parses the templates, and loads and retrieves
+// the credentials.
+func (o *AWSInstanceTagsOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case len(o.SANs) == 0:
+		return errors.New("instanceTags sans cannot be empty")
+	case o.CacheDuration.Value() < 0:
+		return errors.New("instanceTags cacheDuration cannot be negative")
+	}
+
+	o.templates = make([]*template.Template, len(o.SANs))
+	for i, s := range o.SANs {
+		if strings.TrimSpace(s) == "" {
+			return errors.New("instanceTags sans cannot contain empty values")
+		}
+		tmpl, err := template.New("san").Option("missingkey=zero").Parse(s)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing instanceTags san %q", s)
+		}
+		// Execute the template to reject unknown fields.
+		if err := tmpl.Execute(io.Discard, awsInstanceTagsData{}); err != nil {
+			return errors.Wrapf(err, "error validating instanceTags san %q", s)
+		}
+		o.templates[i] = tmpl
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if o.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(o.Profile))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), awsEC2Timeout)
+	defer cancel()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return errors.Wrap(err, "error loading instanceTags aws configuration")
+	}
+	if cfg.Credentials == nil {
+		return errors.New("error loading instanceTags aws credentials: credentials not found")
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return errors.Wrap(err, "error retrieving instanceTags aws credentials")
+	}
+	o.credentials = cfg.Credentials
+
+	ttl := o.CacheDuration.Value()
+	if ttl == 0 {
+		ttl = DefaultAWSInstanceTagsCacheDuration
+	}
+	o.cache = &awsInstanceTagsCache{
+		ttl:     ttl,
+		entries: make(map[string]awsInstanceTagsCacheEntry),
+	}
+	return nil
+}
+
+// newInstanceTagsOptions returns the SignOption that adds the SANs derived from the tags
+// of the instance in the given identity document.
+func (p *AWS) newInstanceTagsOptions(ctx context.Context, doc awsInstanceIdentityDocument) ([]SignOption, error) {
+	o := p.InstanceTags
+	if o == nil {
+		return nil, nil
+	}
+
+	tags, ok := o.cache.load(doc.InstanceID)
+	if !ok {
+		// Do not call the AWS API in a dry run.
+		if DryRunFromContext(ctx) {
+			return nil, nil
+		}
+		var err error
+		if tags, err = p.describeInstanceTags(ctx, doc); err != nil {
+			if o.FailOpen {
+				log.Printf("error describing aws instance %s, signing without the instance tags: %v", doc.InstanceID, err)
+				return nil, nil
+			}
+			return nil, errs.Wrap(http.StatusServiceUnavailable, err, "aws.AuthorizeSign; error describing instance tags")
+		}
+		o.cache.store(doc.InstanceID, tags)
+	}
+
+	data := awsInstanceTagsData{
+		AccountID:        doc.AccountID,
+		Region:           doc.Region,
+		AvailabilityZone: doc.AvailabilityZone,
+		InstanceID:       doc.InstanceID,
+		Tags:             tags,
+	}
+	var sans ResolvedSANs
+	for _, tmpl := range o.templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign; error executing instance tags template")
+		}
+		s := strings.TrimSpace(buf.String())
+		if s == "" {
+			continue
+		}
+		dnsNames, ips, emails, uris := x509util.SplitSANs([]string{s})
+		if len(emails) > 0 {
+			return nil, errs.Forbidden("aws.AuthorizeSign; instance tags san %q is not a valid DNS name, IP address or URI", s)
+		}
+		sans.DNSNames = append(sans.DNSNames, dnsNames...)
+		sans.IPAddresses = append(sans.IPAddresses, ips...)
+		sans.URIs = append(sans.URIs, uris...)
+	}
+	return []SignOption{resolvedSANsModifier(sans)}, nil
+}
+
+type awsDescribeInstancesResponse struct {
+	XMLName   xml.Name `xml:"DescribeInstancesResponse"`
+	Instances []struct {
+		InstanceID string `xml:"instanceId"`
+		Tags       []struct {
+			Key   string `xml:"key"`
+			Value string `xml:"value"`
+		} `xml:"tagSet>item"`
+	} `xml:"reservationSet>item>instancesSet>item"`
+}
+
+// describeInstanceTags calls DescribeInstances in the region of the instance
+// and returns its tags.
+func (p *AWS) describeInstanceTags(ctx context.Context, doc awsInstanceIdentityDocument) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, awsEC2Timeout)
+	defer cancel()
+
+	creds, err := p.InstanceTags.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving aws credentials")
+	}
+
+	body := url.Values{
+		"Action":       []string{"DescribeInstances"},
+		"Version":      []string{awsEC2APIVersion},
+		"InstanceId.1": []string{doc.InstanceID},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.ec2Endpoint(doc.Region), strings.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating DescribeInstances request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sum := sha256.Sum256([]byte(body))
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "ec2", doc.Region, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "error signing DescribeInstances request")
+	}
+
+	client := p.config.ec2Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending DescribeInstances request")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, awsEC2MaxResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading DescribeInstances response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("DescribeInstances request returned non-successful status code %d", resp.StatusCode)
+	}
+
+	var r awsDescribeInstancesResponse
+	if err := xml.Unmarshal(b, &r); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling DescribeInstances response")
+	}
+	for _, instance := range r.Instances {
+		if instance.InstanceID == doc.InstanceID {
+			tags := make(map[string]string, len(instance.Tags))
+			for _, t := range instance.Tags {
+				tags[t.Key] = t.Value
+			}
+			return tags, nil
+		}
+	}
+	return nil, errors.Errorf("DescribeInstances response does not contain the instance %s", doc.InstanceID)
+}
+
+// ec2Endpoint returns the EC2 API endpoint of the given region.
+func (c *awsConfig) ec2Endpoint(region string) string {
+	if c.ec2URL != "" {
+		return c.ec2URL
+	}
+	if strings.HasPrefix(region, "cn-") {
+		return "https://ec2." + region + ".amazonaws.com.cn/"
+	}
+	return "https://ec2." + region + ".amazonaws.com/"
+}
+
+// awsInstanceTagsCache caches the tags of the instances for a short time.
+type awsInstanceTagsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]awsInstanceTagsCacheEntry
+}
+
+type awsInstanceTagsCacheEntry struct {
+	tags      map[string]string
+	expiresAt time.Time
+}
+
+func (c *awsInstanceTagsCache) load(instanceID string) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[instanceID]
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, false
+	}
+	return e.tags, true
+}
+
+// store adds the tags of an instance to the cache and removes the expired
+// entries.
+func (c *awsInstanceTagsCache) store(instanceID string, tags map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[instanceID] = awsInstanceTagsCacheEntry{
+		tags:      tags,
+		expiresAt: now.Add(c.ttl),
+	}
+}
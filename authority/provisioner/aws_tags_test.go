@@ -0,0 +1,205 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// setAWSTestCredentials configures the environment of the AWS SDK with a
+// shared config file with the "test" profile and, if static is true, the
+// default credentials in the environment.
+func setAWSTestCredentials(t *testing.T, static bool) {
+	t.Helper()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	assert.FatalError(t, os.WriteFile(configFile, []byte(`[profile test]
+region = us-west-1
+aws_access_key_id = AKIAPROFILE
+aws_secret_access_key = profile-secret
+`), 0600))
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_PROFILE", "")
+	if static {
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	} else {
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	}
+}
+
+func TestAWSInstanceTagsOptions_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *AWSInstanceTagsOptions
+		static  bool
+		wantErr bool
+	}{
+		{"ok nil", nil, false, false},
+		{"ok", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}}, true, false},
+		{"ok fields", &AWSInstanceTagsOptions{SANs: []string{"{{ .InstanceID }}.{{ .Region }}.{{ .AvailabilityZone }}.{{ .AccountID }}"}}, true, false},
+		{"ok profile", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}, Profile: "test"}, false, false},
+		{"ok cacheDuration", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}, CacheDuration: Duration{Duration: time.Hour}}, true, false},
+		{"fail sans", &AWSInstanceTagsOptions{}, true, true},
+		{"fail empty san", &AWSInstanceTagsOptions{SANs: []string{" "}}, true, true},
+		{"fail template", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service "}}, true, true},
+		{"fail field", &AWSInstanceTagsOptions{SANs: []string{"{{ .Hostname }}"}}, true, true},
+		{"fail cacheDuration", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}, CacheDuration: Duration{Duration: -time.Minute}}, true, true},
+		{"fail profile", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}, Profile: "missing"}, true, true},
+		{"fail credentials", &AWSInstanceTagsOptions{SANs: []string{"{{ .Tags.service }}.internal"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAWSTestCredentials(t, tt.static)
+			if err := tt.options.init(); (err != nil) != tt.wantErr {
+				t.Errorf("AWSInstanceTagsOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAWSConfig_ec2Endpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *awsConfig
+		region string
+		want   string
+	}{
+		{"ok", &awsConfig{}, "us-west-1", "https://ec2.us-west-1.amazonaws.com/"},
+		{"ok china", &awsConfig{}, "cn-north-1", "https://ec2.cn-north-1.amazonaws.com.cn/"},
+		{"ok url", &awsConfig{ec2URL: "https://127.0.0.1:8443/"}, "us-west-1", "https://127.0.0.1:8443/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.config.ec2Endpoint(tt.region))
+		})
+	}
+}
+
+func TestAWS_AuthorizeSign_instanceTags(t *testing.T) {
+	setAWSTestCredentials(t, true)
+
+	block, _ := pem.Decode([]byte(awsTestKey))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatal("error decoding AWS key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	assert.FatalError(t, err)
+
+	var requests int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-west-1/ec2/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "DescribeInstances" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var tags string
+		switch id := r.PostForm.Get("InstanceId.1"); id {
+		case "i-billing":
+			tags = `<item><key>service</key><value>billing</value></item><item><key>team</key><value>payments</value></item>`
+		case "i-untagged":
+		case "i-unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		default:
+			fmt.Fprint(w, `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><reservationSet/></DescribeInstancesResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>%s</instanceId>
+          <tagSet>%s</tagSet>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`, r.PostForm.Get("InstanceId.1"), tags)
+	}))
+	defer srv.Close()
+
+	newProvisioner := func(t *testing.T, failOpen bool) *AWS {
+		p, err := generateAWS()
+		assert.FatalError(t, err)
+		p.InstanceTags = &AWSInstanceTagsOptions{
+			SANs:     []string{"{{ with .Tags.service }}{{ . }}.internal{{ end }}", "{{ if .Tags.team }}{{ .Tags.team }}.{{ .Region }}.internal{{ end }}"},
+			FailOpen: failOpen,
+		}
+		assert.FatalError(t, p.InstanceTags.init())
+		p.config.ec2URL = srv.URL
+		p.config.ec2Client = srv.Client()
+		return p
+	}
+	failClosed := newProvisioner(t, false)
+	failOpen := newProvisioner(t, true)
+
+	tests := []struct {
+		name         string
+		p            *AWS
+		instanceID   string
+		wantDNSNames []string
+		wantRequests int32
+		wantCode     int
+	}{
+		{"ok", failClosed, "i-billing", []string{"billing.internal", "payments.us-west-1.internal"}, 1, 0},
+		{"ok cached", failClosed, "i-billing", []string{"billing.internal", "payments.us-west-1.internal"}, 0, 0},
+		{"ok untagged", failClosed, "i-untagged", nil, 1, 0},
+		{"ok fail open", failOpen, "i-unavailable", nil, 1, 0},
+		{"ok fail open not found", failOpen, "i-missing", nil, 1, 0},
+		{"fail unavailable", failClosed, "i-unavailable", nil, 1, http.StatusServiceUnavailable},
+		{"fail unavailable not cached", failClosed, "i-unavailable", nil, 1, http.StatusServiceUnavailable},
+		{"fail not found", failClosed, "i-missing", nil, 1, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			tok, err := generateAWSToken(
+				tt.p, "instance-id", awsIssuer, tt.p.GetID(), tt.p.Accounts[0], tt.instanceID,
+				"127.0.0.1", "us-west-1", time.Now(), key)
+			assert.FatalError(t, err)
+
+			opts, err := tt.p.AuthorizeSign(context.Background(), tok)
+			assert.Equals(t, tt.wantRequests, atomic.LoadInt32(&requests))
+			if tt.wantCode != 0 {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, tt.wantCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+
+			var dnsNames []string
+			for _, o := range opts {
+				if m, ok := o.(resolvedSANsModifier); ok {
+					dnsNames = append(dnsNames, m.DNSNames...)
+				}
+			}
+			assert.Equals(t, tt.wantDNSNames, dnsNames)
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
@@ -246,6 +247,136 @@ func TestAWS_GetIdentityToken_BadIDMS(t *testing.T) {
 	assert.HasSuffix(t, err.Error(), badIDMS.Error())
 }
 
+func TestAWS_readURL(t *testing.T) {
+	var gotTTL string
+	newServer := func(tokenStatus int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/latest/api/token":
+				gotTTL = r.Header.Get(awsMetadataTokenTTLHeader)
+				if tokenStatus != http.StatusOK {
+					w.WriteHeader(tokenStatus)
+					return
+				}
+				w.Write([]byte("token"))
+			case "/latest/dynamic/instance-identity/document":
+				if r.Header.Get(awsMetadataTokenHeader) == "token" {
+					w.Write([]byte("v2"))
+				} else {
+					w.Write([]byte("v1"))
+				}
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+
+	tests := []struct {
+		name        string
+		tokenStatus int
+		ttl         Duration
+		want        string
+		wantTTL     string
+		wantErr     bool
+	}{
+		{"ok v2", http.StatusOK, Duration{}, "v2", awsAPITokenTTL, false},
+		{"ok v2 with ttl", http.StatusOK, Duration{Duration: 5 * time.Minute}, "v2", "300", false},
+		{"ok fallback v1", http.StatusNotFound, Duration{}, "v1", awsAPITokenTTL, false},
+		{"fail forbidden", http.StatusForbidden, Duration{}, "", awsAPITokenTTL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(tt.tokenStatus)
+			defer srv.Close()
+			p, err := generateAWS()
+			assert.FatalError(t, err)
+			p.IMDSTokenTTL = tt.ttl
+			p.config.tokenURL = srv.URL + "/latest/api/token"
+
+			gotTTL = ""
+			got, err := p.readURL(context.Background(), srv.URL+"/latest/dynamic/instance-identity/document")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AWS.readURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, string(got))
+			assert.Equals(t, tt.wantTTL, gotTTL)
+		})
+	}
+}
+
+func TestAWS_Init_overwriteCommonName(t *testing.T) {
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	p := &AWS{Type: "AWS", Name: "name", OverwriteCommonName: true}
+	if err := p.Init(config); assert.Error(t, err) {
+		assert.Equals(t, "provisioner overwriteCommonName requires disableCustomSANs", err.Error())
+	}
+	p.DisableCustomSANs = true
+	assert.FatalError(t, p.Init(config))
+}
+
+func TestAWS_Init_imdsTokenTTL(t *testing.T) {
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{"ok default", 0, false},
+		{"ok", time.Minute, false},
+		{"ok max", 6 * time.Hour, false},
+		{"fail negative", -time.Minute, true},
+		{"fail too long", 7 * time.Hour, true},
+		{"fail fraction", 1500 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &AWS{Type: "AWS", Name: "name", IMDSTokenTTL: Duration{Duration: tt.ttl}}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("AWS.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAWS_Init_allowedRoles(t *testing.T) {
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name    string
+		roles   []string
+		want    []awsRoleARN
+		wantErr bool
+	}{
+		{"ok default", nil, nil, false},
+		{"ok", []string{"arn:aws:iam::123456789012:role/name", "arn:aws-cn:iam::123456789012:role/path/to/other"}, []awsRoleARN{
+			{"aws", "123456789012", "name"}, {"aws-cn", "123456789012", "other"},
+		}, false},
+		{"fail user", []string{"arn:aws:iam::123456789012:user/name"}, nil, true},
+		{"fail service", []string{"arn:aws:sts::123456789012:role/name"}, nil, true},
+		{"fail account", []string{"arn:aws:iam:::role/name"}, nil, true},
+		{"fail name", []string{"arn:aws:iam::123456789012:role/"}, nil, true},
+		{"fail arn", []string{"name"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &AWS{Type: "AWS", Name: "name", AllowedRoles: tt.roles}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("AWS.Init() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equals(t, tt.want, p.roles)
+			}
+		})
+	}
+}
+
 func TestAWS_Init(t *testing.T) {
 	config := Config{
 		Claims: globalProvisionerClaims,
@@ -558,6 +689,9 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 	assert.FatalError(t, err)
 	p3.config = p1.config
 
+	p4 := *p2
+	p4.OverwriteCommonName = true
+
 	t1, err := p1.GetIdentityToken("foo.local", "https://ca.smallstep.com")
 	assert.FatalError(t, err)
 	t2, err := p2.GetIdentityToken("instance-id", "https://ca.smallstep.com")
@@ -642,11 +776,12 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok", p1, args{t1, "foo.local"}, 9, http.StatusOK, false},
-		{"ok", p2, args{t2, "instance-id"}, 13, http.StatusOK, false},
-		{"ok", p2, args{t2Hostname, "ip-127-0-0-1.us-west-1.compute.internal"}, 13, http.StatusOK, false},
-		{"ok", p2, args{t2PrivateIP, "127.0.0.1"}, 13, http.StatusOK, false},
-		{"ok", p1, args{t4, "instance-id"}, 9, http.StatusOK, false},
+		{"ok", p1, args{t1, "foo.local"}, 14, http.StatusOK, false},
+		{"ok", p2, args{t2, "instance-id"}, 18, http.StatusOK, false},
+		{"ok", p2, args{t2Hostname, "ip-127-0-0-1.us-west-1.compute.internal"}, 18, http.StatusOK, false},
+		{"ok", p2, args{t2PrivateIP, "127.0.0.1"}, 18, http.StatusOK, false},
+		{"ok", p1, args{t4, "instance-id"}, 14, http.StatusOK, false},
+		{"ok overwrite common name", &p4, args{t2, "instance-id"}, 18, http.StatusOK, false},
 		{"fail account", p3, args{token: t3}, 0, http.StatusUnauthorized, true},
 		{"fail token", p1, args{token: "token"}, 0, http.StatusUnauthorized, true},
 		{"fail subject", p1, args{token: failSubject}, 0, http.StatusUnauthorized, true},
@@ -686,6 +821,10 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 					case profileDefaultDuration:
 						assert.Equals(t, time.Duration(v), tt.aws.ctl.Claimer.DefaultTLSCertDuration())
 					case commonNameValidator:
+						assert.False(t, tt.aws.OverwriteCommonName)
+						assert.Equals(t, string(v), tt.args.cn)
+					case commonNameModifier:
+						assert.True(t, tt.aws.OverwriteCommonName)
 						assert.Equals(t, string(v), tt.args.cn)
 					case defaultPublicKeyValidator:
 					case *validityValidator:
@@ -704,6 +843,16 @@ func TestAWS_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, nil, v.policyEngine)
 					case *WebhookController:
 						assert.Len(t, 0, v.webhooks)
+					case X509SignerName:
+						assert.Equals(t, "", string(v))
+					case *uniqueSANOption:
+						assert.False(t, v.Enabled)
+					case *signatureAlgorithmOption:
+						assert.Len(t, 0, v.Allowed)
+					case DuplicateDNSNamesPolicy:
+						assert.Equals(t, "", string(v))
+					case X509SerialGenerator:
+						assert.Nil(t, v.SerialGenerator)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -898,3 +1047,101 @@ func TestAWS_HardcodedCertificates(t *testing.T) {
 	}
 	assert.Len(t, 15, certs, "expected 15 certificates in aws_certificates.pem")
 }
+
+func TestAWS_AuthorizeSign_allowedRoles(t *testing.T) {
+	p, err := generateAWS()
+	assert.FatalError(t, err)
+	account := p.Accounts[0]
+
+	block, _ := pem.Decode([]byte(awsTestKey))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatal("error decoding AWS key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	assert.FatalError(t, err)
+
+	const stsBody = "Action=GetCallerIdentity&Version=2011-06-15"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "AWS4-HMAC-SHA256 signed" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		arn := r.Header.Get("X-Test-Arn")
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROAEXAMPLE:instance-id</UserId>
+    <Account>%s</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, arn, account)
+	}))
+	defer srv.Close()
+	p.config.stsClient = srv.Client()
+	p.config.isSTSHost = func(host string) bool {
+		return host == "127.0.0.1"
+	}
+	p.roles = []awsRoleARN{{"aws", account, "allowed"}}
+
+	withSTS := func(url, method, authorization, arn string) func(*awsPayload) {
+		return func(payload *awsPayload) {
+			payload.Amazon.STSRequest = &awsSTSRequest{
+				Method: method,
+				URL:    url,
+				Headers: map[string][]string{
+					"Authorization": {authorization},
+					"X-Test-Arn":    {arn},
+				},
+				Body: []byte(stsBody),
+			}
+		}
+	}
+	token := func(opts ...func(*awsPayload)) string {
+		tok, err := generateAWSToken(
+			p, "instance-id", awsIssuer, p.GetID(), account, "instance-id",
+			"127.0.0.1", "us-west-1", time.Now(), key, opts...)
+		assert.FatalError(t, err)
+		return tok
+	}
+	allowedARN := "arn:aws:sts::" + account + ":assumed-role/allowed/instance-id"
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"ok", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 signed", allowedARN)), ""},
+		{"fail no sts request", token(), "aws token does not contain an sts request"},
+		{"fail role", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 signed", "arn:aws:sts::"+account+":assumed-role/other/instance-id")), `role "other" is not allowed`},
+		{"fail session", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 signed", "arn:aws:sts::"+account+":assumed-role/allowed/other-instance")), "session does not match"},
+		{"fail account", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 signed", "arn:aws:sts::000000000000:assumed-role/allowed/instance-id")), "account does not match"},
+		{"fail user", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 signed", "arn:aws:iam::"+account+":user/allowed")), "is not an assumed role ARN"},
+		{"fail signature", token(withSTS(srv.URL, "POST", "AWS4-HMAC-SHA256 bad", allowedARN)), "non-successful status code 403"},
+		{"fail method", token(withSTS(srv.URL, "GET", "AWS4-HMAC-SHA256 signed", allowedARN)), `method "GET" is not supported`},
+		{"fail host", token(withSTS("https://sts.example.com", "POST", "AWS4-HMAC-SHA256 signed", allowedARN)), "is not an sts endpoint"},
+		{"fail scheme", token(withSTS(strings.Replace(srv.URL, "https", "http", 1), "POST", "AWS4-HMAC-SHA256 signed", allowedARN)), "is not an sts endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.err == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.True(t, strings.Contains(err.Error(), tt.err), err.Error())
+			}
+		})
+	}
+}
+
+func Test_awsSTSHostRegexp(t *testing.T) {
+	for _, host := range []string{"sts.amazonaws.com", "sts.us-west-2.amazonaws.com", "sts-fips.us-east-1.amazonaws.com", "sts.cn-north-1.amazonaws.com.cn"} {
+		assert.True(t, awsSTSHostRegexp.MatchString(host), host)
+	}
+	for _, host := range []string{"sts.amazonaws.com.example.com", "example.com", "sts.us-west-2.amazonaws.org", "xsts.amazonaws.com"} {
+		assert.False(t, awsSTSHostRegexp.MatchString(host), host)
+	}
+}
@@ -41,6 +41,14 @@ const azureDefaultAudience = "https://management.azure.com/"
 // Using case insensitive as resourceGroups appears as resourcegroups.
 var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.(Compute/virtualMachines|ManagedIdentity/userAssignedIdentities)/([^/]+)$`)
 
+// azureClientIDRegExp is the regular expression used to validate the client id
+// of a managed identity.
+var azureClientIDRegExp = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// azureSPIFFEFields are the fields that can be used in the SPIFFE path
+// template.
+var azureSPIFFEFields = []string{"TenantID", "SubscriptionID", "ResourceGroup", "Name"}
+
 // azureEnvironments is the list of all Azure environments.
 var azureEnvironments = map[string]string{
 	"AzurePublicCloud":       "https://management.azure.com/",
@@ -96,27 +104,60 @@ type azurePayload struct {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// If DisableCustomSANs is false, CustomSANsMode defines how the SANs in the CSR
+// are combined with the internal ones: "csr", the default, uses only the SANs
+// in the CSR, "merge" adds the internal SANs to the ones in the CSR, and
+// "token" uses only the internal SANs.
+//
+// If OverwriteCommonName and DisableCustomSANs are true, the common name in the
+// CSR is ignored and the certificate common name is set to the virtual machine name.
+// By default a CSR with a different common name is rejected.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
 //
+// If SPIFFE is set, a SPIFFE ID is added as a URI SAN. The path template can
+// use the fields TenantID, SubscriptionID, ResourceGroup and Name, the name of
+// the virtual machine or the user-assigned identity.
+//
+// If SSHHostPrincipals is set, the principals of the SSH host certificates are
+// generated from templates that can use the same fields, and the principals
+// requested that are not generated are dropped.
+//
+// If StrictIdentity is true, a CSR with a common name or SANs other than the
+// virtual machine name is rejected, even if DisableCustomSANs is false. By
+// default it is disabled.
+//
+// If IdentityClientID is set, GetIdentityToken requests the token of the
+// user-assigned managed identity with that client id, for virtual machines
+// with more than one managed identity, and only tokens of that identity are
+// accepted. ObjectIDs restricts the accepted identities by their object id.
+//
 // Microsoft Azure identity docs are available at
 // https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
 // and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
 type Azure struct {
 	*base
-	ID                     string   `json:"-"`
-	Type                   string   `json:"type"`
-	Name                   string   `json:"name"`
-	TenantID               string   `json:"tenantID"`
-	ResourceGroups         []string `json:"resourceGroups"`
-	SubscriptionIDs        []string `json:"subscriptionIDs"`
-	ObjectIDs              []string `json:"objectIDs"`
-	Audience               string   `json:"audience,omitempty"`
-	DisableCustomSANs      bool     `json:"disableCustomSANs"`
-	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	Options                *Options `json:"options,omitempty"`
+	ID                     string                    `json:"-"`
+	Type                   string                    `json:"type"`
+	Name                   string                    `json:"name"`
+	TenantID               string                    `json:"tenantID"`
+	ResourceGroups         []string                  `json:"resourceGroups"`
+	SubscriptionIDs        []string                  `json:"subscriptionIDs"`
+	ObjectIDs              []string                  `json:"objectIDs"`
+	IdentityClientID       string                    `json:"identityClientID,omitempty"`
+	Audience               string                    `json:"audience,omitempty"`
+	DisableCustomSANs      bool                      `json:"disableCustomSANs"`
+	OverwriteCommonName    bool                      `json:"overwriteCommonName,omitempty"`
+	CustomSANsMode         CustomSANsMode            `json:"customSANsMode,omitempty"`
+	DisableTrustOnFirstUse bool                      `json:"disableTrustOnFirstUse"`
+	SPIFFE                 *SPIFFEOptions            `json:"spiffe,omitempty"`
+	SSHHostPrincipals      *SSHHostPrincipalsOptions `json:"sshHostPrincipals,omitempty"`
+	StrictIdentity         bool                      `json:"strictIdentity,omitempty"`
+	MetadataRetry          *MetadataRetryOptions     `json:"metadataRetry,omitempty"`
+	Claims                 *Claims                   `json:"claims,omitempty"`
+	Options                *Options                  `json:"options,omitempty"`
 	config                 *azureConfig
 	oidcConfig             openIDConfiguration
 	keyStore               *keyStore
@@ -175,6 +216,25 @@ func (p *Azure) GetType() Type {
 	return TypeAzure
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *Azure) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *Azure) GetController() *Controller {
+	return p.ctl
+}
+
+// GetCapabilities returns the certificates the provisioner can issue. Azure
+// instances can only request SSH host certificates.
+func (p *Azure) GetCapabilities() *Capabilities {
+	caps := newCapabilities(p.ctl.GetClaimer(), false, true)
+	caps.AllowCustomSANs = !p.DisableCustomSANs
+	caps.TrustOnFirstUse = !p.DisableTrustOnFirstUse
+	return caps
+}
+
 // GetEncryptedKey is not available in an Azure provisioner.
 func (p *Azure) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -183,6 +243,13 @@ func (p *Azure) GetEncryptedKey() (kid, key string, ok bool) {
 // GetIdentityToken retrieves from the metadata service the identity token and
 // returns it.
 func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
+	return p.GetIdentityTokenWithContext(context.Background(), subject, caURL)
+}
+
+// GetIdentityTokenWithContext retrieves the identity token from the metadata
+// service with the given context, retrying the request if MetadataRetry is
+// configured.
+func (p *Azure) GetIdentityTokenWithContext(ctx context.Context, subject, caURL string) (string, error) {
 	_, _ = subject, caURL // unused input
 
 	// Initialize the config if this method is used from the cli.
@@ -192,7 +259,7 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	identityTokenResource := azureEnvironments["AzurePublicCloud"]
 
 	var err error
-	p.environment, err = p.getAzureEnvironment()
+	p.environment, err = p.getAzureEnvironment(ctx)
 	if err != nil {
 		return "", errors.Wrap(err, "error getting azure environment")
 	}
@@ -210,9 +277,12 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	query := req.URL.Query()
 	query.Add("resource", identityTokenResource)
 	query.Add("api-version", azureIdentityTokenAPIVersion)
+	if p.IdentityClientID != "" {
+		query.Add("client_id", p.IdentityClientID)
+	}
 	req.URL.RawQuery = query.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.MetadataRetry.do(ctx, http.DefaultClient, req)
 	if err != nil {
 		return "", errors.Wrap(err, "error getting identity token, are you in a Azure VM?")
 	}
@@ -236,14 +306,27 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 
 // Init validates and initializes the Azure provisioner.
 func (p *Azure) Init(config Config) (err error) {
-	switch {
-	case p.Type == "":
-		return errors.New("provisioner type cannot be empty")
-	case p.Name == "":
-		return errors.New("provisioner name cannot be empty")
-	case p.TenantID == "":
-		return errors.New("provisioner tenantId cannot be empty")
-	case p.Audience == "": // use default audience
+	var v configValidator
+	v.check(p.Type == "", "type", "provisioner type cannot be empty")
+	v.check(p.Name == "", "name", "provisioner name cannot be empty")
+	v.check(p.TenantID == "", "tenantID", "provisioner tenantId cannot be empty")
+	v.check(containsString(p.ResourceGroups, ""), "resourceGroups", "provisioner resourceGroups cannot contain empty values")
+	v.check(containsString(p.SubscriptionIDs, ""), "subscriptionIDs", "provisioner subscriptionIDs cannot contain empty values")
+	v.check(containsString(p.ObjectIDs, ""), "objectIDs", "provisioner objectIDs cannot contain empty values")
+	if p.IdentityClientID != "" && !azureClientIDRegExp.MatchString(p.IdentityClientID) {
+		v.add("identityClientID", errors.Errorf("provisioner identityClientID %q is not a valid client id", p.IdentityClientID))
+	}
+	v.add("customSANsMode", p.CustomSANsMode.Validate())
+	v.add("spiffe", p.SPIFFE.init(azureSPIFFEFields))
+	v.add("sshHostPrincipals", p.SSHHostPrincipals.init(azureSPIFFEFields))
+	v.add("metadataRetry", p.MetadataRetry.init())
+	v.check(p.OverwriteCommonName && !p.DisableCustomSANs, "overwriteCommonName", "provisioner overwriteCommonName requires disableCustomSANs")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	// Use the default audience
+	if p.Audience == "" {
 		p.Audience = azureDefaultAudience
 	}
 
@@ -266,19 +349,32 @@ func (p *Azure) Init(config Config) (err error) {
 	return
 }
 
+// Check verifies that the OpenID discovery endpoint is reachable and that its
+// key set has at least one key.
+func (p *Azure) Check(ctx context.Context) error {
+	var oidcConfig openIDConfiguration
+	if err := getAndDecodeContext(ctx, p.config.oidcDiscoveryURL, &oidcConfig); err != nil {
+		return err
+	}
+	if err := oidcConfig.Validate(); err != nil {
+		return errors.Wrapf(err, "error parsing %s", p.config.oidcDiscoveryURL)
+	}
+	return checkKeySet(ctx, oidcConfig.JWKSetURI)
+}
+
 // authorizeToken returns the claims, name, group, subscription, identityObjectID, error.
-func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, string, string, error) {
+func (p *Azure) authorizeToken(ctx context.Context, token string) (*azurePayload, string, string, string, string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, "", "", "", "", errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; error parsing azure token")
+		return nil, "", "", "", "", authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; error parsing azure token"))
 	}
 	if len(jwt.Headers) == 0 {
-		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure token missing header")
+		return nil, "", "", "", "", authorizeErr(ReasonMalformedToken, errs.Unauthorized("azure.authorizeToken; azure token missing header"))
 	}
 
 	var found bool
 	var claims azurePayload
-	keys := p.keyStore.Get(jwt.Headers[0].KeyID)
+	keys := p.keyStore.Get(ctx, jwt.Headers[0].KeyID)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -286,7 +382,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 		}
 	}
 	if !found {
-		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; cannot validate azure token")
+		return nil, "", "", "", "", authorizeErr(ReasonUnknownKey, errs.Unauthorized("azure.authorizeToken; cannot validate azure token"))
 	}
 
 	if err := claims.ValidateWithLeeway(jose.Expected{
@@ -294,17 +390,22 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 		Issuer:   p.oidcConfig.Issuer,
 		Time:     time.Now(),
 	}, 1*time.Minute); err != nil {
-		return nil, "", "", "", "", errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; failed to validate azure token payload")
+		return nil, "", "", "", "", authorizeErr(validationReason(err), errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; failed to validate azure token payload"))
 	}
 
 	// Validate TenantID
 	if claims.TenantID != p.TenantID {
-		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure token validation failed - invalid tenant id claim (tid)")
+		return nil, "", "", "", "", authorizeErr(ReasonInvalidClaims, errs.Unauthorized("azure.authorizeToken; azure token validation failed - invalid tenant id claim (tid)"))
+	}
+
+	// Validate the client id of the managed identity
+	if p.IdentityClientID != "" && !strings.EqualFold(claims.AppID, p.IdentityClientID) {
+		return nil, "", "", "", "", authorizeErr(ReasonInvalidClaims, errs.Unauthorized("azure.authorizeToken; azure token validation failed - invalid client id claim (appid)"))
 	}
 
 	re := azureXMSMirIDRegExp.FindStringSubmatch(claims.XMSMirID)
 	if len(re) != 5 {
-		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; error parsing xms_mirid claim - %s", claims.XMSMirID)
+		return nil, "", "", "", "", authorizeErr(ReasonInvalidClaims, errs.Unauthorized("azure.authorizeToken; error parsing xms_mirid claim - %s", claims.XMSMirID))
 	}
 
 	var subscription, group, name string
@@ -317,7 +418,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	_, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
+	claims, name, group, subscription, identityObjectID, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
 	}
@@ -332,7 +433,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid resource group")
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid resource group"))
 		}
 	}
 
@@ -346,7 +447,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid subscription id")
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid subscription id"))
 		}
 	}
 
@@ -360,10 +461,19 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid identity object id")
+			return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid identity object id"))
 		}
 	}
 
+	// Rate limit by the virtual machine or the user-assigned identity
+	instanceID := subscription + "/" + group + "/" + name
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, instanceID); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
+	}
+
 	// Template options
 	data := x509util.NewTemplateData()
 	data.SetCommonName(name)
@@ -371,14 +481,32 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		data.SetToken(v)
 	}
 
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "azure.AuthorizeSign")
+	}
+
+	// Restrict the subject alternative names to the ones in the manifest.
+	manifestOpts, err := p.ctl.newSANManifestOptions(instanceID)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "azure.AuthorizeSign")
+	}
+	so = append(so, manifestOpts...)
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
 	// Enforce known common name and default DNS if configured.
 	// By default we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
-	var so []SignOption
 	if p.DisableCustomSANs {
 		// name will work only inside the virtual network
+		var cnOption SignOption = commonNameValidator(name)
+		if p.OverwriteCommonName {
+			cnOption = commonNameModifier(name)
+		}
 		so = append(so,
-			commonNameValidator(name),
+			cnOption,
 			dnsNamesValidator([]string{name}),
 			ipAddressesValidator(nil),
 			emailAddressesValidator(nil),
@@ -387,7 +515,24 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 
 		// Enforce SANs in the template.
 		data.SetSANs([]string{name})
+	} else {
+		so = append(so, customSANsOptions(p.CustomSANsMode, data, []string{name})...)
+	}
+	if p.StrictIdentity {
+		so = append(so, newStrictIdentityValidator([]string{name}, []string{name}))
+	}
+
+	// Add the SPIFFE ID if configured.
+	spiffeOptions, err := p.SPIFFE.newOptions(map[string]string{
+		"TenantID":       p.TenantID,
+		"SubscriptionID": subscription,
+		"ResourceGroup":  group,
+		"Name":           name,
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "azure.AuthorizeSign")
 	}
+	so = append(so, spiffeOptions...)
 
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
@@ -402,7 +547,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -421,12 +566,12 @@ func (p *Azure) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
 
-	_, name, _, _, identityObjectID, err := p.authorizeToken(token)
+	_, name, group, subscription, identityObjectID, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
@@ -439,12 +584,25 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	}
 
 	// Validated principals.
-	principals := []string{name}
+	principals, principalsOptions, err := p.SSHHostPrincipals.newOptions(map[string]string{
+		"TenantID":       p.TenantID,
+		"SubscriptionID": subscription,
+		"ResourceGroup":  group,
+		"Name":           name,
+	}, []string{name})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "azure.AuthorizeSSHSign")
+	}
 
-	// Only enforce known principals if disable custom sans is true.
-	if p.DisableCustomSANs {
+	// Only enforce known principals if disable custom sans is true. The
+	// requested principals are restricted to the generated ones if
+	// SSHHostPrincipals is set.
+	switch {
+	case principalsOptions != nil:
+		signOptions = append(signOptions, principalsOptions...)
+	case p.DisableCustomSANs:
 		defaults.Principals = principals
-	} else {
+	default:
 		// Check that at least one principal is sent in the request.
 		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
 			Principals: true,
@@ -463,6 +621,9 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Validate user SignSSHOptions.
@@ -476,7 +637,7 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil, p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -494,7 +655,7 @@ func (p *Azure) assertConfig() {
 }
 
 // getAzureEnvironment returns the Azure environment for the current instance
-func (p *Azure) getAzureEnvironment() (string, error) {
+func (p *Azure) getAzureEnvironment(ctx context.Context) (string, error) {
 	if p.environment != "" {
 		return p.environment, nil
 	}
@@ -510,7 +671,7 @@ func (p *Azure) getAzureEnvironment() (string, error) {
 	query.Add("api-version", "2021-02-01")
 	req.URL.RawQuery = query.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.MetadataRetry.do(ctx, http.DefaultClient, req)
 	if err != nil {
 		return "", errors.Wrap(err, "error getting azure instance environment, are you in a Azure VM?")
 	}
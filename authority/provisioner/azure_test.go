@@ -208,11 +208,13 @@ func TestAzure_Init(t *testing.T) {
 	}
 
 	type fields struct {
-		Type     string
-		Name     string
-		TenantID string
-		Claims   *Claims
-		config   *azureConfig
+		Type            string
+		Name            string
+		TenantID        string
+		ResourceGroups  []string
+		SubscriptionIDs []string
+		Claims          *Claims
+		config          *azureConfig
 	}
 	type args struct {
 		config Config
@@ -223,24 +225,29 @@ func TestAzure_Init(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		{"ok", fields{p1.Type, p1.Name, p1.TenantID, nil, p1.config}, args{config}, false},
-		{"ok with config", fields{p1.Type, p1.Name, p1.TenantID, nil, p1.config}, args{config}, false},
-		{"fail type", fields{"", p1.Name, p1.TenantID, nil, p1.config}, args{config}, true},
-		{"fail name", fields{p1.Type, "", p1.TenantID, nil, p1.config}, args{config}, true},
-		{"fail tenant id", fields{p1.Type, p1.Name, "", nil, p1.config}, args{config}, true},
-		{"fail claims", fields{p1.Type, p1.Name, p1.TenantID, badClaims, p1.config}, args{config}, true},
-		{"fail discovery URL", fields{p1.Type, p1.Name, p1.TenantID, nil, badDiscoveryURL}, args{config}, true},
-		{"fail JWK URL", fields{p1.Type, p1.Name, p1.TenantID, nil, badJWKURL}, args{config}, true},
-		{"fail config Validate", fields{p1.Type, p1.Name, p1.TenantID, nil, badAzureConfig}, args{config}, true},
+		{"ok", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, nil, p1.config}, args{config}, false},
+		{"ok with config", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, nil, p1.config}, args{config}, false},
+		{"ok with resource groups and subscriptions", fields{p1.Type, p1.Name, p1.TenantID, []string{"resourceGroup"}, []string{"subscriptionID"}, nil, p1.config}, args{config}, false},
+		{"fail type", fields{"", p1.Name, p1.TenantID, nil, nil, nil, p1.config}, args{config}, true},
+		{"fail name", fields{p1.Type, "", p1.TenantID, nil, nil, nil, p1.config}, args{config}, true},
+		{"fail tenant id", fields{p1.Type, p1.Name, "", nil, nil, nil, p1.config}, args{config}, true},
+		{"fail resource groups", fields{p1.Type, p1.Name, p1.TenantID, []string{"resourceGroup", ""}, nil, nil, p1.config}, args{config}, true},
+		{"fail subscriptions", fields{p1.Type, p1.Name, p1.TenantID, nil, []string{""}, nil, p1.config}, args{config}, true},
+		{"fail claims", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, badClaims, p1.config}, args{config}, true},
+		{"fail discovery URL", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, nil, badDiscoveryURL}, args{config}, true},
+		{"fail JWK URL", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, nil, badJWKURL}, args{config}, true},
+		{"fail config Validate", fields{p1.Type, p1.Name, p1.TenantID, nil, nil, nil, badAzureConfig}, args{config}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Azure{
-				Type:     tt.fields.Type,
-				Name:     tt.fields.Name,
-				TenantID: tt.fields.TenantID,
-				Claims:   tt.fields.Claims,
-				config:   tt.fields.config,
+				Type:            tt.fields.Type,
+				Name:            tt.fields.Name,
+				TenantID:        tt.fields.TenantID,
+				ResourceGroups:  tt.fields.ResourceGroups,
+				SubscriptionIDs: tt.fields.SubscriptionIDs,
+				Claims:          tt.fields.Claims,
+				config:          tt.fields.config,
 			}
 			if err := p.Init(tt.args.config); (err != nil) != tt.wantErr {
 				t.Errorf("Azure.Init() error = %v, wantErr %v", err, tt.wantErr)
@@ -370,7 +377,7 @@ func TestAzure_authorizeToken(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if claims, name, group, subscriptionID, objectID, err := tc.p.authorizeToken(tc.token); err != nil {
+			if claims, name, group, subscriptionID, objectID, err := tc.p.authorizeToken(context.Background(), tc.token); err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
 					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
@@ -510,11 +517,11 @@ func TestAzure_AuthorizeSign(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok", p1, args{t1}, 8, http.StatusOK, false},
-		{"ok", p2, args{t2}, 13, http.StatusOK, false},
-		{"ok", p1, args{t11}, 8, http.StatusOK, false},
-		{"ok", p5, args{t5}, 8, http.StatusOK, false},
-		{"ok", p7, args{t7}, 8, http.StatusOK, false},
+		{"ok", p1, args{t1}, 13, http.StatusOK, false},
+		{"ok", p2, args{t2}, 18, http.StatusOK, false},
+		{"ok", p1, args{t11}, 13, http.StatusOK, false},
+		{"ok", p5, args{t5}, 13, http.StatusOK, false},
+		{"ok", p7, args{t7}, 13, http.StatusOK, false},
 		{"fail tenant", p3, args{t3}, 0, http.StatusUnauthorized, true},
 		{"fail resource group", p4, args{t4}, 0, http.StatusUnauthorized, true},
 		{"fail subscription", p6, args{t6}, 0, http.StatusUnauthorized, true},
@@ -569,6 +576,16 @@ func TestAzure_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, nil, v.policyEngine)
 					case *WebhookController:
 						assert.Len(t, 0, v.webhooks)
+					case X509SignerName:
+						assert.Equals(t, "", string(v))
+					case *uniqueSANOption:
+						assert.False(t, v.Enabled)
+					case *signatureAlgorithmOption:
+						assert.Len(t, 0, v.Allowed)
+					case DuplicateDNSNamesPolicy:
+						assert.Equals(t, "", string(v))
+					case X509SerialGenerator:
+						assert.Nil(t, v.SerialGenerator)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -752,3 +769,123 @@ func TestAzure_assertConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestAzure_Check(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		discoveryURL string
+		wantErr      bool
+	}{
+		{"ok", p.config.oidcDiscoveryURL, false},
+		{"fail empty", srv.URL + "/empty/.well-known/openid-configuration", true},
+		{"fail jwk", srv.URL + "/openid-configuration-fail-jwk", true},
+		{"fail no issuer", srv.URL + "/openid-configuration-no-issuer", true},
+		{"fail discovery", srv.URL + "/error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.config.oidcDiscoveryURL = tt.discoveryURL
+			if err := p.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Azure.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAzure_identityClientID(t *testing.T) {
+	const clientID = "5b5ac7f4-5c4f-4f8a-a8b4-2f1d5a5e4c3b"
+
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims}
+	for _, tt := range []struct {
+		name     string
+		clientID string
+		wantErr  bool
+	}{
+		{"ok", clientID, false},
+		{"ok upper case", strings.ToUpper(clientID), false},
+		{"fail", "my-identity", true},
+	} {
+		t.Run("Init/"+tt.name, func(t *testing.T) {
+			p := &Azure{Type: p.Type, Name: p.Name, TenantID: p.TenantID, IdentityClientID: tt.clientID, config: p.config}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("Azure.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	t.Run("Init/fail objectIDs", func(t *testing.T) {
+		p := &Azure{Type: p.Type, Name: p.Name, TenantID: p.TenantID, ObjectIDs: []string{""}, config: p.config}
+		assert.Error(t, p.Init(config))
+	})
+
+	// Init replaces the key store with the public keys.
+	key := p.keyStore.keySet.Keys[0]
+	p.IdentityClientID = clientID
+	assert.FatalError(t, p.Init(config))
+
+	t.Run("GetIdentityToken", func(t *testing.T) {
+		srvIdentity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("client_id"); got != clientID {
+				http.Error(w, fmt.Sprintf("client_id = %s, want %s", got, clientID), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"the-token"}`)
+		}))
+		defer srvIdentity.Close()
+		srvInstance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("AzurePublicCloud"))
+		}))
+		defer srvInstance.Close()
+
+		p.config.identityTokenURL = srvIdentity.URL
+		p.config.instanceComputeURL = srvInstance.URL
+		got, err := p.GetIdentityToken("subject", "caURL")
+		assert.FatalError(t, err)
+		assert.Equals(t, "the-token", got)
+	})
+
+	newToken := func(appID string) string {
+		sig, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.ES256, Key: key.Key},
+			new(jose.SignerOptions).WithType("JWT").WithHeader("kid", key.KeyID),
+		)
+		assert.FatalError(t, err)
+		now := time.Now()
+		tok, err := jose.Signed(sig).Claims(azurePayload{
+			Claims: jose.Claims{
+				Subject:   "subject",
+				Issuer:    p.oidcConfig.Issuer,
+				IssuedAt:  jose.NewNumericDate(now),
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+				Audience:  []string{azureDefaultAudience},
+			},
+			AppID:    appID,
+			ObjectID: "the-oid",
+			TenantID: p.TenantID,
+			XMSMirID: "/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/identity",
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	t.Run("authorizeToken", func(t *testing.T) {
+		_, name, _, _, _, err := p.authorizeToken(context.Background(), newToken(strings.ToUpper(clientID)))
+		assert.FatalError(t, err)
+		assert.Equals(t, "identity", name)
+
+		_, _, _, _, _, err = p.authorizeToken(context.Background(), newToken("4a4ac7f4-5c4f-4f8a-a8b4-2f1d5a5e4c3b"))
+		if assert.Error(t, err) {
+			var sc render.StatusCodedError
+			assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+			assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package provisioner
+
+// CapabilitiesGetter is the interface implemented by provisioners that can
+// describe the certificates they are able to issue.
+type CapabilitiesGetter interface {
+	GetCapabilities() *Capabilities
+}
+
+const (
+	// CapabilityX509 is the certificate type used for X.509 certificates.
+	CapabilityX509 = "x509"
+	// CapabilitySSH is the certificate type used for SSH certificates.
+	CapabilitySSH = "ssh"
+)
+
+// Capabilities describes the certificates a provisioner can issue, so tools
+// listing the provisioners do not need to interpret their configuration.
+type Capabilities struct {
+	// CertTypes are the supported certificate types, "x509" and "ssh".
+	CertTypes []string `json:"certTypes"`
+	// AllowCustomSANs is true if the SANs in the request can be other than the
+	// ones derived from the identity of the requester.
+	AllowCustomSANs bool `json:"allowCustomSANs"`
+	// TrustOnFirstUse is true if only one certificate can be requested per
+	// instance. It only applies to cloud provisioners.
+	TrustOnFirstUse bool `json:"trustOnFirstUse"`
+	// AllowRenewal is true if the certificates can be renewed.
+	AllowRenewal bool `json:"allowRenewal"`
+	// X509Durations are the durations of the X.509 certificates.
+	X509Durations *CapabilityDurations `json:"x509Durations"`
+	// SSHUserDurations are the durations of the SSH user certificates.
+	SSHUserDurations *CapabilityDurations `json:"sshUserDurations,omitempty"`
+	// SSHHostDurations are the durations of the SSH host certificates.
+	SSHHostDurations *CapabilityDurations `json:"sshHostDurations,omitempty"`
+}
+
+// CapabilityDurations are the minimum, maximum and default durations of a
+// certificate type.
+type CapabilityDurations struct {
+	Min     Duration `json:"min"`
+	Max     Duration `json:"max"`
+	Default Duration `json:"default"`
+}
+
+// newCapabilities returns the capabilities defined by the claimer. The SSH
+// certificate types are only added if the SSH CA is enabled.
+func newCapabilities(c *Claimer, sshUser, sshHost bool) *Capabilities {
+	caps := &Capabilities{
+		CertTypes:    []string{CapabilityX509},
+		AllowRenewal: !c.IsDisableRenewal(),
+		X509Durations: &CapabilityDurations{
+			Min:     Duration{c.MinTLSCertDuration()},
+			Max:     Duration{c.MaxTLSCertDuration()},
+			Default: Duration{c.DefaultTLSCertDuration()},
+		},
+	}
+	if !c.IsSSHCAEnabled() || (!sshUser && !sshHost) {
+		return caps
+	}
+	caps.CertTypes = append(caps.CertTypes, CapabilitySSH)
+	if sshUser {
+		caps.SSHUserDurations = &CapabilityDurations{
+			Min:     Duration{c.MinUserSSHCertDuration()},
+			Max:     Duration{c.MaxUserSSHCertDuration()},
+			Default: Duration{c.DefaultUserSSHCertDuration()},
+		}
+	}
+	if sshHost {
+		caps.SSHHostDurations = &CapabilityDurations{
+			Min:     Duration{c.MinHostSSHCertDuration()},
+			Max:     Duration{c.MaxHostSSHCertDuration()},
+			Default: Duration{c.DefaultHostSSHCertDuration()},
+		}
+	}
+	return caps
+}
@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	x509Durations := &CapabilityDurations{
+		Min:     Duration{5 * time.Minute},
+		Max:     Duration{24 * time.Hour},
+		Default: Duration{24 * time.Hour},
+	}
+	sshUserDurations := &CapabilityDurations{
+		Min:     Duration{5 * time.Minute},
+		Max:     Duration{24 * time.Hour},
+		Default: Duration{16 * time.Hour},
+	}
+	sshHostDurations := &CapabilityDurations{
+		Min:     Duration{5 * time.Minute},
+		Max:     Duration{30 * 24 * time.Hour},
+		Default: Duration{30 * 24 * time.Hour},
+	}
+
+	disabledSSH := false
+	noSSHClaims := globalProvisionerClaims
+	noSSHClaims.EnableSSHCA = &disabledSSH
+
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateOIDC()
+	assert.FatalError(t, err)
+	p3, err := generateGCP()
+	assert.FatalError(t, err)
+	p4, err := generateAWS()
+	assert.FatalError(t, err)
+	p4.DisableCustomSANs = true
+	p4.DisableTrustOnFirstUse = true
+	p5, err := generateAzure()
+	assert.FatalError(t, err)
+	p6, err := generateJWK()
+	assert.FatalError(t, err)
+	p6.ctl, err = NewController(p6, &noSSHClaims, Config{Audiences: testAudiences}, nil)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		prov CapabilitiesGetter
+		want *Capabilities
+	}{
+		{"jwk", p1, &Capabilities{
+			CertTypes:        []string{"x509", "ssh"},
+			AllowCustomSANs:  true,
+			AllowRenewal:     true,
+			X509Durations:    x509Durations,
+			SSHUserDurations: sshUserDurations,
+			SSHHostDurations: sshHostDurations,
+		}},
+		{"oidc", p2, &Capabilities{
+			CertTypes:        []string{"x509", "ssh"},
+			AllowRenewal:     true,
+			X509Durations:    x509Durations,
+			SSHUserDurations: sshUserDurations,
+		}},
+		{"gcp", p3, &Capabilities{
+			CertTypes:        []string{"x509", "ssh"},
+			AllowCustomSANs:  true,
+			TrustOnFirstUse:  true,
+			AllowRenewal:     true,
+			X509Durations:    x509Durations,
+			SSHHostDurations: sshHostDurations,
+		}},
+		{"aws", p4, &Capabilities{
+			CertTypes:        []string{"x509", "ssh"},
+			AllowRenewal:     true,
+			X509Durations:    x509Durations,
+			SSHHostDurations: sshHostDurations,
+		}},
+		{"azure", p5, &Capabilities{
+			CertTypes:        []string{"x509", "ssh"},
+			AllowCustomSANs:  true,
+			TrustOnFirstUse:  true,
+			AllowRenewal:     true,
+			X509Durations:    x509Durations,
+			SSHHostDurations: sshHostDurations,
+		}},
+		{"ssh disabled", p6, &Capabilities{
+			CertTypes:       []string{"x509"},
+			AllowCustomSANs: true,
+			AllowRenewal:    true,
+			X509Durations:   x509Durations,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.prov.GetCapabilities())
+		})
+	}
+}
+
+func TestCapabilities_MarshalJSON(t *testing.T) {
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	b, err := json.Marshal(p.GetCapabilities())
+	assert.FatalError(t, err)
+	assert.Equals(t, `{"certTypes":["x509","ssh"],"allowCustomSANs":true,"trustOnFirstUse":true,"allowRenewal":true,`+
+		`"x509Durations":{"min":"5m0s","max":"24h0m0s","default":"24h0m0s"},`+
+		`"sshHostDurations":{"min":"5m0s","max":"720h0m0s","default":"720h0m0s"}}`, string(b))
+}
@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidPolicyQualifierCPS           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+)
+
+// policyInformation is the ASN.1 structure of a PolicyInformation in the
+// Certificate Policies extension defined in RFC 5280, section 4.2.1.4.
+type policyInformation struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	PolicyQualifiers []policyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+// policyQualifierInfo is the ASN.1 structure of a PolicyQualifierInfo with a
+// CPS pointer qualifier.
+type policyQualifierInfo struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         string `asn1:"ia5"`
+}
+
+// parseObjectIdentifier parses an object identifier in the dotted form, e.g.
+// "2.23.140.1.2.1".
+func parseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("%q is not a valid object identifier", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || strings.HasPrefix(p, "+") || (len(p) > 1 && p[0] == '0') {
+			return nil, errors.Errorf("%q is not a valid object identifier", s)
+		}
+		oid[i] = n
+	}
+	// The first arc is 0, 1 or 2, and the second one is less than 40 under
+	// the arcs 0 and 1.
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return nil, errors.Errorf("%q is not a valid object identifier", s)
+	}
+	return oid, nil
+}
+
+// newCertificatePoliciesModifier validates the policy OIDs and the CPS URI
+// configured in the provisioner and returns the modifier that adds them to
+// the certificates. It returns nil if they are not configured.
+func newCertificatePoliciesModifier(policyOIDs []string, cpsURI string) (*certificatePoliciesModifier, error) {
+	if len(policyOIDs) == 0 {
+		if cpsURI != "" {
+			return nil, errors.New("x509.cpsURI requires at least one x509.policyOIDs")
+		}
+		return nil, nil
+	}
+	if cpsURI != "" {
+		if u, err := url.Parse(cpsURI); err != nil || !u.IsAbs() {
+			return nil, errors.Errorf("x509.cpsURI %q is not a valid URL", cpsURI)
+		}
+		for _, r := range cpsURI {
+			if r > 127 {
+				return nil, errors.Errorf("x509.cpsURI %q must be an ASCII string", cpsURI)
+			}
+		}
+	}
+
+	policies := make([]policyInformation, len(policyOIDs))
+	seen := make(map[string]bool, len(policyOIDs))
+	for i, s := range policyOIDs {
+		oid, err := parseObjectIdentifier(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "x509.policyOIDs is not valid")
+		}
+		if seen[oid.String()] {
+			return nil, errors.Errorf("x509.policyOIDs contains the duplicated policy %q", s)
+		}
+		seen[oid.String()] = true
+		policies[i].PolicyIdentifier = oid
+		if cpsURI != "" {
+			policies[i].PolicyQualifiers = []policyQualifierInfo{{
+				PolicyQualifierID: oidPolicyQualifierCPS,
+				Qualifier:         cpsURI,
+			}}
+		}
+	}
+
+	b, err := asn1.Marshal(policies)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling certificate policies")
+	}
+	return &certificatePoliciesModifier{
+		extension: pkix.Extension{
+			Id:    oidExtensionCertificatePolicies,
+			Value: b,
+		},
+	}, nil
+}
+
+// certificatePoliciesModifier is a CertificateModifier that sets the
+// Certificate Policies extension, with the policies and the CPS pointer
+// configured in the provisioner.
+type certificatePoliciesModifier struct {
+	extension pkix.Extension
+}
+
+// Modify sets the Certificate Policies extension of the certificate, replacing
+// the policies added by the template.
+func (m *certificatePoliciesModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.PolicyIdentifiers = nil
+	extensions := make([]pkix.Extension, 0, len(cert.ExtraExtensions)+1)
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionCertificatePolicies) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.ExtraExtensions = append(extensions, m.extension)
+	return nil
+}
@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_parseObjectIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    asn1.ObjectIdentifier
+		wantErr bool
+	}{
+		{"ok", "2.23.140.1.2.1", asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, false},
+		{"ok any policy", "2.5.29.32.0", asn1.ObjectIdentifier{2, 5, 29, 32, 0}, false},
+		{"ok large arc", "2.999.1", asn1.ObjectIdentifier{2, 999, 1}, false},
+		{"fail empty", "", nil, true},
+		{"fail one arc", "2", nil, true},
+		{"fail empty arc", "2.23..1", nil, true},
+		{"fail trailing dot", "2.23.140.", nil, true},
+		{"fail letters", "2.23.abc", nil, true},
+		{"fail negative", "2.-23.140", nil, true},
+		{"fail plus", "2.+23.140", nil, true},
+		{"fail leading zero", "2.023.140", nil, true},
+		{"fail first arc", "3.23.140", nil, true},
+		{"fail second arc", "1.40.1", nil, true},
+		{"fail spaces", "2.23.140.1.2.1 ", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseObjectIdentifier(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseObjectIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_newCertificatePoliciesModifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		policyOIDs []string
+		cpsURI     string
+		wantNil    bool
+		wantErr    bool
+	}{
+		{"ok", []string{"2.23.140.1.2.1"}, "", false, false},
+		{"ok cps", []string{"2.23.140.1.2.1", "1.3.6.1.4.1.37476.9000.64.100"}, "https://ca.example.com/cps", false, false},
+		{"ok empty", nil, "", true, false},
+		{"fail cps without policies", nil, "https://ca.example.com/cps", true, true},
+		{"fail cps relative", []string{"2.23.140.1.2.1"}, "/cps", true, true},
+		{"fail cps not ascii", []string{"2.23.140.1.2.1"}, "https://ca.example.com/cpś", true, true},
+		{"fail oid", []string{"2.23.140.1.2.1", "not-an-oid"}, "", true, true},
+		{"fail duplicated oid", []string{"2.23.140.1.2.1", "2.23.140.1.2.1"}, "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newCertificatePoliciesModifier(tt.policyOIDs, tt.cpsURI)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newCertificatePoliciesModifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+		})
+	}
+}
+
+func Test_certificatePoliciesModifier_Modify(t *testing.T) {
+	m, err := newCertificatePoliciesModifier([]string{"2.23.140.1.2.1", "1.3.6.1.4.1.37476.9000.64.100"}, "https://ca.example.com/cps")
+	assert.FatalError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:      big.NewInt(1),
+		Subject:           pkix.Name{CommonName: "test.example.com"},
+		NotBefore:         time.Now(),
+		NotAfter:          time.Now().Add(time.Hour),
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionCertificatePolicies, Value: []byte{0x30, 0x00}},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 5}, Value: []byte{0x05, 0x00}},
+		},
+	}
+	assert.FatalError(t, m.Modify(tmpl, SignOptions{}))
+	assert.Len(t, 2, tmpl.ExtraExtensions)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	assert.Equals(t, []asn1.ObjectIdentifier{
+		{2, 23, 140, 1, 2, 1},
+		{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 100},
+	}, cert.PolicyIdentifiers)
+
+	var count int
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionCertificatePolicies) {
+			continue
+		}
+		count++
+		var policies []policyInformation
+		rest, err := asn1.Unmarshal(ext.Value, &policies)
+		assert.FatalError(t, err)
+		assert.Len(t, 0, rest)
+		assert.Equals(t, []policyInformation{
+			{PolicyIdentifier: asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, PolicyQualifiers: []policyQualifierInfo{
+				{PolicyQualifierID: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}, Qualifier: "https://ca.example.com/cps"},
+			}},
+			{PolicyIdentifier: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 100}, PolicyQualifiers: []policyQualifierInfo{
+				{PolicyQualifierID: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}, Qualifier: "https://ca.example.com/cps"},
+			}},
+		}, policies)
+	}
+	assert.Equals(t, 1, count)
+}
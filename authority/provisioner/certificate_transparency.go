@@ -0,0 +1,461 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidExtensionSCTList is the OID of the extension with the list of
+	// embedded SCTs defined in RFC 6962, section 3.3.
+	oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// oidExtensionCTPoison is the OID of the critical poison extension that
+	// identifies precertificates, defined in RFC 6962, section 3.1.
+	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+)
+
+// defaultCTSubmissionTimeout is the time to wait for the responses of the CT
+// logs if the provisioner does not configure it.
+const defaultCTSubmissionTimeout = 10 * time.Second
+
+// maxCTResponseSize is the maximum size of the response of a CT log.
+const maxCTResponseSize = 64 * 1024
+
+// CertificateTransparencyOptions configures the CT logs where the
+// precertificates of a provisioner are submitted.
+//
+// MinSCTs is the number of logs that must return a valid SCT, by default all
+// of them. Logs that fail, time out, or return an SCT that does not verify
+// with the log key count as failures. If fewer SCTs are obtained the
+// certificate is not signed, unless FailOpen is set, in which case it is
+// signed with the SCTs obtained, if any, and a warning is returned. Timeout is
+// the time to wait for the logs, 10 seconds by default.
+type CertificateTransparencyOptions struct {
+	Logs     []CTLog   `json:"logs"`
+	MinSCTs  int       `json:"minSCTs,omitempty"`
+	Timeout  *Duration `json:"timeout,omitempty"`
+	FailOpen bool      `json:"failOpen,omitempty"`
+}
+
+// CTLog is a certificate transparency log. URL is the base URL of the RFC 6962
+// API of the log, e.g. "https://ct.example.com/2026", and Key is the
+// DER-encoded public key of the log, encoded in base64 in the JSON
+// configuration, as it is published in the log lists.
+type CTLog struct {
+	URL string `json:"url"`
+	Key []byte `json:"key"`
+}
+
+// ctLog is a CT log ready to accept submissions.
+type ctLog struct {
+	url string
+	id  [sha256.Size]byte
+	key crypto.PublicKey
+}
+
+// X509CertificateTransparency is a SignOption with the CT logs of a
+// provisioner. The authority uses it to get the SCTs of the precertificates
+// and embed them in the certificates.
+type X509CertificateTransparency struct {
+	logs     []*ctLog
+	minSCTs  int
+	timeout  time.Duration
+	failOpen bool
+	client   *http.Client
+}
+
+// newCertificateTransparency validates the CT logs configured in the
+// provisioner. It returns nil if they are not configured.
+func newCertificateTransparency(o *CertificateTransparencyOptions) (*X509CertificateTransparency, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if len(o.Logs) == 0 {
+		return nil, errors.New("x509.certificateTransparency logs cannot be empty")
+	}
+
+	t := &X509CertificateTransparency{
+		logs:     make([]*ctLog, len(o.Logs)),
+		minSCTs:  o.MinSCTs,
+		timeout:  defaultCTSubmissionTimeout,
+		failOpen: o.FailOpen,
+		client:   http.DefaultClient,
+	}
+	seen := make(map[[sha256.Size]byte]bool, len(o.Logs))
+	for i, l := range o.Logs {
+		log, err := newCTLog(l)
+		if err != nil {
+			return nil, err
+		}
+		if seen[log.id] {
+			return nil, errors.Errorf("x509.certificateTransparency contains the duplicated log %q", l.URL)
+		}
+		seen[log.id] = true
+		t.logs[i] = log
+	}
+
+	switch {
+	case o.MinSCTs < 0:
+		return nil, errors.New("x509.certificateTransparency minSCTs cannot be negative")
+	case o.MinSCTs > len(o.Logs):
+		return nil, errors.Errorf("x509.certificateTransparency minSCTs cannot be greater than the %d logs", len(o.Logs))
+	case o.MinSCTs == 0:
+		t.minSCTs = len(o.Logs)
+	}
+	if o.Timeout != nil {
+		if o.Timeout.Duration <= 0 {
+			return nil, errors.New("x509.certificateTransparency timeout must be greater than 0")
+		}
+		t.timeout = o.Timeout.Duration
+	}
+	return t, nil
+}
+
+// newCTLog validates the URL and the key of a CT log.
+func newCTLog(l CTLog) (*ctLog, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "x509.certificateTransparency log url %q is not valid", l.URL)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, errors.Errorf("x509.certificateTransparency log url %q must be an http or https url without query", l.URL)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(l.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "x509.certificateTransparency key of log %q is not valid", l.URL)
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.Errorf("x509.certificateTransparency key of log %q must use the P-256 curve", l.URL)
+		}
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.Errorf("x509.certificateTransparency key of log %q must have at least 2048 bits", l.URL)
+		}
+	default:
+		return nil, errors.Errorf("x509.certificateTransparency key of log %q must be an ECDSA or RSA key", l.URL)
+	}
+
+	return &ctLog{
+		url: strings.TrimSuffix(u.String(), "/") + "/ct/v1/add-pre-chain",
+		id:  sha256.Sum256(l.Key),
+		key: key,
+	}, nil
+}
+
+// FailOpen returns true if the certificates can be signed without the SCTs
+// required by the provisioner.
+func (t *X509CertificateTransparency) FailOpen() bool {
+	return t.failOpen
+}
+
+// NewPrecertificate returns a copy of the given template with the poison
+// extension. Any SCT list or poison extension set by the template is removed
+// first, so the certificate signed with the SCTs matches the precertificate.
+func (t *X509CertificateTransparency) NewPrecertificate(cert *x509.Certificate) *x509.Certificate {
+	extensions := make([]pkix.Extension, 0, len(cert.ExtraExtensions))
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionSCTList) && !ext.Id.Equal(oidExtensionCTPoison) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.ExtraExtensions = extensions
+
+	precert := *cert
+	precert.ExtraExtensions = append(extensions[:len(extensions):len(extensions)], pkix.Extension{
+		Id:       oidExtensionCTPoison,
+		Critical: true,
+		Value:    asn1.NullBytes,
+	})
+	return &precert
+}
+
+// Submit submits the given precertificate chain to the CT logs and returns the
+// extension with the SCTs, in the order of the logs. It returns an error if
+// fewer SCTs than required are obtained; in that case the extension with the
+// SCTs obtained is returned too, or nil if there are none, so the certificate
+// can still be signed if the provisioner fails open.
+func (t *X509CertificateTransparency) Submit(ctx context.Context, chain []*x509.Certificate) (*pkix.Extension, error) {
+	if len(chain) < 2 {
+		return nil, errors.New("error submitting precertificate: chain does not contain the issuer")
+	}
+	tbs, err := removeTBSExtension(chain[0].RawTBSCertificate, oidExtensionCTPoison)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting precertificate")
+	}
+	issuerKeyHash := sha256.Sum256(chain[1].RawSubjectPublicKeyInfo)
+
+	req := struct {
+		Chain [][]byte `json:"chain"`
+	}{}
+	for _, crt := range chain {
+		req.Chain = append(req.Chain, crt.Raw)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling precertificate chain")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	type result struct {
+		sct []byte
+		err error
+	}
+	results := make([]result, len(t.logs))
+	var wg sync.WaitGroup
+	for i, l := range t.logs {
+		wg.Add(1)
+		go func(i int, l *ctLog) {
+			defer wg.Done()
+			results[i].sct, results[i].err = l.submit(ctx, t.client, body, issuerKeyHash, tbs)
+		}(i, l)
+	}
+	wg.Wait()
+
+	var scts [][]byte
+	var failures []string
+	for _, r := range results {
+		if r.err != nil {
+			failures = append(failures, r.err.Error())
+		} else {
+			scts = append(scts, r.sct)
+		}
+	}
+
+	var ext *pkix.Extension
+	if len(scts) > 0 {
+		if ext, err = newSCTListExtension(scts); err != nil {
+			return nil, err
+		}
+	}
+	if len(scts) < t.minSCTs {
+		return ext, errors.Errorf("certificate transparency logs returned %d of the %d required SCTs: %s",
+			len(scts), t.minSCTs, strings.Join(failures, "; "))
+	}
+	return ext, nil
+}
+
+// CheckPrecertificate checks that the given certificate is the precertificate
+// with the SCT list extension in place of the poison extension, so the SCTs
+// embedded in it are valid.
+func (t *X509CertificateTransparency) CheckPrecertificate(cert, precert *x509.Certificate) error {
+	got, err := removeTBSExtension(cert.RawTBSCertificate, oidExtensionSCTList)
+	if err != nil {
+		return err
+	}
+	want, err := removeTBSExtension(precert.RawTBSCertificate, oidExtensionCTPoison)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return errors.New("certificate does not match the precertificate submitted to the certificate transparency logs")
+	}
+	return nil
+}
+
+// ctAddChainResponse is the response of the add-pre-chain endpoint of a CT
+// log, defined in RFC 6962, section 4.1.
+type ctAddChainResponse struct {
+	SCTVersion uint8  `json:"sct_version"`
+	ID         []byte `json:"id"`
+	Timestamp  uint64 `json:"timestamp"`
+	Extensions []byte `json:"extensions"`
+	Signature  []byte `json:"signature"`
+}
+
+// submit sends the precertificate chain to the log and returns the serialized
+// SCT, after verifying its signature.
+func (l *ctLog) submit(ctx context.Context, client *http.Client, body []byte, issuerKeyHash [sha256.Size]byte, tbs []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to log %s", l.url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error submitting precertificate to log %s", l.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("log %s responded with status %d", l.url, resp.StatusCode)
+	}
+
+	var sct ctAddChainResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCTResponseSize)).Decode(&sct); err != nil {
+		return nil, errors.Wrapf(err, "error decoding response of log %s", l.url)
+	}
+	switch {
+	case sct.SCTVersion != 0:
+		return nil, errors.Errorf("log %s returned an SCT with the unsupported version %d", l.url, sct.SCTVersion)
+	case !bytes.Equal(sct.ID, l.id[:]):
+		return nil, errors.Errorf("log %s returned an SCT of another log", l.url)
+	case len(sct.Extensions) > 0xffff:
+		return nil, errors.Errorf("log %s returned an SCT with too many extensions", l.url)
+	}
+
+	signed := make([]byte, 0, 47+len(tbs)+len(sct.Extensions))
+	signed = append(signed, 0, 0) // v1, certificate_timestamp
+	signed = binary.BigEndian.AppendUint64(signed, sct.Timestamp)
+	signed = append(signed, 0, 1) // precert_entry
+	signed = append(signed, issuerKeyHash[:]...)
+	signed = append(signed, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+	signed = append(signed, tbs...)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(sct.Extensions)))
+	signed = append(signed, sct.Extensions...)
+	if err := l.verify(signed, sct.Signature); err != nil {
+		return nil, errors.Wrapf(err, "log %s returned an SCT that is not valid", l.url)
+	}
+
+	b := make([]byte, 0, 43+len(sct.Extensions)+len(sct.Signature))
+	b = append(b, sct.SCTVersion)
+	b = append(b, sct.ID...)
+	b = binary.BigEndian.AppendUint64(b, sct.Timestamp)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(sct.Extensions)))
+	b = append(b, sct.Extensions...)
+	b = append(b, sct.Signature...)
+	return b, nil
+}
+
+// verify verifies the TLS DigitallySigned structure of an SCT with the key of
+// the log. Logs sign with SHA-256 and ECDSA or RSA.
+func (l *ctLog) verify(signed, sig []byte) error {
+	if len(sig) < 4 || int(binary.BigEndian.Uint16(sig[2:4])) != len(sig)-4 {
+		return errors.New("signature is malformed")
+	}
+	if sig[0] != 4 { // sha256
+		return errors.Errorf("signature hash algorithm %d is not supported", sig[0])
+	}
+	digest := sha256.Sum256(signed)
+	switch k := l.key.(type) {
+	case *ecdsa.PublicKey:
+		if sig[1] != 3 || !ecdsa.VerifyASN1(k, digest[:], sig[4:]) {
+			return errors.New("signature does not verify")
+		}
+	case *rsa.PublicKey:
+		if sig[1] != 1 || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig[4:]) != nil {
+			return errors.New("signature does not verify")
+		}
+	default:
+		return errors.Errorf("unsupported key type %T", k)
+	}
+	return nil
+}
+
+// newSCTListExtension returns the extension with the TLS-encoded
+// SignedCertificateTimestampList with the given serialized SCTs.
+func newSCTListExtension(scts [][]byte) (*pkix.Extension, error) {
+	var list []byte
+	for _, sct := range scts {
+		list = binary.BigEndian.AppendUint16(list, uint16(len(sct)))
+		list = append(list, sct...)
+	}
+	if len(list) > 0xffff {
+		return nil, errors.New("error creating SCT list extension: SCTs are too large")
+	}
+	value, err := asn1.Marshal(append(binary.BigEndian.AppendUint16(nil, uint16(len(list))), list...))
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling SCT list extension")
+	}
+	return &pkix.Extension{
+		Id:    oidExtensionSCTList,
+		Value: value,
+	}, nil
+}
+
+// removeTBSExtension returns the DER-encoded TBSCertificate without the
+// extension with the given OID. The extensions field is removed if it does not
+// contain any other extension.
+func removeTBSExtension(tbs []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &seq); err != nil || len(rest) > 0 || seq.Tag != asn1.TagSequence {
+		return nil, errors.New("error parsing TBSCertificate")
+	}
+
+	var fields []byte
+	for b := seq.Bytes; len(b) > 0; {
+		var field asn1.RawValue
+		var err error
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return nil, errors.Wrap(err, "error parsing TBSCertificate")
+		}
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			fields = append(fields, field.FullBytes...)
+			continue
+		}
+
+		var exts asn1.RawValue
+		if rest, err := asn1.Unmarshal(field.Bytes, &exts); err != nil || len(rest) > 0 {
+			return nil, errors.New("error parsing TBSCertificate extensions")
+		}
+		var kept []byte
+		for e := exts.Bytes; len(e) > 0; {
+			var raw asn1.RawValue
+			if e, err = asn1.Unmarshal(e, &raw); err != nil {
+				return nil, errors.Wrap(err, "error parsing TBSCertificate extensions")
+			}
+			var ext pkix.Extension
+			if _, err := asn1.Unmarshal(raw.FullBytes, &ext); err != nil {
+				return nil, errors.Wrap(err, "error parsing TBSCertificate extensions")
+			}
+			if !ext.Id.Equal(oid) {
+				kept = append(kept, raw.FullBytes...)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		extensions, err := asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        3,
+			IsCompound: true,
+			Bytes:      marshalSequence(kept),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling TBSCertificate extensions")
+		}
+		fields = append(fields, extensions...)
+	}
+
+	return marshalSequence(fields), nil
+}
+
+// marshalSequence returns the DER encoding of a SEQUENCE with the given
+// DER-encoded elements.
+func marshalSequence(elements []byte) []byte {
+	var length []byte
+	switch n := len(elements); {
+	case n < 0x80:
+		length = []byte{byte(n)}
+	case n <= 0xff:
+		length = []byte{0x81, byte(n)}
+	case n <= 0xffff:
+		length = []byte{0x82, byte(n >> 8), byte(n)}
+	default:
+		length = []byte{0x83, byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	b := append([]byte{0x30}, length...)
+	return append(b, elements...)
+}
@@ -0,0 +1,460 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/minica"
+)
+
+// ctLogStub is a CT log that implements the add-pre-chain endpoint of RFC
+// 6962.
+type ctLogStub struct {
+	*httptest.Server
+	signer    *ecdsa.PrivateKey
+	key       []byte
+	status    int
+	delay     time.Duration
+	badSig    bool
+	submitted []*x509.Certificate
+}
+
+func newCTLogStub(t *testing.T) *ctLogStub {
+	t.Helper()
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	key, err := x509.MarshalPKIXPublicKey(signer.Public())
+	assert.FatalError(t, err)
+
+	l := &ctLogStub{signer: signer, key: key, status: http.StatusOK}
+	l.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/log/ct/v1/add-pre-chain" {
+			http.NotFound(w, r)
+			return
+		}
+		if l.delay > 0 {
+			select {
+			case <-time.After(l.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if l.status != http.StatusOK {
+			w.WriteHeader(l.status)
+			return
+		}
+
+		var req struct {
+			Chain [][]byte `json:"chain"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Chain) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		precert, err := x509.ParseCertificate(req.Chain[0])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		issuer, err := x509.ParseCertificate(req.Chain[1])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tbs, err := removeTBSExtension(precert.RawTBSCertificate, oidExtensionCTPoison)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		l.submitted = append(l.submitted, precert)
+
+		timestamp := uint64(time.Now().UnixMilli())
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		signed := []byte{0, 0}
+		signed = binary.BigEndian.AppendUint64(signed, timestamp)
+		signed = append(signed, 0, 1)
+		signed = append(signed, issuerKeyHash[:]...)
+		signed = append(signed, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+		signed = append(signed, tbs...)
+		signed = append(signed, 0, 0)
+		if l.badSig {
+			signed[0] = 1
+		}
+		digest := sha256.Sum256(signed)
+		sig, err := ecdsa.SignASN1(rand.Reader, l.signer, digest[:])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		id := sha256.Sum256(l.key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"sct_version": 0,
+			"id":          id[:],
+			"timestamp":   timestamp,
+			"extensions":  "",
+			"signature":   append([]byte{4, 3, byte(len(sig) >> 8), byte(len(sig))}, sig...),
+		})
+	}))
+	t.Cleanup(l.Close)
+	return l
+}
+
+func (l *ctLogStub) Log() CTLog {
+	return CTLog{URL: l.URL + "/log/", Key: l.key}
+}
+
+func TestCertificateTransparencyOptions_JSON(t *testing.T) {
+	var o X509Options
+	assert.FatalError(t, json.Unmarshal([]byte(`{"certificateTransparency": {
+		"logs": [{"url": "https://ct.example.com/2026", "key": "AQID"}],
+		"minSCTs": 1, "timeout": "5s", "failOpen": true
+	}}`), &o))
+	assert.Equals(t, &CertificateTransparencyOptions{
+		Logs:     []CTLog{{URL: "https://ct.example.com/2026", Key: []byte{1, 2, 3}}},
+		MinSCTs:  1,
+		Timeout:  &Duration{Duration: 5 * time.Second},
+		FailOpen: true,
+	}, o.GetCertificateTransparency())
+}
+
+func Test_newCertificateTransparency(t *testing.T) {
+	ecKey := func(curve elliptic.Curve) []byte {
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.FatalError(t, err)
+		b, err := x509.MarshalPKIXPublicKey(k.Public())
+		assert.FatalError(t, err)
+		return b
+	}
+	rsaKey := func(bits int) []byte {
+		k, err := rsa.GenerateKey(rand.Reader, bits)
+		assert.FatalError(t, err)
+		b, err := x509.MarshalPKIXPublicKey(k.Public())
+		assert.FatalError(t, err)
+		return b
+	}
+	key1, key2 := ecKey(elliptic.P256()), rsaKey(2048)
+	logs := []CTLog{
+		{URL: "https://ct1.example.com/2026", Key: key1},
+		{URL: "https://ct2.example.com/2026/", Key: key2},
+	}
+
+	tests := []struct {
+		name        string
+		options     *CertificateTransparencyOptions
+		wantNil     bool
+		wantMinSCTs int
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{"ok nil", nil, true, 0, 0, false},
+		{"ok", &CertificateTransparencyOptions{Logs: logs}, false, 2, defaultCTSubmissionTimeout, false},
+		{"ok minSCTs", &CertificateTransparencyOptions{Logs: logs, MinSCTs: 1}, false, 1, defaultCTSubmissionTimeout, false},
+		{"ok timeout", &CertificateTransparencyOptions{Logs: logs, Timeout: &Duration{Duration: time.Second}}, false, 2, time.Second, false},
+		{"ok http", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "http://localhost:8080", Key: key1}}}, false, 1, defaultCTSubmissionTimeout, false},
+		{"fail no logs", &CertificateTransparencyOptions{}, true, 0, 0, true},
+		{"fail url", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "https://ct.example.com:port", Key: key1}}}, true, 0, 0, true},
+		{"fail url scheme", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "ftp://ct.example.com", Key: key1}}}, true, 0, 0, true},
+		{"fail url relative", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "/2026", Key: key1}}}, true, 0, 0, true},
+		{"fail url query", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "https://ct.example.com/?log=2026", Key: key1}}}, true, 0, 0, true},
+		{"fail key", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "https://ct.example.com", Key: []byte("key")}}}, true, 0, 0, true},
+		{"fail key curve", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "https://ct.example.com", Key: ecKey(elliptic.P384())}}}, true, 0, 0, true},
+		{"fail key size", &CertificateTransparencyOptions{Logs: []CTLog{{URL: "https://ct.example.com", Key: rsaKey(1024)}}}, true, 0, 0, true},
+		{"fail duplicated log", &CertificateTransparencyOptions{Logs: []CTLog{logs[0], {URL: "https://ct3.example.com", Key: key1}}}, true, 0, 0, true},
+		{"fail minSCTs negative", &CertificateTransparencyOptions{Logs: logs, MinSCTs: -1}, true, 0, 0, true},
+		{"fail minSCTs too large", &CertificateTransparencyOptions{Logs: logs, MinSCTs: 3}, true, 0, 0, true},
+		{"fail timeout", &CertificateTransparencyOptions{Logs: logs, Timeout: &Duration{}}, true, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newCertificateTransparency(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newCertificateTransparency() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+			if got != nil {
+				assert.Equals(t, tt.wantMinSCTs, got.minSCTs)
+				assert.Equals(t, tt.wantTimeout, got.timeout)
+			}
+		})
+	}
+
+	got, err := newCertificateTransparency(&CertificateTransparencyOptions{Logs: logs})
+	assert.FatalError(t, err)
+	assert.Equals(t, "https://ct1.example.com/2026/ct/v1/add-pre-chain", got.logs[0].url)
+	assert.Equals(t, "https://ct2.example.com/2026/ct/v1/add-pre-chain", got.logs[1].url)
+	assert.Equals(t, sha256.Sum256(key2), got.logs[1].id)
+}
+
+// signWithSCTs signs a precertificate of the template, submits it to the logs,
+// and signs the final certificate with the SCTs, like the authority does.
+func signWithSCTs(t *testing.T, ct *X509CertificateTransparency, ca *minica.CA, template *x509.Certificate) (*x509.Certificate, *x509.Certificate, error) {
+	t.Helper()
+	precert, err := ca.Sign(ct.NewPrecertificate(template))
+	assert.FatalError(t, err)
+	ext, err := ct.Submit(context.Background(), []*x509.Certificate{precert, ca.Intermediate, ca.Root})
+	if ext != nil {
+		template.ExtraExtensions = append(template.ExtraExtensions, *ext)
+	}
+	cert, signErr := ca.Sign(template)
+	assert.FatalError(t, signErr)
+	return cert, precert, err
+}
+
+// parseSCTList returns the SCTs embedded in the certificate.
+func parseSCTList(t *testing.T, cert *x509.Certificate) [][]byte {
+	t.Helper()
+	var scts [][]byte
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionSCTList) {
+			continue
+		}
+		var list []byte
+		rest, err := asn1.Unmarshal(ext.Value, &list)
+		assert.FatalError(t, err)
+		assert.Len(t, 0, rest)
+		assert.Equals(t, int(binary.BigEndian.Uint16(list)), len(list)-2)
+		for b := list[2:]; len(b) > 0; {
+			n := int(binary.BigEndian.Uint16(b))
+			scts = append(scts, b[2:2+n])
+			b = b[2+n:]
+		}
+	}
+	return scts
+}
+
+// verifySCT verifies a serialized SCT embedded in the certificate with the key
+// of the log.
+func verifySCT(t *testing.T, sct []byte, cert, issuer *x509.Certificate, log *ctLogStub) {
+	t.Helper()
+	id := sha256.Sum256(log.key)
+	assert.Equals(t, byte(0), sct[0])
+	assert.Equals(t, id[:], sct[1:33])
+	assert.Equals(t, []byte{0, 0}, sct[41:43])
+	assert.Equals(t, []byte{4, 3}, sct[43:45])
+
+	tbs, err := removeTBSExtension(cert.RawTBSCertificate, oidExtensionSCTList)
+	assert.FatalError(t, err)
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	signed := []byte{0, 0}
+	signed = append(signed, sct[33:41]...)
+	signed = append(signed, 0, 1)
+	signed = append(signed, issuerKeyHash[:]...)
+	signed = append(signed, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+	signed = append(signed, tbs...)
+	signed = append(signed, 0, 0)
+	digest := sha256.Sum256(signed)
+	assert.True(t, ecdsa.VerifyASN1(&log.signer.PublicKey, digest[:], sct[47:]))
+}
+
+func TestX509CertificateTransparency_Submit(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	newTemplate := func() *x509.Certificate {
+		now := time.Now().Truncate(time.Second)
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(1234),
+			Subject:      pkix.Name{CommonName: "test.example.com"},
+			DNSNames:     []string{"test.example.com"},
+			PublicKey:    signer.Public(),
+			NotBefore:    now,
+			NotAfter:     now.Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+
+	log1, log2, failing, slow, badSig := newCTLogStub(t), newCTLogStub(t), newCTLogStub(t), newCTLogStub(t), newCTLogStub(t)
+	failing.status = http.StatusServiceUnavailable
+	slow.delay = time.Second
+	badSig.badSig = true
+
+	newCT := func(o *CertificateTransparencyOptions) *X509CertificateTransparency {
+		ct, err := newCertificateTransparency(o)
+		assert.FatalError(t, err)
+		return ct
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{log1.Log(), log2.Log()}})
+		cert, precert, err := signWithSCTs(t, ct, ca, newTemplate())
+		assert.FatalError(t, err)
+		assert.FatalError(t, ct.CheckPrecertificate(cert, precert))
+
+		// The precertificate is poisoned, the certificate is not.
+		assert.Len(t, 1, precert.UnhandledCriticalExtensions)
+		assert.Equals(t, oidExtensionCTPoison, precert.UnhandledCriticalExtensions[0])
+		assert.Len(t, 0, cert.UnhandledCriticalExtensions)
+		assert.Equals(t, precert.Raw, log1.submitted[len(log1.submitted)-1].Raw)
+
+		scts := parseSCTList(t, cert)
+		if assert.Len(t, 2, scts) {
+			verifySCT(t, scts[0], cert, ca.Intermediate, log1)
+			verifySCT(t, scts[1], cert, ca.Intermediate, log2)
+		}
+	})
+
+	t.Run("ok template extensions", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{log1.Log()}})
+		template := newTemplate()
+		template.ExtraExtensions = []pkix.Extension{
+			{Id: oidExtensionSCTList, Value: []byte{0x04, 0x00}},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: asn1.NullBytes},
+		}
+		cert, precert, err := signWithSCTs(t, ct, ca, template)
+		assert.FatalError(t, err)
+		assert.FatalError(t, ct.CheckPrecertificate(cert, precert))
+		if scts := parseSCTList(t, cert); assert.Len(t, 1, scts) {
+			verifySCT(t, scts[0], cert, ca.Intermediate, log1)
+		}
+	})
+
+	t.Run("ok minSCTs", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{failing.Log(), log1.Log(), badSig.Log()}, MinSCTs: 1})
+		cert, precert, err := signWithSCTs(t, ct, ca, newTemplate())
+		assert.FatalError(t, err)
+		assert.FatalError(t, ct.CheckPrecertificate(cert, precert))
+		if scts := parseSCTList(t, cert); assert.Len(t, 1, scts) {
+			verifySCT(t, scts[0], cert, ca.Intermediate, log1)
+		}
+	})
+
+	t.Run("fail policy", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{log1.Log(), failing.Log(), badSig.Log()}, MinSCTs: 2})
+		cert, precert, err := signWithSCTs(t, ct, ca, newTemplate())
+		if assert.Error(t, err) {
+			assert.HasPrefix(t, err.Error(), "certificate transparency logs returned 1 of the 2 required SCTs: ")
+			assert.True(t, strings.Contains(err.Error(), "responded with status 503"))
+			assert.True(t, strings.Contains(err.Error(), "returned an SCT that is not valid"))
+		}
+		// The SCTs obtained are returned for the provisioners that fail open.
+		assert.FatalError(t, ct.CheckPrecertificate(cert, precert))
+		assert.Len(t, 1, parseSCTList(t, cert))
+	})
+
+	t.Run("fail timeout", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{slow.Log()}, Timeout: &Duration{Duration: 100 * time.Millisecond}})
+		cert, _, err := signWithSCTs(t, ct, ca, newTemplate())
+		if assert.Error(t, err) {
+			assert.True(t, strings.Contains(err.Error(), "context deadline exceeded"))
+		}
+		assert.Len(t, 0, parseSCTList(t, cert))
+	})
+
+	t.Run("fail chain", func(t *testing.T) {
+		ct := newCT(&CertificateTransparencyOptions{Logs: []CTLog{log1.Log()}})
+		_, err := ct.Submit(context.Background(), []*x509.Certificate{ca.Intermediate})
+		assert.Error(t, err)
+	})
+}
+
+func TestX509CertificateTransparency_CheckPrecertificate(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		PublicKey:    signer.Public(),
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}
+
+	ct := new(X509CertificateTransparency)
+	precert, err := ca.Sign(ct.NewPrecertificate(template))
+	assert.FatalError(t, err)
+	cert, err := ca.Sign(template)
+	assert.FatalError(t, err)
+	assert.NoError(t, ct.CheckPrecertificate(cert, precert))
+
+	template.SerialNumber = big.NewInt(4321)
+	other, err := ca.Sign(template)
+	assert.FatalError(t, err)
+	assert.Error(t, ct.CheckPrecertificate(other, precert))
+}
+
+func Test_removeTBSExtension(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	// Without any other extension the extensions field is removed.
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: oidExtensionCTPoison, Critical: true, Value: asn1.NullBytes}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	assert.FatalError(t, err)
+	poisoned, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	tbs, err := removeTBSExtension(poisoned.RawTBSCertificate, oidExtensionCTPoison)
+	assert.FatalError(t, err)
+
+	var got struct {
+		Version            int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber       *big.Int
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Issuer             asn1.RawValue
+		Validity           asn1.RawValue
+		Subject            asn1.RawValue
+		PublicKey          asn1.RawValue
+		Extensions         []pkix.Extension `asn1:"omitempty,optional,explicit,tag:3"`
+	}
+	rest, err := asn1.Unmarshal(tbs, &got)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, rest)
+	assert.Equals(t, big.NewInt(1), got.SerialNumber)
+	assert.Len(t, 0, got.Extensions)
+
+	// Other extensions are kept in order.
+	tbs, err = removeTBSExtension(ca.Intermediate.RawTBSCertificate, oidExtensionCTPoison)
+	assert.FatalError(t, err)
+	assert.Equals(t, ca.Intermediate.RawTBSCertificate, tbs)
+
+	_, err = removeTBSExtension([]byte("not a certificate"), oidExtensionCTPoison)
+	assert.Error(t, err)
+}
+
+func Test_ctLog_verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	data := []byte("signed data")
+	digest := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	assert.FatalError(t, err)
+	digitallySigned := append([]byte{4, 1, byte(len(sig) >> 8), byte(len(sig))}, sig...)
+
+	l := &ctLog{key: rsaKey.Public()}
+	assert.NoError(t, l.verify(data, digitallySigned))
+	assert.Error(t, l.verify([]byte("other data"), digitallySigned))
+	assert.Error(t, l.verify(data, append([]byte{4, 3}, digitallySigned[2:]...)))
+	assert.Error(t, l.verify(data, append([]byte{2, 1}, digitallySigned[2:]...)))
+	assert.Error(t, l.verify(data, digitallySigned[:len(digitallySigned)-1]))
+	assert.Error(t, l.verify(data, []byte{4, 1}))
+}
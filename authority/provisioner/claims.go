@@ -13,6 +13,20 @@ type Claims struct {
 	MinTLSDur     *Duration `json:"minTLSCertDuration,omitempty"`
 	MaxTLSDur     *Duration `json:"maxTLSCertDuration,omitempty"`
 	DefaultTLSDur *Duration `json:"defaultTLSCertDuration,omitempty"`
+	// ClampTLSCertDuration shortens the validity of certificates requested
+	// with a duration greater than MaxTLSDur instead of rejecting them.
+	ClampTLSCertDuration *bool `json:"clampTLSCertDuration,omitempty"`
+	// MaxTLSNotBeforeOffset is the maximum time in the future that can be
+	// requested as the notBefore of a certificate. A zero value does not limit
+	// it.
+	MaxTLSNotBeforeOffset *Duration `json:"maxTLSCertNotBeforeOffset,omitempty"`
+	// MaxTLSBackdate is the maximum time in the past that can be requested as
+	// the notBefore of a certificate. A zero value does not limit it.
+	MaxTLSBackdate *Duration `json:"maxTLSCertBackdate,omitempty"`
+	// TLSBackdate is the time the notBefore of the certificates is set in the
+	// past to tolerate clients with clock skew. If it is not set, the backdate
+	// of the authority is used.
+	TLSBackdate *Duration `json:"tlsCertBackdate,omitempty"`
 
 	// SSH CA properties
 	MinUserSSHDur     *Duration `json:"minUserSSHCertDuration,omitempty"`
@@ -21,16 +35,70 @@ type Claims struct {
 	MinHostSSHDur     *Duration `json:"minHostSSHCertDuration,omitempty"`
 	MaxHostSSHDur     *Duration `json:"maxHostSSHCertDuration,omitempty"`
 	DefaultHostSSHDur *Duration `json:"defaultHostSSHCertDuration,omitempty"`
-	EnableSSHCA       *bool     `json:"enableSSHCA,omitempty"`
+	// MinSSHDur, MaxSSHDur and DefaultSSHDur are the durations of both the
+	// user and host SSH certificates. The durations for a certificate type
+	// take precedence over them. They are independent of the TLS durations.
+	MinSSHDur     *Duration `json:"minSSHCertDuration,omitempty"`
+	MaxSSHDur     *Duration `json:"maxSSHCertDuration,omitempty"`
+	DefaultSSHDur *Duration `json:"defaultSSHCertDuration,omitempty"`
+	EnableSSHCA   *bool     `json:"enableSSHCA,omitempty"`
 
 	// Renewal properties
-	DisableRenewal          *bool `json:"disableRenewal,omitempty"`
-	AllowRenewalAfterExpiry *bool `json:"allowRenewalAfterExpiry,omitempty"`
+	DisableRenewal          *bool     `json:"disableRenewal,omitempty"`
+	AllowRenewalAfterExpiry *bool     `json:"allowRenewalAfterExpiry,omitempty"`
+	MinRenewalTLSDur        *Duration `json:"minRenewalTLSCertDuration,omitempty"`
+	MaxRenewalTLSDur        *Duration `json:"maxRenewalTLSCertDuration,omitempty"`
+	// RenewalGracePeriod is the time after the expiration of a certificate
+	// during which it can still be renewed. A zero value does not allow the
+	// renewal of expired certificates unless AllowRenewalAfterExpiry is set.
+	RenewalGracePeriod *Duration `json:"renewalGracePeriod,omitempty"`
+	// MaxRenewalChainDur is the maximum time, counted from the notBefore of
+	// the first certificate, during which a chain of renewals is allowed.
+	// After it, a new certificate must be requested. A zero value disables
+	// the limit.
+	MaxRenewalChainDur *Duration `json:"maxRenewalChainDuration,omitempty"`
+	// SerializeRenewals allows only one renewal of a certificate at a time.
+	// Concurrent renewals of the same certificate fail with a conflict error,
+	// and retries within a minute of a renewal get the renewed certificate.
+	SerializeRenewals *bool `json:"serializeRenewals,omitempty"`
+	// MaxRenewals is the maximum number of times a chain of renewals can be
+	// renewed. After it, a new certificate must be requested. A value of 0 or
+	// less disables the limit. The renewals are counted in a Smallstep
+	// extension, so it cannot be used with DisableSmallstepExtensions.
+	MaxRenewals *int `json:"maxRenewals,omitempty"`
+
+	// CSR properties
+	// MaxCSRExtensions is the maximum number of extensions in a certificate
+	// request. A value of 0 or less disables the limit.
+	MaxCSRExtensions *int `json:"maxCSRExtensions,omitempty"`
+	// MaxCSRAttributesSize is the maximum size in bytes of the attributes of a
+	// certificate request, including the requested extensions. A value of 0 or
+	// less disables the limit.
+	MaxCSRAttributesSize *int `json:"maxCSRAttributesSize,omitempty"`
+	// MaxSANs is the maximum number of DNS, IP, email and URI subject
+	// alternative names in a certificate request. A value of 0 or less
+	// disables the limit.
+	MaxSANs *int `json:"maxSANs,omitempty"`
+	// MaxSANLength is the maximum length in characters of a subject
+	// alternative name in a certificate request. A value of 0 or less disables
+	// the limit.
+	MaxSANLength *int `json:"maxSANLength,omitempty"`
+
+	// Issuance properties
+	// Freeze temporarily disables the issuance of certificates, and optionally
+	// their renewal.
+	Freeze *Freeze `json:"freeze,omitempty"`
 
 	// Other properties
 	DisableSmallstepExtensions *bool `json:"disableSmallstepExtensions,omitempty"`
 }
 
+// ClaimerGetter is the interface implemented by provisioners that expose the
+// claimer used to control their certificates.
+type ClaimerGetter interface {
+	GetClaimer() *Claimer
+}
+
 // Claimer is the type that controls claims. It provides an interface around the
 // current claim and the global one.
 type Claimer struct {
@@ -51,11 +119,37 @@ func (c *Claimer) Claims() Claims {
 	allowRenewalAfterExpiry := c.AllowRenewalAfterExpiry()
 	enableSSHCA := c.IsSSHCAEnabled()
 	disableSmallstepExtensions := c.IsDisableSmallstepExtensions()
+	clampTLSCertDuration := c.ClampTLSCertDuration()
+	serializeRenewals := c.IsRenewalSerialized()
+	maxRenewals := c.MaxRenewals()
+	maxCSRExtensions := c.MaxCSRExtensions()
+	maxCSRAttributesSize := c.MaxCSRAttributesSize()
+	maxSANs := c.MaxSANs()
+	maxSANLength := c.MaxSANLength()
+
+	var tlsBackdate *Duration
+	if d, ok := c.TLSBackdate(); ok {
+		tlsBackdate = &Duration{d}
+	}
+
+	// The default depends on the claims of each provisioner.
+	var minRenewalTLSDur *Duration
+	if d, ok := c.minRenewalTLSCertDuration(); ok {
+		minRenewalTLSDur = &Duration{d}
+	}
 
 	return Claims{
 		MinTLSDur:                  &Duration{c.MinTLSCertDuration()},
 		MaxTLSDur:                  &Duration{c.MaxTLSCertDuration()},
 		DefaultTLSDur:              &Duration{c.DefaultTLSCertDuration()},
+		MinRenewalTLSDur:           minRenewalTLSDur,
+		MaxRenewalTLSDur:           &Duration{c.MaxRenewalTLSCertDuration()},
+		MaxRenewalChainDur:         &Duration{c.MaxRenewalChainDuration()},
+		RenewalGracePeriod:         &Duration{c.RenewalGracePeriod()},
+		ClampTLSCertDuration:       &clampTLSCertDuration,
+		MaxTLSNotBeforeOffset:      &Duration{c.MaxTLSNotBeforeOffset()},
+		MaxTLSBackdate:             &Duration{c.MaxTLSBackdate()},
+		TLSBackdate:                tlsBackdate,
 		MinUserSSHDur:              &Duration{c.MinUserSSHCertDuration()},
 		MaxUserSSHDur:              &Duration{c.MaxUserSSHCertDuration()},
 		DefaultUserSSHDur:          &Duration{c.DefaultUserSSHCertDuration()},
@@ -65,6 +159,13 @@ func (c *Claimer) Claims() Claims {
 		EnableSSHCA:                &enableSSHCA,
 		DisableRenewal:             &disableRenewal,
 		AllowRenewalAfterExpiry:    &allowRenewalAfterExpiry,
+		SerializeRenewals:          &serializeRenewals,
+		MaxRenewals:                &maxRenewals,
+		MaxCSRExtensions:           &maxCSRExtensions,
+		MaxCSRAttributesSize:       &maxCSRAttributesSize,
+		MaxSANs:                    &maxSANs,
+		MaxSANLength:               &maxSANLength,
+		Freeze:                     c.Freeze(),
 		DisableSmallstepExtensions: &disableSmallstepExtensions,
 	}
 }
@@ -105,6 +206,221 @@ func (c *Claimer) MaxTLSCertDuration() time.Duration {
 	return c.claims.MaxTLSDur.Duration
 }
 
+// MinRenewalTLSCertDuration returns the minimum validity, counted from the
+// time of the renewal, that a renewed TLS certificate will get. If it is not
+// set within the provisioner, then the global value from the authority
+// configuration will be used. If neither is set, the minimum TLS certificate
+// duration is used, limited by the maximum renewal duration, so a certificate
+// renewed close to its expiration is not issued with a few seconds of
+// validity. A zero value keeps the validity of the renewed certificate.
+func (c *Claimer) MinRenewalTLSCertDuration() time.Duration {
+	if d, ok := c.minRenewalTLSCertDuration(); ok {
+		return d
+	}
+	d := c.MinTLSCertDuration()
+	if max := c.MaxRenewalTLSCertDuration(); max > 0 && max < d {
+		d = max
+	}
+	return d
+}
+
+// minRenewalTLSCertDuration returns the minimum renewal duration and true if
+// it is set within the provisioner or the global configuration.
+func (c *Claimer) minRenewalTLSCertDuration() (time.Duration, bool) {
+	if c.claims == nil || c.claims.MinRenewalTLSDur == nil {
+		if c.global.MinRenewalTLSDur == nil {
+			return 0, false
+		}
+		return c.global.MinRenewalTLSDur.Duration, true
+	}
+	return c.claims.MinRenewalTLSDur.Duration, true
+}
+
+// MaxRenewalChainDuration returns the maximum time, counted from the notBefore
+// of the first certificate, during which a certificate can be renewed. If it
+// is not set within the provisioner, then the global value from the authority
+// configuration will be used. A zero value does not limit the renewals.
+func (c *Claimer) MaxRenewalChainDuration() time.Duration {
+	if c.claims == nil || c.claims.MaxRenewalChainDur == nil {
+		if c.global.MaxRenewalChainDur == nil {
+			return 0
+		}
+		return c.global.MaxRenewalChainDur.Duration
+	}
+	return c.claims.MaxRenewalChainDur.Duration
+}
+
+// RenewalGracePeriod returns the time after the expiration of a certificate
+// during which it can still be renewed. If it is not set within the
+// provisioner, then the global value from the authority configuration will be
+// used. A zero value does not allow the renewal of expired certificates.
+func (c *Claimer) RenewalGracePeriod() time.Duration {
+	if c.claims == nil || c.claims.RenewalGracePeriod == nil {
+		if c.global.RenewalGracePeriod == nil {
+			return 0
+		}
+		return c.global.RenewalGracePeriod.Duration
+	}
+	return c.claims.RenewalGracePeriod.Duration
+}
+
+// MaxRenewalTLSCertDuration returns the maximum validity that a renewed TLS
+// certificate will get. If it is not set within the provisioner, then the
+// global value from the authority configuration will be used. A zero value
+// keeps the validity of the renewed certificate.
+func (c *Claimer) MaxRenewalTLSCertDuration() time.Duration {
+	if c.claims == nil || c.claims.MaxRenewalTLSDur == nil {
+		if c.global.MaxRenewalTLSDur == nil {
+			return 0
+		}
+		return c.global.MaxRenewalTLSDur.Duration
+	}
+	return c.claims.MaxRenewalTLSDur.Duration
+}
+
+// MaxTLSNotBeforeOffset returns the maximum time in the future that can be
+// requested as the notBefore of a TLS certificate. If it is not set within the
+// provisioner, then the global value from the authority configuration will be
+// used. A zero value does not limit the notBefore.
+func (c *Claimer) MaxTLSNotBeforeOffset() time.Duration {
+	if c.claims == nil || c.claims.MaxTLSNotBeforeOffset == nil {
+		if c.global.MaxTLSNotBeforeOffset == nil {
+			return 0
+		}
+		return c.global.MaxTLSNotBeforeOffset.Duration
+	}
+	return c.claims.MaxTLSNotBeforeOffset.Duration
+}
+
+// MaxTLSBackdate returns the maximum time in the past that can be requested as
+// the notBefore of a TLS certificate. If it is not set within the provisioner,
+// then the global value from the authority configuration will be used. A zero
+// value does not limit the notBefore.
+func (c *Claimer) MaxTLSBackdate() time.Duration {
+	if c.claims == nil || c.claims.MaxTLSBackdate == nil {
+		if c.global.MaxTLSBackdate == nil {
+			return 0
+		}
+		return c.global.MaxTLSBackdate.Duration
+	}
+	return c.claims.MaxTLSBackdate.Duration
+}
+
+// TLSBackdate returns the time the notBefore of a TLS certificate is set in the
+// past, and true if it is set within the provisioner or the global
+// configuration. If it is not set, the backdate of the authority is used.
+func (c *Claimer) TLSBackdate() (time.Duration, bool) {
+	if c.claims == nil || c.claims.TLSBackdate == nil {
+		if c.global.TLSBackdate == nil {
+			return 0, false
+		}
+		return c.global.TLSBackdate.Duration, true
+	}
+	return c.claims.TLSBackdate.Duration, true
+}
+
+// ClampTLSCertDuration returns if the duration of a TLS certificate greater
+// than the maximum is shortened to the maximum instead of being rejected. If
+// it is not set within the provisioner, then the global value from the
+// authority configuration will be used. Defaults to false.
+func (c *Claimer) ClampTLSCertDuration() bool {
+	if c.claims == nil || c.claims.ClampTLSCertDuration == nil {
+		return c.global.ClampTLSCertDuration != nil && *c.global.ClampTLSCertDuration
+	}
+	return *c.claims.ClampTLSCertDuration
+}
+
+// IsRenewalSerialized returns if a certificate can only be renewed once at a
+// time, so concurrent renewals of the same certificate fail. If it is not set within
+// the provisioner, then the global value from the authority configuration will
+// be used. Defaults to false.
+func (c *Claimer) IsRenewalSerialized() bool {
+	if c.claims == nil || c.claims.SerializeRenewals == nil {
+		return c.global.SerializeRenewals != nil && *c.global.SerializeRenewals
+	}
+	return *c.claims.SerializeRenewals
+}
+
+// MaxRenewals returns the maximum number of times a chain of renewals can be
+// renewed. If it is not set within the provisioner, then the global value from
+// the authority configuration will be used. A value of 0 or less disables the
+// limit.
+func (c *Claimer) MaxRenewals() int {
+	if c.claims == nil || c.claims.MaxRenewals == nil {
+		if c.global.MaxRenewals == nil {
+			return 0
+		}
+		return *c.global.MaxRenewals
+	}
+	return *c.claims.MaxRenewals
+}
+
+// MaxCSRExtensions returns the maximum number of extensions in a certificate
+// request. If it is not set within the provisioner, then the global value from
+// the authority configuration will be used. Defaults to
+// DefaultMaxCSRExtensions.
+func (c *Claimer) MaxCSRExtensions() int {
+	if c.claims == nil || c.claims.MaxCSRExtensions == nil {
+		if c.global.MaxCSRExtensions == nil {
+			return DefaultMaxCSRExtensions
+		}
+		return *c.global.MaxCSRExtensions
+	}
+	return *c.claims.MaxCSRExtensions
+}
+
+// MaxCSRAttributesSize returns the maximum size in bytes of the attributes of
+// a certificate request. If it is not set within the provisioner, then the
+// global value from the authority configuration will be used. Defaults to
+// DefaultMaxCSRAttributesSize.
+func (c *Claimer) MaxCSRAttributesSize() int {
+	if c.claims == nil || c.claims.MaxCSRAttributesSize == nil {
+		if c.global.MaxCSRAttributesSize == nil {
+			return DefaultMaxCSRAttributesSize
+		}
+		return *c.global.MaxCSRAttributesSize
+	}
+	return *c.claims.MaxCSRAttributesSize
+}
+
+// MaxSANs returns the maximum number of subject alternative names in a
+// certificate request. If it is not set within the provisioner, then the global
+// value from the authority configuration will be used. Defaults to
+// DefaultMaxSANs.
+func (c *Claimer) MaxSANs() int {
+	if c.claims == nil || c.claims.MaxSANs == nil {
+		if c.global.MaxSANs == nil {
+			return DefaultMaxSANs
+		}
+		return *c.global.MaxSANs
+	}
+	return *c.claims.MaxSANs
+}
+
+// MaxSANLength returns the maximum length of a subject alternative name in a
+// certificate request. If it is not set within the provisioner, then the global
+// value from the authority configuration will be used. Defaults to
+// DefaultMaxSANLength.
+func (c *Claimer) MaxSANLength() int {
+	if c.claims == nil || c.claims.MaxSANLength == nil {
+		if c.global.MaxSANLength == nil {
+			return DefaultMaxSANLength
+		}
+		return *c.global.MaxSANLength
+	}
+	return *c.claims.MaxSANLength
+}
+
+// Freeze returns the freeze of the issuance of certificates. If it is not set
+// within the provisioner, then the global value from the authority
+// configuration will be used. It returns nil if the issuance is not frozen.
+func (c *Claimer) Freeze() *Freeze {
+	if c.claims == nil || c.claims.Freeze == nil {
+		return c.global.Freeze
+	}
+	return c.claims.Freeze
+}
+
 // IsDisableRenewal returns if the renewal flow is disabled for the
 // provisioner. If the property is not set within the provisioner, then the
 // global value from the authority configuration will be used.
@@ -119,7 +435,7 @@ func (c *Claimer) IsDisableRenewal() bool {
 // the provisioner extension, should be excluded from the certificate.
 func (c *Claimer) IsDisableSmallstepExtensions() bool {
 	if c.claims == nil || c.claims.DisableSmallstepExtensions == nil {
-		return *c.global.DisableSmallstepExtensions
+		return c.global.DisableSmallstepExtensions != nil && *c.global.DisableSmallstepExtensions
 	}
 	return *c.claims.DisableSmallstepExtensions
 }
@@ -149,76 +465,130 @@ func (c *Claimer) DefaultSSHCertDuration(certType uint32) (time.Duration, error)
 	}
 }
 
+// MinSSHCertDuration returns the minimum SSH certificate duration for the
+// given certificate type.
+func (c *Claimer) MinSSHCertDuration(certType uint32) (time.Duration, error) {
+	switch certType {
+	case ssh.UserCert:
+		return c.MinUserSSHCertDuration(), nil
+	case ssh.HostCert:
+		return c.MinHostSSHCertDuration(), nil
+	case 0:
+		return 0, errors.New("ssh certificate type has not been set")
+	default:
+		return 0, errors.Errorf("ssh certificate has an unknown type: %d", certType)
+	}
+}
+
+// MaxSSHCertDuration returns the maximum SSH certificate duration for the
+// given certificate type.
+func (c *Claimer) MaxSSHCertDuration(certType uint32) (time.Duration, error) {
+	switch certType {
+	case ssh.UserCert:
+		return c.MaxUserSSHCertDuration(), nil
+	case ssh.HostCert:
+		return c.MaxHostSSHCertDuration(), nil
+	case 0:
+		return 0, errors.New("ssh certificate type has not been set")
+	default:
+		return 0, errors.Errorf("ssh certificate has an unknown type: %d", certType)
+	}
+}
+
+// sshDuration returns the first of the given durations that is set. It is used
+// to give precedence to the duration of a certificate type over the one common
+// to both types.
+func sshDuration(durations ...*Duration) *Duration {
+	for _, d := range durations {
+		if d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
 // DefaultUserSSHCertDuration returns the default SSH user cert duration for the
 // provisioner. If the default is not set within the provisioner, then the
 // global default from the authority configuration will be used.
 func (c *Claimer) DefaultUserSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.DefaultUserSSHDur == nil {
-		return c.global.DefaultUserSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.DefaultUserSSHDur, c.claims.DefaultSSHDur); d != nil {
+			return d.Duration
+		}
 	}
-	return c.claims.DefaultUserSSHDur.Duration
+	return c.global.DefaultUserSSHDur.Value()
 }
 
 // MinUserSSHCertDuration returns the minimum SSH user cert duration for the
 // provisioner. If the minimum is not set within the provisioner, then the
 // global minimum from the authority configuration will be used.
 func (c *Claimer) MinUserSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.MinUserSSHDur == nil {
-		if c.claims != nil && c.claims.DefaultUserSSHDur != nil && c.claims.DefaultUserSSHDur.Duration < c.global.MinUserSSHDur.Duration {
-			return c.claims.DefaultUserSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.MinUserSSHDur, c.claims.MinSSHDur); d != nil {
+			return d.Duration
+		}
+		if d := sshDuration(c.claims.DefaultUserSSHDur, c.claims.DefaultSSHDur); d != nil && d.Duration < c.global.MinUserSSHDur.Value() {
+			return d.Duration
 		}
-		return c.global.MinUserSSHDur.Duration
 	}
-	return c.claims.MinUserSSHDur.Duration
+	return c.global.MinUserSSHDur.Value()
 }
 
 // MaxUserSSHCertDuration returns the maximum SSH user cert duration for the
 // provisioner. If the maximum is not set within the provisioner, then the
 // global maximum from the authority configuration will be used.
 func (c *Claimer) MaxUserSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.MaxUserSSHDur == nil {
-		if c.claims != nil && c.claims.DefaultUserSSHDur != nil && c.claims.DefaultUserSSHDur.Duration > c.global.MaxUserSSHDur.Duration {
-			return c.claims.DefaultUserSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.MaxUserSSHDur, c.claims.MaxSSHDur); d != nil {
+			return d.Duration
+		}
+		if d := sshDuration(c.claims.DefaultUserSSHDur, c.claims.DefaultSSHDur); d != nil && d.Duration > c.global.MaxUserSSHDur.Value() {
+			return d.Duration
 		}
-		return c.global.MaxUserSSHDur.Duration
 	}
-	return c.claims.MaxUserSSHDur.Duration
+	return c.global.MaxUserSSHDur.Value()
 }
 
 // DefaultHostSSHCertDuration returns the default SSH host cert duration for the
 // provisioner. If the default is not set within the provisioner, then the
 // global default from the authority configuration will be used.
 func (c *Claimer) DefaultHostSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.DefaultHostSSHDur == nil {
-		return c.global.DefaultHostSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.DefaultHostSSHDur, c.claims.DefaultSSHDur); d != nil {
+			return d.Duration
+		}
 	}
-	return c.claims.DefaultHostSSHDur.Duration
+	return c.global.DefaultHostSSHDur.Value()
 }
 
 // MinHostSSHCertDuration returns the minimum SSH host cert duration for the
 // provisioner. If the minimum is not set within the provisioner, then the
 // global minimum from the authority configuration will be used.
 func (c *Claimer) MinHostSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.MinHostSSHDur == nil {
-		if c.claims != nil && c.claims.DefaultHostSSHDur != nil && c.claims.DefaultHostSSHDur.Duration < c.global.MinHostSSHDur.Duration {
-			return c.claims.DefaultHostSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.MinHostSSHDur, c.claims.MinSSHDur); d != nil {
+			return d.Duration
+		}
+		if d := sshDuration(c.claims.DefaultHostSSHDur, c.claims.DefaultSSHDur); d != nil && d.Duration < c.global.MinHostSSHDur.Value() {
+			return d.Duration
 		}
-		return c.global.MinHostSSHDur.Duration
 	}
-	return c.claims.MinHostSSHDur.Duration
+	return c.global.MinHostSSHDur.Value()
 }
 
 // MaxHostSSHCertDuration returns the maximum SSH Host cert duration for the
 // provisioner. If the maximum is not set within the provisioner, then the
 // global maximum from the authority configuration will be used.
 func (c *Claimer) MaxHostSSHCertDuration() time.Duration {
-	if c.claims == nil || c.claims.MaxHostSSHDur == nil {
-		if c.claims != nil && c.claims.DefaultHostSSHDur != nil && c.claims.DefaultHostSSHDur.Duration > c.global.MaxHostSSHDur.Duration {
-			return c.claims.DefaultHostSSHDur.Duration
+	if c.claims != nil {
+		if d := sshDuration(c.claims.MaxHostSSHDur, c.claims.MaxSSHDur); d != nil {
+			return d.Duration
+		}
+		if d := sshDuration(c.claims.DefaultHostSSHDur, c.claims.DefaultSSHDur); d != nil && d.Duration > c.global.MaxHostSSHDur.Value() {
+			return d.Duration
 		}
-		return c.global.MaxHostSSHDur.Duration
 	}
-	return c.claims.MaxHostSSHDur.Duration
+	return c.global.MaxHostSSHDur.Value()
 }
 
 // IsSSHCAEnabled returns if the SSH CA is enabled for the provisioner. If the
@@ -234,10 +604,23 @@ func (c *Claimer) IsSSHCAEnabled() bool {
 // Validate validates and modifies the Claims with default values.
 func (c *Claimer) Validate() error {
 	var (
-		min = c.MinTLSCertDuration()
-		max = c.MaxTLSCertDuration()
-		def = c.DefaultTLSCertDuration()
+		min            = c.MinTLSCertDuration()
+		max            = c.MaxTLSCertDuration()
+		def            = c.DefaultTLSCertDuration()
+		renew          = c.MinRenewalTLSCertDuration()
+		maxRenew       = c.MaxRenewalTLSCertDuration()
+		maxChain       = c.MaxRenewalChainDuration()
+		grace          = c.RenewalGracePeriod()
+		nbOffset       = c.MaxTLSNotBeforeOffset()
+		backdate       = c.MaxTLSBackdate()
+		tlsBackdate, _ = c.TLSBackdate()
 	)
+	if err := validateSSHDurations("User", c.MinUserSSHCertDuration(), c.MaxUserSSHCertDuration(), c.DefaultUserSSHCertDuration()); err != nil {
+		return err
+	}
+	if err := validateSSHDurations("Host", c.MinHostSSHCertDuration(), c.MaxHostSSHCertDuration(), c.DefaultHostSSHCertDuration()); err != nil {
+		return err
+	}
 	switch {
 	case min <= 0:
 		return errors.Errorf("claims: MinTLSCertDuration must be greater than 0")
@@ -252,6 +635,49 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", def, min)
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
+	case renew < 0:
+		return errors.Errorf("claims: MinRenewalTLSCertDuration cannot be less than 0")
+	case max < renew:
+		return errors.Errorf("claims: MaxCertDuration cannot be less than MinRenewalTLSCertDuration: MaxCertDuration - %v, MinRenewalTLSCertDuration - %v", max, renew)
+	case maxRenew < 0:
+		return errors.Errorf("claims: MaxRenewalTLSCertDuration cannot be less than 0")
+	case max < maxRenew:
+		return errors.Errorf("claims: MaxCertDuration cannot be less than MaxRenewalTLSCertDuration: MaxCertDuration - %v, MaxRenewalTLSCertDuration - %v", max, maxRenew)
+	case maxRenew > 0 && maxRenew < renew:
+		return errors.Errorf("claims: MaxRenewalTLSCertDuration cannot be less than MinRenewalTLSCertDuration: MaxRenewalTLSCertDuration - %v, MinRenewalTLSCertDuration - %v", maxRenew, renew)
+	case maxChain < 0:
+		return errors.Errorf("claims: MaxRenewalChainDuration cannot be less than 0")
+	case grace < 0:
+		return errors.Errorf("claims: RenewalGracePeriod cannot be less than 0")
+	case nbOffset < 0:
+		return errors.Errorf("claims: MaxTLSCertNotBeforeOffset cannot be less than 0")
+	case backdate < 0:
+		return errors.Errorf("claims: MaxTLSCertBackdate cannot be less than 0")
+	case tlsBackdate < 0:
+		return errors.Errorf("claims: TLSCertBackdate cannot be less than 0")
+	case c.MaxRenewals() > 0 && c.IsDisableSmallstepExtensions():
+		return errors.Errorf("claims: MaxRenewals cannot be used with DisableSmallstepExtensions")
+	default:
+		return nil
+	}
+}
+
+// validateSSHDurations validates the order of the durations of the SSH
+// certificates of the given type, User or Host.
+func validateSSHDurations(typ string, min, max, def time.Duration) error {
+	switch {
+	case min < 0:
+		return errors.Errorf("claims: Min%sSSHCertDuration cannot be less than 0", typ)
+	case max < 0:
+		return errors.Errorf("claims: Max%sSSHCertDuration cannot be less than 0", typ)
+	case def < 0:
+		return errors.Errorf("claims: Default%sSSHCertDuration cannot be less than 0", typ)
+	case max < min:
+		return errors.Errorf("claims: Max%[1]sSSHCertDuration cannot be less than Min%[1]sSSHCertDuration: Max%[1]sSSHCertDuration - %[2]v, Min%[1]sSSHCertDuration - %[3]v", typ, max, min)
+	case def < min:
+		return errors.Errorf("claims: Default%[1]sSSHCertDuration cannot be less than Min%[1]sSSHCertDuration: Default%[1]sSSHCertDuration - %[2]v, Min%[1]sSSHCertDuration - %[3]v", typ, def, min)
+	case max < def:
+		return errors.Errorf("claims: Max%[1]sSSHCertDuration cannot be less than Default%[1]sSSHCertDuration: Max%[1]sSSHCertDuration - %[2]v, Default%[1]sSSHCertDuration - %[3]v", typ, max, def)
 	default:
 		return nil
 	}
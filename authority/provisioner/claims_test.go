@@ -49,3 +49,607 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimer_SSHCertDurations(t *testing.T) {
+	ssh4h := &Duration{Duration: 4 * time.Hour}
+	ssh1h := &Duration{Duration: time.Hour}
+	ssh10m := &Duration{Duration: 10 * time.Minute}
+	tests := []struct {
+		name                      string
+		claims                    *Claims
+		certType                  uint32
+		wantMin, wantMax, wantDef time.Duration
+	}{
+		{"user global", nil, ssh.UserCert, 5 * time.Minute, 24 * time.Hour, 16 * time.Hour},
+		{"host global", nil, ssh.HostCert, 5 * time.Minute, 30 * 24 * time.Hour, 30 * 24 * time.Hour},
+		{"user generic", &Claims{MinSSHDur: ssh10m, MaxSSHDur: ssh4h, DefaultSSHDur: ssh1h}, ssh.UserCert, 10 * time.Minute, 4 * time.Hour, time.Hour},
+		{"host generic", &Claims{MinSSHDur: ssh10m, MaxSSHDur: ssh4h, DefaultSSHDur: ssh1h}, ssh.HostCert, 10 * time.Minute, 4 * time.Hour, time.Hour},
+		{"user specific", &Claims{MaxSSHDur: ssh1h, DefaultSSHDur: ssh1h, MaxUserSSHDur: ssh4h, DefaultUserSSHDur: ssh4h}, ssh.UserCert, 5 * time.Minute, 4 * time.Hour, 4 * time.Hour},
+		{"host generic with user specific", &Claims{MaxSSHDur: ssh1h, DefaultSSHDur: ssh1h, MaxUserSSHDur: ssh4h}, ssh.HostCert, 5 * time.Minute, time.Hour, time.Hour},
+		{"user generic default above global max", &Claims{DefaultSSHDur: &Duration{Duration: 48 * time.Hour}}, ssh.UserCert, 5 * time.Minute, 48 * time.Hour, 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.claims, globalProvisionerClaims)
+			if err != nil {
+				t.Fatalf("NewClaimer() error = %v", err)
+			}
+			if got, err := c.MinSSHCertDuration(tt.certType); err != nil || got != tt.wantMin {
+				t.Errorf("Claimer.MinSSHCertDuration() = %v, %v, want %v", got, err, tt.wantMin)
+			}
+			if got, err := c.MaxSSHCertDuration(tt.certType); err != nil || got != tt.wantMax {
+				t.Errorf("Claimer.MaxSSHCertDuration() = %v, %v, want %v", got, err, tt.wantMax)
+			}
+			if got, err := c.DefaultSSHCertDuration(tt.certType); err != nil || got != tt.wantDef {
+				t.Errorf("Claimer.DefaultSSHCertDuration() = %v, %v, want %v", got, err, tt.wantDef)
+			}
+			// The SSH durations do not change the TLS ones.
+			if got := c.DefaultTLSCertDuration(); got != globalProvisionerClaims.DefaultTLSDur.Duration {
+				t.Errorf("Claimer.DefaultTLSCertDuration() = %v, want %v", got, globalProvisionerClaims.DefaultTLSDur.Duration)
+			}
+			if got := c.MaxTLSCertDuration(); got != globalProvisionerClaims.MaxTLSDur.Duration {
+				t.Errorf("Claimer.MaxTLSCertDuration() = %v, want %v", got, globalProvisionerClaims.MaxTLSDur.Duration)
+			}
+		})
+	}
+
+	for _, certType := range []uint32{0, 3} {
+		c, err := NewClaimer(nil, globalProvisionerClaims)
+		if err != nil {
+			t.Fatalf("NewClaimer() error = %v", err)
+		}
+		if _, err := c.MinSSHCertDuration(certType); err == nil {
+			t.Errorf("Claimer.MinSSHCertDuration(%d) error = nil, want error", certType)
+		}
+		if _, err := c.MaxSSHCertDuration(certType); err == nil {
+			t.Errorf("Claimer.MaxSSHCertDuration(%d) error = nil, want error", certType)
+		}
+	}
+}
+
+func TestNewClaimer_sshDurations(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  *Claims
+		wantErr bool
+	}{
+		{"ok", &Claims{MinSSHDur: &Duration{Duration: time.Minute}, MaxSSHDur: &Duration{Duration: 8 * time.Hour}, DefaultSSHDur: &Duration{Duration: time.Hour}}, false},
+		{"ok host specific", &Claims{MaxSSHDur: &Duration{Duration: 8 * time.Hour}, DefaultSSHDur: &Duration{Duration: time.Hour}, MaxHostSSHDur: &Duration{Duration: 90 * 24 * time.Hour}}, false},
+		{"fail negative", &Claims{MinSSHDur: &Duration{Duration: -time.Minute}}, true},
+		{"fail max less than min", &Claims{MinSSHDur: &Duration{Duration: 2 * time.Hour}, MaxSSHDur: &Duration{Duration: time.Hour}}, true},
+		{"fail default less than min", &Claims{MinSSHDur: &Duration{Duration: 2 * time.Hour}, DefaultSSHDur: &Duration{Duration: time.Hour}}, true},
+		{"fail max less than default", &Claims{MaxSSHDur: &Duration{Duration: time.Hour}, DefaultSSHDur: &Duration{Duration: 2 * time.Hour}}, true},
+		{"fail host max less than default", &Claims{MaxHostSSHDur: &Duration{Duration: time.Hour}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClaimer(tt.claims, globalProvisionerClaims); (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClaimer_maxRenewals(t *testing.T) {
+	three, enabled, disabled := 3, true, false
+	tests := []struct {
+		name    string
+		global  Claims
+		claims  *Claims
+		wantErr bool
+	}{
+		{"ok", globalProvisionerClaims, &Claims{MaxRenewals: &three}, false},
+		{"ok extensions enabled", globalProvisionerClaims, &Claims{MaxRenewals: &three, DisableSmallstepExtensions: &disabled}, false},
+		{"ok extensions disabled without max renewals", globalProvisionerClaims, &Claims{DisableSmallstepExtensions: &enabled}, false},
+		{"fail extensions disabled", globalProvisionerClaims, &Claims{MaxRenewals: &three, DisableSmallstepExtensions: &enabled}, true},
+		{"fail global extensions disabled", Claims{
+			MinTLSDur:                  globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:                  globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:              globalProvisionerClaims.DefaultTLSDur,
+			DisableSmallstepExtensions: &enabled,
+		}, &Claims{MaxRenewals: &three}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClaimer(tt.claims, tt.global); (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimer_MinRenewalTLSCertDuration(t *testing.T) {
+	duration := Duration{
+		Duration: time.Hour,
+	}
+	tooLong := Duration{
+		Duration: 48 * time.Hour,
+	}
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok", fields{globalProvisionerClaims, &Claims{MinRenewalTLSDur: &duration}}, time.Hour, false},
+		{"ok default", fields{globalProvisionerClaims, nil}, globalProvisionerClaims.MinTLSDur.Duration, false},
+		{"ok default provisioner min", fields{globalProvisionerClaims, &Claims{MinTLSDur: &duration}}, time.Hour, false},
+		{"ok default max renewal", fields{globalProvisionerClaims, &Claims{MaxRenewalTLSDur: &Duration{Duration: time.Minute}}}, time.Minute, false},
+		{"ok disabled", fields{globalProvisionerClaims, &Claims{MinRenewalTLSDur: &Duration{}}}, 0, false},
+		{"ok global set", fields{Claims{
+			MinTLSDur:        globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:        globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:    globalProvisionerClaims.DefaultTLSDur,
+			MinRenewalTLSDur: &duration,
+		}, &Claims{}}, time.Hour, false},
+		{"fail greater than max", fields{globalProvisionerClaims, &Claims{MinRenewalTLSDur: &tooLong}}, 48 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.fields.claims, tt.fields.global)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := c.MinRenewalTLSCertDuration(); got != tt.want {
+				t.Errorf("Claimer.MinRenewalTLSCertDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MinRenewalTLSCertDuration_global(t *testing.T) {
+	// The default of the authority is not used as the global value of the
+	// provisioners, they use their own minimum TLS duration.
+	authority, err := NewClaimer(nil, globalProvisionerClaims)
+	if err != nil {
+		t.Fatalf("NewClaimer() error = %v", err)
+	}
+	c, err := NewClaimer(&Claims{MinTLSDur: &Duration{Duration: time.Second}}, authority.Claims())
+	if err != nil {
+		t.Fatalf("NewClaimer() error = %v", err)
+	}
+	if got := c.MinRenewalTLSCertDuration(); got != time.Second {
+		t.Errorf("Claimer.MinRenewalTLSCertDuration() = %v, want %v", got, time.Second)
+	}
+}
+
+func TestClaimer_MaxRenewalTLSCertDuration(t *testing.T) {
+	duration := Duration{
+		Duration: time.Hour,
+	}
+	short := Duration{
+		Duration: time.Minute,
+	}
+	negative := Duration{
+		Duration: -time.Hour,
+	}
+	tooLong := Duration{
+		Duration: 48 * time.Hour,
+	}
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok", fields{globalProvisionerClaims, &Claims{MaxRenewalTLSDur: &duration}}, time.Hour, false},
+		{"ok global", fields{globalProvisionerClaims, nil}, 0, false},
+		{"ok global set", fields{Claims{
+			MinTLSDur:        globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:        globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:    globalProvisionerClaims.DefaultTLSDur,
+			MaxRenewalTLSDur: &duration,
+		}, &Claims{}}, time.Hour, false},
+		{"fail negative", fields{globalProvisionerClaims, &Claims{MaxRenewalTLSDur: &negative}}, -time.Hour, true},
+		{"fail greater than max", fields{globalProvisionerClaims, &Claims{MaxRenewalTLSDur: &tooLong}}, 48 * time.Hour, true},
+		{"fail less than min renewal", fields{globalProvisionerClaims, &Claims{MinRenewalTLSDur: &duration, MaxRenewalTLSDur: &short}}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.fields.claims, tt.fields.global)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := c.MaxRenewalTLSCertDuration(); got != tt.want {
+				t.Errorf("Claimer.MaxRenewalTLSCertDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxRenewalChainDuration(t *testing.T) {
+	duration := Duration{
+		Duration: 90 * 24 * time.Hour,
+	}
+	negative := Duration{
+		Duration: -time.Hour,
+	}
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok", fields{globalProvisionerClaims, &Claims{MaxRenewalChainDur: &duration}}, 90 * 24 * time.Hour, false},
+		{"ok global", fields{globalProvisionerClaims, nil}, 0, false},
+		{"ok global set", fields{Claims{
+			MinTLSDur:          globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:          globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:      globalProvisionerClaims.DefaultTLSDur,
+			MaxRenewalChainDur: &duration,
+		}, &Claims{}}, 90 * 24 * time.Hour, false},
+		{"fail negative", fields{globalProvisionerClaims, &Claims{MaxRenewalChainDur: &negative}}, -time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.fields.claims, tt.fields.global)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := c.MaxRenewalChainDuration(); got != tt.want {
+				t.Errorf("Claimer.MaxRenewalChainDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_RenewalGracePeriod(t *testing.T) {
+	duration := Duration{
+		Duration: time.Hour,
+	}
+	negative := Duration{
+		Duration: -time.Hour,
+	}
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    time.Duration
+		wantErr bool
+	}{
+		{"ok", fields{globalProvisionerClaims, &Claims{RenewalGracePeriod: &duration}}, time.Hour, false},
+		{"ok global", fields{globalProvisionerClaims, nil}, 0, false},
+		{"ok global set", fields{Claims{
+			MinTLSDur:          globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:          globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:      globalProvisionerClaims.DefaultTLSDur,
+			RenewalGracePeriod: &duration,
+		}, &Claims{}}, time.Hour, false},
+		{"fail negative", fields{globalProvisionerClaims, &Claims{RenewalGracePeriod: &negative}}, -time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.fields.claims, tt.fields.global)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := c.RenewalGracePeriod(); got != tt.want {
+				t.Errorf("Claimer.RenewalGracePeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_ClampTLSCertDuration(t *testing.T) {
+	tru, fals := true, false
+	type fields struct {
+		global Claims
+		claims *Claims
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   bool
+	}{
+		{"ok", fields{globalProvisionerClaims, &Claims{ClampTLSCertDuration: &tru}}, true},
+		{"ok false", fields{globalProvisionerClaims, &Claims{ClampTLSCertDuration: &fals}}, false},
+		{"ok global", fields{globalProvisionerClaims, nil}, false},
+		{"ok global set", fields{Claims{
+			MinTLSDur:            globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:            globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:        globalProvisionerClaims.DefaultTLSDur,
+			ClampTLSCertDuration: &tru,
+		}, &Claims{}}, true},
+		{"ok override global", fields{Claims{
+			MinTLSDur:            globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:            globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:        globalProvisionerClaims.DefaultTLSDur,
+			ClampTLSCertDuration: &tru,
+		}, &Claims{ClampTLSCertDuration: &fals}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.fields.claims, tt.fields.global)
+			if err != nil {
+				t.Fatalf("NewClaimer() error = %v", err)
+			}
+			if got := c.ClampTLSCertDuration(); got != tt.want {
+				t.Errorf("Claimer.ClampTLSCertDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxTLSNotBeforeOffset(t *testing.T) {
+	hour := &Duration{time.Hour}
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   time.Duration
+	}{
+		{"ok default", globalProvisionerClaims, nil, 0},
+		{"ok", globalProvisionerClaims, &Claims{MaxTLSNotBeforeOffset: hour}, time.Hour},
+		{"ok global", Claims{
+			MinTLSDur:             globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:             globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:         globalProvisionerClaims.DefaultTLSDur,
+			MaxTLSNotBeforeOffset: hour,
+		}, &Claims{}, time.Hour},
+		{"ok override global", Claims{
+			MinTLSDur:             globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:             globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:         globalProvisionerClaims.DefaultTLSDur,
+			MaxTLSNotBeforeOffset: hour,
+		}, &Claims{MaxTLSNotBeforeOffset: &Duration{time.Minute}}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.claims, tt.global)
+			if err != nil {
+				t.Fatalf("NewClaimer() error = %v", err)
+			}
+			if got := c.MaxTLSNotBeforeOffset(); got != tt.want {
+				t.Errorf("Claimer.MaxTLSNotBeforeOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxTLSBackdate(t *testing.T) {
+	hour := &Duration{time.Hour}
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   time.Duration
+	}{
+		{"ok default", globalProvisionerClaims, nil, 0},
+		{"ok", globalProvisionerClaims, &Claims{MaxTLSBackdate: hour}, time.Hour},
+		{"ok global", Claims{
+			MinTLSDur:      globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:      globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:  globalProvisionerClaims.DefaultTLSDur,
+			MaxTLSBackdate: hour,
+		}, &Claims{}, time.Hour},
+		{"ok override global", Claims{
+			MinTLSDur:      globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:      globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur:  globalProvisionerClaims.DefaultTLSDur,
+			MaxTLSBackdate: hour,
+		}, &Claims{MaxTLSBackdate: &Duration{time.Minute}}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.claims, tt.global)
+			if err != nil {
+				t.Fatalf("NewClaimer() error = %v", err)
+			}
+			if got := c.MaxTLSBackdate(); got != tt.want {
+				t.Errorf("Claimer.MaxTLSBackdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_TLSBackdate(t *testing.T) {
+	hour := &Duration{time.Hour}
+	tests := []struct {
+		name    string
+		global  Claims
+		claims  *Claims
+		want    time.Duration
+		wantOK  bool
+		wantErr bool
+	}{
+		{"ok default", globalProvisionerClaims, nil, 0, false, false},
+		{"ok", globalProvisionerClaims, &Claims{TLSBackdate: hour}, time.Hour, true, false},
+		{"ok zero", globalProvisionerClaims, &Claims{TLSBackdate: &Duration{}}, 0, true, false},
+		{"ok global", Claims{
+			MinTLSDur:     globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:     globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur: globalProvisionerClaims.DefaultTLSDur,
+			TLSBackdate:   hour,
+		}, &Claims{}, time.Hour, true, false},
+		{"ok override global", Claims{
+			MinTLSDur:     globalProvisionerClaims.MinTLSDur,
+			MaxTLSDur:     globalProvisionerClaims.MaxTLSDur,
+			DefaultTLSDur: globalProvisionerClaims.DefaultTLSDur,
+			TLSBackdate:   hour,
+		}, &Claims{TLSBackdate: &Duration{time.Minute}}, time.Minute, true, false},
+		{"fail negative", globalProvisionerClaims, &Claims{TLSBackdate: &Duration{-time.Minute}}, -time.Minute, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.claims, tt.global)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, ok := c.TLSBackdate()
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Claimer.TLSBackdate() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClaimer_IsRenewalSerialized(t *testing.T) {
+	tru, fals := true, false
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   bool
+	}{
+		{"default", globalProvisionerClaims, nil, false},
+		{"global", Claims{SerializeRenewals: &tru}, nil, true},
+		{"provisioner", globalProvisionerClaims, &Claims{SerializeRenewals: &tru}, true},
+		{"provisioner override", Claims{SerializeRenewals: &tru}, &Claims{SerializeRenewals: &fals}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.IsRenewalSerialized(); got != tt.want {
+				t.Errorf("Claimer.IsRenewalSerialized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxRenewals(t *testing.T) {
+	three, disabled := 3, 0
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   int
+	}{
+		{"default", globalProvisionerClaims, nil, 0},
+		{"global", Claims{MaxRenewals: &three}, nil, 3},
+		{"provisioner", globalProvisionerClaims, &Claims{MaxRenewals: &three}, 3},
+		{"provisioner override", Claims{MaxRenewals: &three}, &Claims{MaxRenewals: &disabled}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.MaxRenewals(); got != tt.want {
+				t.Errorf("Claimer.MaxRenewals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxCSRExtensions(t *testing.T) {
+	ten, twenty := 10, 20
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   int
+	}{
+		{"default", globalProvisionerClaims, nil, DefaultMaxCSRExtensions},
+		{"global", Claims{MaxCSRExtensions: &ten}, nil, 10},
+		{"provisioner", Claims{MaxCSRExtensions: &ten}, &Claims{MaxCSRExtensions: &twenty}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.MaxCSRExtensions(); got != tt.want {
+				t.Errorf("Claimer.MaxCSRExtensions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxCSRAttributesSize(t *testing.T) {
+	small, disabled := 1024, 0
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   int
+	}{
+		{"default", globalProvisionerClaims, nil, DefaultMaxCSRAttributesSize},
+		{"global", Claims{MaxCSRAttributesSize: &small}, nil, 1024},
+		{"provisioner", Claims{MaxCSRAttributesSize: &small}, &Claims{MaxCSRAttributesSize: &disabled}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.MaxCSRAttributesSize(); got != tt.want {
+				t.Errorf("Claimer.MaxCSRAttributesSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxSANs(t *testing.T) {
+	ten, disabled := 10, 0
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   int
+	}{
+		{"default", globalProvisionerClaims, nil, DefaultMaxSANs},
+		{"global", Claims{MaxSANs: &ten}, nil, 10},
+		{"provisioner", Claims{MaxSANs: &ten}, &Claims{MaxSANs: &disabled}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.MaxSANs(); got != tt.want {
+				t.Errorf("Claimer.MaxSANs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_MaxSANLength(t *testing.T) {
+	short, long := 253, 4096
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   int
+	}{
+		{"default", globalProvisionerClaims, nil, DefaultMaxSANLength},
+		{"global", Claims{MaxSANLength: &short}, nil, 253},
+		{"provisioner", Claims{MaxSANLength: &short}, &Claims{MaxSANLength: &long}, 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.MaxSANLength(); got != tt.want {
+				t.Errorf("Claimer.MaxSANLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package provisioner
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseCIDRs parses the given list of CIDRs, e.g. 10.0.0.0/8 or 2001:db8::/32.
+func parseCIDRs(name string, cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		return nil, nil
+	}
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, s := range cidrs {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("provisioner %s %q is not a valid CIDR", name, s)
+		}
+		nets[i] = ipNet
+	}
+	return nets, nil
+}
+
+// networksContain returns true if the ip is in any of the given networks.
+func networksContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client. The X-Forwarded-For addresses
+// are only used if the connection comes from one of the trusted proxies. In
+// that case they are walked from right to left, and the first one that is not
+// a trusted proxy is the client. It returns nil if the address is not valid.
+func clientIP(addr *ClientAddr, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(addr.RemoteAddr)
+	if err != nil {
+		host = addr.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !networksContain(trustedProxies, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, v := range addr.ForwardedFor {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				forwarded = append(forwarded, s)
+			}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if ip = net.ParseIP(forwarded[i]); ip == nil || !networksContain(trustedProxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
@@ -0,0 +1,40 @@
+package provisioner
+
+import (
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_clientIP(t *testing.T) {
+	proxies, err := parseCIDRs("trustedProxies", []string{"192.168.0.0/24", "fd00::/8"})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		addr    *ClientAddr
+		proxies []*net.IPNet
+		want    net.IP
+	}{
+		{"ok remote", &ClientAddr{RemoteAddr: "10.0.0.1:1234"}, proxies, net.ParseIP("10.0.0.1")},
+		{"ok remote without port", &ClientAddr{RemoteAddr: "10.0.0.1"}, proxies, net.ParseIP("10.0.0.1")},
+		{"ok remote ipv6", &ClientAddr{RemoteAddr: "[2001:db8::1]:1234"}, proxies, net.ParseIP("2001:db8::1")},
+		{"ok ignore forwarded", &ClientAddr{RemoteAddr: "10.0.0.1:1234", ForwardedFor: []string{"10.0.0.2"}}, proxies, net.ParseIP("10.0.0.1")},
+		{"ok ignore forwarded without proxies", &ClientAddr{RemoteAddr: "192.168.0.1:1234", ForwardedFor: []string{"10.0.0.2"}}, nil, net.ParseIP("192.168.0.1")},
+		{"ok forwarded", &ClientAddr{RemoteAddr: "192.168.0.1:1234", ForwardedFor: []string{"10.0.0.2"}}, proxies, net.ParseIP("10.0.0.2")},
+		{"ok forwarded chain", &ClientAddr{RemoteAddr: "[fd00::1]:1234", ForwardedFor: []string{"10.0.0.3, 10.0.0.2", "192.168.0.2"}}, proxies, net.ParseIP("10.0.0.2")},
+		{"ok forwarded only proxies", &ClientAddr{RemoteAddr: "192.168.0.1:1234", ForwardedFor: []string{"192.168.0.2"}}, proxies, net.ParseIP("192.168.0.2")},
+		{"ok forwarded empty", &ClientAddr{RemoteAddr: "192.168.0.1:1234"}, proxies, net.ParseIP("192.168.0.1")},
+		{"fail remote", &ClientAddr{RemoteAddr: "foo:1234"}, proxies, nil},
+		{"fail forwarded", &ClientAddr{RemoteAddr: "192.168.0.1:1234", ForwardedFor: []string{"10.0.0.2, foo"}}, proxies, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clientIP(tt.addr, tt.proxies)
+			if !got.Equal(tt.want) {
+				t.Errorf("clientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
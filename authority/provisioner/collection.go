@@ -11,9 +11,12 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/smallstep/certificates/authority/admin"
+	"github.com/pkg/errors"
 	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/admin"
 )
 
 // DefaultProvisionersLimit is the default limit for listing provisioners.
@@ -42,8 +45,25 @@ type loadByTokenPayload struct {
 	TenantID        string `json:"tid"`   // Microsoft Azure tenant id
 }
 
-// Collection is a memory map of provisioners.
+// additionalKeysProvisioner is implemented by the provisioners that accept
+// tokens signed with more than one key, e.g. a JWK provisioner during a key
+// rotation.
+type additionalKeysProvisioner interface {
+	getAdditionalIDsForToken() []string
+	getAdditionalEncryptedKeys() map[string]string
+}
+
+// Collection is a memory map of provisioners. Updates are copy-on-write, a
+// new snapshot is published on every change, so concurrent readers always see
+// a consistent collection.
 type Collection struct {
+	mu    sync.Mutex
+	state atomic.Pointer[collectionState]
+}
+
+// collectionState is a snapshot of the provisioners in a collection. Once
+// published, a state is never modified.
+type collectionState struct {
 	byID      *sync.Map
 	byKey     *sync.Map
 	byName    *sync.Map
@@ -55,53 +75,95 @@ type Collection struct {
 // NewCollection initializes a collection of provisioners. The given list of
 // audiences are the audiences used by the JWT provisioner.
 func NewCollection(audiences Audiences) *Collection {
-	return &Collection{
+	c := new(Collection)
+	c.state.Store(&collectionState{
 		byID:      new(sync.Map),
 		byKey:     new(sync.Map),
 		byName:    new(sync.Map),
 		byTokenID: new(sync.Map),
 		audiences: audiences,
+	})
+	return c
+}
+
+// load returns the current snapshot of the collection.
+func (c *Collection) load() *collectionState {
+	if s := c.state.Load(); s != nil {
+		return s
+	}
+	return &collectionState{
+		byID:      new(sync.Map),
+		byKey:     new(sync.Map),
+		byName:    new(sync.Map),
+		byTokenID: new(sync.Map),
 	}
 }
 
+// update applies fn to a copy of the current snapshot and publishes it if fn
+// does not fail.
+func (c *Collection) update(fn func(s *collectionState) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.load().clone()
+	if err := fn(s); err != nil {
+		return err
+	}
+	c.state.Store(s)
+	return nil
+}
+
+// Replace atomically replaces the provisioners and audiences with the ones in
+// the given collection.
+func (c *Collection) Replace(nc *Collection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Store(nc.load())
+}
+
 // Load a provisioner by the ID.
 func (c *Collection) Load(id string) (Interface, bool) {
-	return loadProvisioner(c.byID, id)
+	return loadProvisioner(c.load().byID, id)
 }
 
 // LoadByName a provisioner by name.
 func (c *Collection) LoadByName(name string) (Interface, bool) {
-	return loadProvisioner(c.byName, name)
+	return loadProvisioner(c.load().byName, name)
 }
 
 // LoadByTokenID a provisioner by identifier found in token.
 // For different provisioner types this identifier may be found in in different
 // attributes of the token.
 func (c *Collection) LoadByTokenID(tokenProvisionerID string) (Interface, bool) {
-	return loadProvisioner(c.byTokenID, tokenProvisionerID)
+	return loadProvisioner(c.load().byTokenID, tokenProvisionerID)
 }
 
 // LoadByToken parses the token claims and loads the provisioner associated.
 func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims) (Interface, bool) {
+	s := c.load()
+
 	var audiences []string
 	// Get all audiences with the given fragment
 	fragment := extractFragment(claims.Audience)
 	if fragment == "" {
-		audiences = c.audiences.All()
+		audiences = s.audiences.All()
 	} else {
-		audiences = c.audiences.WithFragment(fragment).All()
+		audiences = s.audiences.WithFragment(fragment).All()
 	}
 
 	// match with server audiences
 	if matchesAudience(claims.Audience, audiences) {
 		// Use fragment to get provisioner name (GCP, AWS, SSHPOP)
 		if fragment != "" {
-			return c.LoadByTokenID(fragment)
+			return s.loadByTokenID(fragment)
 		}
 		// If matches with stored audiences it will be a JWT token (default), and
-		// the id would be <issuer>:<kid>.
+		// the id would be <issuer>:<kid>, or <issuer>: if the JWK provisioner
+		// uses a remote key set.
 		// TODO: is this ok?
-		return c.LoadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID)
+		if p, ok := s.loadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID); ok {
+			return p, ok
+		}
+		return s.loadByTokenID(claims.Issuer + ":")
 	}
 
 	// The ID will be just the clientID stored in azp, aud or tid.
@@ -112,7 +174,7 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 
 	// Kubernetes Service Account tokens.
 	if payload.Issuer == k8sSAIssuer {
-		if p, ok := c.LoadByTokenID(K8sSAID); ok {
+		if p, ok := s.loadByTokenID(K8sSAID); ok {
 			return p, ok
 		}
 		// Kubernetes service account provisioner not found
@@ -126,7 +188,7 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 
 	// Try with azp (OIDC)
 	if payload.AuthorizedParty != "" {
-		if p, ok := c.LoadByTokenID(payload.AuthorizedParty); ok {
+		if p, ok := s.loadByTokenID(payload.AuthorizedParty); ok {
 			return p, ok
 		}
 	}
@@ -134,18 +196,18 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	if payload.TenantID != "" {
 		// Try to load an OIDC provisioner first.
 		if payload.Email != "" {
-			if p, ok := c.LoadByTokenID(payload.Audience[0]); ok {
+			if p, ok := s.loadByTokenID(payload.Audience[0]); ok {
 				return p, ok
 			}
 		}
 		// Try to load an Azure provisioner.
-		if p, ok := c.LoadByTokenID(payload.TenantID); ok {
+		if p, ok := s.loadByTokenID(payload.TenantID); ok {
 			return p, ok
 		}
 	}
 
 	// Fallback to aud
-	return c.LoadByTokenID(payload.Audience[0])
+	return s.loadByTokenID(payload.Audience[0])
 }
 
 // LoadByCertificate looks for the provisioner extension and extracts the
@@ -157,7 +219,7 @@ func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool)
 			if _, err := asn1.Unmarshal(e.Value, &provisioner); err != nil {
 				return nil, false
 			}
-			return c.LoadByName(string(provisioner.Name))
+			return loadProvisioner(c.load().byName, string(provisioner.Name))
 		}
 	}
 
@@ -169,10 +231,15 @@ func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool)
 // LoadEncryptedKey returns an encrypted key by indexed by KeyID. At this moment
 // only JWK encrypted keys are indexed by KeyID.
 func (c *Collection) LoadEncryptedKey(keyID string) (string, bool) {
-	p, ok := loadProvisioner(c.byKey, keyID)
+	p, ok := loadProvisioner(c.load().byKey, keyID)
 	if !ok {
 		return "", false
 	}
+	if ap, ok := p.(additionalKeysProvisioner); ok {
+		if key, ok := ap.getAdditionalEncryptedKeys()[keyID]; ok {
+			return key, true
+		}
+	}
 	_, key, ok := p.GetEncryptedKey()
 	return key, ok
 }
@@ -180,28 +247,149 @@ func (c *Collection) LoadEncryptedKey(keyID string) (string, bool) {
 // Store adds a provisioner to the collection and enforces the uniqueness of
 // provisioner IDs.
 func (c *Collection) Store(p Interface) error {
+	return c.update(func(s *collectionState) error {
+		return s.store(p)
+	})
+}
+
+// Remove deletes an provisioner from all associated collections and lists.
+func (c *Collection) Remove(id string) error {
+	return c.update(func(s *collectionState) error {
+		return s.remove(id)
+	})
+}
+
+// Update updates the given provisioner in all related lists and collections.
+// The old provisioner is replaced in a single step, so there is no moment in
+// which the provisioner is missing from the collection.
+func (c *Collection) Update(nu Interface) error {
+	return c.update(func(s *collectionState) error {
+		old, ok := loadProvisioner(s.byID, nu.GetID())
+		if !ok {
+			return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", nu.GetID())
+		}
+
+		if old.GetName() != nu.GetName() {
+			if _, ok := loadProvisioner(s.byName, nu.GetName()); ok {
+				return admin.NewError(admin.ErrorBadRequestType,
+					"provisioner with name %s already exists", nu.GetName())
+			}
+		}
+		if old.GetIDForToken() != nu.GetIDForToken() {
+			if _, ok := s.loadByTokenID(nu.GetIDForToken()); ok {
+				return admin.NewError(admin.ErrorBadRequestType,
+					"provisioner with Token ID %s already exists", nu.GetIDForToken())
+			}
+		}
+
+		if err := s.remove(old.GetID()); err != nil {
+			return err
+		}
+		return s.store(nu)
+	})
+}
+
+// Reconfigure initializes the given provisioner with the given config and
+// replaces the provisioner with the same ID with it. The new provisioner is
+// fully validated, and its claimer, keys and other state are built, before it
+// is published, so in-flight requests keep using a consistent view of the old
+// provisioner. If the initialization fails, the old provisioner is left
+// intact.
+//
+// The given provisioner must be a new instance, initializing the provisioner
+// in the collection would modify it while it's in use. For the same reason
+// provisioners do not have an Update method that applies a configuration in
+// place: the Authorize methods of every provisioner type read their keys,
+// claimer and options without locks, and a request can span several of those
+// calls. Swapping the whole instance gives every request either the old or
+// the new configuration, never a mix of both.
+func (c *Collection) Reconfigure(nu Interface, config Config) error {
+	if old, ok := c.Load(nu.GetID()); ok && old == nu {
+		return admin.NewError(admin.ErrorBadRequestType,
+			"provisioner %s cannot be reconfigured in place", nu.GetName())
+	}
+	if err := nu.Init(config); err != nil {
+		return errors.Wrapf(err, "error initializing provisioner %s", nu.GetName())
+	}
+	return c.Update(nu)
+}
+
+// Find implements pagination on a list of sorted provisioners.
+func (c *Collection) Find(cursor string, limit int) (List, string) {
+	switch {
+	case limit <= 0:
+		limit = DefaultProvisionersLimit
+	case limit > DefaultProvisionersMax:
+		limit = DefaultProvisionersMax
+	}
+
+	sorted := c.load().sorted
+	n := sorted.Len()
+	cursor = fmt.Sprintf("%040s", cursor)
+	i := sort.Search(n, func(i int) bool { return sorted[i].uid >= cursor })
+
+	slice := List{}
+	for ; i < n && len(slice) < limit; i++ {
+		slice = append(slice, sorted[i].provisioner)
+	}
+
+	if i < n {
+		return slice, strings.TrimLeft(sorted[i].uid, "0")
+	}
+	return slice, ""
+}
+
+// clone returns a copy of the state that can be modified.
+func (s *collectionState) clone() *collectionState {
+	return &collectionState{
+		byID:      cloneMap(s.byID),
+		byKey:     cloneMap(s.byKey),
+		byName:    cloneMap(s.byName),
+		byTokenID: cloneMap(s.byTokenID),
+		sorted:    append(provisionerSlice(nil), s.sorted...),
+		audiences: s.audiences,
+	}
+}
+
+func (s *collectionState) loadByTokenID(tokenProvisionerID string) (Interface, bool) {
+	return loadProvisioner(s.byTokenID, tokenProvisionerID)
+}
+
+// store adds a provisioner to the state. On errors the state must be
+// discarded.
+func (s *collectionState) store(p Interface) error {
 	// Store provisioner always in byID. ID must be unique.
-	if _, loaded := c.byID.LoadOrStore(p.GetID(), p); loaded {
+	if _, loaded := s.byID.LoadOrStore(p.GetID(), p); loaded {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same id")
 	}
 	// Store provisioner always by name.
-	if _, loaded := c.byName.LoadOrStore(p.GetName(), p); loaded {
-		c.byID.Delete(p.GetID())
+	if _, loaded := s.byName.LoadOrStore(p.GetName(), p); loaded {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same name")
 	}
 	// Store provisioner always by ID presented in token.
-	if _, loaded := c.byTokenID.LoadOrStore(p.GetIDForToken(), p); loaded {
-		c.byID.Delete(p.GetID())
-		c.byName.Delete(p.GetName())
+	if _, loaded := s.byTokenID.LoadOrStore(p.GetIDForToken(), p); loaded {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same token identifier")
 	}
 
 	// Store provisioner in byKey if EncryptedKey is defined.
 	if kid, _, ok := p.GetEncryptedKey(); ok {
-		c.byKey.Store(kid, p)
+		s.byKey.Store(kid, p)
+	}
+
+	// Store the token identifiers and encrypted keys of additional keys.
+	if ap, ok := p.(additionalKeysProvisioner); ok {
+		for _, id := range ap.getAdditionalIDsForToken() {
+			if _, loaded := s.byTokenID.LoadOrStore(id, p); loaded {
+				return admin.NewError(admin.ErrorBadRequestType,
+					"cannot add multiple provisioners with the same token identifier")
+			}
+		}
+		for kid := range ap.getAdditionalEncryptedKeys() {
+			s.byKey.Store(kid, p)
+		}
 	}
 
 	// Store sorted provisioners.
@@ -210,32 +398,33 @@ func (c *Collection) Store(p Interface) error {
 	// 0x00000000, 0x00000001, 0x00000002, ...
 	bi := make([]byte, 4)
 	sum := provisionerSum(p)
-	binary.BigEndian.PutUint32(bi, uint32(c.sorted.Len()))
+	binary.BigEndian.PutUint32(bi, uint32(s.sorted.Len()))
 	sum[0], sum[1], sum[2], sum[3] = bi[0], bi[1], bi[2], bi[3]
-	c.sorted = append(c.sorted, uidProvisioner{
+	s.sorted = append(s.sorted, uidProvisioner{
 		provisioner: p,
 		uid:         hex.EncodeToString(sum),
 	})
-	sort.Sort(c.sorted)
+	sort.Sort(s.sorted)
 	return nil
 }
 
-// Remove deletes an provisioner from all associated collections and lists.
-func (c *Collection) Remove(id string) error {
-	prov, ok := c.Load(id)
+// remove deletes a provisioner from the state. On errors the state must be
+// discarded.
+func (s *collectionState) remove(id string) error {
+	prov, ok := loadProvisioner(s.byID, id)
 	if !ok {
 		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", id)
 	}
 
 	var found bool
-	for i, elem := range c.sorted {
+	for i, elem := range s.sorted {
 		if elem.provisioner.GetID() != id {
 			continue
 		}
 		// Remove index in sorted list
-		copy(c.sorted[i:], c.sorted[i+1:])           // Shift a[i+1:] left one index.
-		c.sorted[len(c.sorted)-1] = uidProvisioner{} // Erase last element (write zero value).
-		c.sorted = c.sorted[:len(c.sorted)-1]        // Truncate slice.
+		copy(s.sorted[i:], s.sorted[i+1:])           // Shift a[i+1:] left one index.
+		s.sorted[len(s.sorted)-1] = uidProvisioner{} // Erase last element (write zero value).
+		s.sorted = s.sorted[:len(s.sorted)-1]        // Truncate slice.
 		found = true
 		break
 	}
@@ -243,65 +432,33 @@ func (c *Collection) Remove(id string) error {
 		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found in sorted list", prov.GetName())
 	}
 
-	c.byID.Delete(id)
-	c.byName.Delete(prov.GetName())
-	c.byTokenID.Delete(prov.GetIDForToken())
+	s.byID.Delete(id)
+	s.byName.Delete(prov.GetName())
+	s.byTokenID.Delete(prov.GetIDForToken())
 	if kid, _, ok := prov.GetEncryptedKey(); ok {
-		c.byKey.Delete(kid)
-	}
-
-	return nil
-}
-
-// Update updates the given provisioner in all related lists and collections.
-func (c *Collection) Update(nu Interface) error {
-	old, ok := c.Load(nu.GetID())
-	if !ok {
-		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", nu.GetID())
+		s.byKey.Delete(kid)
 	}
-
-	if old.GetName() != nu.GetName() {
-		if _, ok := c.LoadByName(nu.GetName()); ok {
-			return admin.NewError(admin.ErrorBadRequestType,
-				"provisioner with name %s already exists", nu.GetName())
+	if ap, ok := prov.(additionalKeysProvisioner); ok {
+		for _, id := range ap.getAdditionalIDsForToken() {
+			s.byTokenID.Delete(id)
 		}
-	}
-	if old.GetIDForToken() != nu.GetIDForToken() {
-		if _, ok := c.LoadByTokenID(nu.GetIDForToken()); ok {
-			return admin.NewError(admin.ErrorBadRequestType,
-				"provisioner with Token ID %s already exists", nu.GetIDForToken())
+		for kid := range ap.getAdditionalEncryptedKeys() {
+			s.byKey.Delete(kid)
 		}
 	}
 
-	if err := c.Remove(old.GetID()); err != nil {
-		return err
-	}
-
-	return c.Store(nu)
+	return nil
 }
 
-// Find implements pagination on a list of sorted provisioners.
-func (c *Collection) Find(cursor string, limit int) (List, string) {
-	switch {
-	case limit <= 0:
-		limit = DefaultProvisionersLimit
-	case limit > DefaultProvisionersMax:
-		limit = DefaultProvisionersMax
-	}
-
-	n := c.sorted.Len()
-	cursor = fmt.Sprintf("%040s", cursor)
-	i := sort.Search(n, func(i int) bool { return c.sorted[i].uid >= cursor })
-
-	slice := List{}
-	for ; i < n && len(slice) < limit; i++ {
-		slice = append(slice, c.sorted[i].provisioner)
+func cloneMap(m *sync.Map) *sync.Map {
+	nm := new(sync.Map)
+	if m != nil {
+		m.Range(func(k, v any) bool {
+			nm.Store(k, v)
+			return true
+		})
 	}
-
-	if i < n {
-		return slice, strings.TrimLeft(c.sorted[i].uid, "0")
-	}
-	return slice, ""
+	return nm
 }
 
 func loadProvisioner(m *sync.Map, key string) (Interface, bool) {
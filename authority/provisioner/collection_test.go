@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"go.step.sm/crypto/jose"
@@ -38,9 +39,10 @@ func TestCollection_Load(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
+			c := new(Collection)
+			c.state.Store(&collectionState{
 				byID: tt.fields.byID,
-			}
+			})
 			got, got1 := c.Load(tt.args.id)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.Load() got = %v, want %v", got, tt.want)
@@ -130,11 +132,12 @@ func TestCollection_LoadByToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
+			c := new(Collection)
+			c.state.Store(&collectionState{
 				byID:      tt.fields.byID,
 				byTokenID: tt.fields.byID,
 				audiences: tt.fields.audiences,
-			}
+			})
 			got, got1 := c.LoadByToken(tt.args.token, tt.args.claims)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.LoadByToken() got = %v, want %v", got, tt.want)
@@ -211,10 +214,11 @@ func TestCollection_LoadByCertificate(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
+			c := new(Collection)
+			c.state.Store(&collectionState{
 				byName:    tt.fields.byName,
 				audiences: tt.fields.audiences,
-			}
+			})
 			got, got1 := c.LoadByCertificate(tt.args.cert)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.LoadByCertificate() got = %v, want %v", got, tt.want)
@@ -238,7 +242,7 @@ func TestCollection_LoadEncryptedKey(t *testing.T) {
 	// Add oidc in byKey.
 	// It should not happen.
 	p2KeyID := p2.keyStore.keySet.Keys[0].KeyID
-	c.byKey.Store(p2KeyID, p2)
+	c.load().byKey.Store(p2KeyID, p2)
 
 	type args struct {
 		keyID string
@@ -266,6 +270,45 @@ func TestCollection_LoadEncryptedKey(t *testing.T) {
 	}
 }
 
+func TestCollection_additionalKeys(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	old, err := generateJWK()
+	assert.FatalError(t, err)
+	next, err := generateJWK()
+	assert.FatalError(t, err)
+	p.AdditionalKeys = []*JWKKey{
+		{Key: old.Key, EncryptedKey: old.EncryptedKey},
+		{Key: next.Key},
+	}
+
+	c := NewCollection(testAudiences)
+	assert.FatalError(t, c.Store(p))
+
+	for _, kid := range []string{p.Key.KeyID, old.Key.KeyID, next.Key.KeyID} {
+		got, ok := c.LoadByTokenID(p.Name + ":" + kid)
+		assert.True(t, ok)
+		assert.Equals(t, p, got)
+	}
+
+	key, ok := c.LoadEncryptedKey(p.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p.EncryptedKey, key)
+	key, ok = c.LoadEncryptedKey(old.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, old.EncryptedKey, key)
+	_, ok = c.LoadEncryptedKey(next.Key.KeyID)
+	assert.False(t, ok)
+
+	assert.FatalError(t, c.Remove(p.GetID()))
+	for _, kid := range []string{p.Key.KeyID, old.Key.KeyID, next.Key.KeyID} {
+		_, ok := c.LoadByTokenID(p.Name + ":" + kid)
+		assert.False(t, ok)
+	}
+	_, ok = c.LoadEncryptedKey(old.Key.KeyID)
+	assert.False(t, ok)
+}
+
 func TestCollection_Store(t *testing.T) {
 	c := NewCollection(testAudiences)
 	p1, err := generateJWK()
@@ -295,6 +338,198 @@ func TestCollection_Store(t *testing.T) {
 	}
 }
 
+func TestCollection_concurrentUpdates(t *testing.T) {
+	c, err := generateCollection(5, 0)
+	assert.FatalError(t, err)
+	list, _ := c.Find("", 0)
+
+	other, err := generateCollection(5, 0)
+	assert.FatalError(t, err)
+	for _, p := range list {
+		assert.FatalError(t, other.Store(p))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, p := range list {
+					if _, ok := c.Load(p.GetID()); !ok {
+						t.Errorf("Collection.Load() provisioner %s not found", p.GetID())
+						return
+					}
+					if _, ok := c.LoadByName(p.GetName()); !ok {
+						t.Errorf("Collection.LoadByName() provisioner %s not found", p.GetName())
+						return
+					}
+				}
+				if got, _ := c.Find("", DefaultProvisionersMax); len(got) != len(list) && len(got) != 2*len(list) {
+					t.Errorf("Collection.Find() returned %d provisioners", len(got))
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		for _, p := range list {
+			assert.FatalError(t, c.Update(p))
+		}
+		if i%2 == 0 {
+			c.Replace(other)
+		} else {
+			c2 := NewCollection(testAudiences)
+			for _, p := range list {
+				assert.FatalError(t, c2.Store(p))
+			}
+			c.Replace(c2)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestCollection_Reconfigure(t *testing.T) {
+	a, err := generateJWK()
+	assert.FatalError(t, err)
+	b, err := generateJWK()
+	assert.FatalError(t, err)
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+
+	// newJWK returns a new instance of the provisioner with the key of a or b
+	// and the given maximum duration.
+	newJWK := func(key *JWK, maxDur time.Duration) *JWK {
+		return &JWK{
+			ID:           "jwk-id",
+			Type:         "JWK",
+			Name:         a.Name,
+			Key:          key.Key,
+			EncryptedKey: key.EncryptedKey,
+			Claims: &Claims{
+				DefaultTLSDur: &Duration{Duration: 5 * time.Minute},
+				MaxTLSDur:     &Duration{Duration: maxDur},
+			},
+		}
+	}
+
+	c := NewCollection(testAudiences)
+	current := newJWK(a, time.Hour)
+	assert.FatalError(t, current.Init(config))
+	assert.FatalError(t, c.Store(current))
+
+	tests := []struct {
+		name    string
+		nu      *JWK
+		wantErr bool
+	}{
+		{"ok", newJWK(b, 2*time.Hour), false},
+		{"ok again", newJWK(a, time.Hour), false},
+		{"fail claims", newJWK(b, time.Minute), true},
+		{"fail in place", nil, true},
+		{"fail not found", func() *JWK { p := newJWK(b, 2*time.Hour); p.ID = "other-id"; return p }(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nu := tt.nu
+			if nu == nil {
+				nu = current
+			}
+			err := c.Reconfigure(nu, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collection.Reconfigure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				current = nu
+			}
+			got, ok := c.Load("jwk-id")
+			assert.Fatal(t, ok, "provisioner jwk-id not found")
+			assert.True(t, got == current, "unexpected provisioner in the collection")
+			assert.Equals(t, current.Key.KeyID, got.(*JWK).Key.KeyID)
+		})
+	}
+}
+
+func TestCollection_Reconfigure_concurrent(t *testing.T) {
+	a, err := generateJWK()
+	assert.FatalError(t, err)
+	b, err := generateJWK()
+	assert.FatalError(t, err)
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+
+	// The key of a is always used with a maximum duration of 1h, and the key
+	// of b with 2h, readers must never see a different combination.
+	durations := map[string]time.Duration{
+		a.Key.KeyID: time.Hour,
+		b.Key.KeyID: 2 * time.Hour,
+	}
+	newJWK := func(key *JWK, maxDur time.Duration) *JWK {
+		return &JWK{
+			ID:           "jwk-id",
+			Type:         "JWK",
+			Name:         a.Name,
+			Key:          key.Key,
+			EncryptedKey: key.EncryptedKey,
+			Claims: &Claims{
+				DefaultTLSDur: &Duration{Duration: 5 * time.Minute},
+				MaxTLSDur:     &Duration{Duration: maxDur},
+			},
+		}
+	}
+
+	c := NewCollection(testAudiences)
+	p := newJWK(a, time.Hour)
+	assert.FatalError(t, p.Init(config))
+	assert.FatalError(t, c.Store(p))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				v, ok := c.Load("jwk-id")
+				if !ok {
+					t.Error("Collection.Load() provisioner jwk-id not found")
+					return
+				}
+				p := v.(*JWK)
+				if got, want := p.ctl.Claimer.MaxTLSCertDuration(), durations[p.Key.KeyID]; got != want {
+					t.Errorf("provisioner with key %s has maxTLSCertDuration %s, want %s", p.Key.KeyID, got, want)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		switch i % 3 {
+		case 0:
+			assert.FatalError(t, c.Reconfigure(newJWK(b, 2*time.Hour), config))
+		case 1:
+			assert.FatalError(t, c.Reconfigure(newJWK(a, time.Hour), config))
+		default:
+			// An invalid configuration keeps the old provisioner.
+			assert.Error(t, c.Reconfigure(newJWK(b, time.Minute), config))
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
 func TestCollection_Find(t *testing.T) {
 	c, err := generateCollection(10, 10)
 	assert.FatalError(t, err)
@@ -320,14 +555,14 @@ func TestCollection_Find(t *testing.T) {
 		want  List
 		want1 string
 	}{
-		{"all", args{"", DefaultProvisionersMax}, toList(c.sorted[0:20]), ""},
-		{"0 to 19", args{"", 20}, toList(c.sorted[0:20]), ""},
-		{"0 to 9", args{"", 10}, toList(c.sorted[0:10]), trim(c.sorted[10].uid)},
-		{"9 to 19", args{trim(c.sorted[10].uid), 10}, toList(c.sorted[10:20]), ""},
-		{"1", args{trim(c.sorted[1].uid), 1}, toList(c.sorted[1:2]), trim(c.sorted[2].uid)},
-		{"1 to 5", args{trim(c.sorted[1].uid), 4}, toList(c.sorted[1:5]), trim(c.sorted[5].uid)},
-		{"defaultLimit", args{"", 0}, toList(c.sorted[0:20]), ""},
-		{"overTheLimit", args{"", DefaultProvisionersMax + 1}, toList(c.sorted[0:20]), ""},
+		{"all", args{"", DefaultProvisionersMax}, toList(c.load().sorted[0:20]), ""},
+		{"0 to 19", args{"", 20}, toList(c.load().sorted[0:20]), ""},
+		{"0 to 9", args{"", 10}, toList(c.load().sorted[0:10]), trim(c.load().sorted[10].uid)},
+		{"9 to 19", args{trim(c.load().sorted[10].uid), 10}, toList(c.load().sorted[10:20]), ""},
+		{"1", args{trim(c.load().sorted[1].uid), 1}, toList(c.load().sorted[1:2]), trim(c.load().sorted[2].uid)},
+		{"1 to 5", args{trim(c.load().sorted[1].uid), 4}, toList(c.load().sorted[1:5]), trim(c.load().sorted[5].uid)},
+		{"defaultLimit", args{"", 0}, toList(c.load().sorted[0:20]), ""},
+		{"overTheLimit", args{"", DefaultProvisionersMax + 1}, toList(c.load().sorted[0:20]), ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
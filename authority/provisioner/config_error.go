@@ -0,0 +1,80 @@
+package provisioner
+
+import (
+	"strings"
+)
+
+// FieldError is a problem found in a field of the configuration of a
+// provisioner. Field is the JSON name of the field, e.g. "instanceAge", and
+// Reason describes the problem.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return e.Reason
+}
+
+// ConfigError is the error returned by the Init method of the GCP, AWS, Azure,
+// OIDC and JWK provisioners when their configuration is not valid. Instead of
+// stopping on the first problem, these provisioners validate all their fields,
+// and the error contains every invalid field with its reason, so a
+// misconfiguration can be fixed at once. It can be retrieved with errors.As
+// and marshaled as JSON.
+type ConfigError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+// Error implements the error interface. If there is only one problem, it
+// returns its reason.
+func (e *ConfigError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Reason
+	}
+	reasons := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		reasons[i] = fe.Reason
+	}
+	return "provisioner configuration is not valid: " + strings.Join(reasons, "; ")
+}
+
+// Fields returns the names of the invalid fields in the order they were found.
+// A field appears once for each of its problems.
+func (e *ConfigError) Fields() []string {
+	fields := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		fields[i] = fe.Field
+	}
+	return fields
+}
+
+// configValidator collects the problems found while validating the
+// configuration of a provisioner.
+type configValidator struct {
+	errors []*FieldError
+}
+
+// check adds a problem in the given field if the condition is true.
+func (v *configValidator) check(cond bool, field, reason string) {
+	if cond {
+		v.errors = append(v.errors, &FieldError{Field: field, Reason: reason})
+	}
+}
+
+// add adds a problem in the given field if the error is not nil.
+func (v *configValidator) add(field string, err error) {
+	if err != nil {
+		v.errors = append(v.errors, &FieldError{Field: field, Reason: err.Error()})
+	}
+}
+
+// err returns a *ConfigError with all the problems found, or nil if there are
+// none.
+func (v *configValidator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ConfigError{Errors: v.errors}
+}
@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func TestConfigError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *ConfigError
+		want string
+	}{
+		{"one", &ConfigError{Errors: []*FieldError{{"name", "provisioner name cannot be empty"}}}, "provisioner name cannot be empty"},
+		{"many", &ConfigError{Errors: []*FieldError{
+			{"name", "provisioner name cannot be empty"},
+			{"instanceAge", "provisioner instanceAge cannot be negative"},
+		}}, "provisioner configuration is not valid: provisioner name cannot be empty; provisioner instanceAge cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.err.Error())
+		})
+	}
+}
+
+func TestConfigError_MarshalJSON(t *testing.T) {
+	err := &ConfigError{Errors: []*FieldError{
+		{"type", "provisioner type cannot be empty"},
+		{"labels", `provisioner labels contains an invalid key "Env"`},
+	}}
+	b, e := json.Marshal(err)
+	assert.FatalError(t, e)
+	assert.Equals(t, `{"errors":[{"field":"type","reason":"provisioner type cannot be empty"},{"field":"labels","reason":"provisioner labels contains an invalid key \"Env\""}]}`, string(b))
+}
+
+func Test_configValidator(t *testing.T) {
+	var v configValidator
+	assert.Nil(t, v.err())
+
+	v.check(false, "type", "provisioner type cannot be empty")
+	v.add("name", nil)
+	assert.Nil(t, v.err())
+
+	v.check(true, "type", "provisioner type cannot be empty")
+	v.add("name", errors.New("provisioner name cannot be empty"))
+	var ce *ConfigError
+	if assert.True(t, errors.As(v.err(), &ce)) {
+		assert.Equals(t, []string{"type", "name"}, ce.Fields())
+	}
+}
+
+func TestProvisioner_Init_configError(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		p          Interface
+		wantFields []string
+	}{
+		{"gcp", &GCP{
+			Type: "GCP", InstanceAge: Duration{Duration: -1}, ServiceAccountsMatch: "foo",
+			OverwriteCommonName: true, Labels: map[string]string{"Env": "prod", "team": "Ops"},
+		}, []string{"name", "instanceAge", "serviceAccounts", "overwriteCommonName", "labels", "labels"}},
+		{"aws", &AWS{
+			Name: "aws", IMDSVersions: []string{"v3"}, AllowedRoles: []string{"foo", "bar"},
+		}, []string{"type", "imdsVersions", "allowedRoles", "allowedRoles"}},
+		{"azure", &Azure{
+			Type: "Azure", Name: "azure", ResourceGroups: []string{""}, IdentityClientID: "foo",
+			CustomSANsMode: "foo",
+		}, []string{"tenantID", "resourceGroups", "identityClientID", "customSANsMode"}},
+		{"oidc", &OIDC{
+			Type: "OIDC", Name: "oidc", GroupsClaim: "roles", TerraformRunPhases: []string{"destroy"},
+			CommonName: &OIDCCommonName{Template: " "}, ListenAddress: "localhost",
+		}, []string{"clientID", "configurationEndpoint", "groupsClaim", "terraformRunPhases", "commonName", "listenAddress"}},
+		{"jwk", &JWK{
+			Type: "JWK", Key: key, AllowedTokenAlgorithms: []string{"none"}, AllowedCIDRs: []string{"10.0.0.0"},
+			DecrypterKeyURI: "softkms:",
+		}, []string{"name", "decrypterKey", "allowedTokenAlgorithms", "allowedCIDRs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			var ce *ConfigError
+			if assert.True(t, errors.As(err, &ce), err) {
+				assert.Equals(t, tt.wantFields, ce.Fields())
+			}
+		})
+	}
+
+	// A single problem keeps its own message.
+	p := &JWK{Type: "JWK", Name: "jwk", Key: &jose.JSONWebKey{}, TrustedProxies: []string{"10.0.0.1/32"}}
+	if err := p.Init(config); assert.Error(t, err) {
+		assert.Equals(t, "provisioner trustedProxies requires allowedCIDRs", err.Error())
+	}
+}
@@ -3,7 +3,9 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -18,14 +20,46 @@ import (
 // functions.
 type Controller struct {
 	Interface
-	Audiences             *Audiences
-	Claimer               *Claimer
-	IdentityFunc          GetIdentityFunc
-	AuthorizeRenewFunc    AuthorizeRenewFunc
-	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
-	policy                *policyEngine
-	webhookClient         *http.Client
-	webhooks              []*Webhook
+	Audiences               *Audiences
+	Claimer                 *Claimer
+	IdentityFunc            GetIdentityFunc
+	AuthorizeRenewFunc      AuthorizeRenewFunc
+	AuthorizeSSHRenewFunc   AuthorizeSSHRenewFunc
+	SANResolver             SANResolver
+	KeyBlocklist            KeyBlocklist
+	TokenCache              TokenCache
+	RateLimiter             RateLimiter
+	rateLimit               *RateLimitOptions
+	signConcurrency         *ConcurrencyLimiter
+	sanManifest             *sanManifest
+	policy                  *policyEngine
+	webhookClient           *http.Client
+	webhooks                []*Webhook
+	x509Signer              string
+	x509AllowedSigners      []string
+	x509UniqueSAN           bool
+	x509SigAlgs             []x509.SignatureAlgorithm
+	x509SigAlg              x509.SignatureAlgorithm
+	x509DuplicateDNSNames   DuplicateDNSNamesPolicy
+	x509KeyPolicy           *keyPolicyValidator
+	x509Schedule            *validitySchedule
+	x509ExtKeyUsages        []x509.ExtKeyUsage
+	x509SerialGenerator     SerialGenerator
+	x509CRLDPs              []string
+	x509Policies            *certificatePoliciesModifier
+	x509QCStatements        *qcStatementsModifier
+	x509NameConstraints     *nameConstraintsValidator
+	x509RenewAfter          *RenewAfterOptions
+	x509AlternateChain      X509AlternateChain
+	x509Transparency        *X509CertificateTransparency
+	x509KeyAttestation      *keyAttestationVerifier
+	x509SubjectKeyID        SubjectKeyIDMethod
+	x509ForbidCommonName    bool
+	x509TokenHash           *TokenHashOptions
+	sshStrictHostPrincipals bool
+	sshExtensions           *sshCertExtensionsModifier
+	sshCertTypes            *sshCertTypesValidator
+	minConnectionTLSVersion uint16
 }
 
 // NewController initializes a new provisioner controller.
@@ -38,19 +72,218 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	if err := options.GetX509Options().loadTemplateFiles(); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().loadTemplateFiles(); err != nil {
+		return nil, err
+	}
+	if err := options.GetX509Options().ValidateTemplate(); err != nil {
+		return nil, err
+	}
+	sigAlgs, err := parseSignatureAlgorithms(options.GetX509Options().GetAllowedSignatureAlgorithms())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSigner(options.GetX509Options().GetSigner(), config.X509SignerKeys); err != nil {
+		return nil, err
+	}
+	sigAlg, err := parseSignerSignatureAlgorithm(options.GetX509Options().GetSignatureAlgorithm(), options.GetX509Options().GetSigner(), config.X509SignerKeys)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAllowedSigners(options.GetX509Options().GetAllowedSigners(), sigAlg, config.X509SignerKeys); err != nil {
+		return nil, err
+	}
+	duplicateDNSNames := options.GetX509Options().GetDuplicateDNSNames()
+	if err := duplicateDNSNames.Validate(); err != nil {
+		return nil, err
+	}
+	if duplicateDNSNames != "" && !config.DNSNamesIndex {
+		return nil, errors.Errorf("x509.duplicateDNSNames requires the database index of DNS names, enable it with db.indexDNSNames")
+	}
+	keyPolicy, err := newKeyPolicyValidator(options.GetX509Options().GetAllowedKeys())
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := newValiditySchedule(options.GetX509Options().GetValiditySchedule())
+	if err != nil {
+		return nil, err
+	}
+	extKeyUsages, err := parseExtKeyUsages(options.GetX509Options().GetAllowedExtKeyUsages())
+	if err != nil {
+		return nil, err
+	}
+	serialGenerator, err := newSerialGenerator(options.GetX509Options().GetSerialNumber())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCRLDistributionPoints(options.GetX509Options().GetCRLDistributionPoints()); err != nil {
+		return nil, err
+	}
+	policies, err := newCertificatePoliciesModifier(options.GetX509Options().GetPolicyOIDs(), options.GetX509Options().GetCPSURI())
+	if err != nil {
+		return nil, err
+	}
+	qcStatements, err := newQCStatementsModifier(options.GetX509Options().GetQCStatements())
+	if err != nil {
+		return nil, err
+	}
+	nameConstraints, err := newNameConstraintsValidator(
+		options.GetX509Options().GetPermittedDNSDomains(),
+		options.GetX509Options().GetExcludedDNSDomains(),
+		options.GetX509Options().GetPermittedIPRanges(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := options.GetX509Options().GetRenewAfter().validate(); err != nil {
+		return nil, err
+	}
+	alternateChain, err := parseAlternateChain(options.GetX509Options().GetAlternateChain(),
+		config.X509SignerKeys[options.GetX509Options().GetSigner()], config.X509Roots)
+	if err != nil {
+		return nil, err
+	}
+	transparency, err := newCertificateTransparency(options.GetX509Options().GetCertificateTransparency())
+	if err != nil {
+		return nil, err
+	}
+	keyAttestation, err := newKeyAttestationVerifier(options.GetX509Options().GetKeyAttestation())
+	if err != nil {
+		return nil, err
+	}
+	subjectKeyID := options.GetX509Options().GetSubjectKeyID()
+	if err := subjectKeyID.Validate(); err != nil {
+		return nil, err
+	}
+	if tokenHash := options.GetX509Options().GetTokenHash(); tokenHash != nil {
+		if err := tokenHash.validate(); err != nil {
+			return nil, err
+		}
+		switch p.GetType() {
+		case TypeJWK, TypeOIDC, TypeGCP, TypeAWS, TypeAzure, TypeK8sSA, TypeX5C, TypeNebula, TypeEmail:
+		default:
+			return nil, errors.Errorf("x509.tokenHash is not supported by %s provisioners", p.GetType())
+		}
+	}
+	if options.GetX509Options().IsCommonNameForbidden() && p.GetType() == TypeSSHPOP {
+		return nil, errors.Errorf("forbidCommonName is not supported by %s provisioners", p.GetType())
+	}
+	for _, wh := range options.GetWebhooks() {
+		if err := wh.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	rateLimit := options.GetRateLimitOptions()
+	if err := rateLimit.Validate(); err != nil {
+		return nil, err
+	}
+	rateLimiter := config.RateLimiter
+	if rateLimit != nil && rateLimiter == nil {
+		rateLimiter = NewMemoryRateLimiter(DefaultRateLimiterSize)
+	}
+	signConcurrency := options.GetSignConcurrencyOptions()
+	if err := signConcurrency.Validate(); err != nil {
+		return nil, err
+	}
+	if signConcurrency != nil && p.GetType() == TypeSSHPOP {
+		return nil, errors.Errorf("signConcurrency is not supported by %s provisioners", p.GetType())
+	}
+	var signLimiter *ConcurrencyLimiter
+	if signConcurrency != nil {
+		signLimiter = config.SignConcurrencyLimiters.Get(p.GetID(), signConcurrency)
+	}
+	if o := options.GetSANManifestOptions(); o != nil {
+		switch p.GetType() {
+		case TypeAWS, TypeGCP, TypeAzure:
+		default:
+			return nil, errors.Errorf("sanManifest is not supported by %s provisioners", p.GetType())
+		}
+	}
+	manifest, err := newSANManifest(options.GetSANManifestOptions())
+	if err != nil {
+		return nil, err
+	}
+	sshExtensions, err := newSSHCertExtensionsModifier(p, options.GetSSHOptions())
+	if err != nil {
+		return nil, err
+	}
+	sshCertTypes, err := newSSHCertTypesValidator(p, options.GetSSHOptions())
+	if err != nil {
+		return nil, err
+	}
+	minConnectionTLSVersion, err := parseTLSVersion(options.GetMinConnectionTLSVersion())
+	if err != nil {
+		return nil, err
+	}
+	if minConnectionTLSVersion != 0 {
+		switch p.GetType() {
+		case TypeJWK, TypeOIDC, TypeGCP, TypeAWS, TypeAzure, TypeK8sSA, TypeX5C, TypeNebula, TypeEmail, TypeK8sCSR:
+		default:
+			return nil, errors.Errorf("minConnectionTLSVersion is not supported by %s provisioners", p.GetType())
+		}
+	}
 	return &Controller{
-		Interface:             p,
-		Audiences:             &config.Audiences,
-		Claimer:               claimer,
-		IdentityFunc:          config.GetIdentityFunc,
-		AuthorizeRenewFunc:    config.AuthorizeRenewFunc,
-		AuthorizeSSHRenewFunc: config.AuthorizeSSHRenewFunc,
-		policy:                policy,
-		webhookClient:         config.WebhookClient,
-		webhooks:              options.GetWebhooks(),
+		Interface:               p,
+		Audiences:               &config.Audiences,
+		Claimer:                 claimer,
+		IdentityFunc:            config.GetIdentityFunc,
+		AuthorizeRenewFunc:      config.AuthorizeRenewFunc,
+		AuthorizeSSHRenewFunc:   config.AuthorizeSSHRenewFunc,
+		SANResolver:             config.SANResolver,
+		KeyBlocklist:            config.KeyBlocklist,
+		TokenCache:              config.TokenCache,
+		RateLimiter:             rateLimiter,
+		rateLimit:               rateLimit,
+		signConcurrency:         signLimiter,
+		sanManifest:             manifest,
+		policy:                  policy,
+		webhookClient:           config.WebhookClient,
+		webhooks:                options.GetWebhooks(),
+		x509Signer:              options.GetX509Options().GetSigner(),
+		x509AllowedSigners:      options.GetX509Options().GetAllowedSigners(),
+		x509UniqueSAN:           options.GetX509Options().IsUniqueSANEnabled(),
+		x509SigAlgs:             sigAlgs,
+		x509SigAlg:              sigAlg,
+		x509DuplicateDNSNames:   duplicateDNSNames,
+		x509KeyPolicy:           keyPolicy,
+		x509Schedule:            schedule,
+		x509ExtKeyUsages:        extKeyUsages,
+		x509SerialGenerator:     serialGenerator,
+		x509CRLDPs:              options.GetX509Options().GetCRLDistributionPoints(),
+		x509Policies:            policies,
+		x509QCStatements:        qcStatements,
+		x509NameConstraints:     nameConstraints,
+		x509RenewAfter:          options.GetX509Options().GetRenewAfter(),
+		x509AlternateChain:      alternateChain,
+		x509Transparency:        transparency,
+		x509KeyAttestation:      keyAttestation,
+		x509SubjectKeyID:        subjectKeyID,
+		x509ForbidCommonName:    options.GetX509Options().IsCommonNameForbidden(),
+		x509TokenHash:           options.GetX509Options().GetTokenHash(),
+		sshStrictHostPrincipals: options.GetSSHOptions().IsStrictHostPrincipals(),
+		sshExtensions:           sshExtensions,
+		sshCertTypes:            sshCertTypes,
+		minConnectionTLSVersion: minConnectionTLSVersion,
 	}, nil
 }
 
+// ControllerGetter is the interface implemented by the provisioners with a
+// Controller. The authority uses it to apply the options of the provisioner
+// that are not part of a sign request, e.g. on renewals.
+type ControllerGetter interface {
+	GetController() *Controller
+}
+
+// GetClaimer returns the claimer of the provisioner.
+func (c *Controller) GetClaimer() *Claimer {
+	if c == nil {
+		return nil
+	}
+	return c.Claimer
+}
+
 // GetIdentity returns the identity for a given email.
 func (c *Controller) GetIdentity(ctx context.Context, email string) (*Identity, error) {
 	if c.IdentityFunc != nil {
@@ -91,6 +324,391 @@ func (c *Controller) newWebhookController(templateData WebhookSetter, certType l
 	}
 }
 
+// newX509SignOptions returns the SignOptions built from the X.509 options and
+// claims of the provisioner. They are common to all the provisioners that sign
+// X.509 certificates.
+func (c *Controller) newX509SignOptions() []SignOption {
+	so := []SignOption{
+		c.newX509SignerOption(),
+		c.newUniqueSANOption(),
+		c.newSignatureAlgorithmOption(),
+		c.newDuplicateDNSNamesOption(),
+		c.newSerialGeneratorOption(),
+	}
+	so = append(so, c.newKeyPolicyOptions()...)
+	so = append(so, c.newKeyBlocklistOptions()...)
+	so = append(so, c.newX509AllowedSignersOptions()...)
+	so = append(so, c.newValidityScheduleOptions()...)
+	so = append(so, c.newBackdateOptions()...)
+	so = append(so, c.newExtKeyUsageOptions()...)
+	so = append(so, c.newCRLDistributionPointsOptions()...)
+	so = append(so, c.newCertificatePoliciesOptions()...)
+	so = append(so, c.newQCStatementsOptions()...)
+	so = append(so, c.newNameConstraintsOptions()...)
+	so = append(so, c.newRenewAfterOptions()...)
+	so = append(so, c.newAlternateChainOptions()...)
+	so = append(so, c.newCertificateTransparencyOptions()...)
+	so = append(so, c.newKeyAttestationOptions()...)
+	so = append(so, c.newSubjectKeyIDOptions()...)
+	so = append(so, c.newForbidCommonNameOptions()...)
+	return append(so, c.newSignConcurrencyOptions()...)
+}
+
+// newX509SignerOption returns the SignOption that selects the X.509 signer
+// configured for the provisioner.
+func (c *Controller) newX509SignerOption() X509SignerName {
+	return X509SignerName(c.x509Signer)
+}
+
+// newX509AllowedSignersOptions returns the SignOption with the X.509 signers
+// that a sign request can select. It returns no options if the requests
+// cannot select the signer.
+func (c *Controller) newX509AllowedSignersOptions() []SignOption {
+	if len(c.x509AllowedSigners) == 0 {
+		return nil
+	}
+	return []SignOption{X509AllowedSigners(c.x509AllowedSigners)}
+}
+
+// newUniqueSANOption returns the SignOption that adds a unique URI SAN to the
+// certificate if it is enabled in the provisioner.
+func (c *Controller) newUniqueSANOption() *uniqueSANOption {
+	return newUniqueSANOption(c.x509UniqueSAN)
+}
+
+// newSignatureAlgorithmOption returns the SignOption that sets the signature
+// algorithm configured in the provisioner, or the one selected in the sign
+// request if the provisioner allows it.
+func (c *Controller) newSignatureAlgorithmOption() *signatureAlgorithmOption {
+	o := newSignatureAlgorithmOption(c.x509SigAlgs)
+	o.Forced = c.x509SigAlg
+	return o
+}
+
+// GetSignatureAlgorithm returns the signature algorithm configured in the
+// provisioner, or x509.UnknownSignatureAlgorithm if it is not configured.
+func (c *Controller) GetSignatureAlgorithm() x509.SignatureAlgorithm {
+	if c == nil {
+		return x509.UnknownSignatureAlgorithm
+	}
+	return c.x509SigAlg
+}
+
+// newDuplicateDNSNamesOption returns the SignOption with the policy used when
+// an active certificate already has one of the DNS names requested.
+func (c *Controller) newDuplicateDNSNamesOption() DuplicateDNSNamesPolicy {
+	return c.x509DuplicateDNSNames
+}
+
+// newSerialGeneratorOption returns the SignOption with the generator of the
+// serial numbers configured in the provisioner.
+func (c *Controller) newSerialGeneratorOption() X509SerialGenerator {
+	return X509SerialGenerator{c.x509SerialGenerator}
+}
+
+// newKeyPolicyOptions returns the SignOption that validates the public key of
+// the certificate request against the keys allowed by the provisioner. It
+// returns no options if the keys are not restricted.
+func (c *Controller) newKeyPolicyOptions() []SignOption {
+	if c.x509KeyPolicy == nil {
+		return nil
+	}
+	return []SignOption{c.x509KeyPolicy}
+}
+
+// newKeyBlocklistOptions returns the SignOption that rejects the certificate
+// requests with a public key in the key blocklist. It returns no options if
+// the blocklist is not configured.
+func (c *Controller) newKeyBlocklistOptions() []SignOption {
+	if c.KeyBlocklist == nil {
+		return nil
+	}
+	return []SignOption{keyBlocklistValidator{blocklist: c.KeyBlocklist}}
+}
+
+// newSSHExtensionsOptions returns the SignOption that sets the extensions and
+// critical options of the provisioner in SSH user certificates. It returns no
+// options if they are not configured.
+func (c *Controller) newSSHExtensionsOptions() []SignOption {
+	if c.sshExtensions == nil {
+		return nil
+	}
+	return []SignOption{c.sshExtensions}
+}
+
+// newSSHCertTypesOptions returns the SignOption that rejects the SSH
+// certificates with a type not allowed by the provisioner. It returns no
+// options if all the types are allowed.
+func (c *Controller) newSSHCertTypesOptions() []SignOption {
+	if c.sshCertTypes == nil {
+		return nil
+	}
+	return []SignOption{c.sshCertTypes}
+}
+
+// newValidityScheduleOptions returns the SignOption that confines the validity
+// of the certificate to the schedule of the provisioner. It returns no options
+// if the validity is not restricted.
+func (c *Controller) newValidityScheduleOptions() []SignOption {
+	if c.x509Schedule == nil {
+		return nil
+	}
+	return []SignOption{validityScheduleModifier{
+		schedule: c.x509Schedule,
+		now:      time.Now(),
+	}}
+}
+
+// newExtKeyUsageOptions returns the SignOption that sets the extended key
+// usages of the certificate to the ones allowed by the provisioner. It returns
+// no options if the extended key usages are not restricted.
+func (c *Controller) newExtKeyUsageOptions() []SignOption {
+	if len(c.x509ExtKeyUsages) == 0 {
+		return nil
+	}
+	return []SignOption{extKeyUsageModifier(c.x509ExtKeyUsages)}
+}
+
+// newCRLDistributionPointsOptions returns the SignOption that sets the CRL
+// distribution points of the certificate to the ones configured in the
+// provisioner. It returns no options if the provisioner does not configure
+// them.
+func (c *Controller) newCRLDistributionPointsOptions() []SignOption {
+	if len(c.x509CRLDPs) == 0 {
+		return nil
+	}
+	return []SignOption{crlDistributionPointsModifier(c.x509CRLDPs)}
+}
+
+// newCertificatePoliciesOptions returns the SignOption that sets the
+// Certificate Policies extension of the certificate. It returns no options if
+// the provisioner does not configure the policies.
+func (c *Controller) newCertificatePoliciesOptions() []SignOption {
+	if c.x509Policies == nil {
+		return nil
+	}
+	return []SignOption{c.x509Policies}
+}
+
+// newQCStatementsOptions returns the SignOption that sets the QCStatements
+// extension of the certificate. It returns no options if the provisioner does
+// not configure the statements.
+func (c *Controller) newQCStatementsOptions() []SignOption {
+	if c.x509QCStatements == nil {
+		return nil
+	}
+	return []SignOption{c.x509QCStatements}
+}
+
+// newNameConstraintsOptions returns the SignOption that validates the SANs of
+// the certificate against the name constraints of the provisioner. It returns
+// no options if the provisioner does not configure them.
+func (c *Controller) newNameConstraintsOptions() []SignOption {
+	if c.x509NameConstraints == nil {
+		return nil
+	}
+	return []SignOption{c.x509NameConstraints}
+}
+
+// newRenewAfterOptions returns the SignOption that adds the extension with the
+// recommended renewal time to the certificate. It returns no options if the
+// provisioner does not configure it.
+func (c *Controller) newRenewAfterOptions() []SignOption {
+	if c.x509RenewAfter == nil {
+		return nil
+	}
+	return []SignOption{renewAfterEnforcer{options: c.x509RenewAfter}}
+}
+
+// GetRenewAfter returns the options of the recommended renewal time extension
+// of the certificates, or nil if the provisioner does not add it.
+func (c *Controller) GetRenewAfter() *RenewAfterOptions {
+	if c == nil {
+		return nil
+	}
+	return c.x509RenewAfter
+}
+
+// newAlternateChainOptions returns the SignOption with the alternate chain of
+// the certificates. It returns no options if the provisioner does not
+// configure it.
+func (c *Controller) newAlternateChainOptions() []SignOption {
+	if len(c.x509AlternateChain) == 0 {
+		return nil
+	}
+	return []SignOption{c.x509AlternateChain}
+}
+
+// GetCertificateTransparency returns the CT logs where the precertificates are
+// submitted, or nil if they are not configured.
+func (c *Controller) GetCertificateTransparency() *X509CertificateTransparency {
+	if c == nil {
+		return nil
+	}
+	return c.x509Transparency
+}
+
+// newCertificateTransparencyOptions returns the SignOption with the CT logs
+// where the precertificates are submitted. It returns no options if the
+// provisioner does not configure them.
+func (c *Controller) newCertificateTransparencyOptions() []SignOption {
+	if c.x509Transparency == nil {
+		return nil
+	}
+	return []SignOption{c.x509Transparency}
+}
+
+// newKeyAttestationOptions returns the SignOptions that verify the key
+// attestation of the certificate request and record the result in the
+// certificate. It returns no options if the provisioner does not verify them.
+func (c *Controller) newKeyAttestationOptions() []SignOption {
+	if c.x509KeyAttestation == nil {
+		return nil
+	}
+	return c.x509KeyAttestation.newOptions()
+}
+
+// newSubjectKeyIDOptions returns the SignOption that sets the subject key
+// identifier of the certificate. It returns no options if the provisioner does
+// not configure the method.
+func (c *Controller) newSubjectKeyIDOptions() []SignOption {
+	if c.x509SubjectKeyID == "" {
+		return nil
+	}
+	return []SignOption{subjectKeyIDModifier{method: c.x509SubjectKeyID}}
+}
+
+// newForbidCommonNameOptions returns the SignOptions that reject the
+// certificate requests with a common name and remove the common name of the
+// certificate. It returns no options if the provisioner allows common names.
+func (c *Controller) newForbidCommonNameOptions() []SignOption {
+	if !c.x509ForbidCommonName {
+		return nil
+	}
+	return []SignOption{forbidCommonNameValidator{}, forbidCommonNameModifier{}}
+}
+
+// newTokenHashOptions returns the SignOption that adds the extension with the
+// hash of the given token to the certificate. It returns no options if the
+// provisioner does not configure it.
+func (c *Controller) newTokenHashOptions(token string) []SignOption {
+	if c.x509TokenHash == nil {
+		return nil
+	}
+	return []SignOption{tokenHashEnforcer{options: c.x509TokenHash, token: token}}
+}
+
+// newBackdateOptions returns the SignOption that sets the backdate of the
+// notBefore of the certificate if the provisioner configures one. It returns no
+// options if the backdate of the authority must be used.
+func (c *Controller) newBackdateOptions() []SignOption {
+	backdate, ok := c.Claimer.TLSBackdate()
+	if !ok {
+		return nil
+	}
+	return []SignOption{X509Backdate(backdate)}
+}
+
+// newSANResolverOptions calls the SANResolver, if configured, with the claims
+// of the given token and returns the SignOption that appends the resolved
+// subject alternative names to the certificate. The token must be validated
+// before calling this method. The resolver is not called in a dry run.
+func (c *Controller) newSANResolverOptions(ctx context.Context, token string) ([]SignOption, error) {
+	if c.SANResolver == nil || DryRunFromContext(ctx) {
+		return nil, nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing token")
+	}
+	sans, err := c.SANResolver.ResolveSANs(ctx, &SANResolverRequest{
+		Provisioner: c.Interface,
+		Claims:      claims,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving subject alternative names")
+	}
+	if sans == nil {
+		return nil, nil
+	}
+	return []SignOption{resolvedSANsModifier(*sans)}, nil
+}
+
+// useToken marks the token with the given key as used until the expiration
+// time. It returns an error if the token has already been used. Tokens are not
+// marked in a dry run.
+func (c *Controller) useToken(ctx context.Context, key string, expiresAt time.Time) error {
+	if c.TokenCache == nil || DryRunFromContext(ctx) {
+		return nil
+	}
+	ok, err := c.TokenCache.Use(key, expiresAt)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error using token cache")
+	}
+	if !ok {
+		return authorizeErr(ReasonTokenReused, errs.Unauthorized("token already used"))
+	}
+	return nil
+}
+
+// allowRequest returns an error if the rate limit of the provisioner has been
+// exceeded. Depending on the configured key, the requests are counted for the
+// whole provisioner, for each subject or for each instance. If the instance id
+// is empty, the subject is used. Requests are not counted in a dry run.
+func (c *Controller) allowRequest(ctx context.Context, subject, instanceID string) error {
+	if c.rateLimit == nil || c.RateLimiter == nil || DryRunFromContext(ctx) {
+		return nil
+	}
+	key := c.GetID()
+	switch c.rateLimit.Key {
+	case RateLimitKeySubject:
+		key += ".subject." + subject
+	case RateLimitKeyInstance:
+		if instanceID != "" {
+			key += ".instance." + instanceID
+		} else {
+			key += ".subject." + subject
+		}
+	}
+	ok, err := c.RateLimiter.Allow(key, c.rateLimit.RequestsPerSecond, c.rateLimit.GetBurst())
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error using rate limiter")
+	}
+	if !ok {
+		return authorizeErr(ReasonRateLimited, errs.New(http.StatusTooManyRequests, "rate limit exceeded"))
+	}
+	return nil
+}
+
+// newSignConcurrencyOptions returns the SignOption with the limiter of the
+// concurrent sign operations of the provisioner. It returns no options if the
+// concurrency is not limited.
+func (c *Controller) newSignConcurrencyOptions() []SignOption {
+	if c.signConcurrency == nil {
+		return nil
+	}
+	return []SignOption{c.signConcurrency}
+}
+
+// newSANManifestOptions returns the SignOption that restricts the SANs of the
+// certificate to the ones in the manifest for the given instance. It returns an
+// error if the manifest is strict and the instance is not in it.
+func (c *Controller) newSANManifestOptions(instanceID string) ([]SignOption, error) {
+	return c.sanManifest.newOptions(instanceID)
+}
+
+// newValidityValidator returns the validator of the certificate validity with
+// the minimum and maximum durations and the notBefore offset and backdates of
+// the provisioner.
+func (c *Controller) newValidityValidator() *validityValidator {
+	v := newValidityValidator(c.Claimer.MinTLSCertDuration(), c.Claimer.MaxTLSCertDuration())
+	v.clamp = c.Claimer.ClampTLSCertDuration()
+	v.maxNotBeforeOffset = c.Claimer.MaxTLSNotBeforeOffset()
+	v.maxBackdate = c.Claimer.MaxTLSBackdate()
+	v.backdate, _ = c.Claimer.TLSBackdate()
+	return v
+}
+
 // Identity is the type representing an externally supplied identity that is used
 // by provisioners to populate certificate fields.
 type Identity struct {
@@ -109,6 +727,39 @@ type AuthorizeRenewFunc func(ctx context.Context, p *Controller, cert *x509.Cert
 // given SSH certificate is enabled.
 type AuthorizeSSHRenewFunc func(ctx context.Context, p *Controller, cert *ssh.Certificate) error
 
+// SANResolverRequest contains the information passed to a SANResolver.
+type SANResolverRequest struct {
+	// Provisioner is the provisioner that validated the token.
+	Provisioner Interface
+	// Claims contains the claims of the validated token. On AWS, the
+	// amazon.document claim is the base64 encoded instance identity document.
+	Claims map[string]interface{}
+}
+
+// ResolvedSANs contains the subject alternative names returned by a
+// SANResolver.
+type ResolvedSANs struct {
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+}
+
+// SANResolver is the interface used to add subject alternative names to the
+// X.509 certificates authorized by the provisioners. ResolveSANs is called in
+// AuthorizeSign after the token has been validated, and the names returned are
+// appended to the certificate. An error rejects the request.
+type SANResolver interface {
+	ResolveSANs(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error)
+}
+
+// SANResolverFunc is an adapter to use a function as a SANResolver.
+type SANResolverFunc func(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error)
+
+// ResolveSANs implements SANResolver and calls the function.
+func (fn SANResolverFunc) ResolveSANs(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error) {
+	return fn(ctx, req)
+}
+
 // DefaultIdentityFunc return a default identity depending on the provisioner
 // type. For OIDC email is always present and the usernames might
 // contain empty strings.
@@ -137,8 +788,10 @@ func DefaultIdentityFunc(_ context.Context, p Interface, email string) (*Identit
 
 // DefaultAuthorizeRenew is the default implementation of AuthorizeRenew. It
 // will return an error if the provisioner has the renewal disabled, if the
-// certificate is not yet valid or if the certificate is expired and renew after
-// expiry is disabled.
+// certificate is not yet valid, if the certificate is expired for longer than
+// the renewal grace period and renew after expiry is disabled, if the
+// certificate was first issued before the maximum renewal chain duration or if
+// the certificate has been renewed the maximum number of times.
 func DefaultAuthorizeRenew(_ context.Context, p *Controller, cert *x509.Certificate) error {
 	if p.Claimer.IsDisableRenewal() {
 		return errs.Unauthorized("renew is disabled for provisioner '%s'", p.GetName())
@@ -148,19 +801,30 @@ func DefaultAuthorizeRenew(_ context.Context, p *Controller, cert *x509.Certific
 	if now.Before(cert.NotBefore) {
 		return errs.Unauthorized("certificate is not yet valid" + " " + now.UTC().Format(time.RFC3339Nano) + " vs " + cert.NotBefore.Format(time.RFC3339Nano))
 	}
-	if now.After(cert.NotAfter) && !p.Claimer.AllowRenewalAfterExpiry() {
+	if now.After(cert.NotAfter.Add(p.Claimer.RenewalGracePeriod())) && !p.Claimer.AllowRenewalAfterExpiry() {
 		// return a custom 401 Unauthorized error with a clearer message for the client
 		// TODO(hs): these errors likely need to be refactored as a whole; HTTP status codes shouldn't be in this layer.
 		return errs.New(http.StatusUnauthorized, "The request lacked necessary authorization to be completed: certificate expired on %s", cert.NotAfter)
 	}
+	if d := p.Claimer.MaxRenewalChainDuration(); d > 0 {
+		if notBefore := GetOriginalNotBefore(cert); now.Sub(notBefore) > d {
+			return errs.Unauthorized("renew is not allowed for certificates first issued more than %s ago, the certificate was first issued on %s", d, notBefore.UTC().Format(time.RFC3339))
+		}
+	}
+	if max := p.Claimer.MaxRenewals(); max > 0 {
+		// Certificates without the extension have not been renewed yet.
+		if b, _ := GetRenewalBudget(cert); b.Renewals >= max {
+			return errs.Unauthorized("renew is not allowed for certificates renewed %d times, a new certificate must be requested", b.Renewals)
+		}
+	}
 
 	return nil
 }
 
 // DefaultAuthorizeSSHRenew is the default implementation of AuthorizeSSHRenew. It
 // will return an error if the provisioner has the renewal disabled, if the
-// certificate is not yet valid or if the certificate is expired and renew after
-// expiry is disabled.
+// certificate is not yet valid or if the certificate is expired for longer than
+// the renewal grace period and renew after expiry is disabled.
 func DefaultAuthorizeSSHRenew(_ context.Context, p *Controller, cert *ssh.Certificate) error {
 	if p.Claimer.IsDisableRenewal() {
 		return errs.Unauthorized("renew is disabled for provisioner '%s'", p.GetName())
@@ -170,7 +834,8 @@ func DefaultAuthorizeSSHRenew(_ context.Context, p *Controller, cert *ssh.Certif
 	if after := int64(cert.ValidAfter); after < 0 || unixNow < int64(cert.ValidAfter) {
 		return errs.Unauthorized("certificate is not yet valid")
 	}
-	if before := int64(cert.ValidBefore); cert.ValidBefore != uint64(ssh.CertTimeInfinity) && (unixNow >= before || before < 0) && !p.Claimer.AllowRenewalAfterExpiry() {
+	grace := int64(p.Claimer.RenewalGracePeriod() / time.Second)
+	if before := int64(cert.ValidBefore); cert.ValidBefore != uint64(ssh.CertTimeInfinity) && (unixNow >= before+grace || before < 0) && !p.Claimer.AllowRenewalAfterExpiry() {
 		return errs.Unauthorized("certificate has expired")
 	}
 
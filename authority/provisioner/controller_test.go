@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -130,6 +131,176 @@ func TestNewController(t *testing.T) {
 				},
 			},
 		}}, nil, true},
+		{"fail signature algorithms", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				AllowedSignatureAlgorithms: []string{"SHA256-RSA", "SHA3-RSA"},
+			},
+		}}, nil, true},
+		{"fail duplicate dns names", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				DuplicateDNSNames: "replace",
+			},
+		}}, nil, true},
+		{"fail duplicate dns names without index", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				DuplicateDNSNames: DuplicateDNSNamesRevoke,
+			},
+		}}, nil, true},
+		{"fail allowed sans", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				AllowedSANs: []string{"*.*.local"},
+			},
+		}}, nil, true},
+		{"fail allowed keys", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				AllowedKeys: &AllowedKeys{Types: []string{"RSA"}, MinRSABits: 1024},
+			},
+		}}, nil, true},
+		{"fail validity schedule", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				ValiditySchedule: &ValiditySchedule{Start: "17:00", End: "09:00"},
+			},
+		}}, nil, true},
+		{"fail allowed ext key usages", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				AllowedExtKeyUsages: []string{"clientAuth", "webAuth"},
+			},
+		}}, nil, true},
+		{"fail serial number", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				SerialNumber: &SerialNumber{Prefix: "not-hex"},
+			},
+		}}, nil, true},
+		{"fail crl distribution points", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				CRLDistributionPoints: []string{"https://crl.smallstep.com", "crl.smallstep.com"},
+			},
+		}}, nil, true},
+		{"fail token hash", args{&ACME{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				TokenHash: &TokenHashOptions{},
+			},
+		}}, nil, true},
+		{"fail forbid common name", args{&SSHPOP{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				ForbidCommonName: true,
+			},
+		}}, nil, true},
+		{"fail sign concurrency", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SignConcurrency: &SignConcurrencyOptions{MaxConcurrent: 0},
+		}}, nil, true},
+		{"fail sign concurrency sshpop", args{&SSHPOP{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SignConcurrency: &SignConcurrencyOptions{MaxConcurrent: 1},
+		}}, nil, true},
+		{"fail ssh certTypes", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SSH: &SSHOptions{CertTypes: []string{"server"}},
+		}}, nil, true},
+		{"fail policy oids", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				PolicyOIDs: []string{"2.23.140.1.2.1", "2.23.140.one"},
+			},
+		}}, nil, true},
+		{"fail qc statements", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				QCStatements: []QCStatement{{ID: "0.4.0.1862.1.1"}, {ID: "0.4.0.1862.1.1"}},
+			},
+		}}, nil, true},
+		{"fail permitted ip ranges", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				PermittedIPRanges: []string{"10.0.0.0/8", "10.0.0.1"},
+			},
+		}}, nil, true},
+		{"fail renew after", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				RenewAfter: &RenewAfterOptions{Fraction: 1.5},
+			},
+		}}, nil, true},
+		{"fail alternate chain", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				AlternateChain: []byte("not a chain"),
+			},
+		}}, nil, true},
+		{"fail subject key id", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				SubjectKeyID: "method3",
+			},
+		}}, nil, true},
+		{"fail x509 template file", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				TemplateFile: "./testdata/templates/missing.tpl",
+			},
+		}}, nil, true},
+		{"fail ssh template file", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SSH: &SSHOptions{
+				TemplateFile: "./testdata/templates/missing.tpl",
+			},
+		}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -344,6 +515,23 @@ func TestController_AuthorizeSSHRenew(t *testing.T) {
 func TestDefaultAuthorizeRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().Truncate(time.Second)
+	maxChain := Duration{Duration: 90 * 24 * time.Hour}
+	grace := Duration{Duration: time.Hour}
+	mustOriginalNotBefore := func(t0 time.Time) pkix.Extension {
+		ext, err := NewOriginalNotBeforeExtension(t0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ext
+	}
+	maxRenewals := 2
+	mustRenewalBudget := func(renewals int) pkix.Extension {
+		ext, err := NewRenewalBudgetExtension(RenewalBudget{Renewals: renewals, MaxRenewals: maxRenewals})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ext
+	}
 	type args struct {
 		ctx  context.Context
 		p    *Controller
@@ -368,6 +556,34 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 			NotBefore: now.Add(-time.Hour),
 			NotAfter:  now.Add(-time.Minute),
 		}}, false},
+		{"ok renewal grace period", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalGracePeriod: &grace}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-2 * time.Hour),
+			NotAfter:  now.Add(-time.Minute),
+		}}, false},
+		{"ok renewal grace period limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalGracePeriod: &grace}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-2 * time.Hour),
+			NotAfter:  now.Add(-grace.Duration + 5*time.Second),
+		}}, false},
+		{"fail renewal grace period past limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalGracePeriod: &grace}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-2 * time.Hour),
+			NotAfter:  now.Add(-grace.Duration - time.Second),
+		}}, true},
+		{"fail expired without grace period", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, nil, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  now.Add(-time.Second),
+		}}, true},
 		{"fail disabled", args{ctx, &Controller{
 			Interface: &JWK{},
 			Claimer:   mustClaimer(t, &Claims{DisableRenewal: &trueValue}, globalProvisionerClaims),
@@ -389,6 +605,83 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 			NotBefore: now.Add(-time.Hour),
 			NotAfter:  now.Add(-time.Minute),
 		}}, true},
+		{"ok renewal chain", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewalChainDur: &maxChain}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustOriginalNotBefore(now.Add(-30 * 24 * time.Hour))},
+		}}, false},
+		{"ok renewal chain near limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewalChainDur: &maxChain}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustOriginalNotBefore(now.Add(-maxChain.Duration + 5*time.Second))},
+		}}, false},
+		{"ok renewal chain without extension", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewalChainDur: &maxChain}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  now.Add(time.Hour),
+		}}, false},
+		{"fail renewal chain past limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewalChainDur: &maxChain}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustOriginalNotBefore(now.Add(-maxChain.Duration - time.Second))},
+		}}, true},
+		{"fail renewal chain without extension", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewalChainDur: &Duration{time.Minute}, AllowRenewalAfterExpiry: &trueValue}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  now.Add(-30 * time.Minute),
+		}}, true},
+		{"ok max renewals without extension", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewals: &maxRenewals}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  now.Add(time.Hour),
+		}}, false},
+		{"ok max renewals below limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewals: &maxRenewals}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustRenewalBudget(maxRenewals - 1)},
+		}}, false},
+		{"ok max renewals disabled", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, nil, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustRenewalBudget(maxRenewals)},
+		}}, false},
+		{"fail max renewals at limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewals: &maxRenewals}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustRenewalBudget(maxRenewals)},
+		}}, true},
+		{"fail max renewals above limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{MaxRenewals: &maxRenewals}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore:  now.Add(-time.Hour),
+			NotAfter:   now.Add(time.Hour),
+			Extensions: []pkix.Extension{mustRenewalBudget(maxRenewals + 1)},
+		}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -402,6 +695,7 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 func TestDefaultAuthorizeSSHRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now()
+	grace := Duration{Duration: time.Hour}
 	type args struct {
 		ctx  context.Context
 		p    *Controller
@@ -426,6 +720,20 @@ func TestDefaultAuthorizeSSHRenew(t *testing.T) {
 			ValidAfter:  uint64(now.Add(-time.Hour).Unix()),
 			ValidBefore: uint64(now.Add(-time.Minute).Unix()),
 		}}, false},
+		{"ok renewal grace period", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalGracePeriod: &grace}, globalProvisionerClaims),
+		}, &ssh.Certificate{
+			ValidAfter:  uint64(now.Add(-2 * time.Hour).Unix()),
+			ValidBefore: uint64(now.Add(-grace.Duration + 5*time.Second).Unix()),
+		}}, false},
+		{"fail renewal grace period past limit", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalGracePeriod: &grace}, globalProvisionerClaims),
+		}, &ssh.Certificate{
+			ValidAfter:  uint64(now.Add(-2 * time.Hour).Unix()),
+			ValidBefore: uint64(now.Add(-grace.Duration).Unix()),
+		}}, true},
 		{"fail disabled", args{ctx, &Controller{
 			Interface: &JWK{},
 			Claimer:   mustClaimer(t, &Claims{DisableRenewal: &trueValue}, globalProvisionerClaims),
@@ -494,3 +802,107 @@ func Test_newWebhookController(t *testing.T) {
 		}
 	}
 }
+
+func TestController_newSANResolverOptions(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := generateSimpleToken("issuer", "audience", jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sans := &ResolvedSANs{DNSNames: []string{"foo.internal"}}
+	resolver := func(s *ResolvedSANs, err error) SANResolver {
+		return SANResolverFunc(func(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error) {
+			if req.Claims["iss"] != "issuer" {
+				t.Errorf("SANResolverRequest.Claims = %v", req.Claims)
+			}
+			return s, err
+		})
+	}
+
+	tests := []struct {
+		name     string
+		resolver SANResolver
+		token    string
+		want     []SignOption
+		wantErr  bool
+	}{
+		{"ok no resolver", nil, token, nil, false},
+		{"ok", resolver(sans, nil), token, []SignOption{resolvedSANsModifier(*sans)}, false},
+		{"ok no sans", resolver(nil, nil), token, nil, false},
+		{"fail resolver", resolver(nil, fmt.Errorf("not allowed")), token, nil, true},
+		{"fail token", resolver(sans, nil), "token", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{SANResolver: tt.resolver}
+			got, err := c.newSANResolverOptions(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Controller.newSANResolverOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Controller.newSANResolverOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The resolver is not called in a dry run.
+	c := &Controller{SANResolver: resolver(nil, fmt.Errorf("not allowed"))}
+	got, err := c.newSANResolverOptions(NewContextWithDryRun(context.Background()), token)
+	if err != nil || got != nil {
+		t.Errorf("Controller.newSANResolverOptions() = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestController_newBackdateOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   []SignOption
+	}{
+		{"ok default", nil, nil},
+		{"ok", &Claims{TLSBackdate: &Duration{5 * time.Second}}, []SignOption{X509Backdate(5 * time.Second)}},
+		{"ok zero", &Claims{TLSBackdate: &Duration{}}, []SignOption{X509Backdate(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimer, err := NewClaimer(tt.claims, globalProvisionerClaims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Controller{Claimer: claimer}
+			if got := c.newBackdateOptions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Controller.newBackdateOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestController_newX509SignOptions(t *testing.T) {
+	claimer, err := NewClaimer(&Claims{TLSBackdate: &Duration{5 * time.Second}}, globalProvisionerClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{
+		Claimer:          claimer,
+		x509Signer:       "signer",
+		x509ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		x509CRLDPs:       []string{"http://crl.example.com"},
+	}
+	want := []SignOption{
+		X509SignerName("signer"),
+		newUniqueSANOption(false),
+		newSignatureAlgorithmOption(nil),
+		DuplicateDNSNamesPolicy(""),
+		X509SerialGenerator{},
+		X509Backdate(5 * time.Second),
+		extKeyUsageModifier{x509.ExtKeyUsageClientAuth},
+		crlDistributionPointsModifier{"http://crl.example.com"},
+	}
+	if got := c.newX509SignOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Controller.newX509SignOptions() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,599 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// DefaultEmailCodeTTL is the default time a one-time code sent by an email
+	// provisioner can be redeemed.
+	DefaultEmailCodeTTL = 10 * time.Minute
+	// DefaultEmailCodeMaxAttempts is the default number of failed attempts to
+	// redeem the one-time codes of an address before it is locked.
+	DefaultEmailCodeMaxAttempts = 5
+	// DefaultEmailCodesPerHour is the default number of one-time codes that
+	// can be sent to an email address per hour.
+	DefaultEmailCodesPerHour = 5
+	// DefaultEmailClientCodesPerHour is the default number of one-time codes
+	// that a client IP address can request per hour.
+	DefaultEmailClientCodesPerHour = 20
+)
+
+// emailCodeDigits is the number of digits of the one-time codes.
+const emailCodeDigits = 8
+
+// emailSMTPTimeout is the maximum time used to send a message to the SMTP
+// server, including the connection.
+const emailSMTPTimeout = 30 * time.Second
+
+// emailCodeSweepInterval is the minimum time between the removals of the
+// expired codes from the in-memory store.
+const emailCodeSweepInterval = time.Minute
+
+// EmailCode is a one-time code sent by an email provisioner. Only the hash of
+// the code is kept. Attempts is the number of failed attempts of the address,
+// it is kept when a new code replaces the previous one.
+type EmailCode struct {
+	Hash      []byte    `json:"hash"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Attempts  int       `json:"attempts"`
+}
+
+// EmailCodeStore is the interface used by the email provisioners to keep the
+// one-time codes until they are redeemed. Implementations must be safe for
+// concurrent use.
+type EmailCodeStore interface {
+	// Put stores the code with the given key, replacing the previous one.
+	Put(ctx context.Context, key string, code *EmailCode) error
+	// Take removes and returns the code with the given key. It returns nil if
+	// there is no code or if it has expired.
+	Take(ctx context.Context, key string) (*EmailCode, error)
+}
+
+// memoryEmailCodeStore is an EmailCodeStore that keeps the codes in memory.
+type memoryEmailCodeStore struct {
+	mu        sync.Mutex
+	codes     map[string]*EmailCode
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryEmailCodeStore returns an in-memory EmailCodeStore. The codes are
+// lost when the CA is restarted.
+func NewMemoryEmailCodeStore() EmailCodeStore {
+	return &memoryEmailCodeStore{
+		codes: make(map[string]*EmailCode),
+		now:   time.Now,
+	}
+}
+
+// Put implements the EmailCodeStore interface. It also removes the expired
+// codes, at most once every emailCodeSweepInterval.
+func (s *memoryEmailCodeStore) Put(_ context.Context, key string, code *EmailCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); now.Sub(s.lastSweep) >= emailCodeSweepInterval {
+		for k, c := range s.codes {
+			if !now.Before(c.ExpiresAt) {
+				delete(s.codes, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	cp := *code
+	s.codes[key] = &cp
+	return nil
+}
+
+// Take implements the EmailCodeStore interface.
+func (s *memoryEmailCodeStore) Take(_ context.Context, key string) (*EmailCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.codes, key)
+	if !s.now().Before(code.ExpiresAt) {
+		return nil, nil
+	}
+	return code, nil
+}
+
+// EmailSender is the interface used by the email provisioners to deliver the
+// one-time codes.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// EmailSMTPOptions contains the SMTP server used by an email provisioner to
+// send the one-time codes. The password can be a reference to a secret, e.g.
+// env://SMTP_PASSWORD. If Username is empty the messages are sent without
+// authentication.
+type EmailSMTPOptions struct {
+	Address  string `json:"address"`
+	From     string `json:"from"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// newSender validates the SMTP options and returns the sender that uses them.
+func (o *EmailSMTPOptions) newSender(config Config) (EmailSender, error) {
+	host, _, err := net.SplitHostPort(o.Address)
+	switch {
+	case o.Address == "":
+		return nil, errors.New("provisioner smtp address cannot be empty")
+	case err != nil:
+		return nil, errors.Wrapf(err, "provisioner smtp address %q is not valid", o.Address)
+	case o.From == "":
+		return nil, errors.New("provisioner smtp from cannot be empty")
+	}
+	if _, err := mail.ParseAddress(o.From); err != nil {
+		return nil, errors.Wrapf(err, "provisioner smtp from %q is not valid", o.From)
+	}
+	sender := &smtpSender{address: o.Address, host: host, from: o.From, timeout: emailSMTPTimeout}
+	if o.Username != "" {
+		password, err := resolveSecret(context.Background(), config, "smtp password", o.Password)
+		if err != nil {
+			return nil, err
+		}
+		sender.auth = smtp.PlainAuth("", o.Username, password, host)
+	}
+	return sender, nil
+}
+
+// smtpSender is an EmailSender that sends the messages to an SMTP server. The
+// connection uses STARTTLS if the server supports it, and the whole exchange
+// must complete within the timeout.
+type smtpSender struct {
+	address string
+	host    string
+	from    string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+// SendEmail implements the EmailSender interface.
+func (s *smtpSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	msg := "From: " + s.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to the smtp server")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to the smtp server")
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return errors.Wrap(err, "error starting tls with the smtp server")
+		}
+	}
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			return errors.Wrap(err, "error authenticating to the smtp server")
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// EmailCodeSender is the interface implemented by provisioners that send
+// one-time codes to an email address. The code must be redeemed with the
+// certificate request to get a certificate for that address.
+type EmailCodeSender interface {
+	SendEmailCode(ctx context.Context, email string) (time.Time, error)
+}
+
+type emailKey struct{}
+
+// NewContextWithEmail creates a new context with the email address a one-time
+// code is redeemed for.
+func NewContextWithEmail(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, emailKey{}, email)
+}
+
+// EmailFromContext returns the email address stored in the given context.
+func EmailFromContext(ctx context.Context) (string, bool) {
+	email, ok := ctx.Value(emailKey{}).(string)
+	return email, ok && email != ""
+}
+
+// Email is a provisioner that issues X.509 certificates to email addresses
+// without an identity provider. The client first requests a one-time code,
+// that is sent to the address, and then redeems the code together with the
+// certificate request. The certificates are only issued to the redeemed
+// address.
+//
+// Domains is the list of email domains allowed to request a code. The codes
+// expire after CodeTTL, ten minutes by default. After MaxAttempts failed
+// attempts, five by default, the address is locked until its last code
+// expires; requesting a new code does not reset the attempts. CodesPerHour
+// limits the codes sent to each address, five by default, and
+// ClientCodesPerHour the codes requested by each client IP address, twenty by
+// default. The codes are sent using the SMTP server in SMTP, or the
+// EmailSender of the provisioner configuration.
+type Email struct {
+	*base
+	ID                 string            `json:"-"`
+	Type               string            `json:"type"`
+	Name               string            `json:"name"`
+	Domains            []string          `json:"domains"`
+	CodeTTL            *Duration         `json:"codeTTL,omitempty"`
+	MaxAttempts        int               `json:"maxAttempts,omitempty"`
+	CodesPerHour       int               `json:"codesPerHour,omitempty"`
+	ClientCodesPerHour int               `json:"clientCodesPerHour,omitempty"`
+	SMTP               *EmailSMTPOptions `json:"smtp,omitempty"`
+	Claims             *Claims           `json:"claims,omitempty"`
+	Options            *Options          `json:"options,omitempty"`
+	store              EmailCodeStore
+	sender             EmailSender
+	limiter            RateLimiter
+	ctl                *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Email) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Email) GetIDForToken() string {
+	return "email/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *Email) GetTokenID(string) (string, error) {
+	return "", errors.New("email provisioner does not implement GetTokenID")
+}
+
+// GetName returns the name of the provisioner.
+func (p *Email) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Email) GetType() Type {
+	return TypeEmail
+}
+
+// GetClaimer returns the claimer of the provisioner.
+func (p *Email) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *Email) GetController() *Controller {
+	return p.ctl
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *Email) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// Init initializes and validates the fields of an Email type.
+func (p *Email) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Domains) == 0:
+		return errors.New("provisioner domains cannot be empty")
+	case p.CodeTTL != nil && p.CodeTTL.Duration <= 0:
+		return errors.New("provisioner codeTTL must be greater than 0")
+	case p.MaxAttempts < 0:
+		return errors.New("provisioner maxAttempts cannot be negative")
+	case p.CodesPerHour < 0:
+		return errors.New("provisioner codesPerHour cannot be negative")
+	case p.ClientCodesPerHour < 0:
+		return errors.New("provisioner clientCodesPerHour cannot be negative")
+	}
+	for i, d := range p.Domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || strings.Contains(d, "@") {
+			return errors.Errorf("provisioner domain %q is not valid", p.Domains[i])
+		}
+		p.Domains[i] = d
+	}
+
+	switch {
+	case p.SMTP != nil:
+		if p.sender, err = p.SMTP.newSender(config); err != nil {
+			return err
+		}
+	case config.EmailSender != nil:
+		p.sender = config.EmailSender
+	default:
+		return errors.New("provisioner smtp cannot be empty")
+	}
+
+	p.store = config.EmailCodeStore
+	if p.store == nil {
+		p.store = NewMemoryEmailCodeStore()
+	}
+	p.limiter = config.RateLimiter
+	if p.limiter == nil {
+		p.limiter = NewMemoryRateLimiter(DefaultRateLimiterSize)
+	}
+
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// codeTTL returns the time a code can be redeemed.
+func (p *Email) codeTTL() time.Duration {
+	if d := p.CodeTTL.Value(); d > 0 {
+		return d
+	}
+	return DefaultEmailCodeTTL
+}
+
+// maxAttempts returns the number of failed attempts before a code is
+// invalidated.
+func (p *Email) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return DefaultEmailCodeMaxAttempts
+}
+
+// codesPerHour returns the number of codes that can be sent to an address per
+// hour.
+func (p *Email) codesPerHour() int {
+	if p.CodesPerHour > 0 {
+		return p.CodesPerHour
+	}
+	return DefaultEmailCodesPerHour
+}
+
+// clientCodesPerHour returns the number of codes that a client can request
+// per hour.
+func (p *Email) clientCodesPerHour() int {
+	if p.ClientCodesPerHour > 0 {
+		return p.ClientCodesPerHour
+	}
+	return DefaultEmailClientCodesPerHour
+}
+
+// allowCode returns an error if the client in the context, or the given email
+// address, has exceeded the number of codes per hour.
+func (p *Email) allowCode(ctx context.Context, email string) error {
+	allow := func(key string, perHour int) error {
+		ok, err := p.limiter.Allow(key, float64(perHour)/3600, perHour)
+		if err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error using rate limiter")
+		}
+		if !ok {
+			return authorizeErr(ReasonRateLimited, errs.New(http.StatusTooManyRequests, "email.SendEmailCode; too many codes requested"))
+		}
+		return nil
+	}
+	if addr, ok := ClientAddrFromContext(ctx); ok {
+		if ip := clientIP(addr, nil); ip != nil {
+			if err := allow(p.GetID()+".email-code.client."+ip.String(), p.clientCodesPerHour()); err != nil {
+				return err
+			}
+		}
+	}
+	return allow(p.GetID()+".email-code.address."+p.codeKey(email), p.codesPerHour())
+}
+
+// codeKey returns the key used to store the code of the given email address.
+func (p *Email) codeKey(email string) string {
+	sum := sha256.Sum256([]byte(p.GetID() + "." + strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseEmail returns the given email address if it is valid and its domain is
+// allowed.
+func (p *Email) parseEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", errs.BadRequest("email %q is not valid", email)
+	}
+	i := strings.LastIndex(email, "@")
+	domain := strings.ToLower(email[i+1:])
+	if !containsString(p.Domains, domain) {
+		return "", authorizeErr(ReasonInvalidSubject, errs.Forbidden("email domain %q is not allowed", domain))
+	}
+	return email, nil
+}
+
+// SendEmailCode generates a new one-time code for the given email address and
+// sends it to the address. It returns the time the code expires. A new code
+// replaces the previous one, but it keeps its failed attempts.
+func (p *Email) SendEmailCode(ctx context.Context, email string) (time.Time, error) {
+	email, err := p.parseEmail(email)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := p.allowCode(ctx, email); err != nil {
+		return time.Time{}, err
+	}
+
+	key := p.codeKey(email)
+	prev, err := p.store.Take(ctx, key)
+	if err != nil {
+		return time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error loading code")
+	}
+	var attempts int
+	if prev != nil {
+		if prev.Attempts >= p.maxAttempts() {
+			if err := p.store.Put(ctx, key, prev); err != nil {
+				return time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error storing code")
+			}
+			return time.Time{}, authorizeErr(ReasonRateLimited, errs.New(http.StatusTooManyRequests, "email.SendEmailCode; too many failed attempts"))
+		}
+		attempts = prev.Attempts
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(100000000))
+	if err != nil {
+		return time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error generating code")
+	}
+	code := fmt.Sprintf("%0*d", emailCodeDigits, n)
+	sum := sha256.Sum256([]byte(code))
+	expiresAt := now().Add(p.codeTTL()).Truncate(time.Second)
+
+	if err := p.store.Put(ctx, key, &EmailCode{
+		Hash:      sum[:],
+		ExpiresAt: expiresAt,
+		Attempts:  attempts,
+	}); err != nil {
+		return time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error storing code")
+	}
+
+	body := fmt.Sprintf("Your one-time code is %s.\r\n\r\nIt expires at %s. If you did not request it, you can ignore this message.",
+		code, expiresAt.UTC().Format(time.RFC1123))
+	if err := p.sender.SendEmail(ctx, email, "Your certificate enrollment code", body); err != nil {
+		return time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "email.SendEmailCode; error sending code")
+	}
+	return expiresAt, nil
+}
+
+// redeemCode checks and invalidates the code of the given email address. The
+// code is kept in a dry run, and after a failed attempt with the number of
+// attempts. Once the maximum number of attempts is reached, the code is kept
+// until it expires and no code is accepted for the address.
+func (p *Email) redeemCode(ctx context.Context, email, code string) error {
+	key := p.codeKey(email)
+	c, err := p.store.Take(ctx, key)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign; error loading code")
+	}
+	if c == nil {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("email.AuthorizeSign; code is not valid or has expired"))
+	}
+
+	sum := sha256.Sum256([]byte(code))
+	if c.Attempts < p.maxAttempts() && subtle.ConstantTimeCompare(sum[:], c.Hash) == 1 {
+		if DryRunFromContext(ctx) {
+			if err := p.store.Put(ctx, key, c); err != nil {
+				return errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign; error storing code")
+			}
+		}
+		return nil
+	}
+
+	if c.Attempts < p.maxAttempts() {
+		c.Attempts++
+	}
+	if err := p.store.Put(ctx, key, c); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign; error storing code")
+	}
+	return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("email.AuthorizeSign; code is not valid or has expired"))
+}
+
+// AuthorizeSign redeems the one-time code in the token for the email address
+// in the context, see NewContextWithEmail, and returns the list of SignOption
+// for a Sign request. The certificate request can only contain the redeemed
+// address.
+func (p *Email) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	email, ok := EmailFromContext(ctx)
+	if !ok {
+		return nil, errs.Unauthorized("email.AuthorizeSign; email not found in context")
+	}
+	email, err := p.parseEmail(email)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "email.AuthorizeSign")
+	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign")
+	}
+	if err := p.redeemCode(ctx, email, token); err != nil {
+		return nil, err
+	}
+	if err := p.ctl.allowRequest(ctx, email, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign")
+	}
+
+	so := p.ctl.newX509SignOptions()
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
+	data := x509util.CreateTemplateData(email, []string{email})
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "email.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeEmail, p.Name, "").WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newStrictIdentityValidator([]string{email}, []string{email}),
+		defaultPublicKeyValidator{},
+		p.ctl.newValidityValidator(),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *Email) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
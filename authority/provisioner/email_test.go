@@ -0,0 +1,310 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// mockEmailSender is an EmailSender that keeps the last message.
+type mockEmailSender struct {
+	mu   sync.Mutex
+	to   string
+	body string
+	err  error
+}
+
+func (s *mockEmailSender) SendEmail(_ context.Context, to, _, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.to, s.body = to, body
+	return s.err
+}
+
+var emailCodeRegexp = regexp.MustCompile(`code is (\d{8})\.`)
+
+func (s *mockEmailSender) code(t *testing.T) string {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := emailCodeRegexp.FindStringSubmatch(s.body)
+	assert.Fatal(t, m != nil, "code not found in message")
+	return m[1]
+}
+
+func generateEmail(t *testing.T) (*Email, *mockEmailSender) {
+	t.Helper()
+	sender := new(mockEmailSender)
+	p := &Email{
+		Type:    "Email",
+		Name:    "contractors",
+		Domains: []string{"Example.com"},
+	}
+	assert.FatalError(t, p.Init(Config{
+		Claims:      globalProvisionerClaims,
+		Audiences:   testAudiences,
+		EmailSender: sender,
+	}))
+	return p, sender
+}
+
+func TestEmail_Init(t *testing.T) {
+	config := Config{
+		Claims:      globalProvisionerClaims,
+		Audiences:   testAudiences,
+		EmailSender: new(mockEmailSender),
+	}
+	tests := []struct {
+		name    string
+		p       *Email
+		config  Config
+		wantErr bool
+	}{
+		{"ok", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}}, config, false},
+		{"ok smtp", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, SMTP: &EmailSMTPOptions{
+			Address: "smtp.example.com:587", From: "CA <ca@example.com>", Username: "ca", Password: "password",
+		}}, Config{Claims: globalProvisionerClaims}, false},
+		{"ok options", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, CodeTTL: &Duration{time.Minute}, MaxAttempts: 3}, config, false},
+		{"fail type", &Email{Name: "name", Domains: []string{"example.com"}}, config, true},
+		{"fail name", &Email{Type: "Email", Domains: []string{"example.com"}}, config, true},
+		{"fail domains", &Email{Type: "Email", Name: "name"}, config, true},
+		{"fail empty domain", &Email{Type: "Email", Name: "name", Domains: []string{" "}}, config, true},
+		{"fail domain email", &Email{Type: "Email", Name: "name", Domains: []string{"jane@example.com"}}, config, true},
+		{"fail codeTTL", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, CodeTTL: &Duration{}}, config, true},
+		{"fail maxAttempts", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, MaxAttempts: -1}, config, true},
+		{"fail codesPerHour", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, CodesPerHour: -1}, config, true},
+		{"fail clientCodesPerHour", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, ClientCodesPerHour: -1}, config, true},
+		{"fail sender", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}}, Config{Claims: globalProvisionerClaims}, true},
+		{"fail smtp address", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, SMTP: &EmailSMTPOptions{
+			Address: "smtp.example.com", From: "ca@example.com",
+		}}, config, true},
+		{"fail smtp from", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, SMTP: &EmailSMTPOptions{
+			Address: "smtp.example.com:587", From: "not an email",
+		}}, config, true},
+		{"fail smtp password", &Email{Type: "Email", Name: "name", Domains: []string{"example.com"}, SMTP: &EmailSMTPOptions{
+			Address: "smtp.example.com:587", From: "ca@example.com", Username: "ca", Password: "env://EMAIL_TEST_MISSING_PASSWORD",
+		}}, config, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("Email.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmail_SendEmailCode(t *testing.T) {
+	p, sender := generateEmail(t)
+
+	expiresAt, err := p.SendEmailCode(context.Background(), "jane@EXAMPLE.com")
+	assert.FatalError(t, err)
+	assert.True(t, expiresAt.After(time.Now().Add(DefaultEmailCodeTTL-time.Minute)))
+	assert.Equals(t, "jane@EXAMPLE.com", sender.to)
+	assert.Len(t, 8, sender.code(t))
+
+	_, err = p.SendEmailCode(context.Background(), "jane@other.com")
+	assert.Error(t, err)
+	_, err = p.SendEmailCode(context.Background(), "Jane <jane@example.com>")
+	assert.Error(t, err)
+	_, err = p.SendEmailCode(context.Background(), "jane@example.com\r\nBcc: mallory@example.com")
+	assert.Error(t, err)
+
+	sender.err = errors.New("connection refused")
+	_, err = p.SendEmailCode(context.Background(), "jane@example.com")
+	assert.Error(t, err)
+}
+
+func TestEmail_SendEmailCode_rateLimit(t *testing.T) {
+	p, _ := generateEmail(t)
+	p.CodesPerHour = 2
+	p.ClientCodesPerHour = 4
+	ctx := NewContextWithClientAddr(context.Background(), &ClientAddr{RemoteAddr: "10.0.0.1:1234"})
+
+	for i := 0; i < 2; i++ {
+		_, err := p.SendEmailCode(ctx, "jane@example.com")
+		assert.FatalError(t, err)
+	}
+	_, err := p.SendEmailCode(ctx, "jane@example.com")
+	assertStatusCode(t, http.StatusTooManyRequests, err)
+
+	// Per client address, rejected requests also count.
+	_, err = p.SendEmailCode(ctx, "john@example.com")
+	assert.FatalError(t, err)
+	_, err = p.SendEmailCode(ctx, "joe@example.com")
+	assertStatusCode(t, http.StatusTooManyRequests, err)
+	_, err = p.SendEmailCode(NewContextWithClientAddr(context.Background(), &ClientAddr{RemoteAddr: "10.0.0.2:1234"}), "joe@example.com")
+	assert.NoError(t, err)
+}
+
+func Test_smtpSender_timeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	defer ln.Close()
+	go func() {
+		// Accept connections but never respond.
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	s := &smtpSender{address: ln.Addr().String(), host: "127.0.0.1", from: "ca@example.com", timeout: 100 * time.Millisecond}
+	start := time.Now()
+	assert.Error(t, s.SendEmail(context.Background(), "jane@example.com", "subject", "body"))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestEmail_AuthorizeSign(t *testing.T) {
+	p, sender := generateEmail(t)
+
+	validate := func(t *testing.T, opts []SignOption, cr *x509.CertificateRequest) error {
+		t.Helper()
+		for _, o := range opts {
+			if v, ok := o.(*strictIdentityValidator); ok {
+				if err := v.Valid(cr); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "jane@example.com")
+		_, err := p.SendEmailCode(ctx, "jane@example.com")
+		assert.FatalError(t, err)
+		code := sender.code(t)
+
+		opts, err := p.AuthorizeSign(ctx, code)
+		assert.FatalError(t, err)
+		assert.NoError(t, validate(t, opts, &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "jane@example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+		}))
+		assert.Error(t, validate(t, opts, &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "jane@example.com"},
+			EmailAddresses: []string{"john@example.com"},
+		}))
+		assert.Error(t, validate(t, opts, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "jane@example.com"},
+			DNSNames: []string{"example.com"},
+		}))
+
+		// The code can only be used once.
+		_, err = p.AuthorizeSign(ctx, code)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok dry run", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "john@example.com")
+		_, err := p.SendEmailCode(ctx, "john@example.com")
+		assert.FatalError(t, err)
+		code := sender.code(t)
+
+		_, err = p.AuthorizeSign(NewContextWithDryRun(ctx), code)
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(ctx, code)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail other email", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "joe@example.com")
+		_, err := p.SendEmailCode(ctx, "joe@example.com")
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(NewContextWithEmail(context.Background(), "mallory@example.com"), sender.code(t))
+		assert.Error(t, err)
+	})
+
+	t.Run("fail missing email", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "jim@example.com")
+		_, err := p.SendEmailCode(ctx, "jim@example.com")
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), sender.code(t))
+		assert.Error(t, err)
+	})
+
+	t.Run("fail max attempts", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "jill@example.com")
+		_, err := p.SendEmailCode(ctx, "jill@example.com")
+		assert.FatalError(t, err)
+		code := sender.code(t)
+		for i := 0; i < DefaultEmailCodeMaxAttempts; i++ {
+			_, err = p.AuthorizeSign(ctx, "00000000x")
+			assert.Error(t, err)
+		}
+		_, err = p.AuthorizeSign(ctx, code)
+		assert.Error(t, err)
+
+		// A new code does not reset the attempts.
+		_, err = p.SendEmailCode(ctx, "jill@example.com")
+		assertStatusCode(t, http.StatusTooManyRequests, err)
+		_, err = p.AuthorizeSign(ctx, code)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok after failed attempt", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "jack@example.com")
+		_, err := p.SendEmailCode(ctx, "jack@example.com")
+		assert.FatalError(t, err)
+		code := sender.code(t)
+		_, err = p.AuthorizeSign(ctx, "00000000x")
+		assert.Error(t, err)
+		_, err = p.AuthorizeSign(ctx, code)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail expired", func(t *testing.T) {
+		ctx := NewContextWithEmail(context.Background(), "jo@example.com")
+		_, fn := mockNow()
+		_, err := p.SendEmailCode(ctx, "jo@example.com")
+		fn()
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(ctx, sender.code(t))
+		assert.Error(t, err)
+	})
+}
+
+func Test_memoryEmailCodeStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryEmailCodeStore()
+
+	code := &EmailCode{Hash: []byte("hash"), ExpiresAt: time.Now().Add(time.Minute)}
+	assert.FatalError(t, s.Put(ctx, "key", code))
+	assert.FatalError(t, s.Put(ctx, "expired", &EmailCode{Hash: []byte("hash"), ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	got, err := s.Take(ctx, "key")
+	assert.FatalError(t, err)
+	assert.Equals(t, code, got)
+	got, err = s.Take(ctx, "key")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+	got, err = s.Take(ctx, "expired")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestList_UnmarshalJSON_email(t *testing.T) {
+	var l List
+	assert.FatalError(t, json.Unmarshal([]byte(`[{"type":"email","name":"contractors","domains":["example.com"],"codeTTL":"5m"}]`), &l))
+	if assert.Len(t, 1, l) {
+		p, ok := l[0].(*Email)
+		assert.Fatal(t, ok, "provisioner is not an *Email")
+		assert.Equals(t, []string{"example.com"}, p.Domains)
+		assert.Equals(t, 5*time.Minute, p.CodeTTL.Value())
+		assert.Equals(t, TypeEmail, p.GetType())
+	}
+}
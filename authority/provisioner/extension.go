@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"time"
 )
 
 var (
@@ -12,6 +13,18 @@ var (
 
 	// StepOIDProvisioner is the OID for the provisioner extension.
 	StepOIDProvisioner = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 1)...)
+
+	// StepOIDOriginalNotBefore is the OID for the extension with the notBefore
+	// of the first certificate of a chain of renewals.
+	StepOIDOriginalNotBefore = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 3)...)
+
+	// StepOIDRenewalBudget is the OID for the extension with the number of
+	// renewals of a chain of renewals and the maximum allowed.
+	StepOIDRenewalBudget = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 5)...)
+
+	// StepOIDAttestationResult is the OID for the extension with the result of
+	// the verification of a device attestation.
+	StepOIDAttestationResult = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 9)...)
 )
 
 // Extension is the Go representation of the provisioner extension.
@@ -71,3 +84,108 @@ func GetProvisionerExtension(cert *x509.Certificate) (*Extension, bool) {
 	}
 	return nil, false
 }
+
+// NewOriginalNotBeforeExtension returns the extension that records the
+// notBefore of the first certificate of a chain of renewals.
+func NewOriginalNotBeforeExtension(t time.Time) (pkix.Extension, error) {
+	b, err := asn1.MarshalWithParams(t.UTC().Truncate(time.Second), "generalized")
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{
+		Id:    StepOIDOriginalNotBefore,
+		Value: b,
+	}, nil
+}
+
+// GetOriginalNotBefore returns the notBefore of the first certificate of the
+// chain of renewals of the given certificate. It returns the notBefore of the
+// certificate if it does not have the original notBefore extension
+// (1.3.6.1.4.1.37476.9000.64.3).
+func GetOriginalNotBefore(cert *x509.Certificate) time.Time {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(StepOIDOriginalNotBefore) {
+			var t time.Time
+			if _, err := asn1.UnmarshalWithParams(e.Value, &t, "generalized"); err != nil {
+				break
+			}
+			return t
+		}
+	}
+	return cert.NotBefore
+}
+
+// RenewalBudget is the Go representation of the renewal budget extension. It
+// records the number of times a chain of renewals has been renewed and the
+// maximum number of renewals allowed when the certificate was issued.
+type RenewalBudget struct {
+	Renewals    int
+	MaxRenewals int
+}
+
+// Remaining returns the number of renewals left in the budget.
+func (b RenewalBudget) Remaining() int {
+	if b.Renewals >= b.MaxRenewals {
+		return 0
+	}
+	return b.MaxRenewals - b.Renewals
+}
+
+// NewRenewalBudgetExtension returns the extension that records the renewal
+// budget of a certificate.
+func NewRenewalBudgetExtension(b RenewalBudget) (pkix.Extension, error) {
+	v, err := asn1.Marshal(b)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{
+		Id:    StepOIDRenewalBudget,
+		Value: v,
+	}, nil
+}
+
+// GetRenewalBudget returns the renewal budget in the renewal budget extension
+// (1.3.6.1.4.1.37476.9000.64.5) of the given certificate. It returns false if
+// the certificate does not have it.
+func GetRenewalBudget(cert *x509.Certificate) (RenewalBudget, bool) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(StepOIDRenewalBudget) {
+			var b RenewalBudget
+			if rest, err := asn1.Unmarshal(e.Value, &b); err != nil || len(rest) > 0 {
+				return RenewalBudget{}, false
+			}
+			return b, true
+		}
+	}
+	return RenewalBudget{}, false
+}
+
+// NewAttestationResultExtension returns the extension that records the result
+// of the verification of the device attestation of an ACME order. The result is
+// encoded as an ASN.1 UTF8String.
+func NewAttestationResultExtension(result ACMEAttestationResult) (pkix.Extension, error) {
+	v, err := asn1.MarshalWithParams(string(result), "utf8")
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{
+		Id:    StepOIDAttestationResult,
+		Value: v,
+	}, nil
+}
+
+// GetAttestationResult returns the result in the attestation result extension
+// (1.3.6.1.4.1.37476.9000.64.9) of the given certificate. It returns false if
+// the certificate does not have it.
+func GetAttestationResult(cert *x509.Certificate) (ACMEAttestationResult, bool) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(StepOIDAttestationResult) {
+			var s string
+			if rest, err := asn1.UnmarshalWithParams(e.Value, &s, "utf8"); err != nil || len(rest) > 0 {
+				return "", false
+			}
+			return ACMEAttestationResult(s), true
+		}
+	}
+	return "", false
+}
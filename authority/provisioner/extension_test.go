@@ -5,6 +5,7 @@ import (
 	"crypto/x509/pkix"
 	"reflect"
 	"testing"
+	"time"
 
 	"go.step.sm/crypto/pemutil"
 )
@@ -156,3 +157,112 @@ func TestGetProvisionerExtension(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOriginalNotBefore(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	original := now.Add(-30 * 24 * time.Hour)
+	ext, err := NewOriginalNotBeforeExtension(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want time.Time
+	}{
+		{"ok", &x509.Certificate{NotBefore: now, Extensions: []pkix.Extension{ext}}, original},
+		{"ok missing extension", &x509.Certificate{NotBefore: now}, now},
+		{"ok bad extension", &x509.Certificate{NotBefore: now, Extensions: []pkix.Extension{
+			{Id: StepOIDOriginalNotBefore, Value: []byte("foo")},
+		}}, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetOriginalNotBefore(tt.cert); !got.Equal(tt.want) {
+				t.Errorf("GetOriginalNotBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRenewalBudget(t *testing.T) {
+	ext, err := NewRenewalBudgetExtension(RenewalBudget{Renewals: 2, MaxRenewals: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cert  *x509.Certificate
+		want  RenewalBudget
+		want1 bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{ext}}, RenewalBudget{Renewals: 2, MaxRenewals: 3}, true},
+		{"ok missing extension", &x509.Certificate{}, RenewalBudget{}, false},
+		{"ok bad extension", &x509.Certificate{Extensions: []pkix.Extension{
+			{Id: StepOIDRenewalBudget, Value: []byte("foo")},
+		}}, RenewalBudget{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := GetRenewalBudget(tt.cert)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRenewalBudget() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("GetRenewalBudget() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestGetAttestationResult(t *testing.T) {
+	ext, err := NewAttestationResultExtension(AttestationFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cert  *x509.Certificate
+		want  ACMEAttestationResult
+		want1 bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{ext}}, AttestationFail, true},
+		{"ok missing extension", &x509.Certificate{}, "", false},
+		{"ok bad extension", &x509.Certificate{Extensions: []pkix.Extension{
+			{Id: StepOIDAttestationResult, Value: []byte("foo")},
+		}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := GetAttestationResult(tt.cert)
+			if got != tt.want {
+				t.Errorf("GetAttestationResult() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("GetAttestationResult() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestRenewalBudget_Remaining(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget RenewalBudget
+		want   int
+	}{
+		{"first", RenewalBudget{Renewals: 1, MaxRenewals: 3}, 2},
+		{"last", RenewalBudget{Renewals: 3, MaxRenewals: 3}, 0},
+		{"above limit", RenewalBudget{Renewals: 4, MaxRenewals: 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.budget.Remaining(); got != tt.want {
+				t.Errorf("RenewalBudget.Remaining() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package provisioner
+
+import (
+	"time"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// Freeze temporarily disables the issuance of certificates with a provisioner,
+// e.g. during a change freeze, without removing it. The freeze is active until
+// the given time, or until it is lifted if Until is not set. If AllowRenewal is
+// true, the certificates of the provisioner can still be renewed during the
+// freeze.
+type Freeze struct {
+	Until        *time.Time `json:"until,omitempty"`
+	AllowRenewal bool       `json:"allowRenewal,omitempty"`
+}
+
+// IsActive returns true if the freeze applies at the given time.
+func (f *Freeze) IsActive(now time.Time) bool {
+	return f != nil && (f.Until == nil || now.Before(*f.Until))
+}
+
+// Check returns an error if the freeze is active. If renewal is true, it only
+// returns an error if the freeze does not allow renewals.
+func (f *Freeze) Check(name string, renewal bool) error {
+	if !f.IsActive(time.Now()) || (renewal && f.AllowRenewal) {
+		return nil
+	}
+	if f.Until == nil {
+		return errs.Forbidden("provisioner %q is temporarily disabled", name)
+	}
+	return errs.Forbidden("provisioner %q is temporarily disabled until %s", name, f.Until.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,67 @@
+package provisioner
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestFreeze_IsActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	tests := []struct {
+		name   string
+		freeze *Freeze
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"until lifted", &Freeze{}, true},
+		{"until future", &Freeze{Until: &future}, true},
+		{"until now", &Freeze{Until: &now}, false},
+		{"until past", &Freeze{Until: &past}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.freeze.IsActive(now); got != tt.want {
+				t.Errorf("Freeze.IsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeze_Check(t *testing.T) {
+	until := time.Date(2100, 1, 2, 3, 4, 5, 0, time.UTC)
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		freeze  *Freeze
+		renewal bool
+		wantErr string
+	}{
+		{"ok nil", nil, false, ""},
+		{"ok expired", &Freeze{Until: &past}, false, ""},
+		{"ok renewal allowed", &Freeze{AllowRenewal: true}, true, ""},
+		{"fail sign", &Freeze{AllowRenewal: true}, false, `provisioner "name" is temporarily disabled`},
+		{"fail renewal", &Freeze{}, true, `provisioner "name" is temporarily disabled`},
+		{"fail until", &Freeze{Until: &until}, false, `provisioner "name" is temporarily disabled until 2100-01-02T03:04:05Z`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.freeze.Check("name", tt.renewal)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.wantErr, err.Error())
+				e, ok := err.(*errs.Error)
+				assert.Fatal(t, ok, "error is not an *errs.Error")
+				assert.Equals(t, http.StatusForbidden, e.StatusCode())
+			}
+		})
+	}
+}
@@ -10,6 +10,10 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +34,13 @@ const gcpCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
 // gcpIdentityURL is the base url for the identity document in GCP.
 const gcpIdentityURL = "http://metadata/computeMetadata/v1/instance/service-accounts/default/identity"
 
+// gcpKeysMaxStaleness is the default time the Google certificates are used
+// after they expire while they are reloaded in the background.
+const gcpKeysMaxStaleness = time.Hour
+
+// defaultGCPClockSkew is the default tolerance of the instance age validation.
+const defaultGCPClockSkew = time.Minute
+
 // gcpPayload extends jwt.Claims with custom GCP attributes.
 type gcpPayload struct {
 	jose.Claims
@@ -51,17 +62,29 @@ type gcpComputeEnginePayload struct {
 	ProjectNumber             int64             `json:"project_number"`
 	Zone                      string            `json:"zone"`
 	LicenseID                 []string          `json:"license_id"`
+	Labels                    map[string]string `json:"labels,omitempty"`
 }
 
+// gcpIdentityFields are the fields that can be used in the SPIFFE path and
+// subject templates.
+var gcpIdentityFields = []string{"ProjectID", "ProjectNumber", "Zone", "InstanceID", "InstanceName"}
+
 type gcpConfig struct {
 	CertsURL    string
 	IdentityURL string
+	// KeysRefreshInterval is the interval between reloads of the Google
+	// certificates. If it's not set the max-age of the response is used.
+	KeysRefreshInterval time.Duration
+	// KeysMaxStaleness is for how long the last certificates are used after
+	// they expire while they are reloaded in the background.
+	KeysMaxStaleness time.Duration
 }
 
 func newGCPConfig() *gcpConfig {
 	return &gcpConfig{
-		CertsURL:    gcpCertsURL,
-		IdentityURL: gcpIdentityURL,
+		CertsURL:         gcpCertsURL,
+		IdentityURL:      gcpIdentityURL,
+		KeysMaxStaleness: gcpKeysMaxStaleness,
 	}
 }
 
@@ -71,32 +94,158 @@ func newGCPConfig() *gcpConfig {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// If DisableCustomSANs is false, CustomSANsMode defines how the SANs in the CSR
+// are combined with the internal ones: "csr", the default, uses only the SANs
+// in the CSR, "merge" adds the internal SANs to the ones in the CSR, and
+// "token" uses only the internal SANs.
+//
+// If OverwriteCommonName and DisableCustomSANs are true, the common name in the
+// CSR is ignored and the certificate common name is set to the instance name.
+// By default a CSR with a different common name is rejected.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
 //
 // If InstanceAge is set, only the instances with an instance_creation_timestamp
-// within the given period will be accepted.
+// within the given period will be accepted. ClockSkew is the tolerance added to
+// both ends of that period, it defaults to 1 minute.
+//
+// If ReplayProtection is true, a token can only be used once during its
+// validity period, even if DisableTrustOnFirstUse is true.
+//
+// If Labels is set, only the instances with all the given labels and values in
+// google.compute_engine.labels will be accepted. Note that the identity tokens
+// created by the metadata server do not include the instance labels by
+// default, so tokens without them will be rejected.
+//
+// If SPIFFE is set, a SPIFFE ID is added as a URI SAN. The path template can
+// use the fields ProjectID, ProjectNumber, Zone, InstanceID and InstanceName.
+//
+// If Subject is set, the Country, Organization and OrganizationalUnit of the
+// certificate subject are set from templates that can use the same fields.
+//
+// If SSHHostPrincipals is set, the principals of the SSH host certificates are
+// generated from templates that can use the same fields, and the principals
+// requested that are not generated are dropped.
+//
+// If BindToTokenExpiry is set, the certificates cannot be valid after the
+// expiration of the identity token plus the given offset.
+//
+// If StrictIdentity is true, a CSR with a common name or SANs other than the
+// instance name, the instance id, or the internal DNS names is rejected, even
+// if DisableCustomSANs is false. By default it is disabled.
+//
+// ServiceAccounts are compared with the subject and email of the token. If
+// ServiceAccountsMatch is "glob" they are patterns like
+// "*-ci@*.iam.gserviceaccount.com", and if it's "regex" they are regular
+// expressions that must match the whole service account. By default, "exact",
+// they are compared literally.
+//
+// If EnableRevoke is true, an X.509 certificate can be revoked with a new
+// identity token of the same instance with the revoke audience. Only the
+// certificates with the instance id of the token in the provisioner extension
+// can be revoked. By default revocation is disabled.
 //
 // Google Identity docs are available at
 // https://cloud.google.com/compute/docs/instances/verifying-instance-identity
 type GCP struct {
 	*base
-	ID                     string   `json:"-"`
-	Type                   string   `json:"type"`
-	Name                   string   `json:"name"`
-	ServiceAccounts        []string `json:"serviceAccounts"`
-	ProjectIDs             []string `json:"projectIDs"`
-	DisableCustomSANs      bool     `json:"disableCustomSANs"`
-	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
-	InstanceAge            Duration `json:"instanceAge,omitempty"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	Options                *Options `json:"options,omitempty"`
+	ID                     string                    `json:"-"`
+	Type                   string                    `json:"type"`
+	Name                   string                    `json:"name"`
+	ServiceAccounts        []string                  `json:"serviceAccounts"`
+	ServiceAccountsMatch   string                    `json:"serviceAccountsMatch,omitempty"`
+	ProjectIDs             []string                  `json:"projectIDs"`
+	DisableCustomSANs      bool                      `json:"disableCustomSANs"`
+	OverwriteCommonName    bool                      `json:"overwriteCommonName,omitempty"`
+	CustomSANsMode         CustomSANsMode            `json:"customSANsMode,omitempty"`
+	DisableTrustOnFirstUse bool                      `json:"disableTrustOnFirstUse"`
+	InstanceAge            Duration                  `json:"instanceAge,omitempty"`
+	ClockSkew              Duration                  `json:"clockSkew,omitempty"`
+	Labels                 map[string]string         `json:"labels,omitempty"`
+	ReplayProtection       bool                      `json:"replayProtection,omitempty"`
+	SPIFFE                 *SPIFFEOptions            `json:"spiffe,omitempty"`
+	Subject                *SubjectOptions           `json:"subject,omitempty"`
+	SSHHostPrincipals      *SSHHostPrincipalsOptions `json:"sshHostPrincipals,omitempty"`
+	BindToTokenExpiry      *TokenExpiryOptions       `json:"bindToTokenExpiry,omitempty"`
+	StrictIdentity         bool                      `json:"strictIdentity,omitempty"`
+	MetadataRetry          *MetadataRetryOptions     `json:"metadataRetry,omitempty"`
+	EnableRevoke           bool                      `json:"enableRevoke,omitempty"`
+	Claims                 *Claims                   `json:"claims,omitempty"`
+	Options                *Options                  `json:"options,omitempty"`
 	config                 *gcpConfig
 	keyStore               *keyStore
+	serviceAccountRegexps  []*regexp.Regexp
 	ctl                    *Controller
 }
 
+const (
+	// GCPServiceAccountsExact compares the service accounts literally. It is
+	// the default.
+	GCPServiceAccountsExact = "exact"
+	// GCPServiceAccountsGlob matches the service accounts with shell patterns,
+	// where * matches any sequence of characters.
+	GCPServiceAccountsGlob = "glob"
+	// GCPServiceAccountsRegex matches the service accounts with regular
+	// expressions anchored to the whole service account.
+	GCPServiceAccountsRegex = "regex"
+)
+
+// initServiceAccounts validates the service account patterns and compiles the
+// regular expressions.
+func (p *GCP) initServiceAccounts() error {
+	p.serviceAccountRegexps = nil
+	switch p.ServiceAccountsMatch {
+	case "", GCPServiceAccountsExact:
+		return nil
+	case GCPServiceAccountsGlob:
+		for _, sa := range p.ServiceAccounts {
+			if _, err := path.Match(sa, ""); err != nil {
+				return errors.Errorf("provisioner serviceAccounts pattern %q is not valid", sa)
+			}
+		}
+		return nil
+	case GCPServiceAccountsRegex:
+		p.serviceAccountRegexps = make([]*regexp.Regexp, len(p.ServiceAccounts))
+		for i, sa := range p.ServiceAccounts {
+			re, err := regexp.Compile("^(?:" + sa + ")$")
+			if err != nil {
+				return errors.Wrapf(err, "provisioner serviceAccounts regular expression %q is not valid", sa)
+			}
+			p.serviceAccountRegexps[i] = re
+		}
+		return nil
+	default:
+		return errors.Errorf("provisioner serviceAccountsMatch %q is not valid", p.ServiceAccountsMatch)
+	}
+}
+
+// matchServiceAccount returns true if the given service account matches one of
+// the ServiceAccounts.
+func (p *GCP) matchServiceAccount(sa string) bool {
+	if sa == "" {
+		return false
+	}
+	switch p.ServiceAccountsMatch {
+	case GCPServiceAccountsGlob:
+		for _, pattern := range p.ServiceAccounts {
+			if ok, _ := path.Match(pattern, sa); ok {
+				return true
+			}
+		}
+	case GCPServiceAccountsRegex:
+		for _, re := range p.serviceAccountRegexps {
+			if re.MatchString(sa) {
+				return true
+			}
+		}
+	default:
+		return containsString(p.ServiceAccounts, sa)
+	}
+	return false
+}
+
 // GetID returns the provisioner unique identifier. The name should uniquely
 // identify any GCP provisioner.
 func (p *GCP) GetID() string {
@@ -114,7 +263,8 @@ func (p *GCP) GetIDForToken() string {
 
 // GetTokenID returns the identifier of the token. The default value for GCP the
 // SHA256 of "provisioner_id.instance_id", but if DisableTrustOnFirstUse is set
-// to true, then it will be the SHA256 of the token.
+// to true, or the token is a revocation token, then it will be the SHA256 of
+// the token.
 func (p *GCP) GetTokenID(token string) (string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
@@ -133,6 +283,13 @@ func (p *GCP) GetTokenID(token string) (string, error) {
 		return "", errors.Wrap(err, "error verifying claims")
 	}
 
+	// Revocation tokens are also single use, the TOFU ID has already been used
+	// by the sign request of the instance.
+	if p.isRevokeToken(&claims) {
+		sum := sha256.Sum256([]byte(token))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
 	// Create unique ID for Trust On First Use (TOFU). Only the first instance
 	// per provisioner is allowed as we don't have a way to trust the given
 	// sans.
@@ -141,6 +298,20 @@ func (p *GCP) GetTokenID(token string) (string, error) {
 	return strings.ToLower(hex.EncodeToString(sum[:])), nil
 }
 
+// useToken rejects the reuse of a token if replay protection is enabled.
+func (p *GCP) useToken(ctx context.Context, claims *gcpPayload, token string) error {
+	if !p.ReplayProtection {
+		return nil
+	}
+	key := tokenReplayKey(p.GetIDForToken(), claims.Google.ComputeEngine.InstanceID, claims.ID, token)
+	return p.ctl.useToken(ctx, key, tokenReplayExpiration(claims.Expiry))
+}
+
+// isRevokeToken returns true if the token has the revoke audience.
+func (p *GCP) isRevokeToken(claims *gcpPayload) bool {
+	return p.EnableRevoke && p.ctl != nil && matchesAudience(claims.Audience, p.ctl.Audiences.Revoke)
+}
+
 // GetName returns the name of the provisioner.
 func (p *GCP) GetName() string {
 	return p.Name
@@ -151,6 +322,25 @@ func (p *GCP) GetType() Type {
 	return TypeGCP
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *GCP) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *GCP) GetController() *Controller {
+	return p.ctl
+}
+
+// GetCapabilities returns the certificates the provisioner can issue. GCP
+// instances can only request SSH host certificates.
+func (p *GCP) GetCapabilities() *Capabilities {
+	caps := newCapabilities(p.ctl.GetClaimer(), false, true)
+	caps.AllowCustomSANs = !p.DisableCustomSANs
+	caps.TrustOnFirstUse = !p.DisableTrustOnFirstUse
+	return caps
+}
+
 // GetEncryptedKey is not available in a GCP provisioner.
 func (p *GCP) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -170,6 +360,12 @@ func (p *GCP) GetIdentityURL(audience string) string {
 
 // GetIdentityToken does an HTTP request to the identity url.
 func (p *GCP) GetIdentityToken(subject, caURL string) (string, error) {
+	return p.GetIdentityTokenWithContext(context.Background(), subject, caURL)
+}
+
+// GetIdentityTokenWithContext does an HTTP request to the identity url with
+// the given context, retrying it if MetadataRetry is configured.
+func (p *GCP) GetIdentityTokenWithContext(ctx context.Context, subject, caURL string) (string, error) {
 	_ = subject // unused input
 
 	audience, err := generateSignAudience(caURL, p.GetIDForToken())
@@ -182,7 +378,7 @@ func (p *GCP) GetIdentityToken(subject, caURL string) (string, error) {
 		return "", errors.Wrap(err, "error creating identity request")
 	}
 	req.Header.Set("Metadata-Flavor", "Google")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.MetadataRetry.do(ctx, http.DefaultClient, req)
 	if err != nil {
 		return "", errors.Wrap(err, "error doing identity request, are you in a GCP VM?")
 	}
@@ -199,35 +395,75 @@ func (p *GCP) GetIdentityToken(subject, caURL string) (string, error) {
 
 // Init validates and initializes the GCP provisioner.
 func (p *GCP) Init(config Config) (err error) {
-	switch {
-	case p.Type == "":
-		return errors.New("provisioner type cannot be empty")
-	case p.Name == "":
-		return errors.New("provisioner name cannot be empty")
-	case p.InstanceAge.Value() < 0:
-		return errors.New("provisioner instanceAge cannot be negative")
+	var v configValidator
+	v.check(p.Type == "", "type", "provisioner type cannot be empty")
+	v.check(p.Name == "", "name", "provisioner name cannot be empty")
+	v.check(p.InstanceAge.Value() < 0, "instanceAge", "provisioner instanceAge cannot be negative")
+	v.check(p.ClockSkew.Value() < 0, "clockSkew", "provisioner clockSkew cannot be negative")
+	v.add("customSANsMode", p.CustomSANsMode.Validate())
+	v.add("serviceAccounts", p.initServiceAccounts())
+	v.add("spiffe", p.SPIFFE.init(gcpIdentityFields))
+	v.add("subject", p.Subject.init(gcpIdentityFields))
+	v.add("sshHostPrincipals", p.SSHHostPrincipals.init(gcpIdentityFields))
+	v.add("bindToTokenExpiry", p.BindToTokenExpiry.init())
+	v.add("metadataRetry", p.MetadataRetry.init())
+	v.check(p.OverwriteCommonName && !p.DisableCustomSANs, "overwriteCommonName", "provisioner overwriteCommonName requires disableCustomSANs")
+	labels := make([]string, 0, len(p.Labels))
+	for k := range p.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		if !isGCPLabel(k) || k[0] < 'a' || k[0] > 'z' {
+			v.add("labels", errors.Errorf("provisioner labels contains an invalid key %q", k))
+		} else if val := p.Labels[k]; val != "" && !isGCPLabel(val) {
+			v.add("labels", errors.Errorf("provisioner labels contains an invalid value %q for key %q", val, k))
+		}
+	}
+	if err := v.err(); err != nil {
+		return err
 	}
 
 	// Initialize config
 	p.assertConfig()
 
 	// Initialize key store
-	if p.keyStore, err = newKeyStore(p.config.CertsURL); err != nil {
+	if p.keyStore, err = newKeyStore(p.config.CertsURL,
+		withRefreshInterval(p.config.KeysRefreshInterval),
+		withMaxStaleness(p.config.KeysMaxStaleness)); err != nil {
 		return
 	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ReplayProtection && config.TokenCache == nil {
+		config.TokenCache = NewMemoryTokenCache(DefaultTokenCacheSize)
+	}
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
 
+// Check verifies that the certificates URL is reachable and that its key set
+// has at least one key.
+func (p *GCP) Check(ctx context.Context) error {
+	return checkKeySet(ctx, p.config.CertsURL)
+}
+
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
 	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, claims.Google.ComputeEngine.InstanceID); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
 
 	ce := claims.Google.ComputeEngine
 
@@ -238,17 +474,35 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		data.SetToken(v)
 	}
 
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "gcp.AuthorizeSign")
+	}
+
+	// Restrict the subject alternative names to the ones in the manifest.
+	manifestOpts, err := p.ctl.newSANManifestOptions(ce.InstanceID)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "gcp.AuthorizeSign")
+	}
+	so = append(so, manifestOpts...)
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
 	// Enforce known common name and default DNS if configured.
 	// By default we we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
-	var so []SignOption
+	dnsName1 := fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID)
+	dnsName2 := fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID)
 	if p.DisableCustomSANs {
-		dnsName1 := fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID)
-		dnsName2 := fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID)
+		var cnOption SignOption = commonNameSliceValidator([]string{
+			ce.InstanceName, ce.InstanceID, dnsName1, dnsName2,
+		})
+		if p.OverwriteCommonName {
+			cnOption = commonNameModifier(ce.InstanceName)
+		}
 		so = append(so,
-			commonNameSliceValidator([]string{
-				ce.InstanceName, ce.InstanceID, dnsName1, dnsName2,
-			}),
+			cnOption,
 			dnsNamesValidator([]string{
 				dnsName1, dnsName2,
 			}),
@@ -259,7 +513,41 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 		// Template SANs
 		data.SetSANs([]string{dnsName1, dnsName2})
+	} else {
+		so = append(so, customSANsOptions(p.CustomSANsMode, data, []string{dnsName1, dnsName2})...)
+	}
+	if p.StrictIdentity {
+		so = append(so, newStrictIdentityValidator(
+			[]string{ce.InstanceName, ce.InstanceID},
+			[]string{dnsName1, dnsName2},
+		))
+	}
+
+	// Add the SPIFFE ID and the subject if configured.
+	identity := map[string]string{
+		"ProjectID":     ce.ProjectID,
+		"ProjectNumber": strconv.FormatInt(ce.ProjectNumber, 10),
+		"Zone":          ce.Zone,
+		"InstanceID":    ce.InstanceID,
+		"InstanceName":  ce.InstanceName,
+	}
+	spiffeOptions, err := p.SPIFFE.newOptions(identity)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "gcp.AuthorizeSign")
 	}
+	so = append(so, spiffeOptions...)
+	subjectOptions, err := p.Subject.newOptions(identity)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
+	so = append(so, subjectOptions...)
+
+	// Bind the validity to the token expiration if configured.
+	expiryOptions, err := p.BindToTokenExpiry.newOptions(claims.Claims)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.AuthorizeSign")
+	}
+	so = append(so, expiryOptions...)
 
 	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
 	if err != nil {
@@ -274,7 +562,7 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -284,6 +572,44 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	), nil
 }
 
+// AuthorizeRevoke validates the given revocation token. It returns an error if
+// revocation is not enabled.
+func (p *GCP) AuthorizeRevoke(ctx context.Context, token string) error {
+	if !p.EnableRevoke {
+		return errs.Unauthorized("gcp.AuthorizeRevoke; revoke is disabled for gcp provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeRevoke")
+	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeRevoke")
+	}
+	return nil
+}
+
+// AuthorizeRevokeCertificate returns an error if the certificate was not
+// issued by this provisioner to the instance in the given revocation token.
+func (p *GCP) AuthorizeRevokeCertificate(ctx context.Context, token string, cert *x509.Certificate) error {
+	if !p.EnableRevoke {
+		return errs.Unauthorized("gcp.AuthorizeRevokeCertificate; revoke is disabled for gcp provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeRevokeCertificate")
+	}
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeGCP || ext.Name != p.Name {
+		return errs.Unauthorized("gcp.AuthorizeRevokeCertificate; certificate was not issued by gcp provisioner '%s'", p.GetName())
+	}
+	for i := 0; i+1 < len(ext.KeyValuePairs); i += 2 {
+		if ext.KeyValuePairs[i] == "InstanceID" && ext.KeyValuePairs[i+1] == claims.Google.ComputeEngine.InstanceID {
+			return nil
+		}
+	}
+	return errs.Unauthorized("gcp.AuthorizeRevokeCertificate; certificate was not issued to instance '%s'", claims.Google.ComputeEngine.InstanceID)
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *GCP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	return p.ctl.AuthorizeRenew(ctx, cert)
@@ -299,19 +625,19 @@ func (p *GCP) assertConfig() {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
+func (p *GCP) authorizeToken(ctx context.Context, token string, audiences []string) (*gcpPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; error parsing gcp token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; error parsing gcp token"))
 	}
 	if len(jwt.Headers) == 0 {
-		return nil, errs.Unauthorized("gcp.authorizeToken; error parsing gcp token - header is missing")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Unauthorized("gcp.authorizeToken; error parsing gcp token - header is missing"))
 	}
 
 	var found bool
 	var claims gcpPayload
 	kid := jwt.Headers[0].KeyID
-	keys := p.keyStore.Get(kid)
+	keys := p.keyStore.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -319,7 +645,7 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 		}
 	}
 	if !found {
-		return nil, errs.Unauthorized("gcp.authorizeToken; failed to validate gcp token payload - cannot find key for kid %s", kid)
+		return nil, authorizeErr(ReasonUnknownKey, errs.Unauthorized("gcp.authorizeToken; failed to validate gcp token payload - cannot find key for kid %s", kid))
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
@@ -329,25 +655,18 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 		Issuer: "https://accounts.google.com",
 		Time:   now,
 	}, time.Minute); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; invalid gcp token payload")
+		return nil, authorizeErr(validationReason(err), errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; invalid gcp token payload"))
 	}
 
 	// validate audiences with the defaults
-	if !matchesAudience(claims.Audience, p.ctl.Audiences.Sign) {
-		return nil, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid audience claim (aud)")
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, authorizeErr(ReasonInvalidAudience, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid audience claim (aud)"))
 	}
 
 	// validate subject (service account)
 	if len(p.ServiceAccounts) > 0 {
-		var found bool
-		for _, sa := range p.ServiceAccounts {
-			if sa == claims.Subject || sa == claims.Email {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return nil, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid subject claim")
+		if !p.matchServiceAccount(claims.Subject) && !p.matchServiceAccount(claims.Email) {
+			return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid subject claim"))
 		}
 	}
 
@@ -361,40 +680,58 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid project id")
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid project id"))
+		}
+	}
+
+	// validate labels
+	for k, v := range p.Labels {
+		if got, ok := claims.Google.ComputeEngine.Labels[k]; !ok || got != v {
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid label %q", k))
 		}
 	}
 
 	// validate instance age
 	if d := p.InstanceAge.Value(); d > 0 {
-		if now.Sub(claims.Google.ComputeEngine.InstanceCreationTimestamp.Time()) > d {
-			return nil, errs.Unauthorized("gcp.authorizeToken; token google.compute_engine.instance_creation_timestamp is too old")
+		skew := p.ClockSkew.Value()
+		if skew == 0 {
+			skew = defaultGCPClockSkew
+		}
+		created := claims.Google.ComputeEngine.InstanceCreationTimestamp.Time()
+		if now.Sub(created) > d+skew {
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; token google.compute_engine.instance_creation_timestamp is too old"))
+		}
+		if created.After(now.Add(skew)) {
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; token google.compute_engine.instance_creation_timestamp is in the future"))
 		}
 	}
 
 	switch {
 	case claims.Google.ComputeEngine.InstanceID == "":
-		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.instance_id cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.instance_id cannot be empty"))
 	case claims.Google.ComputeEngine.InstanceName == "":
-		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.instance_name cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.instance_name cannot be empty"))
 	case claims.Google.ComputeEngine.ProjectID == "":
-		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.project_id cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.project_id cannot be empty"))
 	case claims.Google.ComputeEngine.Zone == "":
-		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.zone cannot be empty")
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("gcp.authorizeToken; gcp token google.compute_engine.zone cannot be empty"))
 	}
 
 	return &claims, nil
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("gcp.AuthorizeSSHSign; sshCA is disabled for gcp provisioner '%s'", p.GetName())
 	}
-	claims, err := p.authorizeToken(token)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
+	}
 
 	ce := claims.Google.ComputeEngine
 	signOptions := []SignOption{}
@@ -405,15 +742,29 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 
 	// Validated principals.
-	principals := []string{
+	principals, principalsOptions, err := p.SSHHostPrincipals.newOptions(map[string]string{
+		"ProjectID":     ce.ProjectID,
+		"ProjectNumber": strconv.FormatInt(ce.ProjectNumber, 10),
+		"Zone":          ce.Zone,
+		"InstanceID":    ce.InstanceID,
+		"InstanceName":  ce.InstanceName,
+	}, []string{
 		fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
 		fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "gcp.AuthorizeSSHSign")
 	}
 
-	// Only enforce known principals if disable custom sans is true.
-	if p.DisableCustomSANs {
+	// Only enforce known principals if disable custom sans is true. The
+	// requested principals are restricted to the generated ones if
+	// SSHHostPrincipals is set.
+	switch {
+	case principalsOptions != nil:
+		signOptions = append(signOptions, principalsOptions...)
+	case p.DisableCustomSANs:
 		defaults.Principals = principals
-	} else {
+	default:
 		// Check that at least one principal is sent in the request.
 		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
 			Principals: true,
@@ -432,6 +783,9 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Validate user SignSSHOptions.
@@ -445,7 +799,7 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil, p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -454,3 +808,17 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		),
 	), nil
 }
+
+// isGCPLabel returns true if the given string is a valid GCP label key or
+// value: up to 63 lowercase letters, numbers, underscores or dashes.
+func isGCPLabel(s string) bool {
+	if s == "" || len(s) > 63 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -7,13 +7,16 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -174,6 +177,7 @@ func TestGCP_Init(t *testing.T) {
 		Name            string
 		ServiceAccounts []string
 		InstanceAge     Duration
+		ClockSkew       Duration
 		Claims          *Claims
 	}
 	type args struct {
@@ -186,14 +190,15 @@ func TestGCP_Init(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		{"ok", fields{"GCP", "name", nil, zero, nil}, args{config, srv.URL}, false},
-		{"ok", fields{"GCP", "name", []string{"service-account"}, zero, nil}, args{config, srv.URL}, false},
-		{"ok", fields{"GCP", "name", []string{"service-account"}, Duration{Duration: 1 * time.Minute}, nil}, args{config, srv.URL}, false},
-		{"bad type", fields{"", "name", nil, zero, nil}, args{config, srv.URL}, true},
-		{"bad name", fields{"GCP", "", nil, zero, nil}, args{config, srv.URL}, true},
-		{"bad duration", fields{"GCP", "name", nil, Duration{Duration: -1 * time.Minute}, nil}, args{config, srv.URL}, true},
-		{"bad claims", fields{"GCP", "name", nil, zero, badClaims}, args{config, srv.URL}, true},
-		{"bad certs", fields{"GCP", "name", nil, zero, nil}, args{config, srv.URL + "/error"}, true},
+		{"ok", fields{"GCP", "name", nil, zero, zero, nil}, args{config, srv.URL}, false},
+		{"ok", fields{"GCP", "name", []string{"service-account"}, zero, zero, nil}, args{config, srv.URL}, false},
+		{"ok", fields{"GCP", "name", []string{"service-account"}, Duration{Duration: 1 * time.Minute}, zero, nil}, args{config, srv.URL}, false},
+		{"bad type", fields{"", "name", nil, zero, zero, nil}, args{config, srv.URL}, true},
+		{"bad name", fields{"GCP", "", nil, zero, zero, nil}, args{config, srv.URL}, true},
+		{"bad duration", fields{"GCP", "name", nil, Duration{Duration: -1 * time.Minute}, zero, nil}, args{config, srv.URL}, true},
+		{"bad clock skew", fields{"GCP", "name", nil, zero, Duration{Duration: -1 * time.Minute}, nil}, args{config, srv.URL}, true},
+		{"bad claims", fields{"GCP", "name", nil, zero, zero, badClaims}, args{config, srv.URL}, true},
+		{"bad certs", fields{"GCP", "name", nil, zero, zero, nil}, args{config, srv.URL + "/error"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -202,6 +207,7 @@ func TestGCP_Init(t *testing.T) {
 				Name:            tt.fields.Name,
 				ServiceAccounts: tt.fields.ServiceAccounts,
 				InstanceAge:     tt.fields.InstanceAge,
+				ClockSkew:       tt.fields.ClockSkew,
 				Claims:          tt.fields.Claims,
 				config: &gcpConfig{
 					CertsURL:    tt.args.certsURL,
@@ -215,6 +221,142 @@ func TestGCP_Init(t *testing.T) {
 	}
 }
 
+func TestGCP_Init_labels(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"ok", map[string]string{"role": "ingress", "env": "prod", "empty": ""}, false},
+		{"ok empty", map[string]string{}, false},
+		{"fail empty key", map[string]string{"": "prod"}, true},
+		{"fail key uppercase", map[string]string{"Role": "ingress"}, true},
+		{"fail key start", map[string]string{"1role": "ingress"}, true},
+		{"fail value", map[string]string{"role": "in gress"}, true},
+		{"fail value length", map[string]string{"role": strings.Repeat("a", 64)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &GCP{
+				Type:   "GCP",
+				Name:   "name",
+				Labels: tt.labels,
+				config: &gcpConfig{
+					CertsURL:    srv.URL,
+					IdentityURL: gcpIdentityURL,
+				},
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("GCP.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGCP_Init_serviceAccounts(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name            string
+		match           string
+		serviceAccounts []string
+		wantErr         bool
+	}{
+		{"ok default", "", []string{"foo@project.iam.gserviceaccount.com"}, false},
+		{"ok exact", "exact", []string{"*-ci@project.iam.gserviceaccount.com"}, false},
+		{"ok glob", "glob", []string{"*-ci@*.iam.gserviceaccount.com"}, false},
+		{"ok regex", "regex", []string{`[a-z]+-ci@[a-z-]+\.iam\.gserviceaccount\.com`}, false},
+		{"fail glob", "glob", []string{"[-ci@project.iam.gserviceaccount.com"}, true},
+		{"fail regex", "regex", []string{"(-ci@project.iam.gserviceaccount.com"}, true},
+		{"fail match", "prefix", []string{"foo@project.iam.gserviceaccount.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &GCP{
+				Type:                 "GCP",
+				Name:                 "name",
+				ServiceAccounts:      tt.serviceAccounts,
+				ServiceAccountsMatch: tt.match,
+				config: &gcpConfig{
+					CertsURL:    srv.URL,
+					IdentityURL: gcpIdentityURL,
+				},
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("GCP.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGCP_authorizeToken_serviceAccountsMatch(t *testing.T) {
+	newGCP := func(match string, serviceAccounts ...string) *GCP {
+		p, err := generateGCP()
+		assert.FatalError(t, err)
+		p.ServiceAccounts = serviceAccounts
+		p.ServiceAccountsMatch = match
+		assert.FatalError(t, p.initServiceAccounts())
+		return p
+	}
+	newToken := func(p *GCP, sub, email string) string {
+		tok, err := generateGCPToken(sub,
+			"https://accounts.google.com", p.GetID(),
+			"instance-id", "instance-name", "project-id", "zone",
+			time.Now(), &p.keyStore.keySet.Keys[0], func(payload *gcpPayload) {
+				payload.Email = email
+			})
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	exact := newGCP("", "build-ci@project.iam.gserviceaccount.com")
+	glob := newGCP("glob", "*-ci@*.iam.gserviceaccount.com", "admin@project.iam.gserviceaccount.com")
+	regex := newGCP("regex", `[a-z]+-ci@(dev|prod)-project\.iam\.gserviceaccount\.com`)
+	exactPattern := newGCP("", "*-ci@project.iam.gserviceaccount.com")
+
+	tests := []struct {
+		name    string
+		p       *GCP
+		token   string
+		wantErr bool
+	}{
+		{"ok exact email", exact, newToken(exact, "1234567890", "build-ci@project.iam.gserviceaccount.com"), false},
+		{"ok exact subject", exact, newToken(exact, "build-ci@project.iam.gserviceaccount.com", ""), false},
+		{"ok glob", glob, newToken(glob, "1234567890", "build-ci@project.iam.gserviceaccount.com"), false},
+		{"ok glob other project", glob, newToken(glob, "1234567890", "deploy-ci@other-project.iam.gserviceaccount.com"), false},
+		{"ok glob literal", glob, newToken(glob, "1234567890", "admin@project.iam.gserviceaccount.com"), false},
+		{"ok regex", regex, newToken(regex, "1234567890", "build-ci@prod-project.iam.gserviceaccount.com"), false},
+		{"fail exact", exact, newToken(exact, "1234567890", "deploy-ci@project.iam.gserviceaccount.com"), true},
+		{"fail exact pattern", exactPattern, newToken(exactPattern, "1234567890", "build-ci@project.iam.gserviceaccount.com"), true},
+		{"fail glob", glob, newToken(glob, "1234567890", "build@project.iam.gserviceaccount.com"), true},
+		{"fail regex", regex, newToken(regex, "1234567890", "build-ci@test-project.iam.gserviceaccount.com"), true},
+		{"fail regex partial", regex, newToken(regex, "1234567890", "build-ci@prod-project.iam.gserviceaccount.com.evil"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.p.authorizeToken(context.Background(), tt.token, tt.p.ctl.Audiences.Sign)
+			if !tt.wantErr {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *AuthorizeError
+			if assert.Error(t, err) && assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, ReasonInvalidSubject, ae.Reason)
+			}
+		})
+	}
+}
+
 func TestGCP_authorizeToken(t *testing.T) {
 	type test struct {
 		p     *GCP
@@ -296,6 +438,40 @@ func TestGCP_authorizeToken(t *testing.T) {
 				err:   errors.New("gcp.authorizeToken; invalid gcp token - invalid project id"),
 			}
 		},
+		"fail/missing-labels": func(t *testing.T) test {
+			p, err := generateGCP()
+			assert.FatalError(t, err)
+			p.Labels = map[string]string{"role": "ingress"}
+			tok, err := generateGCPToken(p.ServiceAccounts[0],
+				"https://accounts.google.com", p.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				time.Now(), &p.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New(`gcp.authorizeToken; invalid gcp token - invalid label "role"`),
+			}
+		},
+		"fail/invalid-labels": func(t *testing.T) test {
+			p, err := generateGCP()
+			assert.FatalError(t, err)
+			p.Labels = map[string]string{"role": "ingress", "env": "prod"}
+			tok, err := generateGCPToken(p.ServiceAccounts[0],
+				"https://accounts.google.com", p.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				time.Now(), &p.keyStore.keySet.Keys[0], func(claims *gcpPayload) {
+					claims.Google.ComputeEngine.Labels = map[string]string{"role": "ingress", "env": "dev"}
+				})
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New(`gcp.authorizeToken; invalid gcp token - invalid label "env"`),
+			}
+		},
 		"fail/instance-age": func(t *testing.T) test {
 			p, err := generateGCP()
 			assert.FatalError(t, err)
@@ -303,7 +479,9 @@ func TestGCP_authorizeToken(t *testing.T) {
 			tok, err := generateGCPToken(p.ServiceAccounts[0],
 				"https://accounts.google.com", p.GetID(),
 				"instance-id", "instance-name", "project-id", "zone",
-				time.Now().Add(-1*time.Minute), &p.keyStore.keySet.Keys[0])
+				time.Now().Add(-1*time.Minute), &p.keyStore.keySet.Keys[0], func(claims *gcpPayload) {
+					claims.Google.ComputeEngine.InstanceCreationTimestamp = jose.NewNumericDate(time.Now().Add(-3 * time.Minute))
+				})
 			assert.FatalError(t, err)
 			return test{
 				p:     p,
@@ -385,11 +563,27 @@ func TestGCP_authorizeToken(t *testing.T) {
 				token: tok,
 			}
 		},
+		"ok/labels": func(t *testing.T) test {
+			p, err := generateGCP()
+			assert.FatalError(t, err)
+			p.Labels = map[string]string{"role": "ingress", "env": "prod"}
+			tok, err := generateGCPToken(p.ServiceAccounts[0],
+				"https://accounts.google.com", p.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				time.Now(), &p.keyStore.keySet.Keys[0], func(claims *gcpPayload) {
+					claims.Google.ComputeEngine.Labels = map[string]string{"role": "ingress", "env": "prod", "team": "foo"}
+				})
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if claims, err := tc.p.authorizeToken(tc.token); err != nil {
+			if claims, err := tc.p.authorizeToken(context.Background(), tc.token, tc.p.ctl.Audiences.Sign); err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
 					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
@@ -425,6 +619,27 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 	p3.ServiceAccounts = []string{"foo@developer.gserviceaccount.com"}
 	p3.InstanceAge = Duration{1 * time.Minute}
 
+	p4, err := generateGCP()
+	assert.FatalError(t, err)
+	p4.CustomSANsMode = CustomSANsMerge
+
+	spiffeID := &url.URL{Scheme: "spiffe", Host: "project-id", Path: "/instance-id"}
+	p5, err := generateGCP()
+	assert.FatalError(t, err)
+	p5.ctl.SANResolver = SANResolverFunc(func(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error) {
+		assert.Equals(t, p5, req.Provisioner)
+		ce := req.Claims["google"].(map[string]interface{})["compute_engine"].(map[string]interface{})
+		return &ResolvedSANs{
+			URIs: []*url.URL{{Scheme: "spiffe", Host: ce["project_id"].(string), Path: "/" + ce["instance_id"].(string)}},
+		}, nil
+	})
+
+	p6, err := generateGCP()
+	assert.FatalError(t, err)
+	p6.ctl.SANResolver = SANResolverFunc(func(ctx context.Context, req *SANResolverRequest) (*ResolvedSANs, error) {
+		return nil, errors.New("instance not allowed")
+	})
+
 	aKey, err := generateJSONWebKey()
 	assert.FatalError(t, err)
 
@@ -443,6 +658,21 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 		"instance-id", "instance-name", "other-project-id", "zone",
 		time.Now(), &p3.keyStore.keySet.Keys[0])
 	assert.FatalError(t, err)
+	t4, err := generateGCPToken(p4.ServiceAccounts[0],
+		"https://accounts.google.com", p4.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p4.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+	t5, err := generateGCPToken(p5.ServiceAccounts[0],
+		"https://accounts.google.com", p5.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p5.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+	t6, err := generateGCPToken(p6.ServiceAccounts[0],
+		"https://accounts.google.com", p6.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p6.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
 
 	failKey, err := generateGCPToken(p1.ServiceAccounts[0],
 		"https://accounts.google.com", p1.GetID(),
@@ -479,10 +709,30 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 		"instance-id", "instance-name", "project-id", "zone",
 		time.Now(), &p3.keyStore.keySet.Keys[0])
 	assert.FatalError(t, err)
+	withCreationTimestamp := func(tm time.Time) func(*gcpPayload) {
+		return func(p *gcpPayload) {
+			p.Google.ComputeEngine.InstanceCreationTimestamp = jose.NewNumericDate(tm)
+		}
+	}
+	okInstanceAgeSkew, err := generateGCPToken(p3.ServiceAccounts[0],
+		"https://accounts.google.com", p3.GetID(),
+		"instance-id", "instance-name", "other-project-id", "zone",
+		time.Now(), &p3.keyStore.keySet.Keys[0], withCreationTimestamp(time.Now().Add(-110*time.Second)))
+	assert.FatalError(t, err)
+	okInstanceFutureSkew, err := generateGCPToken(p3.ServiceAccounts[0],
+		"https://accounts.google.com", p3.GetID(),
+		"instance-id", "instance-name", "other-project-id", "zone",
+		time.Now(), &p3.keyStore.keySet.Keys[0], withCreationTimestamp(time.Now().Add(50*time.Second)))
+	assert.FatalError(t, err)
 	failInvalidInstanceAge, err := generateGCPToken(p3.ServiceAccounts[0],
 		"https://accounts.google.com", p3.GetID(),
 		"instance-id", "instance-name", "other-project-id", "zone",
-		time.Now().Add(-1*time.Minute), &p3.keyStore.keySet.Keys[0])
+		time.Now(), &p3.keyStore.keySet.Keys[0], withCreationTimestamp(time.Now().Add(-130*time.Second)))
+	assert.FatalError(t, err)
+	failInstanceFuture, err := generateGCPToken(p3.ServiceAccounts[0],
+		"https://accounts.google.com", p3.GetID(),
+		"instance-id", "instance-name", "other-project-id", "zone",
+		time.Now(), &p3.keyStore.keySet.Keys[0], withCreationTimestamp(time.Now().Add(70*time.Second)))
 	assert.FatalError(t, err)
 	failInstanceID, err := generateGCPToken(p1.ServiceAccounts[0],
 		"https://accounts.google.com", p1.GetID(),
@@ -516,9 +766,12 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 		code    int
 		wantErr bool
 	}{
-		{"ok", p1, args{t1}, 8, http.StatusOK, false},
-		{"ok", p2, args{t2}, 13, http.StatusOK, false},
-		{"ok", p3, args{t3}, 8, http.StatusOK, false},
+		{"ok", p1, args{t1}, 13, http.StatusOK, false},
+		{"ok", p2, args{t2}, 18, http.StatusOK, false},
+		{"ok", p3, args{t3}, 13, http.StatusOK, false},
+		{"ok merge", p4, args{t4}, 14, http.StatusOK, false},
+		{"ok resolver", p5, args{t5}, 14, http.StatusOK, false},
+		{"fail resolver", p6, args{t6}, 0, http.StatusForbidden, true},
 		{"fail token", p1, args{"token"}, 0, http.StatusUnauthorized, true},
 		{"fail key", p1, args{failKey}, 0, http.StatusUnauthorized, true},
 		{"fail iss", p1, args{failIss}, 0, http.StatusUnauthorized, true},
@@ -527,7 +780,10 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 		{"fail nbf", p1, args{failNbf}, 0, http.StatusUnauthorized, true},
 		{"fail service account", p1, args{failServiceAccount}, 0, http.StatusUnauthorized, true},
 		{"fail invalid project id", p3, args{failInvalidProjectID}, 0, http.StatusUnauthorized, true},
+		{"ok instance age within skew", p3, args{okInstanceAgeSkew}, 13, http.StatusOK, false},
+		{"ok instance creation within skew", p3, args{okInstanceFutureSkew}, 13, http.StatusOK, false},
 		{"fail invalid instance age", p3, args{failInvalidInstanceAge}, 0, http.StatusUnauthorized, true},
+		{"fail instance creation in the future", p3, args{failInstanceFuture}, 0, http.StatusUnauthorized, true},
 		{"fail instance id", p1, args{failInstanceID}, 0, http.StatusUnauthorized, true},
 		{"fail instance name", p1, args{failInstanceName}, 0, http.StatusUnauthorized, true},
 		{"fail project id", p1, args{failProjectID}, 0, http.StatusUnauthorized, true},
@@ -572,10 +828,24 @@ func TestGCP_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, MethodFromContext(v.ctx), SignMethod)
 					case dnsNamesValidator:
 						assert.Equals(t, []string(v), []string{"instance-name.c.project-id.internal", "instance-name.zone.c.project-id.internal"})
+					case mergeSANsModifier:
+						assert.Equals(t, []string(v), []string{"instance-name.c.project-id.internal", "instance-name.zone.c.project-id.internal"})
+					case resolvedSANsModifier:
+						assert.Equals(t, v.URIs, []*url.URL{spiffeID})
 					case *x509NamePolicyValidator:
 						assert.Equals(t, nil, v.policyEngine)
 					case *WebhookController:
 						assert.Len(t, 0, v.webhooks)
+					case X509SignerName:
+						assert.Equals(t, "", string(v))
+					case *uniqueSANOption:
+						assert.False(t, v.Enabled)
+					case *signatureAlgorithmOption:
+						assert.Len(t, 0, v.Allowed)
+					case DuplicateDNSNamesPolicy:
+						assert.Equals(t, "", string(v))
+					case X509SerialGenerator:
+						assert.Nil(t, v.SerialGenerator)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -749,3 +1019,255 @@ func TestGCP_AuthorizeRenew(t *testing.T) {
 		})
 	}
 }
+
+func TestGCP_AuthorizeRevoke(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.EnableRevoke = true
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.keyStore = p1.keyStore
+
+	revokeAudience := func(p *GCP) func(*gcpPayload) {
+		return func(c *gcpPayload) {
+			c.Audience = []string{"https://ca.smallstep.com/1.0/revoke#" + p.GetIDForToken()}
+		}
+	}
+	newToken := func(p *GCP, opts ...func(*gcpPayload)) string {
+		tok, err := generateGCPToken(p.ServiceAccounts[0],
+			"https://accounts.google.com", p.GetIDForToken(),
+			"instance-id", "instance-name", "project-id", "zone",
+			time.Now(), &p1.keyStore.keySet.Keys[0], opts...)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name    string
+		prov    *GCP
+		token   string
+		code    int
+		wantErr bool
+	}{
+		{"ok", p1, newToken(p1, revokeAudience(p1)), http.StatusOK, false},
+		{"fail/revoke-disabled", p2, newToken(p2, revokeAudience(p2)), http.StatusUnauthorized, true},
+		{"fail/sign-audience", p1, newToken(p1), http.StatusUnauthorized, true},
+		{"fail/token", p1, "foo", http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.prov.AuthorizeRevoke(context.Background(), tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("GCP.AuthorizeRevoke() error = %v, wantErr %v", err, tt.wantErr)
+			} else if err != nil {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, sc.StatusCode(), tt.code)
+			}
+		})
+	}
+
+	// Revocation tokens are single use.
+	tok := newToken(p1, revokeAudience(p1))
+	got, err := p1.GetTokenID(tok)
+	assert.FatalError(t, err)
+	sum := sha256.Sum256([]byte(tok))
+	assert.Equals(t, strings.ToLower(hex.EncodeToString(sum[:])), got)
+}
+
+func TestGCP_AuthorizeRevokeCertificate(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.EnableRevoke = true
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.keyStore = p1.keyStore
+
+	tok, err := generateGCPToken(p1.ServiceAccounts[0],
+		"https://accounts.google.com", p1.GetIDForToken(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p1.keyStore.keySet.Keys[0], func(c *gcpPayload) {
+			c.Audience = []string{"https://ca.smallstep.com/1.0/revoke#" + p1.GetIDForToken()}
+		})
+	assert.FatalError(t, err)
+
+	newCert := func(typ Type, name, instanceID string) *x509.Certificate {
+		ext, err := (&Extension{
+			Type:          typ,
+			Name:          name,
+			CredentialID:  p1.ServiceAccounts[0],
+			KeyValuePairs: []string{"InstanceID", instanceID, "InstanceName", "instance-name"},
+		}).ToExtension()
+		assert.FatalError(t, err)
+		return &x509.Certificate{Extensions: []pkix.Extension{ext}}
+	}
+
+	tests := []struct {
+		name    string
+		prov    *GCP
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", p1, newCert(TypeGCP, p1.Name, "instance-id"), false},
+		{"fail/revoke-disabled", p2, newCert(TypeGCP, p2.Name, "instance-id"), true},
+		{"fail/other-instance", p1, newCert(TypeGCP, p1.Name, "other-instance-id"), true},
+		{"fail/other-provisioner", p1, newCert(TypeGCP, p2.Name, "instance-id"), true},
+		{"fail/other-type", p1, newCert(TypeAWS, p1.Name, "instance-id"), true},
+		{"fail/no-extension", p1, &x509.Certificate{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prov.AuthorizeRevokeCertificate(context.Background(), tok, tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GCP.AuthorizeRevokeCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGCP_AuthorizeSign_slowCerts(t *testing.T) {
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	jwk := p.keyStore.keySet.Keys[0]
+
+	var mu sync.Mutex
+	slow := false
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		isSlow := slow
+		mu.Unlock()
+		if isSlow {
+			<-release
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p.config = &gcpConfig{
+		CertsURL:         srv.URL,
+		IdentityURL:      gcpIdentityURL,
+		KeysMaxStaleness: time.Hour,
+	}
+	assert.FatalError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	defer p.keyStore.Close()
+
+	// Expire the keys and make the certs endpoint hang.
+	mu.Lock()
+	slow = true
+	mu.Unlock()
+	p.keyStore.Lock()
+	p.keyStore.expiry = time.Now().Add(-time.Minute)
+	p.keyStore.Unlock()
+
+	tok, err := generateGCPToken(p.ServiceAccounts[0],
+		"https://accounts.google.com", p.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &jwk)
+	assert.FatalError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.AuthorizeSign(NewContextWithMethod(context.Background(), SignMethod), tok)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.FatalError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("GCP.AuthorizeSign() is blocked by the certs endpoint")
+	}
+
+	// Past the max staleness the keys are reloaded before they are used.
+	p.keyStore.Lock()
+	p.keyStore.expiry = time.Now().Add(-2 * time.Hour)
+	p.keyStore.Unlock()
+	mu.Lock()
+	slow = false
+	mu.Unlock()
+	_, err = p.AuthorizeSign(NewContextWithMethod(context.Background(), SignMethod), tok)
+	assert.FatalError(t, err)
+	p.keyStore.RLock()
+	assert.True(t, p.keyStore.expiry.After(time.Now()))
+	p.keyStore.RUnlock()
+}
+
+func TestGCP_AuthorizeSign_replayProtection(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.ReplayProtection = true
+	p1.ctl.TokenCache = NewMemoryTokenCache(10)
+
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.ctl.TokenCache = NewMemoryTokenCache(10)
+
+	newToken := func(p *GCP, instanceID string) string {
+		tok, err := generateGCPToken(p.ServiceAccounts[0],
+			"https://accounts.google.com", p.GetID(),
+			instanceID, "instance-name", "project-id", "zone",
+			time.Now(), &p.keyStore.keySet.Keys[0])
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	ctx := NewContextWithMethod(context.Background(), SignMethod)
+	t1 := newToken(p1, "instance-id")
+
+	// A dry run does not mark the token as used.
+	_, err = p1.AuthorizeSign(NewContextWithDryRun(ctx), t1)
+	assert.FatalError(t, err)
+
+	_, err = p1.AuthorizeSign(ctx, t1)
+	assert.FatalError(t, err)
+	_, err = p1.AuthorizeSign(ctx, t1)
+	var ae *AuthorizeError
+	if assert.Error(t, err) && assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, ReasonTokenReused, ae.Reason)
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc))
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+
+	// A token with a different instance id is allowed.
+	_, err = p1.AuthorizeSign(ctx, newToken(p1, "other-instance-id"))
+	assert.FatalError(t, err)
+
+	// Tokens can be reused if replay protection is disabled.
+	t2 := newToken(p2, "instance-id")
+	_, err = p2.AuthorizeSign(ctx, t2)
+	assert.FatalError(t, err)
+	_, err = p2.AuthorizeSign(ctx, t2)
+	assert.FatalError(t, err)
+}
+
+func TestGCP_Check(t *testing.T) {
+	_, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		certsURL string
+		wantErr  bool
+	}{
+		{"ok", srv.URL + "/jwks_uri", false},
+		{"fail empty", srv.URL + "/empty", true},
+		{"fail error", srv.URL + "/error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateGCP()
+			assert.FatalError(t, err)
+			p.config.CertsURL = tt.certsURL
+			if err := p.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("GCP.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+// IsCACertificateRequest returns true if the given certificate request asks
+// for a CA certificate using the basic constraints extension.
+func IsCACertificateRequest(req *x509.CertificateRequest) bool {
+	for _, ext := range req.Extensions {
+		if !ext.Id.Equal(oidExtensionBasicConstraints) {
+			continue
+		}
+		isCA, err := parseBasicConstraintsIsCA(ext.Value)
+		return err == nil && isCA
+	}
+	return false
+}
+
+// IsCACertificate returns true if the given certificate template is a CA
+// certificate or it can sign certificates. Besides the fields of the template,
+// it checks the basic constraints and key usage extensions added with the
+// extensions of a template, the malformed ones are considered CA extensions.
+func IsCACertificate(cert *x509.Certificate) bool {
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+		return true
+	}
+	for _, ext := range cert.ExtraExtensions {
+		switch {
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			if isCA, err := parseBasicConstraintsIsCA(ext.Value); err != nil || isCA {
+				return true
+			}
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			// keyCertSign is the bit 5 of the key usage.
+			var usage asn1.BitString
+			if rest, err := asn1.Unmarshal(ext.Value, &usage); err != nil || len(rest) > 0 || usage.At(5) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseBasicConstraintsIsCA returns the cA field of the given basic
+// constraints extension.
+func parseBasicConstraintsIsCA(b []byte) (bool, error) {
+	var constraints struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}
+	if rest, err := asn1.Unmarshal(b, &constraints); err != nil {
+		return false, err
+	} else if len(rest) > 0 {
+		return false, errors.New("basic constraints extension has trailing data")
+	}
+	return constraints.IsCA, nil
+}
+
+// IntermediateCAOptions turns a provisioner into a dedicated provisioner of
+// intermediate CA certificates. The provisioner will only sign certificate
+// requests for CA certificates with one of the AllowedSubjects as the common
+// name, and the issued certificates will have the given MaxPathLen and
+// NameConstraints, regardless of the certificate template.
+//
+// Certificate requests for CA certificates are rejected by the provisioners
+// without these options.
+type IntermediateCAOptions struct {
+	MaxPathLen      int                       `json:"maxPathLen"`
+	AllowedSubjects []string                  `json:"allowedSubjects"`
+	NameConstraints *x509util.NameConstraints `json:"nameConstraints,omitempty"`
+}
+
+// init validates the intermediate CA options.
+func (o *IntermediateCAOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.MaxPathLen < 0:
+		return errors.New("intermediateCA maxPathLen cannot be negative")
+	case len(o.AllowedSubjects) == 0:
+		return errors.New("intermediateCA allowedSubjects cannot be empty")
+	}
+	for _, s := range o.AllowedSubjects {
+		if s == "" {
+			return errors.New("intermediateCA allowedSubjects cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// newOptions returns the sign options that validate the certificate request and
+// enforce the CA constraints in the certificate.
+func (o *IntermediateCAOptions) newOptions() []SignOption {
+	if o == nil {
+		return nil
+	}
+	return []SignOption{
+		intermediateCAValidator(o.AllowedSubjects),
+		X509IntermediateCA{
+			MaxPathLen:      o.MaxPathLen,
+			NameConstraints: o.NameConstraints,
+		},
+	}
+}
+
+// intermediateCAValidator is a CertificateRequestValidator that checks that
+// the certificate request asks for a CA certificate with one of the allowed
+// subjects.
+type intermediateCAValidator []string
+
+// Valid implements CertificateRequestValidator.
+func (v intermediateCAValidator) Valid(req *x509.CertificateRequest) error {
+	if !IsCACertificateRequest(req) {
+		return errs.Forbidden("certificate request is not for a CA certificate")
+	}
+	if !containsString(v, req.Subject.CommonName) {
+		return errs.Forbidden("certificate request common name %q is not allowed", req.Subject.CommonName)
+	}
+	return nil
+}
+
+// X509IntermediateCA is a SignOption that allows the authority to sign
+// certificate requests for CA certificates. It implements CertificateEnforcer
+// setting the basic constraints, name constraints and key usages of an
+// intermediate CA.
+type X509IntermediateCA struct {
+	MaxPathLen      int
+	NameConstraints *x509util.NameConstraints
+}
+
+// Enforce implements CertificateEnforcer.
+func (o X509IntermediateCA) Enforce(cert *x509.Certificate) error {
+	x509util.BasicConstraints{
+		IsCA:       true,
+		MaxPathLen: o.MaxPathLen,
+	}.Set(cert)
+	if o.NameConstraints != nil {
+		o.NameConstraints.Set(cert)
+	}
+	cert.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	cert.ExtKeyUsage = nil
+	cert.UnknownExtKeyUsage = nil
+	return nil
+}
@@ -0,0 +1,168 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x509util"
+)
+
+func newCACertificateRequest(t *testing.T, commonName string, isCA bool) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+	if isCA {
+		b, err := asn1.Marshal(struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}{IsCA: true, MaxPathLen: -1})
+		assert.FatalError(t, err)
+		template.ExtraExtensions = []pkix.Extension{
+			{Id: oidExtensionBasicConstraints, Critical: true, Value: b},
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func TestIsCACertificateRequest(t *testing.T) {
+	assert.True(t, IsCACertificateRequest(newCACertificateRequest(t, "Intermediate CA", true)))
+	assert.False(t, IsCACertificateRequest(newCACertificateRequest(t, "leaf", false)))
+	assert.False(t, IsCACertificateRequest(&x509.CertificateRequest{
+		Extensions: []pkix.Extension{{Id: oidExtensionBasicConstraints, Value: []byte("foo")}},
+	}))
+}
+
+func TestIsCACertificate(t *testing.T) {
+	ext := func(oid asn1.ObjectIdentifier, value []byte) []pkix.Extension {
+		return []pkix.Extension{{Id: oid, Value: value}}
+	}
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"ca", &x509.Certificate{BasicConstraintsValid: true, IsCA: true}, true},
+		{"cert sign", &x509.Certificate{KeyUsage: x509.KeyUsageCertSign}, true},
+		{"basic constraints extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionBasicConstraints, []byte{0x30, 0x03, 0x01, 0x01, 0xff})}, true},
+		{"malformed basic constraints extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionBasicConstraints, []byte("foo"))}, true},
+		{"key usage extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionKeyUsage, []byte{0x03, 0x02, 0x02, 0x04})}, true},
+		{"malformed key usage extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionKeyUsage, []byte("foo"))}, true},
+		{"leaf", &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}, false},
+		{"leaf basic constraints extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionBasicConstraints, []byte{0x30, 0x00})}, false},
+		{"leaf key usage extension", &x509.Certificate{ExtraExtensions: ext(oidExtensionKeyUsage, []byte{0x03, 0x02, 0x07, 0x80})}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, IsCACertificate(tt.cert))
+		})
+	}
+}
+
+func TestIntermediateCAOptions_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *IntermediateCAOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &IntermediateCAOptions{AllowedSubjects: []string{"Intermediate CA"}}, false},
+		{"ok max path len", &IntermediateCAOptions{MaxPathLen: 2, AllowedSubjects: []string{"Intermediate CA"}}, false},
+		{"fail negative max path len", &IntermediateCAOptions{MaxPathLen: -1, AllowedSubjects: []string{"Intermediate CA"}}, true},
+		{"fail no subjects", &IntermediateCAOptions{}, true},
+		{"fail empty subject", &IntermediateCAOptions{AllowedSubjects: []string{"Intermediate CA", ""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(); (err != nil) != tt.wantErr {
+				t.Errorf("IntermediateCAOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIntermediateCAOptions_newOptions(t *testing.T) {
+	var disabled *IntermediateCAOptions
+	assert.Nil(t, disabled.newOptions())
+
+	nc := &x509util.NameConstraints{PermittedDNSDomains: []string{"example.com"}}
+	o := &IntermediateCAOptions{MaxPathLen: 1, AllowedSubjects: []string{"Intermediate CA"}, NameConstraints: nc}
+	assert.Equals(t, []SignOption{
+		intermediateCAValidator{"Intermediate CA"},
+		X509IntermediateCA{MaxPathLen: 1, NameConstraints: nc},
+	}, o.newOptions())
+}
+
+func TestIntermediateCAValidator_Valid(t *testing.T) {
+	v := intermediateCAValidator{"Intermediate CA", "Other CA"}
+	tests := []struct {
+		name    string
+		req     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"ok", newCACertificateRequest(t, "Intermediate CA", true), false},
+		{"ok other", newCACertificateRequest(t, "Other CA", true), false},
+		{"fail not allowed", newCACertificateRequest(t, "Evil CA", true), true},
+		{"fail not ca", newCACertificateRequest(t, "Intermediate CA", false), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Valid(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("intermediateCAValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX509IntermediateCA_Enforce(t *testing.T) {
+	leaf := func() *x509.Certificate {
+		return &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+	}
+	keyUsage := x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	cert := leaf()
+	assert.FatalError(t, X509IntermediateCA{}.Enforce(cert))
+	assert.True(t, cert.BasicConstraintsValid)
+	assert.True(t, cert.IsCA)
+	assert.Equals(t, 0, cert.MaxPathLen)
+	assert.True(t, cert.MaxPathLenZero)
+	assert.Equals(t, keyUsage, cert.KeyUsage)
+	assert.Nil(t, cert.ExtKeyUsage)
+	assert.Nil(t, cert.PermittedDNSDomains)
+
+	cert = leaf()
+	assert.FatalError(t, X509IntermediateCA{
+		MaxPathLen: 2,
+		NameConstraints: &x509util.NameConstraints{
+			Critical:                true,
+			PermittedDNSDomains:     []string{".example.com"},
+			ExcludedDNSDomains:      []string{"internal.example.com"},
+			PermittedEmailAddresses: []string{"example.com"},
+			PermittedURIDomains:     []string{".example.com"},
+		},
+	}.Enforce(cert))
+	assert.True(t, cert.IsCA)
+	assert.Equals(t, 2, cert.MaxPathLen)
+	assert.False(t, cert.MaxPathLenZero)
+	assert.True(t, cert.PermittedDNSDomainsCritical)
+	assert.Equals(t, []string{".example.com"}, cert.PermittedDNSDomains)
+	assert.Equals(t, []string{"internal.example.com"}, cert.ExcludedDNSDomains)
+	assert.Equals(t, []string{"example.com"}, cert.PermittedEmailAddresses)
+	assert.Equals(t, []string{".example.com"}, cert.PermittedURIDomains)
+	assert.Equals(t, keyUsage, cert.KeyUsage)
+}
@@ -2,7 +2,9 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
+	"net"
 	"net/http"
 	"time"
 
@@ -30,16 +32,74 @@ type stepPayload struct {
 
 // JWK is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
+//
+// The EncryptedKey is by default a JWE encrypted with a password. If
+// DecrypterKeyURI is set, the EncryptedKey is a JWE encrypted with
+// RSA-OAEP-256 for the RSA key with that KMS URI, and it can only be
+// decrypted with access to the KMS.
+//
+// If ReplayProtection is true, a token can only be used once to sign a
+// certificate, even if the CA has no database to record the used tokens. The
+// token ids are kept in the TokenCache of the provisioner config until the
+// tokens expire. By default it is an in-memory cache, deployments with more
+// than one CA instance must configure a shared TokenCache.
+//
+// If AllowedCIDRs is set, certificates can only be signed in requests coming
+// from those networks. The address of the connection is used unless it is one
+// of the TrustedProxies, in that case the client address is taken from the
+// X-Forwarded-For header.
+//
+// If JWKSet is set, the tokens are verified with the keys of a remote JWK set
+// instead of Key, so the token issuers can rotate their keys without changes
+// in the CA configuration. Key, EncryptedKey and AdditionalKeys cannot be used
+// with a JWKSet, and the token identifier of the provisioner is its name
+// followed by a colon.
+//
+// AdditionalKeys can be used to rotate the provisioner key without downtime.
+// Tokens signed with any of them are accepted, the key is selected with the
+// "kid" header of the token. The ID of the provisioner is always derived from
+// Key.
+//
+// If ProofOfPossession is set, the X.509 sign tokens must include a nonce
+// issued by the provisioner signed with the key of the CSR.
+//
+// The EncryptedKey of the provisioner and of the AdditionalKeys can be a
+// reference to a secret, e.g. vault://secret/data/step#encryptedKey. The
+// references are resolved in Init with the SecretResolvers of the provisioner
+// config, and must resolve to a JWE. The file and env schemes, e.g.
+// file:///etc/step/jwk.jwe or env://STEP_JWK_KEY, are only available if the
+// config enables local secrets. The resolved keys are only used by the CA, they
+// are not returned by the provisioners and encrypted-key endpoints.
 type JWK struct {
 	*base
-	ID           string           `json:"-"`
-	Type         string           `json:"type"`
-	Name         string           `json:"name"`
+	ID                     string                    `json:"-"`
+	Type                   string                    `json:"type"`
+	Name                   string                    `json:"name"`
+	Key                    *jose.JSONWebKey          `json:"key,omitempty"`
+	JWKSet                 *JWKSetOptions            `json:"jwkSet,omitempty"`
+	EncryptedKey           string                    `json:"encryptedKey,omitempty"`
+	AdditionalKeys         []*JWKKey                 `json:"additionalKeys,omitempty"`
+	DecrypterKeyURI        string                    `json:"decrypterKey,omitempty"`
+	AllowedTokenAlgorithms []string                  `json:"allowedTokenAlgorithms,omitempty"`
+	ReplayProtection       bool                      `json:"replayProtection,omitempty"`
+	AllowedCIDRs           []string                  `json:"allowedCIDRs,omitempty"`
+	TrustedProxies         []string                  `json:"trustedProxies,omitempty"`
+	ProofOfPossession      *ProofOfPossessionOptions `json:"proofOfPossession,omitempty"`
+	Claims                 *Claims                   `json:"claims,omitempty"`
+	Options                *Options                  `json:"options,omitempty"`
+	encryptedKey           string
+	decrypter              crypto.Decrypter
+	allowedNets            []*net.IPNet
+	trustedProxies         []*net.IPNet
+	keyStore               *keyStore
+	ctl                    *Controller
+}
+
+// JWKKey is an additional key of a JWK provisioner, with its optional
+// EncryptedKey.
+type JWKKey struct {
 	Key          *jose.JSONWebKey `json:"key"`
 	EncryptedKey string           `json:"encryptedKey,omitempty"`
-	Claims       *Claims          `json:"claims,omitempty"`
-	Options      *Options         `json:"options,omitempty"`
-	ctl          *Controller
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -54,9 +114,34 @@ func (p *JWK) GetID() string {
 // GetIDForToken returns an identifier that will be used to load the provisioner
 // from a token.
 func (p *JWK) GetIDForToken() string {
+	if p.JWKSet != nil {
+		return p.Name + ":"
+	}
 	return p.Name + ":" + p.Key.KeyID
 }
 
+// getAdditionalIDsForToken returns the identifiers used to load the
+// provisioner from the tokens signed with the additional keys.
+func (p *JWK) getAdditionalIDsForToken() []string {
+	ids := make([]string, len(p.AdditionalKeys))
+	for i, k := range p.AdditionalKeys {
+		ids[i] = p.Name + ":" + k.Key.KeyID
+	}
+	return ids
+}
+
+// getAdditionalEncryptedKeys returns the encrypted keys of the additional
+// keys indexed by key id.
+func (p *JWK) getAdditionalEncryptedKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, k := range p.AdditionalKeys {
+		if k.EncryptedKey != "" && !isSecretReference(k.EncryptedKey) {
+			keys[k.Key.KeyID] = k.EncryptedKey
+		}
+	}
+	return keys
+}
+
 // GetTokenID returns the identifier of the token.
 func (p *JWK) GetTokenID(ott string) (string, error) {
 	// Validate payload
@@ -75,6 +160,32 @@ func (p *JWK) GetTokenID(ott string) (string, error) {
 	return claims.ID, nil
 }
 
+// useToken rejects the reuse of a token if replay protection is enabled.
+func (p *JWK) useToken(ctx context.Context, claims *jwtPayload, token string) error {
+	if !p.ReplayProtection {
+		return nil
+	}
+	key := tokenReplayKey(p.GetIDForToken(), "", claims.ID, token)
+	return p.ctl.useToken(ctx, key, tokenReplayExpiration(claims.Expiry))
+}
+
+// authorizeClientAddr returns an error if the provisioner has allowed CIDRs
+// and the client of the request in the context is not in any of them.
+func (p *JWK) authorizeClientAddr(ctx context.Context) error {
+	if len(p.allowedNets) == 0 {
+		return nil
+	}
+	addr, ok := ClientAddrFromContext(ctx)
+	if !ok {
+		return authorizeErr(ReasonAddressNotAllowed, errs.Unauthorized("jwk.authorizeClientAddr; client address is not available"))
+	}
+	ip := clientIP(addr, p.trustedProxies)
+	if ip == nil || !networksContain(p.allowedNets, ip) {
+		return authorizeErr(ReasonAddressNotAllowed, errs.Unauthorized("jwk.authorizeClientAddr; client address %s is not allowed", ip))
+	}
+	return nil
+}
+
 // GetName returns the name of the provisioner.
 func (p *JWK) GetName() string {
 	return p.Name
@@ -85,38 +196,245 @@ func (p *JWK) GetType() Type {
 	return TypeJWK
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *JWK) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *JWK) GetController() *Controller {
+	return p.ctl
+}
+
+// GetCapabilities returns the certificates the provisioner can issue.
+func (p *JWK) GetCapabilities() *Capabilities {
+	caps := newCapabilities(p.ctl.GetClaimer(), true, true)
+	caps.AllowCustomSANs = true
+	return caps
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+// Encrypted keys that are references to secrets are not returned.
 func (p *JWK) GetEncryptedKey() (string, string, bool) {
+	if p.Key == nil || isSecretReference(p.EncryptedKey) {
+		return "", "", false
+	}
 	return p.Key.KeyID, p.EncryptedKey, p.EncryptedKey != ""
 }
 
+// getEncryptedKey returns the resolved encrypted key of the provisioner.
+func (p *JWK) getEncryptedKey() string {
+	if p.encryptedKey != "" {
+		return p.encryptedKey
+	}
+	return p.EncryptedKey
+}
+
+// WithoutSecretReferences returns a copy of the provisioner without the
+// encrypted keys that are references to secrets, so neither the references
+// nor their values are published.
+func (p *JWK) WithoutSecretReferences() *JWK {
+	cp := *p
+	if isSecretReference(p.EncryptedKey) {
+		cp.EncryptedKey = ""
+	}
+	if len(p.AdditionalKeys) > 0 {
+		cp.AdditionalKeys = make([]*JWKKey, len(p.AdditionalKeys))
+		for i, k := range p.AdditionalKeys {
+			cp.AdditionalKeys[i] = &JWKKey{Key: k.Key}
+			if !isSecretReference(k.EncryptedKey) {
+				cp.AdditionalKeys[i].EncryptedKey = k.EncryptedKey
+			}
+		}
+	}
+	return &cp
+}
+
+// resolveEncryptedKeys resolves the encrypted keys of the provisioner that are
+// references to secrets.
+func (p *JWK) resolveEncryptedKeys(config Config) (err error) {
+	if p.encryptedKey, err = resolveEncryptedKey(config, "encryptedKey", p.EncryptedKey); err != nil {
+		return err
+	}
+	// The additional keys are only used to verify tokens, their references
+	// are resolved to validate them.
+	for _, k := range p.AdditionalKeys {
+		if _, err = resolveEncryptedKey(config, "additionalKeys encryptedKey", k.EncryptedKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveEncryptedKey resolves an encrypted key that is a reference to a
+// secret, and checks that the resolved value is a JWE.
+func resolveEncryptedKey(config Config, name, v string) (string, error) {
+	if !isSecretReference(v) {
+		return "", nil
+	}
+	key, err := resolveSecret(context.Background(), config, name, v)
+	if err != nil {
+		return "", err
+	}
+	if _, err := jose.ParseEncrypted(key); err != nil {
+		return "", errors.Errorf("provisioner %s reference does not resolve to a JWE", name)
+	}
+	return key, nil
+}
+
 // Init initializes and validates the fields of a JWK type.
 func (p *JWK) Init(config Config) (err error) {
+	var v configValidator
+	v.check(p.Type == "", "type", "provisioner type cannot be empty")
+	v.check(p.Name == "", "name", "provisioner name cannot be empty")
+	v.check(p.Key == nil && p.JWKSet == nil, "key", "provisioner key cannot be empty")
+	v.check(p.Key != nil && p.JWKSet != nil, "jwkSet", "provisioner key and jwkSet cannot be used together")
+	v.check(p.JWKSet != nil && (p.EncryptedKey != "" || len(p.AdditionalKeys) > 0), "jwkSet", "provisioner jwkSet cannot be used with encryptedKey or additionalKeys")
+	v.check(p.DecrypterKeyURI != "" && p.EncryptedKey == "", "decrypterKey", "provisioner decrypterKey requires an encryptedKey")
+	v.check(len(p.TrustedProxies) > 0 && len(p.AllowedCIDRs) == 0, "trustedProxies", "provisioner trustedProxies requires allowedCIDRs")
+	v.add("allowedTokenAlgorithms", validateTokenAlgorithms(p.AllowedTokenAlgorithms))
 	switch {
-	case p.Type == "":
-		return errors.New("provisioner type cannot be empty")
-	case p.Name == "":
-		return errors.New("provisioner name cannot be empty")
-	case p.Key == nil:
-		return errors.New("provisioner key cannot be empty")
+	case p.JWKSet != nil:
+		v.add("jwkSet", p.JWKSet.validate())
+	case p.Key != nil:
+		v.add("key", validateJWKAlgorithm(p.Key))
+		v.add("additionalKeys", p.validateAdditionalKeys())
+	}
+	v.add("proofOfPossession", p.ProofOfPossession.init())
+	if p.allowedNets, err = parseCIDRs("allowedCIDRs", p.AllowedCIDRs); err != nil {
+		v.add("allowedCIDRs", err)
+	}
+	if p.trustedProxies, err = parseCIDRs("trustedProxies", p.TrustedProxies); err != nil {
+		v.add("trustedProxies", err)
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if err := p.resolveEncryptedKeys(config); err != nil {
+		return err
+	}
+	if p.DecrypterKeyURI != "" {
+		if p.decrypter, err = newKMSDecrypter(p.DecrypterKeyURI); err != nil {
+			return errors.Wrap(err, "error initializing provisioner decrypterKey")
+		}
+	}
+
+	if p.JWKSet != nil {
+		if p.keyStore, err = p.JWKSet.newKeyStore(); err != nil {
+			return err
+		}
 	}
 
+	if p.ReplayProtection && config.TokenCache == nil {
+		config.TokenCache = NewMemoryTokenCache(DefaultTokenCacheSize)
+	}
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
 
+// validateAdditionalKeys returns an error if an additional key is not valid or
+// if the key ids of the provisioner keys are not unique.
+func (p *JWK) validateAdditionalKeys() error {
+	kids := map[string]bool{p.Key.KeyID: true}
+	for _, k := range p.AdditionalKeys {
+		switch {
+		case k == nil || k.Key == nil:
+			return errors.New("provisioner additionalKeys cannot contain empty keys")
+		case k.Key.KeyID == "":
+			return errors.New("provisioner additionalKeys cannot contain keys without a key id")
+		case kids[k.Key.KeyID]:
+			return errors.Errorf("provisioner additionalKeys key id %q is not unique", k.Key.KeyID)
+		case !k.Key.IsPublic():
+			return errors.Errorf("provisioner additionalKeys key %q must be a public key", k.Key.KeyID)
+		}
+		if err := validateJWKAlgorithm(k.Key); err != nil {
+			return err
+		}
+		kids[k.Key.KeyID] = true
+	}
+	return nil
+}
+
+// tokenKey returns the provisioner key with the key id in the header of the
+// token. It defaults to Key if no additional key matches.
+func (p *JWK) tokenKey(jwt *jose.JSONWebToken) *jose.JSONWebKey {
+	if len(jwt.Headers) > 0 && jwt.Headers[0].KeyID != "" {
+		for _, k := range p.AdditionalKeys {
+			if k.Key.KeyID == jwt.Headers[0].KeyID {
+				return k.Key
+			}
+		}
+	}
+	return p.Key
+}
+
+// credentialID returns the key id of the provisioner key, or the key id of the
+// token if the provisioner uses a remote key set.
+func (p *JWK) credentialID(token string) string {
+	if p.Key != nil {
+		return p.Key.KeyID
+	}
+	if jwt, err := jose.ParseSigned(token); err == nil && len(jwt.Headers) > 0 {
+		return jwt.Headers[0].KeyID
+	}
+	return ""
+}
+
+// validateJWKAlgorithm returns an error if the algorithm of the provisioner key
+// is not compatible with the key type and curve, e.g. ES256 with a P-384 key.
+// Keys without an algorithm are not validated.
+func validateJWKAlgorithm(key *jose.JSONWebKey) error {
+	if key.Algorithm == "" {
+		return nil
+	}
+	k := *key
+	k.Use = "sig"
+	if err := jose.ValidateJWK(&k); err != nil {
+		return errors.Wrap(err, "provisioner key is not valid")
+	}
+	return nil
+}
+
+// checkKeyAlgorithm returns an error if the token is not signed with the
+// algorithm of the provisioner key. Keys without an algorithm accept any
+// algorithm supported by the key.
+func checkKeyAlgorithm(jwt *jose.JSONWebToken, key *jose.JSONWebKey) error {
+	if key.Algorithm == "" {
+		return nil
+	}
+	for _, h := range jwt.Headers {
+		if h.Algorithm != key.Algorithm {
+			return errors.Errorf("token algorithm %q does not match the provisioner key algorithm %q", h.Algorithm, key.Algorithm)
+		}
+	}
+	return nil
+}
+
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, error) {
+func (p *JWK) authorizeToken(ctx context.Context, token string, audiences []string) (*jwtPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk token"))
+	}
+	if err := checkTokenAlgorithm(jwt, p.AllowedTokenAlgorithms); err != nil {
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; invalid jwk token"))
 	}
-
 	var claims jwtPayload
-	if err = jwt.Claims(p.Key, &claims); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk claims")
+	if p.keyStore != nil {
+		if err := p.verifyWithKeySet(ctx, jwt, &claims); err != nil {
+			return nil, err
+		}
+	} else {
+		key := p.tokenKey(jwt)
+		if err := checkKeyAlgorithm(jwt, key); err != nil {
+			return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; invalid jwk token"))
+		}
+		if err = jwt.Claims(key, &claims); err != nil {
+			return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk claims"))
+		}
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
@@ -125,17 +443,17 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 		Issuer: p.Name,
 		Time:   time.Now().UTC(),
 	}, time.Minute); err != nil {
-		return nil, errs.Wrapf(http.StatusUnauthorized, err, "jwk.authorizeToken; invalid jwk claims")
+		return nil, authorizeErr(validationReason(err), errs.Wrapf(http.StatusUnauthorized, err, "jwk.authorizeToken; invalid jwk claims"))
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, audiences) {
-		return nil, errs.Unauthorized("jwk.authorizeToken; invalid jwk token audience claim (aud); want %s, but got %s",
-			audiences, claims.Audience)
+		return nil, authorizeErr(ReasonInvalidAudience, errs.Unauthorized("jwk.authorizeToken; invalid jwk token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience))
 	}
 
 	if claims.Subject == "" {
-		return nil, errs.Unauthorized("jwk.authorizeToken; jwk token subject cannot be empty")
+		return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("jwk.authorizeToken; jwk token subject cannot be empty"))
 	}
 
 	return &claims, nil
@@ -143,18 +461,51 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
-func (p *JWK) AuthorizeRevoke(_ context.Context, token string) error {
-	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+func (p *JWK) AuthorizeRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
 	// TODO(hs): authorize the SANs using x509 name policy allow/deny rules (also for other provisioners with AuthorizeRevoke)
 	return errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeRevoke")
 }
 
+// NewProofOfPossessionNonce implements ProofOfPossessionNoncer and returns a
+// nonce to prove the possession of the CSR key.
+func (p *JWK) NewProofOfPossessionNonce() (string, time.Time, error) {
+	return p.ProofOfPossession.newNonce()
+}
+
 // AuthorizeSign validates the given token.
 func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
 	}
+	if err := p.authorizeClientAddr(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
+	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
+	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
+	}
+
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "jwk.AuthorizeSign")
+	}
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
+	// Require the proof of possession of the CSR key if configured.
+	popOptions, err := p.ProofOfPossession.newOptions(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.AuthorizeSign")
+	}
+	so = append(so, popOptions...)
 
 	// NOTE: This is for backwards compatibility with older versions of cli
 	// and certificates. Older versions added the token subject as the only SAN
@@ -183,20 +534,20 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		}
 	}
 
-	return []SignOption{
+	return append(so,
 		self,
 		templateOptions,
 		// modifiers / withOptions
-		newProvisionerExtensionOption(TypeJWK, p.Name, p.Key.KeyID).WithControllerOptions(p.ctl),
+		newProvisionerExtensionOption(TypeJWK, p.Name, p.credentialID(token)).WithControllerOptions(p.ctl),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		commonNameSliceValidator(append([]string{claims.Subject}, claims.SANs...)),
 		defaultPublicKeyValidator{},
 		newDefaultSANsValidator(ctx, claims.SANs),
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
-	}, nil
+	), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -209,17 +560,23 @@ func (p *JWK) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner '%s'", p.GetName())
 	}
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHSign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSSHSign")
 	}
 	if claims.Step == nil || claims.Step.SSH == nil {
 		return nil, errs.Unauthorized("jwk.AuthorizeSSHSign; jwk token must be an SSH provisioning token")
 	}
+	if err := p.authorizeClientAddr(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSSHSign")
+	}
+	if err := p.useToken(ctx, claims, token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSSHSign")
+	}
 
 	opts := claims.Step.SSH
 	signOptions := []SignOption{
@@ -239,6 +596,9 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		if certType, err = sshutil.CertTypeFromString(opts.CertType); err != nil {
 			return nil, errs.BadRequestErr(err, err.Error())
 		}
+		if err := p.ctl.sshCertTypes.Allow(certType.String()); err != nil {
+			return nil, err
+		}
 	}
 	if opts.KeyID != "" {
 		keyID = opts.KeyID
@@ -268,6 +628,12 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
 	}
 
+	// Set the extensions and critical options of the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHExtensionsOptions()...)
+
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Set the validity bounds if not set.
@@ -279,15 +645,15 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser(), p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
 }
 
 // AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
-func (p *JWK) AuthorizeSSHRevoke(_ context.Context, token string) error {
-	_, err := p.authorizeToken(token, p.ctl.Audiences.SSHRevoke)
+func (p *JWK) AuthorizeSSHRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHRevoke)
 	// TODO(hs): authorize the principals using SSH name policy allow/deny rules (also for other provisioners with AuthorizeSSHRevoke)
 	return errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSSHRevoke")
 }
@@ -0,0 +1,106 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+)
+
+// newKMSDecrypter returns the decrypter of the RSA key with the given KMS URI,
+// e.g. cloudkms:projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+// Creating the decrypter accesses the KMS, so an unreachable KMS or a missing
+// key are reported here.
+func newKMSDecrypter(keyURI string) (crypto.Decrypter, error) {
+	u, err := uri.Parse(keyURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing decrypter key: %w", err)
+	}
+	kmsType := kmsapi.SoftKMS
+	if u.Scheme != "" {
+		kmsType = kms.Type(u.Scheme)
+	}
+	opts := kms.Options{
+		Type: kmsType,
+		URI:  keyURI,
+	}
+	km, err := kms.New(context.Background(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed initializing kms: %w", err)
+	}
+	kmsDecrypter, ok := km.(kmsapi.Decrypter)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a kmsapi.Decrypter", opts.Type)
+	}
+	decryptionKey := keyURI
+	if kmsType != kmsapi.SoftKMS {
+		decryptionKey = u.Opaque
+	}
+	decrypter, err := kmsDecrypter.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+		DecryptionKey:    decryptionKey,
+		PasswordPrompter: kmsapi.NonInteractivePasswordPrompter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating decrypter: %w", err)
+	}
+	if _, ok := decrypter.Public().(*rsa.PublicKey); !ok {
+		return nil, errors.New("decrypter key is not an RSA key")
+	}
+	return decrypter, nil
+}
+
+// kmsKeyDecrypter implements the go-jose OpaqueKeyDecrypter interface, it
+// decrypts the content encryption key of a JWE using a KMS key.
+type kmsKeyDecrypter struct {
+	decrypter crypto.Decrypter
+}
+
+// DecryptKey decrypts the encrypted content encryption key of a JWE. Only the
+// RSA-OAEP-256 algorithm is supported.
+func (d kmsKeyDecrypter) DecryptKey(encryptedKey []byte, header jose.Header) ([]byte, error) {
+	if alg := jose.KeyAlgorithm(header.Algorithm); alg != jose.RSA_OAEP_256 {
+		return nil, errors.Errorf("unsupported key algorithm %q", alg)
+	}
+	return d.decrypter.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{
+		Hash: crypto.SHA256,
+	})
+}
+
+// DecryptKey decrypts the EncryptedKey of the provisioner. If DecrypterKeyURI
+// is set, the key is decrypted with the KMS key, otherwise the given password
+// is used.
+func (p *JWK) DecryptKey(password []byte) (*jose.JSONWebKey, error) {
+	enc, err := jose.ParseEncrypted(p.getEncryptedKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing provisioner encrypted key")
+	}
+
+	var key interface{} = password
+	if p.DecrypterKeyURI != "" {
+		decrypter := p.decrypter
+		if decrypter == nil {
+			if decrypter, err = newKMSDecrypter(p.DecrypterKeyURI); err != nil {
+				return nil, errors.Wrap(err, "error decrypting provisioner key")
+			}
+		}
+		key = kmsKeyDecrypter{decrypter: decrypter}
+	}
+
+	data, err := enc.Decrypt(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting provisioner key")
+	}
+	jwk := new(jose.JSONWebKey)
+	if err := json.Unmarshal(data, jwk); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling provisioner key")
+	}
+	return jwk, nil
+}
@@ -0,0 +1,141 @@
+package provisioner
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestJWK_DecryptKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	rsaFile := filepath.Join(dir, "rsa.key")
+	_, err = pemutil.Serialize(rsaKey, pemutil.ToFile(rsaFile, 0600))
+	assert.FatalError(t, err)
+	ecKey, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	ecFile := filepath.Join(dir, "ec.key")
+	_, err = pemutil.Serialize(ecKey, pemutil.ToFile(ecFile, 0600))
+	assert.FatalError(t, err)
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	pub := jwk.Public()
+
+	// Encrypted with a password.
+	jwe, err := jose.EncryptJWK(jwk, []byte("password"))
+	assert.FatalError(t, err)
+	passwordKey, err := jwe.CompactSerialize()
+	assert.FatalError(t, err)
+
+	// Encrypted with the RSA key.
+	b, err := json.Marshal(jwk)
+	assert.FatalError(t, err)
+	enc, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{
+		Algorithm: jose.RSA_OAEP_256,
+		Key:       rsaKey.Public(),
+	}, new(jose.EncrypterOptions).WithContentType("jwk+json"))
+	assert.FatalError(t, err)
+	jwe, err = enc.Encrypt(b)
+	assert.FatalError(t, err)
+	kmsKey, err := jwe.CompactSerialize()
+	assert.FatalError(t, err)
+
+	// Encrypted with the RSA key using RSA-OAEP.
+	enc, err = jose.NewEncrypter(jose.A256GCM, jose.Recipient{
+		Algorithm: jose.RSA_OAEP,
+		Key:       rsaKey.Public(),
+	}, nil)
+	assert.FatalError(t, err)
+	jwe, err = enc.Encrypt(b)
+	assert.FatalError(t, err)
+	oaepKey, err := jwe.CompactSerialize()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name     string
+		p        *JWK
+		password []byte
+		wantErr  bool
+	}{
+		{"ok password", &JWK{Key: &pub, EncryptedKey: passwordKey}, []byte("password"), false},
+		{"ok kms", &JWK{Key: &pub, EncryptedKey: kmsKey, DecrypterKeyURI: "softkms:path=" + rsaFile}, nil, false},
+		{"fail password", &JWK{Key: &pub, EncryptedKey: passwordKey}, []byte("foo"), true},
+		{"fail kms with password key", &JWK{Key: &pub, EncryptedKey: passwordKey, DecrypterKeyURI: "softkms:path=" + rsaFile}, nil, true},
+		{"fail kms algorithm", &JWK{Key: &pub, EncryptedKey: oaepKey, DecrypterKeyURI: "softkms:path=" + rsaFile}, nil, true},
+		{"fail kms ec key", &JWK{Key: &pub, EncryptedKey: kmsKey, DecrypterKeyURI: "softkms:path=" + ecFile}, nil, true},
+		{"fail encrypted key", &JWK{Key: &pub, EncryptedKey: "foo"}, []byte("password"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.DecryptKey(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JWK.DecryptKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.Equals(t, jwk.KeyID, got.KeyID)
+				assert.False(t, got.IsPublic())
+			}
+		})
+	}
+}
+
+func TestJWK_Init_decrypterKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	rsaFile := filepath.Join(dir, "rsa.key")
+	_, err = pemutil.Serialize(rsaKey, pemutil.ToFile(rsaFile, 0600))
+	assert.FatalError(t, err)
+	ecKey, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	ecFile := filepath.Join(dir, "ec.key")
+	_, err = pemutil.Serialize(ecKey, pemutil.ToFile(ecFile, 0600))
+	assert.FatalError(t, err)
+
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	newJWK := func(encryptedKey, uri string) *JWK {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.EncryptedKey = encryptedKey
+		p.DecrypterKeyURI = uri
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		p       *JWK
+		wantErr string
+	}{
+		{"ok", newJWK("encrypted", "softkms:path="+rsaFile), ""},
+		{"fail no encryptedKey", newJWK("", "softkms:path="+rsaFile), "provisioner decrypterKey requires an encryptedKey"},
+		{"fail missing key", newJWK("encrypted", "softkms:path="+filepath.Join(dir, "missing.key")), "error initializing provisioner decrypterKey"},
+		{"fail ec key", newJWK("encrypted", "softkms:path="+ecFile), "error initializing provisioner decrypterKey"},
+		{"fail kms", newJWK("encrypted", "foo:bar"), "error initializing provisioner decrypterKey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				assert.NotNil(t, tt.p.decrypter)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.True(t, strings.Contains(err.Error(), tt.wantErr), err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// JWKSetOptions configures a JWK provisioner that verifies the tokens with the
+// keys of a remote JWK set instead of a static key. The key set is downloaded
+// from URL and cached, and the token key is selected with its "kid" header.
+// The key set is reloaded every RefreshInterval, by default it uses the max-age
+// of the Cache-Control header of the response.
+//
+// If AllowOffline is true, the last key set downloaded is used if the key set
+// has expired and it cannot be reloaded. By default the tokens are rejected
+// until the key set can be downloaded again.
+type JWKSetOptions struct {
+	URL             string   `json:"url"`
+	RefreshInterval Duration `json:"refreshInterval,omitempty"`
+	AllowOffline    bool     `json:"allowOffline,omitempty"`
+}
+
+// validate validates the URL and the refresh interval of the key set.
+func (o *JWKSetOptions) validate() error {
+	u, err := url.Parse(o.URL)
+	switch {
+	case o.URL == "":
+		return errors.New("provisioner jwkSet url cannot be empty")
+	case err != nil:
+		return errors.Wrapf(err, "error parsing provisioner jwkSet url %q", o.URL)
+	case u.Scheme != "https" && u.Scheme != "http":
+		return errors.Errorf("provisioner jwkSet url %q must use the http or https scheme", o.URL)
+	case u.Host == "":
+		return errors.Errorf("provisioner jwkSet url %q must have a host", o.URL)
+	case u.User != nil || u.Fragment != "":
+		return errors.Errorf("provisioner jwkSet url %q cannot have a user or fragment", o.URL)
+	case o.RefreshInterval.Duration < 0:
+		return errors.New("provisioner jwkSet refreshInterval cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// newKeyStore downloads the key set and returns the keyStore that keeps it
+// updated.
+func (o *JWKSetOptions) newKeyStore() (*keyStore, error) {
+	opts := []keyStoreOption{withRefreshInterval(o.RefreshInterval.Duration)}
+	if !o.AllowOffline {
+		opts = append(opts, withoutStaleKeys())
+	}
+	ks, err := newKeyStore(o.URL, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error initializing provisioner jwkSet")
+	}
+	return ks, nil
+}
+
+// verifyWithKeySet verifies the token with the keys of the remote key set that
+// have the key id in the header of the token, and decodes its claims.
+func (p *JWK) verifyWithKeySet(ctx context.Context, jwt *jose.JSONWebToken, claims *jwtPayload) error {
+	var kid string
+	if len(jwt.Headers) > 0 {
+		kid = jwt.Headers[0].KeyID
+	}
+	if kid == "" {
+		return authorizeErr(ReasonUnknownKey, errs.Unauthorized("jwk.authorizeToken; jwk token key id (kid) cannot be empty"))
+	}
+	keys := p.keyStore.Get(ctx, kid)
+	for i := range keys {
+		if checkKeyAlgorithm(jwt, &keys[i]) != nil {
+			continue
+		}
+		if err := jwt.Claims(keys[i].Public(), claims); err == nil {
+			return nil
+		}
+	}
+	return authorizeErr(ReasonUnknownKey, errs.Unauthorized("jwk.authorizeToken; cannot validate jwk token with key id %q", kid))
+}
@@ -14,6 +14,8 @@ import (
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
@@ -53,7 +55,7 @@ func TestJWK_Init(t *testing.T) {
 		"fail-empty": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &JWK{},
-				err: errors.New("provisioner type cannot be empty"),
+				err: errors.New("provisioner configuration is not valid: provisioner type cannot be empty; provisioner name cannot be empty; provisioner key cannot be empty"),
 			}
 		},
 		"fail-empty-name": func(t *testing.T) ProvisionerValidateTest {
@@ -61,13 +63,13 @@ func TestJWK_Init(t *testing.T) {
 				p: &JWK{
 					Type: "JWK",
 				},
-				err: errors.New("provisioner name cannot be empty"),
+				err: errors.New("provisioner configuration is not valid: provisioner name cannot be empty; provisioner key cannot be empty"),
 			}
 		},
 		"fail-empty-type": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &JWK{Name: "foo"},
-				err: errors.New("provisioner type cannot be empty"),
+				err: errors.New("provisioner configuration is not valid: provisioner type cannot be empty; provisioner key cannot be empty"),
 			}
 		},
 		"fail-empty-key": func(t *testing.T) ProvisionerValidateTest {
@@ -82,11 +84,40 @@ func TestJWK_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail-bad-allowed-token-algorithms": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, AllowedTokenAlgorithms: []string{"none"}},
+				err: errors.New(`provisioner allowedTokenAlgorithms contains an unsupported algorithm "none"`),
+			}
+		},
+		"fail-bad-key-algorithm": func(t *testing.T) ProvisionerValidateTest {
+			jwk, err := generateJSONWebKeyWith("EC", "P-384", "ES384")
+			assert.FatalError(t, err)
+			jwk.Algorithm = "ES256"
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: jwk},
+				err: errors.New("provisioner key is not valid: alg 'ES256' is not compatible with kty 'EC' and crv 'P-384'"),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}},
 			}
 		},
+		"ok-p384": func(t *testing.T) ProvisionerValidateTest {
+			jwk, err := generateJSONWebKeyWith("EC", "P-384", "ES384")
+			assert.FatalError(t, err)
+			return ProvisionerValidateTest{
+				p: &JWK{Name: "foo", Type: "bar", Key: jwk},
+			}
+		},
+		"ok-ed25519": func(t *testing.T) ProvisionerValidateTest {
+			jwk, err := generateJSONWebKeyWith("OKP", "Ed25519", "EdDSA")
+			assert.FatalError(t, err)
+			return ProvisionerValidateTest{
+				p: &JWK{Name: "foo", Type: "bar", Key: jwk},
+			}
+		},
 	}
 
 	config := Config{
@@ -158,6 +189,12 @@ func TestJWK_authorizeToken(t *testing.T) {
 	// Remove encrypted key for p2
 	p2.EncryptedKey = ""
 
+	// Only allow EdDSA tokens
+	p3 := *p1
+	p3.AllowedTokenAlgorithms = []string{jose.EdDSA}
+	p4 := *p1
+	p4.AllowedTokenAlgorithms = []string{jose.EdDSA, jose.ES256}
+
 	type args struct {
 		token string
 	}
@@ -177,13 +214,15 @@ func TestJWK_authorizeToken(t *testing.T) {
 		{"fail-not-before", p1, args{failNbf}, http.StatusUnauthorized, errors.New("jwk.authorizeToken; invalid jwk claims: go-jose/go-jose/jwt: validation failed, token not valid yet (nbf)")},
 		{"fail-audience", p1, args{failAud}, http.StatusUnauthorized, errors.New("jwk.authorizeToken; invalid jwk token audience claim (aud)")},
 		{"fail-subject", p1, args{failSub}, http.StatusUnauthorized, errors.New("jwk.authorizeToken; jwk token subject cannot be empty")},
+		{"fail-algorithm", &p3, args{t1}, http.StatusUnauthorized, errors.New(`jwk.authorizeToken; invalid jwk token: token algorithm "ES256" is not allowed`)},
 		{"ok", p1, args{t1}, http.StatusOK, nil},
 		{"ok-no-encrypted-key", p2, args{t2}, http.StatusOK, nil},
 		{"ok-no-sans", p1, args{t3}, http.StatusOK, nil},
+		{"ok-algorithm", &p4, args{t1}, http.StatusOK, nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got, err := tt.prov.authorizeToken(tt.args.token, testAudiences.Sign); err != nil {
+			if got, err := tt.prov.authorizeToken(context.Background(), tt.args.token, testAudiences.Sign); err != nil {
 				if assert.NotNil(t, tt.err) {
 					var sc render.StatusCodedError
 					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
@@ -297,7 +336,7 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.NotNil(t, got) {
-					assert.Equals(t, 10, len(got))
+					assert.Equals(t, 15, len(got))
 					for _, o := range got {
 						switch v := o.(type) {
 						case *JWK:
@@ -321,6 +360,16 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 						case *x509NamePolicyValidator:
 							assert.Equals(t, nil, v.policyEngine)
 						case *WebhookController:
+						case X509SignerName:
+							assert.Equals(t, "", string(v))
+						case *uniqueSANOption:
+							assert.False(t, v.Enabled)
+						case *signatureAlgorithmOption:
+							assert.Len(t, 0, v.Allowed)
+						case DuplicateDNSNamesPolicy:
+							assert.Equals(t, "", string(v))
+						case X509SerialGenerator:
+							assert.Nil(t, v.SerialGenerator)
 						default:
 							assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 						}
@@ -331,6 +380,362 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 	}
 }
 
+func TestJWK_AuthorizeSign_keyTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		kty  string
+		crv  string
+		alg  string
+	}{
+		{"P-256", "EC", "P-256", "ES256"},
+		{"P-384", "EC", "P-384", "ES384"},
+		{"P-521", "EC", "P-521", "ES512"},
+		{"Ed25519", "OKP", "Ed25519", "EdDSA"},
+		{"RSA", "RSA", "", "RS256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWKWith(tt.kty, tt.crv, tt.alg)
+			assert.FatalError(t, err)
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+			// The encrypted key must decrypt to the private key of the
+			// provisioner key.
+			key, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.alg, key.Algorithm)
+			assert.Equals(t, p.Key.KeyID, key.KeyID)
+			assert.False(t, key.IsPublic())
+
+			tok, err := generateToken("subject", p.Name, testAudiences.Sign[0], "name@smallstep.com", []string{"test.smallstep.com"}, time.Now(), key)
+			assert.FatalError(t, err)
+			ctx := NewContextWithMethod(context.Background(), SignMethod)
+			got, err := p.AuthorizeSign(ctx, tok)
+			assert.FatalError(t, err)
+			assert.Equals(t, 15, len(got))
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_keyAlgorithmMismatch(t *testing.T) {
+	p, err := generateJWKWith("RSA", "", "RS256")
+	assert.FatalError(t, err)
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	// An RSA key can also sign PS256 tokens, but the provisioner only
+	// accepts the algorithm of its key.
+	key.Algorithm = "PS256"
+	tok, err := generateToken("subject", p.Name, testAudiences.Sign[0], "name@smallstep.com", []string{"test.smallstep.com"}, time.Now(), key)
+	assert.FatalError(t, err)
+
+	ctx := NewContextWithMethod(context.Background(), SignMethod)
+	_, err = p.AuthorizeSign(ctx, tok)
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+		assert.HasPrefix(t, err.Error(), `jwk.AuthorizeSign: jwk.authorizeToken; invalid jwk token: token algorithm "PS256" does not match the provisioner key algorithm "RS256"`)
+	}
+}
+
+func TestJWK_Init_additionalKeys(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	previous, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	previousPublic := previous.Public()
+	noKeyID := previous.Public()
+	noKeyID.KeyID = ""
+	badAlgorithm := previous.Public()
+	badAlgorithm.KeyID = "bad-algorithm"
+	badAlgorithm.Algorithm = "RS256"
+
+	tests := []struct {
+		name    string
+		keys    func(p *JWK) []*JWKKey
+		wantErr string
+	}{
+		{"ok", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: &previousPublic, EncryptedKey: "encrypted"}}
+		}, ""},
+		{"fail empty", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{}}
+		}, "provisioner additionalKeys cannot contain empty keys"},
+		{"fail key id", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: &noKeyID}}
+		}, "provisioner additionalKeys cannot contain keys without a key id"},
+		{"fail duplicated key", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: p.Key}}
+		}, "provisioner additionalKeys key id"},
+		{"fail duplicated additional key", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: &previousPublic}, {Key: &previousPublic}}
+		}, "provisioner additionalKeys key id"},
+		{"fail private key", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: previous}}
+		}, "provisioner additionalKeys key"},
+		{"fail algorithm", func(p *JWK) []*JWKKey {
+			return []*JWKKey{{Key: &badAlgorithm}}
+		}, "provisioner key is not valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.AdditionalKeys = tt.keys(p)
+			err = p.Init(config)
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_additionalKeys(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	current, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	// The previous key of the provisioner.
+	old, err := generateJWK()
+	assert.FatalError(t, err)
+	previous, err := decryptJSONWebKey(old.EncryptedKey)
+	assert.FatalError(t, err)
+	p.AdditionalKeys = []*JWKKey{{Key: old.Key, EncryptedKey: old.EncryptedKey}}
+	assert.FatalError(t, p.validateAdditionalKeys())
+
+	// A key that is not in the provisioner.
+	unknown, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	// The previous key with the key id of the current one.
+	mismatch := *previous
+	mismatch.KeyID = current.KeyID
+
+	tests := []struct {
+		name    string
+		key     *jose.JSONWebKey
+		wantErr bool
+	}{
+		{"ok current", current, false},
+		{"ok previous", previous, false},
+		{"fail unknown", unknown, true},
+		{"fail key id", &mismatch, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateToken("subject", p.Name, testAudiences.Sign[0], "name@smallstep.com", []string{"test.smallstep.com"}, time.Now(), tt.key)
+			assert.FatalError(t, err)
+			ctx := NewContextWithMethod(context.Background(), SignMethod)
+			if _, err := p.AuthorizeSign(ctx, tok); (err != nil) != tt.wantErr {
+				t.Errorf("JWK.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_replayProtection(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p1.ReplayProtection = true
+	p1.ctl.TokenCache = NewMemoryTokenCache(10)
+	key1, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+	p2.ctl.TokenCache = NewMemoryTokenCache(10)
+	key2, err := decryptJSONWebKey(p2.EncryptedKey)
+	assert.FatalError(t, err)
+
+	ctx := NewContextWithMethod(context.Background(), SignMethod)
+	t1, err := generateSimpleToken(p1.Name, testAudiences.Sign[0], key1)
+	assert.FatalError(t, err)
+
+	// A dry run does not mark the token as used.
+	_, err = p1.AuthorizeSign(NewContextWithDryRun(ctx), t1)
+	assert.FatalError(t, err)
+
+	_, err = p1.AuthorizeSign(ctx, t1)
+	assert.FatalError(t, err)
+	_, err = p1.AuthorizeSign(ctx, t1)
+	var ae *AuthorizeError
+	if assert.Error(t, err) && assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, ReasonTokenReused, ae.Reason)
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc))
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+
+	// A new token is allowed.
+	t2, err := generateSimpleToken(p1.Name, testAudiences.Sign[0], key1)
+	assert.FatalError(t, err)
+	_, err = p1.AuthorizeSign(ctx, t2)
+	assert.FatalError(t, err)
+
+	// Tokens can be reused if replay protection is disabled.
+	t3, err := generateSimpleToken(p2.Name, testAudiences.Sign[0], key2)
+	assert.FatalError(t, err)
+	_, err = p2.AuthorizeSign(ctx, t3)
+	assert.FatalError(t, err)
+	_, err = p2.AuthorizeSign(ctx, t3)
+	assert.FatalError(t, err)
+
+	// Init configures an in-memory cache by default.
+	p3, err := generateJWK()
+	assert.FatalError(t, err)
+	p3.ReplayProtection = true
+	assert.FatalError(t, p3.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.NotNil(t, p3.ctl.TokenCache)
+}
+
+func TestJWK_AuthorizeSign_allowedCIDRs(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	newJWK := func(allowed, proxies []string) (*JWK, *jose.JSONWebKey) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.AllowedCIDRs = allowed
+		p.TrustedProxies = proxies
+		assert.FatalError(t, p.Init(config))
+		key, err := decryptJSONWebKey(p.EncryptedKey)
+		assert.FatalError(t, err)
+		return p, key
+	}
+	newContext := func(remoteAddr string, forwardedFor ...string) context.Context {
+		ctx := NewContextWithMethod(context.Background(), SignMethod)
+		return NewContextWithClientAddr(ctx, &ClientAddr{
+			RemoteAddr:   remoteAddr,
+			ForwardedFor: forwardedFor,
+		})
+	}
+
+	none, noneKey := newJWK(nil, nil)
+	allowed, allowedKey := newJWK([]string{"10.1.0.0/16", "2001:db8::/32"}, nil)
+	proxied, proxiedKey := newJWK([]string{"10.1.0.0/16"}, []string{"192.168.0.0/24"})
+
+	tests := []struct {
+		name    string
+		p       *JWK
+		key     *jose.JSONWebKey
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"ok no cidrs", none, noneKey, newContext("203.0.113.1:443"), false},
+		{"ok no cidrs without address", none, noneKey, context.Background(), false},
+		{"ok allowed", allowed, allowedKey, newContext("10.1.2.3:443"), false},
+		{"ok allowed ipv6", allowed, allowedKey, newContext("[2001:db8::1]:443"), false},
+		{"ok proxied", proxied, proxiedKey, newContext("192.168.0.1:443", "10.1.2.3"), false},
+		{"ok proxied chain", proxied, proxiedKey, newContext("192.168.0.1:443", "203.0.113.1, 10.1.2.3", "192.168.0.2"), false},
+		{"fail not allowed", allowed, allowedKey, newContext("10.2.0.1:443"), true},
+		{"fail without address", allowed, allowedKey, NewContextWithMethod(context.Background(), SignMethod), true},
+		{"fail forwarded without trusted proxies", allowed, allowedKey, newContext("203.0.113.1:443", "10.1.2.3"), true},
+		{"fail forwarded from untrusted proxy", proxied, proxiedKey, newContext("203.0.113.1:443", "10.1.2.3"), true},
+		{"fail proxied not allowed", proxied, proxiedKey, newContext("192.168.0.1:443", "10.1.2.3, 203.0.113.1"), true},
+		{"fail proxied invalid address", proxied, proxiedKey, newContext("192.168.0.1:443", "foo"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateSimpleToken(tt.p.Name, testAudiences.Sign[0], tt.key)
+			assert.FatalError(t, err)
+			_, err = tt.p.AuthorizeSign(tt.ctx, tok)
+			if !tt.wantErr {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *AuthorizeError
+			if assert.Error(t, err) && assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, ReasonAddressNotAllowed, ae.Reason)
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc))
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+			}
+		})
+	}
+}
+
+func TestJWK_Init_allowedCIDRs(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		allowed []string
+		proxies []string
+		wantErr bool
+	}{
+		{"ok", []string{"10.0.0.0/8", "2001:db8::/32"}, nil, false},
+		{"ok trusted proxies", []string{"10.0.0.0/8"}, []string{"192.168.0.1/32"}, false},
+		{"fail allowed", []string{"10.0.0.1"}, nil, true},
+		{"fail trusted proxies", []string{"10.0.0.0/8"}, []string{"foo"}, true},
+		{"fail trusted proxies without allowed", nil, []string{"192.168.0.1/32"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.AllowedCIDRs = tt.allowed
+			p.TrustedProxies = tt.proxies
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("JWK.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_allowedExtKeyUsages(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		allowed []string
+		want    []x509.ExtKeyUsage
+	}{
+		{"ok default", nil, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}},
+		{"ok client", []string{"clientAuth"}, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}},
+		{"ok code signing", []string{"codeSigning"}, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.Options = &Options{X509: &X509Options{AllowedExtKeyUsages: tt.allowed}}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+			key, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			tok, err := generateToken("test.smallstep.com", p.Name, testAudiences.Sign[0], "", []string{"test.smallstep.com"}, time.Now(), key)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+
+			var certOpts []x509util.Option
+			var modifiers []CertificateModifier
+			for _, o := range opts {
+				switch v := o.(type) {
+				case CertificateOptions:
+					certOpts = append(certOpts, v.Options(SignOptions{})...)
+				case CertificateModifier:
+					modifiers = append(modifiers, v)
+				}
+			}
+			c, err := x509util.NewCertificate(csr, certOpts...)
+			assert.FatalError(t, err)
+			cert := c.GetCertificate()
+			for _, m := range modifiers {
+				assert.FatalError(t, m.Modify(cert, SignOptions{}))
+			}
+			assert.Equals(t, tt.want, cert.ExtKeyUsage)
+		})
+	}
+}
+
 func TestJWK_AuthorizeRenew(t *testing.T) {
 	now := time.Now().Truncate(time.Second)
 	p1, err := generateJWK()
@@ -0,0 +1,408 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// k8sCSRRequestTimeout is the timeout used to get a CertificateSigningRequest
+// from the API server.
+const k8sCSRRequestTimeout = 10 * time.Second
+
+// k8sCSRMaxResponseSize is the maximum size of a CertificateSigningRequest
+// returned by the API server.
+const k8sCSRMaxResponseSize = 256 * 1024
+
+// k8sCSRPath is the path of the CertificateSigningRequest API in the Kubernetes
+// API server.
+const k8sCSRPath = "/apis/certificates.k8s.io/v1/certificatesigningrequests/"
+
+// k8sCSRUsedDuration is the time a CertificateSigningRequest is kept as used.
+// Kubernetes garbage collects all CertificateSigningRequests after 24 hours.
+const k8sCSRUsedDuration = 24 * time.Hour
+
+// k8sNameRegexp matches the names of the Kubernetes objects, a DNS subdomain.
+var k8sNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// k8sCSRExtKeyUsages maps the usages of a Kubernetes CertificateSigningRequest
+// to extended key usages. The other usages are key usages set by the template.
+var k8sCSRExtKeyUsages = map[string]x509.ExtKeyUsage{
+	"server auth":      x509.ExtKeyUsageServerAuth,
+	"client auth":      x509.ExtKeyUsageClientAuth,
+	"code signing":     x509.ExtKeyUsageCodeSigning,
+	"email protection": x509.ExtKeyUsageEmailProtection,
+	"s/mime":           x509.ExtKeyUsageEmailProtection,
+	"timestamping":     x509.ExtKeyUsageTimeStamping,
+	"ocsp signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// K8sCSR is a provisioner that issues X.509 certificates for the Kubernetes
+// CertificateSigningRequests approved in a cluster, so the native approval
+// workflow of Kubernetes can be used to get certificates from the CA. The
+// client sends the name of the CertificateSigningRequest object with the
+// certificate request, and the provisioner gets the object from the API
+// server and checks that it is approved, that it is not denied or failed,
+// that it uses the SignerName of the provisioner, and that its request is the
+// same certificate request sent by the client. Each CertificateSigningRequest
+// can only be used once: the ones that already have a certificate are
+// rejected, and the used ones are kept in the TokenCache of the provisioner
+// config. Deployments with more than one CA instance must configure a shared
+// TokenCache.
+//
+// APIServerURL is the URL of the Kubernetes API server. The server certificate
+// is validated with CABundle, or with the system roots if empty. Token or
+// TokenFile are the credentials of the provisioner, that requires permissions
+// to get CertificateSigningRequests. The token file is read on each request, so
+// projected tokens rotated by the kubelet can be used.
+//
+// The certificates get the extended key usages and, if set, the expiration of
+// the CertificateSigningRequest, within the limits of the provisioner claims.
+type K8sCSR struct {
+	*base
+	ID           string   `json:"-"`
+	Type         string   `json:"type"`
+	Name         string   `json:"name"`
+	APIServerURL string   `json:"apiServerURL"`
+	CABundle     []byte   `json:"caBundle,omitempty"`
+	Token        string   `json:"token,omitempty"`
+	TokenFile    string   `json:"tokenFile,omitempty"`
+	SignerName   string   `json:"signerName"`
+	Claims       *Claims  `json:"claims,omitempty"`
+	Options      *Options `json:"options,omitempty"`
+	client       *http.Client
+	ctl          *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *K8sCSR) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *K8sCSR) GetIDForToken() string {
+	return "k8scsr/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *K8sCSR) GetTokenID(string) (string, error) {
+	return "", errors.New("k8sCSR provisioner does not implement GetTokenID")
+}
+
+// GetName returns the name of the provisioner.
+func (p *K8sCSR) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *K8sCSR) GetType() Type {
+	return TypeK8sCSR
+}
+
+// GetClaimer returns the claimer of the provisioner.
+func (p *K8sCSR) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *K8sCSR) GetController() *Controller {
+	return p.ctl
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *K8sCSR) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// Init initializes and validates the fields of a K8sCSR type.
+func (p *K8sCSR) Init(config Config) (err error) {
+	u, err := url.Parse(p.APIServerURL)
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.APIServerURL == "":
+		return errors.New("provisioner apiServerURL cannot be empty")
+	case err != nil:
+		return errors.Wrap(err, "error parsing provisioner apiServerURL")
+	case u.Scheme != "https" || u.Host == "":
+		return errors.Errorf("provisioner apiServerURL %q is not a valid https url", p.APIServerURL)
+	case p.Token == "" && p.TokenFile == "":
+		return errors.New("provisioner token or tokenFile cannot be empty")
+	case p.Token != "" && p.TokenFile != "":
+		return errors.New("provisioner token and tokenFile cannot be used together")
+	case p.SignerName == "":
+		return errors.New("provisioner signerName cannot be empty")
+	}
+	if err := validateK8sSignerName(p.SignerName); err != nil {
+		return err
+	}
+	if len(p.CABundle) > 0 {
+		if ok := x509.NewCertPool().AppendCertsFromPEM(p.CABundle); !ok {
+			return errors.New("provisioner caBundle does not contain any valid certificate")
+		}
+	}
+	p.client = newK8sAPIServerClient(p.CABundle)
+
+	if config.TokenCache == nil {
+		config.TokenCache = NewMemoryTokenCache(DefaultTokenCacheSize)
+	}
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// validateK8sSignerName returns an error if the given name is not a valid
+// Kubernetes signer name, e.g. "ca.example.com/issuer".
+func validateK8sSignerName(name string) error {
+	i := strings.Index(name, "/")
+	if i <= 0 || i == len(name)-1 || !k8sNameRegexp.MatchString(name[:i]) {
+		return errors.Errorf("provisioner signerName %q is not valid", name)
+	}
+	return nil
+}
+
+// bearerToken returns the credentials of the provisioner.
+func (p *K8sCSR) bearerToken() (string, error) {
+	if p.TokenFile == "" {
+		return p.Token, nil
+	}
+	b, err := os.ReadFile(p.TokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading provisioner tokenFile")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+type k8sCertificateSigningRequest struct {
+	Metadata struct {
+		Name string `json:"name"`
+		UID  string `json:"uid,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		Request           []byte   `json:"request"`
+		SignerName        string   `json:"signerName"`
+		ExpirationSeconds int64    `json:"expirationSeconds,omitempty"`
+		Usages            []string `json:"usages,omitempty"`
+		Username          string   `json:"username,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Conditions  []k8sCertificateSigningRequestCondition `json:"conditions,omitempty"`
+		Certificate []byte                                  `json:"certificate,omitempty"`
+	} `json:"status"`
+}
+
+type k8sCertificateSigningRequestCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status,omitempty"`
+}
+
+// isApproved returns true if the CertificateSigningRequest has been approved
+// and it has not been denied or failed. Conditions without a status are true.
+func (csr *k8sCertificateSigningRequest) isApproved() bool {
+	var approved bool
+	for _, c := range csr.Status.Conditions {
+		if c.Status != "" && c.Status != "True" {
+			continue
+		}
+		switch c.Type {
+		case "Approved":
+			approved = true
+		case "Denied", "Failed":
+			return false
+		}
+	}
+	return approved
+}
+
+// getCSR returns the CertificateSigningRequest with the given name from the
+// API server.
+func (p *K8sCSR) getCSR(ctx context.Context, name string) (*k8sCertificateSigningRequest, error) {
+	bearer, err := p.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, k8sCSRRequestTimeout)
+	defer cancel()
+	u := strings.TrimSuffix(p.APIServerURL, "/") + k8sCSRPath + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate signing request request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting certificate signing request")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, k8sCSRMaxResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading certificate signing request response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("certificate signing request %q returned non-successful status code %d", name, resp.StatusCode)
+	}
+
+	var csr k8sCertificateSigningRequest
+	if err := json.Unmarshal(b, &csr); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate signing request response")
+	}
+	if csr.Metadata.Name != name {
+		return nil, errors.Errorf("certificate signing request %q returned the object %q", name, csr.Metadata.Name)
+	}
+	return &csr, nil
+}
+
+// useCSR rejects the reuse of a CertificateSigningRequest. The objects are
+// identified by their UID, so a new object with the same name can be used.
+func (p *K8sCSR) useCSR(ctx context.Context, kcsr *k8sCertificateSigningRequest) error {
+	key := tokenReplayKey(p.GetIDForToken(), "", kcsr.Metadata.UID, kcsr.Metadata.Name)
+	return p.ctl.useToken(ctx, key, time.Now().Add(k8sCSRUsedDuration))
+}
+
+// AuthorizeSign gets the Kubernetes CertificateSigningRequest named in the
+// token from the API server, and if it's approved, returns the list of
+// SignOption for a Sign request. The certificate request must be the one in
+// the CertificateSigningRequest.
+func (p *K8sCSR) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if len(token) > 253 || !k8sNameRegexp.MatchString(token) {
+		return nil, authorizeErr(ReasonMalformedToken, errs.Unauthorized("k8scsr.AuthorizeSign; certificate signing request name %q is not valid", token))
+	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8scsr.AuthorizeSign")
+	}
+	kcsr, err := p.getCSR(ctx, token)
+	if err != nil {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Wrap(http.StatusUnauthorized, err,
+			"k8scsr.AuthorizeSign; error getting the certificate signing request from the API server"))
+	}
+	switch {
+	case kcsr.Spec.SignerName != p.SignerName:
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("k8scsr.AuthorizeSign; certificate signing request %q signer %q is not allowed", token, kcsr.Spec.SignerName))
+	case !kcsr.isApproved():
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("k8scsr.AuthorizeSign; certificate signing request %q is not approved", token))
+	case len(kcsr.Status.Certificate) > 0:
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("k8scsr.AuthorizeSign; certificate signing request %q has already been signed", token))
+	}
+	block, _ := pem.Decode(kcsr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("k8scsr.AuthorizeSign; certificate signing request %q does not contain a PEM encoded request", token))
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Wrap(http.StatusUnauthorized, err,
+			"k8scsr.AuthorizeSign; error parsing certificate signing request %q", token))
+	}
+
+	subject := kcsr.Spec.Username
+	if subject == "" {
+		subject = token
+	}
+	if err := p.ctl.allowRequest(ctx, subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8scsr.AuthorizeSign")
+	}
+	if err := p.useCSR(ctx, kcsr); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8scsr.AuthorizeSign")
+	}
+
+	// The certificate gets the extended key usages and the expiration
+	// requested in the CertificateSigningRequest.
+	var ekus []x509.ExtKeyUsage
+	for _, u := range kcsr.Spec.Usages {
+		if eku, ok := k8sCSRExtKeyUsages[u]; ok {
+			ekus = append(ekus, eku)
+		}
+	}
+	claimer := p.ctl.Claimer
+	duration := claimer.DefaultTLSCertDuration()
+	if kcsr.Spec.ExpirationSeconds > 0 {
+		duration = time.Duration(kcsr.Spec.ExpirationSeconds) * time.Second
+		if d := claimer.MinTLSCertDuration(); duration < d {
+			duration = d
+		}
+		if d := claimer.MaxTLSCertDuration(); duration > d {
+			duration = d
+		}
+	}
+
+	var so []SignOption
+	if len(ekus) > 0 {
+		so = append(so, extKeyUsageModifier(ekus))
+	}
+	so = append(so, p.ctl.newX509SignOptions()...)
+
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, k8sCSRSANs(csr))
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8scsr.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeK8sCSR, p.Name, "").WithControllerOptions(p.ctl),
+		profileDefaultDuration(duration),
+		// validators
+		k8sCSRValidator{csr: csr},
+		defaultPublicKeyValidator{},
+		p.ctl.newValidityValidator(),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *K8sCSR) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// k8sCSRSANs returns the subject alternative names of the given certificate
+// request.
+func k8sCSRSANs(csr *x509.CertificateRequest) []string {
+	sans := append([]string(nil), csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// k8sCSRValidator is a CertificateRequestValidator that checks that the
+// certificate request is the one approved in Kubernetes.
+type k8sCSRValidator struct {
+	csr *x509.CertificateRequest
+}
+
+// Valid implements CertificateRequestValidator.
+func (v k8sCSRValidator) Valid(req *x509.CertificateRequest) error {
+	if !bytes.Equal(req.Raw, v.csr.Raw) {
+		return errs.Forbidden("certificate request does not match the approved certificate signing request")
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func mustK8sCSR(t *testing.T, commonName string, dnsNames ...string) (*x509.CertificateRequest, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestK8sCSR_Init(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	newProvisioner := func(fn func(p *K8sCSR)) *K8sCSR {
+		p := &K8sCSR{
+			Type:         "K8sCSR",
+			Name:         "kubernetes",
+			APIServerURL: srv.URL,
+			CABundle:     caBundle,
+			Token:        "provisioner-token",
+			SignerName:   "ca.example.com/issuer",
+		}
+		if fn != nil {
+			fn(p)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		p       *K8sCSR
+		wantErr bool
+	}{
+		{"ok", newProvisioner(nil), false},
+		{"ok token file", newProvisioner(func(p *K8sCSR) { p.Token, p.TokenFile = "", "/var/run/secrets/kubernetes.io/serviceaccount/token" }), false},
+		{"ok system roots", newProvisioner(func(p *K8sCSR) { p.CABundle = nil }), false},
+		{"ok signer path", newProvisioner(func(p *K8sCSR) { p.SignerName = "ca.example.com/issuers/web" }), false},
+		{"fail type", newProvisioner(func(p *K8sCSR) { p.Type = "" }), true},
+		{"fail name", newProvisioner(func(p *K8sCSR) { p.Name = "" }), true},
+		{"fail apiServerURL empty", newProvisioner(func(p *K8sCSR) { p.APIServerURL = "" }), true},
+		{"fail apiServerURL parse", newProvisioner(func(p *K8sCSR) { p.APIServerURL = "https://ca.example.com:port" }), true},
+		{"fail apiServerURL http", newProvisioner(func(p *K8sCSR) { p.APIServerURL = "http://kubernetes.default.svc" }), true},
+		{"fail no credentials", newProvisioner(func(p *K8sCSR) { p.Token = "" }), true},
+		{"fail both credentials", newProvisioner(func(p *K8sCSR) { p.TokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" }), true},
+		{"fail signerName empty", newProvisioner(func(p *K8sCSR) { p.SignerName = "" }), true},
+		{"fail signerName without path", newProvisioner(func(p *K8sCSR) { p.SignerName = "ca.example.com" }), true},
+		{"fail signerName empty path", newProvisioner(func(p *K8sCSR) { p.SignerName = "ca.example.com/" }), true},
+		{"fail signerName domain", newProvisioner(func(p *K8sCSR) { p.SignerName = "CA_Example/issuer" }), true},
+		{"fail caBundle", newProvisioner(func(p *K8sCSR) { p.CABundle = []byte("not a certificate") }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("K8sCSR.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_k8sCertificateSigningRequest_isApproved(t *testing.T) {
+	cond := func(typ, status string) k8sCertificateSigningRequestCondition {
+		return k8sCertificateSigningRequestCondition{Type: typ, Status: status}
+	}
+	tests := []struct {
+		name       string
+		conditions []k8sCertificateSigningRequestCondition
+		want       bool
+	}{
+		{"ok approved", []k8sCertificateSigningRequestCondition{cond("Approved", "True")}, true},
+		{"ok approved without status", []k8sCertificateSigningRequestCondition{cond("Approved", "")}, true},
+		{"ok issued", []k8sCertificateSigningRequestCondition{cond("Approved", "True"), cond("Failed", "False")}, true},
+		{"fail pending", nil, false},
+		{"fail approved false", []k8sCertificateSigningRequestCondition{cond("Approved", "False")}, false},
+		{"fail denied", []k8sCertificateSigningRequestCondition{cond("Denied", "True")}, false},
+		{"fail approved and failed", []k8sCertificateSigningRequestCondition{cond("Approved", "True"), cond("Failed", "True")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr := new(k8sCertificateSigningRequest)
+			csr.Status.Conditions = tt.conditions
+			assert.Equals(t, tt.want, csr.isApproved())
+		})
+	}
+}
+
+func TestK8sCSR_AuthorizeSign(t *testing.T) {
+	csr, csrPEM := mustK8sCSR(t, "web-1.example.com", "web-1.example.com", "web-1")
+	other, _ := mustK8sCSR(t, "web-1.example.com", "web-1.example.com", "web-1")
+
+	newCSR := func(name, signerName string, conditions ...string) *k8sCertificateSigningRequest {
+		kcsr := new(k8sCertificateSigningRequest)
+		kcsr.Metadata.Name = name
+		kcsr.Metadata.UID = "uid-" + name
+		kcsr.Spec.Request = csrPEM
+		kcsr.Spec.SignerName = signerName
+		kcsr.Spec.Usages = []string{"digital signature", "server auth"}
+		kcsr.Spec.ExpirationSeconds = 3600
+		kcsr.Spec.Username = "system:serviceaccount:default:web"
+		for _, c := range conditions {
+			kcsr.Status.Conditions = append(kcsr.Status.Conditions, k8sCertificateSigningRequestCondition{Type: c, Status: "True"})
+		}
+		return kcsr
+	}
+	badRequest := newCSR("bad-request", "ca.example.com/issuer", "Approved")
+	badRequest.Spec.Request = []byte("not a certificate request")
+	signed := newCSR("signed", "ca.example.com/issuer", "Approved")
+	signed.Status.Certificate = []byte("-----BEGIN CERTIFICATE-----")
+	objects := map[string]*k8sCertificateSigningRequest{
+		"approved":     newCSR("approved", "ca.example.com/issuer", "Approved"),
+		"dry-run":      newCSR("dry-run", "ca.example.com/issuer", "Approved"),
+		"signed":       signed,
+		"pending":      newCSR("pending", "ca.example.com/issuer"),
+		"denied":       newCSR("denied", "ca.example.com/issuer", "Denied"),
+		"failed":       newCSR("failed", "ca.example.com/issuer", "Approved", "Failed"),
+		"other-signer": newCSR("other-signer", "kubernetes.io/kube-apiserver-client", "Approved"),
+		"bad-request":  badRequest,
+		"renamed":      newCSR("approved", "ca.example.com/issuer", "Approved"),
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer provisioner-token":
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, k8sCSRPath):
+			http.NotFound(w, r)
+			return
+		}
+		kcsr, ok := objects[strings.TrimPrefix(r.URL.Path, k8sCSRPath)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(kcsr)
+	}))
+	defer srv.Close()
+
+	p := &K8sCSR{
+		Type:         "K8sCSR",
+		Name:         "kubernetes",
+		APIServerURL: srv.URL,
+		CABundle:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+		Token:        "provisioner-token",
+		SignerName:   "ca.example.com/issuer",
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	t.Run("ok", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), "approved")
+		assert.FatalError(t, err)
+
+		var validated bool
+		for _, o := range opts {
+			switch v := o.(type) {
+			case k8sCSRValidator:
+				assert.NoError(t, v.Valid(csr))
+				assertStatusCode(t, http.StatusForbidden, v.Valid(other))
+				validated = true
+			case extKeyUsageModifier:
+				assert.Equals(t, extKeyUsageModifier{x509.ExtKeyUsageServerAuth}, v)
+			case profileDefaultDuration:
+				assert.Equals(t, time.Hour, time.Duration(v))
+			}
+		}
+		assert.True(t, validated)
+
+		// An approval can only be used once.
+		_, err = p.AuthorizeSign(context.Background(), "approved")
+		assertStatusCode(t, http.StatusUnauthorized, err)
+	})
+
+	t.Run("ok dry run", func(t *testing.T) {
+		ctx := NewContextWithDryRun(context.Background())
+		_, err := p.AuthorizeSign(ctx, "dry-run")
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), "dry-run")
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), "dry-run")
+		assertStatusCode(t, http.StatusUnauthorized, err)
+	})
+
+	tests := []struct {
+		name string
+		csr  string
+		code int
+	}{
+		{"fail name", "Approved/../../namespaces", http.StatusUnauthorized},
+		{"fail not found", "missing", http.StatusUnauthorized},
+		{"fail pending", "pending", http.StatusUnauthorized},
+		{"fail denied", "denied", http.StatusUnauthorized},
+		{"fail failed", "failed", http.StatusUnauthorized},
+		{"fail signer", "other-signer", http.StatusUnauthorized},
+		{"fail request", "bad-request", http.StatusUnauthorized},
+		{"fail renamed", "renamed", http.StatusUnauthorized},
+		{"fail signed", "signed", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.AuthorizeSign(context.Background(), tt.csr)
+			assertStatusCode(t, tt.code, err)
+		})
+	}
+
+	// Bad provisioner credentials.
+	p.Token = "bad-token"
+	_, err := p.AuthorizeSign(context.Background(), "approved")
+	if assert.Error(t, err) {
+		assert.HasPrefix(t, err.Error(), "k8scsr.AuthorizeSign; error getting the certificate signing request from the API server")
+	}
+}
@@ -45,15 +45,19 @@ type k8sSAPayload struct {
 // entity trusted to make signature requests.
 type K8sSA struct {
 	*base
-	ID      string   `json:"-"`
-	Type    string   `json:"type"`
-	Name    string   `json:"name"`
-	PubKeys []byte   `json:"publicKeys,omitempty"`
-	Claims  *Claims  `json:"claims,omitempty"`
-	Options *Options `json:"options,omitempty"`
-	//kauthn    kauthn.AuthenticationV1Interface
-	pubKeys []interface{}
-	ctl     *Controller
+	ID                     string   `json:"-"`
+	Type                   string   `json:"type"`
+	Name                   string   `json:"name"`
+	PubKeys                []byte   `json:"publicKeys,omitempty"`
+	AllowedTokenAlgorithms []string `json:"allowedTokenAlgorithms,omitempty"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	// TokenReview enables the validation of tokens using the TokenReview API
+	// of the Kubernetes API server. If it is not set the public keys are used.
+	TokenReview       *K8sSATokenReview `json:"tokenReview,omitempty"`
+	pubKeys           []interface{}
+	tokenReviewClient *http.Client
+	ctl               *Controller
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -86,6 +90,16 @@ func (p *K8sSA) GetType() Type {
 	return TypeK8sSA
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *K8sSA) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *K8sSA) GetController() *Controller {
+	return p.ctl
+}
+
 // GetEncryptedKey returns false, because the kubernetes provisioner does not
 // have access to the private key.
 func (p *K8sSA) GetEncryptedKey() (string, string, bool) {
@@ -100,8 +114,20 @@ func (p *K8sSA) Init(config Config) (err error) {
 	case p.Name == "":
 		return errors.New("provisioner name cannot be empty")
 	}
+	if err := validateTokenAlgorithms(p.AllowedTokenAlgorithms); err != nil {
+		return err
+	}
 
-	if p.PubKeys != nil {
+	switch {
+	case p.TokenReview != nil:
+		if p.PubKeys != nil {
+			return errors.Errorf("K8s Service Account provisioner '%s' cannot use pub keys and tokenReview together", p.GetName())
+		}
+		if err := p.TokenReview.Validate(); err != nil {
+			return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+		}
+		p.tokenReviewClient = p.TokenReview.newClient()
+	case p.PubKeys != nil:
 		var (
 			block *pem.Block
 			rest  = p.PubKeys
@@ -122,23 +148,9 @@ func (p *K8sSA) Init(config Config) (err error) {
 			}
 			p.pubKeys = append(p.pubKeys, key)
 		}
-	} else {
-		// TODO: Use the TokenReview API if no pub keys provided. This will need to
-		// be configured with additional attributes in the K8sSA struct for
-		// connecting to the kubernetes API server.
-		return errors.New("K8s Service Account provisioner cannot be initialized without pub keys")
+	default:
+		return errors.New("K8s Service Account provisioner cannot be initialized without pub keys or tokenReview")
 	}
-	/*
-		// NOTE: Not sure if we should be doing this initialization here ...
-		// If you have a k8sSA provisioner defined in your config, but you're not
-		// in a kubernetes pod then your CA will fail to startup. Maybe we just postpone
-		// creating the authn until token validation time?
-		if err := checkAccess(k8s.AuthorizationV1()); err != nil {
-			return errors.Wrapf(err, "error verifying access to kubernetes authz service for provisioner %s", p.GetID())
-		}
-
-		p.kauthn = k8s.AuthenticationV1()
-	*/
 
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
@@ -147,12 +159,26 @@ func (p *K8sSA) Init(config Config) (err error) {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload, error) {
+func (p *K8sSA) authorizeToken(ctx context.Context, token string, audiences []string) (*k8sSAPayload, error) {
 	_ = audiences // unused input
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err,
-			"k8ssa.authorizeToken; error parsing k8sSA token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err,
+			"k8ssa.authorizeToken; error parsing k8sSA token"))
+	}
+	if err := checkTokenAlgorithm(jwt, p.AllowedTokenAlgorithms); err != nil {
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err,
+			"k8ssa.authorizeToken; invalid k8sSA token"))
+	}
+
+	// Bound service account tokens are validated by the API server.
+	if p.TokenReview != nil {
+		claims, err := p.reviewToken(ctx, token)
+		if err != nil {
+			return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err,
+				"k8ssa.authorizeToken; error validating k8sSA token with the TokenReview API"))
+		}
+		return claims, nil
 	}
 
 	var (
@@ -160,26 +186,7 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 		claims k8sSAPayload
 	)
 	if p.pubKeys == nil {
-		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA TokenReview API integration not implemented")
-		/* NOTE: We plan to support the TokenReview API in a future release.
-		         Below is some code that should be useful when we prioritize
-				 this integration.
-
-			tr := kauthnApi.TokenReview{Spec: kauthnApi.TokenReviewSpec{Token: string(token)}}
-			rvw, err := p.kauthn.TokenReviews().Create(&tr)
-			if err != nil {
-				return nil, errors.Wrap(err, "error using kubernetes TokenReview API")
-			}
-			if rvw.Status.Error != "" {
-				return nil, errors.Errorf("error from kubernetes TokenReviewAPI: %s", rvw.Status.Error)
-			}
-			if !rvw.Status.Authenticated {
-				return nil, errors.New("error from kubernetes TokenReviewAPI: token could not be authenticated")
-			}
-			if err = jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
-				return nil, errors.Wrap(err, "error parsing claims")
-			}
-		*/
+		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA provisioner does not have pub keys or tokenReview")
 	}
 	for _, pk := range p.pubKeys {
 		if err = jwt.Claims(pk, &claims); err == nil {
@@ -188,7 +195,7 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 		}
 	}
 	if !valid {
-		return nil, errs.Unauthorized("k8ssa.authorizeToken; error validating k8sSA token and extracting claims")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Unauthorized("k8ssa.authorizeToken; error validating k8sSA token and extracting claims"))
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
@@ -196,11 +203,11 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 	if err = claims.Validate(jose.Expected{
 		Issuer: k8sSAIssuer,
 	}); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; invalid k8sSA token claims")
+		return nil, authorizeErr(validationReason(err), errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; invalid k8sSA token claims"))
 	}
 
 	if claims.Subject == "" {
-		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA token subject cannot be empty")
+		return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("k8ssa.authorizeToken; k8sSA token subject cannot be empty"))
 	}
 
 	return &claims, nil
@@ -208,17 +215,31 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
-func (p *K8sSA) AuthorizeRevoke(_ context.Context, token string) error {
-	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+func (p *K8sSA) AuthorizeRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
 	return errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeRevoke")
 }
 
 // AuthorizeSign validates the given token.
-func (p *K8sSA) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
 	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
+	}
+
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "k8ssa.AuthorizeSign")
+	}
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
 
 	// Add some values to use in custom templates.
 	data := x509util.NewTemplateData()
@@ -234,7 +255,7 @@ func (p *K8sSA) AuthorizeSign(_ context.Context, token string) ([]SignOption, er
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
 	}
 
-	return []SignOption{
+	return append(so,
 		p,
 		templateOptions,
 		// modifiers / withOptions
@@ -242,10 +263,10 @@ func (p *K8sSA) AuthorizeSign(_ context.Context, token string) ([]SignOption, er
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
-	}, nil
+	), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -254,11 +275,11 @@ func (p *K8sSA) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 }
 
 // AuthorizeSSHSign validates an request for an SSH certificate.
-func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("k8ssa.AuthorizeSSHSign; sshCA is disabled for k8sSA provisioner '%s'", p.GetName())
 	}
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHSign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSSHSign")
 	}
@@ -276,6 +297,9 @@ func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	}
 	signOptions := []SignOption{templateOptions}
 
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Require type, key-id and principals in the SignSSHOptions.
@@ -289,32 +313,8 @@ func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser(), p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
 }
-
-/*
-func checkAccess(authz kauthz.AuthorizationV1Interface) error {
-	r := &kauthzApi.SelfSubjectAccessReview{
-		Spec: kauthzApi.SelfSubjectAccessReviewSpec{
-			ResourceAttributes: &kauthzApi.ResourceAttributes{
-				Group:    "authentication.k8s.io",
-				Version:  "v1",
-				Resource: "tokenreviews",
-				Verb:     "create",
-			},
-		},
-	}
-	rvw, err := authz.SelfSubjectAccessReviews().Create(r)
-	if err != nil {
-		return err
-	}
-	if !rvw.Status.Allowed {
-		return fmt.Errorf("Unable to create kubernetes token reviews: %s", rvw.Status.Reason)
-	}
-
-	return nil
-}
-*/
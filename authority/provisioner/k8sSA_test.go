@@ -3,9 +3,13 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 
@@ -53,7 +57,7 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 				err:   errors.New("k8ssa.authorizeToken; error parsing k8sSA token"),
 			}
 		},
-		"fail/not-implemented": func(t *testing.T) test {
+		"fail/no-keys": func(t *testing.T) test {
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			assert.FatalError(t, err)
 			p, err := generateK8sSA(nil)
@@ -65,7 +69,7 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 			return test{
 				p:     p,
 				token: tok,
-				err:   errors.New("k8ssa.authorizeToken; k8sSA TokenReview API integration not implemented"),
+				err:   errors.New("k8ssa.authorizeToken; k8sSA provisioner does not have pub keys or tokenReview"),
 				code:  http.StatusUnauthorized,
 			}
 		},
@@ -116,7 +120,7 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if claims, err := tc.p.authorizeToken(tc.token, testAudiences.Sign); err != nil {
+			if claims, err := tc.p.authorizeToken(context.Background(), tc.token, testAudiences.Sign); err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
 					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
@@ -299,11 +303,21 @@ func TestK8sSA_AuthorizeSign(t *testing.T) {
 								assert.Equals(t, nil, v.policyEngine)
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
+							case X509SignerName:
+								assert.Equals(t, "", string(v))
+							case *uniqueSANOption:
+								assert.False(t, v.Enabled)
+							case *signatureAlgorithmOption:
+								assert.Len(t, 0, v.Allowed)
+							case DuplicateDNSNamesPolicy:
+								assert.Equals(t, "", string(v))
+							case X509SerialGenerator:
+								assert.Nil(t, v.SerialGenerator)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
 						}
-						assert.Equals(t, 8, len(opts))
+						assert.Equals(t, 13, len(opts))
 					}
 				}
 			}
@@ -398,3 +412,115 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 		})
 	}
 }
+
+func TestK8sSA_Init_tokenReview(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	fooPub, err := os.ReadFile("./testdata/certs/foo.pub")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		pubKeys     []byte
+		tokenReview *K8sSATokenReview
+		wantErr     bool
+	}{
+		{"ok", nil, &K8sSATokenReview{APIServerURL: srv.URL, CABundle: caBundle, Token: "token"}, false},
+		{"ok/token-file", nil, &K8sSATokenReview{APIServerURL: srv.URL, TokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token"}, false},
+		{"fail/pub-keys", fooPub, &K8sSATokenReview{APIServerURL: srv.URL, Token: "token"}, true},
+		{"fail/empty-url", nil, &K8sSATokenReview{Token: "token"}, true},
+		{"fail/http-url", nil, &K8sSATokenReview{APIServerURL: "http://kubernetes.default.svc", Token: "token"}, true},
+		{"fail/no-credentials", nil, &K8sSATokenReview{APIServerURL: srv.URL}, true},
+		{"fail/token-and-file", nil, &K8sSATokenReview{APIServerURL: srv.URL, Token: "token", TokenFile: "token"}, true},
+		{"fail/ca-bundle", nil, &K8sSATokenReview{APIServerURL: srv.URL, CABundle: []byte("foo"), Token: "token"}, true},
+		{"fail/no-keys", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &K8sSA{
+				Type:        "K8sSA",
+				Name:        K8sSAName,
+				PubKeys:     tt.pubKeys,
+				TokenReview: tt.tokenReview,
+			}
+			err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("K8sSA.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestK8sSA_authorizeToken_tokenReview(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	tok, err := generateK8sSAToken(jwk, nil)
+	assert.FatalError(t, err)
+
+	var status k8sTokenReviewStatus
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review k8sTokenReview
+		switch {
+		case r.URL.Path != k8sSATokenReviewPath:
+			http.NotFound(w, r)
+			return
+		case r.Header.Get("Authorization") != "Bearer provisioner-token":
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Spec.Token != tok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		review.Status = &status
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer srv.Close()
+
+	p := &K8sSA{
+		Type: "K8sSA",
+		Name: K8sSAName,
+		TokenReview: &K8sSATokenReview{
+			APIServerURL: srv.URL,
+			CABundle:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+			Token:        "provisioner-token",
+		},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	// Authenticated service account.
+	status.Authenticated = true
+	status.User.Username = "system:serviceaccount:default:my-app"
+	status.User.UID = "b0c5d8e3"
+	claims, err := p.authorizeToken(context.Background(), tok, testAudiences.Sign)
+	assert.FatalError(t, err)
+	assert.Equals(t, "system:serviceaccount:default:my-app", claims.Subject)
+	assert.Equals(t, "default", claims.Namespace)
+	assert.Equals(t, "my-app", claims.ServiceAccountName)
+	assert.Equals(t, "b0c5d8e3", claims.ServiceAccountUID)
+
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assert.Equals(t, 13, len(opts))
+
+	// Not a service account.
+	status.User.Username = "jane@example.com"
+	_, err = p.authorizeToken(context.Background(), tok, testAudiences.Sign)
+	assert.HasPrefix(t, err.Error(), "k8ssa.authorizeToken; error validating k8sSA token with the TokenReview API")
+
+	// Not authenticated.
+	status = k8sTokenReviewStatus{Error: "token has expired"}
+	_, err = p.authorizeToken(context.Background(), tok, testAudiences.Sign)
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	assert.Equals(t, "k8ssa.authorizeToken; error validating k8sSA token with the TokenReview API: token review failed: token has expired", err.Error())
+
+	// Bad provisioner credentials.
+	p.TokenReview.Token = "bad-token"
+	_, err = p.authorizeToken(context.Background(), tok, testAudiences.Sign)
+	assert.HasPrefix(t, err.Error(), "k8ssa.authorizeToken; error validating k8sSA token with the TokenReview API: token review request returned non-successful status code 401")
+}
@@ -0,0 +1,211 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+)
+
+// k8sSATokenReviewTimeout is the timeout used to send the TokenReview request.
+const k8sSATokenReviewTimeout = 10 * time.Second
+
+// k8sSATokenReviewMaxResponseSize is the maximum size of the TokenReview
+// response.
+const k8sSATokenReviewMaxResponseSize = 64 * 1024
+
+// k8sSATokenReviewPath is the path of the TokenReview API in the Kubernetes API
+// server.
+const k8sSATokenReviewPath = "/apis/authentication.k8s.io/v1/tokenreviews"
+
+// k8sSAUsernamePrefix is the prefix of the username of service accounts
+// returned by the TokenReview API.
+const k8sSAUsernamePrefix = "system:serviceaccount:"
+
+// K8sSATokenReview is the configuration used by the K8sSA provisioner to
+// validate tokens using the TokenReview API of a Kubernetes API server. Bound
+// service account tokens are signed by keys rotated by the cluster, so they
+// cannot be validated with static public keys.
+type K8sSATokenReview struct {
+	// APIServerURL is the URL of the Kubernetes API server, e.g.
+	// "https://kubernetes.default.svc".
+	APIServerURL string `json:"apiServerURL"`
+	// CABundle are the PEM encoded certificates used to validate the API
+	// server certificate. If empty, the system roots are used.
+	CABundle []byte `json:"caBundle,omitempty"`
+	// Token is the bearer token used by the provisioner to authenticate to the
+	// API server. The token requires permissions to create TokenReviews.
+	Token string `json:"token,omitempty"`
+	// TokenFile is the path of a file with the bearer token used by the
+	// provisioner. The file is read on each request, so projected tokens
+	// rotated by the kubelet can be used.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Audiences are the audiences the reviewed tokens must be valid for. If
+	// empty, the API server audiences are used.
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// Validate validates the TokenReview configuration.
+func (t *K8sSATokenReview) Validate() error {
+	u, err := url.Parse(t.APIServerURL)
+	switch {
+	case t.APIServerURL == "":
+		return errors.New("tokenReview apiServerURL cannot be empty")
+	case err != nil:
+		return errors.Wrap(err, "error parsing tokenReview apiServerURL")
+	case u.Scheme != "https" || u.Host == "":
+		return errors.Errorf("tokenReview apiServerURL %q is not a valid https url", t.APIServerURL)
+	case t.Token == "" && t.TokenFile == "":
+		return errors.New("tokenReview token or tokenFile cannot be empty")
+	case t.Token != "" && t.TokenFile != "":
+		return errors.New("tokenReview token and tokenFile cannot be used together")
+	}
+	if len(t.CABundle) > 0 {
+		if ok := x509.NewCertPool().AppendCertsFromPEM(t.CABundle); !ok {
+			return errors.New("tokenReview caBundle does not contain any valid certificate")
+		}
+	}
+	return nil
+}
+
+// newClient returns the http client used to send requests to the API server.
+func (t *K8sSATokenReview) newClient() *http.Client {
+	return newK8sAPIServerClient(t.CABundle)
+}
+
+// newK8sAPIServerClient returns an http client for a Kubernetes API server
+// that validates the server certificate with the given PEM encoded
+// certificates, or with the system roots if empty.
+func newK8sAPIServerClient(caBundle []byte) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if len(caBundle) > 0 {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caBundle)
+		tr.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return &http.Client{
+		Transport: tr,
+	}
+}
+
+// bearerToken returns the credentials of the provisioner.
+func (t *K8sSATokenReview) bearerToken() (string, error) {
+	if t.TokenFile == "" {
+		return t.Token, nil
+	}
+	b, err := os.ReadFile(t.TokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading tokenReview tokenFile")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+type k8sTokenReview struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       k8sTokenReviewSpec    `json:"spec"`
+	Status     *k8sTokenReviewStatus `json:"status,omitempty"`
+}
+
+type k8sTokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type k8sTokenReviewStatus struct {
+	Authenticated bool   `json:"authenticated"`
+	Error         string `json:"error,omitempty"`
+	User          struct {
+		Username string `json:"username"`
+		UID      string `json:"uid"`
+	} `json:"user"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// reviewToken sends the token to the TokenReview API and returns the claims
+// of the authenticated service account.
+func (p *K8sSA) reviewToken(ctx context.Context, token string) (*k8sSAPayload, error) {
+	bearer, err := p.TokenReview.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(k8sTokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec: k8sTokenReviewSpec{
+			Token:     token,
+			Audiences: p.TokenReview.Audiences,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling token review")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, k8sSATokenReviewTimeout)
+	defer cancel()
+	u := strings.TrimSuffix(p.TokenReview.APIServerURL, "/") + k8sSATokenReviewPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating token review request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := p.tokenReviewClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending token review request")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, k8sSATokenReviewMaxResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading token review response")
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, errors.Errorf("token review request returned non-successful status code %d", resp.StatusCode)
+	}
+
+	var review k8sTokenReview
+	if err := json.Unmarshal(b, &review); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling token review response")
+	}
+	switch {
+	case review.Status == nil:
+		return nil, errors.New("token review response does not contain a status")
+	case review.Status.Error != "":
+		return nil, errors.Errorf("token review failed: %s", review.Status.Error)
+	case !review.Status.Authenticated:
+		return nil, errors.New("token review failed: token is not authenticated")
+	}
+
+	// The username of service accounts is
+	// system:serviceaccount:<namespace>:<name>.
+	username := review.Status.User.Username
+	parts := strings.Split(strings.TrimPrefix(username, k8sSAUsernamePrefix), ":")
+	if !strings.HasPrefix(username, k8sSAUsernamePrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("token review user %q is not a service account", username)
+	}
+
+	return &k8sSAPayload{
+		Claims: jose.Claims{
+			Subject: username,
+		},
+		Namespace:          parts[0],
+		ServiceAccountName: parts[1],
+		ServiceAccountUID:  review.Status.User.UID,
+	}, nil
+}
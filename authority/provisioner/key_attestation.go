@@ -0,0 +1,236 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+var (
+	// StepOIDKeyAttestationStatement is the OID of the certificate request
+	// extension with the key attestation of the private key of the request.
+	StepOIDKeyAttestationStatement = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 7)...)
+
+	// StepOIDKeyAttestation is the OID of the certificate extension that
+	// records the result of the verification of the key attestation.
+	StepOIDKeyAttestation = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 8)...)
+)
+
+// KeyAttestationOptions verifies the key attestations sent in the certificate
+// requests, the proof that the private key was generated in, and cannot be
+// exported from, a TPM, HSM, or security key.
+//
+// The attestation is the chain of an attestation certificate, issued by the
+// device or its manufacturer for the key of the certificate request. The
+// client adds it to the certificate request in the extension
+// StepOIDKeyAttestationStatement, a SEQUENCE OF Certificate with the
+// attestation certificate first, e.g. the certificate of a YubiKey PIV slot
+// followed by the attestation intermediate of the device. The chain must
+// verify with the PEM bundle of Roots.
+//
+// If Required is set the requests without a valid attestation are rejected.
+// Otherwise they are signed and the certificates record that the attestation
+// failed. In both cases the certificates record the result of the
+// verification in the extension StepOIDKeyAttestation.
+type KeyAttestationOptions struct {
+	Roots    []byte `json:"roots"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// KeyAttestation is the content of the extension that records the result of
+// the verification of a key attestation. Fingerprint is the SHA-256
+// fingerprint of the attestation certificate, it is only set if the
+// attestation is verified.
+type KeyAttestation struct {
+	Result      ACMEAttestationResult `asn1:"utf8"`
+	Fingerprint []byte                `asn1:"optional,explicit,tag:0"`
+}
+
+// NewKeyAttestationStatementExtension returns the certificate request extension
+// with the given key attestation chain. The first certificate must be the
+// attestation certificate of the key of the request.
+func NewKeyAttestationStatementExtension(chain []*x509.Certificate) (pkix.Extension, error) {
+	if len(chain) == 0 {
+		return pkix.Extension{}, errors.New("key attestation chain cannot be empty")
+	}
+	certs := make([]asn1.RawValue, len(chain))
+	for i, crt := range chain {
+		certs[i] = asn1.RawValue{FullBytes: crt.Raw}
+	}
+	b, err := asn1.Marshal(certs)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling key attestation")
+	}
+	return pkix.Extension{
+		Id:    StepOIDKeyAttestationStatement,
+		Value: b,
+	}, nil
+}
+
+// GetKeyAttestation returns the content of the key attestation extension
+// (1.3.6.1.4.1.37476.9000.64.8) of the given certificate. It returns false if
+// the certificate does not have it.
+func GetKeyAttestation(cert *x509.Certificate) (KeyAttestation, bool) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(StepOIDKeyAttestation) {
+			var ka KeyAttestation
+			if rest, err := asn1.Unmarshal(e.Value, &ka); err != nil || len(rest) > 0 {
+				return KeyAttestation{}, false
+			}
+			return ka, true
+		}
+	}
+	return KeyAttestation{}, false
+}
+
+// newKeyAttestationVerifier validates the key attestation options of the
+// provisioner. It returns nil if they are not configured.
+func newKeyAttestationVerifier(o *KeyAttestationOptions) (*keyAttestationVerifier, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if len(o.Roots) == 0 {
+		return nil, errors.New("x509.keyAttestation roots cannot be empty")
+	}
+	certs, err := pemutil.ParseCertificateBundle(o.Roots)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing x509.keyAttestation roots")
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("x509.keyAttestation roots does not contain any certificate")
+	}
+	roots := x509.NewCertPool()
+	for _, crt := range certs {
+		if !crt.IsCA {
+			return nil, errors.Errorf("x509.keyAttestation root %q is not a CA", crt.Subject)
+		}
+		roots.AddCert(crt)
+	}
+	return &keyAttestationVerifier{
+		roots:    roots,
+		required: o.Required,
+	}, nil
+}
+
+// keyAttestationVerifier verifies the key attestations with the roots of the
+// provisioner.
+type keyAttestationVerifier struct {
+	roots    *x509.CertPool
+	required bool
+}
+
+// newOptions returns the SignOptions that verify the key attestation of a
+// certificate request and record the result in the certificate.
+func (v *keyAttestationVerifier) newOptions() []SignOption {
+	validator := &keyAttestationValidator{verifier: v}
+	return []SignOption{validator, keyAttestationModifier{validator: validator}}
+}
+
+// verify verifies the key attestation in the certificate request and returns
+// the SHA-256 fingerprint of the attestation certificate.
+func (v *keyAttestationVerifier) verify(req *x509.CertificateRequest) ([]byte, error) {
+	var value []byte
+	for _, ext := range req.Extensions {
+		if ext.Id.Equal(StepOIDKeyAttestationStatement) {
+			value = ext.Value
+			break
+		}
+	}
+	if value == nil {
+		return nil, errors.New("certificate request does not have a key attestation")
+	}
+
+	var raws []asn1.RawValue
+	if rest, err := asn1.Unmarshal(value, &raws); err != nil || len(rest) > 0 || len(raws) == 0 {
+		return nil, errors.New("key attestation is malformed")
+	}
+	var leaf *x509.Certificate
+	intermediates := x509.NewCertPool()
+	for i, raw := range raws {
+		crt, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "key attestation certificate is malformed")
+		}
+		if i == 0 {
+			leaf = crt
+		} else {
+			intermediates.AddCert(crt)
+		}
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         v.roots,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, errors.Wrap(err, "key attestation certificate is not valid")
+	}
+	if pub, ok := req.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return nil, errors.New("key attestation certificate does not match the key of the certificate request")
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+	return sum[:], nil
+}
+
+// keyAttestationValidator is a CertificateRequestValidator that verifies the
+// key attestation of the certificate request. It keeps the result of the
+// verification for the keyAttestationModifier of the same request.
+type keyAttestationValidator struct {
+	verifier    *keyAttestationVerifier
+	attestation *KeyAttestation
+}
+
+// Valid verifies the key attestation of the certificate request. It returns an
+// error if the attestation is not valid and the provisioner requires it.
+func (v *keyAttestationValidator) Valid(req *x509.CertificateRequest) error {
+	fingerprint, err := v.verifier.verify(req)
+	if err != nil {
+		if v.verifier.required {
+			return errs.ForbiddenErr(err, "certificate request does not have a valid key attestation")
+		}
+		v.attestation = &KeyAttestation{Result: AttestationFail}
+		return nil
+	}
+	v.attestation = &KeyAttestation{Result: AttestationPass, Fingerprint: fingerprint}
+	return nil
+}
+
+// keyAttestationModifier is a CertificateModifier that records the result of
+// the verification of the key attestation in the certificate. It also removes
+// the key attestation statement if the template copies it from the request.
+type keyAttestationModifier struct {
+	validator *keyAttestationValidator
+}
+
+// Modify sets the key attestation extension of the certificate.
+func (m keyAttestationModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if m.validator.attestation == nil {
+		return errs.InternalServer("key attestation of the certificate request has not been verified")
+	}
+	b, err := asn1.Marshal(*m.validator.attestation)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling key attestation extension")
+	}
+
+	extensions := make([]pkix.Extension, 0, len(cert.ExtraExtensions)+1)
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(StepOIDKeyAttestationStatement) && !ext.Id.Equal(StepOIDKeyAttestation) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.ExtraExtensions = append(extensions, pkix.Extension{
+		Id:    StepOIDKeyAttestation,
+		Value: b,
+	})
+	return nil
+}
@@ -0,0 +1,226 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/minica"
+)
+
+// newAttestationCertificate returns the attestation certificate of the given
+// key issued by the CA.
+func newAttestationCertificate(t *testing.T, ca *minica.CA, key crypto.PublicKey) *x509.Certificate {
+	t.Helper()
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Attested Key"},
+		PublicKey: key,
+	})
+	assert.FatalError(t, err)
+	return crt
+}
+
+// newAttestedRequest returns a certificate request signed by the given key
+// with the given key attestation extensions.
+func newAttestedRequest(t *testing.T, signer crypto.Signer, extensions ...pkix.Extension) *x509.CertificateRequest {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "test.example.com"},
+		DNSNames:        []string{"test.example.com"},
+		ExtraExtensions: extensions,
+	}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func Test_newKeyAttestationVerifier(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	leaf := newAttestationCertificate(t, ca, key.Public())
+
+	tests := []struct {
+		name    string
+		options *KeyAttestationOptions
+		wantNil bool
+		wantErr bool
+	}{
+		{"ok", &KeyAttestationOptions{Roots: encodeCertificates(ca.Root)}, false, false},
+		{"ok required", &KeyAttestationOptions{Roots: encodeCertificates(ca.Root, ca.Intermediate), Required: true}, false, false},
+		{"ok nil", nil, true, false},
+		{"fail empty", &KeyAttestationOptions{Required: true}, true, true},
+		{"fail pem", &KeyAttestationOptions{Roots: []byte("not a certificate")}, true, true},
+		{"fail no certificates", &KeyAttestationOptions{Roots: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3}})}, true, true},
+		{"fail not a CA", &KeyAttestationOptions{Roots: encodeCertificates(leaf)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newKeyAttestationVerifier(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newKeyAttestationVerifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+			if got != nil {
+				assert.Equals(t, tt.options.Required, got.required)
+			}
+		})
+	}
+}
+
+func TestNewKeyAttestationStatementExtension(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+
+	ext, err := NewKeyAttestationStatementExtension([]*x509.Certificate{ca.Intermediate, ca.Root})
+	assert.FatalError(t, err)
+	assert.Equals(t, StepOIDKeyAttestationStatement, ext.Id)
+	assert.False(t, ext.Critical)
+
+	var certs []asn1.RawValue
+	rest, err := asn1.Unmarshal(ext.Value, &certs)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, rest)
+	if assert.Len(t, 2, certs) {
+		assert.Equals(t, ca.Intermediate.Raw, certs[0].FullBytes)
+		assert.Equals(t, ca.Root.Raw, certs[1].FullBytes)
+	}
+
+	_, err = NewKeyAttestationStatementExtension(nil)
+	assert.Error(t, err)
+}
+
+func Test_keyAttestationOptions(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	other, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	attestation := newAttestationCertificate(t, ca, signer.Public())
+	mustExtension := func(chain ...*x509.Certificate) pkix.Extension {
+		ext, err := NewKeyAttestationStatementExtension(chain)
+		assert.FatalError(t, err)
+		return ext
+	}
+	fingerprint := sha256.Sum256(attestation.Raw)
+
+	expired, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Attested Key"},
+		PublicKey: signer.Public(),
+		NotBefore: time.Now().Add(-2 * time.Hour),
+		NotAfter:  time.Now().Add(-time.Hour),
+	})
+	assert.FatalError(t, err)
+
+	valid := newAttestedRequest(t, signer, mustExtension(attestation, ca.Intermediate))
+	tests := []struct {
+		name     string
+		csr      *x509.CertificateRequest
+		required bool
+		want     KeyAttestation
+		wantCode int
+	}{
+		{"ok", valid, true, KeyAttestation{Result: AttestationPass, Fingerprint: fingerprint[:]}, 0},
+		{"ok not required", valid, false, KeyAttestation{Result: AttestationPass, Fingerprint: fingerprint[:]}, 0},
+		{"ok missing not required", newAttestedRequest(t, signer), false, KeyAttestation{Result: AttestationFail}, 0},
+		{"ok invalid not required", newAttestedRequest(t, otherSigner, mustExtension(attestation, ca.Intermediate)), false, KeyAttestation{Result: AttestationFail}, 0},
+		{"fail missing", newAttestedRequest(t, signer), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail malformed", newAttestedRequest(t, signer, pkix.Extension{Id: StepOIDKeyAttestationStatement, Value: []byte("attestation")}), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail empty", newAttestedRequest(t, signer, pkix.Extension{Id: StepOIDKeyAttestationStatement, Value: []byte{0x30, 0x00}}), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail certificate", newAttestedRequest(t, signer, pkix.Extension{Id: StepOIDKeyAttestationStatement, Value: []byte{0x30, 0x02, 0x30, 0x00}}), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail missing intermediate", newAttestedRequest(t, signer, mustExtension(attestation)), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail untrusted", newAttestedRequest(t, signer, mustExtension(newAttestationCertificate(t, other, signer.Public()), other.Intermediate)), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail expired", newAttestedRequest(t, signer, mustExtension(expired, ca.Intermediate)), true, KeyAttestation{}, http.StatusForbidden},
+		{"fail other key", newAttestedRequest(t, otherSigner, mustExtension(attestation, ca.Intermediate)), true, KeyAttestation{}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newKeyAttestationVerifier(&KeyAttestationOptions{
+				Roots:    encodeCertificates(ca.Root),
+				Required: tt.required,
+			})
+			assert.FatalError(t, err)
+
+			opts := v.newOptions()
+			assert.Len(t, 2, opts)
+			validator, ok := opts[0].(CertificateRequestValidator)
+			assert.Fatal(t, ok)
+			modifier, ok := opts[1].(CertificateModifier)
+			assert.Fatal(t, ok)
+
+			err = validator.Valid(tt.csr)
+			if tt.wantCode != 0 {
+				assertStatusCode(t, tt.wantCode, err)
+				return
+			}
+			assert.FatalError(t, err)
+
+			// The statement copied from the request is replaced by the result.
+			cert := &x509.Certificate{
+				SerialNumber:    big.NewInt(1),
+				PublicKey:       tt.csr.PublicKey,
+				ExtraExtensions: tt.csr.Extensions,
+			}
+			assert.FatalError(t, modifier.Modify(cert, SignOptions{}))
+			crt, err := ca.Sign(cert)
+			assert.FatalError(t, err)
+
+			got, ok := GetKeyAttestation(crt)
+			assert.True(t, ok)
+			assert.Equals(t, tt.want, got)
+			for _, ext := range crt.Extensions {
+				assert.False(t, ext.Id.Equal(StepOIDKeyAttestationStatement))
+			}
+		})
+	}
+}
+
+func Test_keyAttestationModifier_notVerified(t *testing.T) {
+	m := keyAttestationModifier{validator: &keyAttestationValidator{}}
+	assertStatusCode(t, http.StatusInternalServerError, m.Modify(&x509.Certificate{}, SignOptions{}))
+}
+
+func TestGetKeyAttestation(t *testing.T) {
+	tests := []struct {
+		name   string
+		cert   *x509.Certificate
+		want   KeyAttestation
+		wantOk bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{
+			{Id: StepOIDKeyAttestation, Value: []byte{0x30, 0x06, 0x0c, 0x04, 'p', 'a', 's', 's'}},
+		}}, KeyAttestation{Result: AttestationPass}, true},
+		{"ok fingerprint", &x509.Certificate{Extensions: []pkix.Extension{
+			{Id: StepOIDKeyAttestation, Value: []byte{0x30, 0x0b, 0x0c, 0x04, 'p', 'a', 's', 's', 0xa0, 0x03, 0x04, 0x01, 0x01}},
+		}}, KeyAttestation{Result: AttestationPass, Fingerprint: []byte{1}}, true},
+		{"fail missing", &x509.Certificate{}, KeyAttestation{}, false},
+		{"fail malformed", &x509.Certificate{Extensions: []pkix.Extension{
+			{Id: StepOIDKeyAttestation, Value: []byte("pass")},
+		}}, KeyAttestation{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetKeyAttestation(tt.cert)
+			assert.Equals(t, tt.wantOk, ok)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package provisioner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/cli-utils/step"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// KeyBlocklist is the interface used to reject the certificate requests with
+// public keys known to be compromised, e.g. the Debian weak keys or leaked
+// keys. Implementations must be safe for concurrent use.
+type KeyBlocklist interface {
+	// IsBlocked reports whether the public key with the given fingerprint is
+	// in the blocklist. The fingerprint is returned by KeyFingerprint.
+	IsBlocked(fingerprint string) (bool, error)
+}
+
+// KeyFingerprint returns the fingerprint of a public key used in the
+// KeyBlocklist, the lowercase hex encoding of the SHA-256 hash of its
+// DER-encoded SubjectPublicKeyInfo.
+func KeyFingerprint(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling public key")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// keyBlocklistCheckInterval is the minimum time between two checks for changes
+// in the key blocklist file.
+const keyBlocklistCheckInterval = 10 * time.Second
+
+// fileKeyBlocklist is a KeyBlocklist loaded from a file. Like the template
+// files, the file is reloaded when it's modified, but it's checked for changes
+// at most once per interval, so the lookups do not hit the filesystem.
+type fileKeyBlocklist struct {
+	mu           sync.RWMutex
+	path         string
+	interval     time.Duration
+	nextCheck    int64
+	modTime      time.Time
+	size         int64
+	fingerprints map[string]bool
+}
+
+// NewFileKeyBlocklist returns a KeyBlocklist with the fingerprints in the
+// given file. The file contains one SHA-256 fingerprint per line, in hex with
+// or without colons; empty lines and lines starting with "#" are ignored. The
+// file is checked for changes every 10 seconds at most, on lookup, and
+// reloaded if it has been modified; if the new version cannot be parsed the
+// previous one is kept.
+func NewFileKeyBlocklist(filename string) (KeyBlocklist, error) {
+	if filename == "" {
+		return nil, errors.New("key blocklist file cannot be empty")
+	}
+	b := &fileKeyBlocklist{
+		path:     step.Abs(filename),
+		interval: keyBlocklistCheckInterval,
+	}
+	if err := b.reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// IsBlocked implements the KeyBlocklist interface.
+func (b *fileKeyBlocklist) IsBlocked(fingerprint string) (bool, error) {
+	b.checkForChanges()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.fingerprints[fingerprint], nil
+}
+
+// checkForChanges reloads the file if it has been modified. Only one caller
+// per interval checks the file, the others use the current fingerprints.
+func (b *fileKeyBlocklist) checkForChanges() {
+	now := time.Now().UnixNano()
+	next := atomic.LoadInt64(&b.nextCheck)
+	if now < next || !atomic.CompareAndSwapInt64(&b.nextCheck, next, now+int64(b.interval)) {
+		return
+	}
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return
+	}
+	b.mu.RLock()
+	modified := !fi.ModTime().Equal(b.modTime) || fi.Size() != b.size
+	b.mu.RUnlock()
+	if modified {
+		if err := b.reload(); err != nil {
+			log.Printf("error reloading key blocklist %s, using the previous version: %v", b.path, err)
+		}
+	}
+}
+
+// reload reads and parses the file and, if it's valid, replaces the
+// fingerprints of the blocklist.
+func (b *fileKeyBlocklist) reload() error {
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading key blocklist")
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading key blocklist")
+	}
+	fingerprints := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fp, err := parseKeyFingerprint(line)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing key blocklist %s on line %d", b.path, n)
+		}
+		fingerprints[fp] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "error parsing key blocklist %s", b.path)
+	}
+	b.mu.Lock()
+	b.modTime = fi.ModTime()
+	b.size = fi.Size()
+	b.fingerprints = fingerprints
+	b.mu.Unlock()
+	return nil
+}
+
+// parseKeyFingerprint returns the normalized form of a SHA-256 fingerprint in
+// hex, with or without colons.
+func parseKeyFingerprint(s string) (string, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, ":", ""))
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return "", errors.Errorf("%q is not a valid SHA-256 fingerprint", s)
+	}
+	return s, nil
+}
+
+// keyBlocklistValidator is a CertificateRequestValidator that rejects the
+// certificate requests with a public key in the blocklist.
+type keyBlocklistValidator struct {
+	blocklist KeyBlocklist
+}
+
+// Valid implements CertificateRequestValidator.
+func (v keyBlocklistValidator) Valid(req *x509.CertificateRequest) error {
+	fp, err := KeyFingerprint(req.PublicKey)
+	if err != nil {
+		return errs.BadRequestErr(err, "certificate request public key is not valid")
+	}
+	blocked, err := v.blocklist.IsBlocked(fp)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error checking the key blocklist")
+	}
+	if blocked {
+		return errs.Forbidden("certificate request public key is in the key blocklist")
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+type mockKeyBlocklist struct {
+	blocked map[string]bool
+	err     error
+}
+
+func (m *mockKeyBlocklist) IsBlocked(fingerprint string) (bool, error) {
+	return m.blocked[fingerprint], m.err
+}
+
+func mustKeyFingerprint(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	fp, err := KeyFingerprint(key.Public())
+	assert.FatalError(t, err)
+	return key, fp
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.FatalError(t, err)
+	sum := sha256.Sum256(der)
+
+	fp, err := KeyFingerprint(key.Public())
+	assert.FatalError(t, err)
+	assert.Equals(t, hex.EncodeToString(sum[:]), fp)
+
+	_, err = KeyFingerprint("not a key")
+	assert.Error(t, err)
+}
+
+func Test_parseKeyFingerprint(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	withColons := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"ok", fp, fp, false},
+		{"ok upper case with colons", withColons, fp, false},
+		{"fail hex", strings.Repeat("zz", 32), "", true},
+		{"fail length", strings.Repeat("ab", 20), "", true},
+		{"fail base64", "SHA256:q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQq83vEjRWeJA", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyFingerprint(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeyFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewFileKeyBlocklist(t *testing.T) {
+	_, fp := mustKeyFingerprint(t)
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.txt")
+	assert.FatalError(t, os.WriteFile(ok, []byte("# Compromised keys\n\n"+fp+"\n"), 0600))
+	empty := filepath.Join(dir, "empty.txt")
+	assert.FatalError(t, os.WriteFile(empty, nil, 0600))
+	invalid := filepath.Join(dir, "invalid.txt")
+	assert.FatalError(t, os.WriteFile(invalid, []byte(fp+"\nnot-a-fingerprint\n"), 0600))
+
+	tests := []struct {
+		name        string
+		filename    string
+		wantBlocked bool
+		wantErr     bool
+	}{
+		{"ok", ok, true, false},
+		{"ok empty", empty, false, false},
+		{"fail filename", "", false, true},
+		{"fail missing", filepath.Join(dir, "missing.txt"), false, true},
+		{"fail invalid", invalid, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewFileKeyBlocklist(tt.filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileKeyBlocklist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			blocked, err := b.IsBlocked(fp)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantBlocked, blocked)
+		})
+	}
+}
+
+func Test_fileKeyBlocklist_reload(t *testing.T) {
+	_, fp1 := mustKeyFingerprint(t)
+	_, fp2 := mustKeyFingerprint(t)
+
+	filename := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.FatalError(t, os.WriteFile(filename, []byte(fp1+"\n"), 0600))
+	kb, err := NewFileKeyBlocklist(filename)
+	assert.FatalError(t, err)
+	b := kb.(*fileKeyBlocklist)
+
+	isBlocked := func(fp string) bool {
+		blocked, err := b.IsBlocked(fp)
+		assert.FatalError(t, err)
+		return blocked
+	}
+	assert.True(t, isBlocked(fp1))
+	assert.False(t, isBlocked(fp2))
+
+	// The modified blocklist is not checked before the interval.
+	touch := func(d time.Duration) {
+		now := time.Now().Add(d)
+		assert.FatalError(t, os.Chtimes(filename, now, now))
+	}
+	assert.FatalError(t, os.WriteFile(filename, []byte(fp2+"\n"), 0600))
+	touch(time.Minute)
+	assert.True(t, isBlocked(fp1))
+	assert.False(t, isBlocked(fp2))
+
+	// The modified blocklist is reloaded.
+	b.interval = 0
+	atomic.StoreInt64(&b.nextCheck, 0)
+	assert.False(t, isBlocked(fp1))
+	assert.True(t, isBlocked(fp2))
+
+	// A blocklist that cannot be parsed is ignored.
+	assert.FatalError(t, os.WriteFile(filename, []byte(fp1+"\nnot-a-fingerprint\n"), 0600))
+	touch(2 * time.Minute)
+	assert.False(t, isBlocked(fp1))
+	assert.True(t, isBlocked(fp2))
+
+	// And so is a deleted one.
+	assert.FatalError(t, os.Remove(filename))
+	assert.True(t, isBlocked(fp2))
+}
+
+func Test_keyBlocklistValidator_Valid(t *testing.T) {
+	key, fp := mustKeyFingerprint(t)
+	other, _ := mustKeyFingerprint(t)
+
+	tests := []struct {
+		name      string
+		blocklist KeyBlocklist
+		req       *x509.CertificateRequest
+		code      int
+	}{
+		{"ok", &mockKeyBlocklist{blocked: map[string]bool{fp: true}}, &x509.CertificateRequest{PublicKey: other.Public()}, http.StatusOK},
+		{"fail blocked", &mockKeyBlocklist{blocked: map[string]bool{fp: true}}, &x509.CertificateRequest{PublicKey: key.Public()}, http.StatusForbidden},
+		{"fail key", &mockKeyBlocklist{}, &x509.CertificateRequest{PublicKey: "not a key"}, http.StatusBadRequest},
+		{"fail blocklist", &mockKeyBlocklist{err: errors.New("force")}, &x509.CertificateRequest{PublicKey: key.Public()}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := keyBlocklistValidator{blocklist: tt.blocklist}.Valid(tt.req)
+			if tt.code == http.StatusOK {
+				assert.NoError(t, err)
+				return
+			}
+			assertStatusCode(t, tt.code, err)
+		})
+	}
+}
+
+func TestJWK_AuthorizeSign_keyBlocklist(t *testing.T) {
+	key, fp := mustKeyFingerprint(t)
+	other, _ := mustKeyFingerprint(t)
+
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	jwk, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	token, err := generateSimpleToken(p.Name, testAudiences.Sign[0], jwk)
+	assert.FatalError(t, err)
+
+	validate := func(opts []SignOption, req *x509.CertificateRequest) error {
+		for _, o := range opts {
+			if v, ok := o.(CertificateRequestValidator); ok {
+				if err := v.Valid(req); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// Without a blocklist all keys are allowed.
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	assert.FatalError(t, err)
+	assert.NoError(t, validate(opts, &x509.CertificateRequest{PublicKey: key.Public()}))
+
+	p.ctl.KeyBlocklist = &mockKeyBlocklist{blocked: map[string]bool{fp: true}}
+	opts, err = p.AuthorizeSign(context.Background(), token)
+	assert.FatalError(t, err)
+	assertStatusCode(t, http.StatusForbidden, validate(opts, &x509.CertificateRequest{PublicKey: key.Public()}))
+	assert.NoError(t, validate(opts, &x509.CertificateRequest{PublicKey: other.Public()}))
+}
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"math/rand"
 	"net/http"
@@ -16,32 +17,74 @@ import (
 const (
 	defaultCacheAge    = 12 * time.Hour
 	defaultCacheJitter = 1 * time.Hour
+	// unknownKeyReloadInterval is the minimum time between the reloads of the
+	// key set caused by an unknown key id.
+	unknownKeyReloadInterval = time.Minute
 )
 
 var maxAgeRegex = regexp.MustCompile(`max-age=(\d+)`)
 
 type keyStore struct {
 	sync.RWMutex
-	uri    string
-	keySet jose.JSONWebKeySet
-	timer  *time.Timer
-	expiry time.Time
-	jitter time.Duration
+	uri             string
+	keySet          jose.JSONWebKeySet
+	timer           *time.Timer
+	expiry          time.Time
+	jitter          time.Duration
+	refreshInterval time.Duration
+	maxStaleness    time.Duration
+	rejectStale     bool
+	refreshing      bool
+	lastUnknownKey  time.Time
 }
 
-func newKeyStore(uri string) (*keyStore, error) {
-	keys, age, err := getKeysFromJWKsURI(uri)
-	if err != nil {
-		return nil, err
+// keyStoreOption is the type of the options that can be passed to newKeyStore.
+type keyStoreOption func(ks *keyStore)
+
+// withRefreshInterval sets the interval between reloads of the key set. If
+// it's not set the max-age in the Cache-Control header is used.
+func withRefreshInterval(d time.Duration) keyStoreOption {
+	return func(ks *keyStore) {
+		ks.refreshInterval = d
 	}
+}
+
+// withMaxStaleness sets for how long an expired key set can be used while it
+// is reloaded in the background. If it's not set, an expired key set is
+// reloaded before it is used.
+func withMaxStaleness(d time.Duration) keyStoreOption {
+	return func(ks *keyStore) {
+		ks.maxStaleness = d
+	}
+}
+
+// withoutStaleKeys makes Get return no keys if the key set has expired and it
+// cannot be reloaded. By default the last key set is used.
+func withoutStaleKeys() keyStoreOption {
+	return func(ks *keyStore) {
+		ks.rejectStale = true
+	}
+}
+
+func newKeyStore(uri string, opts ...keyStoreOption) (*keyStore, error) {
 	ks := &keyStore{
-		uri:    uri,
-		keySet: keys,
-		expiry: getExpirationTime(age),
-		jitter: getCacheJitter(age),
+		uri: uri,
+	}
+	for _, fn := range opts {
+		fn(ks)
+	}
+	keys, age, err := getKeysFromJWKsURI(context.Background(), uri)
+	if err != nil {
+		return nil, err
 	}
+	age = ks.cacheAge(age)
+	ks.keySet = keys
+	ks.expiry = getExpirationTime(age)
+	ks.jitter = getCacheJitter(age)
 	next := ks.nextReloadDuration(age)
-	ks.timer = time.AfterFunc(next, ks.reload)
+	ks.timer = time.AfterFunc(next, func() {
+		ks.reload(context.Background())
+	})
 	return ks, nil
 }
 
@@ -49,25 +92,84 @@ func (ks *keyStore) Close() {
 	ks.timer.Stop()
 }
 
-func (ks *keyStore) Get(kid string) (keys []jose.JSONWebKey) {
+// Get returns the keys with the given key id. If the key set has expired, it is
+// reloaded using the given context, so a canceled request does not wait for
+// the key set. If the key id is not in the key set, the key set is reloaded,
+// at most once a minute, to get the keys rotated before its expiration.
+func (ks *keyStore) Get(ctx context.Context, kid string) (keys []jose.JSONWebKey) {
 	ks.RLock()
-	// Force reload if expiration has passed
-	if time.Now().After(ks.expiry) {
-		ks.RUnlock()
-		ks.reload()
-		ks.RLock()
-	}
+	expiry := ks.expiry
 	keys = ks.keySet.Key(kid)
 	ks.RUnlock()
+
+	// Force reload if expiration has passed. Within the max staleness the
+	// current keys are used while the key set is reloaded in the background.
+	if now := time.Now(); now.After(expiry) {
+		if len(keys) > 0 && ks.maxStaleness > 0 && now.Before(expiry.Add(ks.maxStaleness)) {
+			ks.reloadAsync()
+			return
+		}
+		if err := ks.reload(ctx); err != nil && ks.rejectStale {
+			return nil
+		}
+		ks.RLock()
+		keys = ks.keySet.Key(kid)
+		ks.RUnlock()
+		return
+	}
+
+	if len(keys) == 0 && ks.allowUnknownKeyReload() {
+		if err := ks.reload(ctx); err == nil {
+			ks.RLock()
+			keys = ks.keySet.Key(kid)
+			ks.RUnlock()
+		}
+	}
 	return
 }
 
-func (ks *keyStore) reload() {
+// allowUnknownKeyReload returns true if the key set can be reloaded because
+// of an unknown key id. It limits those reloads to one per interval, so
+// tokens with random key ids cannot be used to flood the key set server.
+func (ks *keyStore) allowUnknownKeyReload() bool {
+	ks.Lock()
+	defer ks.Unlock()
+	if time.Since(ks.lastUnknownKey) < unknownKeyReloadInterval {
+		return false
+	}
+	ks.lastUnknownKey = time.Now()
+	return true
+}
+
+// reloadAsync reloads the key set in the background unless a reload in the
+// background is already in progress.
+func (ks *keyStore) reloadAsync() {
+	ks.Lock()
+	if ks.refreshing {
+		ks.Unlock()
+		return
+	}
+	ks.refreshing = true
+	ks.Unlock()
+
+	// The reload must not be canceled with the request that triggered it.
+	go func() {
+		ks.reload(context.Background())
+		ks.Lock()
+		ks.refreshing = false
+		ks.Unlock()
+	}()
+}
+
+// reload downloads the key set and schedules the next reload. It returns the
+// error downloading the key set, in that case the current keys are kept.
+func (ks *keyStore) reload(ctx context.Context) error {
 	var next time.Duration
-	keys, age, err := getKeysFromJWKsURI(ks.uri)
+	keys, age, err := getKeysFromJWKsURI(ctx, ks.uri)
 	if err != nil {
 		next = ks.nextReloadDuration(ks.jitter / 2)
 	} else {
+		age = ks.cacheAge(age)
 		ks.Lock()
 		ks.keySet = keys
 		ks.expiry = getExpirationTime(age)
@@ -79,6 +181,16 @@ func (ks *keyStore) reload() {
 	ks.Lock()
 	ks.timer.Reset(next)
 	ks.Unlock()
+	return err
+}
+
+// cacheAge returns the configured refresh interval or the given age if the
+// interval is not set.
+func (ks *keyStore) cacheAge(age time.Duration) time.Duration {
+	if ks.refreshInterval > 0 {
+		return ks.refreshInterval
+	}
+	return age
 }
 
 // nextReloadDuration would return the duration for the next rotation. If age is
@@ -90,9 +202,13 @@ func (ks *keyStore) nextReloadDuration(age time.Duration) time.Duration {
 	return abs(age)
 }
 
-func getKeysFromJWKsURI(uri string) (jose.JSONWebKeySet, time.Duration, error) {
+func getKeysFromJWKsURI(ctx context.Context, uri string) (jose.JSONWebKeySet, time.Duration, error) {
 	var keys jose.JSONWebKeySet
-	resp, err := http.Get(uri) //nolint:gosec // openid-configuration jwks_uri
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return keys, 0, errors.Wrapf(err, "error creating request for %s", uri)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return keys, 0, errors.Wrapf(err, "failed to connect to %s", uri)
 	}
@@ -103,6 +219,19 @@ func getKeysFromJWKsURI(uri string) (jose.JSONWebKeySet, time.Duration, error) {
 	return keys, getCacheAge(resp.Header.Get("cache-control")), nil
 }
 
+// checkKeySet gets the key set in the given uri and returns an error if it
+// cannot be retrieved or if it does not have any key.
+func checkKeySet(ctx context.Context, uri string) error {
+	var keys jose.JSONWebKeySet
+	if err := getAndDecodeContext(ctx, uri, &keys); err != nil {
+		return err
+	}
+	if len(keys.Keys) == 0 {
+		return errors.Errorf("key set %s does not have any key", uri)
+	}
+	return nil
+}
+
 func getCacheAge(cacheControl string) time.Duration {
 	age := defaultCacheAge
 	if cacheControl != "" {
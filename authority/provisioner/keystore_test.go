@@ -1,8 +1,11 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
@@ -59,9 +62,9 @@ func Test_keyStore(t *testing.T) {
 	ks.RUnlock()
 	// Check contents
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 1, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Wait for rotation
 	time.Sleep(5 * time.Second)
@@ -75,9 +78,9 @@ func Test_keyStore(t *testing.T) {
 
 	// Check contents
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 1, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -104,9 +107,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 0, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	ks.RLock()
 	keySet2 := ks.keySet
@@ -118,9 +121,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 0, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -156,13 +159,101 @@ func Test_keyStore_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotKeys := tt.ks.Get(tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+			if gotKeys := tt.ks.Get(context.Background(), tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
 				t.Errorf("keyStore.Get() = %v, want %v", gotKeys, tt.wantKeys)
 			}
 		})
 	}
 }
 
+func Test_keyStore_Get_canceledContext(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL + "/random")
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.Lock()
+	keySet := ks.keySet
+	ks.expiry = time.Now().Add(-time.Minute)
+	ks.Unlock()
+
+	// The reload fails with the canceled context and the old keys are used.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Len(t, 1, ks.Get(ctx, keySet.Keys[0].KeyID))
+	ks.RLock()
+	assert.Equals(t, keySet, ks.keySet)
+	ks.RUnlock()
+
+	// The key set is reloaded with a valid context.
+	assert.Len(t, 0, ks.Get(context.Background(), keySet.Keys[0].KeyID))
+}
+
+func Test_keyStore_Get_withoutStaleKeys(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL+"/random", withoutStaleKeys())
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.Lock()
+	keySet := ks.keySet
+	ks.expiry = time.Now().Add(-time.Minute)
+	ks.Unlock()
+
+	// The reload fails with the canceled context and the old keys are not
+	// used.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Len(t, 0, ks.Get(ctx, keySet.Keys[0].KeyID))
+	ks.RLock()
+	assert.Equals(t, keySet, ks.keySet)
+	ks.RUnlock()
+
+	// The key set is not expired.
+	ks.Lock()
+	ks.expiry = time.Now().Add(time.Minute)
+	ks.Unlock()
+	assert.Len(t, 1, ks.Get(ctx, keySet.Keys[0].KeyID))
+}
+
+func Test_keyStore_Get_unknownKey(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL + "/random")
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.RLock()
+	keySet := ks.keySet
+	ks.RUnlock()
+
+	// An unknown key id reloads the key set.
+	assert.Len(t, 0, ks.Get(context.Background(), "unknown"))
+	ks.RLock()
+	assert.NotEquals(t, keySet, ks.keySet)
+	keySet = ks.keySet
+	ks.RUnlock()
+
+	// The new keys are known without a reload.
+	assert.Len(t, 1, ks.Get(context.Background(), keySet.Keys[0].KeyID))
+
+	// Only one reload per interval.
+	assert.Len(t, 0, ks.Get(context.Background(), "unknown"))
+	ks.RLock()
+	assert.Equals(t, keySet, ks.keySet)
+	ks.RUnlock()
+
+	ks.Lock()
+	ks.lastUnknownKey = time.Now().Add(-unknownKeyReloadInterval)
+	ks.Unlock()
+	assert.Len(t, 0, ks.Get(context.Background(), "unknown"))
+	ks.RLock()
+	assert.NotEquals(t, keySet, ks.keySet)
+	ks.RUnlock()
+}
+
 func Test_abs(t *testing.T) {
 	maxInt64 := time.Duration(1<<63 - 1)
 	minInt64 := time.Duration(-1 << 63)
@@ -190,3 +281,44 @@ func Test_abs(t *testing.T) {
 		})
 	}
 }
+
+func Test_checkKeySet(t *testing.T) {
+	_, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{"ok", srv.URL + "/jwks_uri", false},
+		{"fail empty", srv.URL + "/empty", true},
+		{"fail error", srv.URL + "/error", true},
+		{"fail not found", srv.URL + "/not-found", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkKeySet(context.Background(), tt.uri); (err != nil) != tt.wantErr {
+				t.Errorf("checkKeySet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkKeySet_timeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	tmp := checkClient
+	t.Cleanup(func() { checkClient = tmp })
+	checkClient = &http.Client{Timeout: 100 * time.Millisecond}
+
+	if err := checkKeySet(context.Background(), srv.URL); err == nil {
+		t.Error("checkKeySet() error = nil, want timeout error")
+	}
+}
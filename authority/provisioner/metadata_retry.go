@@ -0,0 +1,107 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMetadataRetryBackoff is the default time to wait before retrying
+	// a request to the instance metadata service.
+	DefaultMetadataRetryBackoff = time.Second
+	// DefaultMetadataRetryMaxBackoff is the default maximum time to wait
+	// between two requests to the instance metadata service.
+	DefaultMetadataRetryMaxBackoff = 30 * time.Second
+)
+
+// MetadataRetryOptions configures the retries of the requests that
+// GetIdentityToken sends to the instance metadata service, which can fail
+// transiently while the instance boots.
+//
+// The requests are retried up to Attempts times on connection errors and on
+// 429 and 5xx responses, but not on other errors. The first retry waits
+// Backoff, one second by default, and the wait is doubled after each retry up
+// to MaxBackoff, 30 seconds by default. The retries stop when the context
+// passed to GetIdentityTokenWithContext is done. By default the requests are
+// not retried.
+type MetadataRetryOptions struct {
+	Attempts   int      `json:"attempts,omitempty"`
+	Backoff    Duration `json:"backoff,omitempty"`
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+}
+
+// init validates the metadata retry options.
+func (o *MetadataRetryOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.Attempts < 0:
+		return errors.New("metadataRetry attempts cannot be negative")
+	case o.Backoff.Value() < 0:
+		return errors.New("metadataRetry backoff cannot be negative")
+	case o.MaxBackoff.Value() < 0:
+		return errors.New("metadataRetry maxBackoff cannot be negative")
+	}
+	return nil
+}
+
+func (o *MetadataRetryOptions) attempts() int {
+	if o == nil {
+		return 0
+	}
+	return o.Attempts
+}
+
+func (o *MetadataRetryOptions) backoff(retry int) time.Duration {
+	backoff, maxBackoff := o.Backoff.Value(), o.MaxBackoff.Value()
+	if backoff == 0 {
+		backoff = DefaultMetadataRetryBackoff
+	}
+	if maxBackoff == 0 {
+		maxBackoff = DefaultMetadataRetryMaxBackoff
+	}
+	for i := 0; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// do sends the request with the given client, retrying it on connection errors
+// and on 429 and 5xx responses. The request must not have a body. It returns
+// the last response or error.
+func (o *MetadataRetryOptions) do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	for retry := 0; ; retry++ {
+		resp, err := client.Do(req)
+		if retry >= o.attempts() || !isRetryableMetadataResponse(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		t := time.NewTimer(o.backoff(retry))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// isRetryableMetadataResponse returns true if the request to the metadata
+// service failed with a connection error or a 429 or 5xx response.
+func isRetryableMetadataResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
@@ -0,0 +1,174 @@
+package provisioner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+// newFlakyServer returns a server that responds with the given status codes
+// before responding with the given body.
+func newFlakyServer(t *testing.T, body string, codes ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if int(n) <= len(codes) {
+			http.Error(w, http.StatusText(codes[n-1]), codes[n-1])
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestMetadataRetryOptions_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *MetadataRetryOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &MetadataRetryOptions{Attempts: 3, Backoff: Duration{Duration: time.Second}, MaxBackoff: Duration{Duration: time.Minute}}, false},
+		{"fail attempts", &MetadataRetryOptions{Attempts: -1}, true},
+		{"fail backoff", &MetadataRetryOptions{Backoff: Duration{Duration: -time.Second}}, true},
+		{"fail maxBackoff", &MetadataRetryOptions{MaxBackoff: Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(); (err != nil) != tt.wantErr {
+				t.Errorf("MetadataRetryOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetadataRetryOptions_backoff(t *testing.T) {
+	o := &MetadataRetryOptions{}
+	assert.Equals(t, time.Second, o.backoff(0))
+	assert.Equals(t, 2*time.Second, o.backoff(1))
+	assert.Equals(t, 16*time.Second, o.backoff(4))
+	assert.Equals(t, 30*time.Second, o.backoff(5))
+	assert.Equals(t, 30*time.Second, o.backoff(100))
+
+	o = &MetadataRetryOptions{Backoff: Duration{Duration: 100 * time.Millisecond}, MaxBackoff: Duration{Duration: 300 * time.Millisecond}}
+	assert.Equals(t, 100*time.Millisecond, o.backoff(0))
+	assert.Equals(t, 200*time.Millisecond, o.backoff(1))
+	assert.Equals(t, 300*time.Millisecond, o.backoff(2))
+}
+
+func TestMetadataRetryOptions_do(t *testing.T) {
+	retry := &MetadataRetryOptions{Attempts: 3, Backoff: Duration{Duration: time.Millisecond}}
+	tests := []struct {
+		name      string
+		options   *MetadataRetryOptions
+		codes     []int
+		wantCode  int
+		wantCalls int32
+	}{
+		{"ok", retry, nil, http.StatusOK, 1},
+		{"ok retry 5xx", retry, []int{http.StatusInternalServerError, http.StatusServiceUnavailable}, http.StatusOK, 3},
+		{"ok retry 429", retry, []int{http.StatusTooManyRequests}, http.StatusOK, 2},
+		{"fail 4xx", retry, []int{http.StatusNotFound}, http.StatusNotFound, 1},
+		{"fail attempts", retry, []int{500, 500, 500, 502}, http.StatusBadGateway, 4},
+		{"fail nil options", nil, []int{http.StatusServiceUnavailable}, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newFlakyServer(t, "ok", tt.codes...)
+			req, err := http.NewRequest("GET", srv.URL, http.NoBody)
+			assert.FatalError(t, err)
+			resp, err := tt.options.do(context.Background(), http.DefaultClient, req)
+			assert.FatalError(t, err)
+			defer resp.Body.Close()
+			assert.Equals(t, tt.wantCode, resp.StatusCode)
+			assert.Equals(t, tt.wantCalls, atomic.LoadInt32(calls))
+		})
+	}
+
+	t.Run("fail connection", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		req, err := http.NewRequest("GET", srv.URL, http.NoBody)
+		assert.FatalError(t, err)
+		_, err = retry.do(context.Background(), http.DefaultClient, req)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail deadline", func(t *testing.T) {
+		srv, calls := newFlakyServer(t, "ok", 500, 500, 500)
+		o := &MetadataRetryOptions{Attempts: 3, Backoff: Duration{Duration: time.Minute}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequest("GET", srv.URL, http.NoBody)
+		assert.FatalError(t, err)
+		_, err = o.do(ctx, http.DefaultClient, req)
+		assert.Equals(t, context.DeadlineExceeded, err)
+		assert.Equals(t, int32(1), atomic.LoadInt32(calls))
+	})
+}
+
+func TestGCP_GetIdentityTokenWithContext_retry(t *testing.T) {
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	p.MetadataRetry = &MetadataRetryOptions{Attempts: 2, Backoff: Duration{Duration: time.Millisecond}}
+
+	srv, calls := newFlakyServer(t, "the-token", http.StatusServiceUnavailable, http.StatusInternalServerError)
+	p.config.IdentityURL = srv.URL
+	got, err := p.GetIdentityTokenWithContext(context.Background(), "subject", "https://ca")
+	assert.FatalError(t, err)
+	assert.Equals(t, "the-token", got)
+	assert.Equals(t, int32(3), atomic.LoadInt32(calls))
+
+	srv, calls = newFlakyServer(t, "the-token", http.StatusForbidden)
+	p.config.IdentityURL = srv.URL
+	_, err = p.GetIdentityTokenWithContext(context.Background(), "subject", "https://ca")
+	assert.Error(t, err)
+	assert.Equals(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestAWS_GetIdentityTokenWithContext_retry(t *testing.T) {
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	p.MetadataRetry = &MetadataRetryOptions{Attempts: 2, Backoff: Duration{Duration: time.Millisecond}}
+
+	// The metadata service fails twice on every request.
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		r.URL.Host = srv.Listener.Addr().String()
+		r.URL.Scheme = "http"
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer flaky.Close()
+
+	p.config.identityURL = flaky.URL + "/latest/dynamic/instance-identity/document"
+	p.config.signatureURL = flaky.URL + "/latest/dynamic/instance-identity/signature"
+	p.config.tokenURL = flaky.URL + "/latest/api/token"
+
+	token, err := p.GetIdentityTokenWithContext(context.Background(), "foo.local", "https://ca.smallstep.com")
+	assert.FatalError(t, err)
+	assert.NotEquals(t, "", token)
+	// Two requests for the token and the document and two for the token and
+	// the signature.
+	assert.Equals(t, int32(12), atomic.LoadInt32(&calls))
+}
@@ -66,6 +66,23 @@ func MethodFromContext(ctx context.Context) Method {
 	return m
 }
 
+type dryRunKey struct{}
+
+// NewContextWithDryRun creates a new context from ctx that marks the
+// authorization as a dry run. In a dry run, provisioners with replay
+// protection will not mark the token as used, and the SAN resolver, the
+// webhooks and other external services that only add data to the certificate
+// are not called.
+func NewContextWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// DryRunFromContext returns if the authorization in ctx is a dry run.
+func DryRunFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
+
 type tokenKey struct{}
 
 // NewContextWithToken creates a new context with the given token.
@@ -78,3 +95,41 @@ func TokenFromContext(ctx context.Context) (string, bool) {
 	token, ok := ctx.Value(tokenKey{}).(string)
 	return token, ok
 }
+
+type clientAddrKey struct{}
+
+// ClientAddr is the network address of the client of a request. RemoteAddr is
+// the address of the connection and ForwardedFor contains the values of the
+// X-Forwarded-For headers of the request.
+type ClientAddr struct {
+	RemoteAddr   string
+	ForwardedFor []string
+}
+
+// NewContextWithClientAddr creates a new context with the address of the
+// client of the request.
+func NewContextWithClientAddr(ctx context.Context, addr *ClientAddr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// ClientAddrFromContext returns the address of the client stored in the given
+// context.
+func ClientAddrFromContext(ctx context.Context) (*ClientAddr, bool) {
+	addr, ok := ctx.Value(clientAddrKey{}).(*ClientAddr)
+	return addr, ok && addr != nil
+}
+
+type tlsVersionKey struct{}
+
+// NewContextWithTLSVersion creates a new context with the TLS version
+// negotiated in the connection of the request, e.g. tls.VersionTLS13.
+func NewContextWithTLSVersion(ctx context.Context, version uint16) context.Context {
+	return context.WithValue(ctx, tlsVersionKey{}, version)
+}
+
+// TLSVersionFromContext returns the TLS version of the connection stored in
+// the given context.
+func TLSVersionFromContext(ctx context.Context) (uint16, bool) {
+	v, ok := ctx.Value(tlsVersionKey{}).(uint16)
+	return v, ok
+}
@@ -6,6 +6,8 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -36,11 +38,16 @@ const (
 // using XEd25519 defined at
 // https://signal.org/docs/specifications/xeddsa/#xeddsa and implemented by
 // go.step.sm/crypto/x25519.
+//
+// If Groups is set, the X.509 and SSH certificates are only issued to the
+// hosts with a Nebula certificate in at least one of the given groups. By
+// default all the hosts are allowed.
 type Nebula struct {
 	ID      string   `json:"-"`
 	Type    string   `json:"type"`
 	Name    string   `json:"name"`
 	Roots   []byte   `json:"roots"`
+	Groups  []string `json:"groups,omitempty"`
 	Claims  *Claims  `json:"claims,omitempty"`
 	Options *Options `json:"options,omitempty"`
 	caPool  *nebula.NebulaCAPool
@@ -57,6 +64,11 @@ func (p *Nebula) Init(config Config) (err error) {
 	case len(p.Roots) == 0:
 		return errors.New("provisioner root(s) cannot be empty")
 	}
+	for _, g := range p.Groups {
+		if strings.TrimSpace(g) == "" {
+			return errors.New("provisioner groups cannot contain empty values")
+		}
+	}
 
 	p.caPool, err = nebula.NewCAPoolFromBytes(p.Roots)
 	if err != nil {
@@ -110,17 +122,44 @@ func (p *Nebula) GetType() Type {
 	return TypeNebula
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *Nebula) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *Nebula) GetController() *Controller {
+	return p.ctl
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *Nebula) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
 // AuthorizeSign returns the list of SignOption for a Sign request.
-func (p *Nebula) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *Nebula) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
 	crt, claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, err
 	}
+	if err := p.authorizeGroups(crt); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "nebula.AuthorizeSign")
+	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "nebula.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "nebula.AuthorizeSign")
+	}
+
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "nebula.AuthorizeSign")
+	}
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
 
 	sans := claims.SANs
 	if len(sans) == 0 {
@@ -146,7 +185,7 @@ func (p *Nebula) AuthorizeSign(_ context.Context, token string) ([]SignOption, e
 		return nil, err
 	}
 
-	return []SignOption{
+	return append(so,
 		p,
 		templateOptions,
 		// modifiers / withOptions
@@ -163,10 +202,10 @@ func (p *Nebula) AuthorizeSign(_ context.Context, token string) ([]SignOption, e
 			IPs:  crt.Details.Ips,
 		},
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
-	}, nil
+	), nil
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
@@ -180,6 +219,9 @@ func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption
 	if err != nil {
 		return nil, err
 	}
+	if err := p.authorizeGroups(crt); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "nebula.AuthorizeSSHSign")
+	}
 
 	// Default template attributes.
 	keyID := claims.Subject
@@ -251,6 +293,9 @@ func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption
 		return nil, err
 	}
 
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		templateOptions,
@@ -263,7 +308,7 @@ func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil, p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
@@ -369,6 +414,20 @@ func (p *Nebula) authorizeToken(token string, audiences []string) (*nebula.Nebul
 	return c, &claims, nil
 }
 
+// authorizeGroups returns an error if the provisioner has groups and the given
+// Nebula certificate is not in any of them.
+func (p *Nebula) authorizeGroups(crt *nebula.NebulaCertificate) error {
+	if len(p.Groups) == 0 {
+		return nil
+	}
+	for _, g := range crt.Details.Groups {
+		if containsString(p.Groups, g) {
+			return nil
+		}
+	}
+	return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("nebula certificate groups %q are not allowed", crt.Details.Groups))
+}
+
 type nebulaSANsValidator struct {
 	Name string
 	IPs  []*net.IPNet
@@ -275,6 +275,42 @@ func TestNebula_Init(t *testing.T) {
 	}
 }
 
+func TestNebula_Init_groups(t *testing.T) {
+	nc, _ := mustNebulaCA(t)
+	ncPem, err := nc.MarshalToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name    string
+		groups  []string
+		wantErr bool
+	}{
+		{"ok", []string{"servers", "lighthouses"}, false},
+		{"ok empty", nil, false},
+		{"fail empty group", []string{"servers", ""}, true},
+		{"fail blank group", []string{" "}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Nebula{
+				Type:   "Nebula",
+				Name:   "Nebulous",
+				Roots:  ncPem,
+				Groups: tt.groups,
+			}
+			if err := p.Init(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("Nebula.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestNebula_GetID(t *testing.T) {
 	type fields struct {
 		ID   string
@@ -452,6 +488,14 @@ func TestNebula_AuthorizeSign(t *testing.T) {
 		},
 	}
 
+	pGroups, _, _ := mustNebulaProvisioner(t)
+	pGroups.caPool = p.caPool
+	pGroups.Groups = []string{"servers", "test"}
+
+	pOtherGroups, _, _ := mustNebulaProvisioner(t)
+	pOtherGroups.caPool = p.caPool
+	pOtherGroups.Groups = []string{"servers", "lighthouses"}
+
 	type args struct {
 		ctx   context.Context
 		token string
@@ -464,8 +508,10 @@ func TestNebula_AuthorizeSign(t *testing.T) {
 	}{
 		{"ok", p, args{ctx, ok}, false},
 		{"ok no sans", p, args{ctx, okNoSANs}, false},
+		{"ok groups", pGroups, args{ctx, ok}, false},
 		{"fail token", p, args{ctx, "token"}, true},
 		{"fail template", pBadOptions, args{ctx, ok}, true},
+		{"fail groups", pOtherGroups, args{ctx, ok}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -517,6 +563,14 @@ func TestNebula_AuthorizeSSHSign(t *testing.T) {
 		},
 	}
 
+	// Provisioners with groups
+	pGroups, _, _ := mustNebulaProvisioner(t)
+	pGroups.caPool = p.caPool
+	pGroups.Groups = []string{"test"}
+	pOtherGroups, _, _ := mustNebulaProvisioner(t)
+	pOtherGroups.caPool = p.caPool
+	pOtherGroups.Groups = []string{"lighthouses"}
+
 	type args struct {
 		ctx   context.Context
 		token string
@@ -528,6 +582,7 @@ func TestNebula_AuthorizeSSHSign(t *testing.T) {
 		wantErr bool
 	}{
 		{"ok", p, args{ctx, ok}, false},
+		{"ok groups", pGroups, args{ctx, ok}, false},
 		{"ok no options", p, args{ctx, okNoOptions}, false},
 		{"ok with validity", p, args{ctx, okWithValidity}, false},
 		{"fail token", p, args{ctx, "token"}, true},
@@ -535,6 +590,7 @@ func TestNebula_AuthorizeSSHSign(t *testing.T) {
 		{"fail principals", p, args{ctx, failPrincipals}, true},
 		{"fail disabled", pDisabled, args{ctx, ok}, true},
 		{"fail template", pBadOptions, args{ctx, ok}, true},
+		{"fail groups", pOtherGroups, args{ctx, ok}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,14 +1,18 @@
 package provisioner
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -43,13 +47,66 @@ func (c openIDConfiguration) Validate() error {
 // openIDPayload represents the fields on the id_token JWT payload.
 type openIDPayload struct {
 	jose.Claims
-	AtHash          string   `json:"at_hash"`
-	AuthorizedParty string   `json:"azp"`
-	Email           string   `json:"email"`
-	EmailVerified   bool     `json:"email_verified"`
-	Hd              string   `json:"hd"`
-	Nonce           string   `json:"nonce"`
-	Groups          []string `json:"groups"`
+	AtHash          string     `json:"at_hash"`
+	AuthorizedParty string     `json:"azp"`
+	Email           string     `json:"email"`
+	EmailVerified   bool       `json:"email_verified"`
+	Hd              string     `json:"hd"`
+	Nonce           string     `json:"nonce"`
+	Groups          oidcGroups `json:"groups"`
+	// Terraform Cloud and Terraform Enterprise workload identity claims.
+	TerraformOrganizationID string `json:"terraform_organization_id,omitempty"`
+	TerraformWorkspaceName  string `json:"terraform_workspace_name,omitempty"`
+	TerraformRunPhase       string `json:"terraform_run_phase,omitempty"`
+	// GitHub Actions claims.
+	GitHubRepository   string   `json:"repository,omitempty"`
+	GitHubRef          string   `json:"ref,omitempty"`
+	GitHubRefProtected oidcBool `json:"ref_protected,omitempty"`
+}
+
+// oidcGroups is the groups claim of an OIDC token. Some identity providers
+// encode the groups as a space-delimited string instead of an array.
+type oidcGroups []string
+
+// UnmarshalJSON implements json.Unmarshaler and accepts an array of strings or
+// a space-delimited string.
+func (g *oidcGroups) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*g = strings.Fields(s)
+		return nil
+	}
+	var groups []string
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return err
+	}
+	*g = groups
+	return nil
+}
+
+// oidcBool is a boolean claim of an OIDC token. Some identity providers, e.g.
+// GitHub Actions, encode the booleans as the strings "true" or "false".
+type oidcBool bool
+
+// UnmarshalJSON implements json.Unmarshaler and accepts a boolean or a string.
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*b = oidcBool(strings.EqualFold(s, "true"))
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = oidcBool(v)
+	return nil
 }
 
 func (o *openIDPayload) IsAdmin(admins []string) bool {
@@ -78,24 +135,269 @@ func (o *openIDPayload) IsAdmin(admins []string) bool {
 // OIDC represents an OAuth 2.0 OpenID Connect provider.
 //
 // ClientSecret is mandatory, but it can be an empty string.
+//
+// Audiences can be used to accept tokens issued to other clients of the same
+// identity provider. A token is accepted if its aud claim contains the
+// ClientID or one of the Audiences, and if its azp claim, when present, is one
+// of them.
+//
+// TerraformOrganizationIDs, TerraformWorkspaceNames and TerraformRunPhases can
+// be used to restrict the Terraform Cloud or Terraform Enterprise workload
+// identity tokens accepted by the provisioner. If set, the token
+// terraform_organization_id, terraform_workspace_name and terraform_run_phase
+// claims must match one of the configured values.
+//
+// GitHubRepositories, GitHubRefs and GitHubProtectedRefs can be used to restrict
+// the GitHub Actions tokens accepted by the provisioner. If GitHubRepositories is
+// set, the token repository claim, e.g. "smallstep/certificates", must match one
+// of them, case-insensitively, and the repository is the subject of the X.509
+// certificates. If GitHubRefs is set, the ref claim, e.g. "refs/heads/main",
+// must match one of them, and if GitHubProtectedRefs is true, the ref must be
+// protected.
+//
+// Vault can be used to accept the identity tokens issued by HashiCorp Vault,
+// the configuration endpoint is derived from the Vault address, and the
+// subject of the X.509 certificates can be set from the entity metadata in the
+// token. See OIDCVault.
+//
+// ClaimExtensions can be used to copy string claims of the token, e.g. a team
+// identifier, into custom extensions of the X.509 certificates.
+//
+// AllowedGroups can be used to restrict the tokens authorized to sign X.509
+// certificates. If set, the groups in the token must contain one of the allowed
+// groups. The groups are read from the GroupsClaim, "groups" by default, that
+// can be an array or a space-delimited string.
+//
+// AllowedDomains and DeniedDomains can be used to restrict the email domains of
+// the tokens authorized to sign X.509 certificates. If any of them is set, the
+// token must have an email whose domain is not denied and, if AllowedDomains is
+// set, it is allowed. Domains are compared case-insensitively, and denied
+// domains take precedence.
+//
+// RequiredACR and RequiredAMR can be used to require a minimum authentication
+// context, e.g. multi-factor authentication, to sign X.509 and SSH
+// certificates. If RequiredACR is set, the acr claim of the token must be one
+// of its values. If RequiredAMR is set, the amr claim of the token must
+// contain all of its values, e.g. "mfa". Tokens without the claims are
+// rejected.
+//
+// AdditionalConfigurationEndpoints can be used to accept tokens from other
+// issuers, e.g. while migrating to a new identity provider. Each endpoint has
+// its own key set, and a token is validated with the key set of the issuer in
+// its iss claim.
+//
+// SSHPrincipals can be used to set the principals of the SSH user certificates
+// of non-admin users from a claim of the token, e.g. preferred_username,
+// instead of using the ones returned by the identity function.
+//
+// UserPrincipalName can be used to add a Microsoft UPN otherName SAN to the
+// X.509 certificates from a claim of the token, for the smart card logon in
+// Active Directory. See OIDCUserPrincipalName.
+//
+// CommonName can be used to set the common name and the first DNS name of the
+// X.509 certificates from a template over the claims of the token, e.g.
+// "{{ .email }}" or "{{ .sub }}@devices". If DisableCustomSANs is true, the
+// value of the template is the only SAN allowed in the certificate.
+//
+// If Ephemeral is true, the provisioner issues short-lived X.509 certificates
+// that bind a key to the identity in the token, like Fulcio does. The
+// certificates are valid for DefaultEphemeralCertDuration, or less if
+// maxTLSCertDuration is lower, their SANs are the verified email and the
+// iss#sub URI, and they cannot be renewed.
+//
+// If StrictIdentity is true, the X.509 CSRs of non-admin users can only contain
+// the subject, the email, the iss#sub URI, or the value of the CommonName
+// template of the token. By default it is disabled.
+//
+// If ProofOfPossession is set, the X.509 sign tokens must include a nonce
+// issued by the provisioner signed with the key of the CSR.
 type OIDC struct {
 	*base
-	ID                    string   `json:"-"`
-	Type                  string   `json:"type"`
-	Name                  string   `json:"name"`
-	ClientID              string   `json:"clientID"`
-	ClientSecret          string   `json:"clientSecret"`
-	ConfigurationEndpoint string   `json:"configurationEndpoint"`
-	TenantID              string   `json:"tenantID,omitempty"`
-	Admins                []string `json:"admins,omitempty"`
-	Domains               []string `json:"domains,omitempty"`
-	Groups                []string `json:"groups,omitempty"`
-	ListenAddress         string   `json:"listenAddress,omitempty"`
-	Claims                *Claims  `json:"claims,omitempty"`
-	Options               *Options `json:"options,omitempty"`
-	configuration         openIDConfiguration
-	keyStore              *keyStore
-	ctl                   *Controller
+	ID                               string                    `json:"-"`
+	Type                             string                    `json:"type"`
+	Name                             string                    `json:"name"`
+	ClientID                         string                    `json:"clientID"`
+	ClientSecret                     string                    `json:"clientSecret"`
+	Audiences                        []string                  `json:"audiences,omitempty"`
+	ConfigurationEndpoint            string                    `json:"configurationEndpoint"`
+	AdditionalConfigurationEndpoints []string                  `json:"additionalConfigurationEndpoints,omitempty"`
+	TenantID                         string                    `json:"tenantID,omitempty"`
+	Admins                           []string                  `json:"admins,omitempty"`
+	Domains                          []string                  `json:"domains,omitempty"`
+	Groups                           []string                  `json:"groups,omitempty"`
+	ListenAddress                    string                    `json:"listenAddress,omitempty"`
+	TerraformOrganizationIDs         []string                  `json:"terraformOrganizationIDs,omitempty"`
+	TerraformWorkspaceNames          []string                  `json:"terraformWorkspaceNames,omitempty"`
+	TerraformRunPhases               []string                  `json:"terraformRunPhases,omitempty"`
+	GitHubRepositories               []string                  `json:"githubRepositories,omitempty"`
+	GitHubRefs                       []string                  `json:"githubRefs,omitempty"`
+	GitHubProtectedRefs              bool                      `json:"githubProtectedRefs,omitempty"`
+	Vault                            *OIDCVault                `json:"vault,omitempty"`
+	AllowedTokenAlgorithms           []string                  `json:"allowedTokenAlgorithms,omitempty"`
+	ClaimExtensions                  []OIDCClaimExtension      `json:"claimExtensions,omitempty"`
+	AllowedGroups                    []string                  `json:"allowedGroups,omitempty"`
+	GroupsClaim                      string                    `json:"groupsClaim,omitempty"`
+	AllowedDomains                   []string                  `json:"allowedDomains,omitempty"`
+	DeniedDomains                    []string                  `json:"deniedDomains,omitempty"`
+	RequiredACR                      []string                  `json:"requiredACR,omitempty"`
+	RequiredAMR                      []string                  `json:"requiredAMR,omitempty"`
+	Ephemeral                        bool                      `json:"ephemeral,omitempty"`
+	SSHPrincipals                    *OIDCSSHPrincipals        `json:"sshPrincipals,omitempty"`
+	CommonName                       *OIDCCommonName           `json:"commonName,omitempty"`
+	UserPrincipalName                *OIDCUserPrincipalName    `json:"userPrincipalName,omitempty"`
+	StrictIdentity                   bool                      `json:"strictIdentity,omitempty"`
+	EmailNormalization               EmailNormalization        `json:"emailNormalization,omitempty"`
+	ProofOfPossession                *ProofOfPossessionOptions `json:"proofOfPossession,omitempty"`
+	Claims                           *Claims                   `json:"claims,omitempty"`
+	Options                          *Options                  `json:"options,omitempty"`
+	configuration                    openIDConfiguration
+	keyStore                         *keyStore
+	issuers                          []*oidcIssuer
+	ctl                              *Controller
+}
+
+// DefaultEphemeralCertDuration is the duration of the X.509 certificates issued
+// by an OIDC provisioner in ephemeral mode.
+const DefaultEphemeralCertDuration = 10 * time.Minute
+
+// OIDCClaimExtension maps a claim of the OIDC token to a custom extension in the
+// X.509 certificate. The claim must be a string, and it's encoded as an ASN.1
+// UTF8String. If Required is true, a token without the claim is rejected, by
+// default the extension is skipped.
+type OIDCClaimExtension struct {
+	Claim    string                    `json:"claim"`
+	OID      x509util.ObjectIdentifier `json:"oid"`
+	Required bool                      `json:"required,omitempty"`
+}
+
+// OIDCSSHPrincipals maps a claim of the OIDC token to the principals of the SSH
+// user certificates. The claim can be a string or an array of strings, and
+// each value is added as a principal with the given Prefix and Suffix. A token
+// without the claim is rejected. If AllowCustomPrincipals is true, a request
+// can select some of those principals, by default the requested principals
+// are ignored and the certificate gets all of them.
+type OIDCSSHPrincipals struct {
+	Claim                 string `json:"claim"`
+	Prefix                string `json:"prefix,omitempty"`
+	Suffix                string `json:"suffix,omitempty"`
+	AllowCustomPrincipals bool   `json:"allowCustomPrincipals,omitempty"`
+}
+
+// OIDCCommonName sets the common name of the X.509 certificates from a template
+// over the claims of the OIDC token, e.g. "{{ .email }}". A token without one
+// of the claims used in the template is rejected. The common name is also added
+// as a SAN of the type it parses as, an IP address, a URI, an email address or
+// a DNS name. If DisableCustomSANs is true, it's the only SAN of the
+// certificate, by default it's added to the other SANs.
+type OIDCCommonName struct {
+	Template          string `json:"template"`
+	DisableCustomSANs bool   `json:"disableCustomSANs,omitempty"`
+	template          *template.Template
+}
+
+// EmailNormalization defines how the email of an OIDC token is normalized
+// before it's added to an X.509 certificate.
+type EmailNormalization string
+
+const (
+	// EmailNormalizationDomain lowercases only the domain part of the email.
+	// It's the default.
+	EmailNormalizationDomain EmailNormalization = "domain"
+	// EmailNormalizationLowercase lowercases the whole email.
+	EmailNormalizationLowercase EmailNormalization = "lowercase"
+	// EmailNormalizationNone uses the email as it is in the token.
+	EmailNormalizationNone EmailNormalization = "none"
+)
+
+// Validate returns an error if the normalization is not supported.
+func (n EmailNormalization) Validate() error {
+	switch n {
+	case "", EmailNormalizationDomain, EmailNormalizationLowercase, EmailNormalizationNone:
+		return nil
+	default:
+		return errors.Errorf("unsupported emailNormalization %q", n)
+	}
+}
+
+// normalize returns the email normalized.
+func (n EmailNormalization) normalize(email string) string {
+	switch n {
+	case EmailNormalizationNone:
+		return email
+	case EmailNormalizationLowercase:
+		return strings.ToLower(email)
+	default:
+		return sanitizeEmail(email)
+	}
+}
+
+// validateClaimExtensions returns an error if a claim extension does not have a
+// claim or an id, or if the id is duplicated or reserved.
+func validateClaimExtensions(exts []OIDCClaimExtension) error {
+	for i, e := range exts {
+		switch {
+		case e.Claim == "":
+			return errors.New("claimExtensions claim cannot be empty")
+		case len(e.OID) == 0:
+			return errors.Errorf("claimExtensions oid for claim %q cannot be empty", e.Claim)
+		case hasOIDPrefix(asn1.ObjectIdentifier(e.OID), StepOIDRoot):
+			return errors.Errorf("claimExtensions oid %s is reserved", asn1.ObjectIdentifier(e.OID))
+		}
+		for _, ee := range exts[:i] {
+			if ee.OID.Equal(e.OID) {
+				return errors.Errorf("claimExtensions oid %s is duplicated", asn1.ObjectIdentifier(e.OID))
+			}
+		}
+	}
+	return nil
+}
+
+// validateEmailDomains returns an error if a domain in the given option is
+// empty or contains an @.
+func validateEmailDomains(name string, domains []string) error {
+	for _, d := range domains {
+		switch {
+		case d == "":
+			return errors.Errorf("%s cannot contain empty values", name)
+		case strings.Contains(d, "@"):
+			return errors.Errorf("%s %q is not a valid domain", name, d)
+		}
+	}
+	return nil
+}
+
+// validateAdmins returns an error if an entry in the given list of admins is
+// empty or, if it contains an @, it's not a valid email. Entries without an @
+// are group names.
+func validateAdmins(admins []string) error {
+	for _, a := range admins {
+		switch {
+		case strings.TrimSpace(a) == "":
+			return errors.New("admins cannot contain empty values")
+		case strings.Contains(a, "@"):
+			i := strings.LastIndex(a, "@")
+			if i == 0 || i == len(a)-1 || strings.ContainsAny(a, " \t\n") {
+				return errors.Errorf("admins %q is not a valid email", a)
+			}
+		}
+	}
+	return nil
+}
+
+// validateGitHubRepositories returns an error if a repository in the given
+// list is not in the owner/name format.
+func validateGitHubRepositories(repos []string) error {
+	for _, r := range repos {
+		owner, name, ok := strings.Cut(r, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return errors.Errorf("githubRepositories %q is not valid, must be owner/name", r)
+		}
+	}
+	return nil
+}
+
+func hasOIDPrefix(oid, prefix asn1.ObjectIdentifier) bool {
+	return len(oid) >= len(prefix) && oid[:len(prefix)].Equal(prefix)
 }
 
 func sanitizeEmail(email string) string {
@@ -149,6 +451,23 @@ func (o *OIDC) GetType() Type {
 	return TypeOIDC
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (o *OIDC) GetClaimer() *Claimer {
+	return o.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (o *OIDC) GetController() *Controller {
+	return o.ctl
+}
+
+// GetCapabilities returns the certificates the provisioner can issue for
+// non-admin users.
+func (o *OIDC) GetCapabilities() *Capabilities {
+	// Only admins can request custom SANs and SSH host certificates.
+	return newCapabilities(o.ctl.GetClaimer(), true, false)
+}
+
 // GetEncryptedKey is not available in an OIDC provisioner.
 func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
@@ -156,67 +475,213 @@ func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 
 // Init validates and initializes the OIDC provider.
 func (o *OIDC) Init(config Config) (err error) {
-	switch {
-	case o.Type == "":
-		return errors.New("type cannot be empty")
-	case o.Name == "":
-		return errors.New("name cannot be empty")
-	case o.ClientID == "":
-		return errors.New("clientID cannot be empty")
-	case o.ConfigurationEndpoint == "":
-		return errors.New("configurationEndpoint cannot be empty")
+	var v configValidator
+	v.check(o.Type == "", "type", "type cannot be empty")
+	v.check(o.Name == "", "name", "name cannot be empty")
+	v.check(o.ClientID == "", "clientID", "clientID cannot be empty")
+	v.check(o.ConfigurationEndpoint == "" && o.Vault == nil, "configurationEndpoint", "configurationEndpoint cannot be empty")
+	v.check(o.ConfigurationEndpoint != "" && o.Vault != nil, "configurationEndpoint", "configurationEndpoint cannot be used with vault")
+	v.check(o.Vault != nil && len(o.GitHubRepositories) > 0, "vault", "vault cannot be used with githubRepositories")
+	v.check(containsString(o.AdditionalConfigurationEndpoints, ""), "additionalConfigurationEndpoints", "additionalConfigurationEndpoints cannot contain empty values")
+	v.check(o.Audiences != nil && len(o.Audiences) == 0, "audiences", "audiences cannot be empty")
+	v.check(containsString(o.Audiences, ""), "audiences", "audiences cannot contain empty values")
+	v.check(containsString(o.AllowedGroups, ""), "allowedGroups", "allowedGroups cannot contain empty values")
+	v.check(o.GroupsClaim != "" && len(o.AllowedGroups) == 0, "groupsClaim", "groupsClaim requires allowedGroups")
+	v.check(containsString(o.RequiredACR, ""), "requiredACR", "requiredACR cannot contain empty values")
+	v.check(containsString(o.RequiredAMR, ""), "requiredAMR", "requiredAMR cannot contain empty values")
+	v.check(o.SSHPrincipals != nil && o.SSHPrincipals.Claim == "", "sshPrincipals", "sshPrincipals claim cannot be empty")
+	v.check(o.CommonName != nil && o.Ephemeral, "commonName", "commonName cannot be used with ephemeral")
+	v.check(o.CommonName != nil && o.Options.GetX509Options().IsCommonNameForbidden(), "commonName", "commonName cannot be used with x509.forbidCommonName")
+	v.add("admins", validateAdmins(o.Admins))
+	v.add("proofOfPossession", o.ProofOfPossession.init())
+	v.add("allowedDomains", validateEmailDomains("allowedDomains", o.AllowedDomains))
+	v.add("deniedDomains", validateEmailDomains("deniedDomains", o.DeniedDomains))
+	v.add("emailNormalization", o.EmailNormalization.Validate())
+
+	// Validate terraformRunPhases if given
+	for _, phase := range o.TerraformRunPhases {
+		if phase != "plan" && phase != "apply" {
+			v.add("terraformRunPhases", errors.Errorf("terraformRunPhases %q is not valid, must be plan or apply", phase))
+		}
+	}
+
+	v.add("githubRepositories", validateGitHubRepositories(o.GitHubRepositories))
+	v.check(containsString(o.GitHubRefs, ""), "githubRefs", "githubRefs cannot contain empty values")
+	v.check(len(o.GitHubRefs) > 0 && len(o.GitHubRepositories) == 0, "githubRefs", "githubRefs requires githubRepositories")
+	v.check(o.GitHubProtectedRefs && len(o.GitHubRepositories) == 0, "githubProtectedRefs", "githubProtectedRefs requires githubRepositories")
+
+	v.add("vault", o.Vault.init())
+	v.add("userPrincipalName", o.UserPrincipalName.init())
+	v.add("allowedTokenAlgorithms", validateTokenAlgorithms(o.AllowedTokenAlgorithms))
+	v.add("claimExtensions", validateClaimExtensions(o.ClaimExtensions))
+
+	if o.CommonName != nil {
+		if strings.TrimSpace(o.CommonName.Template) == "" {
+			v.add("commonName", errors.New("commonName template cannot be empty"))
+		} else if o.CommonName.template, err = template.New("commonName").Option("missingkey=error").Parse(o.CommonName.Template); err != nil {
+			v.add("commonName", errors.Wrap(err, "error parsing commonName template"))
+		}
 	}
 
 	// Validate listenAddress if given
 	if o.ListenAddress != "" {
 		if _, _, err := net.SplitHostPort(o.ListenAddress); err != nil {
-			return errors.Wrap(err, "error parsing listenAddress")
+			v.add("listenAddress", errors.Wrap(err, "error parsing listenAddress"))
 		}
 	}
+	if err := v.err(); err != nil {
+		return err
+	}
 
 	// Decode and validate openid-configuration endpoint
-	u, err := url.Parse(o.ConfigurationEndpoint)
+	if o.configuration, err = o.getConfiguration(o.getConfigurationEndpoint()); err != nil {
+		return err
+	}
+	// Get JWK key set
+	o.keyStore, err = newKeyStore(o.configuration.JWKSetURI)
+	if err != nil {
+		return err
+	}
+
+	// Decode the additional endpoints, each one with its own key set.
+	o.issuers = make([]*oidcIssuer, 0, len(o.AdditionalConfigurationEndpoints))
+	for _, endpoint := range o.AdditionalConfigurationEndpoints {
+		configuration, err := o.getConfiguration(endpoint)
+		if err != nil {
+			return err
+		}
+		if o.getIssuer(configuration.Issuer) != nil {
+			return errors.Errorf("issuer %s of %s is duplicated", configuration.Issuer, endpoint)
+		}
+		ks, err := newKeyStore(configuration.JWKSetURI)
+		if err != nil {
+			return err
+		}
+		o.issuers = append(o.issuers, &oidcIssuer{
+			configuration: configuration,
+			keyStore:      ks,
+		})
+	}
+
+	o.ctl, err = NewController(o, o.Claims, config, o.Options)
+	return
+}
+
+// oidcIssuer is an additional issuer accepted by an OIDC provisioner.
+type oidcIssuer struct {
+	configuration openIDConfiguration
+	keyStore      *keyStore
+}
+
+// getConfigurationEndpoint returns the configuration endpoint of the
+// provisioner, the Vault one if the provisioner accepts Vault tokens.
+func (o *OIDC) getConfigurationEndpoint() string {
+	if o.Vault != nil {
+		return o.Vault.configurationEndpoint()
+	}
+	return o.ConfigurationEndpoint
+}
+
+// getConfiguration gets and validates the openid-configuration document in
+// the given endpoint.
+func (o *OIDC) getConfiguration(endpoint string) (openIDConfiguration, error) {
+	return o.getConfigurationContext(context.Background(), endpoint)
+}
+
+// getConfigurationContext is like getConfiguration, but it uses the given
+// context and it fails if the endpoint does not respond successfully.
+func (o *OIDC) getConfigurationContext(ctx context.Context, endpoint string) (openIDConfiguration, error) {
+	var configuration openIDConfiguration
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return errors.Wrapf(err, "error parsing %s", o.ConfigurationEndpoint)
+		return configuration, errors.Wrapf(err, "error parsing %s", endpoint)
 	}
 	if !strings.Contains(u.Path, "/.well-known/openid-configuration") {
 		u.Path = path.Join(u.Path, "/.well-known/openid-configuration")
 	}
-	if err := getAndDecode(u.String(), &o.configuration); err != nil {
-		return err
+	if err := getAndDecodeContext(ctx, u.String(), &configuration); err != nil {
+		return configuration, err
 	}
-	if err := o.configuration.Validate(); err != nil {
-		return errors.Wrapf(err, "error parsing %s", o.ConfigurationEndpoint)
+	if err := configuration.Validate(); err != nil {
+		return configuration, errors.Wrapf(err, "error parsing %s", endpoint)
 	}
 	// Replace {tenantid} with the configured one
 	if o.TenantID != "" {
-		o.configuration.Issuer = strings.ReplaceAll(o.configuration.Issuer, "{tenantid}", o.TenantID)
+		configuration.Issuer = strings.ReplaceAll(configuration.Issuer, "{tenantid}", o.TenantID)
 	}
-	// Get JWK key set
-	o.keyStore, err = newKeyStore(o.configuration.JWKSetURI)
-	if err != nil {
-		return err
+	return configuration, nil
+}
+
+// Check verifies that the configuration endpoints of the provisioner are
+// reachable and that their key sets have at least one key.
+func (o *OIDC) Check(ctx context.Context) error {
+	endpoints := append([]string{o.getConfigurationEndpoint()}, o.AdditionalConfigurationEndpoints...)
+	for _, endpoint := range endpoints {
+		configuration, err := o.getConfigurationContext(ctx, endpoint)
+		if err != nil {
+			return err
+		}
+		if err := checkKeySet(ctx, configuration.JWKSetURI); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	o.ctl, err = NewController(o, o.Claims, config, o.Options)
-	return
+// getIssuer returns the configuration and the key set of the given issuer.
+// It returns nil if the issuer is not accepted by the provisioner.
+func (o *OIDC) getIssuer(issuer string) *oidcIssuer {
+	if issuer == o.configuration.Issuer {
+		return &oidcIssuer{
+			configuration: o.configuration,
+			keyStore:      o.keyStore,
+		}
+	}
+	for _, iss := range o.issuers {
+		if issuer == iss.configuration.Issuer {
+			return iss
+		}
+	}
+	return nil
+}
+
+// acceptedAudiences returns the ClientID and the configured Audiences.
+func (o *OIDC) acceptedAudiences() []string {
+	return append([]string{o.ClientID}, o.Audiences...)
 }
 
 // ValidatePayload validates the given token payload.
 func (o *OIDC) ValidatePayload(p openIDPayload) error {
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
 	// than a few minutes.
+	// The token can be issued by any of the accepted issuers.
+	issuer := o.configuration.Issuer
+	if iss := o.getIssuer(p.Issuer); iss != nil {
+		issuer = iss.configuration.Issuer
+	}
 	if err := p.ValidateWithLeeway(jose.Expected{
-		Issuer:   o.configuration.Issuer,
-		Audience: jose.Audience{o.ClientID},
-		Time:     time.Now().UTC(),
+		Issuer: issuer,
+		Time:   time.Now().UTC(),
 	}, time.Minute); err != nil {
-		return errs.Wrap(http.StatusUnauthorized, err, "validatePayload: failed to validate oidc token payload")
+		return authorizeErr(validationReason(err), errs.Wrap(http.StatusUnauthorized, err, "validatePayload: failed to validate oidc token payload"))
+	}
+
+	// Validate audience, at least one of the accepted ones must be present
+	audiences := o.acceptedAudiences()
+	var found bool
+	for _, aud := range audiences {
+		if p.Audience.Contains(aud) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return authorizeErr(ReasonInvalidAudience, errs.Wrap(http.StatusUnauthorized, jose.ErrInvalidAudience, "validatePayload: failed to validate oidc token payload"))
 	}
 
 	// Validate azp if present
-	if p.AuthorizedParty != "" && p.AuthorizedParty != o.ClientID {
-		return errs.Unauthorized("validatePayload: failed to validate oidc token payload: invalid azp")
+	if p.AuthorizedParty != "" && !containsString(audiences, p.AuthorizedParty) {
+		return authorizeErr(ReasonInvalidAudience, errs.Unauthorized("validatePayload: failed to validate oidc token payload: invalid azp"))
 	}
 
 	// Validate domains (case-insensitive)
@@ -230,7 +695,7 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 			}
 		}
 		if !found {
-			return errs.Unauthorized("validatePayload: failed to validate oidc token payload: email %q is not allowed", p.Email)
+			return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("validatePayload: failed to validate oidc token payload: email %q is not allowed", p.Email))
 		}
 	}
 
@@ -246,32 +711,70 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 			}
 		}
 		if !found {
-			return errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid group")
+			return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid group"))
 		}
 	}
 
+	// Filter by Terraform workload identity claims
+	if len(o.TerraformOrganizationIDs) > 0 && !containsString(o.TerraformOrganizationIDs, p.TerraformOrganizationID) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid terraform_organization_id %q", p.TerraformOrganizationID))
+	}
+	if len(o.TerraformWorkspaceNames) > 0 && !containsString(o.TerraformWorkspaceNames, p.TerraformWorkspaceName) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid terraform_workspace_name %q", p.TerraformWorkspaceName))
+	}
+	if len(o.TerraformRunPhases) > 0 && !containsString(o.TerraformRunPhases, p.TerraformRunPhase) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid terraform_run_phase %q", p.TerraformRunPhase))
+	}
+
+	// Filter by GitHub Actions claims
+	if len(o.GitHubRepositories) > 0 && !containsStringFold(o.GitHubRepositories, p.GitHubRepository) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid repository %q", p.GitHubRepository))
+	}
+	if len(o.GitHubRefs) > 0 && !containsString(o.GitHubRefs, p.GitHubRef) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid ref %q", p.GitHubRef))
+	}
+	if o.GitHubProtectedRefs && !bool(p.GitHubRefProtected) {
+		return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("validatePayload: oidc token payload validation failed: ref %q is not protected", p.GitHubRef))
+	}
+
+	// Vault identity tokens are always issued to an entity.
+	if o.Vault != nil && p.Subject == "" {
+		return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("validatePayload: oidc token payload validation failed: vault token does not have an entity"))
+	}
+
 	return nil
 }
 
 // authorizeToken applies the most common provisioner authorization claims,
 // leaving the rest to context specific methods.
-func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
+func (o *OIDC) authorizeToken(ctx context.Context, token string) (*openIDPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err,
-			"oidc.AuthorizeToken; error parsing oidc token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err,
+			"oidc.AuthorizeToken; error parsing oidc token"))
+	}
+	if err := checkTokenAlgorithm(jwt, o.AllowedTokenAlgorithms); err != nil {
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err,
+			"oidc.AuthorizeToken; invalid oidc token"))
 	}
 
 	// Parse claims to get the kid
 	var claims openIDPayload
 	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err,
-			"oidc.AuthorizeToken; error parsing oidc token claims")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err,
+			"oidc.AuthorizeToken; error parsing oidc token claims"))
+	}
+
+	// Use the key set of the issuer of the token, the issuer is validated
+	// later with the rest of the payload.
+	ks := o.keyStore
+	if iss := o.getIssuer(claims.Issuer); iss != nil {
+		ks = iss.keyStore
 	}
 
 	found := false
 	kid := jwt.Headers[0].KeyID
-	keys := o.keyStore.Get(kid)
+	keys := ks.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key, &claims); err == nil {
 			found = true
@@ -279,7 +782,7 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 		}
 	}
 	if !found {
-		return nil, errs.Unauthorized("oidc.AuthorizeToken; cannot validate oidc token")
+		return nil, authorizeErr(ReasonUnknownKey, errs.Unauthorized("oidc.AuthorizeToken; cannot validate oidc token"))
 	}
 
 	if err := o.ValidatePayload(claims); err != nil {
@@ -292,8 +795,8 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 // Only tokens generated by an admin have the right to revoke a certificate.
-func (o *OIDC) AuthorizeRevoke(_ context.Context, token string) error {
-	claims, err := o.authorizeToken(token)
+func (o *OIDC) AuthorizeRevoke(ctx context.Context, token string) error {
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeRevoke")
 	}
@@ -306,17 +809,75 @@ func (o *OIDC) AuthorizeRevoke(_ context.Context, token string) error {
 	return errs.Unauthorized("oidc.AuthorizeRevoke; cannot revoke with non-admin oidc token")
 }
 
+// NewProofOfPossessionNonce implements ProofOfPossessionNoncer and returns a
+// nonce to prove the possession of the CSR key.
+func (o *OIDC) NewProofOfPossessionNonce() (string, time.Time, error) {
+	return o.ProofOfPossession.newNonce()
+}
+
 // AuthorizeSign validates the given token.
-func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
-	claims, err := o.authorizeToken(token)
+func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := o.authorizeToken(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	if err := o.authorizeGroups(token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	if err := o.authorizeEmailDomain(claims); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	if err := o.authorizeAuthenticationContext(token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	if err := o.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	if err := o.ctl.allowRequest(ctx, claims.Subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+
+	// Add the subject alternative names of the SAN resolver.
+	so, err := o.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "oidc.AuthorizeSign")
+	}
+	so = append(so, o.ctl.newX509SignOptions()...)
+	so = append(so, o.ctl.newTokenHashOptions(token)...)
+
+	// Require the proof of possession of the CSR key if configured.
+	popOptions, err := o.ProofOfPossession.newOptions(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "oidc.AuthorizeSign")
+	}
+	so = append(so, popOptions...)
+
+	// Add the custom extensions with the mapped claims.
+	extOptions, err := o.newClaimExtensionsOptions(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	so = append(so, extOptions...)
+
+	// Add the user principal name in the mapped claim.
+	upnOptions, err := o.UserPrincipalName.newOptions(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
+	so = append(so, upnOptions...)
+
+	// Set the common name from the claims.
+	cnOptions, err := o.newCommonNameOptions(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
+	so = append(so, cnOptions...)
 
 	// Certificate templates
 	sans := []string{}
-	if claims.Email != "" {
-		sans = append(sans, claims.Email)
+	email := o.EmailNormalization.normalize(claims.Email)
+	if email != "" && (!o.Ephemeral || claims.EmailVerified) {
+		sans = append(sans, email)
 	}
 
 	// Add uri SAN with iss#sub if issuer is a URL with schema.
@@ -330,15 +891,47 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 		sans = append(sans, iss.String())
 	}
 
-	data := x509util.CreateTemplateData(claims.Subject, sans)
+	// GitHub Actions certificates are issued to the repository.
+	subject := claims.Subject
+	if len(o.GitHubRepositories) > 0 {
+		subject = claims.GitHubRepository
+	}
+
+	// Vault certificates can be issued to the entity metadata.
+	if o.Vault != nil {
+		if subject, err = o.Vault.getSubject(token, claims); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+		}
+	}
+
+	data := x509util.CreateTemplateData(subject, sans)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
 
+	// Reject the CSRs with names that are not part of the token identity.
+	// Admins can request any name.
+	if o.StrictIdentity && !claims.IsAdmin(o.Admins) {
+		commonNames := []string{claims.Subject, subject}
+		allowedSANs := append([]string{}, sans...)
+		// The request can still use the email as it is in the token.
+		if email != claims.Email && containsString(sans, email) {
+			allowedSANs = append(allowedSANs, claims.Email)
+		}
+		for _, opt := range cnOptions {
+			if m, ok := opt.(commonNameSANModifier); ok {
+				commonNames = append(commonNames, m.Name)
+				allowedSANs = append(allowedSANs, m.Name)
+			}
+		}
+		so = append(so, newStrictIdentityValidator(commonNames, allowedSANs))
+	}
+
 	// Use the default template unless no-templates are configured and email is
-	// an admin, in that case we will use the CR template.
+	// an admin, in that case we will use the CR template. Ephemeral
+	// certificates only contain the identity in the token.
 	defaultTemplate := x509util.DefaultLeafTemplate
-	if !o.Options.GetX509Options().HasTemplate() && claims.IsAdmin(o.Admins) {
+	if !o.Ephemeral && !o.Options.GetX509Options().HasTemplate() && claims.IsAdmin(o.Admins) {
 		defaultTemplate = x509util.DefaultAdminLeafTemplate
 	}
 
@@ -347,35 +940,275 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
 
-	return []SignOption{
+	// Ephemeral certificates have a fixed short duration.
+	defaultDuration := o.ctl.Claimer.DefaultTLSCertDuration()
+	validity := o.ctl.newValidityValidator()
+	if o.Ephemeral {
+		defaultDuration = o.ephemeralCertDuration()
+		validity.max = defaultDuration
+		if validity.min > defaultDuration {
+			validity.min = defaultDuration
+		}
+	}
+
+	return append(so,
 		o,
 		templateOptions,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID).WithControllerOptions(o.ctl),
-		profileDefaultDuration(o.ctl.Claimer.DefaultTLSCertDuration()),
+		profileDefaultDuration(defaultDuration),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(o.ctl.Claimer.MinTLSCertDuration(), o.ctl.Claimer.MaxTLSCertDuration()),
+		validity,
 		newX509NamePolicyValidator(o.ctl.getPolicy().getX509()),
 		// webhooks
 		o.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	), nil
+}
+
+// newClaimExtensionsOptions returns the SignOption that adds the configured
+// claims of the token as certificate extensions. The token must be validated
+// before calling this method.
+func (o *OIDC) newClaimExtensionsOptions(token string) ([]SignOption, error) {
+	if len(o.ClaimExtensions) == 0 {
+		return nil, nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+
+	var exts extensionsModifier
+	for _, e := range o.ClaimExtensions {
+		v, ok := claims[e.Claim]
+		if !ok || v == nil {
+			if e.Required {
+				return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claim %q", e.Claim))
+			}
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim %q is not a string", e.Claim))
+		}
+		value, err := asn1.MarshalWithParams(s, "utf8")
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "error marshaling claim %q", e.Claim)
+		}
+		exts = append(exts, pkix.Extension{
+			Id:    asn1.ObjectIdentifier(e.OID),
+			Value: value,
+		})
+	}
+	if len(exts) == 0 {
+		return nil, nil
+	}
+	return []SignOption{exts}, nil
+}
+
+// newCommonNameOptions returns the SignOptions that set the common name and the
+// first DNS name of the certificate using the commonName template. If custom
+// SANs are disabled, the request can only contain that name. The token must be
+// validated before calling this method.
+func (o *OIDC) newCommonNameOptions(ctx context.Context, token string) ([]SignOption, error) {
+	if o.CommonName == nil {
+		return nil, nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+	// Use the same email than the SANs.
+	if email, ok := claims["email"].(string); ok {
+		claims["email"] = o.EmailNormalization.normalize(email)
+	}
+
+	var buf bytes.Buffer
+	if err := o.CommonName.template.Execute(&buf, claims); err != nil {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claims of the commonName template: %v", err))
+	}
+	cn := strings.TrimSpace(buf.String())
+	if cn == "" {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claims result in an empty commonName"))
+	}
+
+	m := commonNameSANModifier{Name: cn, Only: o.CommonName.DisableCustomSANs}
+	if !m.Only {
+		return []SignOption{m}, nil
+	}
+	dnsNames, ips, emails, uris := x509util.SplitSANs([]string{cn})
+	return []SignOption{
+		m,
+		dnsNamesValidator(dnsNames),
+		ipAddressesValidator(ips),
+		emailAddressesValidator(emails),
+		newURIsValidator(ctx, uris),
 	}, nil
 }
 
+// authorizeGroups returns an error if the provisioner has allowed groups and
+// the groups claim of the token does not contain any of them.
+func (o *OIDC) authorizeGroups(token string) error {
+	if len(o.AllowedGroups) == 0 {
+		return nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+
+	name := o.GroupsClaim
+	if name == "" {
+		name = "groups"
+	}
+	var groups []string
+	switch v := claims[name].(type) {
+	case string:
+		groups = strings.Fields(v)
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	for _, g := range groups {
+		if containsString(o.AllowedGroups, g) {
+			return nil
+		}
+	}
+	return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim %q does not contain an allowed group", name))
+}
+
+// authorizeAuthenticationContext returns an error if the provisioner requires
+// an authentication context and the acr claim of the token is not one of the
+// required values, or the amr claim does not contain all the required methods.
+func (o *OIDC) authorizeAuthenticationContext(token string) error {
+	if len(o.RequiredACR) == 0 && len(o.RequiredAMR) == 0 {
+		return nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+
+	if len(o.RequiredACR) > 0 {
+		acr, _ := claims["acr"].(string)
+		if acr == "" {
+			return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claim \"acr\""))
+		}
+		if !containsString(o.RequiredACR, acr) {
+			return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim \"acr\" %q is not allowed", acr))
+		}
+	}
+
+	if len(o.RequiredAMR) > 0 {
+		var methods []string
+		if v, ok := claims["amr"].([]interface{}); ok {
+			for _, m := range v {
+				if s, ok := m.(string); ok {
+					methods = append(methods, s)
+				}
+			}
+		}
+		if len(methods) == 0 {
+			return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claim \"amr\""))
+		}
+		for _, m := range o.RequiredAMR {
+			if !containsString(methods, m) {
+				return authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim \"amr\" does not contain %q", m))
+			}
+		}
+	}
+	return nil
+}
+
+// getSSHPrincipals returns the SSH principals defined by the sshPrincipals
+// claim of the token. The token must be validated before calling this method.
+func (o *OIDC) getSSHPrincipals(token string) ([]string, error) {
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+
+	var values []string
+	switch v := claims[o.SSHPrincipals.Claim].(type) {
+	case string:
+		if v != "" {
+			values = append(values, v)
+		}
+	case []interface{}:
+		for _, vv := range v {
+			if s, ok := vv.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claim %q", o.SSHPrincipals.Claim))
+	}
+
+	principals := make([]string, len(values))
+	for i, v := range values {
+		principals[i] = o.SSHPrincipals.Prefix + v + o.SSHPrincipals.Suffix
+	}
+	return principals, nil
+}
+
+// authorizeEmailDomain returns an error if the provisioner has allowed or
+// denied domains and the email in the token is missing, its domain is denied,
+// or it is not one of the allowed ones.
+func (o *OIDC) authorizeEmailDomain(claims *openIDPayload) error {
+	if len(o.AllowedDomains) == 0 && len(o.DeniedDomains) == 0 {
+		return nil
+	}
+	i := strings.LastIndex(claims.Email, "@")
+	if i < 0 || i == len(claims.Email)-1 {
+		return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("oidc token does not contain a valid email"))
+	}
+	domain := claims.Email[i+1:]
+	for _, d := range o.DeniedDomains {
+		if strings.EqualFold(domain, d) {
+			return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("oidc token email domain %q is not allowed", domain))
+		}
+	}
+	if len(o.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, d := range o.AllowedDomains {
+		if strings.EqualFold(domain, d) {
+			return nil
+		}
+	}
+	return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("oidc token email domain %q is not allowed", domain))
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
 // certificate was configured to allow renewals.
 func (o *OIDC) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if o.Ephemeral {
+		return errs.Unauthorized("oidc.AuthorizeRenew; renew is disabled for ephemeral certificates of provisioner '%s'", o.GetName())
+	}
 	return o.ctl.AuthorizeRenew(ctx, cert)
 }
 
+// ephemeralCertDuration returns the duration of the ephemeral certificates, it
+// cannot be greater than the maximum duration of the provisioner.
+func (o *OIDC) ephemeralCertDuration() time.Duration {
+	if d := o.ctl.Claimer.MaxTLSCertDuration(); d < DefaultEphemeralCertDuration {
+		return d
+	}
+	return DefaultEphemeralCertDuration
+}
+
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !o.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign; sshCA is disabled for oidc provisioner '%s'", o.GetName())
 	}
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
 	}
@@ -383,6 +1216,9 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 	if claims.Subject == "" {
 		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign: failed to validate oidc token payload: subject not found")
 	}
+	if err := o.authorizeAuthenticationContext(token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
+	}
 
 	var data sshutil.TemplateData
 	if claims.Email == "" {
@@ -416,9 +1252,19 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		}
 	}
 
+	// Set the principals of non-admin users from the token claim, if
+	// configured.
+	isAdmin := claims.IsAdmin(o.Admins)
+	var principals []string
+	if o.SSHPrincipals != nil && !isAdmin {
+		if principals, err = o.getSSHPrincipals(token); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
+		}
+		data.SetPrincipals(principals)
+	}
+
 	// Use the default template unless no-templates are configured and email is
 	// an admin, in that case we will use the parameters in the request.
-	isAdmin := claims.IsAdmin(o.Admins)
 	defaultTemplate := sshutil.DefaultTemplate
 	if isAdmin && !o.Options.GetSSHOptions().HasTemplate() {
 		defaultTemplate = sshutil.DefaultAdminTemplate
@@ -439,12 +1285,24 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 			KeyID:      true,
 			Principals: true,
 		})
+	} else if o.SSHPrincipals != nil && o.SSHPrincipals.AllowCustomPrincipals {
+		// The requested principals must be a subset of the ones in the token.
+		signOptions = append(signOptions, sshCertOptionsValidator(SignSSHOptions{
+			CertType:   SSHUserCert,
+			Principals: principals,
+		}), sshRequestedPrincipalsModifier{})
 	} else {
 		signOptions = append(signOptions, sshCertOptionsValidator(SignSSHOptions{
 			CertType: SSHUserCert,
 		}))
 	}
 
+	// Set the extensions and critical options of the provisioner.
+	signOptions = append(signOptions, o.ctl.newSSHExtensionsOptions()...)
+
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, o.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		o,
 		// Set the validity bounds if not set.
@@ -456,15 +1314,15 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser()),
+		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser(), o.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		o.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
 }
 
 // AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
-func (o *OIDC) AuthorizeSSHRevoke(_ context.Context, token string) error {
-	claims, err := o.authorizeToken(token)
+func (o *OIDC) AuthorizeSSHRevoke(ctx context.Context, token string) error {
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHRevoke")
 	}
@@ -488,3 +1346,32 @@ func getAndDecode(uri string, v interface{}) error {
 	}
 	return nil
 }
+
+// checkRequestTimeout is the timeout of each request sent to check the
+// external dependencies of a provisioner.
+const checkRequestTimeout = 10 * time.Second
+
+// checkClient is the client used to check the external dependencies of the
+// provisioners.
+var checkClient = &http.Client{Timeout: checkRequestTimeout}
+
+// getAndDecodeContext is like getAndDecode, but it uses the given context and
+// it fails if the response status is not successful.
+func getAndDecodeContext(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return errors.Wrapf(err, "error creating request for %s", uri)
+	}
+	resp, err := checkClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", uri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("error reading %s: %s", uri, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "error reading %s", uri)
+	}
+	return nil
+}
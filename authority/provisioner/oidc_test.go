@@ -6,6 +6,9 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,6 +18,8 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
@@ -140,6 +145,92 @@ func TestOIDC_Init(t *testing.T) {
 	}
 }
 
+func TestOIDC_additionalConfigurationEndpoints(t *testing.T) {
+	srv1 := generateJWKServer(1)
+	defer srv1.Close()
+	srv2 := generateJWKServer(1)
+	defer srv2.Close()
+
+	var keys1, keys2 jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv1.URL+"/private", &keys1))
+	assert.FatalError(t, getAndDecode(srv2.URL+"/private", &keys2))
+
+	config := Config{Claims: globalProvisionerClaims}
+	newOIDC := func(endpoints ...string) *OIDC {
+		return &OIDC{
+			Type:                             "oidc",
+			Name:                             "name",
+			ClientID:                         "client-id",
+			ConfigurationEndpoint:            srv1.URL,
+			AdditionalConfigurationEndpoints: endpoints,
+		}
+	}
+
+	t.Run("init", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			endpoints []string
+			wantErr   bool
+		}{
+			{"ok", []string{srv2.URL + "/common"}, false},
+			{"ok empty", nil, false},
+			{"fail empty endpoint", []string{""}, true},
+			{"fail duplicated issuer", []string{srv2.URL}, true},
+			{"fail bad configuration", []string{srv2.URL + "/random"}, true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				p := newOIDC(tt.endpoints...)
+				if err := p.Init(config); (err != nil) != tt.wantErr {
+					t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !tt.wantErr {
+					assert.Len(t, len(tt.endpoints), p.issuers)
+				}
+			})
+		}
+	})
+
+	p := newOIDC(srv2.URL + "/common")
+	assert.FatalError(t, p.Init(config))
+
+	oldIssuer := "the-issuer"
+	newIssuer := "https://login.microsoftonline.com/{tenantid}/v2.0"
+	okOld, err := generateSimpleToken(oldIssuer, p.ClientID, &keys1.Keys[0])
+	assert.FatalError(t, err)
+	okNew, err := generateSimpleToken(newIssuer, p.ClientID, &keys2.Keys[0])
+	assert.FatalError(t, err)
+	failKey, err := generateSimpleToken(oldIssuer, p.ClientID, &keys2.Keys[0])
+	assert.FatalError(t, err)
+	failIss, err := generateSimpleToken("bad-issuer", p.ClientID, &keys2.Keys[0])
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantIss string
+		wantErr bool
+	}{
+		{"ok old issuer", okOld, oldIssuer, false},
+		{"ok new issuer", okNew, newIssuer, false},
+		{"fail key of other issuer", failKey, "", true},
+		{"fail unknown issuer", failIss, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.authorizeToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equals(t, tt.wantIss, got.Issuer)
+			}
+		})
+	}
+}
+
 func TestOIDC_authorizeToken(t *testing.T) {
 	srv := generateJWKServer(3)
 	defer srv.Close()
@@ -163,15 +254,23 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	// Admin + Domains
 	p3.Admins = []string{"name@smallstep.com", "root@example.com"}
 	p3.Domains = []string{"smallstep.com"}
+	// Terraform workload identity
+	p4, err := generateOIDC()
+	assert.FatalError(t, err)
+	p4.TerraformOrganizationIDs = []string{"org-123"}
+	p4.TerraformWorkspaceNames = []string{"infra", "network"}
+	p4.TerraformRunPhases = []string{"apply"}
 
 	// Update configuration endpoints and initialize
 	config := Config{Claims: globalProvisionerClaims}
 	p1.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	p2.ConfigurationEndpoint = srv.URL + "/common/.well-known/openid-configuration"
 	p3.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p4.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	assert.FatalError(t, p1.Init(config))
 	assert.FatalError(t, p2.Init(config))
 	assert.FatalError(t, p3.Init(config))
+	assert.FatalError(t, p4.Init(config))
 
 	t1, err := generateSimpleToken(issuer, p1.ClientID, &keys.Keys[0])
 	assert.FatalError(t, err)
@@ -183,6 +282,16 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	assert.FatalError(t, err)
 	t5, err := generateToken("subject", issuer, p3.ClientID, "", []string{}, time.Now(), &keys.Keys[2])
 	assert.FatalError(t, err)
+	t6, err := generateTerraformToken(issuer, p4.ClientID, "org-123", "network", "apply", &keys.Keys[0])
+	assert.FatalError(t, err)
+
+	// Invalid terraform claims
+	failTerraformOrg, err := generateTerraformToken(issuer, p4.ClientID, "org-456", "network", "apply", &keys.Keys[0])
+	assert.FatalError(t, err)
+	failTerraformWorkspace, err := generateTerraformToken(issuer, p4.ClientID, "org-123", "other", "apply", &keys.Keys[0])
+	assert.FatalError(t, err)
+	failTerraformPhase, err := generateTerraformToken(issuer, p4.ClientID, "org-123", "network", "plan", &keys.Keys[0])
+	assert.FatalError(t, err)
 
 	// Invalid email
 	failDomain, err := generateToken("subject", issuer, p3.ClientID, "name@example.com", []string{}, time.Now(), &keys.Keys[2])
@@ -229,6 +338,10 @@ func TestOIDC_authorizeToken(t *testing.T) {
 		{"ok admin", p3, args{t3}, http.StatusOK, issuer, nil},
 		{"ok domain", p3, args{t4}, http.StatusOK, issuer, nil},
 		{"ok no email", p3, args{t5}, http.StatusOK, issuer, nil},
+		{"ok terraform", p4, args{t6}, http.StatusOK, issuer, nil},
+		{"fail-terraform-organization", p4, args{failTerraformOrg}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken: validatePayload: oidc token payload validation failed: invalid terraform_organization_id "org-456"`)},
+		{"fail-terraform-workspace", p4, args{failTerraformWorkspace}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken: validatePayload: oidc token payload validation failed: invalid terraform_workspace_name "other"`)},
+		{"fail-terraform-run-phase", p4, args{failTerraformPhase}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken: validatePayload: oidc token payload validation failed: invalid terraform_run_phase "plan"`)},
 		{"fail-domain", p3, args{failDomain}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken: validatePayload: failed to validate oidc token payload: email "name@example.com" is not allowed`)},
 		{"fail-key", p1, args{failKey}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken; cannot validate oidc token`)},
 		{"fail-token", p1, args{failTok}, http.StatusUnauthorized, "", errors.New(`oidc.AuthorizeToken; error parsing oidc token: invalid character '~' looking for beginning of value`)},
@@ -241,7 +354,7 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.prov.authorizeToken(tt.args.token)
+			got, err := tt.prov.authorizeToken(context.Background(), tt.args.token)
 			if tt.expErr != nil {
 				require.Error(t, err)
 				require.EqualError(t, err, tt.expErr.Error())
@@ -258,6 +371,32 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	}
 }
 
+func generateTerraformToken(iss, aud, orgID, workspace, phase string, jwk *jose.JSONWebKey) (string, error) {
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", jwk.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := openIDPayload{
+		Claims: jose.Claims{
+			Subject:   "organization:example:project:default:workspace:" + workspace + ":run_phase:" + phase,
+			Issuer:    iss,
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Audience:  []string{aud},
+		},
+		TerraformOrganizationID: orgID,
+		TerraformWorkspaceName:  workspace,
+		TerraformRunPhase:       phase,
+	}
+	return jose.Signed(sig).Claims(claims).CompactSerialize()
+}
+
 func TestOIDC_AuthorizeSign(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
@@ -322,7 +461,7 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 				assert.Equals(t, sc.StatusCode(), tt.code)
 				assert.Nil(t, got)
 			} else if assert.NotNil(t, got) {
-				assert.Equals(t, 8, len(got))
+				assert.Equals(t, 13, len(got))
 				for _, o := range got {
 					switch v := o.(type) {
 					case *OIDC:
@@ -342,6 +481,16 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 						assert.Equals(t, nil, v.policyEngine)
 					case *WebhookController:
 						assert.Len(t, 0, v.webhooks)
+					case X509SignerName:
+						assert.Equals(t, "", string(v))
+					case *uniqueSANOption:
+						assert.False(t, v.Enabled)
+					case *signatureAlgorithmOption:
+						assert.Len(t, 0, v.Allowed)
+					case DuplicateDNSNamesPolicy:
+						assert.Equals(t, "", string(v))
+					case X509SerialGenerator:
+						assert.Nil(t, v.SerialGenerator)
 					default:
 						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 					}
@@ -351,6 +500,671 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 	}
 }
 
+func TestOIDC_AuthorizeSign_claimExtensions(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	teamOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	costCenterOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.ClaimExtensions = []OIDCClaimExtension{
+		{Claim: "team", OID: x509util.ObjectIdentifier(teamOID), Required: true},
+		{Claim: "cost_center", OID: x509util.ObjectIdentifier(costCenterOID)},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	token := func(extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+	utf8 := func(s string) []byte {
+		b, err := asn1.MarshalWithParams(s, "utf8")
+		assert.FatalError(t, err)
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  []pkix.Extension
+		err   error
+	}{
+		{"ok", token(map[string]interface{}{"team": "platform", "cost_center": "cc-42"}), []pkix.Extension{
+			{Id: teamOID, Value: utf8("platform")},
+			{Id: costCenterOID, Value: utf8("cc-42")},
+		}, nil},
+		{"ok skip missing", token(map[string]interface{}{"team": "platform"}), []pkix.Extension{
+			{Id: teamOID, Value: utf8("platform")},
+		}, nil},
+		{"fail required", token(map[string]interface{}{"cost_center": "cc-42"}), nil,
+			errors.New(`oidc.AuthorizeSign: oidc token does not contain the claim "team"`)},
+		{"fail not string", token(map[string]interface{}{"team": "platform", "cost_center": 42}), nil,
+			errors.New(`oidc.AuthorizeSign: oidc token claim "cost_center" is not a string`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.err != nil {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			cert := &x509.Certificate{
+				ExtraExtensions: []pkix.Extension{{Id: teamOID, Value: utf8("from-template")}},
+			}
+			for _, o := range opts {
+				if m, ok := o.(extensionsModifier); ok {
+					assert.FatalError(t, m.Modify(cert, SignOptions{}))
+				}
+			}
+			assert.Equals(t, tt.want, cert.ExtraExtensions)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_allowedGroups(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	newProvisioner := func(claim string, groups ...string) *OIDC {
+		p, err := generateOIDC()
+		assert.FatalError(t, err)
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		p.AllowedGroups = groups
+		p.GroupsClaim = claim
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+	token := func(p *OIDC, extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	allowAll := newProvisioner("")
+	groups := newProvisioner("", "ca-issuers")
+	roles := newProvisioner("roles", "ca-issuers", "admins")
+
+	tests := []struct {
+		name    string
+		p       *OIDC
+		token   string
+		wantErr bool
+	}{
+		{"ok allow all", allowAll, token(allowAll, nil), false},
+		{"ok array", groups, token(groups, map[string]interface{}{"groups": []string{"eng", "ca-issuers"}}), false},
+		{"ok string", groups, token(groups, map[string]interface{}{"groups": "eng ca-issuers"}), false},
+		{"ok roles", roles, token(roles, map[string]interface{}{"roles": []string{"admins"}}), false},
+		{"fail missing", groups, token(groups, nil), true},
+		{"fail array", groups, token(groups, map[string]interface{}{"groups": []string{"eng"}}), true},
+		{"fail string", groups, token(groups, map[string]interface{}{"groups": "eng ca-issuers-old"}), true},
+		{"fail other claim", roles, token(roles, map[string]interface{}{"groups": []string{"ca-issuers"}}), true},
+		{"fail letter case", groups, token(groups, map[string]interface{}{"groups": []string{"CA-Issuers"}}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, err.Error(), "oidc.AuthorizeSign: oidc token claim")
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_authenticationContext(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	newProvisioner := func(acr, amr []string) *OIDC {
+		p, err := generateOIDC()
+		assert.FatalError(t, err)
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		p.RequiredACR = acr
+		p.RequiredAMR = amr
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+	token := func(p *OIDC, extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	allowAll := newProvisioner(nil, nil)
+	acr := newProvisioner([]string{"phr", "phrh"}, nil)
+	amr := newProvisioner(nil, []string{"mfa", "hwk"})
+	both := newProvisioner([]string{"phr"}, []string{"mfa"})
+
+	tests := []struct {
+		name    string
+		p       *OIDC
+		token   string
+		wantErr bool
+	}{
+		{"ok allow all", allowAll, token(allowAll, nil), false},
+		{"ok acr", acr, token(acr, map[string]interface{}{"acr": "phrh"}), false},
+		{"ok amr", amr, token(amr, map[string]interface{}{"amr": []string{"pwd", "hwk", "mfa"}}), false},
+		{"ok both", both, token(both, map[string]interface{}{"acr": "phr", "amr": []string{"mfa"}}), false},
+		{"fail acr missing", acr, token(acr, nil), true},
+		{"fail acr", acr, token(acr, map[string]interface{}{"acr": "urn:mace:incommon:iap:silver"}), true},
+		{"fail acr type", acr, token(acr, map[string]interface{}{"acr": []string{"phr"}}), true},
+		{"fail amr missing", amr, token(amr, nil), true},
+		{"fail amr", amr, token(amr, map[string]interface{}{"amr": []string{"pwd", "mfa"}}), true},
+		{"fail amr type", amr, token(amr, map[string]interface{}{"amr": "mfa hwk"}), true},
+		{"fail both missing amr", both, token(both, map[string]interface{}{"acr": "phr"}), true},
+		{"fail both missing acr", both, token(both, map[string]interface{}{"amr": []string{"mfa"}}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			_, sshErr := tt.p.AuthorizeSSHSign(context.Background(), tt.token)
+			if tt.wantErr {
+				if assert.Error(t, err) && assert.Error(t, sshErr) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, err.Error(), "oidc.AuthorizeSign: oidc token")
+					assert.Fatal(t, errors.As(sshErr, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, sshErr.Error(), "oidc.AuthorizeSSHSign: oidc token")
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.FatalError(t, sshErr)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_emailDomains(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	newProvisioner := func(allowed, denied []string) *OIDC {
+		p, err := generateOIDC()
+		assert.FatalError(t, err)
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		p.AllowedDomains = allowed
+		p.DeniedDomains = denied
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+	token := func(p *OIDC, email string) string {
+		var extra map[string]interface{}
+		if email != "" {
+			extra = map[string]interface{}{"email": email}
+		}
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	none := newProvisioner(nil, nil)
+	allowed := newProvisioner([]string{"smallstep.com", "example.com"}, nil)
+	denied := newProvisioner(nil, []string{"gmail.com"})
+	both := newProvisioner([]string{"smallstep.com", "partner.smallstep.com"}, []string{"Partner.Smallstep.com"})
+
+	tests := []struct {
+		name    string
+		p       *OIDC
+		token   string
+		wantErr bool
+	}{
+		{"ok no domains", none, token(none, ""), false},
+		{"ok allowed", allowed, token(allowed, "jane@smallstep.com"), false},
+		{"ok allowed letter case", allowed, token(allowed, "jane@Example.COM"), false},
+		{"ok denied", denied, token(denied, "jane@smallstep.com"), false},
+		{"ok both", both, token(both, "jane@smallstep.com"), false},
+		{"fail allowed", allowed, token(allowed, "jane@gmail.com"), true},
+		{"fail allowed subdomain", allowed, token(allowed, "jane@eng.smallstep.com"), true},
+		{"fail allowed missing email", allowed, token(allowed, ""), true},
+		{"fail denied", denied, token(denied, "jane@GMAIL.com"), true},
+		{"fail denied missing email", denied, token(denied, ""), true},
+		{"fail denied invalid email", denied, token(denied, "jane"), true},
+		{"fail denied precedence", both, token(both, "jane@partner.smallstep.com"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, err.Error(), "oidc.AuthorizeSign: oidc token")
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_commonName(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	newProvisioner := func(tmpl string, disableCustomSANs bool) *OIDC {
+		p, err := generateOIDC()
+		assert.FatalError(t, err)
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		p.CommonName = &OIDCCommonName{Template: tmpl, DisableCustomSANs: disableCustomSANs}
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+	token := func(p *OIDC, extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	email := newProvisioner("{{ .email }}", false)
+	sub := newProvisioner("{{ .sub }}@devices", false)
+	number := newProvisioner("device-{{ .device_id }}", false)
+	nested := newProvisioner("{{ .device.name }}.{{ .device.domain }}", false)
+	only := newProvisioner("{{ .sub }}.devices.internal", true)
+
+	tests := []struct {
+		name      string
+		p         *OIDC
+		token     string
+		csr       *x509.CertificateRequest
+		cert      *x509.Certificate
+		wantCN    string
+		wantDNS   []string
+		wantEmail []string
+		wantErr   bool
+	}{
+		{"ok email", email, token(email, map[string]interface{}{"email": "jane@smallstep.com"}), &x509.CertificateRequest{},
+			&x509.Certificate{DNSNames: []string{"foo.internal"}, EmailAddresses: []string{"jane@smallstep.com"}},
+			"jane@smallstep.com", []string{"foo.internal"}, []string{"jane@smallstep.com"}, false},
+		{"ok sub", sub, token(sub, nil), &x509.CertificateRequest{},
+			&x509.Certificate{},
+			"subject@devices", nil, []string{"subject@devices"}, false},
+		{"ok number", number, token(number, map[string]interface{}{"device_id": 1234}), &x509.CertificateRequest{},
+			&x509.Certificate{},
+			"device-1234", []string{"device-1234"}, nil, false},
+		{"ok nested", nested, token(nested, map[string]interface{}{"device": map[string]interface{}{"name": "laptop", "domain": "smallstep.com"}}), &x509.CertificateRequest{},
+			&x509.Certificate{},
+			"laptop.smallstep.com", []string{"laptop.smallstep.com"}, nil, false},
+		{"ok disableCustomSANs", only, token(only, nil), &x509.CertificateRequest{DNSNames: []string{"subject.devices.internal"}},
+			&x509.Certificate{DNSNames: []string{"foo.internal"}, EmailAddresses: []string{"jane@smallstep.com"}},
+			"subject.devices.internal", []string{"subject.devices.internal"}, nil, false},
+		{"fail missing claim", email, token(email, nil), nil, nil, "", nil, nil, true},
+		{"fail missing nested claim", nested, token(nested, map[string]interface{}{"device": map[string]interface{}{"name": "laptop"}}), nil, nil, "", nil, nil, true},
+		{"fail empty", email, token(email, map[string]interface{}{"email": ""}), nil, nil, "", nil, nil, true},
+		{"fail disableCustomSANs dns", only, token(only, nil), &x509.CertificateRequest{DNSNames: []string{"foo.internal"}}, nil, "", nil, nil, true},
+		{"fail disableCustomSANs email", only, token(only, nil), &x509.CertificateRequest{EmailAddresses: []string{"jane@smallstep.com"}}, nil, "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			if err != nil {
+				if assert.True(t, tt.wantErr, err.Error()) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.HasPrefix(t, err.Error(), "oidc.AuthorizeSign: oidc token")
+				}
+				return
+			}
+			for _, o := range opts {
+				switch v := o.(type) {
+				case dnsNamesValidator, ipAddressesValidator, emailAddressesValidator, *urisValidator:
+					if err == nil {
+						err = v.(CertificateRequestValidator).Valid(tt.csr)
+					}
+				}
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			for _, o := range opts {
+				if m, ok := o.(commonNameSANModifier); ok {
+					assert.FatalError(t, m.Modify(tt.cert, SignOptions{}))
+				}
+			}
+			assert.Equals(t, tt.wantCN, tt.cert.Subject.CommonName)
+			assert.Equals(t, tt.wantDNS, tt.cert.DNSNames)
+			assert.Equals(t, tt.wantEmail, tt.cert.EmailAddresses)
+		})
+	}
+}
+
+func TestOIDC_Init_github(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		repos     []string
+		refs      []string
+		protected bool
+		wantErr   string
+	}{
+		{"ok", []string{"smallstep/certificates"}, nil, false, ""},
+		{"ok refs", []string{"smallstep/certificates", "smallstep/cli"}, []string{"refs/heads/main"}, true, ""},
+		{"fail repository", []string{"smallstep"}, nil, false, `githubRepositories "smallstep" is not valid`},
+		{"fail empty owner", []string{"/certificates"}, nil, false, `githubRepositories "/certificates" is not valid`},
+		{"fail nested", []string{"smallstep/certificates/main"}, nil, false, `githubRepositories "smallstep/certificates/main" is not valid`},
+		{"fail empty ref", []string{"smallstep/certificates"}, []string{""}, false, "githubRefs cannot contain empty values"},
+		{"fail refs without repositories", nil, []string{"refs/heads/main"}, false, "githubRefs requires githubRepositories"},
+		{"fail protected without repositories", nil, nil, true, "githubProtectedRefs requires githubRepositories"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.GitHubRepositories = tt.repos
+			p.GitHubRefs = tt.refs
+			p.GitHubProtectedRefs = tt.protected
+			err = p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_github(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.GitHubRepositories = []string{"smallstep/certificates"}
+	p.GitHubRefs = []string{"refs/heads/main", "refs/heads/release"}
+	p.GitHubProtectedRefs = true
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	claims := func(repo, ref string, protected interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"repository":    repo,
+			"ref":           ref,
+			"ref_protected": protected,
+			"workflow":      "deploy",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		wantCN  string
+		wantErr string
+	}{
+		{"ok", claims("smallstep/certificates", "refs/heads/main", "true"), "smallstep/certificates", ""},
+		{"ok bool", claims("smallstep/certificates", "refs/heads/release", true), "smallstep/certificates", ""},
+		{"ok case", claims("Smallstep/Certificates", "refs/heads/main", "true"), "Smallstep/Certificates", ""},
+		{"fail repository", claims("smallstep/cli", "refs/heads/main", "true"), "", `invalid repository "smallstep/cli"`},
+		{"fail no repository", map[string]interface{}{"ref": "refs/heads/main", "ref_protected": "true"}, "", `invalid repository ""`},
+		{"fail ref", claims("smallstep/certificates", "refs/heads/feature", "true"), "", `invalid ref "refs/heads/feature"`},
+		{"fail not protected", claims("smallstep/certificates", "refs/heads/main", "false"), "", `ref "refs/heads/main" is not protected`},
+		{"fail no protected", map[string]interface{}{"repository": "smallstep/certificates", "ref": "refs/heads/main"}, "", `ref "refs/heads/main" is not protected`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateOIDCTokenWithClaims("repo:smallstep/certificates:ref:refs/heads/main", "the-issuer", p.ClientID, &keys.Keys[0], tt.claims)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSign(context.Background(), tok)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.True(t, strings.Contains(err.Error(), tt.wantErr), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+
+			var certOpts []x509util.Option
+			for _, o := range opts {
+				if v, ok := o.(CertificateOptions); ok {
+					certOpts = append(certOpts, v.Options(SignOptions{})...)
+				}
+			}
+			cert, err := x509util.NewCertificate(csr, certOpts...)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantCN, cert.GetCertificate().Subject.CommonName)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_ephemeral(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.Admins = []string{"name@smallstep.com"}
+	p.Ephemeral = true
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	p.configuration.Issuer = "https://the-issuer.example.com"
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"evil.example.com"},
+	}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		wantEmails []string
+	}{
+		{"ok verified email", map[string]interface{}{"email": "name@smallstep.com", "email_verified": true}, []string{"name@smallstep.com"}},
+		{"ok unverified email", map[string]interface{}{"email": "name@smallstep.com"}, nil},
+		{"ok no email", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateOIDCTokenWithClaims("subject", "https://the-issuer.example.com", p.ClientID, &keys.Keys[0], tt.claims)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+
+			var certOpts []x509util.Option
+			for _, o := range opts {
+				switch v := o.(type) {
+				case CertificateOptions:
+					certOpts = append(certOpts, v.Options(SignOptions{})...)
+				case profileDefaultDuration:
+					assert.Equals(t, DefaultEphemeralCertDuration, time.Duration(v))
+				case *validityValidator:
+					assert.Equals(t, p.ctl.Claimer.MinTLSCertDuration(), v.min)
+					assert.Equals(t, DefaultEphemeralCertDuration, v.max)
+				}
+			}
+			cert, err := x509util.NewCertificate(csr, certOpts...)
+			assert.FatalError(t, err)
+			crt := cert.GetCertificate()
+			assert.Len(t, 0, crt.DNSNames)
+			assert.Equals(t, tt.wantEmails, crt.EmailAddresses)
+			if assert.Len(t, 1, crt.URIs) {
+				assert.Equals(t, "https://the-issuer.example.com#subject", crt.URIs[0].String())
+			}
+		})
+	}
+
+	if err := p.AuthorizeRenew(context.Background(), &x509.Certificate{}); assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+}
+
+func TestOIDC_AuthorizeSign_emailNormalization(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "Jane.Doe@SmallStep.COM"},
+		EmailAddresses: []string{"Jane.Doe@SmallStep.COM"},
+	}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name          string
+		normalization EmailNormalization
+		want          string
+	}{
+		{"default", "", "Jane.Doe@smallstep.com"},
+		{"domain", EmailNormalizationDomain, "Jane.Doe@smallstep.com"},
+		{"lowercase", EmailNormalizationLowercase, "jane.doe@smallstep.com"},
+		{"none", EmailNormalizationNone, "Jane.Doe@SmallStep.COM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.CommonName = &OIDCCommonName{Template: "{{ .email }}"}
+			p.StrictIdentity = true
+			p.EmailNormalization = tt.normalization
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+			tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], map[string]interface{}{
+				"email": "Jane.Doe@SmallStep.COM",
+			})
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+
+			var certOpts []x509util.Option
+			var modifiers []CertificateModifier
+			for _, o := range opts {
+				switch v := o.(type) {
+				case CertificateOptions:
+					certOpts = append(certOpts, v.Options(SignOptions{})...)
+				case commonNameSANModifier:
+					modifiers = append(modifiers, v)
+				case *strictIdentityValidator:
+					// The request can use the email in the token.
+					assert.NoError(t, v.Valid(csr))
+				}
+			}
+			cert, err := x509util.NewCertificate(csr, certOpts...)
+			assert.FatalError(t, err)
+			crt := cert.GetCertificate()
+			for _, m := range modifiers {
+				assert.FatalError(t, m.Modify(crt, SignOptions{}))
+			}
+			assert.Equals(t, tt.want, crt.Subject.CommonName)
+			assert.Equals(t, []string{tt.want}, crt.EmailAddresses)
+		})
+	}
+}
+
+func TestOIDC_Init_emailNormalization(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	for _, tt := range []struct {
+		normalization EmailNormalization
+		wantErr       bool
+	}{
+		{"", false}, {EmailNormalizationDomain, false}, {EmailNormalizationLowercase, false}, {EmailNormalizationNone, false}, {"uppercase", true},
+	} {
+		p := &OIDC{
+			Type:                  "oidc",
+			Name:                  "name",
+			ClientID:              "client-id",
+			ConfigurationEndpoint: srv.URL,
+			EmailNormalization:    tt.normalization,
+		}
+		if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+			t.Errorf("OIDC.Init() emailNormalization %q error = %v, wantErr %v", tt.normalization, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_validateClaimExtensions(t *testing.T) {
+	oid := x509util.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	tests := []struct {
+		name    string
+		exts    []OIDCClaimExtension
+		wantErr bool
+	}{
+		{"ok", []OIDCClaimExtension{{Claim: "team", OID: oid}}, false},
+		{"ok empty", nil, false},
+		{"fail claim", []OIDCClaimExtension{{OID: oid}}, true},
+		{"fail oid", []OIDCClaimExtension{{Claim: "team"}}, true},
+		{"fail duplicated", []OIDCClaimExtension{{Claim: "team", OID: oid}, {Claim: "cost_center", OID: oid}}, true},
+		{"fail reserved", []OIDCClaimExtension{{Claim: "team", OID: x509util.ObjectIdentifier(StepOIDProvisioner)}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateClaimExtensions(tt.exts); (err != nil) != tt.wantErr {
+				t.Errorf("validateClaimExtensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestOIDC_AuthorizeRevoke(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
@@ -504,6 +1318,23 @@ func TestOIDC_AuthorizeSSHSign(t *testing.T) {
 	assert.FatalError(t, p4.Init(config))
 	assert.FatalError(t, p5.Init(config))
 
+	// Principals from claims
+	p7, err := generateOIDC()
+	assert.FatalError(t, err)
+	p7.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p7.SSHPrincipals = &OIDCSSHPrincipals{Claim: "preferred_username", Prefix: "u-", Suffix: "@example"}
+	assert.FatalError(t, p7.Init(config))
+	p8, err := generateOIDC()
+	assert.FatalError(t, err)
+	p8.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p8.SSHPrincipals = &OIDCSSHPrincipals{Claim: "principals", AllowCustomPrincipals: true}
+	assert.FatalError(t, p8.Init(config))
+	p9, err := generateOIDC()
+	assert.FatalError(t, err)
+	p9.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p9.SSHPrincipals = &OIDCSSHPrincipals{Prefix: "u-"}
+	assert.Error(t, p9.Init(config))
+
 	p4.ctl.IdentityFunc = func(ctx context.Context, p Interface, email string) (*Identity, error) {
 		return &Identity{Usernames: []string{"max", "mariano"}}, nil
 	}
@@ -521,6 +1352,15 @@ func TestOIDC_AuthorizeSSHSign(t *testing.T) {
 	// Admin email not in domains
 	okAdmin, err := generateOIDCToken("subject", "the-issuer", p3.ClientID, "root@example.com", "", time.Now(), &keys.Keys[0])
 	assert.FatalError(t, err)
+	okClaimPrincipals, err := generateOIDCToken("subject", "the-issuer", p7.ClientID, "name@smallstep.com", "jane", time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+	failClaimPrincipals, err := generateOIDCToken("subject", "the-issuer", p7.ClientID, "name@smallstep.com", "", time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+	okCustomPrincipals, err := generateOIDCTokenWithClaims("subject", "the-issuer", p8.ClientID, &keys.Keys[0], map[string]interface{}{
+		"email":      "name@smallstep.com",
+		"principals": []string{"jane", "deploy"},
+	})
+	assert.FatalError(t, err)
 	// Empty email
 	emptyEmail, err := generateToken("subject", "the-issuer", p1.ClientID, "", []string{}, time.Now(), &keys.Keys[0])
 	expectemptyEmailOptions := &SignSSHOptions{
@@ -598,6 +1438,20 @@ func TestOIDC_AuthorizeSSHSign(t *testing.T) {
 		{"ok-admin-options", p3, args{okAdmin, SignSSHOptions{CertType: "user", KeyID: "name", Principals: []string{"name"}}, pub},
 			&SignSSHOptions{CertType: "user", Principals: []string{"name"},
 				ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration))}, http.StatusOK, false, false},
+		{"ok-claim-principals", p7, args{okClaimPrincipals, SignSSHOptions{}, pub},
+			&SignSSHOptions{CertType: "user", Principals: []string{"u-jane@example"},
+				ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration))}, http.StatusOK, false, false},
+		{"ok-claim-principals-ignore-passed", p7, args{okClaimPrincipals, SignSSHOptions{Principals: []string{"root"}}, pub},
+			&SignSSHOptions{CertType: "user", Principals: []string{"u-jane@example"},
+				ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration))}, http.StatusOK, false, false},
+		{"ok-custom-principals", p8, args{okCustomPrincipals, SignSSHOptions{Principals: []string{"deploy"}}, pub},
+			&SignSSHOptions{CertType: "user", Principals: []string{"deploy"},
+				ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration))}, http.StatusOK, false, false},
+		{"ok-custom-principals-empty", p8, args{okCustomPrincipals, SignSSHOptions{}, pub},
+			&SignSSHOptions{CertType: "user", Principals: []string{"jane", "deploy"},
+				ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration))}, http.StatusOK, false, false},
+		{"fail-custom-principals", p8, args{okCustomPrincipals, SignSSHOptions{Principals: []string{"root"}}, pub}, nil, http.StatusOK, false, true},
+		{"fail-claim-principals-missing", p7, args{failClaimPrincipals, SignSSHOptions{}, pub}, nil, http.StatusUnauthorized, true, false},
 		{"fail-rsa1024", p1, args{t1, SignSSHOptions{}, rsa1024.Public()}, expectedUserOptions, http.StatusOK, false, true},
 		{"fail-user-host", p1, args{t1, SignSSHOptions{CertType: "host"}, pub}, nil, http.StatusOK, false, true},
 		{"fail-getIdentity", p5, args{failGetIdentityToken, SignSSHOptions{}, pub}, nil, http.StatusInternalServerError, true, false},
@@ -746,3 +1600,307 @@ func Test_openIDPayload_IsAdmin(t *testing.T) {
 		})
 	}
 }
+
+func TestOIDC_ValidatePayload_audiences(t *testing.T) {
+	o := &OIDC{
+		ClientID:      "client-id",
+		Audiences:     []string{"app-1", "app-2"},
+		configuration: openIDConfiguration{Issuer: "the-issuer"},
+	}
+	newPayload := func(azp string, aud ...string) openIDPayload {
+		return openIDPayload{
+			Claims: jose.Claims{
+				Issuer:   "the-issuer",
+				Audience: aud,
+				Expiry:   jose.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			AuthorizedParty: azp,
+		}
+	}
+	tests := []struct {
+		name    string
+		payload openIDPayload
+		wantErr bool
+	}{
+		{"ok client id", newPayload("", "client-id"), false},
+		{"ok audience", newPayload("", "app-2"), false},
+		{"ok multiple", newPayload("app-1", "foo", "app-1"), false},
+		{"ok azp client id", newPayload("client-id", "app-1"), false},
+		{"fail audience", newPayload("", "foo", "bar"), true},
+		{"fail azp", newPayload("foo", "app-1"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := o.ValidatePayload(tt.payload); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.ValidatePayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_audiences(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name      string
+		audiences []string
+		wantErr   bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", []string{"app-1", "app-2"}, false},
+		{"fail empty", []string{}, true},
+		{"fail empty value", []string{"app-1", ""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				Audiences:             tt.audiences,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_allowedGroups(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name          string
+		allowedGroups []string
+		groupsClaim   string
+		wantErr       bool
+	}{
+		{"ok nil", nil, "", false},
+		{"ok", []string{"ca-issuers"}, "", false},
+		{"ok groups claim", []string{"ca-issuers"}, "roles", false},
+		{"fail empty value", []string{"ca-issuers", ""}, "", true},
+		{"fail groups claim", nil, "roles", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				AllowedGroups:         tt.allowedGroups,
+				GroupsClaim:           tt.groupsClaim,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_authenticationContext(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name        string
+		requiredACR []string
+		requiredAMR []string
+		wantErr     bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok", []string{"phr"}, []string{"mfa"}, false},
+		{"fail empty acr", []string{"phr", ""}, nil, true},
+		{"fail empty amr", nil, []string{""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				RequiredACR:           tt.requiredACR,
+				RequiredAMR:           tt.requiredAMR,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_oidcGroups_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    oidcGroups
+		wantErr bool
+	}{
+		{"ok array", `["eng", "admin"]`, oidcGroups{"eng", "admin"}, false},
+		{"ok string", `"eng  admin"`, oidcGroups{"eng", "admin"}, false},
+		{"ok null", `null`, nil, false},
+		{"fail number", `42`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got oidcGroups
+			if err := json.Unmarshal([]byte(tt.data), &got); (err != nil) != tt.wantErr {
+				t.Fatalf("oidcGroups.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestOIDC_Init_emailDomains(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name           string
+		allowedDomains []string
+		deniedDomains  []string
+		wantErr        bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok", []string{"smallstep.com"}, []string{"gmail.com"}, false},
+		{"fail allowed empty value", []string{""}, nil, true},
+		{"fail allowed email", []string{"jane@smallstep.com"}, nil, true},
+		{"fail denied empty value", nil, []string{"gmail.com", ""}, true},
+		{"fail denied email", nil, []string{"@gmail.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				AllowedDomains:        tt.allowedDomains,
+				DeniedDomains:         tt.deniedDomains,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_admins(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name    string
+		admins  []string
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", []string{"jane@smallstep.com", "admins"}, false},
+		{"fail empty value", []string{"jane@smallstep.com", ""}, true},
+		{"fail blank value", []string{" "}, true},
+		{"fail no local part", []string{"@smallstep.com"}, true},
+		{"fail no domain", []string{"jane@"}, true},
+		{"fail spaces", []string{"jane doe@smallstep.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				Admins:                tt.admins,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_commonName(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name       string
+		commonName *OIDCCommonName
+		ephemeral  bool
+		options    *Options
+		wantErr    bool
+	}{
+		{"ok nil", nil, false, nil, false},
+		{"ok", &OIDCCommonName{Template: "{{ .email }}"}, false, nil, false},
+		{"ok disableCustomSANs", &OIDCCommonName{Template: "{{ .sub }}@devices", DisableCustomSANs: true}, false, nil, false},
+		{"ok forbidCommonName", nil, false, &Options{X509: &X509Options{ForbidCommonName: true}}, false},
+		{"fail empty", &OIDCCommonName{Template: " "}, false, nil, true},
+		{"fail parse", &OIDCCommonName{Template: "{{ .email "}, false, nil, true},
+		{"fail ephemeral", &OIDCCommonName{Template: "{{ .email }}"}, true, nil, true},
+		{"fail forbidCommonName", &OIDCCommonName{Template: "{{ .email }}"}, false, &Options{X509: &X509Options{ForbidCommonName: true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				CommonName:            tt.commonName,
+				Ephemeral:             tt.ephemeral,
+				Options:               tt.options,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_Check(t *testing.T) {
+	az, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	ok := srv.URL + "/" + az.TenantID + "/.well-known/openid-configuration"
+	tests := []struct {
+		name       string
+		endpoint   string
+		additional []string
+		wantErr    bool
+	}{
+		{"ok", ok, nil, false},
+		{"ok additional", ok, []string{ok}, false},
+		{"fail empty", srv.URL + "/empty/.well-known/openid-configuration", nil, true},
+		{"fail jwk", srv.URL + "/error/.well-known/openid-configuration", nil, true},
+		{"fail configuration", srv.URL + "/error", nil, true},
+		{"fail additional", ok, []string{srv.URL + "/empty/.well-known/openid-configuration"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = tt.endpoint
+			p.AdditionalConfigurationEndpoints = tt.additional
+			if err := p.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// OIDCUserPrincipalName maps a claim of the OIDC token to a Microsoft User
+// Principal Name (UPN) in the X.509 certificates, an otherName SAN with the
+// type 1.3.6.1.4.1.311.20.2.3 and the value encoded as an UTF8String, used for
+// the smart card logon in Active Directory. The claim must be a string in the
+// form user@domain, e.g. the upn or preferred_username claims of Microsoft
+// Entra ID. If Required is true, a token without the claim is rejected, by
+// default the UPN is skipped.
+type OIDCUserPrincipalName struct {
+	Claim    string `json:"claim"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// init validates the claim mapping.
+func (u *OIDCUserPrincipalName) init() error {
+	switch {
+	case u == nil:
+		return nil
+	case u.Claim == "":
+		return errors.New("userPrincipalName claim cannot be empty")
+	case strings.IndexFunc(u.Claim, unicode.IsSpace) >= 0:
+		return errors.Errorf("userPrincipalName claim %q cannot contain spaces", u.Claim)
+	default:
+		return nil
+	}
+}
+
+// newOptions returns the SignOption that adds the UPN in the configured claim
+// of the token. The token must be validated before calling this method.
+func (u *OIDCUserPrincipalName) newOptions(token string) ([]SignOption, error) {
+	if u == nil {
+		return nil, nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+	v, ok := claims[u.Claim]
+	if !ok || v == nil {
+		if u.Required {
+			return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token does not contain the claim %q", u.Claim))
+		}
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim %q is not a string", u.Claim))
+	}
+	if err := validateUserPrincipalName(s); err != nil {
+		return nil, authorizeErr(ReasonInvalidClaims, errs.Unauthorized("oidc token claim %q is not valid: %v", u.Claim, err))
+	}
+	return []SignOption{userPrincipalNameEnforcer(s)}, nil
+}
+
+// validateUserPrincipalName returns an error if the given value is not a UPN in
+// the form user@domain.
+func validateUserPrincipalName(upn string) error {
+	i := strings.LastIndexByte(upn, '@')
+	switch {
+	case !utf8.ValidString(upn):
+		return errors.New("user principal name is not a valid UTF-8 string")
+	case i <= 0 || i == len(upn)-1:
+		return errors.Errorf("user principal name %q must have the form user@domain", upn)
+	case strings.IndexFunc(upn, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		return errors.Errorf("user principal name %q cannot contain spaces or control characters", upn)
+	default:
+		return nil
+	}
+}
+
+// userPrincipalNameEnforcer is a CertificateEnforcer that adds a Microsoft UPN
+// otherName to the subject alternative names of the certificate. The Go
+// standard library does not support otherName SANs, so the enforcer writes the
+// subjectAltName extension with the DNS names, emails, IPs and URIs of the
+// certificate, or adds the UPN to the extension created by the template.
+type userPrincipalNameEnforcer string
+
+// Enforce implements CertificateEnforcer.
+func (e userPrincipalNameEnforcer) Enforce(cert *x509.Certificate) error {
+	upn, err := x509util.SubjectAlternativeName{
+		Type:  x509util.UserPrincipalNameType,
+		Value: string(e),
+	}.RawValue()
+	if err != nil {
+		return err
+	}
+
+	var names []asn1.RawValue
+	idx := -1
+	for i, ext := range cert.ExtraExtensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil || len(rest) > 0 {
+				return errors.New("error parsing subjectAltName extension")
+			}
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		if names, err = subjectAltNameRawValues(cert); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if bytes.Equal(name.FullBytes, upn.FullBytes) {
+			return nil
+		}
+	}
+
+	value, err := asn1.Marshal(append(names, upn))
+	if err != nil {
+		return errors.Wrap(err, "error marshaling subjectAltName extension")
+	}
+	ext := pkix.Extension{
+		Id:       oidExtensionSubjectAltName,
+		Critical: len(cert.Subject.ToRDNSequence()) == 0,
+		Value:    value,
+	}
+	if idx == -1 {
+		cert.ExtraExtensions = append(cert.ExtraExtensions, ext)
+	} else {
+		cert.ExtraExtensions[idx] = ext
+	}
+	return nil
+}
+
+// subjectAltNameRawValues returns the ASN.1 values of the DNS names, emails,
+// IPs and URIs of the given certificate.
+func subjectAltNameRawValues(cert *x509.Certificate) ([]asn1.RawValue, error) {
+	var sans []x509util.SubjectAlternativeName
+	for _, s := range cert.DNSNames {
+		sans = append(sans, x509util.SubjectAlternativeName{Type: x509util.DNSType, Value: s})
+	}
+	for _, s := range cert.EmailAddresses {
+		sans = append(sans, x509util.SubjectAlternativeName{Type: x509util.EmailType, Value: s})
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, x509util.SubjectAlternativeName{Type: x509util.IPType, Value: ip.String()})
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, x509util.SubjectAlternativeName{Type: x509util.URIType, Value: u.String()})
+	}
+	values := make([]asn1.RawValue, 0, len(sans)+1)
+	for _, san := range sans {
+		v, err := san.RawValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,226 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	assert.FatalError(t, err)
+	return b
+}
+
+func TestOIDCUserPrincipalName_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		upn     *OIDCUserPrincipalName
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &OIDCUserPrincipalName{Claim: "upn"}, false},
+		{"ok required", &OIDCUserPrincipalName{Claim: "preferred_username", Required: true}, false},
+		{"fail empty", &OIDCUserPrincipalName{}, true},
+		{"fail spaces", &OIDCUserPrincipalName{Claim: "user principal"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.upn.init(); (err != nil) != tt.wantErr {
+				t.Errorf("OIDCUserPrincipalName.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateUserPrincipalName(t *testing.T) {
+	tests := []struct {
+		name    string
+		upn     string
+		wantErr bool
+	}{
+		{"ok", "jane@example.com", false},
+		{"ok utf8", "jäne@corp.example.com", false},
+		{"ok multiple at", "jane@contoso@example.com", false},
+		{"fail empty", "", true},
+		{"fail no at", "jane", true},
+		{"fail no user", "@example.com", true},
+		{"fail no domain", "jane@", true},
+		{"fail space", "jane doe@example.com", true},
+		{"fail control", "jane\x00@example.com", true},
+		{"fail utf8", "jane\xff@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateUserPrincipalName(tt.upn); (err != nil) != tt.wantErr {
+				t.Errorf("validateUserPrincipalName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_userPrincipalNameEnforcer_Enforce(t *testing.T) {
+	// Reference values generated with OpenSSL using
+	// subjectAltName=otherName:msUPN;UTF8:user@example.com
+	upnOnly := "3022" + "a020060a2b060104018237140203a0120c1075736572406578616d706c652e636f6d"
+	upn := "a020060a2b060104018237140203a0120c1075736572406578616d706c652e636f6d"
+	dns := "820b6578616d706c652e636f6d"
+	email := "81106a616e65406578616d706c652e636f6d"
+	ip := "87040a000001"
+	uri := "86147370696666653a2f2f6578616d706c652e636f6d"
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want pkix.Extension
+	}{
+		{"ok only upn", &x509.Certificate{}, pkix.Extension{
+			Id: oidExtensionSubjectAltName, Critical: true, Value: mustHex(t, upnOnly),
+		}},
+		{"ok with subject", &x509.Certificate{Subject: pkix.Name{CommonName: "user"}}, pkix.Extension{
+			Id: oidExtensionSubjectAltName, Critical: false, Value: mustHex(t, upnOnly),
+		}},
+		{"ok sans", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "user"},
+			DNSNames:       []string{"example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com"}},
+		}, pkix.Extension{
+			Id: oidExtensionSubjectAltName, Value: mustHex(t, "305d"+dns+email+ip+uri+upn),
+		}},
+		{"ok template extension", &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "user"},
+			DNSNames:        []string{"ignored.example.com"},
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: mustHex(t, "300d"+dns)}},
+		}, pkix.Extension{
+			Id: oidExtensionSubjectAltName, Value: mustHex(t, "302f"+dns+upn),
+		}},
+		{"ok already present", &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "user"},
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: mustHex(t, upnOnly)}},
+		}, pkix.Extension{
+			Id: oidExtensionSubjectAltName, Value: mustHex(t, upnOnly),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.FatalError(t, userPrincipalNameEnforcer("user@example.com").Enforce(tt.cert))
+			assert.Equals(t, []pkix.Extension{tt.want}, tt.cert.ExtraExtensions)
+		})
+	}
+
+	t.Run("fail extension", func(t *testing.T) {
+		cert := &x509.Certificate{
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: []byte("foo")}},
+		}
+		assert.Error(t, userPrincipalNameEnforcer("user@example.com").Enforce(cert))
+	})
+
+	t.Run("ok signed", func(t *testing.T) {
+		signer, err := keyutil.GenerateDefaultSigner()
+		assert.FatalError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "user"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		assert.FatalError(t, userPrincipalNameEnforcer("user@example.com").Enforce(template))
+		der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+		assert.FatalError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.FatalError(t, err)
+		assert.Equals(t, []string{"example.com"}, cert.DNSNames)
+
+		var sans []pkix.Extension
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oidExtensionSubjectAltName) {
+				sans = append(sans, ext)
+			}
+		}
+		assert.Equals(t, []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: mustHex(t, "302f"+dns+upn)}}, sans)
+	})
+}
+
+func TestOIDC_AuthorizeSign_userPrincipalName(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	newProvisioner := func(required bool) *OIDC {
+		p, err := generateOIDC()
+		assert.FatalError(t, err)
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		p.UserPrincipalName = &OIDCUserPrincipalName{Claim: "upn", Required: required}
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+	optional := newProvisioner(false)
+	required := newProvisioner(true)
+
+	token := func(p *OIDC, extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "the-issuer", p.ClientID, &keys.Keys[0], extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name  string
+		p     *OIDC
+		token string
+		want  []userPrincipalNameEnforcer
+		err   error
+	}{
+		{"ok", optional, token(optional, map[string]interface{}{"upn": "jane@corp.example.com"}), []userPrincipalNameEnforcer{"jane@corp.example.com"}, nil},
+		{"ok required", required, token(required, map[string]interface{}{"upn": "jane@corp.example.com"}), []userPrincipalNameEnforcer{"jane@corp.example.com"}, nil},
+		{"ok skip missing", optional, token(optional, nil), nil, nil},
+		{"fail required", required, token(required, nil), nil,
+			errors.New(`oidc.AuthorizeSign: oidc token does not contain the claim "upn"`)},
+		{"fail not string", optional, token(optional, map[string]interface{}{"upn": 42}), nil,
+			errors.New(`oidc.AuthorizeSign: oidc token claim "upn" is not a string`)},
+		{"fail not valid", optional, token(optional, map[string]interface{}{"upn": "jane"}), nil,
+			errors.New(`oidc.AuthorizeSign: oidc token claim "upn" is not valid: user principal name "jane" must have the form user@domain`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			if tt.err != nil {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			var got []userPrincipalNameEnforcer
+			for _, o := range opts {
+				if e, ok := o.(userPrincipalNameEnforcer); ok {
+					got = append(got, e)
+				}
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package provisioner
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// OIDCVault configures an OIDC provisioner to accept the identity tokens
+// issued by HashiCorp Vault, the ones of the identity/oidc/token/:role
+// endpoint or, if Provider is set, the ID tokens of a Vault OIDC provider.
+//
+// The configuration endpoint of the provisioner is derived from the Address,
+// the Namespace and the Provider, e.g.
+// https://vault.example.com:8200/v1/team-a/identity/oidc/.well-known/openid-configuration.
+// The ClientID and the Audiences of the provisioner are the client_id of the
+// Vault roles or clients whose tokens are accepted, Vault uses them as the aud
+// claim.
+//
+// Subject is a template over the claims of the token, including the ones added
+// by the template of the Vault role, e.g. "{{ .metadata.service }}". It sets
+// the subject of the X.509 certificates, by default the subject is the Vault
+// entity ID in the sub claim.
+type OIDCVault struct {
+	Address   string `json:"address"`
+	Namespace string `json:"namespace,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	subject   *template.Template
+}
+
+// init validates the Vault options and parses the subject template.
+func (v *OIDCVault) init() (err error) {
+	if v == nil {
+		return nil
+	}
+	u, err := url.Parse(v.Address)
+	switch {
+	case v.Address == "":
+		return errors.New("vault address cannot be empty")
+	case err != nil:
+		return errors.Wrapf(err, "error parsing vault address %q", v.Address)
+	case u.Scheme != "https" && u.Scheme != "http":
+		return errors.Errorf("vault address %q must use the http or https scheme", v.Address)
+	case u.Host == "":
+		return errors.Errorf("vault address %q must have a host", v.Address)
+	case strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil:
+		return errors.Errorf("vault address %q cannot have a path, query, fragment or user", v.Address)
+	}
+	if v.Namespace != "" {
+		for _, s := range strings.Split(v.Namespace, "/") {
+			if s == "" || s == "." || s == ".." || strings.ContainsAny(s, "?#%") {
+				return errors.Errorf("vault namespace %q is not valid", v.Namespace)
+			}
+		}
+	}
+	if v.Provider != "" && (strings.ContainsAny(v.Provider, "/?#%") || v.Provider == "." || v.Provider == "..") {
+		return errors.Errorf("vault provider %q is not valid", v.Provider)
+	}
+	if v.Subject != "" {
+		if strings.TrimSpace(v.Subject) == "" {
+			return errors.New("vault subject template cannot be empty")
+		}
+		if v.subject, err = template.New("subject").Option("missingkey=error").Parse(v.Subject); err != nil {
+			return errors.Wrap(err, "error parsing vault subject template")
+		}
+	}
+	return nil
+}
+
+// configurationEndpoint returns the URL of the openid-configuration document
+// of the Vault identity tokens or OIDC provider.
+func (v *OIDCVault) configurationEndpoint() string {
+	p := "/v1/"
+	if v.Namespace != "" {
+		p += v.Namespace + "/"
+	}
+	p += "identity/oidc"
+	if v.Provider != "" {
+		p += "/provider/" + v.Provider
+	}
+	return strings.TrimRight(v.Address, "/") + p + "/.well-known/openid-configuration"
+}
+
+// getSubject returns the subject of the X.509 certificates from the claims of
+// the given token. It returns the sub claim if the subject template is not
+// set.
+func (v *OIDCVault) getSubject(token string, claims *openIDPayload) (string, error) {
+	if v.subject == nil {
+		return claims.Subject, nil
+	}
+	m, err := unsafeParseSigned(token)
+	if err != nil {
+		return "", errs.Wrap(http.StatusUnauthorized, err, "error parsing token")
+	}
+	var buf bytes.Buffer
+	if err := v.subject.Execute(&buf, m); err != nil {
+		return "", authorizeErr(ReasonInvalidClaims, errs.Unauthorized("vault token does not contain the claims of the subject template: %v", err))
+	}
+	subject := strings.TrimSpace(buf.String())
+	if subject == "" {
+		return "", authorizeErr(ReasonInvalidClaims, errs.Unauthorized("vault token claims result in an empty subject"))
+	}
+	return subject, nil
+}
@@ -0,0 +1,209 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// generateVaultServer returns a server with the openid-configuration of the
+// Vault identity tokens in the root and team-a namespaces, using the keys of
+// the given JWK server.
+func generateVaultServer(jwkServer *httptest.Server) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/v1/identity/oidc/.well-known/openid-configuration",
+			"/v1/team-a/identity/oidc/provider/default/.well-known/openid-configuration":
+			w.Header().Add("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(openIDConfiguration{
+				Issuer:    "https://vault.example.com/v1/identity/oidc",
+				JWKSetURI: jwkServer.URL + "/jwks_uri",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOIDCVault_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		vault   *OIDCVault
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &OIDCVault{Address: "https://vault.example.com:8200"}, false},
+		{"ok trailing slash", &OIDCVault{Address: "https://vault.example.com/"}, false},
+		{"ok http", &OIDCVault{Address: "http://127.0.0.1:8200"}, false},
+		{"ok namespace", &OIDCVault{Address: "https://vault.example.com", Namespace: "team-a/project-b", Provider: "default"}, false},
+		{"ok subject", &OIDCVault{Address: "https://vault.example.com", Subject: "{{ .metadata.service }}.svc"}, false},
+		{"fail empty", &OIDCVault{}, true},
+		{"fail scheme", &OIDCVault{Address: "ftp://vault.example.com"}, true},
+		{"fail no scheme", &OIDCVault{Address: "vault.example.com:8200"}, true},
+		{"fail no host", &OIDCVault{Address: "https:///v1"}, true},
+		{"fail path", &OIDCVault{Address: "https://vault.example.com/v1"}, true},
+		{"fail query", &OIDCVault{Address: "https://vault.example.com?namespace=team-a"}, true},
+		{"fail user", &OIDCVault{Address: "https://root@vault.example.com"}, true},
+		{"fail namespace", &OIDCVault{Address: "https://vault.example.com", Namespace: "team-a//project-b"}, true},
+		{"fail namespace dots", &OIDCVault{Address: "https://vault.example.com", Namespace: "../sys"}, true},
+		{"fail provider", &OIDCVault{Address: "https://vault.example.com", Provider: "default/keys"}, true},
+		{"fail subject", &OIDCVault{Address: "https://vault.example.com", Subject: "{{ .metadata.service "}, true},
+		{"fail empty subject", &OIDCVault{Address: "https://vault.example.com", Subject: "  "}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.vault.init(); (err != nil) != tt.wantErr {
+				t.Errorf("OIDCVault.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCVault_configurationEndpoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		vault *OIDCVault
+		want  string
+	}{
+		{"ok", &OIDCVault{Address: "https://vault.example.com:8200"}, "https://vault.example.com:8200/v1/identity/oidc/.well-known/openid-configuration"},
+		{"ok trailing slash", &OIDCVault{Address: "https://vault.example.com/"}, "https://vault.example.com/v1/identity/oidc/.well-known/openid-configuration"},
+		{"ok namespace", &OIDCVault{Address: "https://vault.example.com", Namespace: "team-a/project-b"}, "https://vault.example.com/v1/team-a/project-b/identity/oidc/.well-known/openid-configuration"},
+		{"ok provider", &OIDCVault{Address: "https://vault.example.com", Namespace: "team-a", Provider: "default"}, "https://vault.example.com/v1/team-a/identity/oidc/provider/default/.well-known/openid-configuration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.vault.configurationEndpoint())
+		})
+	}
+}
+
+func TestOIDC_Init_vault(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	vaultSrv := generateVaultServer(srv)
+	defer vaultSrv.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		vault    *OIDCVault
+		repos    []string
+		wantErr  string
+	}{
+		{"ok", "", &OIDCVault{Address: vaultSrv.URL}, nil, ""},
+		{"ok provider", "", &OIDCVault{Address: vaultSrv.URL, Namespace: "team-a", Provider: "default"}, nil, ""},
+		{"fail endpoint", srv.URL + "/.well-known/openid-configuration", &OIDCVault{Address: vaultSrv.URL}, nil, "configurationEndpoint cannot be used with vault"},
+		{"fail github", "", &OIDCVault{Address: vaultSrv.URL}, []string{"smallstep/certificates"}, "vault cannot be used with githubRepositories"},
+		{"fail address", "", &OIDCVault{Address: vaultSrv.URL + "/v1"}, nil, "vault address"},
+		{"fail namespace", "", &OIDCVault{Address: vaultSrv.URL, Namespace: "team-b"}, nil, "error reading"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = tt.endpoint
+			p.Vault = tt.vault
+			p.GitHubRepositories = tt.repos
+			err = p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				assert.Equals(t, "https://vault.example.com/v1/identity/oidc", p.configuration.Issuer)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_vault(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	vaultSrv := generateVaultServer(srv)
+	defer vaultSrv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = ""
+	p.Vault = &OIDCVault{Address: vaultSrv.URL, Subject: "{{ .metadata.service }}.{{ .namespace }}"}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	issuer := p.configuration.Issuer
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	entityID := "2a2c7d4c-5d33-0aad-6d6a-c8d4e5a62f3b"
+	tests := []struct {
+		name    string
+		sub     string
+		aud     string
+		claims  map[string]interface{}
+		wantCN  string
+		wantErr string
+	}{
+		{"ok", entityID, p.ClientID, map[string]interface{}{
+			"namespace": "root",
+			"metadata":  map[string]interface{}{"service": "billing"},
+		}, "billing.root", ""},
+		{"fail audience", entityID, "other-role", map[string]interface{}{
+			"namespace": "root",
+			"metadata":  map[string]interface{}{"service": "billing"},
+		}, "", "invalid audience claim"},
+		{"fail no entity", "", p.ClientID, map[string]interface{}{
+			"namespace": "root",
+			"metadata":  map[string]interface{}{"service": "billing"},
+		}, "", "vault token does not have an entity"},
+		{"fail no metadata", entityID, p.ClientID, map[string]interface{}{
+			"namespace": "root",
+		}, "", "vault token does not contain the claims of the subject template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateOIDCTokenWithClaims(tt.sub, issuer, tt.aud, &keys.Keys[0], tt.claims)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSign(context.Background(), tok)
+			if tt.wantCN == "" {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.True(t, strings.Contains(err.Error(), tt.wantErr), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+
+			var certOpts []x509util.Option
+			for _, o := range opts {
+				if v, ok := o.(CertificateOptions); ok {
+					certOpts = append(certOpts, v.Options(SignOptions{})...)
+				}
+			}
+			cert, err := x509util.NewCertificate(csr, certOpts...)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantCN, cert.GetCertificate().Subject.CommonName)
+		})
+	}
+}
@@ -1,12 +1,23 @@
 package provisioner
 
 import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // used only as an identifier
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"hash"
+	"net"
+	"sort"
 	"strings"
+	"text/template"
+	"text/template/parse"
 
 	"github.com/pkg/errors"
 
-	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/x509util"
 
@@ -33,6 +44,22 @@ type Options struct {
 
 	// Webhooks is a list of webhooks that can augment template data
 	Webhooks []*Webhook `json:"webhooks,omitempty"`
+
+	// RateLimit limits the rate of sign requests of the provisioner.
+	RateLimit *RateLimitOptions `json:"rateLimit,omitempty"`
+
+	// SignConcurrency limits the number of certificates of the provisioner
+	// signed at the same time.
+	SignConcurrency *SignConcurrencyOptions `json:"signConcurrency,omitempty"`
+
+	// SANManifest restricts the SANs of each cloud instance to the ones in a
+	// signed manifest.
+	SANManifest *SANManifestOptions `json:"sanManifest,omitempty"`
+
+	// MinConnectionTLSVersion is the minimum TLS version, e.g. "1.3", of the
+	// connection used to request a certificate. If empty, any version is
+	// allowed.
+	MinConnectionTLSVersion string `json:"minConnectionTLSVersion,omitempty"`
 }
 
 // GetX509Options returns the X.509 options.
@@ -59,6 +86,39 @@ func (o *Options) GetWebhooks() []*Webhook {
 	return o.Webhooks
 }
 
+// GetRateLimitOptions returns the rate limit options.
+func (o *Options) GetRateLimitOptions() *RateLimitOptions {
+	if o == nil {
+		return nil
+	}
+	return o.RateLimit
+}
+
+// GetSignConcurrencyOptions returns the sign concurrency options.
+func (o *Options) GetSignConcurrencyOptions() *SignConcurrencyOptions {
+	if o == nil {
+		return nil
+	}
+	return o.SignConcurrency
+}
+
+// GetSANManifestOptions returns the SAN manifest options.
+func (o *Options) GetSANManifestOptions() *SANManifestOptions {
+	if o == nil {
+		return nil
+	}
+	return o.SANManifest
+}
+
+// GetMinConnectionTLSVersion returns the minimum TLS version of the connection
+// used to request a certificate.
+func (o *Options) GetMinConnectionTLSVersion() string {
+	if o == nil {
+		return ""
+	}
+	return o.MinConnectionTLSVersion
+}
+
 // X509Options contains specific options for X.509 certificates.
 type X509Options struct {
 	// Template contains a X.509 certificate template. It can be a JSON template
@@ -68,6 +128,12 @@ type X509Options struct {
 	// TemplateFile points to a file containing a X.509 certificate template.
 	TemplateFile string `json:"templateFile,omitempty"`
 
+	// TemplatePartials maps names to files containing templates that can be
+	// included in Template or TemplateFile using {{ template "name" . }}. A
+	// partial can also be used as a base template, declaring blocks with
+	// {{ block "name" . }} that the main template can redefine.
+	TemplatePartials map[string]string `json:"templatePartials,omitempty"`
+
 	// TemplateData is a JSON object with variables that can be used in custom
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
@@ -81,6 +147,132 @@ type X509Options struct {
 	// AllowWildcardNames indicates if literal wildcard names
 	// like *.example.com are allowed. Defaults to false.
 	AllowWildcardNames bool `json:"-"`
+
+	// Signer is the name of one of the X.509 signers configured in the
+	// authority. If empty, certificates are signed by the default
+	// intermediate.
+	Signer string `json:"signer,omitempty"`
+
+	// AllowedSigners is the list of names of the X.509 signers configured in
+	// the authority that a sign request can select instead of the default
+	// one. If empty, requests cannot select the signer.
+	AllowedSigners []string `json:"allowedSigners,omitempty"`
+
+	// UniqueSAN adds a unique "urn:uuid:<uuid>" URI SAN to every certificate
+	// signed by the provisioner. The SAN is subject to the name policies. A
+	// template can also use the uuidv4 function to generate it.
+	UniqueSAN bool `json:"uniqueSAN,omitempty"`
+
+	// AllowedSignatureAlgorithms is the list of signature algorithms, e.g.
+	// "SHA256-RSA" or "ECDSA-SHA384", that a sign request can select instead
+	// of the default one. If empty, requests cannot select the algorithm.
+	AllowedSignatureAlgorithms []string `json:"allowedSignatureAlgorithms,omitempty"`
+
+	// SignatureAlgorithm is the signature algorithm, e.g. "SHA256-RSAPSS",
+	// used to sign the certificates and their renewals. It must be supported
+	// by the key of the signer. If empty, the default algorithm of the key or
+	// the one selected by the request is used.
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+
+	// DuplicateDNSNames defines what to do if another active certificate
+	// already has one of the DNS names requested. It can be "reject" to deny
+	// the request or "revoke" to revoke the old certificate after signing the
+	// new one. If empty, duplicated DNS names are allowed. It requires the
+	// database index of DNS names. The check is best-effort, concurrent
+	// requests for the same names can all be signed.
+	DuplicateDNSNames DuplicateDNSNamesPolicy `json:"duplicateDNSNames,omitempty"`
+
+	// AllowedSANs is the list of DNS domains and IP ranges, e.g.
+	// "*.internal.example.com" or "10.0.0.0/8", that the provisioner is
+	// authorized to sign. They are added to the allowed names of the x509
+	// policy of the provisioner, so any other name is rejected. If empty, the
+	// SANs are not restricted.
+	AllowedSANs []string `json:"allowedSANs,omitempty"`
+
+	// AllowedKeys restricts the type, the size and the curve of the public
+	// keys in the certificate requests. If empty, all the keys supported by
+	// the CA are allowed.
+	AllowedKeys *AllowedKeys `json:"allowedKeys,omitempty"`
+
+	// ValiditySchedule confines the validity of the certificates to the
+	// daily windows of the schedule. If empty, the validity is not restricted.
+	ValiditySchedule *ValiditySchedule `json:"validitySchedule,omitempty"`
+
+	// AllowedExtKeyUsages is the list of extended key usages, e.g. "clientAuth"
+	// or "serverAuth", of the certificates. If set, the certificates get
+	// exactly these extended key usages, and the ones added by the template are
+	// removed. If empty, the extended key usages are not restricted.
+	AllowedExtKeyUsages []string `json:"allowedExtKeyUsages,omitempty"`
+
+	// SerialNumber configures the scheme of the serial numbers of the
+	// certificates. If empty, the default random serial numbers are used.
+	SerialNumber *SerialNumber `json:"serialNumber,omitempty"`
+
+	// CRLDistributionPoints is the list of URLs added to the CRL Distribution
+	// Points extension of the certificates. If set, they replace the ones
+	// added by the template or configured in the authority.
+	CRLDistributionPoints []string `json:"crlDistributionPoints,omitempty"`
+
+	// PolicyOIDs is the list of policy OIDs, e.g. "2.23.140.1.2.1", added to
+	// the Certificate Policies extension of the certificates. If set, they
+	// replace the policies added by the template.
+	PolicyOIDs []string `json:"policyOIDs,omitempty"`
+
+	// CPSURI is the URL of the certification practice statement added as a
+	// qualifier to each policy in PolicyOIDs.
+	CPSURI string `json:"cpsURI,omitempty"`
+
+	// QCStatements is the list of qualified certificate statements added to
+	// the QCStatements extension of the certificates, e.g. the eIDAS
+	// statements. If set, they replace the extension added by the template.
+	QCStatements []QCStatement `json:"qcStatements,omitempty"`
+
+	// PermittedDNSDomains, ExcludedDNSDomains and PermittedIPRanges are name
+	// constraints that the SANs of the certificates must satisfy, using the
+	// same semantics as the X.509 name constraints extension. A domain like
+	// "example.com" matches itself and its subdomains, and ".example.com"
+	// only matches the subdomains. IP ranges use the CIDR notation.
+	PermittedDNSDomains []string `json:"permittedDNSDomains,omitempty"`
+	ExcludedDNSDomains  []string `json:"excludedDNSDomains,omitempty"`
+	PermittedIPRanges   []string `json:"permittedIPRanges,omitempty"`
+
+	// RenewAfter adds an extension with the recommended renewal time to the
+	// certificates. If not set, the extension is not added.
+	RenewAfter *RenewAfterOptions `json:"renewAfter,omitempty"`
+
+	// AlternateChain is a PEM bundle with an alternate chain of intermediates
+	// of the certificates, e.g. one that terminates at an older cross-signed
+	// root during a root rotation. Every certificate in the bundle must be
+	// signed by the next one, the first one must have the key of the signer
+	// of the provisioner, and the chain must verify with a root or federated
+	// root of the authority. The alternate chain is only returned if the sign
+	// request asks for it.
+	AlternateChain []byte `json:"alternateChain,omitempty"`
+
+	// SubjectKeyID is the method used to compute the subject key identifier of
+	// the certificates, "method1" or "method2" of RFC 5280. If empty, the one
+	// set by the template or the method 1 is used.
+	SubjectKeyID SubjectKeyIDMethod `json:"subjectKeyID,omitempty"`
+
+	// ForbidCommonName rejects the certificate requests with a common name,
+	// and removes the common name set by the template, so the certificates
+	// only identify the subject with their SANs.
+	ForbidCommonName bool `json:"forbidCommonName,omitempty"`
+
+	// TokenHash adds an extension with the SHA-256 hash of the token that
+	// authorized the certificate. If not set, the extension is not added.
+	TokenHash *TokenHashOptions `json:"tokenHash,omitempty"`
+
+	// CertificateTransparency submits a precertificate of each certificate to
+	// the configured CT logs and embeds the returned SCTs in the certificate.
+	// The renewals are logged too. If not set, the certificates are not
+	// logged.
+	CertificateTransparency *CertificateTransparencyOptions `json:"certificateTransparency,omitempty"`
+
+	// KeyAttestation verifies the key attestations of the certificate
+	// requests and records the result in the certificates. If not set, the
+	// attestations are not verified.
+	KeyAttestation *KeyAttestationOptions `json:"keyAttestation,omitempty"`
 }
 
 // HasTemplate returns true if a template is defined in the provisioner options.
@@ -89,12 +281,29 @@ func (o *X509Options) HasTemplate() bool {
 }
 
 // GetAllowedNameOptions returns the AllowedNames, which models the
-// SANs that a provisioner is authorized to sign x509 certificates for.
+// SANs that a provisioner is authorized to sign x509 certificates for. The
+// AllowedSANs are added to its DNS domains and IP ranges.
 func (o *X509Options) GetAllowedNameOptions() *policy.X509NameOptions {
 	if o == nil {
 		return nil
 	}
-	return o.AllowedNames
+	if len(o.AllowedSANs) == 0 {
+		return o.AllowedNames
+	}
+	allowed := new(policy.X509NameOptions)
+	if o.AllowedNames != nil {
+		*allowed = *o.AllowedNames
+	}
+	allowed.DNSDomains = append([]string{}, allowed.DNSDomains...)
+	allowed.IPRanges = append([]string{}, allowed.IPRanges...)
+	for _, san := range o.AllowedSANs {
+		if strings.Contains(san, "/") || net.ParseIP(san) != nil {
+			allowed.IPRanges = append(allowed.IPRanges, san)
+		} else {
+			allowed.DNSDomains = append(allowed.DNSDomains, san)
+		}
+	}
+	return allowed
 }
 
 // GetDeniedNameOptions returns the DeniedNames, which models the
@@ -106,6 +315,404 @@ func (o *X509Options) GetDeniedNameOptions() *policy.X509NameOptions {
 	return o.DeniedNames
 }
 
+// GetSigner returns the name of the X.509 signer used to sign certificates. An
+// empty string indicates the default signer.
+func (o *X509Options) GetSigner() string {
+	if o == nil {
+		return ""
+	}
+	return o.Signer
+}
+
+// GetAllowedSigners returns the names of the X.509 signers that a sign request
+// can select.
+func (o *X509Options) GetAllowedSigners() []string {
+	if o == nil {
+		return nil
+	}
+	return o.AllowedSigners
+}
+
+// IsUniqueSANEnabled returns true if a unique URI SAN must be added to the
+// certificates.
+func (o *X509Options) IsUniqueSANEnabled() bool {
+	return o != nil && o.UniqueSAN
+}
+
+// IsCommonNameForbidden returns true if the certificates and the certificate
+// requests cannot have a common name.
+func (o *X509Options) IsCommonNameForbidden() bool {
+	return o != nil && o.ForbidCommonName
+}
+
+// GetAllowedSignatureAlgorithms returns the signature algorithms that a sign
+// request can select.
+func (o *X509Options) GetAllowedSignatureAlgorithms() []string {
+	if o == nil {
+		return nil
+	}
+	return o.AllowedSignatureAlgorithms
+}
+
+// GetDuplicateDNSNames returns the policy used when an active certificate
+// already has one of the DNS names requested.
+func (o *X509Options) GetDuplicateDNSNames() DuplicateDNSNamesPolicy {
+	if o == nil {
+		return ""
+	}
+	return o.DuplicateDNSNames
+}
+
+// GetAllowedKeys returns the public keys allowed in the certificate requests.
+func (o *X509Options) GetAllowedKeys() *AllowedKeys {
+	if o == nil {
+		return nil
+	}
+	return o.AllowedKeys
+}
+
+// GetValiditySchedule returns the schedule that confines the validity of the
+// certificates.
+func (o *X509Options) GetValiditySchedule() *ValiditySchedule {
+	if o == nil {
+		return nil
+	}
+	return o.ValiditySchedule
+}
+
+// GetAllowedExtKeyUsages returns the extended key usages of the certificates.
+func (o *X509Options) GetAllowedExtKeyUsages() []string {
+	if o == nil {
+		return nil
+	}
+	return o.AllowedExtKeyUsages
+}
+
+// GetSerialNumber returns the scheme of the serial numbers of the
+// certificates.
+func (o *X509Options) GetSerialNumber() *SerialNumber {
+	if o == nil {
+		return nil
+	}
+	return o.SerialNumber
+}
+
+// GetCRLDistributionPoints returns the URLs of the CRL Distribution Points
+// extension of the certificates.
+func (o *X509Options) GetCRLDistributionPoints() []string {
+	if o == nil {
+		return nil
+	}
+	return o.CRLDistributionPoints
+}
+
+// GetPolicyOIDs returns the policy OIDs of the Certificate Policies extension
+// of the certificates.
+func (o *X509Options) GetPolicyOIDs() []string {
+	if o == nil {
+		return nil
+	}
+	return o.PolicyOIDs
+}
+
+// GetCPSURI returns the URL of the certification practice statement of the
+// certificates.
+func (o *X509Options) GetCPSURI() string {
+	if o == nil {
+		return ""
+	}
+	return o.CPSURI
+}
+
+// GetQCStatements returns the qualified certificate statements of the
+// certificates.
+func (o *X509Options) GetQCStatements() []QCStatement {
+	if o == nil {
+		return nil
+	}
+	return o.QCStatements
+}
+
+// GetSignatureAlgorithm returns the signature algorithm used to sign the
+// certificates.
+func (o *X509Options) GetSignatureAlgorithm() string {
+	if o == nil {
+		return ""
+	}
+	return o.SignatureAlgorithm
+}
+
+// GetPermittedDNSDomains returns the DNS domains permitted in the
+// certificates.
+func (o *X509Options) GetPermittedDNSDomains() []string {
+	if o == nil {
+		return nil
+	}
+	return o.PermittedDNSDomains
+}
+
+// GetExcludedDNSDomains returns the DNS domains excluded from the
+// certificates.
+func (o *X509Options) GetExcludedDNSDomains() []string {
+	if o == nil {
+		return nil
+	}
+	return o.ExcludedDNSDomains
+}
+
+// GetRenewAfter returns the options of the recommended renewal time extension
+// of the certificates.
+func (o *X509Options) GetRenewAfter() *RenewAfterOptions {
+	if o == nil {
+		return nil
+	}
+	return o.RenewAfter
+}
+
+// GetTokenHash returns the options of the token hash extension, or nil if the
+// extension is not added.
+func (o *X509Options) GetTokenHash() *TokenHashOptions {
+	if o == nil {
+		return nil
+	}
+	return o.TokenHash
+}
+
+// GetCertificateTransparency returns the certificate transparency options of
+// the certificates, or nil if they are not submitted to CT logs.
+func (o *X509Options) GetCertificateTransparency() *CertificateTransparencyOptions {
+	if o == nil {
+		return nil
+	}
+	return o.CertificateTransparency
+}
+
+// GetKeyAttestation returns the options used to verify the key attestations
+// of the certificate requests, or nil if they are not verified.
+func (o *X509Options) GetKeyAttestation() *KeyAttestationOptions {
+	if o == nil {
+		return nil
+	}
+	return o.KeyAttestation
+}
+
+// GetAlternateChain returns the PEM bundle with the alternate chain of the
+// certificates.
+func (o *X509Options) GetAlternateChain() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.AlternateChain
+}
+
+// GetSubjectKeyID returns the method used to compute the subject key
+// identifier of the certificates.
+func (o *X509Options) GetSubjectKeyID() SubjectKeyIDMethod {
+	if o == nil {
+		return ""
+	}
+	return o.SubjectKeyID
+}
+
+// GetPermittedIPRanges returns the IP ranges permitted in the certificates.
+func (o *X509Options) GetPermittedIPRanges() []string {
+	if o == nil {
+		return nil
+	}
+	return o.PermittedIPRanges
+}
+
+// HasTemplatePartials returns true if template partials are defined in the
+// provisioner options.
+func (o *X509Options) HasTemplatePartials() bool {
+	return o != nil && len(o.TemplatePartials) > 0
+}
+
+// loadTemplateFiles loads the template file and the partials, so they are
+// validated when the provisioner is initialized and reloaded when they change.
+func (o *X509Options) loadTemplateFiles() error {
+	if o == nil {
+		return nil
+	}
+	funcMap := getTemplateFuncMap()
+	if o.Template == "" && o.TemplateFile != "" {
+		if _, err := loadTemplateFile(o.TemplateFile, funcMap); err != nil {
+			return err
+		}
+	}
+	for name, filename := range o.TemplatePartials {
+		if _, err := loadTemplateFile(filename, funcMap); err != nil {
+			return errors.Wrapf(err, "error loading template partial %q", name)
+		}
+	}
+	return nil
+}
+
+// ValidateTemplate returns an error if the custom template and its partials
+// cannot be loaded and parsed, or if the template includes a partial that is
+// not defined.
+func (o *X509Options) ValidateTemplate() error {
+	if !o.HasTemplatePartials() {
+		return nil
+	}
+	if !o.HasTemplate() {
+		return errors.New("x509.templatePartials requires a template or templateFile")
+	}
+	tmpl, err := o.parseTemplateWithPartials(getTemplateFuncMap())
+	if err != nil {
+		return err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if name, ok := findUndefinedTemplate(tmpl, t.Tree.Root); ok {
+			return errors.Errorf("error parsing template: template %q is not defined", name)
+		}
+	}
+	return nil
+}
+
+// parseTemplateWithPartials parses the partials and then the custom template.
+// Each one is parsed separately, so the custom template can redefine the
+// blocks declared in the partials.
+func (o *X509Options) parseTemplateWithPartials(funcMap template.FuncMap) (*template.Template, error) {
+	names := make([]string, 0, len(o.TemplatePartials))
+	for name := range o.TemplatePartials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tmpl := template.New("template").Funcs(funcMap)
+	for _, name := range names {
+		text, err := readTemplateFile(o.TemplatePartials[name], funcMap)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading template partial %q", name)
+		}
+		if _, err := tmpl.New(name).Parse(text); err != nil {
+			return nil, errors.Wrapf(err, "error parsing template partial %q", name)
+		}
+	}
+
+	text, err := loadTemplate(o.Template, o.TemplateFile, funcMap)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return nil, errors.Wrap(err, "error parsing template")
+	}
+
+	return tmpl, nil
+}
+
+// loadTemplate returns the text of a custom template. The template is loaded
+// from templateFile if text is not defined, or from text as a JSON in a string
+// or as a base64 encoded JSON. Template files are cached and reloaded when
+// they change.
+func loadTemplate(text, templateFile string, funcMap template.FuncMap) (string, error) {
+	switch {
+	case text == "" && templateFile != "":
+		return readTemplateFile(templateFile, funcMap)
+	case strings.HasPrefix(strings.TrimSpace(text), "{"):
+		return strings.TrimSpace(text), nil
+	default:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return "", errors.Wrap(err, "error decoding template")
+		}
+		return string(b), nil
+	}
+}
+
+// publicKeyHash returns the hex encoded hash of the DER encoded
+// SubjectPublicKeyInfo of the given key. The supported algorithms are sha1,
+// sha256, sha384 and sha512, e.g.:
+//
+//	{{ publicKeyHash "sha256" .Insecure.CR.PublicKey }}
+func publicKeyHash(alg string, key interface{}) (string, error) {
+	var h hash.Hash
+	switch strings.ToLower(alg) {
+	case "sha1":
+		h = sha1.New() //nolint:gosec // used only as an identifier
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", errors.Errorf("publicKeyHash: unsupported hash algorithm %q", alg)
+	}
+	b, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", errors.Wrap(err, "publicKeyHash: error marshaling public key")
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// withCustomTemplate is an x509util.Option that executes the custom template
+// and its partials with the given data.
+func withCustomTemplate(o *X509Options, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, opts *x509util.Options) error {
+		terr := new(x509util.TemplateError)
+		funcMap := getTemplateFuncMap()
+		funcMap["fail"] = func(msg string) (string, error) {
+			terr.Message = msg
+			return "", errors.New(msg)
+		}
+		tmpl, err := o.parseTemplateWithPartials(funcMap)
+		if err != nil {
+			return err
+		}
+
+		buf := new(bytes.Buffer)
+		data.SetCertificateRequest(cr)
+		if err := tmpl.Execute(buf, data); err != nil {
+			if terr.Message != "" {
+				return terr
+			}
+			return errors.Wrap(err, "error executing template")
+		}
+		opts.CertBuffer = buf
+		return nil
+	}
+}
+
+// findUndefinedTemplate walks the given node and returns the name of the first
+// template included that is not defined in tmpl.
+func findUndefinedTemplate(tmpl *template.Template, node parse.Node) (string, bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return "", false
+		}
+		for _, c := range n.Nodes {
+			if name, ok := findUndefinedTemplate(tmpl, c); ok {
+				return name, true
+			}
+		}
+	case *parse.IfNode:
+		return findUndefinedTemplateInBranch(tmpl, &n.BranchNode)
+	case *parse.RangeNode:
+		return findUndefinedTemplateInBranch(tmpl, &n.BranchNode)
+	case *parse.WithNode:
+		return findUndefinedTemplateInBranch(tmpl, &n.BranchNode)
+	case *parse.TemplateNode:
+		if tmpl.Lookup(n.Name) == nil {
+			return n.Name, true
+		}
+	}
+	return "", false
+}
+
+func findUndefinedTemplateInBranch(tmpl *template.Template, n *parse.BranchNode) (string, bool) {
+	if name, ok := findUndefinedTemplate(tmpl, n.List); ok {
+		return name, true
+	}
+	return findUndefinedTemplate(tmpl, n.ElseList)
+}
+
 func (o *X509Options) AreWildcardNamesAllowed() bool {
 	if o == nil {
 		return true
@@ -158,24 +765,11 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 			}
 		}
 
-		// Load a template from a file if Template is not defined.
-		if opts.Template == "" && opts.TemplateFile != "" {
-			return []x509util.Option{
-				x509util.WithTemplateFile(step.Abs(opts.TemplateFile), data),
-			}
-		}
-
-		// Load a template from the Template fields
-		// 1. As a JSON in a string.
-		template := strings.TrimSpace(opts.Template)
-		if strings.HasPrefix(template, "{") {
-			return []x509util.Option{
-				x509util.WithTemplate(template, data),
-			}
-		}
-		// 2. As a base64 encoded JSON.
+		// Load the template and its partials. The template is loaded from
+		// TemplateFile if Template is not defined, or from Template as a JSON
+		// in a string or as a base64 encoded JSON.
 		return []x509util.Option{
-			x509util.WithTemplateBase64(template, data),
+			withCustomTemplate(opts, data),
 		}
 	}), nil
 }
@@ -0,0 +1,178 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultProofOfPossessionNonceLifetime is the default time a proof of
+// possession nonce can be used after it's issued.
+const DefaultProofOfPossessionNonceLifetime = 5 * time.Minute
+
+// minProofOfPossessionKeySize is the minimum size in bytes of the key used to
+// authenticate the proof of possession nonces.
+const minProofOfPossessionKeySize = 32
+
+const (
+	// ProofOfPossessionNonceClaim is the token claim with the nonce issued by
+	// the provisioner.
+	ProofOfPossessionNonceClaim = "popNonce"
+	// ProofOfPossessionSignatureClaim is the token claim with the base64url
+	// encoded signature of the nonce made with the key of the CSR.
+	ProofOfPossessionSignatureClaim = "popSignature"
+)
+
+// ProofOfPossessionNoncer is the interface implemented by the provisioners
+// that can require a proof of possession of the CSR key. NewProofOfPossessionNonce
+// returns a new nonce and the time it expires.
+type ProofOfPossessionNoncer interface {
+	NewProofOfPossessionNonce() (string, time.Time, error)
+}
+
+// ProofOfPossessionOptions requires the clients to prove they hold the private
+// key of the CSR by signing a nonce issued by the provisioner. The client first
+// gets a nonce from the CA, then signs it with the CSR key and adds the nonce
+// and the base64url encoded signature to the popNonce and popSignature claims
+// of the token. ECDSA and RSA keys sign the SHA-256 digest of the nonce, using
+// PKCS #1 v1.5 in the RSA case, and Ed25519 keys sign the nonce itself.
+//
+// The nonces expire after NonceLifetime, 5 minutes by default. They are
+// authenticated with Key, the base64 encoding of at least 32 random bytes. All
+// the CA instances sharing the same configuration accept the nonces issued by
+// any of them. If Key is not set, a key is generated when the provisioner is
+// initialized, and the nonces are only valid in the CA instance that issued
+// them, and until the provisioner is reloaded.
+type ProofOfPossessionOptions struct {
+	NonceLifetime Duration `json:"nonceLifetime,omitempty"`
+	Key           []byte   `json:"key,omitempty"`
+	key           []byte
+}
+
+// init validates the options and loads or generates the key used to
+// authenticate the nonces.
+func (o *ProofOfPossessionOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	if o.NonceLifetime.Value() < 0 {
+		return errors.New("proofOfPossession nonceLifetime cannot be negative")
+	}
+	if len(o.Key) > 0 {
+		if len(o.Key) < minProofOfPossessionKeySize {
+			return errors.Errorf("proofOfPossession key must have at least %d bytes", minProofOfPossessionKeySize)
+		}
+		o.key = o.Key
+		return nil
+	}
+	o.key = make([]byte, minProofOfPossessionKeySize)
+	if _, err := rand.Read(o.key); err != nil {
+		return errors.Wrap(err, "error generating proof of possession key")
+	}
+	return nil
+}
+
+func (o *ProofOfPossessionOptions) lifetime() time.Duration {
+	if d := o.NonceLifetime.Value(); d > 0 {
+		return d
+	}
+	return DefaultProofOfPossessionNonceLifetime
+}
+
+// newNonce returns a new nonce and the time it expires. The nonce is the
+// base64url encoding of its expiration time, 16 random bytes and the HMAC of
+// both.
+func (o *ProofOfPossessionOptions) newNonce() (string, time.Time, error) {
+	if o == nil {
+		return "", time.Time{}, errs.BadRequest("proof of possession is not enabled")
+	}
+	expiresAt := now().Add(o.lifetime()).Truncate(time.Second)
+	b := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(b, uint64(expiresAt.Unix()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "error generating proof of possession nonce")
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, o.sum(b)...)), expiresAt, nil
+}
+
+// sum returns the HMAC of the given data.
+func (o *ProofOfPossessionOptions) sum(b []byte) []byte {
+	mac := hmac.New(sha256.New, o.key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// newOptions validates the nonce in the given token and returns the validator
+// that checks its signature with the key of the CSR.
+func (o *ProofOfPossessionOptions) newOptions(token string) ([]SignOption, error) {
+	if o == nil {
+		return nil, nil
+	}
+	claims, err := unsafeParseSigned(token)
+	if err != nil {
+		return nil, errs.UnauthorizedErr(err, errs.WithMessage("error parsing token"))
+	}
+	nonce, _ := claims[ProofOfPossessionNonceClaim].(string)
+	sig, _ := claims[ProofOfPossessionSignatureClaim].(string)
+	if nonce == "" || sig == "" {
+		return nil, errs.Unauthorized("token does not contain the proof of possession claims")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+16+sha256.Size || !hmac.Equal(b[8+16:], o.sum(b[:8+16])) {
+		return nil, errs.Unauthorized("proof of possession nonce is not valid")
+	}
+	if expiresAt := time.Unix(int64(binary.BigEndian.Uint64(b)), 0); !now().Before(expiresAt) {
+		return nil, errs.Unauthorized("proof of possession nonce expired at %s", expiresAt.UTC().Format(time.RFC3339))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, errs.Unauthorized("proof of possession signature is not valid")
+	}
+
+	return []SignOption{
+		proofOfPossessionValidator{
+			Nonce:     nonce,
+			Signature: signature,
+		},
+	}, nil
+}
+
+// proofOfPossessionValidator is a CertificateRequestValidator that verifies
+// the signature of a nonce with the key of the certificate request.
+type proofOfPossessionValidator struct {
+	Nonce     string
+	Signature []byte
+}
+
+// Valid implements CertificateRequestValidator.
+func (v proofOfPossessionValidator) Valid(req *x509.CertificateRequest) error {
+	var algo x509.SignatureAlgorithm
+	switch req.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algo = x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		algo = x509.SHA256WithRSA
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	default:
+		return errs.BadRequest("certificate request key type %T is not supported by the proof of possession", req.PublicKey)
+	}
+	cert := &x509.Certificate{PublicKey: req.PublicKey}
+	if err := cert.CheckSignature(algo, []byte(v.Nonce), v.Signature); err != nil {
+		return errs.Forbidden("proof of possession signature does not match the certificate request key")
+	}
+	return nil
+}
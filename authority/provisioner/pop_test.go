@@ -0,0 +1,238 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+// signNonce signs the nonce like a client would do with the key of the CSR.
+func signNonce(t *testing.T, signer crypto.Signer, nonce string) string {
+	t.Helper()
+	var (
+		digest []byte
+		opts   crypto.SignerOpts = crypto.SHA256
+	)
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		digest, opts = []byte(nonce), crypto.Hash(0)
+	} else {
+		sum := sha256.Sum256([]byte(nonce))
+		digest = sum[:]
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	assert.FatalError(t, err)
+	return base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestProofOfPossessionOptions_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *ProofOfPossessionOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ProofOfPossessionOptions{}, false},
+		{"ok lifetime", &ProofOfPossessionOptions{NonceLifetime: Duration{Duration: time.Minute}}, false},
+		{"ok key", &ProofOfPossessionOptions{Key: make([]byte, 32)}, false},
+		{"fail negative lifetime", &ProofOfPossessionOptions{NonceLifetime: Duration{Duration: -time.Minute}}, true},
+		{"fail short key", &ProofOfPossessionOptions{Key: make([]byte, 31)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(); (err != nil) != tt.wantErr {
+				t.Errorf("ProofOfPossessionOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProofOfPossessionOptions_newNonce(t *testing.T) {
+	tm, fn := mockNow()
+	defer fn()
+
+	o := &ProofOfPossessionOptions{NonceLifetime: Duration{Duration: time.Minute}}
+	assert.FatalError(t, o.init())
+	nonce, expiresAt, err := o.newNonce()
+	assert.FatalError(t, err)
+	assert.Equals(t, tm.Add(time.Minute).Truncate(time.Second), expiresAt)
+
+	other, _, err := o.newNonce()
+	assert.FatalError(t, err)
+	assert.NotEquals(t, nonce, other)
+
+	o = &ProofOfPossessionOptions{}
+	assert.FatalError(t, o.init())
+	_, expiresAt, err = o.newNonce()
+	assert.FatalError(t, err)
+	assert.Equals(t, tm.Add(DefaultProofOfPossessionNonceLifetime).Truncate(time.Second), expiresAt)
+
+	var disabled *ProofOfPossessionOptions
+	_, _, err = disabled.newNonce()
+	assert.Error(t, err)
+}
+
+func TestProofOfPossessionOptions_newOptions(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	o := &ProofOfPossessionOptions{}
+	assert.FatalError(t, o.init())
+	other := &ProofOfPossessionOptions{}
+	assert.FatalError(t, other.init())
+
+	// Instances with the same configured key accept each other's nonces.
+	sharedKey := make([]byte, 32)
+	_, err = rand.Read(sharedKey)
+	assert.FatalError(t, err)
+	shared := &ProofOfPossessionOptions{Key: sharedKey}
+	assert.FatalError(t, shared.init())
+	sharedOther := &ProofOfPossessionOptions{Key: sharedKey}
+	assert.FatalError(t, sharedOther.init())
+
+	nonce, _, err := o.newNonce()
+	assert.FatalError(t, err)
+	otherNonce, _, err := other.newNonce()
+	assert.FatalError(t, err)
+	sharedNonce, _, err := sharedOther.newNonce()
+	assert.FatalError(t, err)
+
+	_, fn := mockNow()
+	expiredNonce, _, err := o.newNonce()
+	fn()
+	assert.FatalError(t, err)
+
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	assert.FatalError(t, err)
+	b[len(b)-1] ^= 0xff
+	tamperedNonce := base64.RawURLEncoding.EncodeToString(b)
+
+	newToken := func(nonce, sig string) string {
+		tok, err := generateOIDCTokenWithClaims("subject", "issuer", "audience", jwk, map[string]interface{}{
+			ProofOfPossessionNonceClaim:     nonce,
+			ProofOfPossessionSignatureClaim: sig,
+		})
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name         string
+		options      *ProofOfPossessionOptions
+		token        string
+		key          crypto.Signer
+		wantErr      bool
+		wantValidErr bool
+	}{
+		{"ok ecdsa", o, newToken(nonce, signNonce(t, ecKey, nonce)), ecKey, false, false},
+		{"ok rsa", o, newToken(nonce, signNonce(t, rsaKey, nonce)), rsaKey, false, false},
+		{"ok ed25519", o, newToken(nonce, signNonce(t, edKey, nonce)), edKey, false, false},
+		{"ok shared key", shared, newToken(sharedNonce, signNonce(t, ecKey, sharedNonce)), ecKey, false, false},
+		{"fail missing claims", o, newToken("", ""), ecKey, true, false},
+		{"fail expired", o, newToken(expiredNonce, signNonce(t, ecKey, expiredNonce)), ecKey, true, false},
+		{"fail other provisioner", o, newToken(otherNonce, signNonce(t, ecKey, otherNonce)), ecKey, true, false},
+		{"fail other shared key", o, newToken(sharedNonce, signNonce(t, ecKey, sharedNonce)), ecKey, true, false},
+		{"fail tampered nonce", o, newToken(tamperedNonce, signNonce(t, ecKey, tamperedNonce)), ecKey, true, false},
+		{"fail signature encoding", o, newToken(nonce, "not+base64url"), ecKey, true, false},
+		{"fail wrong key", o, newToken(nonce, signNonce(t, otherKey, nonce)), ecKey, false, true},
+		{"fail wrong nonce", o, newToken(nonce, signNonce(t, ecKey, otherNonce)), ecKey, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.options.newOptions(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProofOfPossessionOptions.newOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if assert.Len(t, 1, opts) {
+				v, ok := opts[0].(proofOfPossessionValidator)
+				assert.Fatal(t, ok, "option is not a proofOfPossessionValidator")
+				err := v.Valid(&x509.CertificateRequest{PublicKey: tt.key.Public()})
+				if (err != nil) != tt.wantValidErr {
+					t.Errorf("proofOfPossessionValidator.Valid() error = %v, wantErr %v", err, tt.wantValidErr)
+				}
+			}
+		})
+	}
+
+	var disabled *ProofOfPossessionOptions
+	opts, err := disabled.newOptions(newToken("", ""))
+	assert.NoError(t, err)
+	assert.Nil(t, opts)
+}
+
+func TestJWK_AuthorizeSign_proofOfPossession(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.ProofOfPossession = &ProofOfPossessionOptions{}
+	assert.FatalError(t, p.ProofOfPossession.init())
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	csrKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	nonce, _, err := p.NewProofOfPossessionNonce()
+	assert.FatalError(t, err)
+
+	newToken := func(extra map[string]interface{}) string {
+		tok, err := generateOIDCTokenWithClaims("subject", p.Name, testAudiences.Sign[0], key, extra)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), newToken(map[string]interface{}{
+			"sans":                          []string{"subject"},
+			ProofOfPossessionNonceClaim:     nonce,
+			ProofOfPossessionSignatureClaim: signNonce(t, csrKey, nonce),
+		}))
+		assert.FatalError(t, err)
+		var found int
+		for _, o := range opts {
+			if v, ok := o.(proofOfPossessionValidator); ok {
+				found++
+				assert.NoError(t, v.Valid(&x509.CertificateRequest{PublicKey: csrKey.Public()}))
+			}
+		}
+		assert.Equals(t, 1, found)
+	})
+
+	t.Run("fail missing proof", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newToken(map[string]interface{}{
+			"sans": []string{"subject"},
+		}))
+		assert.Error(t, err)
+	})
+}
+
+func TestProofOfPossessionNoncer(t *testing.T) {
+	var _ ProofOfPossessionNoncer = (*JWK)(nil)
+	var _ ProofOfPossessionNoncer = (*X5C)(nil)
+	var _ ProofOfPossessionNoncer = (*OIDC)(nil)
+
+	_, _, err := (&X5C{}).NewProofOfPossessionNonce()
+	assert.Error(t, err)
+	_, _, err = (&OIDC{}).NewProofOfPossessionNonce()
+	assert.Error(t, err)
+}
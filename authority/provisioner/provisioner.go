@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	stderrors "errors"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/errs"
@@ -33,6 +35,21 @@ type Interface interface {
 	AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Certificate, []SignOption, error)
 }
 
+// Checker is the interface implemented by provisioners that depend on external
+// services, e.g. the key set of an identity provider. Check verifies that the
+// services are reachable and return valid data.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// RevokeCertificateAuthorizer is the interface implemented by provisioners
+// whose revocation tokens do not include the serial number of the certificate.
+// These provisioners must check that the certificate to revoke belongs to the
+// identity in the token.
+type RevokeCertificateAuthorizer interface {
+	AuthorizeRevokeCertificate(ctx context.Context, token string, cert *x509.Certificate) error
+}
+
 // ErrAllowTokenReuse is an error that is returned by provisioners that allows
 // the reuse of tokens.
 //
@@ -141,6 +158,40 @@ func generateSignAudience(caURL, provisionerID string) (string, error) {
 	return u.ResolveReference(&url.URL{Path: "/1.0/sign", Fragment: provisionerID}).String(), nil
 }
 
+// tokenAlgorithms contains the JWS signature algorithms that can be used in
+// the allowedTokenAlgorithms of a provisioner. HMAC algorithms are not allowed,
+// the provisioners verify tokens with public keys.
+var tokenAlgorithms = []string{
+	jose.ES256, jose.ES384, jose.ES512, jose.EdDSA,
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+}
+
+// validateTokenAlgorithms returns an error if one of the given algorithms is
+// not a supported JWS signature algorithm.
+func validateTokenAlgorithms(algs []string) error {
+	for _, alg := range algs {
+		if !containsString(tokenAlgorithms, alg) {
+			return errors.Errorf("provisioner allowedTokenAlgorithms contains an unsupported algorithm %q", alg)
+		}
+	}
+	return nil
+}
+
+// checkTokenAlgorithm returns an error if the token is not signed with one of
+// the allowed algorithms. All algorithms are allowed if the list is empty.
+func checkTokenAlgorithm(jwt *jose.JSONWebToken, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, h := range jwt.Headers {
+		if !containsString(allowed, h.Algorithm) {
+			return errors.Errorf("token algorithm %q is not allowed", h.Algorithm)
+		}
+	}
+	return nil
+}
+
 // Type indicates the provisioner Type.
 type Type int
 
@@ -168,6 +219,10 @@ const (
 	TypeSCEP Type = 10
 	// TypeNebula is used to indicate the Nebula provisioners
 	TypeNebula Type = 11
+	// TypeEmail is used to indicate the Email provisioners
+	TypeEmail Type = 12
+	// TypeK8sCSR is used to indicate the K8sCSR provisioners
+	TypeK8sCSR Type = 13
 )
 
 // String returns the string representation of the type.
@@ -195,6 +250,10 @@ func (t Type) String() string {
 		return "SCEP"
 	case TypeNebula:
 		return "Nebula"
+	case TypeEmail:
+		return "Email"
+	case TypeK8sCSR:
+		return "K8sCSR"
 	default:
 		return ""
 	}
@@ -224,8 +283,53 @@ type Config struct {
 	// AuthorizeSSHRenewFunc is a function that returns nil if a given SSH
 	// certificate can be renewed.
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	// SANResolver returns additional subject alternative names for the X.509
+	// certificates authorized by the provisioners.
+	SANResolver SANResolver
+	// KeyBlocklist is used by the provisioners to reject the certificate
+	// requests with public keys known to be compromised.
+	KeyBlocklist KeyBlocklist
+	// TokenCache is used by the provisioners with replay protection to reject
+	// the reuse of a token. If it is not set, those provisioners use an
+	// in-memory cache.
+	TokenCache TokenCache
+	// RateLimiter is used by the provisioners with a rate limit. The keys are
+	// prefixed with the provisioner id, so it can be shared by all the
+	// provisioners and kept across reloads. If it is not set, those
+	// provisioners use their own in-memory rate limiter.
+	RateLimiter RateLimiter
+	// SignConcurrencyLimiters keeps the limiters of the concurrent sign
+	// operations of the provisioners across reloads. If it is not set, the
+	// limiters are created every time the provisioners are initialized.
+	SignConcurrencyLimiters *ConcurrencyLimiters
 	// WebhookClient is an http client to use in webhook request
 	WebhookClient *http.Client
+	// SecretResolvers are used by the provisioners to resolve the references
+	// to secrets in their configuration, indexed by the scheme of the
+	// reference. They take precedence over the DefaultSecretResolvers.
+	SecretResolvers map[string]SecretResolver
+	// LocalSecrets enables the file and env references to secrets. It must
+	// only be set for the provisioners in the configuration file, not for the
+	// ones managed with the admin API.
+	LocalSecrets bool
+	// EmailCodeStore is used by the email provisioners to keep the one-time
+	// codes. If it is not set, those provisioners use an in-memory store.
+	EmailCodeStore EmailCodeStore
+	// EmailSender is used by the email provisioners without an SMTP server
+	// to send the one-time codes.
+	EmailSender EmailSender
+	// X509SignerKeys are the public keys of the X.509 signers of the
+	// authority, indexed by the signer name. The key of the default
+	// intermediate uses the empty name. They are used to validate the
+	// signature algorithms configured in the provisioners.
+	X509SignerKeys map[string]crypto.PublicKey
+	// X509Roots are the root and federated certificates of the authority. They
+	// are used to verify the alternate chains configured in the provisioners.
+	X509Roots []*x509.Certificate
+	// DNSNamesIndex is true if the database of the authority keeps an index of
+	// the certificates by DNS name. It is required by the x509
+	// duplicateDNSNames policies.
+	DNSNamesIndex bool
 }
 
 type provisioner struct {
@@ -273,6 +377,10 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SCEP{}
 		case "nebula":
 			p = &Nebula{}
+		case "email":
+			p = &Email{}
+		case "k8scsr":
+			p = &K8sCSR{}
 		default:
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
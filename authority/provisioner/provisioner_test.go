@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"testing"
 
+	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/assert"
@@ -176,7 +177,6 @@ func TestUnimplementedMethods(t *testing.T) {
 		{"azure/sshRenew", &Azure{}, SSHRenewMethod},
 		{"azure/sshRekey", &Azure{}, SSHRekeyMethod},
 		{"azure/sshRevoke", &Azure{}, SSHRevokeMethod},
-		{"gcp/revoke", &GCP{}, RevokeMethod},
 		{"gcp/sshRenew", &GCP{}, SSHRenewMethod},
 		{"gcp/sshRekey", &GCP{}, SSHRekeyMethod},
 		{"gcp/sshRevoke", &GCP{}, SSHRevokeMethod},
@@ -249,3 +249,52 @@ func TestUnimplementedMethods(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateTokenAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		algs    []string
+		wantErr bool
+	}{
+		{"ok-empty", nil, false},
+		{"ok", []string{jose.ES256, jose.EdDSA, jose.RS256}, false},
+		{"fail-none", []string{"none"}, true},
+		{"fail-unknown", []string{jose.ES256, "ES1024"}, true},
+		{"fail-hs256", []string{jose.ES256, jose.HS256}, true},
+		{"fail-hs384", []string{jose.HS384}, true},
+		{"fail-hs512", []string{jose.HS512}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTokenAlgorithms(tt.algs); (err != nil) != tt.wantErr {
+				t.Errorf("validateTokenAlgorithms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkTokenAlgorithm(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	token, err := generateSimpleToken("issuer", "audience", jwk)
+	assert.FatalError(t, err)
+	jwt, err := jose.ParseSigned(token)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		allowed []string
+		wantErr bool
+	}{
+		{"ok-empty", nil, false},
+		{"ok", []string{jose.EdDSA, jose.ES256}, false},
+		{"fail", []string{jose.EdDSA, jose.ES384}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTokenAlgorithm(jwt, tt.allowed); (err != nil) != tt.wantErr {
+				t.Errorf("checkTokenAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
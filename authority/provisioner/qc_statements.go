@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// oidExtensionQCStatements is the OID of the Qualified Certificate Statements
+// extension defined in RFC 3739, section 3.2.6.
+var oidExtensionQCStatements = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+// QCStatement is a qualified certificate statement added to the QCStatements
+// extension, e.g. the statements defined in ETSI EN 319 412-5 for the eIDAS
+// qualified certificates. ID is the statement OID, e.g. "0.4.0.1862.1.1", and
+// Value is the optional DER-encoded statement info, encoded in base64 in the
+// JSON configuration.
+type QCStatement struct {
+	ID    string `json:"id"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// qcStatement is the ASN.1 structure of a QCStatement defined in RFC 3739,
+// section 3.2.6.
+type qcStatement struct {
+	StatementID   asn1.ObjectIdentifier
+	StatementInfo asn1.RawValue `asn1:"optional"`
+}
+
+// newQCStatementsModifier validates the statements configured in the
+// provisioner and returns the modifier that adds them to the certificates. It
+// returns nil if they are not configured.
+func newQCStatementsModifier(statements []QCStatement) (*qcStatementsModifier, error) {
+	if len(statements) == 0 {
+		return nil, nil
+	}
+
+	values := make([]qcStatement, len(statements))
+	seen := make(map[string]bool, len(statements))
+	for i, s := range statements {
+		oid, err := parseObjectIdentifier(s.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "x509.qcStatements id is not valid")
+		}
+		if seen[oid.String()] {
+			return nil, errors.Errorf("x509.qcStatements contains the duplicated statement %q", s.ID)
+		}
+		seen[oid.String()] = true
+		values[i].StatementID = oid
+		if len(s.Value) > 0 {
+			var v asn1.RawValue
+			if rest, err := asn1.Unmarshal(s.Value, &v); err != nil || len(rest) > 0 {
+				return nil, errors.Errorf("x509.qcStatements value of %q is not a valid DER-encoded value", s.ID)
+			}
+			values[i].StatementInfo = v
+		}
+	}
+
+	b, err := asn1.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling qualified certificate statements")
+	}
+	return &qcStatementsModifier{
+		extension: pkix.Extension{
+			Id:    oidExtensionQCStatements,
+			Value: b,
+		},
+	}, nil
+}
+
+// qcStatementsModifier is a CertificateModifier that sets the QCStatements
+// extension with the statements configured in the provisioner.
+type qcStatementsModifier struct {
+	extension pkix.Extension
+}
+
+// Modify sets the QCStatements extension of the certificate, replacing the
+// one added by the template.
+func (m *qcStatementsModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	extensions := make([]pkix.Extension, 0, len(cert.ExtraExtensions)+1)
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionQCStatements) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.ExtraExtensions = append(extensions, m.extension)
+	return nil
+}
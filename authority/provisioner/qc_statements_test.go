@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+var (
+	oidQcCompliance = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	oidQcType       = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+	oidQcTypeESign  = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 1}
+)
+
+func TestQCStatement_UnmarshalJSON(t *testing.T) {
+	var statements []QCStatement
+	assert.FatalError(t, json.Unmarshal([]byte(`[
+		{"id": "0.4.0.1862.1.1"},
+		{"id": "0.4.0.1862.1.6", "value": "MAgGBgQAjkYGAQ=="}
+	]`), &statements))
+	assert.Equals(t, []QCStatement{
+		{ID: "0.4.0.1862.1.1"},
+		{ID: "0.4.0.1862.1.6", Value: []byte{0x30, 0x08, 0x06, 0x06, 0x04, 0x00, 0x8e, 0x46, 0x06, 0x01}},
+	}, statements)
+}
+
+func Test_newQCStatementsModifier(t *testing.T) {
+	qcType, err := asn1.Marshal([]asn1.ObjectIdentifier{oidQcTypeESign})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		statements []QCStatement
+		wantNil    bool
+		wantErr    bool
+	}{
+		{"ok", []QCStatement{{ID: "0.4.0.1862.1.1"}}, false, false},
+		{"ok value", []QCStatement{{ID: "0.4.0.1862.1.1"}, {ID: "0.4.0.1862.1.6", Value: qcType}}, false, false},
+		{"ok empty", nil, true, false},
+		{"fail id", []QCStatement{{ID: "0.4.0.1862.1.one"}}, true, true},
+		{"fail empty id", []QCStatement{{Value: qcType}}, true, true},
+		{"fail duplicated id", []QCStatement{{ID: "0.4.0.1862.1.1"}, {ID: "0.4.0.1862.1.1"}}, true, true},
+		{"fail value", []QCStatement{{ID: "0.4.0.1862.1.6", Value: []byte("esign")}}, true, true},
+		{"fail value trailing data", []QCStatement{{ID: "0.4.0.1862.1.6", Value: append(qcType, 0x05, 0x00)}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newQCStatementsModifier(tt.statements)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newQCStatementsModifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+		})
+	}
+}
+
+func Test_qcStatementsModifier_Modify(t *testing.T) {
+	qcType, err := asn1.Marshal([]asn1.ObjectIdentifier{oidQcTypeESign})
+	assert.FatalError(t, err)
+	m, err := newQCStatementsModifier([]QCStatement{
+		{ID: "0.4.0.1862.1.1"},
+		{ID: "0.4.0.1862.1.6", Value: qcType},
+	})
+	assert.FatalError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionQCStatements, Value: []byte{0x30, 0x00}},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 5}, Value: []byte{0x05, 0x00}},
+		},
+	}
+	assert.FatalError(t, m.Modify(tmpl, SignOptions{}))
+	assert.Len(t, 2, tmpl.ExtraExtensions)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	var count int
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionQCStatements) {
+			continue
+		}
+		count++
+		assert.False(t, ext.Critical)
+
+		var statements []struct {
+			StatementID   asn1.ObjectIdentifier
+			StatementInfo asn1.RawValue `asn1:"optional"`
+		}
+		rest, err := asn1.Unmarshal(ext.Value, &statements)
+		assert.FatalError(t, err)
+		assert.Len(t, 0, rest)
+		if assert.Len(t, 2, statements) {
+			assert.Equals(t, oidQcCompliance, statements[0].StatementID)
+			assert.Len(t, 0, statements[0].StatementInfo.FullBytes)
+			assert.Equals(t, oidQcType, statements[1].StatementID)
+
+			var types []asn1.ObjectIdentifier
+			rest, err = asn1.Unmarshal(statements[1].StatementInfo.FullBytes, &types)
+			assert.FatalError(t, err)
+			assert.Len(t, 0, rest)
+			assert.Equals(t, []asn1.ObjectIdentifier{oidQcTypeESign}, types)
+		}
+	}
+	assert.Equals(t, 1, count)
+}
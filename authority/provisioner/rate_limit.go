@@ -0,0 +1,127 @@
+package provisioner
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimiterSize is the maximum number of keys kept by the default
+// in-memory rate limiter.
+const DefaultRateLimiterSize = 10000
+
+const (
+	// RateLimitKeyProvisioner limits the requests of all the clients of a
+	// provisioner together. It is the default.
+	RateLimitKeyProvisioner = "provisioner"
+	// RateLimitKeySubject limits the requests of each token subject
+	// independently.
+	RateLimitKeySubject = "subject"
+	// RateLimitKeyInstance limits the requests of each cloud instance
+	// independently. Provisioners without instances use the token subject.
+	RateLimitKeyInstance = "instance"
+)
+
+// RateLimitOptions configures the rate limit of the sign requests of a
+// provisioner. It uses a token bucket that is refilled with RequestsPerSecond
+// tokens per second up to Burst tokens.
+type RateLimitOptions struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst,omitempty"`
+	Key               string  `json:"key,omitempty"`
+}
+
+// Validate validates the rate limit options.
+func (o *RateLimitOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.RequestsPerSecond <= 0:
+		return errors.New("rateLimit requestsPerSecond must be greater than 0")
+	case o.Burst < 0:
+		return errors.New("rateLimit burst cannot be negative")
+	}
+	switch o.Key {
+	case "", RateLimitKeyProvisioner, RateLimitKeySubject, RateLimitKeyInstance:
+		return nil
+	default:
+		return errors.Errorf("rateLimit key %q is not valid", o.Key)
+	}
+}
+
+// GetBurst returns the burst of the rate limit, if it's not set it defaults to
+// one request.
+func (o *RateLimitOptions) GetBurst() int {
+	if o.Burst == 0 {
+		return 1
+	}
+	return o.Burst
+}
+
+// RateLimiter is the interface used by the provisioners to limit the rate of
+// sign requests. Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Allow reports whether a request with the given key can be processed
+	// with the given rate, in requests per second, and burst.
+	Allow(key string, limit float64, burst int) (bool, error)
+}
+
+type memoryRateLimiterEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+// memoryRateLimiter is a RateLimiter that keeps a token bucket per key in
+// memory. When it is full, the least recently used key is evicted.
+type memoryRateLimiter struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// NewMemoryRateLimiter returns an in-memory RateLimiter that keeps up to size
+// keys. An evicted key starts again with a full bucket.
+func NewMemoryRateLimiter(size int) RateLimiter {
+	if size <= 0 {
+		size = DefaultRateLimiterSize
+	}
+	return &memoryRateLimiter{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Allow implements the RateLimiter interface.
+func (l *memoryRateLimiter) Allow(key string, limit float64, burst int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		lim := e.Value.(*memoryRateLimiterEntry).limiter
+		if lim.Limit() != rate.Limit(limit) {
+			lim.SetLimit(rate.Limit(limit))
+		}
+		if lim.Burst() != burst {
+			lim.SetBurst(burst)
+		}
+		return lim.Allow(), nil
+	}
+
+	lim := rate.NewLimiter(rate.Limit(limit), burst)
+	l.items[key] = l.ll.PushFront(&memoryRateLimiterEntry{
+		key:     key,
+		limiter: lim,
+	})
+	for l.ll.Len() > l.size {
+		e := l.ll.Back()
+		l.ll.Remove(e)
+		delete(l.items, e.Value.(*memoryRateLimiterEntry).key)
+	}
+	return lim.Allow(), nil
+}
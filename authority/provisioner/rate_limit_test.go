@@ -0,0 +1,181 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func TestRateLimitOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *RateLimitOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &RateLimitOptions{RequestsPerSecond: 0.5}, false},
+		{"ok burst", &RateLimitOptions{RequestsPerSecond: 10, Burst: 20}, false},
+		{"ok provisioner", &RateLimitOptions{RequestsPerSecond: 1, Key: "provisioner"}, false},
+		{"ok subject", &RateLimitOptions{RequestsPerSecond: 1, Key: "subject"}, false},
+		{"ok instance", &RateLimitOptions{RequestsPerSecond: 1, Key: "instance"}, false},
+		{"fail requestsPerSecond", &RateLimitOptions{}, true},
+		{"fail negative requestsPerSecond", &RateLimitOptions{RequestsPerSecond: -1}, true},
+		{"fail burst", &RateLimitOptions{RequestsPerSecond: 1, Burst: -1}, true},
+		{"fail key", &RateLimitOptions{RequestsPerSecond: 1, Key: "ip"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RateLimitOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_memoryRateLimiter_Allow(t *testing.T) {
+	l := NewMemoryRateLimiter(2).(*memoryRateLimiter)
+
+	allow := func(key string, burst int) bool {
+		ok, err := l.Allow(key, 0.001, burst)
+		assert.FatalError(t, err)
+		return ok
+	}
+
+	assert.True(t, allow("a", 2))
+	assert.True(t, allow("a", 2))
+	assert.False(t, allow("a", 2))
+	assert.True(t, allow("b", 1))
+	assert.False(t, allow("b", 1))
+
+	// the least recently used key is evicted
+	assert.True(t, allow("c", 1))
+	assert.Equals(t, 2, l.ll.Len())
+	_, ok := l.items["a"]
+	assert.False(t, ok)
+	assert.True(t, allow("a", 1))
+
+	// tokens are refilled
+	ok, err := l.Allow("d", 1000, 1)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	ok, err = l.Allow("d", 1000, 1)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+}
+
+type failRateLimiter struct{}
+
+func (failRateLimiter) Allow(string, float64, int) (bool, error) {
+	return false, errors.New("an error")
+}
+
+func TestController_allowRequest(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+
+	newController := func(t *testing.T, rl *RateLimitOptions, limiter RateLimiter) *Controller {
+		t.Helper()
+		c, err := NewController(p, nil, Config{
+			Claims:      globalProvisionerClaims,
+			RateLimiter: limiter,
+		}, &Options{RateLimit: rl})
+		assert.FatalError(t, err)
+		return c
+	}
+
+	type call struct {
+		subject, instanceID string
+		wantErr             bool
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		ctl     *Controller
+		calls   []call
+		errCode int
+	}{
+		{"ok disabled", context.Background(), newController(t, nil, nil), []call{
+			{"foo", "", false}, {"foo", "", false},
+		}, 0},
+		{"ok provisioner", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001}, nil), []call{
+			{"foo", "", false}, {"bar", "", true},
+		}, http.StatusTooManyRequests},
+		{"ok subject", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001, Key: "subject"}, nil), []call{
+			{"foo", "1", false}, {"bar", "1", false}, {"foo", "2", true},
+		}, http.StatusTooManyRequests},
+		{"ok instance", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001, Key: "instance"}, nil), []call{
+			{"foo", "1", false}, {"foo", "2", false}, {"bar", "1", true},
+		}, http.StatusTooManyRequests},
+		{"ok instance fallback", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001, Key: "instance"}, nil), []call{
+			{"foo", "", false}, {"bar", "", false}, {"foo", "", true},
+		}, http.StatusTooManyRequests},
+		{"ok burst", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001, Burst: 2}, nil), []call{
+			{"foo", "", false}, {"foo", "", false}, {"foo", "", true},
+		}, http.StatusTooManyRequests},
+		{"ok dry run", NewContextWithDryRun(context.Background()), newController(t, &RateLimitOptions{RequestsPerSecond: 0.001}, nil), []call{
+			{"foo", "", false}, {"foo", "", false},
+		}, 0},
+		{"fail limiter", context.Background(), newController(t, &RateLimitOptions{RequestsPerSecond: 1}, failRateLimiter{}), []call{
+			{"foo", "", true},
+		}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range tt.calls {
+				err := tt.ctl.allowRequest(tt.ctx, c.subject, c.instanceID)
+				if (err != nil) != c.wantErr {
+					t.Fatalf("Controller.allowRequest() error = %v, wantErr %v", err, c.wantErr)
+				}
+				if err != nil {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, tt.errCode, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
+
+func TestNewController_rateLimit(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	_, err = NewController(p, nil, Config{Claims: globalProvisionerClaims}, &Options{
+		RateLimit: &RateLimitOptions{RequestsPerSecond: 0},
+	})
+	assert.Error(t, err)
+}
+
+func TestJWK_AuthorizeSign_rateLimit(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{RateLimit: &RateLimitOptions{RequestsPerSecond: 0.001, Key: "subject"}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	newToken := func(sub string) string {
+		tok, err := generateToken(sub, p.Name, testAudiences.Sign[0], "", []string{"foo.smallstep.com"}, time.Now(), key)
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	_, err = p.AuthorizeSign(context.Background(), newToken("foo"))
+	assert.FatalError(t, err)
+	_, err = p.AuthorizeSign(context.Background(), newToken("bar"))
+	assert.FatalError(t, err)
+
+	_, err = p.AuthorizeSign(context.Background(), newToken("foo"))
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusTooManyRequests, sc.StatusCode())
+	var ae *AuthorizeError
+	assert.Fatal(t, errors.As(err, &ae))
+	assert.Equals(t, ReasonRateLimited, ae.Reason)
+}
@@ -0,0 +1,114 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// StepOIDRenewAfter is the default OID of the extension with the recommended
+// renewal time of a certificate.
+var StepOIDRenewAfter = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 4)...)
+
+// DefaultRenewAfterFraction is the default fraction of the validity of a
+// certificate after which its renewal is recommended.
+const DefaultRenewAfterFraction = 2.0 / 3.0
+
+// RenewAfterOptions adds an extension with the recommended renewal time to the
+// X.509 certificates, so clients do not need to hardcode when to renew them.
+// The renewal time is the notBefore of the certificate plus the given Fraction
+// of its validity, two thirds by default, and it is encoded as an ASN.1
+// GeneralizedTime. The extension uses the given OID, or StepOIDRenewAfter if
+// it is not set.
+type RenewAfterOptions struct {
+	OID      x509util.ObjectIdentifier `json:"oid,omitempty"`
+	Fraction float64                   `json:"fraction,omitempty"`
+}
+
+// validate validates the renew after options.
+func (o *RenewAfterOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Fraction < 0 || o.Fraction >= 1 {
+		return errors.New("x509.renewAfter fraction must be greater than 0 and less than 1")
+	}
+	if len(o.OID) > 0 && len(o.OID) < 2 {
+		return errors.Errorf("x509.renewAfter oid %s is not valid", asn1.ObjectIdentifier(o.OID))
+	}
+	return nil
+}
+
+// GetOID returns the OID of the renewal time extension.
+func (o *RenewAfterOptions) GetOID() asn1.ObjectIdentifier {
+	if o == nil || len(o.OID) == 0 {
+		return StepOIDRenewAfter
+	}
+	return asn1.ObjectIdentifier(o.OID)
+}
+
+// GetFraction returns the fraction of the validity of the certificates after
+// which their renewal is recommended.
+func (o *RenewAfterOptions) GetFraction() float64 {
+	if o == nil || o.Fraction == 0 {
+		return DefaultRenewAfterFraction
+	}
+	return o.Fraction
+}
+
+// NewExtension returns the extension with the recommended renewal time of a
+// certificate with the given validity.
+func (o *RenewAfterOptions) NewExtension(notBefore, notAfter time.Time) (pkix.Extension, error) {
+	d := time.Duration(float64(notAfter.Sub(notBefore)) * o.GetFraction())
+	b, err := asn1.MarshalWithParams(notBefore.Add(d).UTC().Truncate(time.Second), "generalized")
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling renewAfter extension")
+	}
+	return pkix.Extension{
+		Id:    o.GetOID(),
+		Value: b,
+	}, nil
+}
+
+// GetRenewAfter returns the recommended renewal time of the given certificate
+// from the extension with the given OID. It returns false if the certificate
+// does not have the extension.
+func GetRenewAfter(cert *x509.Certificate, oid asn1.ObjectIdentifier) (time.Time, bool) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(oid) {
+			var t time.Time
+			if _, err := asn1.UnmarshalWithParams(e.Value, &t, "generalized"); err != nil {
+				return time.Time{}, false
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// renewAfterEnforcer is a CertificateEnforcer that adds the extension with the
+// recommended renewal time computed from the final validity of the
+// certificate, replacing the one added by the template, if any.
+type renewAfterEnforcer struct {
+	options *RenewAfterOptions
+}
+
+// Enforce implements CertificateEnforcer.
+func (e renewAfterEnforcer) Enforce(cert *x509.Certificate) error {
+	ext, err := e.options.NewExtension(cert.NotBefore, cert.NotAfter)
+	if err != nil {
+		return err
+	}
+	exts := cert.ExtraExtensions[:0:0]
+	for _, x := range cert.ExtraExtensions {
+		if !x.Id.Equal(ext.Id) {
+			exts = append(exts, x)
+		}
+	}
+	cert.ExtraExtensions = append(exts, ext)
+	return nil
+}
@@ -0,0 +1,118 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestRenewAfterOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *RenewAfterOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok default", &RenewAfterOptions{}, false},
+		{"ok", &RenewAfterOptions{OID: x509util.ObjectIdentifier{1, 2, 3, 4}, Fraction: 0.75}, false},
+		{"fail negative fraction", &RenewAfterOptions{Fraction: -0.5}, true},
+		{"fail fraction", &RenewAfterOptions{Fraction: 1}, true},
+		{"fail oid", &RenewAfterOptions{OID: x509util.ObjectIdentifier{1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RenewAfterOptions.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenewAfterOptions_getters(t *testing.T) {
+	var o *RenewAfterOptions
+	assert.Equals(t, StepOIDRenewAfter, o.GetOID())
+	assert.Equals(t, DefaultRenewAfterFraction, o.GetFraction())
+
+	o = &RenewAfterOptions{OID: x509util.ObjectIdentifier{1, 2, 3, 4}, Fraction: 0.5}
+	assert.Equals(t, asn1.ObjectIdentifier{1, 2, 3, 4}, o.GetOID())
+	assert.Equals(t, 0.5, o.GetFraction())
+}
+
+func Test_renewAfterEnforcer_Enforce(t *testing.T) {
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(24 * time.Hour)
+	oid := asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	tests := []struct {
+		name    string
+		options *RenewAfterOptions
+		exts    []pkix.Extension
+		oid     asn1.ObjectIdentifier
+		want    time.Time
+		wantLen int
+	}{
+		{"ok default", &RenewAfterOptions{}, nil, StepOIDRenewAfter, notBefore.Add(16 * time.Hour), 1},
+		{"ok fraction", &RenewAfterOptions{Fraction: 0.25}, nil, StepOIDRenewAfter, notBefore.Add(6 * time.Hour), 1},
+		{"ok oid", &RenewAfterOptions{OID: x509util.ObjectIdentifier(oid)}, nil, oid, notBefore.Add(16 * time.Hour), 1},
+		{"ok replace template", &RenewAfterOptions{}, []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{0x05, 0x00}},
+			{Id: StepOIDRenewAfter, Value: []byte{0x05, 0x00}},
+		}, StepOIDRenewAfter, notBefore.Add(16 * time.Hour), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{
+				NotBefore:       notBefore,
+				NotAfter:        notAfter,
+				ExtraExtensions: tt.exts,
+			}
+			assert.FatalError(t, renewAfterEnforcer{options: tt.options}.Enforce(cert))
+
+			assert.Len(t, tt.wantLen, cert.ExtraExtensions)
+
+			// Marshaled extensions are in cert.Extensions of parsed certificates.
+			cert.Extensions = cert.ExtraExtensions
+			got, ok := GetRenewAfter(cert, tt.oid)
+			assert.True(t, ok)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	_, ok := GetRenewAfter(&x509.Certificate{}, StepOIDRenewAfter)
+	assert.False(t, ok)
+	_, ok = GetRenewAfter(&x509.Certificate{Extensions: []pkix.Extension{
+		{Id: StepOIDRenewAfter, Value: []byte{0x05, 0x00}},
+	}}, StepOIDRenewAfter)
+	assert.False(t, ok)
+}
+
+func TestJWK_AuthorizeSign_renewAfter(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{X509: &X509Options{RenewAfter: &RenewAfterOptions{Fraction: 0.5}}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.Equals(t, p.Options.X509.RenewAfter, p.GetController().GetRenewAfter())
+
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	tok, err := generateToken("subject", p.Name, testAudiences.Sign[0], "", []string{"subject"}, time.Now(), key)
+	assert.FatalError(t, err)
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	var found int
+	for _, o := range opts {
+		if _, ok := o.(renewAfterEnforcer); ok {
+			found++
+		}
+	}
+	assert.Equals(t, 1, found)
+
+	p.Options = &Options{X509: &X509Options{RenewAfter: &RenewAfterOptions{Fraction: 2}}}
+	assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+}
@@ -0,0 +1,191 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/cli-utils/step"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// SANManifestOptions restricts the SANs of the certificates of each cloud
+// instance to the ones listed for its id in a signed manifest. The manifest
+// file is a JWS, in the compact or JSON serialization, signed with the given
+// key, and its payload is a SANManifest. The file is checked for changes on
+// every sign request and reloaded if it has been modified; if the new version
+// cannot be verified the previous one is kept.
+//
+// The instances that are not in the manifest are rejected if Strict is true,
+// and their SANs are not restricted otherwise. The manifest is only supported
+// by the AWS, GCP and Azure provisioners. AWS and GCP use the instance id, and
+// Azure uses "<subscription>/<resource-group>/<vm-name>".
+type SANManifestOptions struct {
+	File   string           `json:"file"`
+	Key    *jose.JSONWebKey `json:"key"`
+	Strict bool             `json:"strict,omitempty"`
+}
+
+// Validate validates the SAN manifest options.
+func (o *SANManifestOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.File == "":
+		return errors.New("sanManifest file cannot be empty")
+	case o.Key == nil:
+		return errors.New("sanManifest key cannot be empty")
+	case !o.Key.IsPublic():
+		return errors.New("sanManifest key must be a public key")
+	}
+	return nil
+}
+
+// SANManifest is the payload of the signed manifest with the SANs allowed for
+// each instance id.
+type SANManifest struct {
+	Instances map[string][]string `json:"instances"`
+}
+
+// sanManifest is a SAN manifest loaded from a file. Like the template files,
+// the file is reloaded when it's modified.
+type sanManifest struct {
+	mu        sync.Mutex
+	path      string
+	key       *jose.JSONWebKey
+	strict    bool
+	modTime   time.Time
+	size      int64
+	instances map[string][]string
+}
+
+// newSANManifest loads and verifies the manifest in the given options. It
+// returns nil if the options are nil.
+func newSANManifest(o *SANManifestOptions) (*sanManifest, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	m := &sanManifest{
+		path:   step.Abs(o.File),
+		key:    o.Key,
+		strict: o.Strict,
+	}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Lookup returns the SANs allowed for the given instance id, reloading the
+// manifest if the file has been modified. It returns false if the instance is
+// not in the manifest.
+func (m *sanManifest) Lookup(instanceID string) ([]string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fi, err := os.Stat(m.path); err == nil && (!fi.ModTime().Equal(m.modTime) || fi.Size() != m.size) {
+		if err := m.reload(); err != nil {
+			log.Printf("error reloading SAN manifest %s, using the previous version: %v", m.path, err)
+		}
+	}
+	sans, ok := m.instances[instanceID]
+	return sans, ok
+}
+
+// reload reads and verifies the file and, if it's valid, replaces the
+// instances of the manifest. The caller must hold the lock, or have exclusive
+// access.
+func (m *sanManifest) reload() error {
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading SAN manifest")
+	}
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading SAN manifest")
+	}
+	jws, err := jose.ParseJWS(string(b))
+	if err != nil {
+		return errors.Wrapf(err, "error parsing SAN manifest %s", m.path)
+	}
+	payload, err := jws.Verify(m.key)
+	if err != nil {
+		return errors.Wrapf(err, "error verifying SAN manifest %s", m.path)
+	}
+	var manifest SANManifest
+	if err := json.Unmarshal(payload, &manifest); err != nil {
+		return errors.Wrapf(err, "error unmarshaling SAN manifest %s", m.path)
+	}
+	m.modTime = fi.ModTime()
+	m.size = fi.Size()
+	m.instances = manifest.Instances
+	return nil
+}
+
+// newOptions returns the sign options that restrict the SANs of the
+// certificate of the given instance. It returns an error if the instance is
+// not in the manifest and the manifest is strict.
+func (m *sanManifest) newOptions(instanceID string) ([]SignOption, error) {
+	if m == nil {
+		return nil, nil
+	}
+	sans, ok := m.Lookup(instanceID)
+	switch {
+	case ok:
+		return []SignOption{newManifestSANsValidator(sans)}, nil
+	case m.strict:
+		return nil, authorizeErr(ReasonInvalidSubject, errs.Forbidden("instance %q is not in the SAN manifest", instanceID))
+	default:
+		return nil, nil
+	}
+}
+
+// manifestSANsValidator is a CertificateValidator that checks that all the
+// SANs of the certificate are in the manifest.
+type manifestSANsValidator map[string]bool
+
+func newManifestSANsValidator(sans []string) manifestSANsValidator {
+	v := make(manifestSANsValidator, len(sans))
+	for _, s := range sans {
+		if ip := net.ParseIP(s); ip != nil {
+			s = ip.String()
+		}
+		v[s] = true
+	}
+	return v
+}
+
+// Valid implements CertificateValidator.
+func (v manifestSANsValidator) Valid(cert *x509.Certificate, _ SignOptions) error {
+	for _, s := range cert.DNSNames {
+		if !v[s] {
+			return errs.Forbidden("certificate DNS name %q is not in the SAN manifest", s)
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if !v[ip.String()] {
+			return errs.Forbidden("certificate IP address %q is not in the SAN manifest", ip)
+		}
+	}
+	for _, s := range cert.EmailAddresses {
+		if !v[s] {
+			return errs.Forbidden("certificate email address %q is not in the SAN manifest", s)
+		}
+	}
+	for _, u := range cert.URIs {
+		if !v[u.String()] {
+			return errs.Forbidden("certificate URI %q is not in the SAN manifest", u)
+		}
+	}
+	return nil
+}
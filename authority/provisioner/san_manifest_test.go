@@ -0,0 +1,287 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+// writeSANManifest writes the given manifest signed with the given key.
+func writeSANManifest(t *testing.T, filename string, key *jose.JSONWebKey, manifest SANManifest) {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key.Key}, nil)
+	assert.FatalError(t, err)
+	payload, err := json.Marshal(manifest)
+	assert.FatalError(t, err)
+	jws, err := signer.Sign(payload)
+	assert.FatalError(t, err)
+	raw, err := jws.CompactSerialize()
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(filename, []byte(raw), 0600))
+}
+
+func TestSANManifestOptions_Validate(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+
+	tests := []struct {
+		name    string
+		options *SANManifestOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &SANManifestOptions{File: "manifest.jws", Key: &pub}, false},
+		{"fail file", &SANManifestOptions{Key: &pub}, true},
+		{"fail key", &SANManifestOptions{File: "manifest.jws"}, true},
+		{"fail private key", &SANManifestOptions{File: "manifest.jws", Key: key}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SANManifestOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newSANManifest(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+	other, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.jws")
+	writeSANManifest(t, ok, key, SANManifest{Instances: map[string][]string{
+		"i-1": {"foo.internal"},
+	}})
+	badSignature := filepath.Join(dir, "bad-signature.jws")
+	writeSANManifest(t, badSignature, other, SANManifest{Instances: map[string][]string{
+		"i-1": {"foo.internal"},
+	}})
+	notJWS := filepath.Join(dir, "not-jws.json")
+	assert.FatalError(t, os.WriteFile(notJWS, []byte(`{"instances":{}}`), 0600))
+
+	tests := []struct {
+		name    string
+		options *SANManifestOptions
+		wantNil bool
+		wantErr bool
+	}{
+		{"ok nil", nil, true, false},
+		{"ok", &SANManifestOptions{File: ok, Key: &pub}, false, false},
+		{"fail options", &SANManifestOptions{File: ok}, true, true},
+		{"fail missing", &SANManifestOptions{File: filepath.Join(dir, "missing.jws"), Key: &pub}, true, true},
+		{"fail signature", &SANManifestOptions{File: badSignature, Key: &pub}, true, true},
+		{"fail not jws", &SANManifestOptions{File: notJWS, Key: &pub}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSANManifest(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSANManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+		})
+	}
+}
+
+func Test_sanManifest_reload(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+	other, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "manifest.jws")
+	writeSANManifest(t, filename, key, SANManifest{Instances: map[string][]string{
+		"i-1": {"foo.internal"},
+	}})
+	m, err := newSANManifest(&SANManifestOptions{File: filename, Key: &pub})
+	assert.FatalError(t, err)
+
+	sans, ok := m.Lookup("i-1")
+	assert.True(t, ok)
+	assert.Equals(t, []string{"foo.internal"}, sans)
+	_, ok = m.Lookup("i-2")
+	assert.False(t, ok)
+
+	// The modified manifest is reloaded.
+	touch := func(d time.Duration) {
+		now := time.Now().Add(d)
+		assert.FatalError(t, os.Chtimes(filename, now, now))
+	}
+	writeSANManifest(t, filename, key, SANManifest{Instances: map[string][]string{
+		"i-2": {"bar.internal", "10.0.0.2"},
+	}})
+	touch(time.Minute)
+	_, ok = m.Lookup("i-1")
+	assert.False(t, ok)
+	sans, ok = m.Lookup("i-2")
+	assert.True(t, ok)
+	assert.Equals(t, []string{"bar.internal", "10.0.0.2"}, sans)
+
+	// A manifest that cannot be verified is ignored.
+	writeSANManifest(t, filename, other, SANManifest{Instances: map[string][]string{
+		"i-3": {"zar.internal"},
+	}})
+	touch(2 * time.Minute)
+	_, ok = m.Lookup("i-3")
+	assert.False(t, ok)
+	_, ok = m.Lookup("i-2")
+	assert.True(t, ok)
+
+	// And so is a deleted one.
+	assert.FatalError(t, os.Remove(filename))
+	_, ok = m.Lookup("i-2")
+	assert.True(t, ok)
+}
+
+func Test_sanManifest_newOptions(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+
+	filename := filepath.Join(t.TempDir(), "manifest.jws")
+	writeSANManifest(t, filename, key, SANManifest{Instances: map[string][]string{
+		"i-1": {"foo.internal", "10.0.0.1", "::1", "foo@internal", "spiffe://internal/foo"},
+	}})
+	m, err := newSANManifest(&SANManifestOptions{File: filename, Key: &pub})
+	assert.FatalError(t, err)
+	strict, err := newSANManifest(&SANManifestOptions{File: filename, Key: &pub, Strict: true})
+	assert.FatalError(t, err)
+
+	var nilManifest *sanManifest
+	opts, err := nilManifest.newOptions("i-1")
+	assert.NoError(t, err)
+	assert.Len(t, 0, opts)
+
+	opts, err = m.newOptions("i-2")
+	assert.NoError(t, err)
+	assert.Len(t, 0, opts)
+
+	_, err = strict.newOptions("i-2")
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+	}
+
+	opts, err = strict.newOptions("i-1")
+	assert.FatalError(t, err)
+	assert.Len(t, 1, opts)
+	v, ok := opts[0].(manifestSANsValidator)
+	assert.Fatal(t, ok, "option is not a manifestSANsValidator")
+
+	mustURL := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		assert.FatalError(t, err)
+		return u
+	}
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{
+			DNSNames:       []string{"foo.internal"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("0:0:0:0:0:0:0:1")},
+			EmailAddresses: []string{"foo@internal"},
+			URIs:           []*url.URL{mustURL("spiffe://internal/foo")},
+		}, false},
+		{"ok empty", &x509.Certificate{}, false},
+		{"fail dns", &x509.Certificate{DNSNames: []string{"foo.internal", "bar.internal"}}, true},
+		{"fail ip", &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}}, true},
+		{"fail email", &x509.Certificate{EmailAddresses: []string{"bar@internal"}}, true},
+		{"fail uri", &x509.Certificate{URIs: []*url.URL{mustURL("spiffe://internal/bar")}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Valid(tt.cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("manifestSANsValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewController_sanManifest(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+	filename := filepath.Join(t.TempDir(), "manifest.jws")
+	writeSANManifest(t, filename, key, SANManifest{})
+	options := &Options{SANManifest: &SANManifestOptions{File: filename, Key: &pub}}
+
+	for _, p := range []Interface{&AWS{}, &GCP{}, &Azure{}} {
+		_, err := NewController(p, nil, Config{Claims: globalProvisionerClaims}, options)
+		assert.NoError(t, err)
+	}
+	_, err = NewController(&JWK{}, nil, Config{Claims: globalProvisionerClaims}, options)
+	assert.Error(t, err)
+}
+
+func TestAWS_AuthorizeSign_sanManifest(t *testing.T) {
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+	filename := filepath.Join(t.TempDir(), "manifest.jws")
+	writeSANManifest(t, filename, key, SANManifest{Instances: map[string][]string{
+		"other-instance-id": {"foo.internal"},
+	}})
+	p.ctl, err = NewController(p, p.Claims, Config{
+		Audiences: testAudiences.WithFragment("aws/" + p.Name),
+	}, &Options{SANManifest: &SANManifestOptions{File: filename, Key: &pub, Strict: true}})
+	assert.FatalError(t, err)
+
+	newToken := func() string {
+		tok, err := p.GetIdentityToken("foo.local", "https://ca.smallstep.com")
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	// The instance is not in the manifest.
+	_, err = p.AuthorizeSign(context.Background(), newToken())
+	if assert.Error(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+	}
+
+	// The instance is added to the manifest.
+	writeSANManifest(t, filename, key, SANManifest{Instances: map[string][]string{
+		"instance-id": {"foo.local", "127.0.0.1"},
+	}})
+	now := time.Now().Add(time.Minute)
+	assert.FatalError(t, os.Chtimes(filename, now, now))
+
+	opts, err := p.AuthorizeSign(context.Background(), newToken())
+	assert.FatalError(t, err)
+	var found int
+	for _, o := range opts {
+		if v, ok := o.(manifestSANsValidator); ok {
+			found++
+			assert.NoError(t, v.Valid(&x509.Certificate{DNSNames: []string{"foo.local"}}, SignOptions{}))
+			assert.Error(t, v.Valid(&x509.Certificate{DNSNames: []string{"bar.local"}}, SignOptions{}))
+		}
+	}
+	assert.Equals(t, 1, found)
+}
@@ -90,6 +90,16 @@ func (s *SCEP) GetType() Type {
 	return TypeSCEP
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (s *SCEP) GetClaimer() *Claimer {
+	return s.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (s *SCEP) GetController() *Controller {
+	return s.ctl
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (s *SCEP) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -240,6 +250,8 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("provisioner type cannot be empty")
 	case s.Name == "":
 		return errors.New("provisioner name cannot be empty")
+	case s.ForceCN && s.GetOptions().GetX509Options().IsCommonNameForbidden():
+		return errors.New("forceCN cannot be used with x509.forbidCommonName")
 	}
 
 	// Default to 2048 bits minimum public key length (for CSRs) if not set
@@ -389,7 +401,7 @@ func (s *SCEP) Init(config Config) (err error) {
 // in the SCEP protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
 func (s *SCEP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
-	return []SignOption{
+	opts := []SignOption{
 		s,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeSCEP, s.Name, "").WithControllerOptions(s.ctl),
@@ -397,10 +409,11 @@ func (s *SCEP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
 		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
-		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
+		s.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
 		s.ctl.newWebhookController(nil, linkedca.Webhook_X509),
-	}, nil
+	}
+	return append(opts, s.ctl.newX509SignOptions()...), nil
 }
 
 // GetCapabilities returns the CA capabilities
@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SecretResolver is the interface used to resolve the references to secrets
+// in the provisioner configuration, e.g. vault://secret/data/step#encryptedKey.
+// ResolveSecret is called in Init with the parsed reference, and the value
+// returned replaces the reference. An error fails the initialization of the
+// provisioner.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref *url.URL) ([]byte, error)
+}
+
+// SecretResolverFunc is an adapter to use a function as a SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref *url.URL) ([]byte, error)
+
+// ResolveSecret implements SecretResolver and calls the function.
+func (fn SecretResolverFunc) ResolveSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	return fn(ctx, ref)
+}
+
+// DefaultSecretResolvers returns the resolvers of local secrets, indexed by
+// scheme. They are only used if LocalSecrets is set in the provisioner config:
+//
+//   - file:///path/to/secret reads the secret from a file.
+//   - env://NAME reads the secret from an environment variable.
+func DefaultSecretResolvers() map[string]SecretResolver {
+	return map[string]SecretResolver{
+		"file": SecretResolverFunc(resolveFileSecret),
+		"env":  SecretResolverFunc(resolveEnvSecret),
+	}
+}
+
+func resolveFileSecret(_ context.Context, ref *url.URL) ([]byte, error) {
+	if ref.Path == "" {
+		return nil, errors.Errorf("secret reference %q does not have a path", ref.Redacted())
+	}
+	b, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading secret %q", ref.Redacted())
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+func resolveEnvSecret(_ context.Context, ref *url.URL) ([]byte, error) {
+	name := ref.Host
+	if name == "" {
+		name = ref.Opaque
+	}
+	if name == "" {
+		return nil, errors.Errorf("secret reference %q does not have a variable name", ref.Redacted())
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil, errors.Errorf("environment variable %q is not set", name)
+	}
+	return []byte(strings.TrimSpace(v)), nil
+}
+
+// isSecretReference returns true if the given value is a reference to a
+// secret instead of the secret itself. Encrypted keys are compact or JSON
+// serialized JWEs, so they never contain "://".
+func isSecretReference(v string) bool {
+	return strings.Contains(v, "://")
+}
+
+// resolveSecret returns the value of the secret if v is a reference, or v
+// otherwise. The resolvers in the config are used before the default ones,
+// that are only available if the config enables local secrets.
+func resolveSecret(ctx context.Context, config Config, name, v string) (string, error) {
+	if !isSecretReference(v) {
+		return v, nil
+	}
+	ref, err := url.Parse(v)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing provisioner %s reference", name)
+	}
+	resolver, ok := config.SecretResolvers[ref.Scheme]
+	if !ok && config.LocalSecrets {
+		resolver, ok = DefaultSecretResolvers()[ref.Scheme]
+	}
+	if !ok {
+		return "", errors.Errorf("provisioner %s reference scheme %q is not supported", name, ref.Scheme)
+	}
+	b, err := resolver.ResolveSecret(ctx, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolving provisioner %s", name)
+	}
+	if len(b) == 0 {
+		return "", errors.Errorf("provisioner %s reference %q resolved to an empty value", name, ref.Redacted())
+	}
+	return string(b), nil
+}
@@ -0,0 +1,137 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_resolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "encrypted.jwe")
+	assert.FatalError(t, os.WriteFile(fn, []byte("from-file\n"), 0600))
+	empty := filepath.Join(dir, "empty")
+	assert.FatalError(t, os.WriteFile(empty, nil, 0600))
+	t.Setenv("STEP_TEST_ENCRYPTED_KEY", "from-env")
+
+	vault := SecretResolverFunc(func(ctx context.Context, ref *url.URL) ([]byte, error) {
+		if ref.Host+ref.Path == "secret/data/step" && ref.Fragment == "encryptedKey" {
+			return []byte("from-vault"), nil
+		}
+		return nil, errors.New("secret not found")
+	})
+	local := Config{LocalSecrets: true}
+	config := Config{SecretResolvers: map[string]SecretResolver{
+		"vault": vault,
+		"env": SecretResolverFunc(func(ctx context.Context, ref *url.URL) ([]byte, error) {
+			return []byte("overridden"), nil
+		}),
+	}}
+
+	tests := []struct {
+		name    string
+		config  Config
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"ok inline", Config{}, "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0.a.b.c.d", "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0.a.b.c.d", false},
+		{"ok empty", Config{}, "", "", false},
+		{"ok file", local, "file://" + fn, "from-file", false},
+		{"ok env", local, "env://STEP_TEST_ENCRYPTED_KEY", "from-env", false},
+		{"ok vault", config, "vault://secret/data/step#encryptedKey", "from-vault", false},
+		{"ok override", config, "env://STEP_TEST_ENCRYPTED_KEY", "overridden", false},
+		{"fail scheme", Config{}, "vault://secret/data/step#encryptedKey", "", true},
+		{"fail vault", config, "vault://secret/data/other#encryptedKey", "", true},
+		{"fail file not local", Config{}, "file://" + fn, "", true},
+		{"fail env not local", Config{}, "env://STEP_TEST_ENCRYPTED_KEY", "", true},
+		{"fail missing file", local, "file://" + filepath.Join(dir, "missing"), "", true},
+		{"fail empty file", local, "file://" + empty, "", true},
+		{"fail missing env", local, "env://STEP_TEST_MISSING_KEY", "", true},
+		{"fail parse", local, "file://%zz", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret(context.Background(), tt.config, "encryptedKey", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestJWK_Init_secretReferences(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	encryptedKey := p.EncryptedKey
+	previous, err := generateJWK()
+	assert.FatalError(t, err)
+
+	t.Setenv("STEP_TEST_ENCRYPTED_KEY", encryptedKey)
+	vault := SecretResolverFunc(func(ctx context.Context, ref *url.URL) ([]byte, error) {
+		if ref.Fragment == "encryptedKey" {
+			return []byte(previous.EncryptedKey), nil
+		}
+		return []byte("not a jwe"), nil
+	})
+	config := Config{
+		Claims:          globalProvisionerClaims,
+		Audiences:       testAudiences,
+		SecretResolvers: map[string]SecretResolver{"vault": vault},
+		LocalSecrets:    true,
+	}
+
+	p.EncryptedKey = "env://STEP_TEST_ENCRYPTED_KEY"
+	p.AdditionalKeys = []*JWKKey{{Key: previous.Key, EncryptedKey: "vault://secret/data/step#encryptedKey"}}
+	assert.FatalError(t, p.Init(config))
+
+	// The configuration keeps the references.
+	assert.Equals(t, "env://STEP_TEST_ENCRYPTED_KEY", p.EncryptedKey)
+	assert.Equals(t, "vault://secret/data/step#encryptedKey", p.AdditionalKeys[0].EncryptedKey)
+
+	// The resolved keys are used by the CA, but they are not published.
+	_, err = p.DecryptKey([]byte("password"))
+	assert.FatalError(t, err)
+	kid, key, ok := p.GetEncryptedKey()
+	assert.False(t, ok)
+	assert.Equals(t, "", kid)
+	assert.Equals(t, "", key)
+	assert.Equals(t, map[string]string{}, p.getAdditionalEncryptedKeys())
+
+	public := p.WithoutSecretReferences()
+	assert.Equals(t, "", public.EncryptedKey)
+	assert.Equals(t, "", public.AdditionalKeys[0].EncryptedKey)
+	assert.Equals(t, previous.Key, public.AdditionalKeys[0].Key)
+	assert.Equals(t, "env://STEP_TEST_ENCRYPTED_KEY", p.EncryptedKey)
+
+	// Inline keys are still published.
+	p.AdditionalKeys[0].EncryptedKey = previous.EncryptedKey
+	assert.FatalError(t, p.Init(config))
+	assert.Equals(t, map[string]string{previous.Key.KeyID: previous.EncryptedKey}, p.getAdditionalEncryptedKeys())
+	assert.Equals(t, previous.EncryptedKey, p.WithoutSecretReferences().AdditionalKeys[0].EncryptedKey)
+
+	tests := []struct {
+		name           string
+		config         Config
+		encryptedKey   string
+		additionalKeys []*JWKKey
+	}{
+		{"fail scheme", Config{Claims: globalProvisionerClaims, Audiences: testAudiences}, "vault://secret/data/step", nil},
+		{"fail not local", Config{Claims: globalProvisionerClaims, Audiences: testAudiences}, "env://STEP_TEST_ENCRYPTED_KEY", nil},
+		{"fail not jwe", config, "vault://secret/data/step#other", nil},
+		{"fail additional key not jwe", config, encryptedKey, []*JWKKey{{Key: previous.Key, EncryptedKey: "vault://secret/data/step#other"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.EncryptedKey = tt.encryptedKey
+			p.AdditionalKeys = tt.additionalKeys
+			assert.Error(t, p.Init(tt.config))
+		})
+	}
+}
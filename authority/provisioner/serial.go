@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxSerialPrefixLength is the maximum length in bytes of the prefix of a
+// sequential serial number. A serial number cannot be longer than 20 octets,
+// and it has an 8 bytes counter and may need a leading zero.
+const maxSerialPrefixLength = 11
+
+// SerialGenerator is the interface used to generate the serial numbers of the
+// X.509 certificates signed by a provisioner. The serial numbers must be
+// positive.
+type SerialGenerator interface {
+	GenerateSerial() (*big.Int, error)
+}
+
+// X509SerialGenerator is a SignOption with the generator of the serial number
+// of the certificate. The authority checks the database to avoid duplicated
+// serial numbers. If the generator is nil, the default random serial number is
+// used.
+type X509SerialGenerator struct {
+	SerialGenerator
+}
+
+// SerialNumber configures the serial numbers of the certificates. The serial
+// numbers are made of the hex encoded Prefix followed by a monotonically
+// increasing 64-bit counter. The counter is initialized with the current Unix
+// time in the upper 32 bits, so it keeps increasing after a restart, and a
+// random value in the lower 32 bits, so the first serial numbers cannot be
+// guessed.
+type SerialNumber struct {
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// newSerialGenerator validates the given options and returns the serial
+// generator. It returns nil if the options are not set.
+func newSerialGenerator(o *SerialNumber) (SerialGenerator, error) {
+	if o == nil {
+		return nil, nil
+	}
+	prefix, err := hex.DecodeString(o.Prefix)
+	if err != nil {
+		return nil, errors.Errorf("x509.serialNumber prefix %q is not a valid hex string", o.Prefix)
+	}
+	if len(prefix) > maxSerialPrefixLength {
+		return nil, errors.Errorf("x509.serialNumber prefix %q cannot be longer than %d bytes", o.Prefix, maxSerialPrefixLength)
+	}
+	seed, err := newSerialCounterSeed()
+	if err != nil {
+		return nil, err
+	}
+	return &sequentialSerialGenerator{
+		prefix:  prefix,
+		counter: seed,
+	}, nil
+}
+
+// newSerialCounterSeed returns the initial value of the counter of a
+// sequential serial generator.
+func newSerialCounterSeed() (uint64, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, errors.Wrap(err, "error generating serial number seed")
+	}
+	return uint64(time.Now().Unix())<<32 | uint64(binary.BigEndian.Uint32(b[:])), nil
+}
+
+// sequentialSerialGenerator is a SerialGenerator that returns monotonically
+// increasing serial numbers with a fixed prefix.
+type sequentialSerialGenerator struct {
+	mu      sync.Mutex
+	prefix  []byte
+	counter uint64
+}
+
+// GenerateSerial implements SerialGenerator and returns the prefix followed by
+// the next value of the counter.
+func (g *sequentialSerialGenerator) GenerateSerial() (*big.Int, error) {
+	g.mu.Lock()
+	g.counter++
+	counter := g.counter
+	g.mu.Unlock()
+
+	b := make([]byte, len(g.prefix)+8)
+	copy(b, g.prefix)
+	binary.BigEndian.PutUint64(b[len(g.prefix):], counter)
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,84 @@
+package provisioner
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_newSerialGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SerialNumber
+		wantNil bool
+		wantErr bool
+	}{
+		{"ok nil", nil, true, false},
+		{"ok", &SerialNumber{Prefix: "0a1b"}, false, false},
+		{"ok empty prefix", &SerialNumber{}, false, false},
+		{"ok max prefix", &SerialNumber{Prefix: strings.Repeat("ff", maxSerialPrefixLength)}, false, false},
+		{"fail prefix", &SerialNumber{Prefix: "0a1"}, true, true},
+		{"fail prefix characters", &SerialNumber{Prefix: "zz"}, true, true},
+		{"fail prefix length", &SerialNumber{Prefix: strings.Repeat("ff", maxSerialPrefixLength+1)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSerialGenerator(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSerialGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.wantNil, got == nil)
+		})
+	}
+}
+
+func Test_sequentialSerialGenerator_GenerateSerial(t *testing.T) {
+	g, err := newSerialGenerator(&SerialNumber{Prefix: "0a1b"})
+	assert.FatalError(t, err)
+
+	var last *big.Int
+	for i := 0; i < 10; i++ {
+		sn, err := g.GenerateSerial()
+		assert.FatalError(t, err)
+		assert.Equals(t, 1, sn.Sign())
+		b := sn.Bytes()
+		assert.Len(t, 10, b)
+		assert.Equals(t, []byte{0x0a, 0x1b}, b[:2])
+		if last != nil {
+			assert.Equals(t, 1, sn.Cmp(last))
+		}
+		last = sn
+	}
+
+}
+
+func Test_newSerialCounterSeed(t *testing.T) {
+	before := time.Now().Unix()
+	s1, err := newSerialCounterSeed()
+	assert.FatalError(t, err)
+	s2, err := newSerialCounterSeed()
+	assert.FatalError(t, err)
+	after := time.Now().Unix()
+
+	// The upper bits keep the counter increasing after a restart, and the
+	// lower bits are random.
+	for _, s := range []uint64{s1, s2} {
+		if sec := int64(s >> 32); sec < before || sec > after {
+			t.Errorf("newSerialCounterSeed() = %d, want Unix time between %d and %d", sec, before, after)
+		}
+	}
+	assert.NotEquals(t, s1, s2)
+}
+
+func TestController_newSerialGeneratorOption(t *testing.T) {
+	gen, err := newSerialGenerator(&SerialNumber{Prefix: "01"})
+	assert.FatalError(t, err)
+
+	c := &Controller{}
+	assert.Equals(t, X509SerialGenerator{}, c.newSerialGeneratorOption())
+	c = &Controller{x509SerialGenerator: gen}
+	assert.Equals(t, X509SerialGenerator{gen}, c.newSerialGeneratorOption())
+}
@@ -0,0 +1,221 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// SignConcurrencyOptions limits the number of certificates signed at the same
+// time, to protect the CA from running out of CPU during enrollment storms.
+// Up to MaxConcurrent sign operations run at the same time, and up to
+// MaxQueued operations wait, in order, for a free slot. The requests beyond
+// the queue, or the ones that wait for longer than QueueTimeout, are rejected
+// with a 503 Service Unavailable error. By default requests are not queued.
+//
+// The options can be set in the authority, to limit all the sign operations of
+// the CA, or in a provisioner, to limit its own requests.
+type SignConcurrencyOptions struct {
+	MaxConcurrent int       `json:"maxConcurrent"`
+	MaxQueued     int       `json:"maxQueued,omitempty"`
+	QueueTimeout  *Duration `json:"queueTimeout,omitempty"`
+}
+
+// Validate validates the sign concurrency options.
+func (o *SignConcurrencyOptions) Validate() error {
+	switch {
+	case o == nil:
+		return nil
+	case o.MaxConcurrent <= 0:
+		return errors.New("signConcurrency maxConcurrent must be greater than 0")
+	case o.MaxQueued < 0:
+		return errors.New("signConcurrency maxQueued cannot be negative")
+	case o.QueueTimeout != nil && o.QueueTimeout.Duration < 0:
+		return errors.New("signConcurrency queueTimeout cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// ConcurrencyObserver is called with the number of in-flight and queued
+// operations of a ConcurrencyLimiter every time they change.
+type ConcurrencyObserver func(inFlight, queued int)
+
+// ConcurrencyLimiter is a semaphore with a bounded FIFO queue. It is also a
+// SignOption used to pass the limiter of a provisioner to the authority.
+type ConcurrencyLimiter struct {
+	maxConcurrent int
+	maxQueued     int
+	timeout       time.Duration
+	mu            sync.Mutex
+	inFlight      int
+	queue         []chan struct{}
+}
+
+// NewConcurrencyLimiter returns a new ConcurrencyLimiter with the given
+// options. It returns nil if the options are nil.
+func NewConcurrencyLimiter(o *SignConcurrencyOptions) *ConcurrencyLimiter {
+	if o == nil {
+		return nil
+	}
+	l := &ConcurrencyLimiter{
+		maxConcurrent: o.MaxConcurrent,
+		maxQueued:     o.MaxQueued,
+	}
+	if o.QueueTimeout != nil {
+		l.timeout = o.QueueTimeout.Duration
+	}
+	return l
+}
+
+// update changes the limits of the limiter, keeping the in-flight and queued
+// operations. If the number of concurrent operations grows, the slots are
+// handed over to the queued operations.
+func (l *ConcurrencyLimiter) update(o *SignConcurrencyOptions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxConcurrent = o.MaxConcurrent
+	l.maxQueued = o.MaxQueued
+	l.timeout = 0
+	if o.QueueTimeout != nil {
+		l.timeout = o.QueueTimeout.Duration
+	}
+	for l.inFlight < l.maxConcurrent && len(l.queue) > 0 {
+		close(l.queue[0])
+		l.queue = l.queue[1:]
+		l.inFlight++
+	}
+}
+
+// Acquire waits until the operation can run and returns the function that
+// must be called when it finishes. It returns a 503 error if the queue is full
+// or if the operation waits for longer than the queue timeout, and the context
+// error if the context is done while it's waiting. The observer, if not nil,
+// is called every time the in-flight or queued operations change.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, observe ConcurrencyObserver) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release := func() { l.release(observe) }
+
+	l.mu.Lock()
+	if l.inFlight < l.maxConcurrent && len(l.queue) == 0 {
+		l.inFlight++
+		l.notify(observe)
+		l.mu.Unlock()
+		return release, nil
+	}
+	if len(l.queue) >= l.maxQueued {
+		l.mu.Unlock()
+		return nil, errs.New(http.StatusServiceUnavailable, "too many concurrent sign requests")
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.notify(observe)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		t := time.NewTimer(l.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return release, nil
+	case <-timeout:
+		err = errs.New(http.StatusServiceUnavailable, "timeout waiting for a sign slot")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Leave the queue, or release the slot if it has been handed over
+	// concurrently.
+	l.mu.Lock()
+	for i, ch := range l.queue {
+		if ch == ready {
+			l.queue = append(l.queue[:i:i], l.queue[i+1:]...)
+			l.notify(observe)
+			l.mu.Unlock()
+			return nil, err
+		}
+	}
+	l.mu.Unlock()
+	release()
+	return nil, err
+}
+
+// release hands over the slot to the first queued operation, or frees it if
+// the queue is empty.
+func (l *ConcurrencyLimiter) release(observe ConcurrencyObserver) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) > 0 {
+		close(l.queue[0])
+		l.queue = l.queue[1:]
+	} else {
+		l.inFlight--
+	}
+	l.notify(observe)
+}
+
+// notify calls the observer with the current counts, the lock must be held.
+func (l *ConcurrencyLimiter) notify(observe ConcurrencyObserver) {
+	if observe != nil {
+		observe(l.inFlight, len(l.queue))
+	}
+}
+
+// ConcurrencyLimiters keeps the concurrency limiters of the provisioners
+// indexed by the provisioner id, so the in-flight and queued operations are
+// not lost when the provisioners are reloaded.
+type ConcurrencyLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*ConcurrencyLimiter
+}
+
+// NewConcurrencyLimiters returns an empty set of concurrency limiters.
+func NewConcurrencyLimiters() *ConcurrencyLimiters {
+	return &ConcurrencyLimiters{
+		limiters: make(map[string]*ConcurrencyLimiter),
+	}
+}
+
+// Get returns the limiter of the provisioner with the given id, updated with
+// the given options. It returns nil and forgets the limiter if the options are
+// nil. If the set is nil, a new limiter is returned every time.
+func (l *ConcurrencyLimiters) Get(id string, o *SignConcurrencyOptions) *ConcurrencyLimiter {
+	if l == nil {
+		return NewConcurrencyLimiter(o)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if o == nil {
+		delete(l.limiters, id)
+		return nil
+	}
+	if limiter, ok := l.limiters[id]; ok {
+		limiter.update(o)
+		return limiter
+	}
+	limiter := NewConcurrencyLimiter(o)
+	l.limiters[id] = limiter
+	return limiter
+}
+
+// Stats returns the number of in-flight and queued operations.
+func (l *ConcurrencyLimiter) Stats() (inFlight, queued int) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, len(l.queue)
+}
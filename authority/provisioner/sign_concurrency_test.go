@@ -0,0 +1,230 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+)
+
+func assertStatusCode(t *testing.T, want int, err error) {
+	t.Helper()
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+		assert.Equals(t, want, sc.StatusCode())
+	}
+}
+
+func TestSignConcurrencyOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SignConcurrencyOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &SignConcurrencyOptions{MaxConcurrent: 1}, false},
+		{"ok queue", &SignConcurrencyOptions{MaxConcurrent: 4, MaxQueued: 16, QueueTimeout: &Duration{Duration: time.Second}}, false},
+		{"fail maxConcurrent", &SignConcurrencyOptions{}, true},
+		{"fail negative maxConcurrent", &SignConcurrencyOptions{MaxConcurrent: -1}, true},
+		{"fail maxQueued", &SignConcurrencyOptions{MaxConcurrent: 1, MaxQueued: -1}, true},
+		{"fail queueTimeout", &SignConcurrencyOptions{MaxConcurrent: 1, QueueTimeout: &Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SignConcurrencyOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_nil(t *testing.T) {
+	var l *ConcurrencyLimiter
+	assert.Nil(t, NewConcurrencyLimiter(nil))
+
+	release, err := l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+	release()
+
+	inFlight, queued := l.Stats()
+	assert.Equals(t, 0, inFlight)
+	assert.Equals(t, 0, queued)
+}
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		observed [][2]int
+	)
+	observe := func(inFlight, queued int) {
+		mu.Lock()
+		observed = append(observed, [2]int{inFlight, queued})
+		mu.Unlock()
+	}
+
+	l := NewConcurrencyLimiter(&SignConcurrencyOptions{MaxConcurrent: 2, MaxQueued: 2})
+	release1, err := l.Acquire(context.Background(), observe)
+	assert.FatalError(t, err)
+	release2, err := l.Acquire(context.Background(), observe)
+	assert.FatalError(t, err)
+
+	// Queue two operations, they must get the slots in order.
+	order := make(chan int, 2)
+	var wg sync.WaitGroup
+	for i := 1; i <= 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background(), observe)
+			if err != nil {
+				t.Errorf("ConcurrencyLimiter.Acquire() error = %v", err)
+				return
+			}
+			order <- i
+			release()
+		}(i)
+		waitForStats(t, l, 2, i)
+	}
+
+	// The queue is full.
+	_, err = l.Acquire(context.Background(), observe)
+	if assert.Error(t, err) {
+		assertStatusCode(t, http.StatusServiceUnavailable, err)
+	}
+
+	release1()
+	assert.Equals(t, 1, <-order)
+	release2()
+	assert.Equals(t, 2, <-order)
+	wg.Wait()
+
+	inFlight, queued := l.Stats()
+	assert.Equals(t, 0, inFlight)
+	assert.Equals(t, 0, queued)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equals(t, [2]int{1, 0}, observed[0])
+	assert.Equals(t, [2]int{2, 0}, observed[1])
+	assert.Equals(t, [2]int{2, 1}, observed[2])
+	assert.Equals(t, [2]int{2, 2}, observed[3])
+	assert.Equals(t, [2]int{0, 0}, observed[len(observed)-1])
+}
+
+func TestConcurrencyLimiter_Acquire_noQueue(t *testing.T) {
+	l := NewConcurrencyLimiter(&SignConcurrencyOptions{MaxConcurrent: 1})
+	release, err := l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+
+	_, err = l.Acquire(context.Background(), nil)
+	if assert.Error(t, err) {
+		assertStatusCode(t, http.StatusServiceUnavailable, err)
+	}
+
+	release()
+	release, err = l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+	release()
+}
+
+func TestConcurrencyLimiter_Acquire_timeout(t *testing.T) {
+	l := NewConcurrencyLimiter(&SignConcurrencyOptions{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  &Duration{Duration: 10 * time.Millisecond},
+	})
+	release, err := l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+	defer release()
+
+	_, err = l.Acquire(context.Background(), nil)
+	if assert.Error(t, err) {
+		assertStatusCode(t, http.StatusServiceUnavailable, err)
+	}
+
+	inFlight, queued := l.Stats()
+	assert.Equals(t, 1, inFlight)
+	assert.Equals(t, 0, queued)
+}
+
+func TestConcurrencyLimiter_Acquire_canceled(t *testing.T) {
+	l := NewConcurrencyLimiter(&SignConcurrencyOptions{MaxConcurrent: 1, MaxQueued: 1})
+	release, err := l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, nil)
+		errc <- err
+	}()
+	waitForStats(t, l, 1, 1)
+	cancel()
+	assert.Equals(t, context.Canceled, <-errc)
+
+	// The canceled operation must not hold the slot.
+	release()
+	inFlight, queued := l.Stats()
+	assert.Equals(t, 0, inFlight)
+	assert.Equals(t, 0, queued)
+}
+
+// waitForStats waits until the limiter has the given number of in-flight and
+// queued operations.
+func waitForStats(t *testing.T, l *ConcurrencyLimiter, wantInFlight, wantQueued int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		inFlight, queued := l.Stats()
+		if inFlight == wantInFlight && queued == wantQueued {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ConcurrencyLimiter.Stats() = %d, %d, want %d, %d", inFlight, queued, wantInFlight, wantQueued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiters_Get(t *testing.T) {
+	var nilLimiters *ConcurrencyLimiters
+	assert.Nil(t, nilLimiters.Get("id", nil))
+	assert.NotNil(t, nilLimiters.Get("id", &SignConcurrencyOptions{MaxConcurrent: 1}))
+
+	limiters := NewConcurrencyLimiters()
+	l := limiters.Get("id", &SignConcurrencyOptions{MaxConcurrent: 1, MaxQueued: 1})
+	release, err := l.Acquire(context.Background(), nil)
+	assert.FatalError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		release, err := l.Acquire(context.Background(), nil)
+		if err != nil {
+			t.Errorf("ConcurrencyLimiter.Acquire() error = %v", err)
+			return
+		}
+		release()
+	}()
+	waitForStats(t, l, 1, 1)
+
+	// A reload keeps the limiter and hands over the new slots.
+	assert.True(t, l == limiters.Get("id", &SignConcurrencyOptions{MaxConcurrent: 2}))
+	<-done
+	inFlight, queued := l.Stats()
+	assert.Equals(t, 1, inFlight)
+	assert.Equals(t, 0, queued)
+	release()
+
+	// Other provisioners get their own limiter.
+	assert.False(t, l == limiters.Get("other", &SignConcurrencyOptions{MaxConcurrent: 2}))
+
+	// Disabling the limit forgets the limiter.
+	assert.Nil(t, limiters.Get("id", nil))
+	assert.False(t, l == limiters.Get("id", &SignConcurrencyOptions{MaxConcurrent: 2}))
+}
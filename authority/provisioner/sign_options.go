@@ -2,20 +2,27 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"net"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/authority/internal/constraints"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/errs"
 )
@@ -26,10 +33,13 @@ const DefaultCertValidity = 24 * time.Hour
 // SignOptions contains the options that can be passed to the Sign method. Backdate
 // is automatically filled and can only be configured in the CA.
 type SignOptions struct {
-	NotAfter     TimeDuration    `json:"notAfter"`
-	NotBefore    TimeDuration    `json:"notBefore"`
-	TemplateData json.RawMessage `json:"templateData"`
-	Backdate     time.Duration   `json:"-"`
+	NotAfter           TimeDuration    `json:"notAfter"`
+	NotBefore          TimeDuration    `json:"notBefore"`
+	TemplateData       json.RawMessage `json:"templateData"`
+	SignatureAlgorithm string          `json:"signatureAlgorithm"`
+	AlternateChain     bool            `json:"alternateChain"`
+	Signer             string          `json:"signer"`
+	Backdate           time.Duration   `json:"-"`
 }
 
 // SignOption is the interface used to collect all extra options used in the
@@ -84,6 +94,92 @@ type AttestationData struct {
 	PermanentIdentifier string
 }
 
+// X509SignerName is a SignOption used to select one of the named X.509 signers
+// configured in the authority. An empty name selects the default signer.
+type X509SignerName string
+
+// X509AllowedSigners is a SignOption with the names of the X.509 signers that
+// a sign request can select with the Signer field of the SignOptions.
+type X509AllowedSigners []string
+
+// Allows returns true if the given signer can be selected by a sign request.
+func (s X509AllowedSigners) Allows(name string) bool {
+	for _, n := range s {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSigner returns an error if the X.509 signer of a provisioner is not
+// configured in the authority. The signer is not validated if the keys of the
+// signers are not known.
+func validateSigner(name string, keys map[string]crypto.PublicKey) error {
+	if name == "" || keys == nil {
+		return nil
+	}
+	if _, ok := keys[name]; !ok {
+		return errors.Errorf("x509.signer %q is not configured", name)
+	}
+	return nil
+}
+
+// validateAllowedSigners returns an error if one of the allowed signers is
+// not configured in the authority, or if the signature algorithm of the
+// provisioner cannot be used with its key. The signers are only validated if
+// the keys of the signers are known.
+func validateAllowedSigners(names []string, sigAlg x509.SignatureAlgorithm, keys map[string]crypto.PublicKey) error {
+	for _, name := range names {
+		if name == "" {
+			return errors.New("x509.allowedSigners cannot contain an empty name")
+		}
+		if keys == nil {
+			continue
+		}
+		key, ok := keys[name]
+		if !ok {
+			return errors.Errorf("x509.allowedSigners contains the signer %q, but it is not configured", name)
+		}
+		if sigAlg != x509.UnknownSignatureAlgorithm {
+			if err := validateSignatureAlgorithmKey(sigAlg, key); err != nil {
+				return errors.Wrapf(err, "x509.signatureAlgorithm cannot be used with the signer %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// X509Backdate is a SignOption used to set the backdate of the notBefore of
+// the certificate, replacing the backdate configured in the authority.
+type X509Backdate time.Duration
+
+// DuplicateDNSNamesPolicy is a SignOption that indicates what the authority
+// must do if another active certificate already has one of the DNS names of
+// the certificate being signed. An empty policy allows duplicated names.
+type DuplicateDNSNamesPolicy string
+
+const (
+	// DuplicateDNSNamesReject rejects the request if there is an active
+	// certificate with the same DNS names. The lookup and the storage of the
+	// new certificate are not atomic, so two concurrent requests for the same
+	// names can both be signed.
+	DuplicateDNSNamesReject DuplicateDNSNamesPolicy = "reject"
+	// DuplicateDNSNamesRevoke revokes the active certificates with the same
+	// DNS names once the new certificate is signed.
+	DuplicateDNSNamesRevoke DuplicateDNSNamesPolicy = "revoke"
+)
+
+// Validate returns an error if the policy is not supported.
+func (p DuplicateDNSNamesPolicy) Validate() error {
+	switch p {
+	case "", DuplicateDNSNamesReject, DuplicateDNSNamesRevoke:
+		return nil
+	default:
+		return errors.Errorf("unsupported duplicateDNSNames policy %q", p)
+	}
+}
+
 // defaultPublicKeyValidator validates the public key of a certificate request.
 type defaultPublicKeyValidator struct{}
 
@@ -133,6 +229,100 @@ func (v publicKeyMinimumLengthValidator) Valid(req *x509.CertificateRequest) err
 	return nil
 }
 
+// Default limits of a certificate request.
+const (
+	DefaultMaxCSRExtensions     = 100
+	DefaultMaxCSRAttributesSize = 64 * 1024
+	DefaultMaxSANs              = 100
+	DefaultMaxSANLength         = 2048
+)
+
+// csrLimitsValidator validates the number of extensions, the size of the
+// attributes, and the number and length of the subject alternative names of a
+// certificate request.
+type csrLimitsValidator struct {
+	maxExtensions     int
+	maxAttributesSize int
+	maxSANs           int
+	maxSANLength      int
+}
+
+// NewCSRLimitsValidator returns the validator of the certificate request
+// limits configured in the given claimer. A nil claimer uses the default
+// limits.
+func NewCSRLimitsValidator(c *Claimer) CertificateRequestValidator {
+	if c == nil {
+		return csrLimitsValidator{
+			maxExtensions:     DefaultMaxCSRExtensions,
+			maxAttributesSize: DefaultMaxCSRAttributesSize,
+			maxSANs:           DefaultMaxSANs,
+			maxSANLength:      DefaultMaxSANLength,
+		}
+	}
+	return csrLimitsValidator{
+		maxExtensions:     c.MaxCSRExtensions(),
+		maxAttributesSize: c.MaxCSRAttributesSize(),
+		maxSANs:           c.MaxSANs(),
+		maxSANLength:      c.MaxSANLength(),
+	}
+}
+
+// Valid checks the size of the attributes, the number of extensions, and the
+// number and length of the subject alternative names of the certificate
+// request. The size is checked first as it does not depend on the parsed
+// extensions.
+func (v csrLimitsValidator) Valid(req *x509.CertificateRequest) error {
+	if v.maxAttributesSize > 0 {
+		var tbs struct {
+			Raw           asn1.RawContent
+			Version       int
+			Subject       asn1.RawValue
+			PublicKey     asn1.RawValue
+			RawAttributes []asn1.RawValue `asn1:"tag:0"`
+		}
+		if _, err := asn1.Unmarshal(req.RawTBSCertificateRequest, &tbs); err != nil {
+			return errs.BadRequestErr(err, "error parsing certificate request")
+		}
+		var size int
+		for _, attr := range tbs.RawAttributes {
+			size += len(attr.FullBytes)
+		}
+		if size > v.maxAttributesSize {
+			return errs.Forbidden("certificate request attributes size of %d bytes is more than the allowed maximum of %d bytes", size, v.maxAttributesSize)
+		}
+	}
+	if v.maxExtensions > 0 && len(req.Extensions) > v.maxExtensions {
+		return errs.Forbidden("certificate request with %d extensions is more than the allowed maximum of %d extensions", len(req.Extensions), v.maxExtensions)
+	}
+	if n := len(req.DNSNames) + len(req.IPAddresses) + len(req.EmailAddresses) + len(req.URIs); v.maxSANs > 0 && n > v.maxSANs {
+		return errs.Forbidden("certificate request with %d subject alternative names is more than the allowed maximum of %d names", n, v.maxSANs)
+	}
+	if v.maxSANLength > 0 {
+		check := func(kind, name string) error {
+			if len(name) > v.maxSANLength {
+				return errs.Forbidden("certificate request %s of %d characters is longer than the allowed maximum of %d characters", kind, len(name), v.maxSANLength)
+			}
+			return nil
+		}
+		for _, name := range req.DNSNames {
+			if err := check("dns name", name); err != nil {
+				return err
+			}
+		}
+		for _, name := range req.EmailAddresses {
+			if err := check("email address", name); err != nil {
+				return err
+			}
+		}
+		for _, u := range req.URIs {
+			if err := check("uri", u.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // commonNameValidator validates the common name of a certificate request.
 type commonNameValidator string
 
@@ -164,6 +354,94 @@ func (v commonNameSliceValidator) Valid(req *x509.CertificateRequest) error {
 	return errs.Forbidden("certificate request does not contain the valid common name - got %s, want %s", req.Subject.CommonName, v)
 }
 
+// commonNameModifier is a CertificateModifier that sets the common name of the
+// certificate, ignoring the one in the certificate request.
+type commonNameModifier string
+
+// Modify sets the common name of the certificate.
+func (m commonNameModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.Subject.CommonName = string(m)
+	return nil
+}
+
+// forbidCommonNameValidator is a CertificateRequestValidator that rejects the
+// certificate requests with a common name.
+type forbidCommonNameValidator struct{}
+
+// Valid checks that the certificate request does not have a common name.
+func (forbidCommonNameValidator) Valid(req *x509.CertificateRequest) error {
+	if req.Subject.CommonName != "" {
+		return errs.Forbidden("certificate request cannot contain a common name - got %s", req.Subject.CommonName)
+	}
+	return nil
+}
+
+// forbidCommonNameModifier is a CertificateModifier that removes the common
+// name of the certificate, e.g. the one set by the template. The certificate
+// must have at least one SAN.
+type forbidCommonNameModifier struct{}
+
+// Modify removes the common name of the certificate.
+func (forbidCommonNameModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.Subject.CommonName = ""
+	if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 && len(cert.EmailAddresses) == 0 && len(cert.URIs) == 0 {
+		return errs.BadRequest("certificate without a common name must contain at least one subject alternative name")
+	}
+	return nil
+}
+
+// commonNameSANModifier is a CertificateModifier that sets the common name of
+// the certificate and adds it as the first SAN of the type it parses as, an IP
+// address, a URI, an email address or a DNS name. If Only is true, the common
+// name is the only SAN of the certificate.
+type commonNameSANModifier struct {
+	Name string
+	Only bool
+}
+
+// Modify sets the common name and the SANs of the certificate.
+func (m commonNameSANModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.Subject.CommonName = m.Name
+	if m.Only {
+		cert.DNSNames = nil
+		cert.IPAddresses = nil
+		cert.EmailAddresses = nil
+		cert.URIs = nil
+	}
+	dnsNames, ips, emails, uris := x509util.SplitSANs([]string{m.Name})
+	switch {
+	case len(ips) > 0:
+		for _, ip := range cert.IPAddresses {
+			if !ip.Equal(ips[0]) {
+				ips = append(ips, ip)
+			}
+		}
+		cert.IPAddresses = ips
+	case len(uris) > 0:
+		for _, u := range cert.URIs {
+			if u.String() != uris[0].String() {
+				uris = append(uris, u)
+			}
+		}
+		cert.URIs = uris
+	case len(emails) > 0:
+		for _, s := range cert.EmailAddresses {
+			if s != m.Name {
+				emails = append(emails, s)
+			}
+		}
+		cert.EmailAddresses = emails
+	default:
+		for _, s := range cert.DNSNames {
+			if s != m.Name {
+				dnsNames = append(dnsNames, s)
+			}
+		}
+		cert.DNSNames = dnsNames
+	}
+	return nil
+}
+
 // dnsNamesValidator validates the DNS names SAN of a certificate request.
 type dnsNamesValidator []string
 
@@ -295,6 +573,188 @@ func (v defaultSANsValidator) Valid(req *x509.CertificateRequest) (err error) {
 	return
 }
 
+// extensionsModifier is a CertificateModifier that adds the given extensions to
+// the certificate. Extensions with the same id added by a template are
+// replaced.
+type extensionsModifier []pkix.Extension
+
+func (m extensionsModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	for _, ext := range m {
+		var found bool
+		for i, e := range cert.ExtraExtensions {
+			if e.Id.Equal(ext.Id) {
+				cert.ExtraExtensions[i] = ext
+				found = true
+				break
+			}
+		}
+		if !found {
+			cert.ExtraExtensions = append(cert.ExtraExtensions, ext)
+		}
+	}
+	return nil
+}
+
+// nameConstraintsValidator validates that the SANs of a certificate satisfy
+// the name constraints configured in the provisioner, following the semantics
+// of the X.509 name constraints extension.
+type nameConstraintsValidator struct {
+	engine *constraints.Engine
+}
+
+// newNameConstraintsValidator parses the given domains and IP ranges and
+// returns the validator. It returns nil if there are no constraints.
+func newNameConstraintsValidator(permittedDNSDomains, excludedDNSDomains, permittedIPRanges []string) (*nameConstraintsValidator, error) {
+	if len(permittedDNSDomains) == 0 && len(excludedDNSDomains) == 0 && len(permittedIPRanges) == 0 {
+		return nil, nil
+	}
+	if err := validateDNSDomains("x509.permittedDNSDomains", permittedDNSDomains); err != nil {
+		return nil, err
+	}
+	if err := validateDNSDomains("x509.excludedDNSDomains", excludedDNSDomains); err != nil {
+		return nil, err
+	}
+	ipRanges := make([]*net.IPNet, 0, len(permittedIPRanges))
+	for _, s := range permittedIPRanges {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("x509.permittedIPRanges contains an invalid IP range %q", s)
+		}
+		ipRanges = append(ipRanges, ipNet)
+	}
+	return &nameConstraintsValidator{
+		engine: constraints.New(&x509.Certificate{
+			PermittedDNSDomains: permittedDNSDomains,
+			ExcludedDNSDomains:  excludedDNSDomains,
+			PermittedIPRanges:   ipRanges,
+		}),
+	}, nil
+}
+
+// validateDNSDomains returns an error if one of the given name constraints is
+// not a DNS domain, optionally starting with a ".".
+func validateDNSDomains(name string, domains []string) error {
+	for _, domain := range domains {
+		labels := strings.Split(strings.TrimPrefix(domain, "."), ".")
+		for _, label := range labels {
+			if label == "" || strings.ContainsAny(label, "* ") {
+				return errors.Errorf("%s contains an invalid DNS domain %q", name, domain)
+			}
+		}
+	}
+	return nil
+}
+
+// Valid returns an error if a DNS name or an IP address of the certificate
+// does not satisfy the name constraints.
+func (v *nameConstraintsValidator) Valid(cert *x509.Certificate, _ SignOptions) error {
+	if err := v.engine.Validate(cert.DNSNames, cert.IPAddresses, nil, nil); err != nil {
+		return errs.Forbidden("certificate request does not satisfy the name constraints of the provisioner: %s", err)
+	}
+	return nil
+}
+
+// Key types supported in the allowed keys options.
+const (
+	KeyTypeRSA     = "RSA"
+	KeyTypeECDSA   = "ECDSA"
+	KeyTypeEd25519 = "Ed25519"
+)
+
+// AllowedKeys restricts the public keys of the certificate requests that a
+// provisioner can sign. Types is the list of key types, "RSA", "ECDSA" or
+// "Ed25519", MinRSABits is the minimum size of RSA keys and Curves is the list
+// of ECDSA curves, "P-256", "P-384" or "P-521". Empty values do not restrict
+// the keys.
+type AllowedKeys struct {
+	Types      []string `json:"types,omitempty"`
+	MinRSABits int      `json:"minRSABits,omitempty"`
+	Curves     []string `json:"curves,omitempty"`
+}
+
+// keyPolicyValidator validates the public key of a certificate request with
+// the allowed keys of a provisioner.
+type keyPolicyValidator struct {
+	types      map[string]bool
+	minRSABits int
+	curves     map[string]bool
+}
+
+// newKeyPolicyValidator validates the given allowed keys and returns the
+// validator. It returns nil if the keys are not restricted.
+func newKeyPolicyValidator(o *AllowedKeys) (*keyPolicyValidator, error) {
+	if o == nil || (len(o.Types) == 0 && o.MinRSABits == 0 && len(o.Curves) == 0) {
+		return nil, nil
+	}
+	v := new(keyPolicyValidator)
+	if len(o.Types) > 0 {
+		v.types = make(map[string]bool, len(o.Types))
+		for _, t := range o.Types {
+			switch t {
+			case KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519:
+				v.types[t] = true
+			default:
+				return nil, errors.Errorf("x509.allowedKeys contains an unsupported key type %q", t)
+			}
+		}
+	}
+	switch {
+	case o.MinRSABits < 0:
+		return nil, errors.New("x509.allowedKeys minRSABits cannot be negative")
+	case o.MinRSABits > 0 && o.MinRSABits < 8*keyutil.MinRSAKeyBytes:
+		return nil, errors.Errorf("x509.allowedKeys minRSABits must be at least %d", 8*keyutil.MinRSAKeyBytes)
+	case o.MinRSABits > 0 && !v.allowsType(KeyTypeRSA):
+		return nil, errors.New("x509.allowedKeys minRSABits requires RSA keys to be allowed")
+	case len(o.Curves) > 0 && !v.allowsType(KeyTypeECDSA):
+		return nil, errors.New("x509.allowedKeys curves requires ECDSA keys to be allowed")
+	}
+	v.minRSABits = o.MinRSABits
+	if len(o.Curves) > 0 {
+		v.curves = make(map[string]bool, len(o.Curves))
+		for _, c := range o.Curves {
+			switch c {
+			case "P-256", "P-384", "P-521":
+				v.curves[c] = true
+			default:
+				return nil, errors.Errorf("x509.allowedKeys contains an unsupported curve %q", c)
+			}
+		}
+	}
+	return v, nil
+}
+
+func (v *keyPolicyValidator) allowsType(t string) bool {
+	return v.types == nil || v.types[t]
+}
+
+// Valid returns an error if the type, size or curve of the public key of the
+// certificate request is not allowed.
+func (v *keyPolicyValidator) Valid(req *x509.CertificateRequest) error {
+	switch k := req.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if !v.allowsType(KeyTypeRSA) {
+			return errs.Forbidden("certificate request RSA keys are not allowed by the provisioner")
+		}
+		if bits := k.N.BitLen(); bits < v.minRSABits {
+			return errs.Forbidden("certificate request RSA key must be at least %d bits, got %d bits", v.minRSABits, bits)
+		}
+	case *ecdsa.PublicKey:
+		if !v.allowsType(KeyTypeECDSA) {
+			return errs.Forbidden("certificate request ECDSA keys are not allowed by the provisioner")
+		}
+		if name := k.Curve.Params().Name; v.curves != nil && !v.curves[name] {
+			return errs.Forbidden("certificate request ECDSA curve %s is not allowed by the provisioner", name)
+		}
+	case ed25519.PublicKey:
+		if !v.allowsType(KeyTypeEd25519) {
+			return errs.Forbidden("certificate request Ed25519 keys are not allowed by the provisioner")
+		}
+	default:
+		return errs.BadRequest("certificate request key of type '%T' is not supported", k)
+	}
+	return nil
+}
+
 // profileDefaultDuration is a modifier that sets the certificate
 // duration.
 type profileDefaultDuration time.Duration
@@ -362,10 +822,20 @@ func (v profileLimitDuration) Modify(cert *x509.Certificate, so SignOptions) err
 	return nil
 }
 
-// validityValidator validates the certificate validity settings.
+// validityValidator validates the certificate validity settings. If clamp is
+// set, a certificate with a duration greater than the maximum is shortened
+// instead of rejected. If maxNotBeforeOffset is set, a certificate cannot
+// become valid later than that offset from now. If maxBackdate is set, a
+// certificate cannot become valid earlier than that backdate from now, besides
+// the backdate of the authority. If backdate is set, the backdate of the
+// provisioner does not count towards the minimum duration.
 type validityValidator struct {
-	min time.Duration
-	max time.Duration
+	min                time.Duration
+	max                time.Duration
+	clamp              bool
+	maxNotBeforeOffset time.Duration
+	maxBackdate        time.Duration
+	backdate           time.Duration
 }
 
 // newValidityValidator return a new validity validator.
@@ -384,13 +854,31 @@ func (v *validityValidator) Valid(cert *x509.Certificate, o SignOptions) error {
 
 	d := na.Sub(nb)
 
+	// NOTE: see the note below about the backdate.
+	if v.clamp && d > v.max+o.Backdate {
+		cert.NotAfter = cert.NotBefore.Add(v.max + o.Backdate)
+		na = cert.NotAfter.Truncate(time.Second)
+		d = na.Sub(nb)
+	}
+
 	if na.Before(now) {
 		return errs.BadRequest("notAfter cannot be in the past; na=%v", na)
 	}
 	if na.Before(nb) {
 		return errs.BadRequest("notAfter cannot be before notBefore; na=%v, nb=%v", na, nb)
 	}
-	if d < v.min {
+	if v.maxNotBeforeOffset > 0 && nb.Sub(now) > v.maxNotBeforeOffset {
+		return errs.Forbidden("requested notBefore of %v is more than the authorized maximum of %v in the future", nb, v.maxNotBeforeOffset)
+	}
+	if v.maxBackdate > 0 && now.Sub(nb) > v.maxBackdate+o.Backdate {
+		return errs.Forbidden("requested notBefore of %v is more than the authorized maximum of %v in the past", nb, v.maxBackdate)
+	}
+	// The backdate is only applied if the notBefore is not requested.
+	if v.backdate > 0 && o.NotBefore.IsZero() {
+		if d-v.backdate < v.min {
+			return errs.Forbidden("requested duration of %v is less than the authorized minimum certificate duration of %v", d-v.backdate, v.min)
+		}
+	} else if d < v.min {
 		return errs.Forbidden("requested duration of %v is less than the authorized minimum certificate duration of %v", d, v.min)
 	}
 	// NOTE: this check is not "technically correct". We're allowing the max
@@ -448,6 +936,348 @@ func (o *forceCNOption) Modify(cert *x509.Certificate, _ SignOptions) error {
 	return nil
 }
 
+type uniqueSANOption struct {
+	Enabled bool
+}
+
+func newUniqueSANOption(enabled bool) *uniqueSANOption {
+	return &uniqueSANOption{enabled}
+}
+
+// Modify adds a "urn:uuid:<uuid>" URI SAN to the certificate if enabled.
+func (o *uniqueSANOption) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if !o.Enabled {
+		return nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error generating unique SAN")
+	}
+	cert.URIs = append(cert.URIs, &url.URL{Scheme: "urn", Opaque: "uuid:" + id.String()})
+	return nil
+}
+
+// resolvedSANsModifier appends the subject alternative names returned by a
+// SANResolver to the certificate.
+type resolvedSANsModifier ResolvedSANs
+
+// Modify implements CertificateModifier and appends the names that are not
+// already in the certificate.
+func (m resolvedSANsModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	for _, name := range m.DNSNames {
+		if !containsString(cert.DNSNames, name) {
+			cert.DNSNames = append(cert.DNSNames, name)
+		}
+	}
+	for _, ip := range m.IPAddresses {
+		if !containsIP(cert.IPAddresses, ip) {
+			cert.IPAddresses = append(cert.IPAddresses, ip)
+		}
+	}
+	for _, u := range m.URIs {
+		if !containsURI(cert.URIs, u) {
+			cert.URIs = append(cert.URIs, u)
+		}
+	}
+	return nil
+}
+
+type signatureAlgorithmOption struct {
+	Allowed []x509.SignatureAlgorithm
+	// Forced is the signature algorithm configured in the provisioner. If set,
+	// it is always used and requests can only select the same one.
+	Forced x509.SignatureAlgorithm
+}
+
+func newSignatureAlgorithmOption(allowed []x509.SignatureAlgorithm) *signatureAlgorithmOption {
+	return &signatureAlgorithmOption{Allowed: allowed}
+}
+
+// Modify sets the signature algorithm configured in the provisioner or the one
+// requested in the sign options. It fails if the requested algorithm is not in
+// the list of allowed algorithms or if it is not the configured one.
+func (o *signatureAlgorithmOption) Modify(cert *x509.Certificate, opts SignOptions) error {
+	if opts.SignatureAlgorithm == "" {
+		if o.Forced != x509.UnknownSignatureAlgorithm {
+			cert.SignatureAlgorithm = o.Forced
+		}
+		return nil
+	}
+
+	sa, err := parseSignatureAlgorithm(opts.SignatureAlgorithm)
+	if err != nil {
+		return err
+	}
+	if o.Forced != x509.UnknownSignatureAlgorithm {
+		if sa != o.Forced {
+			return errors.Errorf("signature algorithm %q is not allowed", opts.SignatureAlgorithm)
+		}
+		cert.SignatureAlgorithm = sa
+		return nil
+	}
+	for _, allowed := range o.Allowed {
+		if sa == allowed {
+			cert.SignatureAlgorithm = sa
+			return nil
+		}
+	}
+	return errors.Errorf("signature algorithm %q is not allowed", opts.SignatureAlgorithm)
+}
+
+// parseSignatureAlgorithm returns the x509.SignatureAlgorithm for the given
+// name, e.g. "SHA256-RSA" or "ECDSA-SHA256".
+func parseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	b, err := json.Marshal(name)
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, errors.Wrapf(err, "error parsing signature algorithm %q", name)
+	}
+	var sa x509util.SignatureAlgorithm
+	if err := sa.UnmarshalJSON(b); err != nil || sa == x509util.SignatureAlgorithm(x509.UnknownSignatureAlgorithm) {
+		return x509.UnknownSignatureAlgorithm, errors.Errorf("unsupported signature algorithm %q", name)
+	}
+	return x509.SignatureAlgorithm(sa), nil
+}
+
+// parseSignerSignatureAlgorithm parses the signature algorithm configured in
+// a provisioner and validates that the key of the given signer supports it.
+// It returns x509.UnknownSignatureAlgorithm if the name is empty.
+func parseSignerSignatureAlgorithm(name, signer string, keys map[string]crypto.PublicKey) (x509.SignatureAlgorithm, error) {
+	if name == "" {
+		return x509.UnknownSignatureAlgorithm, nil
+	}
+	sa, err := parseSignatureAlgorithm(name)
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, errors.Wrap(err, "x509.signatureAlgorithm is not valid")
+	}
+	key, ok := keys[signer]
+	if !ok || key == nil {
+		return x509.UnknownSignatureAlgorithm, errors.Errorf("x509.signatureAlgorithm %q cannot be used, the key of the signer is not known", name)
+	}
+	if err := validateSignatureAlgorithmKey(sa, key); err != nil {
+		return x509.UnknownSignatureAlgorithm, errors.Wrapf(err, "x509.signatureAlgorithm %q cannot be used", name)
+	}
+	return sa, nil
+}
+
+// validateSignatureAlgorithmKey returns an error if the given signature
+// algorithm cannot be used with the given key.
+func validateSignatureAlgorithmKey(sa x509.SignatureAlgorithm, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch sa {
+		case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+			return nil
+		case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+			// The certificates use a salt of the size of the hash, the key
+			// must fit the hash, the salt and the encoding.
+			h := crypto.SHA256
+			switch sa {
+			case x509.SHA384WithRSAPSS:
+				h = crypto.SHA384
+			case x509.SHA512WithRSAPSS:
+				h = crypto.SHA512
+			}
+			if k.Size() < 2*h.Size()+2 {
+				return errors.Errorf("the RSA key of the signer is too small for %s", sa)
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		switch sa {
+		case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+			return nil
+		}
+	case ed25519.PublicKey:
+		if sa == x509.PureEd25519 {
+			return nil
+		}
+	default:
+		return errors.Errorf("unsupported key type %T", key)
+	}
+	return errors.Errorf("%s is not supported by the key of the signer", sa)
+}
+
+func parseSignatureAlgorithms(names []string) ([]x509.SignatureAlgorithm, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sigAlgs := make([]x509.SignatureAlgorithm, len(names))
+	for i, name := range names {
+		sa, err := parseSignatureAlgorithm(name)
+		if err != nil {
+			return nil, err
+		}
+		sigAlgs[i] = sa
+	}
+	return sigAlgs, nil
+}
+
+// parseExtKeyUsages parses the given extended key usage names, e.g.
+// "clientAuth", using the names supported by the templates.
+func parseExtKeyUsages(names []string) ([]x509.ExtKeyUsage, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(names)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling x509.allowedExtKeyUsages")
+	}
+	var ekus x509util.ExtKeyUsage
+	if err := json.Unmarshal(b, &ekus); err != nil {
+		return nil, errors.Wrap(err, "x509.allowedExtKeyUsages is not valid")
+	}
+	return ekus, nil
+}
+
+// validateCRLDistributionPoints returns an error if one of the given URLs of
+// the CRL Distribution Points extension is not an absolute URL.
+func validateCRLDistributionPoints(urls []string) error {
+	for _, s := range urls {
+		if u, err := url.Parse(s); err != nil || !u.IsAbs() {
+			return errors.Errorf("x509.crlDistributionPoints %q is not a valid URL", s)
+		}
+	}
+	return nil
+}
+
+// crlDistributionPointsModifier is a CertificateModifier that sets the URLs of
+// the CRL Distribution Points extension.
+type crlDistributionPointsModifier []string
+
+// Modify sets the CRL distribution points of the certificate.
+func (m crlDistributionPointsModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.CRLDistributionPoints = append([]string(nil), m...)
+	return nil
+}
+
+var oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// extKeyUsageModifier is a CertificateModifier that sets exactly the given
+// extended key usages, removing any other usage added by the template,
+// including the unknown ones and the raw extensions.
+type extKeyUsageModifier []x509.ExtKeyUsage
+
+// Modify sets the extended key usages of the certificate.
+func (m extKeyUsageModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.ExtKeyUsage = append([]x509.ExtKeyUsage(nil), m...)
+	cert.UnknownExtKeyUsage = nil
+	exts := cert.ExtraExtensions[:0]
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			exts = append(exts, ext)
+		}
+	}
+	cert.ExtraExtensions = exts
+	return nil
+}
+
+// CustomSANsMode defines how the SANs in a certificate request are combined
+// with the SANs verified by an instance identity provisioner when custom SANs
+// are allowed, i.e. when DisableCustomSANs is false.
+type CustomSANsMode string
+
+const (
+	// CustomSANsCSR uses only the SANs in the certificate request. This is
+	// the default mode.
+	CustomSANsCSR CustomSANsMode = "csr"
+	// CustomSANsMerge adds the verified SANs to the SANs in the certificate
+	// request.
+	CustomSANsMerge CustomSANsMode = "merge"
+	// CustomSANsToken uses only the verified SANs, ignoring the ones in the
+	// certificate request.
+	CustomSANsToken CustomSANsMode = "token"
+)
+
+// Validate returns an error if the mode is not supported.
+func (m CustomSANsMode) Validate() error {
+	switch m {
+	case "", CustomSANsCSR, CustomSANsMerge, CustomSANsToken:
+		return nil
+	default:
+		return errors.Errorf("unsupported customSANsMode %q", m)
+	}
+}
+
+// customSANsOptions applies the mode to the template data and returns the
+// sign options required by it. The given SANs are the verified ones.
+func customSANsOptions(mode CustomSANsMode, data x509util.TemplateData, sans []string) []SignOption {
+	switch mode {
+	case CustomSANsMerge:
+		return []SignOption{mergeSANsModifier(sans)}
+	case CustomSANsToken:
+		data.SetSANs(sans)
+		return nil
+	default:
+		return nil
+	}
+}
+
+// mergeSANsModifier adds the given SANs to the certificate if they are not
+// already present.
+type mergeSANsModifier []string
+
+func (o mergeSANsModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	dnsNames, ips, emails, uris := x509util.SplitSANs(o)
+	for _, dns := range dnsNames {
+		if !containsString(cert.DNSNames, dns) {
+			cert.DNSNames = append(cert.DNSNames, dns)
+		}
+	}
+	for _, ip := range ips {
+		if !containsIP(cert.IPAddresses, ip) {
+			cert.IPAddresses = append(cert.IPAddresses, ip)
+		}
+	}
+	for _, email := range emails {
+		if !containsString(cert.EmailAddresses, email) {
+			cert.EmailAddresses = append(cert.EmailAddresses, email)
+		}
+	}
+	for _, u := range uris {
+		if !containsURI(cert.URIs, u) {
+			cert.URIs = append(cert.URIs, u)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStringFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(list []net.IP, ip net.IP) bool {
+	for _, v := range list {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsURI(list []*url.URL, u *url.URL) bool {
+	for _, v := range list {
+		if v.String() == u.String() {
+			return true
+		}
+	}
+	return false
+}
+
 type provisionerExtensionOption struct {
 	Extension
 	Disabled bool
@@ -2,19 +2,31 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
 )
 
 func Test_defaultPublicKeyValidator_Valid(t *testing.T) {
@@ -106,6 +118,118 @@ func Test_commonNameValidator_Valid(t *testing.T) {
 	}
 }
 
+func Test_commonNameModifier_Modify(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+	assert.FatalError(t, commonNameModifier("instance-id").Modify(cert, SignOptions{}))
+	assert.Equals(t, "instance-id", cert.Subject.CommonName)
+}
+
+func Test_forbidCommonNameValidator_Valid(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"ok", &x509.CertificateRequest{DNSNames: []string{"foo.bar.zar"}}, false},
+		{"ok organization", &x509.CertificateRequest{Subject: pkix.Name{Organization: []string{"Smallstep"}}}, false},
+		{"fail", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo.bar.zar"}, DNSNames: []string{"foo.bar.zar"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (forbidCommonNameValidator{}).Valid(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("forbidCommonNameValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_forbidCommonNameModifier_Modify(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{Subject: pkix.Name{CommonName: "foo.bar.zar", Organization: []string{"Smallstep"}}, DNSNames: []string{"foo.bar.zar"}}, false},
+		{"ok ip", &x509.Certificate{Subject: pkix.Name{CommonName: "10.0.0.1"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}, false},
+		{"ok uri", &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/foo"}}}, false},
+		{"fail no sans", &x509.Certificate{Subject: pkix.Name{CommonName: "foo.bar.zar"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := tt.cert.Subject.Organization
+			err := (forbidCommonNameModifier{}).Modify(tt.cert, SignOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("forbidCommonNameModifier.Modify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, "", tt.cert.Subject.CommonName)
+			assert.Equals(t, org, tt.cert.Subject.Organization)
+		})
+	}
+}
+
+func Test_commonNameSANModifier_Modify(t *testing.T) {
+	newCert := func() *x509.Certificate {
+		return &x509.Certificate{
+			DNSNames:       []string{"foo.internal"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			EmailAddresses: []string{"jane@smallstep.com"},
+			URIs:           []*url.URL{{Scheme: "https", Host: "foo.internal"}},
+		}
+	}
+	tests := []struct {
+		name       string
+		modifier   commonNameSANModifier
+		wantDNS    []string
+		wantIPs    []net.IP
+		wantEmails []string
+		wantURIs   []*url.URL
+	}{
+		{"ok dns", commonNameSANModifier{Name: "bar.internal"},
+			[]string{"bar.internal", "foo.internal"}, []net.IP{net.ParseIP("10.0.0.1")}, []string{"jane@smallstep.com"}, []*url.URL{{Scheme: "https", Host: "foo.internal"}}},
+		{"ok dns duplicate", commonNameSANModifier{Name: "foo.internal"},
+			[]string{"foo.internal"}, []net.IP{net.ParseIP("10.0.0.1")}, []string{"jane@smallstep.com"}, []*url.URL{{Scheme: "https", Host: "foo.internal"}}},
+		{"ok ip", commonNameSANModifier{Name: "10.0.0.2"},
+			[]string{"foo.internal"}, []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")}, []string{"jane@smallstep.com"}, []*url.URL{{Scheme: "https", Host: "foo.internal"}}},
+		{"ok email", commonNameSANModifier{Name: "jane@smallstep.com"},
+			[]string{"foo.internal"}, []net.IP{net.ParseIP("10.0.0.1")}, []string{"jane@smallstep.com"}, []*url.URL{{Scheme: "https", Host: "foo.internal"}}},
+		{"ok uri", commonNameSANModifier{Name: "spiffe://example.org/foo"},
+			[]string{"foo.internal"}, []net.IP{net.ParseIP("10.0.0.1")}, []string{"jane@smallstep.com"}, []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/foo"}, {Scheme: "https", Host: "foo.internal"}}},
+		{"ok only dns", commonNameSANModifier{Name: "bar.internal", Only: true},
+			[]string{"bar.internal"}, nil, nil, nil},
+		{"ok only email", commonNameSANModifier{Name: "joe@smallstep.com", Only: true},
+			nil, nil, []string{"joe@smallstep.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := newCert()
+			assert.FatalError(t, tt.modifier.Modify(cert, SignOptions{}))
+			assert.Equals(t, tt.modifier.Name, cert.Subject.CommonName)
+			assert.Equals(t, tt.wantDNS, cert.DNSNames)
+			assert.Equals(t, tt.wantIPs, cert.IPAddresses)
+			assert.Equals(t, tt.wantEmails, cert.EmailAddresses)
+			assert.Equals(t, tt.wantURIs, cert.URIs)
+		})
+	}
+}
+
+func Test_resolvedSANsModifier_Modify(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"foo.internal"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:        []*url.URL{{Scheme: "https", Host: "foo.internal"}},
+	}
+	m := resolvedSANsModifier{
+		DNSNames:    []string{"foo.internal", "bar.internal"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+		URIs:        []*url.URL{{Scheme: "https", Host: "foo.internal"}, {Scheme: "spiffe", Host: "example.org", Path: "/foo"}},
+	}
+	assert.FatalError(t, m.Modify(cert, SignOptions{}))
+	assert.Equals(t, []string{"foo.internal", "bar.internal"}, cert.DNSNames)
+	assert.Equals(t, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, cert.IPAddresses)
+	assert.Equals(t, []*url.URL{{Scheme: "https", Host: "foo.internal"}, {Scheme: "spiffe", Host: "example.org", Path: "/foo"}}, cert.URIs)
+}
+
 func Test_commonNameSliceValidator_Valid(t *testing.T) {
 	type args struct {
 		req *x509.CertificateRequest
@@ -349,17 +473,176 @@ func Test_defaultSANsValidator_Valid(t *testing.T) {
 	}
 }
 
+func Test_newNameConstraintsValidator(t *testing.T) {
+	tests := []struct {
+		name      string
+		permitted []string
+		excluded  []string
+		ipRanges  []string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{"ok empty", nil, nil, nil, true, false},
+		{"ok", []string{"example.com", ".internal.example.com"}, []string{"secret.example.com"}, []string{"10.0.0.0/8", "2001:db8::/32"}, false, false},
+		{"ok only ip ranges", nil, nil, []string{"10.0.0.0/8"}, false, false},
+		{"fail permitted", []string{"foo..example.com"}, nil, nil, false, true},
+		{"fail permitted wildcard", []string{"*.example.com"}, nil, nil, false, true},
+		{"fail excluded", nil, []string{""}, nil, false, true},
+		{"fail ip range", nil, nil, []string{"10.0.0.1"}, false, true},
+		{"fail cidr", nil, nil, []string{"10.0.0.0/33"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newNameConstraintsValidator(tt.permitted, tt.excluded, tt.ipRanges)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newNameConstraintsValidator() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != (tt.wantNil || tt.wantErr) {
+				t.Errorf("newNameConstraintsValidator() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_nameConstraintsValidator_Valid(t *testing.T) {
+	v, err := newNameConstraintsValidator([]string{"example.com", ".internal.example.org"}, []string{"secret.example.com"}, []string{"10.0.0.0/8"})
+	assert.FatalError(t, err)
+	dnsOnly, err := newNameConstraintsValidator([]string{"example.com"}, nil, nil)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name      string
+		validator *nameConstraintsValidator
+		cert      *x509.Certificate
+		wantErr   bool
+	}{
+		{"ok", v, &x509.Certificate{
+			DNSNames:       []string{"example.com", "foo.example.com", "foo.internal.example.org"},
+			IPAddresses:    []net.IP{net.ParseIP("10.1.2.3")},
+			EmailAddresses: []string{"jane@doe.com"},
+		}, false},
+		{"ok empty", v, &x509.Certificate{}, false},
+		{"ok unconstrained ip", dnsOnly, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}}, false},
+		{"fail permitted dns", v, &x509.Certificate{DNSNames: []string{"example.org"}}, true},
+		{"fail leading period", v, &x509.Certificate{DNSNames: []string{"internal.example.org"}}, true},
+		{"fail excluded dns", v, &x509.Certificate{DNSNames: []string{"foo.secret.example.com"}}, true},
+		{"fail permitted ip", v, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}}, true},
+		{"fail ipv6", v, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("2001:db8::1")}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator.Valid(tt.cert, SignOptions{})
+			if !tt.wantErr {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+			}
+		})
+	}
+}
+
+func Test_newKeyPolicyValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    *AllowedKeys
+		want    *keyPolicyValidator
+		wantErr bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok empty", &AllowedKeys{}, nil, false},
+		{"ok", &AllowedKeys{Types: []string{"RSA", "ECDSA"}, MinRSABits: 3072, Curves: []string{"P-384"}}, &keyPolicyValidator{
+			types:      map[string]bool{"RSA": true, "ECDSA": true},
+			minRSABits: 3072,
+			curves:     map[string]bool{"P-384": true},
+		}, false},
+		{"ok only size", &AllowedKeys{MinRSABits: 4096}, &keyPolicyValidator{minRSABits: 4096}, false},
+		{"fail type", &AllowedKeys{Types: []string{"DSA"}}, nil, true},
+		{"fail negative bits", &AllowedKeys{MinRSABits: -1}, nil, true},
+		{"fail weak bits", &AllowedKeys{MinRSABits: 1024}, nil, true},
+		{"fail bits without rsa", &AllowedKeys{Types: []string{"ECDSA"}, MinRSABits: 3072}, nil, true},
+		{"fail curves without ecdsa", &AllowedKeys{Types: []string{"Ed25519"}, Curves: []string{"P-256"}}, nil, true},
+		{"fail curve", &AllowedKeys{Curves: []string{"P-224"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newKeyPolicyValidator(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newKeyPolicyValidator() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newKeyPolicyValidator() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_keyPolicyValidator_Valid(t *testing.T) {
+	mustPublicKey := func(kty, crv string, size int) interface{} {
+		priv, err := keyutil.GenerateKey(kty, crv, size)
+		assert.FatalError(t, err)
+		pub, err := keyutil.PublicKey(priv)
+		assert.FatalError(t, err)
+		return pub
+	}
+	rsa2048 := mustPublicKey("RSA", "", 2048)
+	p256 := mustPublicKey("EC", "P-256", 0)
+	p384 := mustPublicKey("EC", "P-384", 0)
+	ed25519Key := mustPublicKey("OKP", "Ed25519", 0)
+
+	ecOnly, err := newKeyPolicyValidator(&AllowedKeys{Types: []string{"ECDSA"}, Curves: []string{"P-384"}})
+	assert.FatalError(t, err)
+	strongRSA, err := newKeyPolicyValidator(&AllowedKeys{MinRSABits: 3072})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		v    *keyPolicyValidator
+		key  interface{}
+		err  error
+	}{
+		{"ok ecdsa", ecOnly, p384, nil},
+		{"ok ecdsa any curve", strongRSA, p256, nil},
+		{"ok ed25519", strongRSA, ed25519Key, nil},
+		{"fail rsa type", ecOnly, rsa2048, errors.New("certificate request RSA keys are not allowed by the provisioner")},
+		{"fail ed25519 type", ecOnly, ed25519Key, errors.New("certificate request Ed25519 keys are not allowed by the provisioner")},
+		{"fail curve", ecOnly, p256, errors.New("certificate request ECDSA curve P-256 is not allowed by the provisioner")},
+		{"fail rsa bits", strongRSA, rsa2048, errors.New("certificate request RSA key must be at least 3072 bits, got 2048 bits")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Valid(&x509.CertificateRequest{PublicKey: tt.key})
+			if tt.err == nil {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+				assert.Equals(t, tt.err.Error(), err.Error())
+			}
+		})
+	}
+}
+
 func Test_validityValidator_Valid(t *testing.T) {
 	type test struct {
-		cert *x509.Certificate
-		opts SignOptions
-		vv   *validityValidator
-		err  error
+		cert     *x509.Certificate
+		opts     SignOptions
+		vv       *validityValidator
+		notAfter time.Time
+		err      error
 	}
 	tests := map[string]func() test{
 		"fail/notAfter-past": func() test {
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotAfter: time.Now().Add(-5 * time.Minute)},
 				opts: SignOptions{},
 				err:  errors.New("notAfter cannot be in the past"),
@@ -367,7 +650,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 		},
 		"fail/notBefore-after-notAfter": func() test {
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: time.Now().Add(10 * time.Minute),
 					NotAfter: time.Now().Add(5 * time.Minute)},
 				opts: SignOptions{},
@@ -377,7 +660,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 		"fail/duration-too-short": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(3 * time.Minute)},
 				opts: SignOptions{},
@@ -387,25 +670,89 @@ func Test_validityValidator_Valid(t *testing.T) {
 		"ok/duration-exactly-min": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(5 * time.Minute)},
 				opts: SignOptions{},
 			}
 		},
+		"fail/notBefore-offset-too-great": func() test {
+			n := now().Add(2 * time.Hour)
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, maxNotBeforeOffset: time.Hour},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(time.Hour)},
+				err: errors.New("is more than the authorized maximum of 1h0m0s in the future"),
+			}
+		},
+		"ok/notBefore-offset": func() test {
+			n := now().Add(30 * time.Minute)
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, maxNotBeforeOffset: time.Hour},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(time.Hour)},
+			}
+		},
+		"fail/backdate-too-great": func() test {
+			n := now().Add(-2 * time.Hour)
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, maxBackdate: time.Hour},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(3 * time.Hour)},
+				opts: SignOptions{Backdate: time.Minute},
+				err:  errors.New("is more than the authorized maximum of 1h0m0s in the past"),
+			}
+		},
+		"ok/backdate": func() test {
+			n := now().Add(-time.Hour - 30*time.Second)
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, maxBackdate: time.Hour},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(3 * time.Hour)},
+				opts: SignOptions{Backdate: time.Minute},
+			}
+		},
 		"fail/duration-too-great": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(24*time.Hour + time.Second)},
 				err: errors.New("is more than the authorized maximum certificate duration of "),
 			}
 		},
+		"ok/duration-too-great-clamp": func() test {
+			n := now()
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, clamp: true},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(48 * time.Hour)},
+				notAfter: n.Add(24 * time.Hour),
+			}
+		},
+		"ok/duration-too-great-clamp-with-backdate": func() test {
+			n := now()
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, clamp: true},
+				cert: &x509.Certificate{NotBefore: n.Add(-time.Minute),
+					NotAfter: n.Add(48 * time.Hour)},
+				opts:     SignOptions{Backdate: time.Minute},
+				notAfter: n.Add(24 * time.Hour),
+			}
+		},
+		"fail/duration-too-short-clamp": func() test {
+			n := now()
+			return test{
+				vv: &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, clamp: true},
+				cert: &x509.Certificate{NotBefore: n,
+					NotAfter: n.Add(3 * time.Minute)},
+				err: errors.New("is less than the authorized minimum certificate duration of "),
+			}
+		},
 		"ok/duration-exactly-max": func() test {
 			n := time.Now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(24 * time.Hour)},
 			}
@@ -415,7 +762,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 			cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(5 * time.Minute)}
 			time.Sleep(time.Second)
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: cert,
 				opts: SignOptions{Backdate: time.Second},
 			}
@@ -426,7 +773,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 			cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(24*time.Hour + backdate)}
 			time.Sleep(backdate)
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: cert,
 				opts: SignOptions{Backdate: backdate},
 			}
@@ -442,7 +789,53 @@ func Test_validityValidator_Valid(t *testing.T) {
 				}
 			} else {
 				assert.Nil(t, tt.err, fmt.Sprintf("expected err = %s, but not <nil>", tt.err))
+				if !tt.notAfter.IsZero() {
+					assert.Equals(t, tt.notAfter, tt.cert.NotAfter)
+				}
+			}
+		})
+	}
+}
+
+func Test_validityValidator_Valid_backdate(t *testing.T) {
+	backdate := time.Hour
+	tests := []struct {
+		name      string
+		vv        *validityValidator
+		so        SignOptions
+		notBefore time.Duration
+		notAfter  time.Duration
+		wantErr   bool
+	}{
+		{"ok", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, backdate: backdate},
+			SignOptions{}, -backdate, 5 * time.Minute, false},
+		{"ok notBefore", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, backdate: backdate},
+			SignOptions{NotBefore: NewTimeDuration(now().Add(time.Minute))}, time.Minute, 6 * time.Minute, false},
+		{"ok clamp", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, clamp: true, backdate: backdate},
+			SignOptions{NotAfter: NewTimeDuration(now().Add(48 * time.Hour))}, -backdate, 24 * time.Hour, false},
+		{"fail min", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, backdate: backdate},
+			SignOptions{NotAfter: NewTimeDuration(now().Add(3 * time.Minute))}, -backdate, 3 * time.Minute, true},
+		{"fail min clamp", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, clamp: true, backdate: backdate},
+			SignOptions{NotAfter: NewTimeDuration(now().Add(3 * time.Minute))}, -backdate, 3 * time.Minute, true},
+		{"fail max", &validityValidator{min: 5 * time.Minute, max: 24 * time.Hour, backdate: backdate},
+			SignOptions{NotAfter: NewTimeDuration(now().Add(48 * time.Hour))}, -backdate, 48 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			so := tt.so
+			so.Backdate = backdate
+			cert := new(x509.Certificate)
+			assert.FatalError(t, profileDefaultDuration(5*time.Minute).Modify(cert, so))
+
+			n := now()
+			assert.True(t, cert.NotBefore.Sub(n.Add(tt.notBefore)).Abs() < time.Minute)
+			err := tt.vv.Valid(cert, so)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
 			}
+			assert.FatalError(t, err)
+			assert.True(t, cert.NotAfter.Sub(n.Add(tt.notAfter)).Abs() < time.Minute)
 		})
 	}
 }
@@ -527,6 +920,276 @@ func Test_forceCN_Option(t *testing.T) {
 	}
 }
 
+func Test_uniqueSANOption_Modify(t *testing.T) {
+	cert := &x509.Certificate{}
+	assert.FatalError(t, newUniqueSANOption(false).Modify(cert, SignOptions{}))
+	assert.Len(t, 0, cert.URIs)
+
+	uri := &url.URL{Scheme: "spiffe", Host: "example.com", Path: "/foo"}
+	cert1 := &x509.Certificate{URIs: []*url.URL{uri}}
+	cert2 := &x509.Certificate{URIs: []*url.URL{uri}}
+	assert.FatalError(t, newUniqueSANOption(true).Modify(cert1, SignOptions{}))
+	assert.FatalError(t, newUniqueSANOption(true).Modify(cert2, SignOptions{}))
+	assert.Len(t, 2, cert1.URIs)
+	assert.Len(t, 2, cert2.URIs)
+	assert.Equals(t, uri, cert1.URIs[0])
+	assert.Equals(t, "urn", cert1.URIs[1].Scheme)
+	assert.True(t, strings.HasPrefix(cert1.URIs[1].String(), "urn:uuid:"))
+	assert.NotEquals(t, cert1.URIs[1].String(), cert2.URIs[1].String())
+}
+
+func TestDuplicateDNSNamesPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       DuplicateDNSNamesPolicy
+		wantErr bool
+	}{
+		{"ok empty", "", false},
+		{"ok reject", DuplicateDNSNamesReject, false},
+		{"ok revoke", DuplicateDNSNamesRevoke, false},
+		{"fail", "replace", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DuplicateDNSNamesPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_signatureAlgorithmOption_Modify(t *testing.T) {
+	allowed := []x509.SignatureAlgorithm{x509.SHA256WithRSA, x509.ECDSAWithSHA384}
+	tests := []struct {
+		name    string
+		allowed []x509.SignatureAlgorithm
+		opts    SignOptions
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ok default", allowed, SignOptions{}, x509.UnknownSignatureAlgorithm, false},
+		{"ok default not allowed", nil, SignOptions{}, x509.UnknownSignatureAlgorithm, false},
+		{"ok", allowed, SignOptions{SignatureAlgorithm: "ECDSA-SHA384"}, x509.ECDSAWithSHA384, false},
+		{"ok case insensitive", allowed, SignOptions{SignatureAlgorithm: "sha256-rsa"}, x509.SHA256WithRSA, false},
+		{"fail not allowed", allowed, SignOptions{SignatureAlgorithm: "ECDSA-SHA256"}, x509.UnknownSignatureAlgorithm, true},
+		{"fail no allowed algorithms", nil, SignOptions{SignatureAlgorithm: "SHA256-RSA"}, x509.UnknownSignatureAlgorithm, true},
+		{"fail unsupported", allowed, SignOptions{SignatureAlgorithm: "SHA3-RSA"}, x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{}
+			if err := newSignatureAlgorithmOption(tt.allowed).Modify(cert, tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("signatureAlgorithmOption.Modify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cert.SignatureAlgorithm != tt.want {
+				t.Errorf("signatureAlgorithmOption.Modify() SignatureAlgorithm = %v, want %v", cert.SignatureAlgorithm, tt.want)
+			}
+		})
+	}
+}
+
+func Test_signatureAlgorithmOption_Modify_forced(t *testing.T) {
+	o := &signatureAlgorithmOption{
+		Allowed: []x509.SignatureAlgorithm{x509.SHA256WithRSA},
+		Forced:  x509.SHA384WithRSAPSS,
+	}
+	tests := []struct {
+		name    string
+		opts    SignOptions
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ok default", SignOptions{}, x509.SHA384WithRSAPSS, false},
+		{"ok requested", SignOptions{SignatureAlgorithm: "SHA384-RSAPSS"}, x509.SHA384WithRSAPSS, false},
+		{"fail allowed", SignOptions{SignatureAlgorithm: "SHA256-RSA"}, x509.UnknownSignatureAlgorithm, true},
+		{"fail other", SignOptions{SignatureAlgorithm: "SHA256-RSAPSS"}, x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{}
+			if err := o.Modify(cert, tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("signatureAlgorithmOption.Modify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cert.SignatureAlgorithm != tt.want {
+				t.Errorf("signatureAlgorithmOption.Modify() SignatureAlgorithm = %v, want %v", cert.SignatureAlgorithm, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSignerSignatureAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.FatalError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	keys := map[string]crypto.PublicKey{
+		"":      rsaKey.Public(),
+		"small": smallRSAKey.Public(),
+		"ec":    ecKey.Public(),
+		"ed":    edPub,
+	}
+	tests := []struct {
+		name    string
+		sigAlg  string
+		signer  string
+		keys    map[string]crypto.PublicKey
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ok empty", "", "", nil, x509.UnknownSignatureAlgorithm, false},
+		{"ok rsa pss", "SHA256-RSAPSS", "", keys, x509.SHA256WithRSAPSS, false},
+		{"ok rsa pss sha512", "SHA512-RSAPSS", "", keys, x509.SHA512WithRSAPSS, false},
+		{"ok rsa", "SHA384-RSA", "", keys, x509.SHA384WithRSA, false},
+		{"ok small rsa pss", "SHA256-RSAPSS", "small", keys, x509.SHA256WithRSAPSS, false},
+		{"ok ecdsa", "ECDSA-SHA384", "ec", keys, x509.ECDSAWithSHA384, false},
+		{"ok ed25519", "Ed25519", "ed", keys, x509.PureEd25519, false},
+		{"fail unsupported", "SHA3-RSAPSS", "", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail unknown key", "SHA256-RSAPSS", "", nil, x509.UnknownSignatureAlgorithm, true},
+		{"fail unknown signer", "SHA256-RSAPSS", "foo", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail ecdsa key", "SHA256-RSAPSS", "ec", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail ed25519 key", "SHA256-RSAPSS", "ed", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail rsa key", "ECDSA-SHA256", "", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail small rsa key", "SHA512-RSAPSS", "small", keys, x509.UnknownSignatureAlgorithm, true},
+		{"fail sha1", "SHA1-RSA", "", keys, x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSignerSignatureAlgorithm(tt.sigAlg, tt.signer, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSignerSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSignerSignatureAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	keys := map[string]crypto.PublicKey{
+		"":   ecKey.Public(),
+		"ec": ecKey.Public(),
+	}
+	tests := []struct {
+		name    string
+		signer  string
+		keys    map[string]crypto.PublicKey
+		wantErr bool
+	}{
+		{"ok default", "", keys, false},
+		{"ok", "ec", keys, false},
+		{"ok unknown keys", "foo", nil, false},
+		{"fail unknown signer", "foo", keys, true},
+		{"fail no signers", "ec", map[string]crypto.PublicKey{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSigner(tt.signer, tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("validateSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateAllowedSigners(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	keys := map[string]crypto.PublicKey{
+		"":    rsaKey.Public(),
+		"rsa": rsaKey.Public(),
+		"ec":  ecKey.Public(),
+	}
+	tests := []struct {
+		name    string
+		names   []string
+		sigAlg  x509.SignatureAlgorithm
+		keys    map[string]crypto.PublicKey
+		wantErr bool
+	}{
+		{"ok empty", nil, x509.UnknownSignatureAlgorithm, keys, false},
+		{"ok", []string{"rsa", "ec"}, x509.UnknownSignatureAlgorithm, keys, false},
+		{"ok signature algorithm", []string{"rsa"}, x509.SHA256WithRSAPSS, keys, false},
+		{"ok unknown keys", []string{"foo"}, x509.SHA256WithRSAPSS, nil, false},
+		{"fail empty name", []string{""}, x509.UnknownSignatureAlgorithm, keys, true},
+		{"fail unknown signer", []string{"rsa", "foo"}, x509.UnknownSignatureAlgorithm, keys, true},
+		{"fail signature algorithm", []string{"rsa", "ec"}, x509.SHA256WithRSAPSS, keys, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAllowedSigners(tt.names, tt.sigAlg, tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("validateAllowedSigners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX509AllowedSigners_Allows(t *testing.T) {
+	signers := X509AllowedSigners{"foo", "bar"}
+	assert.True(t, signers.Allows("foo"))
+	assert.True(t, signers.Allows("bar"))
+	assert.False(t, signers.Allows("zar"))
+	assert.False(t, signers.Allows(""))
+	assert.False(t, X509AllowedSigners(nil).Allows("foo"))
+}
+
+func TestCustomSANsMode_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    CustomSANsMode
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"csr", CustomSANsCSR, false},
+		{"merge", CustomSANsMerge, false},
+		{"token", CustomSANsToken, false},
+		{"fail", "replace", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mode.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CustomSANsMode.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_customSANsOptions(t *testing.T) {
+	sans := []string{"foo.internal", "10.0.0.1"}
+
+	data := x509util.NewTemplateData()
+	assert.Len(t, 0, customSANsOptions("", data, sans))
+	assert.Len(t, 0, customSANsOptions(CustomSANsCSR, data, sans))
+	assert.Nil(t, data[x509util.SANsKey])
+
+	assert.Equals(t, []SignOption{mergeSANsModifier(sans)}, customSANsOptions(CustomSANsMerge, data, sans))
+	assert.Nil(t, data[x509util.SANsKey])
+
+	assert.Len(t, 0, customSANsOptions(CustomSANsToken, data, sans))
+	assert.Equals(t, x509util.CreateSANs(sans), data[x509util.SANsKey])
+}
+
+func Test_mergeSANsModifier_Modify(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"foo.example.com", "foo.internal"},
+		IPAddresses: []net.IP{net.ParseIP("192.168.0.1")},
+	}
+	m := mergeSANsModifier([]string{"foo.internal", "10.0.0.1", "192.168.0.1", "foo@example.com", "spiffe://example.com/foo"})
+	assert.FatalError(t, m.Modify(cert, SignOptions{}))
+	assert.Equals(t, []string{"foo.example.com", "foo.internal"}, cert.DNSNames)
+	assert.Equals(t, []net.IP{net.ParseIP("192.168.0.1"), net.ParseIP("10.0.0.1")}, cert.IPAddresses)
+	assert.Equals(t, []string{"foo@example.com"}, cert.EmailAddresses)
+	assert.Equals(t, []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}}, cert.URIs)
+}
+
 func Test_profileDefaultDuration_Option(t *testing.T) {
 	type test struct {
 		so    SignOptions
@@ -798,3 +1461,217 @@ func Test_profileLimitDuration_Option(t *testing.T) {
 		})
 	}
 }
+
+func Test_csrLimitsValidator_Valid(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	newCSR := func(extensions, size int) *x509.CertificateRequest {
+		tmpl := &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+			DNSNames: []string{"test.smallstep.com"},
+		}
+		for i := 0; i < extensions; i++ {
+			tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, pkix.Extension{
+				Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, i + 1},
+				Value: make([]byte, size),
+			})
+		}
+		der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, signer)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		assert.FatalError(t, err)
+		return csr
+	}
+
+	tests := []struct {
+		name    string
+		v       csrLimitsValidator
+		csr     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"ok", csrLimitsValidator{10, 1024, 0, 0}, newCSR(5, 10), false},
+		{"ok no limits", csrLimitsValidator{0, 0, 0, 0}, newCSR(20, 100), false},
+		{"ok defaults", NewCSRLimitsValidator(nil).(csrLimitsValidator), newCSR(20, 100), false},
+		{"fail extensions", csrLimitsValidator{10, 0, 0, 0}, newCSR(11, 1), true},
+		{"fail size", csrLimitsValidator{0, 1024, 0, 0}, newCSR(1, 1024), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.Valid(tt.csr); (err != nil) != tt.wantErr {
+				t.Errorf("csrLimitsValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parseExtKeyUsages(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []x509.ExtKeyUsage
+		wantErr bool
+	}{
+		{"ok empty", nil, nil, false},
+		{"ok", []string{"clientAuth"}, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, false},
+		{"ok multiple", []string{"ServerAuth", "client_auth", "ocspSigning"}, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageOCSPSigning}, false},
+		{"fail unknown", []string{"clientAuth", "webAuth"}, nil, true},
+		{"fail empty name", []string{""}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExtKeyUsages(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExtKeyUsages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_extKeyUsageModifier_Modify(t *testing.T) {
+	ekuExtension := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: []byte{0x30, 0x00}}
+	otherExtension := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}
+	clientAuth := extKeyUsageModifier{x509.ExtKeyUsageClientAuth}
+
+	tests := []struct {
+		name string
+		m    extKeyUsageModifier
+		cert *x509.Certificate
+		want *x509.Certificate
+	}{
+		{"ok empty", clientAuth, &x509.Certificate{}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}},
+		{"ok strip server auth", clientAuth, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}},
+		{"ok strip unknown", clientAuth, &x509.Certificate{
+			UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}},
+		}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}},
+		{"ok strip extension", clientAuth, &x509.Certificate{
+			ExtraExtensions: []pkix.Extension{otherExtension, ekuExtension},
+		}, &x509.Certificate{
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			ExtraExtensions: []pkix.Extension{otherExtension},
+		}},
+		{"ok multiple", extKeyUsageModifier{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}, &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.FatalError(t, tt.m.Modify(tt.cert, SignOptions{}))
+			assert.Equals(t, tt.want.ExtKeyUsage, tt.cert.ExtKeyUsage)
+			assert.Equals(t, tt.want.UnknownExtKeyUsage, tt.cert.UnknownExtKeyUsage)
+			assert.Equals(t, len(tt.want.ExtraExtensions), len(tt.cert.ExtraExtensions))
+			for i := range tt.want.ExtraExtensions {
+				assert.Equals(t, tt.want.ExtraExtensions[i], tt.cert.ExtraExtensions[i])
+			}
+		})
+	}
+}
+
+func Test_crlDistributionPointsModifier_Modify(t *testing.T) {
+	tests := []struct {
+		name string
+		m    crlDistributionPointsModifier
+		cert *x509.Certificate
+		want []string
+	}{
+		{"ok empty", crlDistributionPointsModifier{"https://crl.smallstep.com"}, &x509.Certificate{}, []string{"https://crl.smallstep.com"}},
+		{"ok replace", crlDistributionPointsModifier{"https://crl.smallstep.com", "ldap:///cn=crl"}, &x509.Certificate{
+			CRLDistributionPoints: []string{"https://ca.smallstep.com/1.0/crl"},
+		}, []string{"https://crl.smallstep.com", "ldap:///cn=crl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.FatalError(t, tt.m.Modify(tt.cert, SignOptions{}))
+			assert.Equals(t, tt.want, tt.cert.CRLDistributionPoints)
+		})
+	}
+}
+
+func Test_csrLimitsValidator_Valid_sans(t *testing.T) {
+	newCSR := func(dns, ips, emails, uris int) *x509.CertificateRequest {
+		csr := new(x509.CertificateRequest)
+		for i := 0; i < dns; i++ {
+			csr.DNSNames = append(csr.DNSNames, fmt.Sprintf("host-%d.smallstep.com", i))
+		}
+		for i := 0; i < ips; i++ {
+			csr.IPAddresses = append(csr.IPAddresses, net.IPv4(10, 0, 0, byte(i)))
+		}
+		for i := 0; i < emails; i++ {
+			csr.EmailAddresses = append(csr.EmailAddresses, fmt.Sprintf("user-%d@smallstep.com", i))
+		}
+		for i := 0; i < uris; i++ {
+			csr.URIs = append(csr.URIs, &url.URL{Scheme: "spiffe", Host: "smallstep.com", Path: fmt.Sprintf("/workload-%d", i)})
+		}
+		return csr
+	}
+	withName := func(csr *x509.CertificateRequest, fn func(*x509.CertificateRequest)) *x509.CertificateRequest {
+		fn(csr)
+		return csr
+	}
+	// 10 characters each
+	dnsName := "abcdef.com"
+	email := "abc@de.com"
+	uri := &url.URL{Scheme: "urn", Opaque: "abcdef"}
+	// The requests are not serialized, skip the attributes size.
+	defaults := NewCSRLimitsValidator(nil).(csrLimitsValidator)
+	defaults.maxAttributesSize = 0
+
+	tests := []struct {
+		name    string
+		v       csrLimitsValidator
+		csr     *x509.CertificateRequest
+		wantErr string
+	}{
+		{"ok no sans", csrLimitsValidator{maxSANs: 4}, newCSR(0, 0, 0, 0), ""},
+		{"ok max sans", csrLimitsValidator{maxSANs: 4}, newCSR(1, 1, 1, 1), ""},
+		{"ok max dns names", csrLimitsValidator{maxSANs: 4}, newCSR(4, 0, 0, 0), ""},
+		{"ok no limits", csrLimitsValidator{}, newCSR(500, 200, 500, 500), ""},
+		{"ok defaults", defaults, newCSR(25, 25, 25, 25), ""},
+		{"fail sans", csrLimitsValidator{maxSANs: 4}, newCSR(2, 1, 1, 1), "certificate request with 5 subject alternative names is more than the allowed maximum of 4 names"},
+		{"fail ips", csrLimitsValidator{maxSANs: 4}, newCSR(0, 5, 0, 0), "certificate request with 5 subject alternative names is more than the allowed maximum of 4 names"},
+		{"fail defaults", defaults, newCSR(26, 25, 25, 25), "certificate request with 101 subject alternative names is more than the allowed maximum of 100 names"},
+		{"ok max length", csrLimitsValidator{maxSANLength: 10}, withName(newCSR(0, 1, 0, 0), func(csr *x509.CertificateRequest) {
+			csr.DNSNames = []string{dnsName}
+			csr.EmailAddresses = []string{email}
+			csr.URIs = []*url.URL{uri}
+		}), ""},
+		{"fail dns name length", csrLimitsValidator{maxSANLength: 9}, withName(newCSR(0, 0, 0, 0), func(csr *x509.CertificateRequest) {
+			csr.DNSNames = []string{dnsName}
+		}), "certificate request dns name of 10 characters is longer than the allowed maximum of 9 characters"},
+		{"fail email length", csrLimitsValidator{maxSANLength: 9}, withName(newCSR(0, 0, 0, 0), func(csr *x509.CertificateRequest) {
+			csr.EmailAddresses = []string{email}
+		}), "certificate request email address of 10 characters is longer than the allowed maximum of 9 characters"},
+		{"fail uri length", csrLimitsValidator{maxSANLength: 9}, withName(newCSR(0, 0, 0, 0), func(csr *x509.CertificateRequest) {
+			csr.URIs = []*url.URL{uri}
+		}), "certificate request uri of 10 characters is longer than the allowed maximum of 9 characters"},
+		{"fail default length", defaults, withName(newCSR(0, 0, 0, 0), func(csr *x509.CertificateRequest) {
+			csr.DNSNames = []string{strings.Repeat("a", DefaultMaxSANLength+1)}
+		}), "certificate request dns name of 2049 characters is longer than the allowed maximum of 2048 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Valid(tt.csr)
+			if tt.wantErr == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.wantErr, err.Error())
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc)) {
+					assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
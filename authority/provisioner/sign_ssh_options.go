@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"net"
 	"strings"
 	"time"
 
@@ -143,6 +144,18 @@ func (m sshCertValidBeforeModifier) Modify(cert *ssh.Certificate, _ SignSSHOptio
 	return nil
 }
 
+// sshRequestedPrincipalsModifier is an SSHCertModifier that sets the
+// ValidPrincipals in the SSH certificate to the requested ones, if any. The
+// requested principals must be validated by other options.
+type sshRequestedPrincipalsModifier struct{}
+
+func (m sshRequestedPrincipalsModifier) Modify(cert *ssh.Certificate, opts SignSSHOptions) error {
+	if len(opts.Principals) > 0 {
+		cert.ValidPrincipals = opts.Principals
+	}
+	return nil
+}
+
 // sshDefaultDuration is an SSHCertModifier that sets the certificate
 // ValidAfter and ValidBefore if they have not been set. It will fail if a
 // CertType has not been set or is not valid.
@@ -375,20 +388,32 @@ func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, _ SignSSHOpti
 // sshNamePolicyValidator validates that the certificate (to be signed)
 // contains only allowed principals.
 type sshNamePolicyValidator struct {
-	hostPolicyEngine policy.HostPolicy
-	userPolicyEngine policy.UserPolicy
+	hostPolicyEngine     policy.HostPolicy
+	userPolicyEngine     policy.UserPolicy
+	strictHostPrincipals bool
 }
 
-// newSSHNamePolicyValidator return a new SSH allow/deny validator.
-func newSSHNamePolicyValidator(host policy.HostPolicy, user policy.UserPolicy) *sshNamePolicyValidator {
+// newSSHNamePolicyValidator return a new SSH allow/deny validator. If
+// strictHostPrincipals is set, host certificates can only contain hostnames
+// and IP addresses.
+func newSSHNamePolicyValidator(host policy.HostPolicy, user policy.UserPolicy, strictHostPrincipals bool) *sshNamePolicyValidator {
 	return &sshNamePolicyValidator{
-		hostPolicyEngine: host,
-		userPolicyEngine: user,
+		hostPolicyEngine:     host,
+		userPolicyEngine:     user,
+		strictHostPrincipals: strictHostPrincipals,
 	}
 }
 
 // Valid validates that the certificate (to be signed) contains only allowed principals.
 func (v *sshNamePolicyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	if v.strictHostPrincipals && cert.CertType == ssh.HostCert {
+		for _, p := range cert.ValidPrincipals {
+			if !isHostnameOrIP(p) {
+				return errs.Forbidden("ssh host certificate principal %q is not a valid hostname or IP address", p)
+			}
+		}
+	}
+
 	if v.hostPolicyEngine == nil && v.userPolicyEngine == nil {
 		// no policy configured at all; allow anything
 		return nil
@@ -486,3 +511,26 @@ func sshParseRSAPublicKey(in []byte) (*rsa.PublicKey, error) {
 	key.N = w.N
 	return &key, nil
 }
+
+// isHostnameOrIP returns true if the given string is an IP address or a
+// hostname with valid DNS labels. Wildcards are not allowed.
+func isHostnameOrIP(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
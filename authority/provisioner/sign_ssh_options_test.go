@@ -736,3 +736,29 @@ func Test_sshDefaultDuration_Option(t *testing.T) {
 		})
 	}
 }
+
+func Test_sshNamePolicyValidator_strictHostPrincipals(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		cert    *ssh.Certificate
+		wantErr bool
+	}{
+		{"ok/lenient", false, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"foo bar", "*.smallstep.com"}}, false},
+		{"ok/hostnames", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"internal", "host.smallstep.com", "host.smallstep.com.", "10.0.0.1", "::1"}}, false},
+		{"ok/user", true, &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"foo@smallstep.com"}}, false},
+		{"fail/email", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"host.smallstep.com", "foo@smallstep.com"}}, true},
+		{"fail/space", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"foo bar"}}, true},
+		{"fail/wildcard", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"*.smallstep.com"}}, true},
+		{"fail/empty-label", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"host..smallstep.com"}}, true},
+		{"fail/hyphen", true, &ssh.Certificate{CertType: ssh.HostCert, ValidPrincipals: []string{"-host.smallstep.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSSHNamePolicyValidator(nil, nil, tt.strict)
+			if err := v.Valid(tt.cert, SignSSHOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("sshNamePolicyValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
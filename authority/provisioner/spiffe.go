@@ -0,0 +1,103 @@
+package provisioner
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// spiffeTrustDomainRegexp matches the characters allowed in a SPIFFE trust
+// domain name.
+var spiffeTrustDomainRegexp = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// spiffePathSegmentRegexp matches the characters allowed in a segment of a
+// SPIFFE ID path.
+var spiffePathSegmentRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// SPIFFEOptions configures the SPIFFE ID added by the cloud provisioners as a
+// URI SAN. The ID is built with the TrustDomain and the Path template, the
+// template can use the fields of the cloud identity supported by each
+// provisioner, e.g. "/gcp/{{ .ProjectID }}/{{ .InstanceID }}".
+type SPIFFEOptions struct {
+	TrustDomain string `json:"trustDomain"`
+	Path        string `json:"path"`
+	template    *template.Template
+}
+
+// init validates the options and parses the path template. The template can
+// only reference the given fields.
+func (o *SPIFFEOptions) init(fields []string) error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.TrustDomain == "":
+		return errors.New("spiffe trustDomain cannot be empty")
+	case !spiffeTrustDomainRegexp.MatchString(o.TrustDomain):
+		return errors.Errorf("spiffe trustDomain %q is not valid", o.TrustDomain)
+	case o.Path == "":
+		return errors.New("spiffe path cannot be empty")
+	case !strings.HasPrefix(o.Path, "/"):
+		return errors.Errorf("spiffe path %q must start with a /", o.Path)
+	}
+
+	tmpl, err := template.New("spiffe").Option("missingkey=error").Parse(o.Path)
+	if err != nil {
+		return errors.Wrap(err, "error parsing spiffe path")
+	}
+
+	// Execute the template with all the fields to reject unknown ones.
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f] = f
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, values); err != nil {
+		return errors.Wrapf(err, "error validating spiffe path, supported fields are %s", strings.Join(fields, ", "))
+	}
+
+	o.template = tmpl
+	return nil
+}
+
+// newOptions returns the sign options that add the SPIFFE ID built with the
+// given values to the certificate.
+func (o *SPIFFEOptions) newOptions(values map[string]string) ([]SignOption, error) {
+	if o == nil || o.template == nil {
+		return nil, nil
+	}
+	u, err := o.spiffeID(values)
+	if err != nil {
+		return nil, err
+	}
+	return []SignOption{
+		resolvedSANsModifier{URIs: []*url.URL{u}},
+	}, nil
+}
+
+// spiffeID returns the SPIFFE ID built with the given values. The values are
+// escaped, so they cannot add new segments to the path.
+func (o *SPIFFEOptions) spiffeID(values map[string]string) (*url.URL, error) {
+	escaped := make(map[string]string, len(values))
+	for k, v := range values {
+		escaped[k] = url.PathEscape(v)
+	}
+	var buf bytes.Buffer
+	if err := o.template.Execute(&buf, escaped); err != nil {
+		return nil, errors.Wrap(err, "error executing spiffe path")
+	}
+	path := buf.String()
+	for _, s := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if s == "." || s == ".." || !spiffePathSegmentRegexp.MatchString(s) {
+			return nil, errors.Errorf("spiffe path %q is not valid", path)
+		}
+	}
+	return &url.URL{
+		Scheme: "spiffe",
+		Host:   o.TrustDomain,
+		Path:   path,
+	}, nil
+}
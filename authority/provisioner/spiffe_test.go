@@ -0,0 +1,168 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestSPIFFEOptions_init(t *testing.T) {
+	fields := []string{"ProjectID", "InstanceID"}
+	tests := []struct {
+		name    string
+		options *SPIFFEOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &SPIFFEOptions{TrustDomain: "example.org", Path: "/gcp/{{ .ProjectID }}/{{ .InstanceID }}"}, false},
+		{"ok static", &SPIFFEOptions{TrustDomain: "example.org", Path: "/workload"}, false},
+		{"fail trustDomain", &SPIFFEOptions{Path: "/{{ .InstanceID }}"}, true},
+		{"fail trustDomain characters", &SPIFFEOptions{TrustDomain: "Example.org", Path: "/{{ .InstanceID }}"}, true},
+		{"fail path", &SPIFFEOptions{TrustDomain: "example.org"}, true},
+		{"fail path prefix", &SPIFFEOptions{TrustDomain: "example.org", Path: "{{ .InstanceID }}"}, true},
+		{"fail template", &SPIFFEOptions{TrustDomain: "example.org", Path: "/{{ .InstanceID }"}, true},
+		{"fail unknown field", &SPIFFEOptions{TrustDomain: "example.org", Path: "/{{ .Zone }}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(fields); (err != nil) != tt.wantErr {
+				t.Errorf("SPIFFEOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSPIFFEOptions_spiffeID(t *testing.T) {
+	o := &SPIFFEOptions{TrustDomain: "example.org", Path: "/gcp/{{ .ProjectID }}/{{ .InstanceID }}"}
+	assert.FatalError(t, o.init([]string{"ProjectID", "InstanceID"}))
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"ok", map[string]string{"ProjectID": "project-id", "InstanceID": "1234"}, "spiffe://example.org/gcp/project-id/1234", false},
+		{"fail empty segment", map[string]string{"ProjectID": "", "InstanceID": "1234"}, "", true},
+		{"fail dot segment", map[string]string{"ProjectID": "..", "InstanceID": "1234"}, "", true},
+		{"fail characters", map[string]string{"ProjectID": "project id", "InstanceID": "1234"}, "", true},
+		{"fail missing value", map[string]string{"ProjectID": "project-id"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := o.spiffeID(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SPIFFEOptions.spiffeID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equals(t, tt.want, got.String())
+			}
+		})
+	}
+}
+
+// assertSPIFFEID applies the certificate modifiers in the given options and
+// checks the URIs of the resulting certificate.
+func assertSPIFFEID(t *testing.T, opts []SignOption, want string) {
+	t.Helper()
+	cert := new(x509.Certificate)
+	for _, o := range opts {
+		if m, ok := o.(resolvedSANsModifier); ok {
+			assert.FatalError(t, m.Modify(cert, SignOptions{}))
+		}
+	}
+	var got []string
+	for _, u := range cert.URIs {
+		got = append(got, u.String())
+	}
+	if want == "" {
+		assert.Len(t, 0, got)
+	} else {
+		assert.Equals(t, []string{want}, got)
+	}
+}
+
+func TestGCP_AuthorizeSign_spiffe(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.SPIFFE = &SPIFFEOptions{TrustDomain: "example.org", Path: "/gcp/{{ .ProjectID }}/{{ .Zone }}/{{ .InstanceID }}"}
+	assert.FatalError(t, p1.SPIFFE.init(gcpIdentityFields))
+
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.DisableCustomSANs = true
+	p2.keyStore = p1.keyStore
+	p2.SPIFFE = &SPIFFEOptions{TrustDomain: "example.org", Path: "/{{ .InstanceName }}"}
+	assert.FatalError(t, p2.SPIFFE.init(gcpIdentityFields))
+
+	p3, err := generateGCP()
+	assert.FatalError(t, err)
+	p3.keyStore = p1.keyStore
+
+	tests := []struct {
+		name         string
+		prov         *GCP
+		instanceName string
+		want         string
+		wantErr      bool
+	}{
+		{"ok", p1, "instance-name", "spiffe://example.org/gcp/project-id/zone/instance-id", false},
+		{"ok disableCustomSANs", p2, "instance-name", "spiffe://example.org/instance-name", false},
+		{"ok not configured", p3, "instance-name", "", false},
+		{"fail invalid path", p2, "instance/name", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateGCPToken(tt.prov.ServiceAccounts[0],
+				"https://accounts.google.com", tt.prov.GetID(),
+				"instance-id", tt.instanceName, "project-id", "zone",
+				time.Now(), &p1.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			opts, err := tt.prov.AuthorizeSign(context.Background(), tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GCP.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assertSPIFFEID(t, opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWS_AuthorizeSign_spiffe(t *testing.T) {
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	p.SPIFFE = &SPIFFEOptions{TrustDomain: "example.org", Path: "/aws/{{ .AccountID }}/{{ .Region }}/{{ .InstanceID }}"}
+	assert.FatalError(t, p.SPIFFE.init(awsSPIFFEFields))
+
+	tok, err := p.GetIdentityToken("foo.local", "https://ca.smallstep.com")
+	assert.FatalError(t, err)
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assertSPIFFEID(t, opts, (&url.URL{
+		Scheme: "spiffe",
+		Host:   "example.org",
+		Path:   "/aws/" + p.Accounts[0] + "/us-west-1/instance-id",
+	}).String())
+}
+
+func TestAzure_AuthorizeSign_spiffe(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	p.SPIFFE = &SPIFFEOptions{TrustDomain: "example.org", Path: "/azure/{{ .SubscriptionID }}/{{ .ResourceGroup }}/{{ .Name }}"}
+	assert.FatalError(t, p.SPIFFE.init(azureSPIFFEFields))
+
+	tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "virtualMachine", "vm",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assertSPIFFEID(t, opts, "spiffe://example.org/azure/subscriptionID/resourceGroup/virtualMachine")
+}
@@ -0,0 +1,76 @@
+package provisioner
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// sshCertTypesValidator is an SSHCertValidator that rejects the SSH
+// certificates with a type not allowed by the provisioner.
+type sshCertTypesValidator struct {
+	name string
+	user bool
+	host bool
+}
+
+// newSSHCertTypesValidator validates the certificate types in the SSH options
+// and returns the validator that enforces them. It returns nil if they are not
+// configured or if they allow both types.
+func newSSHCertTypesValidator(p Interface, o *SSHOptions) (*sshCertTypesValidator, error) {
+	certTypes := o.GetCertTypes()
+	if certTypes == nil {
+		return nil, nil
+	}
+	// Only provisioners that sign SSH certificates support them.
+	switch p.GetType() {
+	case TypeJWK, TypeOIDC, TypeX5C, TypeK8sSA, TypeNebula, TypeAWS, TypeGCP, TypeAzure:
+	default:
+		return nil, errors.Errorf("ssh certTypes are not supported by %s provisioners", p.GetType())
+	}
+	if len(certTypes) == 0 {
+		return nil, errors.New("ssh certTypes cannot be empty")
+	}
+
+	v := &sshCertTypesValidator{name: p.GetName()}
+	for _, ct := range certTypes {
+		var seen bool
+		switch ct {
+		case SSHUserCert:
+			seen, v.user = v.user, true
+		case SSHHostCert:
+			seen, v.host = v.host, true
+		default:
+			return nil, errors.Errorf("unsupported ssh certType %q, it must be %q or %q", ct, SSHUserCert, SSHHostCert)
+		}
+		if seen {
+			return nil, errors.Errorf("ssh certTypes cannot contain duplicates, found %q", ct)
+		}
+	}
+	if v.user && v.host {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// Allow returns an error if the given certificate type, "user" or "host", is
+// not allowed.
+func (v *sshCertTypesValidator) Allow(certType string) error {
+	if v == nil || (certType == SSHUserCert && v.user) || (certType == SSHHostCert && v.host) {
+		return nil
+	}
+	return errs.Forbidden("ssh %s certificates are not allowed by provisioner %q", certType, v.name)
+}
+
+// Valid implements SSHCertValidator.
+func (v *sshCertTypesValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	switch cert.CertType {
+	case ssh.UserCert:
+		return v.Allow(SSHUserCert)
+	case ssh.HostCert:
+		return v.Allow(SSHHostCert)
+	default:
+		return errs.Forbidden("ssh certificate type %d is not allowed by provisioner %q", cert.CertType, v.name)
+	}
+}
@@ -0,0 +1,127 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_newSSHCertTypesValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Interface
+		options *SSHOptions
+		want    *sshCertTypesValidator
+		wantErr bool
+	}{
+		{"ok nil", &JWK{Name: "jwk"}, nil, nil, false},
+		{"ok not set", &ACME{Name: "acme"}, &SSHOptions{}, nil, false},
+		{"ok user", &JWK{Name: "jwk"}, &SSHOptions{CertTypes: []string{"user"}}, &sshCertTypesValidator{name: "jwk", user: true}, false},
+		{"ok host", &GCP{Name: "gcp"}, &SSHOptions{CertTypes: []string{"host"}}, &sshCertTypesValidator{name: "gcp", host: true}, false},
+		{"ok both", &OIDC{Name: "oidc"}, &SSHOptions{CertTypes: []string{"host", "user"}}, nil, false},
+		{"fail empty", &JWK{Name: "jwk"}, &SSHOptions{CertTypes: []string{}}, nil, true},
+		{"fail type", &JWK{Name: "jwk"}, &SSHOptions{CertTypes: []string{"User"}}, nil, true},
+		{"fail duplicates", &JWK{Name: "jwk"}, &SSHOptions{CertTypes: []string{"host", "host"}}, nil, true},
+		{"fail provisioner", &ACME{Name: "acme"}, &SSHOptions{CertTypes: []string{"host"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSSHCertTypesValidator(tt.p, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSSHCertTypesValidator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_sshCertTypesValidator_Valid(t *testing.T) {
+	user := &sshCertTypesValidator{name: "jwk", user: true}
+	host := &sshCertTypesValidator{name: "jwk", host: true}
+	tests := []struct {
+		name     string
+		v        *sshCertTypesValidator
+		certType uint32
+		wantErr  bool
+	}{
+		{"ok user", user, ssh.UserCert, false},
+		{"ok host", host, ssh.HostCert, false},
+		{"fail user", host, ssh.UserCert, true},
+		{"fail host", user, ssh.HostCert, true},
+		{"fail unknown", user, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Valid(&ssh.Certificate{CertType: tt.certType}, SignSSHOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sshCertTypesValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				assertStatusCode(t, http.StatusForbidden, err)
+			}
+		})
+	}
+}
+
+func TestJWK_AuthorizeSSHSign_sshCertTypes(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{SSH: &SSHOptions{CertTypes: []string{"host"}}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	jwk, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	iss, aud := p.Name, testAudiences.SSHSign[0]
+	hostToken, err := generateSimpleSSHHostToken(iss, aud, jwk)
+	assert.FatalError(t, err)
+	userToken, err := generateSimpleSSHUserToken(iss, aud, jwk)
+	assert.FatalError(t, err)
+	anyToken, err := generateSSHToken("subject@localhost", iss, aud, time.Now(), &SignSSHOptions{
+		Principals: []string{"smallstep.com"},
+	}, jwk)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		token       string
+		sshOpts     SignSSHOptions
+		wantErr     bool
+		wantSignErr bool
+	}{
+		{"ok host", hostToken, SignSSHOptions{}, false, false},
+		{"fail user", userToken, SignSSHOptions{}, true, false},
+		{"fail default user", anyToken, SignSSHOptions{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSSHSign(context.Background(), tt.token)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					assertStatusCode(t, http.StatusForbidden, err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+
+			cert, err := signSSHCertificate(key.Public().Key, tt.sshOpts, opts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				if assert.Error(t, err) {
+					assertStatusCode(t, http.StatusForbidden, err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, uint32(ssh.HostCert), cert.CertType)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package provisioner
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHExtensionsPolicy defines how the extensions and critical options
+// configured in a provisioner are combined with the ones in the certificate.
+type SSHExtensionsPolicy string
+
+const (
+	// SSHExtensionsMerge adds the configured extensions and critical options
+	// to the ones in the certificate, overwriting the ones with the same name.
+	SSHExtensionsMerge SSHExtensionsPolicy = "merge"
+	// SSHExtensionsReplace discards the extensions and critical options in the
+	// certificate and sets only the configured ones.
+	SSHExtensionsReplace SSHExtensionsPolicy = "replace"
+)
+
+// Validate returns an error if the policy is not supported.
+func (p SSHExtensionsPolicy) Validate() error {
+	switch p {
+	case "", SSHExtensionsMerge, SSHExtensionsReplace:
+		return nil
+	default:
+		return errors.Errorf("unsupported extensionsPolicy %q", p)
+	}
+}
+
+// sshExtensions are the extensions defined by OpenSSH. They do not have a
+// value.
+var sshExtensions = map[string]bool{
+	"no-touch-required":       true,
+	"permit-X11-forwarding":   true,
+	"permit-agent-forwarding": true,
+	"permit-port-forwarding":  true,
+	"permit-pty":              true,
+	"permit-user-rc":          true,
+}
+
+// validateSSHExtensions validates the names and values of the extensions and
+// critical options configured in a provisioner. Names not defined by OpenSSH
+// must have the form name@domain.
+func validateSSHExtensions(extensions, criticalOptions map[string]string) error {
+	for name, value := range extensions {
+		switch {
+		case sshExtensions[name]:
+			if value != "" {
+				return errors.Errorf("ssh extension %q cannot have a value", name)
+			}
+		case !isCustomSSHExtension(name):
+			return errors.Errorf("unsupported ssh extension %q", name)
+		}
+	}
+	for name, value := range criticalOptions {
+		switch name {
+		case "force-command":
+			if value == "" {
+				return errors.New("ssh critical option \"force-command\" cannot be empty")
+			}
+		case "source-address":
+			if err := validateSSHSourceAddress(value); err != nil {
+				return err
+			}
+		case "verify-required":
+			if value != "" {
+				return errors.New("ssh critical option \"verify-required\" cannot have a value")
+			}
+		default:
+			if !isCustomSSHExtension(name) {
+				return errors.Errorf("unsupported ssh critical option %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// isCustomSSHExtension returns true if the name has the form name@domain.
+func isCustomSSHExtension(name string) bool {
+	local, domain, ok := strings.Cut(name, "@")
+	return ok && local != "" && domain != "" && !strings.ContainsAny(name, " \t\r\n")
+}
+
+// validateSSHSourceAddress validates the comma-separated list of addresses
+// and CIDRs of the source-address critical option.
+func validateSSHSourceAddress(value string) error {
+	if value == "" {
+		return errors.New("ssh critical option \"source-address\" cannot be empty")
+	}
+	for _, s := range strings.Split(value, ",") {
+		if _, _, err := net.ParseCIDR(s); err == nil {
+			continue
+		}
+		if net.ParseIP(s) == nil {
+			return errors.Errorf("ssh critical option \"source-address\" has an invalid address %q", s)
+		}
+	}
+	return nil
+}
+
+// newSSHCertExtensionsModifier validates the extensions and critical options in
+// the SSH options and returns the modifier that sets them. It returns nil if
+// they are not configured.
+func newSSHCertExtensionsModifier(p Interface, o *SSHOptions) (*sshCertExtensionsModifier, error) {
+	policy := o.GetExtensionsPolicy()
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	extensions, criticalOptions := o.GetExtensions(), o.GetCriticalOptions()
+	if extensions == nil && criticalOptions == nil && policy == "" {
+		return nil, nil
+	}
+	// Only provisioners that sign SSH user certificates support them.
+	switch p.GetType() {
+	case TypeJWK, TypeOIDC, TypeX5C:
+	default:
+		return nil, errors.Errorf("ssh extensions are not supported by %s provisioners", p.GetType())
+	}
+	if err := validateSSHExtensions(extensions, criticalOptions); err != nil {
+		return nil, err
+	}
+	return &sshCertExtensionsModifier{
+		extensions:      extensions,
+		criticalOptions: criticalOptions,
+		policy:          policy,
+	}, nil
+}
+
+// sshCertExtensionsModifier is an SSHCertModifier that sets the extensions
+// and critical options configured in the provisioner in SSH user
+// certificates.
+type sshCertExtensionsModifier struct {
+	extensions      map[string]string
+	criticalOptions map[string]string
+	policy          SSHExtensionsPolicy
+}
+
+// Modify implements SSHCertModifier and sets the configured extensions and
+// critical options. Host certificates are not modified.
+func (m *sshCertExtensionsModifier) Modify(cert *ssh.Certificate, _ SignSSHOptions) error {
+	if cert.CertType != ssh.UserCert {
+		return nil
+	}
+	if m.policy == SSHExtensionsReplace || cert.Extensions == nil {
+		cert.Extensions = make(map[string]string, len(m.extensions))
+	}
+	if m.policy == SSHExtensionsReplace || cert.CriticalOptions == nil {
+		cert.CriticalOptions = make(map[string]string, len(m.criticalOptions))
+	}
+	for k, v := range m.extensions {
+		cert.Extensions[k] = v
+	}
+	for k, v := range m.criticalOptions {
+		cert.CriticalOptions[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_newSSHCertExtensionsModifier(t *testing.T) {
+	jwk := &JWK{Type: "JWK", Name: "jwk"}
+	aws := &AWS{Type: "AWS", Name: "aws"}
+	tests := []struct {
+		name    string
+		p       Interface
+		o       *SSHOptions
+		want    *sshCertExtensionsModifier
+		wantErr bool
+	}{
+		{"ok nil", jwk, nil, nil, false},
+		{"ok empty", aws, &SSHOptions{}, nil, false},
+		{"ok", jwk, &SSHOptions{
+			Extensions:       map[string]string{"permit-agent-forwarding": "", "login@example.com": "jane"},
+			CriticalOptions:  map[string]string{"force-command": "/usr/local/bin/backup", "source-address": "10.0.0.0/8,192.168.1.1,2001:db8::/32"},
+			ExtensionsPolicy: SSHExtensionsReplace,
+		}, &sshCertExtensionsModifier{
+			extensions:      map[string]string{"permit-agent-forwarding": "", "login@example.com": "jane"},
+			criticalOptions: map[string]string{"force-command": "/usr/local/bin/backup", "source-address": "10.0.0.0/8,192.168.1.1,2001:db8::/32"},
+			policy:          SSHExtensionsReplace,
+		}, false},
+		{"ok verify-required", jwk, &SSHOptions{CriticalOptions: map[string]string{"verify-required": ""}}, &sshCertExtensionsModifier{
+			criticalOptions: map[string]string{"verify-required": ""},
+		}, false},
+		{"fail policy", jwk, &SSHOptions{ExtensionsPolicy: "overwrite"}, nil, true},
+		{"fail provisioner", aws, &SSHOptions{Extensions: map[string]string{"permit-pty": ""}}, nil, true},
+		{"fail extension", jwk, &SSHOptions{Extensions: map[string]string{"permit-everything": ""}}, nil, true},
+		{"fail extension value", jwk, &SSHOptions{Extensions: map[string]string{"permit-pty": "yes"}}, nil, true},
+		{"fail custom extension", jwk, &SSHOptions{Extensions: map[string]string{"login@": ""}}, nil, true},
+		{"fail critical option", jwk, &SSHOptions{CriticalOptions: map[string]string{"permit-pty": ""}}, nil, true},
+		{"fail force-command", jwk, &SSHOptions{CriticalOptions: map[string]string{"force-command": ""}}, nil, true},
+		{"fail source-address", jwk, &SSHOptions{CriticalOptions: map[string]string{"source-address": "10.0.0.0/8, 10.1.0.0/16"}}, nil, true},
+		{"fail empty source-address", jwk, &SSHOptions{CriticalOptions: map[string]string{"source-address": ""}}, nil, true},
+		{"fail verify-required", jwk, &SSHOptions{CriticalOptions: map[string]string{"verify-required": "yes"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSSHCertExtensionsModifier(tt.p, tt.o)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newSSHCertExtensionsModifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_sshCertExtensionsModifier_Modify(t *testing.T) {
+	extensions := map[string]string{"permit-agent-forwarding": ""}
+	criticalOptions := map[string]string{"force-command": "/usr/local/bin/backup"}
+	userCert := func() *ssh.Certificate {
+		return &ssh.Certificate{
+			CertType: ssh.UserCert,
+			Permissions: ssh.Permissions{
+				Extensions:      map[string]string{"permit-pty": "", "permit-user-rc": ""},
+				CriticalOptions: map[string]string{"force-command": "/bin/sh"},
+			},
+		}
+	}
+	tests := []struct {
+		name                string
+		modifier            *sshCertExtensionsModifier
+		cert                *ssh.Certificate
+		wantExtensions      map[string]string
+		wantCriticalOptions map[string]string
+	}{
+		{"merge", &sshCertExtensionsModifier{extensions: extensions, criticalOptions: criticalOptions}, userCert(),
+			map[string]string{"permit-pty": "", "permit-user-rc": "", "permit-agent-forwarding": ""},
+			map[string]string{"force-command": "/usr/local/bin/backup"}},
+		{"merge empty certificate", &sshCertExtensionsModifier{extensions: extensions, criticalOptions: criticalOptions, policy: SSHExtensionsMerge}, &ssh.Certificate{CertType: ssh.UserCert},
+			map[string]string{"permit-agent-forwarding": ""},
+			map[string]string{"force-command": "/usr/local/bin/backup"}},
+		{"replace", &sshCertExtensionsModifier{extensions: extensions, policy: SSHExtensionsReplace}, userCert(),
+			map[string]string{"permit-agent-forwarding": ""},
+			map[string]string{}},
+		{"host", &sshCertExtensionsModifier{extensions: extensions, criticalOptions: criticalOptions, policy: SSHExtensionsReplace}, &ssh.Certificate{CertType: ssh.HostCert},
+			nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.FatalError(t, tt.modifier.Modify(tt.cert, SignSSHOptions{}))
+			assert.Equals(t, tt.wantExtensions, tt.cert.Extensions)
+			assert.Equals(t, tt.wantCriticalOptions, tt.cert.CriticalOptions)
+		})
+	}
+	// The configuration is not modified.
+	assert.Equals(t, map[string]string{"permit-agent-forwarding": ""}, extensions)
+	assert.Equals(t, map[string]string{"force-command": "/usr/local/bin/backup"}, criticalOptions)
+}
+
+func TestJWK_AuthorizeSSHSign_extensions(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{SSH: &SSHOptions{
+		CriticalOptions:  map[string]string{"force-command": "/usr/local/bin/backup", "source-address": "10.0.0.0/8"},
+		Extensions:       map[string]string{"permit-agent-forwarding": ""},
+		ExtensionsPolicy: SSHExtensionsReplace,
+	}}
+	p.ctl, err = NewController(p, p.Claims, Config{Audiences: testAudiences}, p.Options)
+	assert.FatalError(t, err)
+
+	jwk, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+	assert.FatalError(t, err)
+	opts, err := p.AuthorizeSSHSign(context.Background(), token)
+	assert.FatalError(t, err)
+	cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{CertType: SSHUserCert, Principals: []string{"name"}}, opts, signer.Key.(crypto.Signer))
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]string{"permit-agent-forwarding": ""}, cert.Extensions)
+	assert.Equals(t, map[string]string{"force-command": "/usr/local/bin/backup", "source-address": "10.0.0.0/8"}, cert.CriticalOptions)
+}
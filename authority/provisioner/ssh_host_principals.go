@@ -0,0 +1,125 @@
+package provisioner
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHHostPrincipalsOptions sets the principals of the SSH host certificates
+// signed by the cloud provisioners from the validated identity of the
+// instance. Each template generates a principal, and it can use the fields of
+// the cloud identity supported by each provisioner and the sprig functions,
+// e.g. "{{ .InstanceName }}.{{ .Zone }}.c.{{ .ProjectID }}.internal".
+// Templates that generate an empty string are skipped. If no templates are
+// set, the internal hostnames of the provisioner are used.
+//
+// The principals requested by the client that are not generated by the
+// templates are dropped, and if none is left the certificate gets all the
+// generated principals.
+type SSHHostPrincipalsOptions struct {
+	Templates []string `json:"templates,omitempty"`
+	templates []*template.Template
+}
+
+// init validates the options and parses the templates. The templates can only
+// reference the given fields.
+func (o *SSHHostPrincipalsOptions) init(fields []string) error {
+	if o == nil {
+		return nil
+	}
+
+	// Execute the templates with all the fields to reject unknown ones.
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f] = f
+	}
+
+	o.templates = make([]*template.Template, len(o.Templates))
+	for i, s := range o.Templates {
+		if strings.TrimSpace(s) == "" {
+			return errors.New("sshHostPrincipals templates cannot contain empty templates")
+		}
+		tmpl, err := template.New("principal").Funcs(getSSHTemplateFuncMap()).Option("missingkey=error").Parse(s)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing sshHostPrincipals template %q", s)
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, values); err != nil {
+			return errors.Wrapf(err, "error validating sshHostPrincipals template %q, supported fields are %s", s, strings.Join(fields, ", "))
+		}
+		o.templates[i] = tmpl
+	}
+	return nil
+}
+
+// newOptions returns the principals of the instance with the given values and
+// the sign option that restricts the certificate to them. If the options are
+// nil, it returns the given default principals and no options.
+func (o *SSHHostPrincipalsOptions) newOptions(values map[string]string, defaults []string) ([]string, []SignOption, error) {
+	if o == nil {
+		return defaults, nil, nil
+	}
+	principals := defaults
+	if len(o.templates) > 0 {
+		var err error
+		if principals, err = o.principals(values); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(principals) == 0 {
+		return nil, nil, errors.New("sshHostPrincipals templates did not generate any principal")
+	}
+	return principals, []SignOption{sshHostPrincipalsModifier(principals)}, nil
+}
+
+// principals executes the templates with the given values and returns the
+// unique principals generated.
+func (o *SSHHostPrincipalsOptions) principals(values map[string]string) ([]string, error) {
+	var principals []string
+	seen := make(map[string]bool)
+	for _, tmpl := range o.templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err != nil {
+			return nil, errors.Wrap(err, "error executing sshHostPrincipals template")
+		}
+		s := strings.TrimSpace(buf.String())
+		switch {
+		case s == "" || seen[s]:
+			continue
+		case strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) || r == ',' }) >= 0:
+			return nil, errors.Errorf("sshHostPrincipals principal %q is not valid", s)
+		}
+		seen[s] = true
+		principals = append(principals, s)
+	}
+	return principals, nil
+}
+
+// sshHostPrincipalsModifier is an SSHCertModifier that drops the principals of
+// the certificate that are not in the list, and sets all of them if none is
+// left.
+type sshHostPrincipalsModifier []string
+
+// Modify implements SSHCertModifier.
+func (m sshHostPrincipalsModifier) Modify(cert *ssh.Certificate, _ SignSSHOptions) error {
+	allowed := make(map[string]bool, len(m))
+	for _, p := range m {
+		allowed[p] = true
+	}
+	var principals []string
+	for _, p := range cert.ValidPrincipals {
+		if allowed[p] {
+			principals = append(principals, p)
+			delete(allowed, p)
+		}
+	}
+	if len(principals) == 0 {
+		principals = append([]string(nil), m...)
+	}
+	cert.ValidPrincipals = principals
+	return nil
+}
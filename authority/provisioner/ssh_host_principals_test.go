@@ -0,0 +1,147 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHHostPrincipalsOptions_init(t *testing.T) {
+	fields := []string{"InstanceName", "Zone", "ProjectID"}
+	tests := []struct {
+		name    string
+		options *SSHHostPrincipalsOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok defaults", &SSHHostPrincipalsOptions{}, false},
+		{"ok", &SSHHostPrincipalsOptions{Templates: []string{"{{ .InstanceName }}.{{ .Zone }}.c.{{ .ProjectID }}.internal"}}, false},
+		{"ok functions", &SSHHostPrincipalsOptions{Templates: []string{`{{ .InstanceName | lower | replace "_" "-" }}.example.com`}}, false},
+		{"fail empty", &SSHHostPrincipalsOptions{Templates: []string{" "}}, true},
+		{"fail parse", &SSHHostPrincipalsOptions{Templates: []string{"{{ .InstanceName "}}, true},
+		{"fail field", &SSHHostPrincipalsOptions{Templates: []string{"{{ .PrivateIP }}"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(fields); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostPrincipalsOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostPrincipalsOptions_newOptions(t *testing.T) {
+	newOptions := func(templates ...string) *SSHHostPrincipalsOptions {
+		o := &SSHHostPrincipalsOptions{Templates: templates}
+		assert.FatalError(t, o.init([]string{"Name", "Zone"}))
+		return o
+	}
+	values := map[string]string{"Name": "web-1", "Zone": "us-east1-b"}
+	defaults := []string{"web-1.internal"}
+
+	tests := []struct {
+		name           string
+		options        *SSHHostPrincipalsOptions
+		wantPrincipals []string
+		wantOptions    []SignOption
+		wantErr        bool
+	}{
+		{"ok nil", nil, defaults, nil, false},
+		{"ok defaults", newOptions(), defaults, []SignOption{sshHostPrincipalsModifier(defaults)}, false},
+		{"ok", newOptions("{{ .Name }}.{{ .Zone }}.example.com", "{{ .Name }}"), []string{"web-1.us-east1-b.example.com", "web-1"},
+			[]SignOption{sshHostPrincipalsModifier{"web-1.us-east1-b.example.com", "web-1"}}, false},
+		{"ok skip empty and duplicates", newOptions("{{ if eq .Zone \"eu\" }}{{ .Name }}.eu{{ end }}", "{{ .Name }}", " {{ .Name }} "), []string{"web-1"},
+			[]SignOption{sshHostPrincipalsModifier{"web-1"}}, false},
+		{"fail no principals", newOptions("{{ if eq .Zone \"eu\" }}{{ .Name }}{{ end }}"), nil, nil, true},
+		{"fail principal", newOptions("{{ .Name }}, {{ .Zone }}"), nil, nil, true},
+		{"fail execute", newOptions(`{{ if eq .Zone "us-east1-b" }}{{ fail "zone not supported" }}{{ end }}`), nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principals, opts, err := tt.options.newOptions(values, defaults)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SSHHostPrincipalsOptions.newOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.wantPrincipals, principals)
+			assert.Equals(t, tt.wantOptions, opts)
+		})
+	}
+}
+
+func Test_sshHostPrincipalsModifier_Modify(t *testing.T) {
+	m := sshHostPrincipalsModifier{"web-1.internal", "10.0.0.1"}
+	tests := []struct {
+		name       string
+		principals []string
+		want       []string
+	}{
+		{"ok empty", nil, []string{"web-1.internal", "10.0.0.1"}},
+		{"ok all", []string{"10.0.0.1", "web-1.internal"}, []string{"10.0.0.1", "web-1.internal"}},
+		{"ok subset", []string{"10.0.0.1"}, []string{"10.0.0.1"}},
+		{"ok drop mismatched", []string{"web-1.internal", "smallstep.com", "10.0.0.2"}, []string{"web-1.internal"}},
+		{"ok drop duplicates", []string{"10.0.0.1", "10.0.0.1"}, []string{"10.0.0.1"}},
+		{"ok drop all mismatched", []string{"smallstep.com"}, []string{"web-1.internal", "10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &ssh.Certificate{ValidPrincipals: tt.principals}
+			assert.FatalError(t, m.Modify(cert, SignSSHOptions{}))
+			assert.Equals(t, tt.want, cert.ValidPrincipals)
+		})
+	}
+}
+
+func TestGCP_AuthorizeSSHSign_sshHostPrincipals(t *testing.T) {
+	tm, fn := mockNow()
+	defer fn()
+
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	p.SSHHostPrincipals = &SSHHostPrincipalsOptions{
+		Templates: []string{"{{ .InstanceName }}.{{ .ProjectID }}.example.com", "{{ .InstanceID }}"},
+	}
+	assert.FatalError(t, p.SSHHostPrincipals.init(gcpIdentityFields))
+
+	token, err := generateGCPToken(p.ServiceAccounts[0],
+		"https://accounts.google.com", p.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	hostDuration := p.ctl.Claimer.DefaultHostSSHCertDuration()
+	expected := func(principals ...string) *SignSSHOptions {
+		return &SignSSHOptions{
+			CertType: "host", Principals: principals,
+			ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(hostDuration)),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		principals []string
+		want       *SignSSHOptions
+	}{
+		{"ok", nil, expected("instance-name.project-id.example.com", "instance-id")},
+		{"ok subset", []string{"instance-id"}, expected("instance-id")},
+		{"ok drop mismatched", []string{"instance-name.project-id.example.com", "instance-name.c.project-id.internal", "smallstep.com"}, expected("instance-name.project-id.example.com")},
+		{"ok drop all mismatched", []string{"smallstep.com"}, expected("instance-name.project-id.example.com", "instance-id")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSSHSign(context.Background(), token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{Principals: tt.principals}, opts, signer.Key.(crypto.Signer))
+			assert.FatalError(t, err)
+			assert.NoError(t, validateSSHCertificate(cert, tt.want))
+		})
+	}
+}
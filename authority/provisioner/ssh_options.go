@@ -1,11 +1,11 @@
 package provisioner
 
 import (
+	"bytes"
 	"encoding/json"
-	"strings"
+	"text/template"
 
 	"github.com/pkg/errors"
-	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/sshutil"
 
 	"github.com/smallstep/certificates/authority/policy"
@@ -37,6 +37,30 @@ type SSHOptions struct {
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
+	// StrictHostPrincipals requires all the principals of SSH host
+	// certificates to be valid hostnames or IP addresses.
+	StrictHostPrincipals bool `json:"strictHostPrincipals,omitempty"`
+
+	// Extensions are the extensions set in all the SSH user certificates,
+	// e.g. {"permit-pty": ""}. How they are combined with the extensions in
+	// the certificate is defined by the ExtensionsPolicy.
+	Extensions map[string]string `json:"extensions,omitempty"`
+
+	// CriticalOptions are the critical options set in all the SSH user
+	// certificates, e.g. {"force-command": "/usr/local/bin/backup",
+	// "source-address": "10.0.0.0/8"}. How they are combined with the critical
+	// options in the certificate is defined by the ExtensionsPolicy.
+	CriticalOptions map[string]string `json:"criticalOptions,omitempty"`
+
+	// ExtensionsPolicy defines how the Extensions and CriticalOptions are
+	// combined with the ones requested, "merge" or "replace". It defaults to
+	// "merge".
+	ExtensionsPolicy SSHExtensionsPolicy `json:"extensionsPolicy,omitempty"`
+
+	// CertTypes are the types of SSH certificates the provisioner can sign,
+	// "user" and/or "host". It defaults to both.
+	CertTypes []string `json:"certTypes,omitempty"`
+
 	// User contains SSH user certificate options.
 	User *policy.SSHUserCertificateOptions `json:"-"`
 
@@ -92,6 +116,46 @@ func (o *SSHOptions) GetDeniedHostNameOptions() *policy.SSHNameOptions {
 	return o.Host.DeniedNames
 }
 
+// IsStrictHostPrincipals returns true if the principals of SSH host
+// certificates must be valid hostnames or IP addresses.
+func (o *SSHOptions) IsStrictHostPrincipals() bool {
+	return o != nil && o.StrictHostPrincipals
+}
+
+// GetExtensions returns the extensions set in SSH user certificates.
+func (o *SSHOptions) GetExtensions() map[string]string {
+	if o == nil {
+		return nil
+	}
+	return o.Extensions
+}
+
+// GetCriticalOptions returns the critical options set in SSH user
+// certificates.
+func (o *SSHOptions) GetCriticalOptions() map[string]string {
+	if o == nil {
+		return nil
+	}
+	return o.CriticalOptions
+}
+
+// GetExtensionsPolicy returns the policy used to combine the extensions and
+// critical options.
+func (o *SSHOptions) GetExtensionsPolicy() SSHExtensionsPolicy {
+	if o == nil {
+		return ""
+	}
+	return o.ExtensionsPolicy
+}
+
+// GetCertTypes returns the types of SSH certificates allowed.
+func (o *SSHOptions) GetCertTypes() []string {
+	if o == nil {
+		return nil
+	}
+	return o.CertTypes
+}
+
 // HasTemplate returns true if a template is defined in the provisioner options.
 func (o *SSHOptions) HasTemplate() bool {
 	return o != nil && (o.Template != "" || o.TemplateFile != "")
@@ -105,6 +169,48 @@ func TemplateSSHOptions(o *Options, data sshutil.TemplateData) (SSHCertificateOp
 	return CustomSSHTemplateOptions(o, data, sshutil.DefaultTemplate)
 }
 
+// loadTemplateFiles loads the template file, so it is validated when the
+// provisioner is initialized and reloaded when it changes.
+func (o *SSHOptions) loadTemplateFiles() error {
+	if o == nil || o.Template != "" || o.TemplateFile == "" {
+		return nil
+	}
+	_, err := loadTemplateFile(o.TemplateFile, getSSHTemplateFuncMap())
+	return err
+}
+
+// withCustomSSHTemplate is an sshutil.Option that executes the custom template
+// with the given data.
+func withCustomSSHTemplate(o *SSHOptions, data sshutil.TemplateData) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, opts *sshutil.Options) error {
+		terr := new(sshutil.TemplateError)
+		funcMap := getSSHTemplateFuncMap()
+		funcMap["fail"] = func(msg string) (string, error) {
+			terr.Message = msg
+			return "", errors.New(msg)
+		}
+		text, err := loadTemplate(o.Template, o.TemplateFile, funcMap)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New("template").Funcs(funcMap).Parse(text)
+		if err != nil {
+			return errors.Wrap(err, "error parsing template")
+		}
+
+		buf := new(bytes.Buffer)
+		data.SetCertificateRequest(cr)
+		if err := tmpl.Execute(buf, data); err != nil {
+			if terr.Message != "" {
+				return terr
+			}
+			return errors.Wrap(err, "error executing template")
+		}
+		opts.CertBuffer = buf
+		return nil
+	}
+}
+
 // CustomSSHTemplateOptions generates a CertificateOptions with the template, data
 // defined in the ProvisionerOptions, the provisioner generated data and the
 // user data provided in the request. If no template has been provided in the
@@ -142,24 +248,10 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 			}
 		}
 
-		// Load a template from a file if Template is not defined.
-		if opts.Template == "" && opts.TemplateFile != "" {
-			return []sshutil.Option{
-				sshutil.WithTemplateFile(step.Abs(opts.TemplateFile), data),
-			}
-		}
-
-		// Load a template from the Template fields
-		// 1. As a JSON in a string.
-		template := strings.TrimSpace(opts.Template)
-		if strings.HasPrefix(template, "{") {
-			return []sshutil.Option{
-				sshutil.WithTemplate(template, data),
-			}
-		}
-		// 2. As a base64 encoded JSON.
+		// Load the template from TemplateFile if Template is not defined, or
+		// from Template as a JSON in a string or as a base64 encoded JSON.
 		return []sshutil.Option{
-			sshutil.WithTemplateBase64(template, data),
+			withCustomSSHTemplate(opts, data),
 		}
 	}), nil
 }
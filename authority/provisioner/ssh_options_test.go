@@ -80,6 +80,9 @@ func TestCustomSSHTemplateOptions(t *testing.T) {
 		{"okBadUserOptions", args{&Options{SSH: &SSHOptions{Template: `{"foo": "{{.Insecure.User.foo}}"}`}}, data, sshutil.DefaultTemplate, SignSSHOptions{TemplateData: []byte(`{"badJSON"}`)}}, sshutil.Options{
 			CertBuffer: bytes.NewBufferString(`{"foo": "<no value>"}`),
 		}, false},
+		{"okTemplateFuncs", args{&Options{SSH: &SSHOptions{Template: `{"inCIDR": {{ inCIDR "10.0.0.0/8" "10.1.2.3" }}, "inZone": {{ inZone "smallstep.com" .Insecure.CR.KeyID }}, "isFQDN": {{ isFQDN .Insecure.CR.KeyID }}}`}}, data, sshutil.DefaultTemplate, SignSSHOptions{}}, sshutil.Options{
+			CertBuffer: bytes.NewBufferString(`{"inCIDR": true, "inZone": false, "isFQDN": false}`),
+		}, false},
 		{"fail", args{&Options{SSH: &SSHOptions{TemplateData: []byte(`{"badJSON`)}}, data, sshutil.DefaultTemplate, SignSSHOptions{}}, sshutil.Options{}, true},
 	}
 	for _, tt := range tests {
@@ -78,6 +78,11 @@ func (p *SSHPOP) GetType() Type {
 	return TypeSSHPOP
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *SSHPOP) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *SSHPOP) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
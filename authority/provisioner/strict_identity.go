@@ -0,0 +1,73 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// strictIdentityValidator is a CertificateRequestValidator that rejects the
+// certificate requests with a common name or SANs that are not part of the
+// identity authorized by the token. It's used by the provisioners with the
+// StrictIdentity option.
+type strictIdentityValidator struct {
+	CommonNames []string
+	SANs        []string
+}
+
+// newStrictIdentityValidator returns a validator that only accepts the given
+// common names and SANs. Any of the SANs is also accepted as the common name.
+func newStrictIdentityValidator(commonNames, sans []string) *strictIdentityValidator {
+	return &strictIdentityValidator{
+		CommonNames: commonNames,
+		SANs:        sans,
+	}
+}
+
+// Valid implements CertificateRequestValidator. The error lists all the
+// fields of the certificate request that are not allowed, followed by the
+// names authorized by the token.
+func (v *strictIdentityValidator) Valid(req *x509.CertificateRequest) error {
+	dnsNames, ips, emails, uris := x509util.SplitSANs(v.SANs)
+
+	var diff []string
+	if cn := req.Subject.CommonName; cn != "" && !containsString(v.CommonNames, cn) && !containsString(v.SANs, cn) {
+		diff = append(diff, fmt.Sprintf("-commonName %q", cn))
+	}
+	for _, s := range req.DNSNames {
+		if !containsStringFold(dnsNames, s) {
+			diff = append(diff, fmt.Sprintf("-dnsName %q", s))
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !containsIP(ips, ip) {
+			diff = append(diff, fmt.Sprintf("-ipAddress %q", ip.String()))
+		}
+	}
+	for _, s := range req.EmailAddresses {
+		if !containsString(emails, s) {
+			diff = append(diff, fmt.Sprintf("-emailAddress %q", s))
+		}
+	}
+	for _, u := range req.URIs {
+		if !containsURI(uris, u) {
+			diff = append(diff, fmt.Sprintf("-uri %q", u.String()))
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+
+	allowed := make([]string, 0, len(v.CommonNames)+len(v.SANs))
+	for _, s := range append(append([]string{}, v.CommonNames...), v.SANs...) {
+		if !containsString(allowed, s) {
+			allowed = append(allowed, s)
+		}
+	}
+	return errs.Forbidden("certificate request does not match the token identity: %s; allowed %q",
+		strings.Join(diff, ", "), allowed)
+}
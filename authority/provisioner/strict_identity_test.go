@@ -0,0 +1,186 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func Test_strictIdentityValidator_Valid(t *testing.T) {
+	v := newStrictIdentityValidator(
+		[]string{"instance-name", "instance-id"},
+		[]string{"foo.internal", "10.0.0.1", "jane@doe.com", "spiffe://example.org/foo"},
+	)
+	uri := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		assert.FatalError(t, err)
+		return u
+	}
+	tests := []struct {
+		name    string
+		req     *x509.CertificateRequest
+		wantErr string
+	}{
+		{"ok empty", &x509.CertificateRequest{}, ""},
+		{"ok common name", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "instance-id"}}, ""},
+		{"ok san as common name", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo.internal"}}, ""},
+		{"ok sans", &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "instance-name"},
+			DNSNames:       []string{"FOO.internal"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			EmailAddresses: []string{"jane@doe.com"},
+			URIs:           []*url.URL{uri("spiffe://example.org/foo")},
+		}, ""},
+		{"fail common name", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "other"}},
+			`certificate request does not match the token identity: -commonName "other"; allowed ["instance-name" "instance-id" "foo.internal" "10.0.0.1" "jane@doe.com" "spiffe://example.org/foo"]`},
+		{"fail sans", &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "instance-name"},
+			DNSNames:       []string{"foo.internal", "bar.internal"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+			EmailAddresses: []string{"john@doe.com"},
+			URIs:           []*url.URL{uri("spiffe://example.org/bar")},
+		}, `certificate request does not match the token identity: -dnsName "bar.internal", -ipAddress "10.0.0.2", -emailAddress "john@doe.com", -uri "spiffe://example.org/bar"; allowed ["instance-name" "instance-id" "foo.internal" "10.0.0.1" "jane@doe.com" "spiffe://example.org/foo"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Valid(tt.req)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+// validateStrictIdentity runs the strict identity validators in the given
+// options and returns the number of validators found.
+func validateStrictIdentity(opts []SignOption, req *x509.CertificateRequest) (int, error) {
+	var n int
+	for _, o := range opts {
+		if v, ok := o.(*strictIdentityValidator); ok {
+			n++
+			if err := v.Valid(req); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func TestGCP_AuthorizeSign_strictIdentity(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.StrictIdentity = true
+
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.keyStore = p1.keyStore
+
+	tests := []struct {
+		name      string
+		prov      *GCP
+		req       *x509.CertificateRequest
+		wantCount int
+		wantErr   bool
+	}{
+		{"ok", p1, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "instance-name"},
+			DNSNames: []string{"instance-name.c.project-id.internal", "instance-name.zone.c.project-id.internal"},
+		}, 1, false},
+		{"ok not configured", p2, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "foo.example.com"},
+			DNSNames: []string{"foo.example.com"},
+		}, 0, false},
+		{"fail common name", p1, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "foo.example.com"},
+		}, 1, true},
+		{"fail dns names", p1, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "instance-id"},
+			DNSNames: []string{"instance-name.c.project-id.internal", "foo.example.com"},
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateGCPToken(tt.prov.ServiceAccounts[0],
+				"https://accounts.google.com", tt.prov.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				time.Now(), &p1.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			opts, err := tt.prov.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+			n, err := validateStrictIdentity(opts, tt.req)
+			assert.Equals(t, tt.wantCount, n)
+			assert.Equals(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSign_strictIdentity(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.Admins = []string{"root@example.com"}
+	p.StrictIdentity = true
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	user, err := generateToken("subject", "the-issuer", p.ClientID, "name@smallstep.com", []string{}, time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+	admin, err := generateToken("subject", "the-issuer", p.ClientID, "root@example.com", []string{}, time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name      string
+		token     string
+		req       *x509.CertificateRequest
+		wantCount int
+		wantErr   bool
+	}{
+		{"ok", user, &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "subject"},
+			EmailAddresses: []string{"name@smallstep.com"},
+		}, 1, false},
+		{"ok email as common name", user, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "name@smallstep.com"},
+		}, 1, false},
+		{"ok admin", admin, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "foo.example.com"},
+			DNSNames: []string{"foo.example.com"},
+		}, 0, false},
+		{"fail common name", user, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "root@example.com"},
+		}, 1, true},
+		{"fail email", user, &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "subject"},
+			EmailAddresses: []string{"root@example.com"},
+		}, 1, true},
+		{"fail dns names", user, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "subject"},
+			DNSNames: []string{"foo.example.com"},
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSign(context.Background(), tt.token)
+			assert.FatalError(t, err)
+			n, err := validateStrictIdentity(opts, tt.req)
+			assert.Equals(t, tt.wantCount, n)
+			assert.Equals(t, tt.wantErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// SubjectOptions configures the Country, Organization and OrganizationalUnit
+// of the subject of the certificates issued by a provisioner. Each value is a
+// template that can use the fields of the identity supported by the
+// provisioner, e.g. "{{ .ProjectID }}".
+type SubjectOptions struct {
+	Country            []string `json:"country,omitempty"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	country            []*template.Template
+	organization       []*template.Template
+	organizationalUnit []*template.Template
+}
+
+// init parses the templates of the subject. The templates can only reference
+// the given fields.
+func (o *SubjectOptions) init(fields []string) (err error) {
+	if o == nil {
+		return nil
+	}
+	if o.country, err = parseSubjectTemplates("country", o.Country, fields); err != nil {
+		return err
+	}
+	if o.organization, err = parseSubjectTemplates("organization", o.Organization, fields); err != nil {
+		return err
+	}
+	if o.organizationalUnit, err = parseSubjectTemplates("organizationalUnit", o.OrganizationalUnit, fields); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newOptions returns the sign options that set the subject built with the
+// given values.
+func (o *SubjectOptions) newOptions(values map[string]string) ([]SignOption, error) {
+	if o == nil {
+		return nil, nil
+	}
+	var (
+		m   subjectModifier
+		err error
+	)
+	if m.Country, err = executeSubjectTemplates(o.country, values); err != nil {
+		return nil, err
+	}
+	if m.Organization, err = executeSubjectTemplates(o.organization, values); err != nil {
+		return nil, err
+	}
+	if m.OrganizationalUnit, err = executeSubjectTemplates(o.organizationalUnit, values); err != nil {
+		return nil, err
+	}
+	return []SignOption{m}, nil
+}
+
+// parseSubjectTemplates parses the given templates and executes them with all
+// the fields to reject unknown ones.
+func parseSubjectTemplates(name string, texts, fields []string) ([]*template.Template, error) {
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f] = f
+	}
+	tmpls := make([]*template.Template, len(texts))
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			return nil, errors.Errorf("subject %s cannot contain empty values", name)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing subject %s", name)
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, values); err != nil {
+			return nil, errors.Wrapf(err, "error validating subject %s, supported fields are %s", name, strings.Join(fields, ", "))
+		}
+		tmpls[i] = tmpl
+	}
+	return tmpls, nil
+}
+
+// executeSubjectTemplates executes the given templates, skipping the ones
+// that result in an empty value.
+func executeSubjectTemplates(tmpls []*template.Template, values map[string]string) ([]string, error) {
+	var ret []string
+	for _, tmpl := range tmpls {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err != nil {
+			return nil, errors.Wrapf(err, "error executing subject %s", tmpl.Name())
+		}
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+// subjectModifier is a CertificateModifier that sets the configured attributes
+// of the subject of the certificate, ignoring the ones in the certificate
+// request or the template. Empty attributes are not modified.
+type subjectModifier struct {
+	Country            []string
+	Organization       []string
+	OrganizationalUnit []string
+}
+
+// Modify sets the attributes of the subject of the certificate.
+func (m subjectModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if len(m.Country) > 0 {
+		cert.Subject.Country = m.Country
+	}
+	if len(m.Organization) > 0 {
+		cert.Subject.Organization = m.Organization
+	}
+	if len(m.OrganizationalUnit) > 0 {
+		cert.Subject.OrganizationalUnit = m.OrganizationalUnit
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/sha1" //nolint:gosec // used to compute the Subject Key Identifier by RFC 5280
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// SubjectKeyIDMethod is the method used to compute the subject key identifier
+// of the certificates. An empty method keeps the one set by the template, or
+// the default one, the method 1 of RFC 5280.
+type SubjectKeyIDMethod string
+
+const (
+	// SubjectKeyIDMethod1 computes the subject key identifier as the SHA-1
+	// hash of the subjectPublicKey, as described in the method 1 of RFC 5280,
+	// section 4.2.1.2.
+	SubjectKeyIDMethod1 SubjectKeyIDMethod = "method1"
+	// SubjectKeyIDMethod2 computes the subject key identifier as the four-bit
+	// type field 0100 followed by the least significant 60 bits of the SHA-1
+	// hash of the subjectPublicKey, as described in the method 2 of RFC 5280,
+	// section 4.2.1.2.
+	SubjectKeyIDMethod2 SubjectKeyIDMethod = "method2"
+)
+
+// Validate returns an error if the method is not supported.
+func (m SubjectKeyIDMethod) Validate() error {
+	switch m {
+	case "", SubjectKeyIDMethod1, SubjectKeyIDMethod2:
+		return nil
+	default:
+		return errors.Errorf("unsupported subjectKeyID method %q", m)
+	}
+}
+
+// SubjectKeyID returns the subject key identifier of the given public key
+// computed with the method.
+func (m SubjectKeyIDMethod) SubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling public key")
+	}
+	var info struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(b, &info); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling public key")
+	}
+
+	//nolint:gosec // used to compute the Subject Key Identifier by RFC 5280
+	hash := sha1.Sum(info.SubjectPublicKey.Bytes)
+	switch m {
+	case SubjectKeyIDMethod1:
+		return hash[:], nil
+	case SubjectKeyIDMethod2:
+		id := append([]byte(nil), hash[12:]...)
+		id[0] = 0x40 | (id[0] & 0x0f)
+		return id, nil
+	default:
+		return nil, errors.Errorf("unsupported subjectKeyID method %q", m)
+	}
+}
+
+// subjectKeyIDModifier is a CertificateModifier that sets the subject key
+// identifier of the certificate using the given method.
+type subjectKeyIDModifier struct {
+	method SubjectKeyIDMethod
+}
+
+// Modify implements CertificateModifier.
+func (m subjectKeyIDModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	id, err := m.method.SubjectKeyID(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+	cert.SubjectKeyId = id
+	return nil
+}
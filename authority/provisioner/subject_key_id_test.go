@@ -0,0 +1,89 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // used to compute the Subject Key Identifier by RFC 5280
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestSubjectKeyIDMethod_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       SubjectKeyIDMethod
+		wantErr bool
+	}{
+		{"ok empty", "", false},
+		{"ok method1", SubjectKeyIDMethod1, false},
+		{"ok method2", SubjectKeyIDMethod2, false},
+		{"fail", "sha256", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.m.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SubjectKeyIDMethod.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubjectKeyIDMethod_SubjectKeyID(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	b, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.FatalError(t, err)
+	var info struct {
+		Algorithm        asn1.RawValue
+		SubjectPublicKey asn1.BitString
+	}
+	_, err = asn1.Unmarshal(b, &info)
+	assert.FatalError(t, err)
+	hash := sha1.Sum(info.SubjectPublicKey.Bytes) //nolint:gosec // used to compute the Subject Key Identifier by RFC 5280
+
+	method2 := append([]byte(nil), hash[12:]...)
+	method2[0] = 0x40 | (method2[0] & 0x0f)
+
+	tests := []struct {
+		name    string
+		m       SubjectKeyIDMethod
+		pub     interface{}
+		want    []byte
+		wantErr bool
+	}{
+		{"ok method1", SubjectKeyIDMethod1, key.Public(), hash[:], false},
+		{"ok method2", SubjectKeyIDMethod2, key.Public(), method2, false},
+		{"fail method", "", key.Public(), nil, true},
+		{"fail key", SubjectKeyIDMethod1, "not a key", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.SubjectKeyID(tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SubjectKeyIDMethod.SubjectKeyID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+	assert.Len(t, 8, method2)
+	assert.Equals(t, byte(0x40), method2[0]&0xf0)
+}
+
+func Test_subjectKeyIDModifier_Modify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	cert := &x509.Certificate{PublicKey: key.Public(), SubjectKeyId: []byte("template")}
+	assert.FatalError(t, subjectKeyIDModifier{method: SubjectKeyIDMethod2}.Modify(cert, SignOptions{}))
+	want, err := SubjectKeyIDMethod2.SubjectKeyID(key.Public())
+	assert.FatalError(t, err)
+	assert.Equals(t, want, cert.SubjectKeyId)
+
+	cert = &x509.Certificate{PublicKey: "not a key"}
+	assert.Error(t, subjectKeyIDModifier{method: SubjectKeyIDMethod1}.Modify(cert, SignOptions{}))
+}
@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestSubjectOptions_init(t *testing.T) {
+	fields := []string{"ProjectID", "Zone"}
+	tests := []struct {
+		name    string
+		options *SubjectOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &SubjectOptions{
+			Country:            []string{"US"},
+			Organization:       []string{"{{ .ProjectID }}"},
+			OrganizationalUnit: []string{"{{ .Zone }}", "compute"},
+		}, false},
+		{"fail empty", &SubjectOptions{Organization: []string{" "}}, true},
+		{"fail template", &SubjectOptions{Organization: []string{"{{ .ProjectID }"}}, true},
+		{"fail unknown field", &SubjectOptions{OrganizationalUnit: []string{"{{ .InstanceID }}"}}, true},
+		{"fail unknown field country", &SubjectOptions{Country: []string{"{{ .Region }}"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(fields); (err != nil) != tt.wantErr {
+				t.Errorf("SubjectOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGCP_AuthorizeSign_subject(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.Subject = &SubjectOptions{
+		Country:            []string{"US"},
+		Organization:       []string{"{{ .ProjectID }}"},
+		OrganizationalUnit: []string{"{{ .Zone }}", "{{ .ProjectNumber }}"},
+	}
+	assert.FatalError(t, p1.Subject.init(gcpIdentityFields))
+
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.keyStore = p1.keyStore
+
+	tests := []struct {
+		name string
+		prov *GCP
+		want pkix.Name
+	}{
+		{"ok", p1, pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"project-id"},
+			OrganizationalUnit: []string{"zone", "1234567890"},
+			CommonName:         "instance-name",
+		}},
+		{"ok not configured", p2, pkix.Name{
+			Country:    []string{"CA"},
+			CommonName: "instance-name",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateGCPToken(tt.prov.ServiceAccounts[0],
+				"https://accounts.google.com", tt.prov.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				time.Now(), &p1.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			opts, err := tt.prov.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+
+			cert := &x509.Certificate{
+				Subject: pkix.Name{Country: []string{"CA"}, CommonName: "instance-name"},
+			}
+			for _, o := range opts {
+				if m, ok := o.(subjectModifier); ok {
+					assert.FatalError(t, m.Modify(cert, SignOptions{}))
+				}
+			}
+			assert.Equals(t, tt.want, cert.Subject)
+		})
+	}
+}
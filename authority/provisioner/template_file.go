@@ -0,0 +1,92 @@
+package provisioner
+
+import (
+	"log"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/cli-utils/step"
+)
+
+// templateFiles is the cache of the templates loaded from files, by the
+// absolute path of the file.
+var templateFiles sync.Map
+
+// templateFile is a template loaded from a file. The file is checked for
+// changes every time the template is used, and reloaded if it has been
+// modified. If the new version cannot be read or parsed, the previous one is
+// kept and the error is logged, so a bad edit does not break the issuance.
+type templateFile struct {
+	mu      sync.Mutex
+	path    string
+	funcMap template.FuncMap
+	modTime time.Time
+	size    int64
+	text    string
+}
+
+// loadTemplateFile reads and parses the given template file with the given
+// functions and adds it to the cache. It's called when the provisioner is
+// initialized, so a template that cannot be loaded is reported at startup.
+func loadTemplateFile(filename string, funcMap template.FuncMap) (*templateFile, error) {
+	f := &templateFile{
+		path:    step.Abs(filename),
+		funcMap: funcMap,
+	}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	templateFiles.Store(f.path, f)
+	return f, nil
+}
+
+// readTemplateFile returns the text of the given template file. It loads the
+// file if it's not in the cache, or returns the current version of the cached
+// one otherwise.
+func readTemplateFile(filename string, funcMap template.FuncMap) (string, error) {
+	if v, ok := templateFiles.Load(step.Abs(filename)); ok {
+		return v.(*templateFile).Text(), nil
+	}
+	f, err := loadTemplateFile(filename, funcMap)
+	if err != nil {
+		return "", err
+	}
+	return f.text, nil
+}
+
+// Text returns the text of the template, reloading it if the file has been
+// modified.
+func (f *templateFile) Text() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fi, err := os.Stat(f.path); err != nil || (fi.ModTime().Equal(f.modTime) && fi.Size() == f.size) {
+		return f.text
+	}
+	if err := f.reload(); err != nil {
+		log.Printf("error reloading template %s, using the previous version: %v", f.path, err)
+	}
+	return f.text
+}
+
+// reload reads and parses the file and, if it's valid, replaces the text of
+// the template. The caller must hold the lock, or have exclusive access.
+func (f *templateFile) reload() error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading template")
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return errors.Wrap(err, "error reading template")
+	}
+	if _, err := template.New(f.path).Funcs(f.funcMap).Parse(string(b)); err != nil {
+		return errors.Wrapf(err, "error parsing template %s", f.path)
+	}
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	f.text = string(b)
+	return nil
+}
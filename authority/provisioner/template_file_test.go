@@ -0,0 +1,99 @@
+package provisioner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func writeTemplateFile(t *testing.T, filename, text string, modTime time.Time) {
+	t.Helper()
+	assert.FatalError(t, os.WriteFile(filename, []byte(text), 0600))
+	assert.FatalError(t, os.Chtimes(filename, modTime, modTime))
+}
+
+func Test_loadTemplateFile(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.tpl")
+	writeTemplateFile(t, ok, `{"subject": {{ toJson .Subject }}}`, time.Now())
+	bad := filepath.Join(dir, "bad.tpl")
+	writeTemplateFile(t, bad, `{"subject": {{ toJson .Subject }}}{{ end }}`, time.Now())
+	unknownFunc := filepath.Join(dir, "func.tpl")
+	writeTemplateFile(t, unknownFunc, `{"subject": {{ foo .Subject }}}`, time.Now())
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{"ok", ok, `{"subject": {{ toJson .Subject }}}`, false},
+		{"fail missing", filepath.Join(dir, "missing.tpl"), "", true},
+		{"fail parse", bad, "", true},
+		{"fail function", unknownFunc, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadTemplateFile(tt.filename, getTemplateFuncMap())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTemplateFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				_, ok := templateFiles.Load(tt.filename)
+				assert.False(t, ok)
+				return
+			}
+			assert.Equals(t, tt.want, got.Text())
+			v, ok := templateFiles.Load(tt.filename)
+			assert.True(t, ok)
+			assert.Equals(t, got, v)
+		})
+	}
+}
+
+func Test_templateFile_Text(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "template.tpl")
+	now := time.Now().Truncate(time.Second)
+	writeTemplateFile(t, filename, `{"version": 1}`, now)
+
+	f, err := loadTemplateFile(filename, getTemplateFuncMap())
+	assert.FatalError(t, err)
+	assert.Equals(t, `{"version": 1}`, f.Text())
+
+	// Modified file
+	writeTemplateFile(t, filename, `{"version": 2}`, now.Add(time.Minute))
+	assert.Equals(t, `{"version": 2}`, f.Text())
+	text, err := readTemplateFile(filename, getTemplateFuncMap())
+	assert.FatalError(t, err)
+	assert.Equals(t, `{"version": 2}`, text)
+
+	// Invalid template keeps the previous version
+	writeTemplateFile(t, filename, `{"version": {{ 3 }`, now.Add(2*time.Minute))
+	assert.Equals(t, `{"version": 2}`, f.Text())
+
+	// Fixed template
+	writeTemplateFile(t, filename, `{"version": {{ 3 }}}`, now.Add(3*time.Minute))
+	assert.Equals(t, `{"version": {{ 3 }}}`, f.Text())
+
+	// Deleted file keeps the previous version
+	assert.FatalError(t, os.Remove(filename))
+	assert.Equals(t, `{"version": {{ 3 }}}`, f.Text())
+}
+
+func Test_readTemplateFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "template.tpl")
+	writeTemplateFile(t, filename, `{"foo": "bar"}`, time.Now())
+
+	text, err := readTemplateFile(filename, getSSHTemplateFuncMap())
+	assert.FatalError(t, err)
+	assert.Equals(t, `{"foo": "bar"}`, text)
+	_, ok := templateFiles.Load(filename)
+	assert.True(t, ok)
+
+	_, err = readTemplateFile(filepath.Join(dir, "missing.tpl"), getSSHTemplateFuncMap())
+	assert.Error(t, err)
+}
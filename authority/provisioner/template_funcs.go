@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+)
+
+// getTemplateFuncMap returns the functions available in custom X.509
+// templates: the x509util functions and the ones defined by the provisioners.
+func getTemplateFuncMap() template.FuncMap {
+	funcMap := x509util.GetFuncMap()
+	addTemplateFuncs(funcMap)
+	return funcMap
+}
+
+// getSSHTemplateFuncMap returns the functions available in custom SSH
+// templates: the sshutil functions and the ones defined by the provisioners.
+func getSSHTemplateFuncMap() template.FuncMap {
+	funcMap := sshutil.GetFuncMap()
+	addTemplateFuncs(funcMap)
+	return funcMap
+}
+
+// addTemplateFuncs adds the functions defined by the provisioners to the given
+// map. Besides these, the sprig functions like hasPrefix or hasSuffix are also
+// available.
+func addTemplateFuncs(funcMap template.FuncMap) {
+	funcMap["publicKeyHash"] = publicKeyHash
+	funcMap["inCIDR"] = inCIDR
+	funcMap["inZone"] = inZone
+	funcMap["isFQDN"] = isFQDN
+}
+
+// inCIDR returns true if the given IP, a string or a net.IP, is in the given
+// CIDR, e.g.:
+//
+//	{{ range .Insecure.CR.IPAddresses }}
+//	  {{ if not (inCIDR "10.0.0.0/8" .) }}{{ fail "IP address not allowed" }}{{ end }}
+//	{{ end }}
+func inCIDR(cidr string, ip interface{}) (bool, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, errors.Errorf("inCIDR: %q is not a valid CIDR", cidr)
+	}
+	switch v := ip.(type) {
+	case net.IP:
+		return ipNet.Contains(v), nil
+	case string:
+		return ipNet.Contains(net.ParseIP(v)), nil
+	default:
+		return false, errors.Errorf("inCIDR: unsupported type %T", ip)
+	}
+}
+
+// inZone returns true if the given DNS name is the zone or a subdomain of it.
+// Unlike hasSuffix, it compares full labels and it's case-insensitive, e.g.:
+//
+//	{{ if inZone "example.com" "www.example.com" }}...{{ end }}
+func inZone(zone, name string) bool {
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if zone == "" || name == "" {
+		return false
+	}
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// isFQDN returns true if the given name is a fully qualified domain name with
+// at least two valid labels and a non-numeric top-level domain, so IP
+// addresses are not accepted. A trailing dot is allowed, e.g.:
+//
+//	{{ if not (isFQDN .Subject.CommonName) }}{{ fail "invalid common name" }}{{ end }}
+func isFQDN(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if !isDNSLabel(l) {
+			return false
+		}
+	}
+	return strings.Trim(labels[len(labels)-1], "0123456789") != ""
+}
+
+// isDNSLabel returns true if the given string is a valid DNS label: 1 to 63
+// letters, digits or hyphens, not starting or ending with a hyphen.
+func isDNSLabel(l string) bool {
+	if len(l) == 0 || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+	for _, c := range l {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
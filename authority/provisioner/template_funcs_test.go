@@ -0,0 +1,89 @@
+package provisioner
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_inCIDR(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidr    string
+		ip      interface{}
+		want    bool
+		wantErr bool
+	}{
+		{"ok string", "10.0.0.0/8", "10.1.2.3", true, false},
+		{"ok net.IP", "10.0.0.0/8", net.ParseIP("10.1.2.3"), true, false},
+		{"ok ipv6", "2001:db8::/32", "2001:db8::1", true, false},
+		{"ok outside", "10.0.0.0/8", "192.168.1.1", false, false},
+		{"ok outside net.IP", "10.0.0.0/8", net.ParseIP("192.168.1.1"), false, false},
+		{"ok invalid ip", "10.0.0.0/8", "foo", false, false},
+		{"fail cidr", "10.0.0.0", "10.1.2.3", false, true},
+		{"fail type", "10.0.0.0/8", 10, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inCIDR(tt.cidr, tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("inCIDR() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("inCIDR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inZone(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+		dns  string
+		want bool
+	}{
+		{"ok", "example.com", "www.example.com", true},
+		{"ok zone", "example.com", "example.com", true},
+		{"ok trailing dot", "example.com.", "www.example.com.", true},
+		{"ok case", "Example.com", "WWW.EXAMPLE.COM", true},
+		{"fail partial label", "example.com", "badexample.com", false},
+		{"fail other zone", "example.com", "example.org", false},
+		{"fail empty zone", "", "example.com", false},
+		{"fail empty name", "example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inZone(tt.zone, tt.dns); got != tt.want {
+				t.Errorf("inZone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isFQDN(t *testing.T) {
+	tests := []struct {
+		name string
+		dns  string
+		want bool
+	}{
+		{"ok", "www.example.com", true},
+		{"ok trailing dot", "example.com.", true},
+		{"ok hyphen", "my-host.example.com", true},
+		{"fail empty", "", false},
+		{"fail single label", "localhost", false},
+		{"fail empty label", "www..example.com", false},
+		{"fail hyphen", "-www.example.com", false},
+		{"fail wildcard", "*.example.com", false},
+		{"fail ip", "10.0.0.1", false},
+		{"fail long label", strings.Repeat("a", 64) + ".com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFQDN(tt.dns); got != tt.want {
+				t.Errorf("isFQDN() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+{"subject": {{ toJson .Subject }}, {{ block "keyUsage" . }}"keyUsage": ["digitalSignature"]{{ end }}}
\ No newline at end of file
@@ -0,0 +1 @@
+"keyUsage": ["digitalSignature"]
\ No newline at end of file
@@ -0,0 +1 @@
+{"subject": {{ toJson .Subject }}, {{ template "keyUsage" . }}}
\ No newline at end of file
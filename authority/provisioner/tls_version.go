@@ -0,0 +1,49 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// tlsVersions are the TLS versions supported by minConnectionTLSVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the TLS version for the given string, e.g. "1.3". It
+// returns 0 if the string is empty.
+func parseTLSVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, errors.Errorf("minConnectionTLSVersion %q is not valid, must be one of 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return v, nil
+}
+
+// authorizeConnection returns an error if the provisioner requires a minimum
+// TLS version and the connection of the request, stored in the context, has
+// been negotiated with an older one or it's not available.
+func (c *Controller) authorizeConnection(ctx context.Context) error {
+	if c.minConnectionTLSVersion == 0 {
+		return nil
+	}
+	v, ok := TLSVersionFromContext(ctx)
+	if !ok {
+		return authorizeErr(ReasonInsecureConnection, errs.Unauthorized("the TLS version of the connection is not available"))
+	}
+	if v < c.minConnectionTLSVersion {
+		return authorizeErr(ReasonInsecureConnection, errs.Unauthorized("the connection uses %s, the provisioner requires %s or later",
+			tls.VersionName(v), tls.VersionName(c.minConnectionTLSVersion)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func Test_parseTLSVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    uint16
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"1.0", "1.0", tls.VersionTLS10, false},
+		{"1.1", "1.1", tls.VersionTLS11, false},
+		{"1.2", "1.2", tls.VersionTLS12, false},
+		{"1.3", "1.3", tls.VersionTLS13, false},
+		{"fail", "1.4", 0, true},
+		{"fail name", "TLS1.3", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTLSVersion(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTLSVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewController_minConnectionTLSVersion(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	ctl, err := NewController(p, nil, Config{Claims: globalProvisionerClaims}, &Options{MinConnectionTLSVersion: "1.3"})
+	assert.FatalError(t, err)
+	assert.Equals(t, uint16(tls.VersionTLS13), ctl.minConnectionTLSVersion)
+
+	_, err = NewController(p, nil, Config{Claims: globalProvisionerClaims}, &Options{MinConnectionTLSVersion: "1.4"})
+	assert.Error(t, err)
+	_, err = NewController(&ACME{Type: "ACME", Name: "acme"}, nil, Config{Claims: globalProvisionerClaims}, &Options{MinConnectionTLSVersion: "1.3"})
+	assert.Error(t, err)
+}
+
+func TestJWK_AuthorizeSign_minConnectionTLSVersion(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{MinConnectionTLSVersion: "1.3"}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"ok", NewContextWithTLSVersion(context.Background(), tls.VersionTLS13), false},
+		{"fail old version", NewContextWithTLSVersion(context.Background(), tls.VersionTLS12), true},
+		{"fail missing version", context.Background(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateToken("foo", p.Name, testAudiences.Sign[0], "", []string{"foo.smallstep.com"}, time.Now(), key)
+			assert.FatalError(t, err)
+			_, err = p.AuthorizeSign(tt.ctx, tok)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			var sc render.StatusCodedError
+			assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+			assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+			var ae *AuthorizeError
+			assert.Fatal(t, errors.As(err, &ae))
+			assert.Equals(t, ReasonInsecureConnection, ae.Reason)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+)
+
+// DefaultTokenCacheSize is the maximum number of tokens kept by the default
+// in-memory token cache.
+const DefaultTokenCacheSize = 10000
+
+// TokenCache is the interface used by the provisioners with replay protection
+// to reject the reuse of a token. Implementations must be safe for concurrent
+// use.
+type TokenCache interface {
+	// Use marks the given key as used until the expiration time. It returns
+	// false if the key is already in use and has not expired.
+	Use(key string, expiresAt time.Time) (bool, error)
+}
+
+type memoryTokenEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// memoryTokenCache is a TokenCache that keeps the tokens in memory. When the
+// cache is full, the least recently used token is evicted.
+type memoryTokenCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewMemoryTokenCache returns an in-memory TokenCache that keeps up to size
+// tokens. Tokens evicted before they expire can be used again, so the size
+// must be large enough for the expected number of tokens in their validity
+// period.
+func NewMemoryTokenCache(size int) TokenCache {
+	if size <= 0 {
+		size = DefaultTokenCacheSize
+	}
+	return &memoryTokenCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Use implements the TokenCache interface.
+func (c *memoryTokenCache) Use(key string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		entry := e.Value.(*memoryTokenEntry)
+		if c.now().Before(entry.expiresAt) {
+			return false, nil
+		}
+		entry.expiresAt = expiresAt
+		return true, nil
+	}
+
+	c.items[key] = c.ll.PushFront(&memoryTokenEntry{
+		key:       key,
+		expiresAt: expiresAt,
+	})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*memoryTokenEntry).key)
+	}
+	return true, nil
+}
+
+// tokenReplayKey returns the key used to detect the reuse of a token. It
+// combines the provisioner and instance ids with the token id, or with the hash
+// of the token if it does not have one.
+func tokenReplayKey(provisionerID, instanceID, tokenID, token string) string {
+	if tokenID == "" {
+		sum := sha256.Sum256([]byte(token))
+		tokenID = hex.EncodeToString(sum[:])
+	}
+	sum := sha256.Sum256([]byte(provisionerID + "." + instanceID + "." + tokenID))
+	return strings.ToLower(hex.EncodeToString(sum[:]))
+}
+
+// tokenReplayExpiration returns the time until a token must be kept in the
+// token cache. It includes the leeway used to validate the token, and tokens
+// without an expiration are kept for an hour.
+func tokenReplayExpiration(exp *jose.NumericDate) time.Time {
+	if exp == nil {
+		return time.Now().Add(time.Hour)
+	}
+	return exp.Time().Add(time.Minute)
+}
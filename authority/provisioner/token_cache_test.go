@@ -0,0 +1,49 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func Test_memoryTokenCache_Use(t *testing.T) {
+	now := time.Now()
+	c := NewMemoryTokenCache(2).(*memoryTokenCache)
+	c.now = func() time.Time { return now }
+
+	use := func(key string, expiresAt time.Time) bool {
+		ok, err := c.Use(key, expiresAt)
+		assert.FatalError(t, err)
+		return ok
+	}
+
+	assert.True(t, use("a", now.Add(time.Minute)))
+	assert.False(t, use("a", now.Add(time.Minute)))
+	assert.True(t, use("b", now.Add(time.Minute)))
+
+	// expired tokens can be used again
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	assert.True(t, use("a", now.Add(5*time.Minute)))
+	assert.False(t, use("a", now.Add(5*time.Minute)))
+
+	// the least recently used token is evicted
+	assert.True(t, use("c", now.Add(5*time.Minute)))
+	assert.Equals(t, 2, c.ll.Len())
+	_, ok := c.items["b"]
+	assert.False(t, ok)
+	assert.False(t, use("a", now.Add(5*time.Minute)))
+}
+
+func Test_tokenReplayKey(t *testing.T) {
+	assert.Equals(t, tokenReplayKey("prov", "instance", "id", "token"), tokenReplayKey("prov", "instance", "id", "other"))
+	assert.NotEquals(t, tokenReplayKey("prov", "instance", "id", "token"), tokenReplayKey("prov", "other", "id", "token"))
+	assert.NotEquals(t, tokenReplayKey("prov", "instance", "", "token"), tokenReplayKey("prov", "instance", "", "other"))
+}
+
+func Test_tokenReplayExpiration(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	assert.Equals(t, exp.Add(time.Minute), tokenReplayExpiration(jose.NewNumericDate(exp)))
+	assert.True(t, tokenReplayExpiration(nil).After(time.Now().Add(59*time.Minute)))
+}
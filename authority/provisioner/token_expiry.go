@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// TokenExpiryOptions binds the validity of the X.509 certificates to the
+// expiration of the token that authorized them. The NotAfter of the
+// certificates is clamped to the "exp" claim of the token plus the given
+// Offset, so an instance cannot keep a long-lived certificate after it's torn
+// down.
+type TokenExpiryOptions struct {
+	Offset Duration `json:"offset,omitempty"`
+}
+
+// init validates the options.
+func (o *TokenExpiryOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	if o.Offset.Value() < 0 {
+		return errors.New("bindToTokenExpiry offset cannot be negative")
+	}
+	return nil
+}
+
+// newOptions returns the sign options that clamp the validity of the
+// certificate to the expiration of a token with the given claims.
+func (o *TokenExpiryOptions) newOptions(claims jose.Claims) ([]SignOption, error) {
+	return o.newCappedOptions(claims, time.Time{})
+}
+
+// newCappedOptions is like newOptions, but the expiration of the token is
+// capped to maxExpiry if it is not zero. It's used with tokens whose "exp"
+// claim is chosen by the client, like the AWS tokens.
+func (o *TokenExpiryOptions) newCappedOptions(claims jose.Claims, maxExpiry time.Time) ([]SignOption, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if claims.Expiry == nil {
+		return nil, errors.New("token has no expiration")
+	}
+	exp := claims.Expiry.Time()
+	if !maxExpiry.IsZero() && exp.After(maxExpiry) {
+		exp = maxExpiry
+	}
+	return []SignOption{
+		tokenExpiryModifier(exp.Add(o.Offset.Value())),
+	}, nil
+}
+
+// tokenExpiryModifier is a CertificateModifier that limits the NotAfter of a
+// certificate to the given time.
+type tokenExpiryModifier time.Time
+
+// Modify implements CertificateModifier and clamps the NotAfter of the
+// certificate. It fails if the certificate would not be valid before the
+// given time.
+func (m tokenExpiryModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	notAfter := time.Time(m)
+	if !cert.NotBefore.Before(notAfter) {
+		return errs.Forbidden("certificate notBefore cannot be after the token expiration %s", notAfter.Format(time.RFC3339))
+	}
+	if cert.NotAfter.After(notAfter) {
+		cert.NotAfter = notAfter
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func TestTokenExpiryOptions_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *TokenExpiryOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &TokenExpiryOptions{}, false},
+		{"ok offset", &TokenExpiryOptions{Offset: Duration{Duration: time.Hour}}, false},
+		{"fail negative offset", &TokenExpiryOptions{Offset: Duration{Duration: -time.Hour}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.init(); (err != nil) != tt.wantErr {
+				t.Errorf("TokenExpiryOptions.init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenExpiryOptions_newOptions(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	tests := []struct {
+		name    string
+		options *TokenExpiryOptions
+		claims  jose.Claims
+		want    []SignOption
+		wantErr bool
+	}{
+		{"ok nil", nil, jose.Claims{}, nil, false},
+		{"ok", &TokenExpiryOptions{}, jose.Claims{Expiry: jose.NewNumericDate(exp)}, []SignOption{tokenExpiryModifier(exp)}, false},
+		{"ok offset", &TokenExpiryOptions{Offset: Duration{Duration: time.Hour}}, jose.Claims{Expiry: jose.NewNumericDate(exp)}, []SignOption{tokenExpiryModifier(exp.Add(time.Hour))}, false},
+		{"fail no expiry", &TokenExpiryOptions{}, jose.Claims{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.newOptions(tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TokenExpiryOptions.newOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestTokenExpiryOptions_newCappedOptions(t *testing.T) {
+	exp := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	tests := []struct {
+		name      string
+		options   *TokenExpiryOptions
+		claims    jose.Claims
+		maxExpiry time.Time
+		want      []SignOption
+		wantErr   bool
+	}{
+		{"ok nil", nil, jose.Claims{}, exp, nil, false},
+		{"ok not capped", &TokenExpiryOptions{}, jose.Claims{Expiry: jose.NewNumericDate(exp)}, exp.Add(time.Minute), []SignOption{tokenExpiryModifier(exp)}, false},
+		{"ok capped", &TokenExpiryOptions{}, jose.Claims{Expiry: jose.NewNumericDate(exp.Add(24 * time.Hour))}, exp, []SignOption{tokenExpiryModifier(exp)}, false},
+		{"ok capped offset", &TokenExpiryOptions{Offset: Duration{Duration: time.Hour}}, jose.Claims{Expiry: jose.NewNumericDate(exp.Add(24 * time.Hour))}, exp, []SignOption{tokenExpiryModifier(exp.Add(time.Hour))}, false},
+		{"ok zero max", &TokenExpiryOptions{}, jose.Claims{Expiry: jose.NewNumericDate(exp.Add(24 * time.Hour))}, time.Time{}, []SignOption{tokenExpiryModifier(exp.Add(24 * time.Hour))}, false},
+		{"fail no expiry", &TokenExpiryOptions{}, jose.Claims{}, exp, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.newCappedOptions(tt.claims, tt.maxExpiry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TokenExpiryOptions.newCappedOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_tokenExpiryModifier_Modify(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name         string
+		modifier     tokenExpiryModifier
+		cert         *x509.Certificate
+		wantNotAfter time.Time
+		wantErr      bool
+	}{
+		{"ok clamped", tokenExpiryModifier(now.Add(time.Hour)), &x509.Certificate{NotBefore: now, NotAfter: now.Add(24 * time.Hour)}, now.Add(time.Hour), false},
+		{"ok not clamped", tokenExpiryModifier(now.Add(time.Hour)), &x509.Certificate{NotBefore: now, NotAfter: now.Add(time.Minute)}, now.Add(time.Minute), false},
+		{"fail notBefore", tokenExpiryModifier(now.Add(time.Hour)), &x509.Certificate{NotBefore: now.Add(time.Hour), NotAfter: now.Add(24 * time.Hour)}, now.Add(24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.modifier.Modify(tt.cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("tokenExpiryModifier.Modify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.wantNotAfter, tt.cert.NotAfter)
+		})
+	}
+}
+
+func assertTokenExpiry(t *testing.T, opts []SignOption, want time.Time) {
+	t.Helper()
+	var found []tokenExpiryModifier
+	for _, o := range opts {
+		if m, ok := o.(tokenExpiryModifier); ok {
+			found = append(found, m)
+		}
+	}
+	if want.IsZero() {
+		assert.Len(t, 0, found)
+		return
+	}
+	if assert.Len(t, 1, found) {
+		assert.Equals(t, want, time.Time(found[0]))
+	}
+}
+
+func TestGCP_AuthorizeSign_bindToTokenExpiry(t *testing.T) {
+	p1, err := generateGCP()
+	assert.FatalError(t, err)
+	p1.BindToTokenExpiry = &TokenExpiryOptions{Offset: Duration{Duration: time.Hour}}
+	assert.FatalError(t, p1.BindToTokenExpiry.init())
+
+	p2, err := generateGCP()
+	assert.FatalError(t, err)
+	p2.keyStore = p1.keyStore
+
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name string
+		prov *GCP
+		want time.Time
+	}{
+		{"ok", p1, now.Add(5*time.Minute + time.Hour)},
+		{"ok not configured", p2, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateGCPToken(tt.prov.ServiceAccounts[0],
+				"https://accounts.google.com", tt.prov.GetID(),
+				"instance-id", "instance-name", "project-id", "zone",
+				now, &p1.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			opts, err := tt.prov.AuthorizeSign(context.Background(), tok)
+			assert.FatalError(t, err)
+			assertTokenExpiry(t, opts, tt.want)
+		})
+	}
+}
+
+func TestAWS_AuthorizeSign_bindToTokenExpiry(t *testing.T) {
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	p.BindToTokenExpiry = &TokenExpiryOptions{}
+	assert.FatalError(t, p.BindToTokenExpiry.init())
+
+	tok, err := p.GetIdentityToken("foo.local", "https://ca.smallstep.com")
+	assert.FatalError(t, err)
+	jwt, err := jose.ParseSigned(tok)
+	assert.FatalError(t, err)
+	var claims jose.Claims
+	assert.FatalError(t, jwt.UnsafeClaimsWithoutVerification(&claims))
+
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assertTokenExpiry(t, opts, claims.Expiry.Time())
+
+	// The client chooses the expiration, so it's capped.
+	block, _ := pem.Decode([]byte(awsTestKey))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	assert.FatalError(t, err)
+	tok, err = generateAWSToken(p, "instance-id", awsIssuer, p.GetID(), p.Accounts[0], "instance-id",
+		"127.0.0.1", "us-west-1", time.Now(), key, func(payload *awsPayload) {
+			payload.Expiry = jose.NewNumericDate(time.Now().Add(365 * 24 * time.Hour))
+		})
+	assert.FatalError(t, err)
+	before := time.Now()
+	opts, err = p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	var found bool
+	for _, o := range opts {
+		if m, ok := o.(tokenExpiryModifier); ok {
+			found = true
+			exp := time.Time(m)
+			assert.False(t, exp.Before(before.Add(awsTokenLifetime)))
+			assert.False(t, exp.After(time.Now().Add(awsTokenLifetime)))
+		}
+	}
+	assert.True(t, found)
+}
@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// StepOIDTokenHash is the default OID of the extension with the hash of the
+// token that authorized a certificate.
+var StepOIDTokenHash = append(asn1.ObjectIdentifier(nil), append(StepOIDRoot, 6)...)
+
+// TokenHashOptions adds an extension with the SHA-256 hash of the token that
+// authorized the certificate, encoded as an ASN.1 OCTET STRING, so the
+// certificates can be correlated with the logs of the enrollment. The token is
+// never added to the certificate. The extension uses the given OID, or
+// StepOIDTokenHash if it is not set.
+type TokenHashOptions struct {
+	OID x509util.ObjectIdentifier `json:"oid,omitempty"`
+}
+
+// validate validates the token hash options.
+func (o *TokenHashOptions) validate() error {
+	if o == nil || len(o.OID) == 0 {
+		return nil
+	}
+	oid := asn1.ObjectIdentifier(o.OID)
+	if len(oid) < 2 || oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return errors.Errorf("x509.tokenHash oid %s is not valid", oid)
+	}
+	for _, v := range []asn1.ObjectIdentifier{StepOIDProvisioner, StepOIDOriginalNotBefore, StepOIDRenewAfter, StepOIDRenewalBudget, StepOIDAttestationResult, StepOIDKeyAttestationStatement, StepOIDKeyAttestation} {
+		if oid.Equal(v) {
+			return errors.Errorf("x509.tokenHash oid %s is reserved", oid)
+		}
+	}
+	return nil
+}
+
+// GetOID returns the OID of the token hash extension.
+func (o *TokenHashOptions) GetOID() asn1.ObjectIdentifier {
+	if o == nil || len(o.OID) == 0 {
+		return StepOIDTokenHash
+	}
+	return asn1.ObjectIdentifier(o.OID)
+}
+
+// NewExtension returns the extension with the hash of the given token.
+func (o *TokenHashOptions) NewExtension(token string) (pkix.Extension, error) {
+	sum := sha256.Sum256([]byte(token))
+	b, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling tokenHash extension")
+	}
+	return pkix.Extension{
+		Id:    o.GetOID(),
+		Value: b,
+	}, nil
+}
+
+// GetTokenHash returns the hash of the token in the extension with the given
+// OID of the given certificate. It returns false if the certificate does not
+// have the extension.
+func GetTokenHash(cert *x509.Certificate, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(oid) {
+			var b []byte
+			if rest, err := asn1.Unmarshal(e.Value, &b); err != nil || len(rest) > 0 {
+				return nil, false
+			}
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// tokenHashEnforcer is a CertificateEnforcer that adds the extension with the
+// hash of the token, replacing the one added by the template, if any.
+type tokenHashEnforcer struct {
+	options *TokenHashOptions
+	token   string
+}
+
+// Enforce implements CertificateEnforcer.
+func (e tokenHashEnforcer) Enforce(cert *x509.Certificate) error {
+	ext, err := e.options.NewExtension(e.token)
+	if err != nil {
+		return err
+	}
+	exts := cert.ExtraExtensions[:0:0]
+	for _, x := range cert.ExtraExtensions {
+		if !x.Id.Equal(ext.Id) {
+			exts = append(exts, x)
+		}
+	}
+	cert.ExtraExtensions = append(exts, ext)
+	return nil
+}
@@ -0,0 +1,144 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestTokenHashOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *TokenHashOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok default", &TokenHashOptions{}, false},
+		{"ok", &TokenHashOptions{OID: x509util.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}}, false},
+		{"fail oid", &TokenHashOptions{OID: x509util.ObjectIdentifier{1}}, true},
+		{"fail first arc", &TokenHashOptions{OID: x509util.ObjectIdentifier{3, 1, 2}}, true},
+		{"fail second arc", &TokenHashOptions{OID: x509util.ObjectIdentifier{1, 40, 2}}, true},
+		{"fail provisioner oid", &TokenHashOptions{OID: x509util.ObjectIdentifier(StepOIDProvisioner)}, true},
+		{"fail renew after oid", &TokenHashOptions{OID: x509util.ObjectIdentifier(StepOIDRenewAfter)}, true},
+		{"fail attestation result oid", &TokenHashOptions{OID: x509util.ObjectIdentifier(StepOIDAttestationResult)}, true},
+		{"fail key attestation oid", &TokenHashOptions{OID: x509util.ObjectIdentifier(StepOIDKeyAttestation)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TokenHashOptions.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenHashOptions_GetOID(t *testing.T) {
+	var o *TokenHashOptions
+	assert.Equals(t, StepOIDTokenHash, o.GetOID())
+	assert.Equals(t, StepOIDTokenHash, (&TokenHashOptions{}).GetOID())
+
+	o = &TokenHashOptions{OID: x509util.ObjectIdentifier{1, 2, 3, 4}}
+	assert.Equals(t, asn1.ObjectIdentifier{1, 2, 3, 4}, o.GetOID())
+}
+
+func Test_tokenHashEnforcer_Enforce(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 2, 3, 4}
+	token := "the.token.signature"
+	sum := sha256.Sum256([]byte(token))
+
+	tests := []struct {
+		name    string
+		options *TokenHashOptions
+		exts    []pkix.Extension
+		oid     asn1.ObjectIdentifier
+		wantLen int
+	}{
+		{"ok default", &TokenHashOptions{}, nil, StepOIDTokenHash, 1},
+		{"ok oid", &TokenHashOptions{OID: x509util.ObjectIdentifier(oid)}, nil, oid, 1},
+		{"ok replace template", &TokenHashOptions{}, []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{0x05, 0x00}},
+			{Id: StepOIDTokenHash, Value: []byte{0x05, 0x00}},
+		}, StepOIDTokenHash, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{ExtraExtensions: tt.exts}
+			assert.FatalError(t, tokenHashEnforcer{options: tt.options, token: token}.Enforce(cert))
+			assert.Len(t, tt.wantLen, cert.ExtraExtensions)
+
+			// Marshaled extensions are in cert.Extensions of parsed certificates.
+			cert.Extensions = cert.ExtraExtensions
+			got, ok := GetTokenHash(cert, tt.oid)
+			assert.True(t, ok)
+			assert.Equals(t, sum[:], got)
+		})
+	}
+
+	_, ok := GetTokenHash(&x509.Certificate{}, StepOIDTokenHash)
+	assert.False(t, ok)
+	_, ok = GetTokenHash(&x509.Certificate{Extensions: []pkix.Extension{
+		{Id: StepOIDTokenHash, Value: []byte{0x05, 0x00}},
+	}}, StepOIDTokenHash)
+	assert.False(t, ok)
+}
+
+func TestJWK_AuthorizeSign_tokenHash(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{X509: &X509Options{TokenHash: &TokenHashOptions{OID: x509util.ObjectIdentifier(oid)}}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	tok, err := generateToken("subject", p.Name, testAudiences.Sign[0], "", []string{"subject"}, time.Now(), key)
+	assert.FatalError(t, err)
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "subject"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, o := range opts {
+		if e, ok := o.(CertificateEnforcer); ok {
+			assert.FatalError(t, e.Enforce(tmpl))
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	assert.FatalError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	// The extension is an OCTET STRING with the hash of the token.
+	var ext pkix.Extension
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(oid) {
+			ext = e
+		}
+	}
+	assert.False(t, ext.Critical)
+	var got []byte
+	rest, err := asn1.Unmarshal(ext.Value, &got)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, rest)
+	sum := sha256.Sum256([]byte(tok))
+	assert.Equals(t, sum[:], got)
+
+	p.Options = &Options{X509: &X509Options{TokenHash: &TokenHashOptions{OID: x509util.ObjectIdentifier{1}}}}
+	assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+}
@@ -94,7 +94,11 @@ func must(args ...interface{}) []interface{} {
 }
 
 func generateJSONWebKey() (*jose.JSONWebKey, error) {
-	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	return generateJSONWebKeyWith("EC", "P-256", "ES256")
+}
+
+func generateJSONWebKeyWith(kty, crv, alg string) (*jose.JSONWebKey, error) {
+	jwk, err := jose.GenerateJWK(kty, crv, alg, "sig", "", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -159,11 +163,15 @@ func decryptJSONWebKey(key string) (*jose.JSONWebKey, error) {
 }
 
 func generateJWK() (*JWK, error) {
+	return generateJWKWith("EC", "P-256", "ES256")
+}
+
+func generateJWKWith(kty, crv, alg string) (*JWK, error) {
 	name, err := randutil.Alphanumeric(10)
 	if err != nil {
 		return nil, err
 	}
-	jwk, err := generateJSONWebKey()
+	jwk, err := generateJSONWebKeyWith(kty, crv, alg)
 	if err != nil {
 		return nil, err
 	}
@@ -338,10 +346,7 @@ func generateOIDC() (*OIDC, error) {
 			Issuer:    issuer,
 			JWKSetURI: "https://example.com/.well-known/jwks",
 		},
-		keyStore: &keyStore{
-			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
-			expiry: time.Now().Add(24 * time.Hour),
-		},
+		keyStore: newStaticKeyStore(*jwk),
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
 		Audiences: testAudiences,
@@ -349,6 +354,16 @@ func generateOIDC() (*OIDC, error) {
 	return p, err
 }
 
+// newStaticKeyStore returns a key store with the given keys that is never
+// reloaded.
+func newStaticKeyStore(keys ...jose.JSONWebKey) *keyStore {
+	return &keyStore{
+		keySet:         jose.JSONWebKeySet{Keys: keys},
+		expiry:         time.Now().Add(24 * time.Hour),
+		lastUnknownKey: time.Now().Add(24 * time.Hour),
+	}
+}
+
 func generateGCP() (*GCP, error) {
 	name, err := randutil.Alphanumeric(10)
 	if err != nil {
@@ -368,10 +383,7 @@ func generateGCP() (*GCP, error) {
 		ServiceAccounts: []string{serviceAccount},
 		Claims:          &globalProvisionerClaims,
 		config:          newGCPConfig(),
-		keyStore: &keyStore{
-			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
-			expiry: time.Now().Add(24 * time.Hour),
-		},
+		keyStore:        newStaticKeyStore(*jwk),
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
 		Audiences: testAudiences.WithFragment("gcp/" + name),
@@ -604,10 +616,7 @@ func generateAzure() (*Azure, error) {
 			Issuer:    "https://sts.windows.net/" + tenantID + "/",
 			JWKSetURI: "https://login.microsoftonline.com/common/discovery/keys",
 		},
-		keyStore: &keyStore{
-			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
-			expiry: time.Now().Add(24 * time.Hour),
-		},
+		keyStore: newStaticKeyStore(*jwk),
 	}
 	p.ctl, err = NewController(p, p.Claims, Config{
 		Audiences: testAudiences,
@@ -649,6 +658,12 @@ func generateAzureWithServer() (*Azure, *httptest.Server, error) {
 			writeJSON(w, openIDConfiguration{Issuer: "", JWKSetURI: srv.URL + "/jwks_uri"})
 		case "/openid-configuration-fail-jwk":
 			writeJSON(w, openIDConfiguration{Issuer: issuer, JWKSetURI: srv.URL + "/error"})
+		case "/empty":
+			writeJSON(w, jose.JSONWebKeySet{})
+		case "/empty/.well-known/openid-configuration":
+			writeJSON(w, openIDConfiguration{Issuer: "the-empty-issuer", JWKSetURI: srv.URL + "/empty"})
+		case "/error/.well-known/openid-configuration":
+			writeJSON(w, openIDConfiguration{Issuer: "the-error-issuer", JWKSetURI: srv.URL + "/error"})
 		case "/random":
 			keySet := must(generateJSONWebKeySet(2))[0].(jose.JSONWebKeySet)
 			w.Header().Add("Cache-Control", "max-age=5")
@@ -735,7 +750,11 @@ func generateToken(sub, iss, aud, email string, sans []string, iat time.Time, jw
 		}
 	}
 
-	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	alg := jose.ES256
+	if jwk.Algorithm != "" {
+		alg = jwk.Algorithm
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(alg), Key: jwk.Key}, so)
 	if err != nil {
 		return "", err
 	}
@@ -765,6 +784,23 @@ func generateToken(sub, iss, aud, email string, sans []string, iat time.Time, jw
 	return jose.Signed(sig).Claims(claims).CompactSerialize()
 }
 
+func generateOIDCTokenWithClaims(sub, iss, aud string, jwk *jose.JSONWebKey, extra map[string]interface{}) (string, error) {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return jose.Signed(sig).Claims(jose.Claims{
+		Subject:   sub,
+		Issuer:    iss,
+		IssuedAt:  jose.NewNumericDate(now),
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		Audience:  []string{aud},
+	}).Claims(extra).CompactSerialize()
+}
+
 func generateOIDCToken(sub, iss, aud, email, preferredUsername string, iat time.Time, jwk *jose.JSONWebKey, tokOpts ...tokOption) (string, error) {
 	so := new(jose.SignerOptions)
 	so.WithType("JWT")
@@ -776,7 +812,11 @@ func generateOIDCToken(sub, iss, aud, email, preferredUsername string, iat time.
 		}
 	}
 
-	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	alg := jose.ES256
+	if jwk.Algorithm != "" {
+		alg = jwk.Algorithm
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(alg), Key: jwk.Key}, so)
 	if err != nil {
 		return "", err
 	}
@@ -906,7 +946,7 @@ func generateSSHToken(sub, iss, aud string, iat time.Time, sshOpts *SignSSHOptio
 	return jose.Signed(sig).Claims(claims).CompactSerialize()
 }
 
-func generateGCPToken(sub, iss, aud, instanceID, instanceName, projectID, zone string, iat time.Time, jwk *jose.JSONWebKey) (string, error) {
+func generateGCPToken(sub, iss, aud, instanceID, instanceName, projectID, zone string, iat time.Time, jwk *jose.JSONWebKey, opts ...func(*gcpPayload)) (string, error) {
 	sig, err := jose.NewSigner(
 		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
 		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
@@ -941,10 +981,13 @@ func generateGCPToken(sub, iss, aud, instanceID, instanceName, projectID, zone s
 			},
 		},
 	}
+	for _, fn := range opts {
+		fn(&claims)
+	}
 	return jose.Signed(sig).Claims(claims).CompactSerialize()
 }
 
-func generateAWSToken(p *AWS, sub, iss, aud, accountID, instanceID, privateIP, region string, iat time.Time, key crypto.Signer) (string, error) {
+func generateAWSToken(p *AWS, sub, iss, aud, accountID, instanceID, privateIP, region string, iat time.Time, key crypto.Signer, opts ...func(*awsPayload)) (string, error) {
 	doc, err := json.MarshalIndent(awsInstanceIdentityDocument{
 		AccountID:        accountID,
 		Architecture:     "x86_64",
@@ -998,6 +1041,9 @@ func generateAWSToken(p *AWS, sub, iss, aud, accountID, instanceID, privateIP, r
 			Signature: signature,
 		},
 	}
+	for _, fn := range opts {
+		fn(&claims)
+	}
 	return jose.Signed(sig).Claims(claims).CompactSerialize()
 }
 
@@ -0,0 +1,147 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// ValiditySchedule confines the validity of the X.509 certificates to daily
+// windows. Days is the list of weekdays with a window, e.g. "mon" or "monday",
+// all the days by default. Start and End are the local times of the window, in
+// the 24-hour "15:04" format, in the given Timezone, UTC by default.
+//
+// Certificates are clamped to the current window, or shifted to the next one
+// if they are signed outside of it. If Strict is true, the requests outside of
+// a window are rejected instead.
+type ValiditySchedule struct {
+	Days     []string `json:"days,omitempty"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone,omitempty"`
+	Strict   bool     `json:"strict,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// validitySchedule is the parsed version of a ValiditySchedule.
+type validitySchedule struct {
+	days     [7]bool
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+	strict   bool
+}
+
+// newValiditySchedule validates the given schedule and returns its parsed
+// version. It returns nil if the schedule is not set.
+func newValiditySchedule(o *ValiditySchedule) (*validitySchedule, error) {
+	if o == nil {
+		return nil, nil
+	}
+	s := &validitySchedule{
+		location: time.UTC,
+		strict:   o.Strict,
+	}
+	if len(o.Days) == 0 {
+		for i := range s.days {
+			s.days[i] = true
+		}
+	}
+	for _, d := range o.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, errors.Errorf("x509.validitySchedule day %q is not valid", d)
+		}
+		s.days[wd] = true
+	}
+
+	var err error
+	if s.start, err = parseTimeOfDay(o.Start); err != nil {
+		return nil, errors.Wrap(err, "x509.validitySchedule start is not valid")
+	}
+	if s.end, err = parseTimeOfDay(o.End); err != nil {
+		return nil, errors.Wrap(err, "x509.validitySchedule end is not valid")
+	}
+	if s.end <= s.start {
+		return nil, errors.New("x509.validitySchedule end must be after start")
+	}
+	if o.Timezone != "" {
+		if s.location, err = time.LoadLocation(o.Timezone); err != nil {
+			return nil, errors.Wrapf(err, "x509.validitySchedule timezone %q is not valid", o.Timezone)
+		}
+	}
+	return s, nil
+}
+
+// parseTimeOfDay parses a time in the "15:04" format and returns it as the
+// duration since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// window returns the window that contains t or, if there is none, the next
+// one.
+func (s *validitySchedule) window(t time.Time) (start, end time.Time) {
+	lt := t.In(s.location)
+	for i := 0; i <= 7; i++ {
+		y, m, d := lt.AddDate(0, 0, i).Date()
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, s.location)
+		if !s.days[midnight.Weekday()] {
+			continue
+		}
+		start = time.Date(y, m, d, int(s.start/time.Hour), int(s.start%time.Hour/time.Minute), 0, 0, s.location)
+		end = time.Date(y, m, d, int(s.end/time.Hour), int(s.end%time.Hour/time.Minute), 0, 0, s.location)
+		if end.After(t) {
+			return start, end
+		}
+	}
+	// Unreachable, a valid schedule has at least one day.
+	return start, end
+}
+
+// validityScheduleModifier is a CertificateModifier that confines the validity
+// of a certificate to a window of the schedule.
+type validityScheduleModifier struct {
+	schedule *validitySchedule
+	now      time.Time
+}
+
+// Modify clamps the validity of the certificate to the window that contains
+// its notBefore. If the notBefore is outside a window, the certificate is
+// moved to the next one, keeping its duration, or rejected if the schedule is
+// strict.
+func (m validityScheduleModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if m.schedule.strict {
+		if start, _ := m.schedule.window(m.now); start.After(m.now) {
+			return errs.Forbidden("certificates cannot be signed outside of the validity schedule, the next window starts on %s", start.Format(time.RFC3339))
+		}
+	}
+
+	start, end := m.schedule.window(cert.NotBefore)
+	if cert.NotBefore.Before(start) {
+		d := cert.NotAfter.Sub(cert.NotBefore)
+		cert.NotBefore = start
+		cert.NotAfter = start.Add(d)
+	}
+	if cert.NotAfter.After(end) {
+		cert.NotAfter = end
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_newValiditySchedule(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		o       *ValiditySchedule
+		want    *validitySchedule
+		wantErr bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok all days", &ValiditySchedule{Start: "09:00", End: "17:30"}, &validitySchedule{
+			days:     [7]bool{true, true, true, true, true, true, true},
+			start:    9 * time.Hour,
+			end:      17*time.Hour + 30*time.Minute,
+			location: time.UTC,
+		}, false},
+		{"ok days", &ValiditySchedule{Days: []string{"mon", "Tuesday", "FRI"}, Start: "08:00", End: "18:00", Timezone: "Europe/Madrid", Strict: true}, &validitySchedule{
+			days:     [7]bool{false, true, true, false, false, true, false},
+			start:    8 * time.Hour,
+			end:      18 * time.Hour,
+			location: madrid,
+			strict:   true,
+		}, false},
+		{"fail day", &ValiditySchedule{Days: []string{"mon", "foo"}, Start: "09:00", End: "17:00"}, nil, true},
+		{"fail start", &ValiditySchedule{Start: "9am", End: "17:00"}, nil, true},
+		{"fail end", &ValiditySchedule{Start: "09:00", End: "25:00"}, nil, true},
+		{"fail empty", &ValiditySchedule{}, nil, true},
+		{"fail end before start", &ValiditySchedule{Start: "17:00", End: "09:00"}, nil, true},
+		{"fail timezone", &ValiditySchedule{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newValiditySchedule(tt.o)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newValiditySchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_validityScheduleModifier_Modify(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	assert.FatalError(t, err)
+	weekdays, err := newValiditySchedule(&ValiditySchedule{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:00",
+		Timezone: "Europe/Madrid",
+	})
+	assert.FatalError(t, err)
+	strict, err := newValiditySchedule(&ValiditySchedule{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:00",
+		Timezone: "Europe/Madrid",
+		Strict:   true,
+	})
+	assert.FatalError(t, err)
+
+	// Wednesday, 2024-01-10
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, madrid)
+	}
+
+	tests := []struct {
+		name          string
+		schedule      *validitySchedule
+		now           time.Time
+		cert          *x509.Certificate
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantErr       bool
+	}{
+		{"ok inside", weekdays, at(10, 10, 0), &x509.Certificate{NotBefore: at(10, 10, 0), NotAfter: at(10, 11, 0)}, at(10, 10, 0), at(10, 11, 0), false},
+		{"ok clamp end", weekdays, at(10, 10, 0), &x509.Certificate{NotBefore: at(10, 10, 0), NotAfter: at(11, 10, 0)}, at(10, 10, 0), at(10, 17, 0), false},
+		{"ok backdated start", weekdays, at(10, 9, 0), &x509.Certificate{NotBefore: at(10, 8, 59), NotAfter: at(10, 9, 59)}, at(10, 9, 0), at(10, 10, 0), false},
+		{"ok before window", weekdays, at(10, 7, 0), &x509.Certificate{NotBefore: at(10, 7, 0), NotAfter: at(10, 8, 0)}, at(10, 9, 0), at(10, 10, 0), false},
+		{"ok after window", weekdays, at(10, 18, 0), &x509.Certificate{NotBefore: at(10, 18, 0), NotAfter: at(11, 18, 0)}, at(11, 9, 0), at(11, 17, 0), false},
+		{"ok weekend", weekdays, at(12, 18, 0), &x509.Certificate{NotBefore: at(12, 18, 0), NotAfter: at(12, 19, 0)}, at(15, 9, 0), at(15, 10, 0), false},
+		{"ok strict inside", strict, at(10, 16, 0), &x509.Certificate{NotBefore: at(10, 16, 0), NotAfter: at(10, 18, 0)}, at(10, 16, 0), at(10, 17, 0), false},
+		{"fail strict before window", strict, at(10, 8, 59), &x509.Certificate{NotBefore: at(10, 8, 59), NotAfter: at(10, 9, 59)}, time.Time{}, time.Time{}, true},
+		{"fail strict end of window", strict, at(10, 17, 0), &x509.Certificate{NotBefore: at(10, 17, 0), NotAfter: at(10, 18, 0)}, time.Time{}, time.Time{}, true},
+		{"fail strict weekend", strict, at(13, 12, 0), &x509.Certificate{NotBefore: at(13, 12, 0), NotAfter: at(13, 13, 0)}, time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := validityScheduleModifier{schedule: tt.schedule, now: tt.now}
+			if err := m.Modify(tt.cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Fatalf("validityScheduleModifier.Modify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.True(t, tt.wantNotBefore.Equal(tt.cert.NotBefore), tt.cert.NotBefore)
+				assert.True(t, tt.wantNotAfter.Equal(tt.cert.NotAfter), tt.cert.NotAfter)
+			}
+		})
+	}
+}
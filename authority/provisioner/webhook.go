@@ -36,7 +36,7 @@ type WebhookController struct {
 }
 
 // Enrich fetches data from remote servers and adds returned data to the
-// templateData
+// templateData. The webhooks are not called in a dry run.
 func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBody) error {
 	if wc == nil {
 		return nil
@@ -56,8 +56,11 @@ func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBod
 		if !wc.isCertTypeOK(wh) {
 			continue
 		}
+		if DryRunFromContext(ctx) {
+			return nil
+		}
 
-		whCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		whCtx, cancel := context.WithTimeout(ctx, wh.GetTimeout())
 		defer cancel() //nolint:gocritic // every request canceled with its own timeout
 
 		resp, err := wh.DoWithContext(whCtx, wc.client, req, wc.TemplateData)
@@ -72,7 +75,8 @@ func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBod
 	return nil
 }
 
-// Authorize checks that all remote servers allow the request
+// Authorize checks that all remote servers allow the request. The webhooks
+// are not called in a dry run.
 func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.RequestBody) error {
 	if wc == nil {
 		return nil
@@ -92,12 +96,21 @@ func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.Request
 		if !wc.isCertTypeOK(wh) {
 			continue
 		}
+		if DryRunFromContext(ctx) {
+			return nil
+		}
 
-		whCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		whCtx, cancel := context.WithTimeout(ctx, wh.GetTimeout())
 		defer cancel() //nolint:gocritic // every request canceled with its own timeout
 
 		resp, err := wh.DoWithContext(whCtx, wc.client, req, wc.TemplateData)
 		if err != nil {
+			// A webhook that fails open allows the request if the server
+			// cannot be reached or returns an error, but not if it denies it.
+			if wh.FailOpen {
+				log.Printf("authorizing webhook %q failed, allowing request: %v", wh.Name, err)
+				continue
+			}
 			return err
 		}
 		if !resp.Allow {
@@ -117,6 +130,10 @@ func (wc *WebhookController) isCertTypeOK(wh *Webhook) bool {
 	return wc.certType.String() == wh.CertType
 }
 
+// DefaultWebhookTimeout is the default timeout of the requests to a webhook
+// server, including the retry.
+const DefaultWebhookTimeout = 10 * time.Second
+
 type Webhook struct {
 	ID                   string `json:"id"`
 	Name                 string `json:"name"`
@@ -130,6 +147,33 @@ type Webhook struct {
 		Username string
 		Password string
 	} `json:"-"`
+	// Timeout is the timeout of the requests to the webhook server, it
+	// defaults to 10s.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// FailOpen allows the request if an authorizing webhook server cannot be
+	// reached or responds with an error. By default, these requests are
+	// rejected.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// Validate validates the timeout and the fail-open option of the webhook.
+func (w *Webhook) Validate() error {
+	switch {
+	case w.Timeout != nil && w.Timeout.Duration <= 0:
+		return errors.Errorf("webhook %q timeout must be greater than 0", w.Name)
+	case w.FailOpen && w.Kind != linkedca.Webhook_AUTHORIZING.String():
+		return errors.Errorf("webhook %q failOpen can only be used with authorizing webhooks", w.Name)
+	default:
+		return nil
+	}
+}
+
+// GetTimeout returns the timeout of the requests to the webhook server.
+func (w *Webhook) GetTimeout() time.Duration {
+	if w.Timeout == nil || w.Timeout.Duration <= 0 {
+		return DefaultWebhookTimeout
+	}
+	return w.Timeout.Duration
 }
 
 func (w *Webhook) DoWithContext(ctx context.Context, client *http.Client, reqBody *webhook.RequestBody, data any) (*webhook.ResponseBody, error) {
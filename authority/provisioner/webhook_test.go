@@ -14,6 +14,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -387,6 +388,112 @@ func TestWebhookController_Authorize(t *testing.T) {
 	}
 }
 
+func TestWebhookController_Authorize_failOpen(t *testing.T) {
+	var slow = make(chan struct{})
+	defer close(slow)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/allow":
+			json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: true})
+		case "/deny":
+			json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: false})
+		case "/slow":
+			io.Copy(io.Discard, r.Body)
+			select {
+			case <-slow:
+			case <-r.Context().Done():
+			}
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	timeout := &Duration{Duration: 100 * time.Millisecond}
+	tests := []struct {
+		name      string
+		webhook   *Webhook
+		expectErr bool
+	}{
+		{"ok", &Webhook{Name: "ok", Kind: "AUTHORIZING", URL: srv.URL + "/allow"}, false},
+		{"ok fail open error", &Webhook{Name: "error", Kind: "AUTHORIZING", URL: srv.URL + "/error", FailOpen: true}, false},
+		{"ok fail open timeout", &Webhook{Name: "slow", Kind: "AUTHORIZING", URL: srv.URL + "/slow", FailOpen: true, Timeout: timeout}, false},
+		{"fail error", &Webhook{Name: "error", Kind: "AUTHORIZING", URL: srv.URL + "/error"}, true},
+		{"fail timeout", &Webhook{Name: "slow", Kind: "AUTHORIZING", URL: srv.URL + "/slow", Timeout: timeout}, true},
+		{"fail fail open deny", &Webhook{Name: "deny", Kind: "AUTHORIZING", URL: srv.URL + "/deny", FailOpen: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wc := &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{tt.webhook},
+			}
+			start := time.Now()
+			err := wc.Authorize(context.Background(), &webhook.RequestBody{})
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Less(t, time.Since(start), DefaultWebhookTimeout)
+		})
+	}
+}
+
+func TestWebhookController_dryRun(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: false})
+	}))
+	defer srv.Close()
+
+	wc := &WebhookController{
+		client: http.DefaultClient,
+		webhooks: []*Webhook{
+			{Name: "enrich", Kind: "ENRICHING", URL: srv.URL},
+			{Name: "authorize", Kind: "AUTHORIZING", URL: srv.URL},
+		},
+		TemplateData: x509util.TemplateData{},
+	}
+	ctx := NewContextWithDryRun(context.Background())
+	assert.NoError(t, wc.Enrich(ctx, &webhook.RequestBody{}))
+	assert.NoError(t, wc.Authorize(ctx, &webhook.RequestBody{}))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	assert.Error(t, wc.Authorize(context.Background(), &webhook.RequestBody{}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		webhook   *Webhook
+		expectErr bool
+	}{
+		{"ok", &Webhook{Name: "people", Kind: "AUTHORIZING"}, false},
+		{"ok timeout", &Webhook{Name: "people", Kind: "ENRICHING", Timeout: &Duration{Duration: time.Second}}, false},
+		{"ok fail open", &Webhook{Name: "people", Kind: "AUTHORIZING", FailOpen: true}, false},
+		{"fail timeout", &Webhook{Name: "people", Kind: "AUTHORIZING", Timeout: &Duration{}}, true},
+		{"fail fail open", &Webhook{Name: "people", Kind: "ENRICHING", FailOpen: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.webhook.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWebhook_GetTimeout(t *testing.T) {
+	assert.Equal(t, DefaultWebhookTimeout, (&Webhook{}).GetTimeout())
+	assert.Equal(t, time.Second, (&Webhook{Timeout: &Duration{Duration: time.Second}}).GetTimeout())
+}
+
 func TestWebhook_Do(t *testing.T) {
 	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
 	type test struct {
@@ -28,16 +28,29 @@ type x5cPayload struct {
 
 // X5C is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
+//
+// If LeafConstraints is set, only the leaf certificates with the given common
+// name or SANs can sign the tokens used to get new certificates.
+//
+// If ProofOfPossession is set, the X.509 sign tokens must include a nonce
+// issued by the provisioner signed with the key of the CSR.
+//
+// If IntermediateCA is set, the provisioner only issues intermediate CA
+// certificates. It requires the proof of possession of the CSR key.
 type X5C struct {
 	*base
-	ID       string   `json:"-"`
-	Type     string   `json:"type"`
-	Name     string   `json:"name"`
-	Roots    []byte   `json:"roots"`
-	Claims   *Claims  `json:"claims,omitempty"`
-	Options  *Options `json:"options,omitempty"`
-	ctl      *Controller
-	rootPool *x509.CertPool
+	ID                     string                    `json:"-"`
+	Type                   string                    `json:"type"`
+	Name                   string                    `json:"name"`
+	Roots                  []byte                    `json:"roots"`
+	AllowedTokenAlgorithms []string                  `json:"allowedTokenAlgorithms,omitempty"`
+	LeafConstraints        *X5CLeafConstraints       `json:"leafConstraints,omitempty"`
+	ProofOfPossession      *ProofOfPossessionOptions `json:"proofOfPossession,omitempty"`
+	IntermediateCA         *IntermediateCAOptions    `json:"intermediateCA,omitempty"`
+	Claims                 *Claims                   `json:"claims,omitempty"`
+	Options                *Options                  `json:"options,omitempty"`
+	ctl                    *Controller
+	rootPool               *x509.CertPool
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -83,6 +96,16 @@ func (p *X5C) GetType() Type {
 	return TypeX5C
 }
 
+// GetClaimer returns the claimer of the provisioner.
+func (p *X5C) GetClaimer() *Claimer {
+	return p.ctl.GetClaimer()
+}
+
+// GetController returns the controller of the provisioner.
+func (p *X5C) GetController() *Controller {
+	return p.ctl
+}
+
 // GetEncryptedKey returns the base provisioner encrypted key if it's defined.
 func (p *X5C) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
@@ -98,6 +121,21 @@ func (p *X5C) Init(config Config) (err error) {
 	case len(p.Roots) == 0:
 		return errors.New("provisioner root(s) cannot be empty")
 	}
+	if err := validateTokenAlgorithms(p.AllowedTokenAlgorithms); err != nil {
+		return err
+	}
+	if err := p.LeafConstraints.init(); err != nil {
+		return err
+	}
+	if err := p.ProofOfPossession.init(); err != nil {
+		return err
+	}
+	if err := p.IntermediateCA.init(); err != nil {
+		return err
+	}
+	if p.IntermediateCA != nil && p.ProofOfPossession == nil {
+		return errors.New("provisioner intermediateCA requires proofOfPossession")
+	}
 
 	p.rootPool = x509.NewCertPool()
 
@@ -135,7 +173,10 @@ func (p *X5C) Init(config Config) (err error) {
 func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; error parsing x5c token")
+		return nil, authorizeErr(ReasonMalformedToken, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; error parsing x5c token"))
+	}
+	if err := checkTokenAlgorithm(jwt, p.AllowedTokenAlgorithms); err != nil {
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; invalid x5c token"))
 	}
 
 	verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
@@ -143,13 +184,13 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	})
 	if err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err,
-			"x5c.authorizeToken; error verifying x5c certificate chain in token")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err,
+			"x5c.authorizeToken; error verifying x5c certificate chain in token"))
 	}
 	leaf := verifiedChains[0][0]
 
 	if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
-		return nil, errs.Unauthorized("x5c.authorizeToken; certificate used to sign x5c token cannot be used for digital signature")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Unauthorized("x5c.authorizeToken; certificate used to sign x5c token cannot be used for digital signature"))
 	}
 
 	// Using the leaf certificates key to validate the claims accomplishes two
@@ -159,7 +200,7 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 	//   2. Asserts that the claims are valid - have not been tampered with.
 	var claims x5cPayload
 	if err = jwt.Claims(leaf.PublicKey, &claims); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; error parsing x5c claims")
+		return nil, authorizeErr(ReasonInvalidSignature, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; error parsing x5c claims"))
 	}
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
@@ -168,17 +209,17 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		Issuer: p.Name,
 		Time:   time.Now().UTC(),
 	}, time.Minute); err != nil {
-		return nil, errs.Wrapf(http.StatusUnauthorized, err, "x5c.authorizeToken; invalid x5c claims")
+		return nil, authorizeErr(validationReason(err), errs.Wrapf(http.StatusUnauthorized, err, "x5c.authorizeToken; invalid x5c claims"))
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, audiences) {
-		return nil, errs.Unauthorized("x5c.authorizeToken; x5c token has invalid audience "+
-			"claim (aud); expected %s, but got %s", audiences, claims.Audience)
+		return nil, authorizeErr(ReasonInvalidAudience, errs.Unauthorized("x5c.authorizeToken; x5c token has invalid audience "+
+			"claim (aud); expected %s, but got %s", audiences, claims.Audience))
 	}
 
 	if claims.Subject == "" {
-		return nil, errs.Unauthorized("x5c.authorizeToken; x5c token subject cannot be empty")
+		return nil, authorizeErr(ReasonInvalidSubject, errs.Unauthorized("x5c.authorizeToken; x5c token subject cannot be empty"))
 	}
 
 	// Save the verified chains on the x5c payload object.
@@ -193,12 +234,45 @@ func (p *X5C) AuthorizeRevoke(_ context.Context, token string) error {
 	return errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeRevoke")
 }
 
+// NewProofOfPossessionNonce implements ProofOfPossessionNoncer and returns a
+// nonce to prove the possession of the CSR key.
+func (p *X5C) NewProofOfPossessionNonce() (string, time.Time, error) {
+	return p.ProofOfPossession.newNonce()
+}
+
 // AuthorizeSign validates the given token.
 func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
 	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
 	}
+	if err := p.LeafConstraints.Valid(claims.chains[0][0]); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
+	}
+	if err := p.ctl.authorizeConnection(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
+	}
+	if err := p.ctl.allowRequest(ctx, claims.Subject, ""); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
+	}
+
+	// Add the subject alternative names of the SAN resolver.
+	so, err := p.ctl.newSANResolverOptions(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "x5c.AuthorizeSign")
+	}
+	so = append(so, p.ctl.newX509SignOptions()...)
+	so = append(so, p.ctl.newTokenHashOptions(token)...)
+
+	// Require the proof of possession of the CSR key if configured.
+	popOptions, err := p.ProofOfPossession.newOptions(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.AuthorizeSign")
+	}
+	so = append(so, popOptions...)
+
+	// Only issue intermediate CA certificates if configured.
+	so = append(so, p.IntermediateCA.newOptions()...)
 
 	// NOTE: This is for backwards compatibility with older versions of cli
 	// and certificates. Older versions added the token subject as the only SAN
@@ -233,7 +307,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		}
 	}
 
-	return []SignOption{
+	return append(so,
 		self,
 		templateOptions,
 		// modifiers / withOptions
@@ -246,7 +320,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		commonNameValidator(claims.Subject),
 		newDefaultSANsValidator(ctx, claims.SANs),
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		p.ctl.newValidityValidator(),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -254,7 +328,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 			webhook.WithX5CCertificate(x5cLeaf),
 			webhook.WithAuthorizationPrincipal(x5cLeaf.Subject.CommonName),
 		),
-	}, nil
+	), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -272,6 +346,9 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSSHSign")
 	}
+	if err := p.LeafConstraints.Valid(claims.chains[0][0]); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSSHSign")
+	}
 
 	if claims.Step == nil || claims.Step.SSH == nil {
 		return nil, errs.Unauthorized("x5c.AuthorizeSSHSign; x5c token must be an SSH provisioning token")
@@ -295,6 +372,9 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		if certType, err = sshutil.CertTypeFromString(opts.CertType); err != nil {
 			return nil, errs.BadRequestErr(err, err.Error())
 		}
+		if err := p.ctl.sshCertTypes.Allow(certType.String()); err != nil {
+			return nil, err
+		}
 	}
 	if opts.KeyID != "" {
 		keyID = opts.KeyID
@@ -330,6 +410,12 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
 	}
 
+	// Set the extensions and critical options of the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHExtensionsOptions()...)
+
+	// Reject the certificate types not allowed by the provisioner.
+	signOptions = append(signOptions, p.ctl.newSSHCertTypesOptions()...)
+
 	return append(signOptions,
 		p,
 		// Checks the validity bounds, and set the validity if has not been set.
@@ -341,7 +427,7 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser(), p.ctl.sshStrictHostPrincipals),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// X5CLeafConstraints limits the leaf certificates that can sign the tokens of
+// an X5C provisioner, so not every certificate that chains to the roots can
+// enroll.
+//
+// If CommonName is set, the common name of the leaf must match the regular
+// expression, which must match the whole common name. If SANSuffixes is set,
+// the leaf must have at least one SAN and all its DNS names, IP addresses,
+// email addresses and URIs must end with one of the suffixes, e.g.
+// ".internal.example.com" or "@example.com". If both are set, the leaf must
+// satisfy both.
+type X5CLeafConstraints struct {
+	CommonName       string   `json:"commonName,omitempty"`
+	SANSuffixes      []string `json:"sanSuffixes,omitempty"`
+	commonNameRegexp *regexp.Regexp
+}
+
+// init validates and compiles the constraints.
+func (c *X5CLeafConstraints) init() error {
+	if c == nil {
+		return nil
+	}
+	c.commonNameRegexp = nil
+	if c.CommonName != "" {
+		re, err := regexp.Compile("^(?:" + c.CommonName + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "leafConstraints commonName %q is not a valid regular expression", c.CommonName)
+		}
+		c.commonNameRegexp = re
+	}
+	for _, s := range c.SANSuffixes {
+		if strings.TrimSpace(s) == "" {
+			return errors.New("leafConstraints sanSuffixes cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// Valid returns an error if the given leaf certificate does not satisfy the
+// constraints.
+func (c *X5CLeafConstraints) Valid(leaf *x509.Certificate) error {
+	if c == nil {
+		return nil
+	}
+	if c.commonNameRegexp != nil && !c.commonNameRegexp.MatchString(leaf.Subject.CommonName) {
+		return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("x5c certificate common name %q is not allowed", leaf.Subject.CommonName))
+	}
+	if len(c.SANSuffixes) == 0 {
+		return nil
+	}
+
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		sans = append(sans, u.String())
+	}
+	if len(sans) == 0 {
+		return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("x5c certificate does not have any subject alternative name"))
+	}
+	for _, s := range sans {
+		if !hasAnySuffix(s, c.SANSuffixes) {
+			return authorizeErr(ReasonInvalidSubject, errs.Unauthorized("x5c certificate subject alternative name %q is not allowed", s))
+		}
+	}
+	return nil
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	s = strings.ToLower(s)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestX5CLeafConstraints_Valid(t *testing.T) {
+	mustConstraints := func(c *X5CLeafConstraints) *X5CLeafConstraints {
+		if err := c.init(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	leaf := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "web-1"},
+		DNSNames:       []string{"web-1.internal.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"ops@example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/web-1"}},
+	}
+	tests := []struct {
+		name        string
+		constraints *X5CLeafConstraints
+		leaf        *x509.Certificate
+		wantErr     bool
+	}{
+		{"ok nil", nil, leaf, false},
+		{"ok empty", mustConstraints(&X5CLeafConstraints{}), leaf, false},
+		{"ok common name", mustConstraints(&X5CLeafConstraints{CommonName: `web-\d+`}), leaf, false},
+		{"ok san suffixes", mustConstraints(&X5CLeafConstraints{SANSuffixes: []string{".EXAMPLE.com", "example.com", ".0.0.1", "/web-1"}}), leaf, false},
+		{"ok both", mustConstraints(&X5CLeafConstraints{CommonName: "web-.*", SANSuffixes: []string{"example.com", ".1", "/web-1"}}), leaf, false},
+		{"fail common name", mustConstraints(&X5CLeafConstraints{CommonName: "web"}), leaf, true},
+		{"fail dns name", mustConstraints(&X5CLeafConstraints{SANSuffixes: []string{".other.com", ".1", "@example.com", "/web-1"}}), leaf, true},
+		{"fail ip address", mustConstraints(&X5CLeafConstraints{SANSuffixes: []string{"example.com", "/web-1"}}), leaf, true},
+		{"fail uri", mustConstraints(&X5CLeafConstraints{SANSuffixes: []string{"example.com", ".1"}}), leaf, true},
+		{"fail no sans", mustConstraints(&X5CLeafConstraints{SANSuffixes: []string{"example.com"}}), &x509.Certificate{Subject: pkix.Name{CommonName: "web-1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.constraints.Valid(tt.leaf); (err != nil) != tt.wantErr {
+				t.Errorf("X5CLeafConstraints.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
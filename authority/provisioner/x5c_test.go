@@ -86,6 +86,43 @@ func TestX5C_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail/leaf-constraints-common-name": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{CommonName: "leaf-(test"}
+			return ProvisionerValidateTest{
+				p:   p,
+				err: errors.New("leafConstraints commonName \"leaf-(test\" is not a valid regular expression: error parsing regexp: missing closing ): `^(?:leaf-(test)$`"),
+			}
+		},
+		"fail/leaf-constraints-san-suffixes": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{SANSuffixes: []string{".example.com", " "}}
+			return ProvisionerValidateTest{
+				p:   p,
+				err: errors.New("leafConstraints sanSuffixes cannot contain empty values"),
+			}
+		},
+		"fail/intermediate-ca-without-proof-of-possession": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.IntermediateCA = &IntermediateCAOptions{AllowedSubjects: []string{"Intermediate CA"}}
+			return ProvisionerValidateTest{
+				p:   p,
+				err: errors.New("provisioner intermediateCA requires proofOfPossession"),
+			}
+		},
+		"fail/intermediate-ca-allowed-subjects": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.ProofOfPossession = &ProofOfPossessionOptions{}
+			p.IntermediateCA = &IntermediateCAOptions{}
+			return ProvisionerValidateTest{
+				p:   p,
+				err: errors.New("intermediateCA allowedSubjects cannot be empty"),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			p, err := generateX5C(nil)
 			assert.FatalError(t, err)
@@ -93,6 +130,29 @@ func TestX5C_Init(t *testing.T) {
 				p: p,
 			}
 		},
+		"ok/leaf-constraints": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{CommonName: "leaf-.*", SANSuffixes: []string{".example.com"}}
+			return ProvisionerValidateTest{
+				p: p,
+				extraValid: func(p *X5C) error {
+					if p.LeafConstraints.commonNameRegexp == nil {
+						return errors.New("leaf constraints common name regexp is not compiled")
+					}
+					return nil
+				},
+			}
+		},
+		"ok/intermediate-ca": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.ProofOfPossession = &ProofOfPossessionOptions{}
+			p.IntermediateCA = &IntermediateCAOptions{MaxPathLen: 1, AllowedSubjects: []string{"Intermediate CA"}}
+			return ProvisionerValidateTest{
+				p: p,
+			}
+		},
 		"ok/root-chain": func(t *testing.T) ProvisionerValidateTest {
 			p, err := generateX5C([]byte(`-----BEGIN CERTIFICATE-----
 MIIBtjCCAVygAwIBAgIQNr+f4IkABY2n4wx4sLOMrTAKBggqhkjOPQQDAjAUMRIw
@@ -430,6 +490,53 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 				err:   errors.New("x5c.AuthorizeSign: x5c.authorizeToken; error parsing x5c token"),
 			}
 		},
+		"fail/leaf-constraints-common-name": func(t *testing.T) test {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{CommonName: "server-.*"}
+			assert.FatalError(t, p.LeafConstraints.init())
+			tok, err := generateToken("foo", p.GetName(), testAudiences.Sign[0], "",
+				[]string{}, time.Now(), jwk,
+				withX5CHdr(certs))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New(`x5c.AuthorizeSign: x5c certificate common name "leaf-test" is not allowed`),
+			}
+		},
+		"fail/leaf-constraints-san-suffixes": func(t *testing.T) test {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{SANSuffixes: []string{".example.com"}}
+			assert.FatalError(t, p.LeafConstraints.init())
+			tok, err := generateToken("foo", p.GetName(), testAudiences.Sign[0], "",
+				[]string{}, time.Now(), jwk,
+				withX5CHdr(certs))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				code:  http.StatusUnauthorized,
+				err:   errors.New(`x5c.AuthorizeSign: x5c certificate subject alternative name "leaf-test" is not allowed`),
+			}
+		},
+		"ok/leaf-constraints": func(t *testing.T) test {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.LeafConstraints = &X5CLeafConstraints{CommonName: "leaf-.*", SANSuffixes: []string{"-test"}}
+			assert.FatalError(t, p.LeafConstraints.init())
+			tok, err := generateToken("foo", p.GetName(), testAudiences.Sign[0], "",
+				[]string{}, time.Now(), jwk,
+				withX5CHdr(certs))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				sans:  []string{"foo"},
+			}
+		},
 		"ok/empty-sans": func(t *testing.T) test {
 			p, err := generateX5C(nil)
 			assert.FatalError(t, err)
@@ -472,7 +579,7 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Equals(t, 10, len(opts))
+						assert.Equals(t, 15, len(opts))
 						for _, o := range opts {
 							switch v := o.(type) {
 							case *X5C:
@@ -502,6 +609,16 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 								assert.Len(t, 0, v.webhooks)
 								assert.Equals(t, linkedca.Webhook_X509, v.certType)
 								assert.Len(t, 2, v.options)
+							case X509SignerName:
+								assert.Equals(t, "", string(v))
+							case *uniqueSANOption:
+								assert.False(t, v.Enabled)
+							case *signatureAlgorithmOption:
+								assert.Len(t, 0, v.Allowed)
+							case DuplicateDNSNamesPolicy:
+								assert.Equals(t, "", string(v))
+							case X509SerialGenerator:
+								assert.Nil(t, v.SerialGenerator)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
@@ -0,0 +1,47 @@
+package authority
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// provisionerCheckTimeout is the maximum time spent checking the external
+// dependencies of a provisioner.
+const provisionerCheckTimeout = 30 * time.Second
+
+// checkProvisioners verifies the external dependencies of the provisioners
+// that implement the provisioner.Checker interface if the check is
+// configured. On failure, it returns an error if the check is fatal, or logs a
+// warning for each failed provisioner.
+func (a *Authority) checkProvisioners(ctx context.Context) error {
+	if a.config.ProvisionerCheck == nil {
+		return nil
+	}
+
+	for _, p := range a.config.AuthorityConfig.Provisioners {
+		checker, ok := p.(provisioner.Checker)
+		if !ok {
+			continue
+		}
+		if err := checkProvisioner(ctx, checker); err != nil {
+			err = errors.Wrapf(err, "error checking provisioner %q", p.GetName())
+			if a.config.ProvisionerCheck.Fatal {
+				return err
+			}
+			log.Printf("warning: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkProvisioner runs the check of a provisioner with a timeout.
+func checkProvisioner(ctx context.Context, checker provisioner.Checker) error {
+	ctx, cancel := context.WithTimeout(ctx, provisionerCheckTimeout)
+	defer cancel()
+	return checker.Check(ctx)
+}
@@ -0,0 +1,61 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type checkerProvisioner struct {
+	*provisioner.JWK
+	err error
+}
+
+func (p *checkerProvisioner) Check(context.Context) error {
+	return p.err
+}
+
+func TestAuthority_checkProvisioners(t *testing.T) {
+	okProvisioners := provisioner.List{
+		&provisioner.JWK{Name: "jwk"},
+		&checkerProvisioner{JWK: &provisioner.JWK{Name: "ok"}},
+	}
+	failProvisioners := append(provisioner.List{}, okProvisioners[0], &checkerProvisioner{
+		JWK: &provisioner.JWK{Name: "fail"},
+		err: errors.New("key set is not available"),
+	})
+
+	tests := []struct {
+		name         string
+		check        *config.ProvisionerCheckConfig
+		provisioners provisioner.List
+		wantErr      bool
+	}{
+		{"ok disabled", nil, failProvisioners, false},
+		{"ok", &config.ProvisionerCheckConfig{}, okProvisioners, false},
+		{"ok fatal", &config.ProvisionerCheckConfig{Fatal: true}, okProvisioners, false},
+		{"ok warn", &config.ProvisionerCheckConfig{}, failProvisioners, false},
+		{"fail fatal", &config.ProvisionerCheckConfig{Fatal: true}, failProvisioners, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config: &config.Config{
+					ProvisionerCheck: tt.check,
+					AuthorityConfig:  &config.AuthConfig{Provisioners: tt.provisioners},
+				},
+			}
+			err := a.checkProvisioners(context.Background())
+			if tt.wantErr {
+				assert.ErrorContains(t, err, `error checking provisioner "fail"`)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package authority
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -177,6 +178,13 @@ func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, e
 	return p, nil
 }
 
+// hasDNSNamesIndex returns true if the given database can look up certificates
+// by DNS name and the index is enabled.
+func hasDNSNamesIndex(d db.AuthDB) bool {
+	ndb, ok := d.(db.CertificateDNSNameDB)
+	return ok && ndb.HasDNSNamesIndex()
+}
+
 func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.Config, error) {
 	// Merge global and configuration claims
 	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
@@ -197,13 +205,38 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 			UserKeys: sshKeys.UserKeys,
 			HostKeys: sshKeys.HostKeys,
 		},
-		GetIdentityFunc:       a.getIdentityFunc,
-		AuthorizeRenewFunc:    a.authorizeRenewFunc,
-		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
-		WebhookClient:         a.webhookClient,
+		GetIdentityFunc:         a.getIdentityFunc,
+		AuthorizeRenewFunc:      a.authorizeRenewFunc,
+		AuthorizeSSHRenewFunc:   a.authorizeSSHRenewFunc,
+		SANResolver:             a.sanResolver,
+		KeyBlocklist:            a.keyBlocklist,
+		TokenCache:              a.tokenCache,
+		RateLimiter:             a.rateLimiter,
+		SignConcurrencyLimiters: a.signLimiters,
+		EmailCodeStore:          a.emailCodeStore,
+		EmailSender:             a.emailSender,
+		WebhookClient:           a.webhookClient,
+		SecretResolvers:         a.secretResolvers,
+		X509SignerKeys:          a.x509SignerKeys(),
+		X509Roots:               append(append([]*x509.Certificate{}, a.rootX509Certs...), a.federatedX509Certs...),
+		DNSNamesIndex:           hasDNSNamesIndex(a.db),
 	}, nil
 }
 
+// x509SignerKeys returns the public keys of the X.509 signers indexed by
+// name. The key of the default intermediate uses the empty name, and it is
+// not included if the intermediate is not known by the authority.
+func (a *Authority) x509SignerKeys() map[string]crypto.PublicKey {
+	keys := make(map[string]crypto.PublicKey, len(a.x509Signers)+1)
+	if len(a.intermediateX509Certs) > 0 {
+		keys[""] = a.intermediateX509Certs[0].PublicKey
+	}
+	for name, s := range a.x509Signers {
+		keys[name] = s.chain[0].PublicKey
+	}
+	return keys
+}
+
 // StoreProvisioner stores a provisioner to the authority.
 func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisioner) error {
 	a.adminMutex.Lock()
@@ -282,11 +315,9 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 		return err
 	}
 
-	if err := certProv.Init(provisionerConfig); err != nil {
-		return admin.WrapErrorISE(err, "error initializing provisioner %s", nu.Name)
-	}
-
-	if err := a.provisioners.Update(certProv); err != nil {
+	// Initialize the new provisioner and replace the old one atomically, the
+	// old provisioner is kept if the new configuration is not valid.
+	if err := a.provisioners.Reconfigure(certProv, provisionerConfig); err != nil {
 		return admin.WrapErrorISE(err, "error updating provisioner '%s' in authority cache", nu.Name)
 	}
 	if err := a.adminDB.UpdateProvisioner(ctx, nu); err != nil {
@@ -341,6 +372,9 @@ func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
 		}
 		return admin.WrapErrorISE(err, "error deleting provisioner %s", provName)
 	}
+	if err := a.deleteProvisionerFreeze(provID); err != nil {
+		return admin.WrapErrorISE(err, "error deleting freeze of provisioner %s", provName)
+	}
 	return nil
 }
 
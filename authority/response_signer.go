@@ -0,0 +1,159 @@
+package authority
+
+import (
+	"crypto/x509"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// responseSignerCheckInterval is the time a successful signature of the
+// response signer is trusted by CheckResponseSigner.
+const responseSignerCheckInterval = time.Minute
+
+// responseSignerCheckMessage is the message signed by CheckResponseSigner.
+const responseSignerCheckMessage = "step-ca response signer check"
+
+// responseSigner signs the certificate responses requested in the JWS format.
+type responseSigner struct {
+	signer jose.Signer
+	jwk    *jose.JSONWebKey
+	// lastSigned is the time, in unix nanoseconds, of the last successful
+	// signature.
+	lastSigned int64
+}
+
+// initResponseSigner loads the key used to sign the responses and its
+// certificate chain, that must chain to one of the roots of the authority.
+// The key uses the same password as the default intermediate key.
+func (a *Authority) initResponseSigner() error {
+	if a.config.ResponseSigner == nil {
+		return nil
+	}
+
+	chain, err := pemutil.ReadCertificateBundle(a.config.ResponseSigner.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading response signer certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	for _, crt := range a.intermediateX509Certs {
+		intermediates.AddCert(crt)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         a.rootX509CertPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying response signer certificate")
+	}
+
+	signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.ResponseSigner.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating response signer")
+	}
+	x5c, err := jose.ValidateX5C(chain, signer)
+	if err != nil {
+		return errors.Wrap(err, "error creating response signer: key does not match the certificate")
+	}
+
+	opaque := jose.NewOpaqueSigner(signer)
+	algs := opaque.Algs()
+	if len(algs) == 0 {
+		return errors.New("error creating response signer: unsupported key type")
+	}
+	jwk := opaque.Public()
+	if jwk.KeyID, err = jose.Thumbprint(jwk); err != nil {
+		return errors.Wrap(err, "error creating response signer")
+	}
+	jwk.Algorithm = string(algs[0])
+	jwk.Use = "sig"
+	jwk.Certificates = chain
+
+	so := new(jose.SignerOptions).WithType("JOSE").
+		WithHeader("kid", jwk.KeyID).
+		WithHeader("x5c", x5c)
+	js, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: algs[0],
+		Key:       opaque,
+	}, so)
+	if err != nil {
+		return errors.Wrap(err, "error creating response signer")
+	}
+
+	a.responseSigner = &responseSigner{
+		signer: js,
+		jwk:    jwk,
+	}
+	return nil
+}
+
+// GetResponseSigningKeys returns the public keys used to sign the certificate
+// responses requested in the JWS format, with their certificate chains. It
+// returns nil if the response signer is not configured.
+func (a *Authority) GetResponseSigningKeys() *jose.JSONWebKeySet {
+	if a.responseSigner == nil {
+		return nil
+	}
+	return &jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{*a.responseSigner.jwk},
+	}
+}
+
+// CheckResponseSigner returns an error if the response signer cannot sign. It
+// is used before signing a certificate requested in the JWS format, so the
+// certificate is not issued if the response cannot be signed. The check signs
+// a test message unless the signer has signed in the last minute.
+func (a *Authority) CheckResponseSigner() error {
+	r := a.responseSigner
+	if r == nil {
+		return errs.NotImplemented("authority.CheckResponseSigner; response signer is not configured")
+	}
+	if time.Since(time.Unix(0, atomic.LoadInt64(&r.lastSigned))) < responseSignerCheckInterval {
+		return nil
+	}
+	if _, err := r.sign([]byte(responseSignerCheckMessage)); err != nil {
+		return errs.Wrap(http.StatusServiceUnavailable, err, "authority.CheckResponseSigner; response signer is not available")
+	}
+	return nil
+}
+
+// SignResponse signs the given payload with the response signer and returns
+// it as a JWS in the compact serialization.
+func (a *Authority) SignResponse(payload []byte) (string, error) {
+	if a.responseSigner == nil {
+		return "", errs.NotImplemented("authority.SignResponse; response signer is not configured")
+	}
+	jws, err := a.responseSigner.sign(payload)
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.SignResponse; error signing response")
+	}
+	raw, err := jws.CompactSerialize()
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.SignResponse; error serializing response")
+	}
+	return raw, nil
+}
+
+// sign signs the payload and records the time of the signature.
+func (r *responseSigner) sign(payload []byte) (*jose.JSONWebSignature, error) {
+	jws, err := r.signer.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&r.lastSigned, time.Now().UnixNano())
+	return jws, nil
+}
@@ -0,0 +1,174 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/softkms"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// newResponseSignerCertificate creates a certificate for the given key issued
+// by the ca and returns the path of the bundle with the intermediate.
+func newResponseSignerCertificate(t *testing.T, ca *minica.CA, pub crypto.PublicKey) string {
+	t.Helper()
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Response Signer"},
+		PublicKey: pub,
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	})
+	require.NoError(t, err)
+
+	certFile := filepath.Join(t.TempDir(), "response.crt")
+	b := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})...)
+	require.NoError(t, os.WriteFile(certFile, b, 0600))
+	return certFile
+}
+
+func TestAuthority_SignResponse(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	ecSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	_, edSigner, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey := filepath.Join(dir, "ec.key")
+	_, err = pemutil.Serialize(ecSigner, pemutil.ToFile(ecKey, 0600))
+	require.NoError(t, err)
+	edKey := filepath.Join(dir, "ed.key")
+	_, err = pemutil.Serialize(edSigner, pemutil.ToFile(edKey, 0600))
+	require.NoError(t, err)
+
+	ecCert := newResponseSignerCertificate(t, ca, ecSigner.Public())
+	edCert := newResponseSignerCertificate(t, ca, edSigner.Public())
+	otherCert := newResponseSignerCertificate(t, other, ecSigner.Public())
+
+	km, err := softkms.New(context.Background(), kmsapi.Options{})
+	require.NoError(t, err)
+
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(ca.Root)
+
+	tests := []struct {
+		name     string
+		config   *config.ResponseSignerConfig
+		wantAlg  string
+		wantKeys bool
+		wantErr  bool
+	}{
+		{"ok ec", &config.ResponseSignerConfig{Certificate: ecCert, Key: ecKey}, jose.ES256, true, false},
+		{"ok ed25519", &config.ResponseSignerConfig{Certificate: edCert, Key: edKey}, jose.EdDSA, true, false},
+		{"ok not configured", nil, "", false, false},
+		{"fail missing key", &config.ResponseSignerConfig{Certificate: ecCert, Key: filepath.Join(dir, "missing.key")}, "", false, true},
+		{"fail missing certificate", &config.ResponseSignerConfig{Certificate: filepath.Join(dir, "missing.crt"), Key: ecKey}, "", false, true},
+		{"fail other root", &config.ResponseSignerConfig{Certificate: otherCert, Key: ecKey}, "", false, true},
+		{"fail key mismatch", &config.ResponseSignerConfig{Certificate: ecCert, Key: edKey}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config:                &config.Config{ResponseSigner: tt.config},
+				keyManager:            km,
+				rootX509CertPool:      rootPool,
+				intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+			}
+			err := a.initResponseSigner()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, a.GetResponseSigningKeys())
+				return
+			}
+			require.NoError(t, err)
+
+			keys := a.GetResponseSigningKeys()
+			if !tt.wantKeys {
+				assert.Nil(t, keys)
+				assert.Error(t, a.CheckResponseSigner())
+				_, err := a.SignResponse([]byte(`{"foo":"bar"}`))
+				assert.Error(t, err)
+				return
+			}
+			require.Len(t, keys.Keys, 1)
+			jwk := keys.Keys[0]
+			assert.True(t, jwk.IsPublic())
+			assert.Equal(t, tt.wantAlg, jwk.Algorithm)
+			assert.Equal(t, "sig", jwk.Use)
+			require.Len(t, jwk.Certificates, 2)
+			assert.Equal(t, ca.Intermediate, jwk.Certificates[1])
+			assert.NoError(t, a.CheckResponseSigner())
+
+			raw, err := a.SignResponse([]byte(`{"foo":"bar"}`))
+			require.NoError(t, err)
+			jws, err := jose.ParseJWS(raw)
+			require.NoError(t, err)
+			require.Len(t, jws.Signatures, 1)
+			assert.Equal(t, jwk.KeyID, jws.Signatures[0].Header.KeyID)
+			chains, err := jws.Signatures[0].Header.Certificates(x509.VerifyOptions{
+				Roots:     rootPool,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, jwk.Certificates[0], chains[0][0])
+			payload, err := jws.Verify(jwk)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(`{"foo":"bar"}`), payload)
+		})
+	}
+}
+
+func TestAuthority_CheckResponseSigner(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	js, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signer}, nil)
+	require.NoError(t, err)
+	failing, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key:       jose.NewOpaqueSigner(&flakySigner{Signer: signer}),
+	}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		signer  *responseSigner
+		wantErr bool
+	}{
+		{"ok", &responseSigner{signer: js}, false},
+		{"ok recently signed", &responseSigner{signer: failing, lastSigned: time.Now().UnixNano()}, false},
+		{"fail not configured", nil, true},
+		{"fail signer unavailable", &responseSigner{signer: failing}, true},
+		{"fail signed long ago", &responseSigner{signer: failing, lastSigned: time.Now().Add(-2 * responseSignerCheckInterval).UnixNano()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{responseSigner: tt.signer}
+			err := a.CheckResponseSigner()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
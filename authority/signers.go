@@ -0,0 +1,127 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/internal/constraints"
+	"github.com/smallstep/certificates/cas"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+// x509Signer is a named X.509 signer that provisioners can use instead of the
+// default CAS.
+type x509Signer struct {
+	name              string
+	chain             []*x509.Certificate
+	service           cas.CertificateAuthorityService
+	constraintsEngine *constraints.Engine
+}
+
+// initX509Signers loads the named signers in the configuration. All signers
+// use the same password as the default intermediate key.
+func (a *Authority) initX509Signers(ctx context.Context) error {
+	if len(a.config.Signers) == 0 {
+		return nil
+	}
+
+	a.x509Signers = make(map[string]*x509Signer, len(a.config.Signers))
+	for _, sc := range a.config.Signers {
+		chain, err := pemutil.ReadCertificateBundle(sc.IntermediateCert)
+		if err != nil {
+			return err
+		}
+		signer, err := a.createSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: sc.IntermediateKey,
+			Password:   a.password,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error creating signer %q", sc.Name)
+		}
+		svc, err := cas.New(ctx, casapi.Options{
+			Type:             casapi.SoftCAS,
+			CertificateChain: chain,
+			Signer:           signer,
+			KeyManager:       a.keyManager,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error creating signer %q", sc.Name)
+		}
+
+		// Use the signer chain and the root that signed it for name
+		// constraints validation.
+		constraintCerts := append([]*x509.Certificate{}, chain...)
+		last := chain[len(chain)-1]
+		for _, root := range a.rootX509Certs {
+			if bytes.Equal(last.RawIssuer, root.RawSubject) && bytes.Equal(last.AuthorityKeyId, root.SubjectKeyId) {
+				constraintCerts = append(constraintCerts, root)
+			}
+		}
+
+		a.x509Signers[sc.Name] = &x509Signer{
+			name:              sc.Name,
+			chain:             chain,
+			service:           svc,
+			constraintsEngine: constraints.New(constraintCerts...),
+		}
+	}
+
+	return nil
+}
+
+// getX509Signer returns the CAS, the constraints engine and the issuer
+// certificate used to sign a certificate with the named signer. An empty name
+// returns the default ones. The default issuer might be nil if it's not known by
+// the authority.
+func (a *Authority) getX509Signer(name string) (cas.CertificateAuthorityService, *constraints.Engine, *x509.Certificate, error) {
+	if name == "" {
+		var issuer *x509.Certificate
+		if len(a.intermediateX509Certs) > 0 {
+			issuer = a.intermediateX509Certs[0]
+		}
+		return a.x509CAService, a.constraintsEngine, issuer, nil
+	}
+	s, ok := a.x509Signers[name]
+	if !ok {
+		return nil, nil, nil, errs.InternalServer("authority.Sign; signer %q is not configured", name)
+	}
+	return s.service, s.constraintsEngine, s.chain[0], nil
+}
+
+// getX509ChainByIssuer returns the chain of the signer that issued the given
+// certificate, without the certificate. If the certificate was not issued by a
+// named signer it returns the default intermediates.
+func (a *Authority) getX509ChainByIssuer(cert *x509.Certificate) []*x509.Certificate {
+	for _, s := range a.x509Signers {
+		issuer := s.chain[0]
+		if bytes.Equal(cert.RawIssuer, issuer.RawSubject) && bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+			return s.chain
+		}
+	}
+	return a.intermediateX509Certs
+}
+
+// getX509SignerByIssuer returns the CAS, the constraints engine and the issuer
+// certificate of the named signer that issued the given certificate. If the
+// certificate was not issued by a named signer it returns the default ones.
+// The default issuer might be nil if it's not known by the authority.
+func (a *Authority) getX509SignerByIssuer(cert *x509.Certificate) (cas.CertificateAuthorityService, *constraints.Engine, *x509.Certificate) {
+	for _, s := range a.x509Signers {
+		issuer := s.chain[0]
+		if bytes.Equal(cert.RawIssuer, issuer.RawSubject) && bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+			return s.service, s.constraintsEngine, issuer
+		}
+	}
+	var issuer *x509.Certificate
+	if len(a.intermediateX509Certs) > 0 {
+		issuer = a.intermediateX509Certs[0]
+	}
+	return a.x509CAService, a.constraintsEngine, issuer
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/binary"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -147,7 +148,10 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*
 
 // SignSSH creates a signed SSH certificate with the given public key and options.
 func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	ctx, span := a.startSpan(ctx, "authority.SignSSH")
 	cert, prov, err := a.signSSH(ctx, key, opts, signOpts...)
+	setSpanProvisioner(span, prov)
+	endSpan(span, err)
 	a.meter.SSHSigned(prov, err)
 	return cert, err
 }
@@ -202,6 +206,11 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 	}
 
+	// Check if the provisioner is allowed to issue SSH certificates.
+	if err := a.isProvisionerAllowedToSignSSH(prov); err != nil {
+		return nil, prov, err
+	}
+
 	// Simulated certificate request with request options.
 	cr := sshutil.CertificateRequest{
 		Type:       opts.CertType,
@@ -273,7 +282,10 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	}
 
 	// Check if authority is allowed to sign the certificate
-	if err := a.isAllowedToSignSSHCertificate(certTpl); err != nil {
+	_, pspan := a.startSpan(ctx, "authority.isAllowedToSignSSHCertificate")
+	err = a.isAllowedToSignSSHCertificate(prov, certTpl)
+	endSpan(pspan, err)
+	if err != nil {
 		var ee *errs.Error
 		if errors.As(err, &ee) {
 			return nil, prov, ee
@@ -291,7 +303,9 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	}
 
 	// Sign certificate.
+	_, cspan := a.startSpan(ctx, "authority.createCertificate")
 	cert, err := sshutil.CreateCertificate(certTpl, signer)
+	endSpan(cspan, err)
 	if err != nil {
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error signing certificate")
 	}
@@ -310,9 +324,33 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	return cert, prov, nil
 }
 
-// isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the SSH certificate.
-func (a *Authority) isAllowedToSignSSHCertificate(cert *ssh.Certificate) error {
-	return a.policyEngine.IsSSHCertificateAllowed(cert)
+// isProvisionerAllowedToSignSSH returns an error if the authority restricts the
+// provisioners that can issue SSH certificates, and the given one is not one of
+// them.
+func (a *Authority) isProvisionerAllowedToSignSSH(prov provisioner.Interface) error {
+	var name string
+	if prov != nil {
+		name = prov.GetName()
+	}
+	if !a.config.SSH.IsProvisionerAllowed(name) {
+		return errs.Forbidden("SSH not permitted for provisioner %q", name)
+	}
+	return nil
+}
+
+// isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the
+// SSH certificate. If the SSH policy is in shadow mode, a denial is only logged
+// and recorded.
+func (a *Authority) isAllowedToSignSSHCertificate(prov provisioner.Interface, cert *ssh.Certificate) error {
+	err := a.policyEngine.IsSSHCertificateAllowed(cert)
+	if a.policyEngine.IsSSHShadow() {
+		a.meter.SSHPolicyShadowed(prov, err)
+		if err != nil {
+			log.Printf("ssh policy in shadow mode would have denied the certificate for %q: %v", cert.KeyId, err)
+		}
+		return nil
+	}
+	return err
 }
 
 // RenewSSH creates a signed SSH certificate using the old SSH certificate as a template.
@@ -337,6 +375,11 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		prov, _, _ = a.getProvisionerFromToken(token)
 	}
 
+	// Check if the provisioner is allowed to issue SSH certificates.
+	if err := a.isProvisionerAllowedToSignSSH(prov); err != nil {
+		return nil, prov, err
+	}
+
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := time.Duration(oldCert.ValidBefore-oldCert.ValidAfter) * time.Second
 	now := time.Now()
@@ -409,6 +452,11 @@ func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		}
 	}
 
+	// Check if the provisioner is allowed to issue SSH certificates.
+	if err := a.isProvisionerAllowedToSignSSH(prov); err != nil {
+		return nil, prov, err
+	}
+
 	if oldCert.ValidAfter == 0 || oldCert.ValidBefore == 0 {
 		return nil, prov, errs.BadRequest("cannot rekey a certificate without validity period")
 	}
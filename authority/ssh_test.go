@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/sshutil"
 	"golang.org/x/crypto/ssh"
@@ -317,6 +318,58 @@ func TestAuthority_SignSSH(t *testing.T) {
 	}
 }
 
+func TestAuthority_SignSSH_allowedProvisioners(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	require.NoError(t, err)
+
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", nil))
+	require.NoError(t, err)
+
+	allowed := &provisioner.JWK{Name: "ssh-allowed"}
+	denied := &provisioner.JWK{Name: "ssh-denied"}
+
+	tests := []struct {
+		name                string
+		allowedProvisioners []string
+		prov                provisioner.Interface
+		wantErr             string
+	}{
+		{"ok no restrictions", nil, denied, ""},
+		{"ok allowed", []string{"ssh-allowed"}, allowed, ""},
+		{"fail denied", []string{"ssh-allowed"}, denied, `SSH not permitted for provisioner "ssh-denied"`},
+		{"fail no provisioner", []string{"ssh-allowed"}, nil, `SSH not permitted for provisioner ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.config.SSH = &SSHConfig{AllowedProvisioners: tt.allowedProvisioners}
+
+			signOpts := []provisioner.SignOption{userTemplate, sshTestModifier{CertType: ssh.UserCert}}
+			if tt.prov != nil {
+				signOpts = append(signOpts, tt.prov)
+			}
+			got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{}, signOpts...)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				require.Equal(t, http.StatusForbidden, sc.StatusCode())
+				require.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, got)
+		})
+	}
+}
+
 func TestAuthority_SignSSHAddUser(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -724,6 +777,8 @@ func TestSSHConfig_Validate(t *testing.T) {
 		{"ok", &SSHConfig{Keys: []*SSHPublicKey{{Type: "host", Key: key.Public()}}}, false},
 		{"badType", &SSHConfig{Keys: []*SSHPublicKey{{Type: "bad", Key: key.Public()}}}, true},
 		{"badKey", &SSHConfig{Keys: []*SSHPublicKey{{Type: "user", Key: *key}}}, true},
+		{"ok allowedProvisioners", &SSHConfig{AllowedProvisioners: []string{"ssh"}}, false},
+		{"badAllowedProvisioners", &SSHConfig{AllowedProvisioners: []string{""}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3,14 +3,18 @@ package authority
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"math/big"
 	"net"
 	"net/http"
@@ -18,6 +22,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
@@ -26,6 +31,7 @@ import (
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/internal/constraints"
 	"github.com/smallstep/certificates/authority/provisioner"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
@@ -56,6 +62,7 @@ var (
 	oidAuthorityKeyIdentifier            = asn1.ObjectIdentifier{2, 5, 29, 35}
 	oidSubjectKeyIdentifier              = asn1.ObjectIdentifier{2, 5, 29, 14}
 	oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+	oidSCTList                           = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
 )
 
 func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
@@ -102,12 +109,90 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 // SignWithContext creates a signed certificate from a certificate signing
 // request, taking the provided context.Context.
 func (a *Authority) SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
-	chain, prov, err := a.signX509(ctx, csr, signOpts, extraOpts...)
+	ctx, span := a.startSpan(ctx, "authority.Sign")
+	chain, prov, err := a.signX509(ctx, csr, signOpts, false, extraOpts...)
+	setSpanProvisioner(span, prov)
+	endSpan(span, err)
 	a.meter.X509Signed(prov, err)
 	return chain, err
 }
 
-func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, provisioner.Interface, error) {
+// maxTokenPreviews is the number of times a token can be used to preview a
+// certificate before the previews are rate limited.
+const maxTokenPreviews = 5
+
+// tokenPreviewsPerSecond is the rate at which the previews of a token are
+// allowed after the first maxTokenPreviews, one per minute.
+const tokenPreviewsPerSecond = 1.0 / 60
+
+// PreviewSign returns the certificate that would be issued for the given token
+// and certificate request, without signing it. It runs the same authorization,
+// templates, modifiers and validations than a sign request in a dry run, but
+// the token is not marked as used and nothing is stored. Instead, the number
+// of previews of a token is rate limited. The returned certificate does not
+// have the fields set when it's signed, like the serial number, the issuer or
+// the authority key identifier.
+func (a *Authority) PreviewSign(ctx context.Context, token string, csr *x509.CertificateRequest, signOpts provisioner.SignOptions) (*x509.Certificate, error) {
+	var opts = []interface{}{errs.WithKeyVal("token", token)}
+
+	ctx = NewContextWithSkipTokenReuse(ctx)
+	ctx = provisioner.NewContextWithDryRun(ctx)
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	extraOpts, err := a.authorizeSign(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.PreviewSign", opts...)
+	}
+	if err := a.allowTokenPreview(token); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PreviewSign", opts...)
+	}
+
+	chain, _, err := a.signX509(ctx, csr, signOpts, true, extraOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return chain[0], nil
+}
+
+// checkKeyBlocklist returns a 403 error if the given public key is in the key
+// blocklist of the authority.
+func (a *Authority) checkKeyBlocklist(pub crypto.PublicKey) error {
+	if a.keyBlocklist == nil {
+		return nil
+	}
+	fp, err := provisioner.KeyFingerprint(pub)
+	if err != nil {
+		return errs.BadRequestErr(err, "certificate public key is not valid")
+	}
+	blocked, err := a.keyBlocklist.IsBlocked(fp)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error checking the key blocklist")
+	}
+	if blocked {
+		return errs.Forbidden("certificate public key is in the key blocklist")
+	}
+	return nil
+}
+
+// allowTokenPreview returns a 429 error if the token has been used to preview
+// too many certificates.
+func (a *Authority) allowTokenPreview(token string) error {
+	if a.previewLimiter == nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(token))
+	ok, err := a.previewLimiter.Allow("preview."+hex.EncodeToString(sum[:]), tokenPreviewsPerSecond, maxTokenPreviews)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error using rate limiter")
+	}
+	if !ok {
+		return errs.New(http.StatusTooManyRequests, "too many previews with the same token")
+	}
+	return nil
+}
+
+// signX509 creates a signed certificate from a certificate signing request. If
+// preview is true, it returns the unsigned certificate right before signing it.
+func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, preview bool, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, provisioner.Interface, error) {
 	var (
 		certOptions    []x509util.Option
 		certValidators []provisioner.CertificateValidator
@@ -131,6 +216,14 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		pInfo      *casapi.ProvisionerInfo
 		attData    *provisioner.AttestationData
 		webhookCtl webhookController
+		signerName string
+		signers    provisioner.X509AllowedSigners
+		duplicates provisioner.DuplicateDNSNamesPolicy
+		serialGen  provisioner.SerialGenerator
+		altChain   provisioner.X509AlternateChain
+		ctLogs     *provisioner.X509CertificateTransparency
+		limiter    *provisioner.ConcurrencyLimiter
+		allowCA    bool
 	)
 	for _, op := range extraOpts {
 		switch k := op.(type) {
@@ -142,6 +235,23 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 				Type: prov.GetType().String(),
 				Name: prov.GetName(),
 			}
+			// Reject oversized certificate requests before doing any other
+			// work with them.
+			var claimer *provisioner.Claimer
+			if cg, ok := k.(provisioner.ClaimerGetter); ok {
+				claimer = cg.GetClaimer()
+			}
+			// Reject the requests of frozen provisioners, e.g. ACME or SCEP
+			// requests that are not authorized with a token.
+			if err := a.checkProvisionerFreeze(prov, false); err != nil {
+				return nil, prov, errs.ApplyOptions(err, opts...)
+			}
+			if err := provisioner.NewCSRLimitsValidator(claimer).Valid(csr); err != nil {
+				return nil, prov, errs.ApplyOptions(
+					errs.ForbiddenErr(err, "error validating certificate request"),
+					opts...,
+				)
+			}
 		// Adds new options to NewCertificate
 		case provisioner.CertificateOptions:
 			certOptions = append(certOptions, k.Options(signOpts)...)
@@ -163,6 +273,11 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		case provisioner.CertificateModifier:
 			certModifiers = append(certModifiers, k)
 
+		// Allows CA certificates and enforces their constraints.
+		case provisioner.X509IntermediateCA:
+			allowCA = true
+			certEnforcers = append(certEnforcers, k)
+
 		// Modifies a certificate after validating it.
 		case provisioner.CertificateEnforcer:
 			certEnforcers = append(certEnforcers, k)
@@ -175,11 +290,65 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		case webhookController:
 			webhookCtl = k
 
+		// Capture the named signer used to sign the certificate.
+		case provisioner.X509SignerName:
+			signerName = string(k)
+
+		// Capture the named signers that the request can select.
+		case provisioner.X509AllowedSigners:
+			signers = k
+
+		// Capture the backdate configured in the provisioner.
+		case provisioner.X509Backdate:
+			signOpts.Backdate = time.Duration(k)
+
+		// Capture the policy for DNS names in other active certificates.
+		case provisioner.DuplicateDNSNamesPolicy:
+			duplicates = k
+
+		// Capture the generator of serial numbers of the provisioner.
+		case provisioner.X509SerialGenerator:
+			serialGen = k.SerialGenerator
+
+		// Capture the alternate chain configured in the provisioner.
+		case provisioner.X509AlternateChain:
+			altChain = k
+
+		// Capture the CT logs where the precertificates are submitted.
+		case *provisioner.X509CertificateTransparency:
+			ctLogs = k
+
+		// Capture the limit of concurrent sign operations of the provisioner.
+		case *provisioner.ConcurrencyLimiter:
+			limiter = k
+
 		default:
 			return nil, prov, errs.InternalServer("authority.Sign; invalid extra option type %T", append([]any{k}, opts...)...)
 		}
 	}
 
+	// Only the provisioners of intermediate CAs can sign CA certificates.
+	if !allowCA && provisioner.IsCACertificateRequest(csr) {
+		return nil, prov, errs.ApplyOptions(
+			errs.Forbidden("certificate request for a CA certificate is not allowed"),
+			opts...,
+		)
+	}
+
+	// Use the signer selected by the request if the provisioner allows it.
+	if signOpts.Signer != "" && signOpts.Signer != signerName {
+		if !signers.Allows(signOpts.Signer) {
+			return nil, prov, errs.Forbidden("authority.Sign; signer %q is not allowed by the provisioner",
+				append([]any{signOpts.Signer}, opts...)...)
+		}
+		signerName = signOpts.Signer
+	}
+
+	x509CAService, constraintsEngine, issuer, err := a.getX509Signer(signerName)
+	if err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
 	if err := a.callEnrichingWebhooksX509(ctx, prov, webhookCtl, attData, csr); err != nil {
 		return nil, prov, errs.ApplyOptions(
 			errs.ForbiddenErr(err, err.Error()),
@@ -221,6 +390,18 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Set default CRL distribution points
+	if len(leaf.CRLDistributionPoints) == 0 {
+		leaf.CRLDistributionPoints = a.config.CRL.GetDistributionPoints()
+	}
+
+	// Set default OCSP server
+	if len(leaf.OCSPServer) == 0 {
+		if u := a.config.OCSP.GetURL(); u != "" {
+			leaf.OCSPServer = []string{u}
+		}
+	}
+
 	for _, m := range certModifiers {
 		if err := m.Modify(leaf, signOpts); err != nil {
 			return nil, prov, errs.ApplyOptions(
@@ -230,16 +411,22 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
-	// Certificate validation.
+	// Certificate validation. Validators might clamp the validity of the
+	// certificate.
+	notAfter := leaf.NotAfter
 	for _, v := range certValidators {
 		if err := v.Valid(leaf, signOpts); err != nil {
 			return nil, prov, errs.ApplyOptions(
 				errs.ForbiddenErr(err, "error validating certificate"),
-				opts...,
+				append(opts, withPolicyViolations(err))...,
 			)
 		}
 	}
 
+	if !leaf.NotAfter.Equal(notAfter) {
+		addWarning(ctx, "certificate validity was clamped to %v", leaf.NotAfter.Sub(leaf.NotBefore))
+	}
+
 	// Certificate modifiers after validation
 	for _, m := range certEnforcers {
 		if err = m.Enforce(leaf); err != nil {
@@ -260,8 +447,20 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
+	// The template of a provisioner cannot turn a certificate request into a
+	// CA certificate either.
+	if !allowCA && provisioner.IsCACertificate(leaf) {
+		return nil, prov, errs.ApplyOptions(
+			errs.Forbidden("certificate template for a CA certificate is not allowed"),
+			opts...,
+		)
+	}
+
 	// Check if authority is allowed to sign the certificate
-	if err = a.isAllowedToSignX509Certificate(leaf); err != nil {
+	pctx, pspan := a.startSpan(ctx, "authority.isAllowedToSignX509Certificate")
+	err = a.isAllowedToSignX509Certificate(pctx, prov, constraintsEngine, leaf)
+	endSpan(pspan, err)
+	if err != nil {
 		var ee *errs.Error
 		if errors.As(err, &ee) {
 			return nil, prov, errs.ApplyOptions(ee, opts...)
@@ -281,19 +480,96 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Look for other active certificates with the same DNS names
+	var duplicateCerts []*x509.Certificate
+	if duplicates != "" {
+		if duplicateCerts, err = a.getDuplicateDNSNamesCertificates(leaf); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+		}
+		if len(duplicateCerts) > 0 && duplicates == provisioner.DuplicateDNSNamesReject {
+			return nil, prov, errs.Forbidden("authority.Sign; certificate with serial number '%s' already has the requested DNS names",
+				append([]any{duplicateCerts[0].SerialNumber.String()}, opts...)...)
+		}
+	}
+
+	// Set serial number if the provisioner has a generator or if the authority
+	// is configured with a custom length
+	switch {
+	case preview:
+		// Serial numbers are only assigned to signed certificates.
+	case serialGen != nil:
+		if err := a.setGeneratedSerialNumber(leaf, serialGen); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+		}
+	default:
+		if err := a.setSerialNumber(leaf); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+		}
+	}
+
+	// Reference the key of the actual issuer, so the chain can be built by
+	// clients with multiple intermediates, even if the template sets
+	// another one.
+	if issuer != nil && len(issuer.SubjectKeyId) > 0 {
+		leaf.AuthorityKeyId = issuer.SubjectKeyId
+	}
+
+	// Check that the certificate does not outlive its issuer
+	if issuer != nil && leaf.NotAfter.After(issuer.NotAfter) {
+		return nil, prov, errs.Forbidden("authority.Sign; requested duration exceeds the remaining validity of the issuer, expires at %s",
+			append([]any{issuer.NotAfter.UTC().Format(time.RFC3339)}, opts...)...)
+	}
+
+	// Check that the certificate is not valid before its issuer
+	if err := checkIssuerNotBefore(leaf, issuer, signOpts); err != nil {
+		return nil, prov, errs.Wrap(http.StatusForbidden, err, "authority.Sign", opts...)
+	}
+
+	// Return the certificate that would be signed
+	if preview {
+		return []*x509.Certificate{leaf}, prov, nil
+	}
+
+	// Wait for a free slot in the authority and the provisioner.
+	release, err := a.acquireSignSlot(ctx, prov, limiter)
+	if err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+	defer release()
+
 	// Sign certificate
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
+	createCertificate := func(template *x509.Certificate) (*casapi.CreateCertificateResponse, error) {
+		_, cspan := a.startSpan(ctx, "authority.createCertificate")
+		resp, err := x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+			Template:    template,
+			CSR:         csr,
+			Lifetime:    lifetime,
+			Backdate:    signOpts.Backdate,
+			Provisioner: pInfo,
+		})
+		endSpan(cspan, err)
+		return resp, err
+	}
 
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
-		Template:    leaf,
-		CSR:         csr,
-		Lifetime:    lifetime,
-		Backdate:    signOpts.Backdate,
-		Provisioner: pInfo,
-	})
+	// Embed the SCTs of a precertificate if the provisioner submits them to
+	// certificate transparency logs.
+	var precert *x509.Certificate
+	if ctLogs != nil {
+		if precert, err = a.addSCTs(ctx, ctLogs, leaf, createCertificate); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error submitting precertificate", opts...)
+		}
+	}
+
+	resp, err := createCertificate(leaf)
 	if err != nil {
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
 	}
+	if precert != nil {
+		if err := ctLogs.CheckPrecertificate(resp.Certificate, precert); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
+		}
+	}
 
 	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
 
@@ -307,21 +583,175 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error storing certificate in db", opts...)
 	}
 
+	// Revoke the certificates replaced by the new one.
+	if duplicates == provisioner.DuplicateDNSNamesRevoke {
+		a.revokeSuperseded(ctx, duplicateCerts)
+	}
+
+	// Return the alternate chain if it has been requested.
+	if signOpts.AlternateChain {
+		if selected, ok := altChain.Select(chain); ok {
+			chain = selected
+		} else if len(altChain) == 0 {
+			addWarning(ctx, "provisioner does not have an alternate chain")
+		} else {
+			addWarning(ctx, "alternate chain does not match the issuer of the certificate")
+		}
+	}
+
 	return chain, prov, nil
 }
 
+// addSCTs signs a precertificate of the given template, submits it to the CT
+// logs, and adds the extension with the returned SCTs to the template. It
+// returns the signed precertificate. If the logs do not return enough SCTs the
+// template is left without them if the provisioner fails open, with a warning,
+// or an error is returned otherwise.
+func (a *Authority) addSCTs(ctx context.Context, ctLogs *provisioner.X509CertificateTransparency, leaf *x509.Certificate, createCertificate func(*x509.Certificate) (*casapi.CreateCertificateResponse, error)) (*x509.Certificate, error) {
+	template := ctLogs.NewPrecertificate(leaf)
+	resp, err := createCertificate(template)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating precertificate")
+	}
+
+	// The CAS might set the serial number, validity, and key identifier of
+	// the precertificate, the certificate must have the same ones.
+	leaf.SerialNumber = resp.Certificate.SerialNumber
+	leaf.NotBefore, leaf.NotAfter = resp.Certificate.NotBefore, resp.Certificate.NotAfter
+	leaf.SubjectKeyId = resp.Certificate.SubjectKeyId
+
+	ext, err := ctLogs.Submit(ctx, append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...))
+	if err != nil {
+		if !ctLogs.FailOpen() {
+			return nil, err
+		}
+		addWarning(ctx, "%v", err)
+	}
+	if ext != nil {
+		leaf.ExtraExtensions = append(leaf.ExtraExtensions, *ext)
+	}
+	return resp.Certificate, nil
+}
+
+// getDuplicateDNSNamesCertificates returns the active certificates that have
+// any of the DNS names in the given certificate. It only works if the database
+// keeps an index of DNS names.
+func (a *Authority) getDuplicateDNSNamesCertificates(leaf *x509.Certificate) ([]*x509.Certificate, error) {
+	ndb, ok := a.db.(db.CertificateDNSNameDB)
+	if !ok || !ndb.HasDNSNamesIndex() {
+		return nil, nil
+	}
+
+	var certs []*x509.Certificate
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, name := range leaf.DNSNames {
+		crts, err := ndb.GetCertificatesByDNSName(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, crt := range crts {
+			if now.After(crt.NotAfter) {
+				continue
+			}
+			sn := crt.SerialNumber.String()
+			if seen[sn] {
+				continue
+			}
+			seen[sn] = true
+			revoked, err := a.db.IsRevoked(sn)
+			if err != nil {
+				return nil, err
+			}
+			if !revoked {
+				certs = append(certs, crt)
+			}
+		}
+	}
+	return certs, nil
+}
+
+// revokeSuperseded revokes the given certificates with the superseded reason.
+// The new certificate has already been issued, so errors are logged and
+// returned as warnings instead of failing the request.
+func (a *Authority) revokeSuperseded(ctx context.Context, certs []*x509.Certificate) {
+	if len(certs) == 0 {
+		return
+	}
+
+	var revoked int
+	for _, crt := range certs {
+		if err := a.revokeSupersededCertificate(crt); err != nil {
+			log.Printf("error revoking superseded certificate %s: %v", crt.SerialNumber, err)
+			addWarning(ctx, "certificate with serial number '%s' could not be revoked", crt.SerialNumber)
+			continue
+		}
+		revoked++
+	}
+
+	if revoked > 0 && a.config.CRL.IsEnabled() && a.config.CRL.GenerateOnRevoke {
+		if err := a.GenerateCertificateRevocationList(); err != nil {
+			log.Printf("error generating certificate revocation list: %v", err)
+		}
+	}
+}
+
+// revokeSupersededCertificate revokes one certificate replaced by a new one
+// with the same DNS names.
+func (a *Authority) revokeSupersededCertificate(crt *x509.Certificate) error {
+	rci := &db.RevokedCertificateInfo{
+		Serial:     crt.SerialNumber.String(),
+		ReasonCode: ocsp.Superseded,
+		Reason:     "superseded by a certificate with the same DNS names",
+		RevokedAt:  time.Now().UTC(),
+		ExpiresAt:  crt.NotAfter,
+	}
+	if p, err := a.LoadProvisionerByCertificate(crt); err == nil {
+		rci.ProvisionerID = p.GetID()
+	}
+
+	x509CAService, _, _ := a.getX509SignerByIssuer(crt)
+	if _, err := x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+		Certificate:  crt,
+		SerialNumber: rci.Serial,
+		Reason:       rci.Reason,
+		ReasonCode:   rci.ReasonCode,
+	}); err != nil {
+		return err
+	}
+	if err := a.revoke(crt, rci); err != nil && !errors.Is(err, db.ErrAlreadyExists) {
+		return err
+	}
+	return nil
+}
+
 // isAllowedToSignX509Certificate checks if the Authority is allowed
-// to sign the X.509 certificate.
-func (a *Authority) isAllowedToSignX509Certificate(cert *x509.Certificate) error {
-	if err := a.constraintsEngine.ValidateCertificate(cert); err != nil {
+// to sign the X.509 certificate using the given constraints engine. If the
+// X.509 policy is in shadow mode, a denial is only logged, recorded and added
+// as a warning.
+func (a *Authority) isAllowedToSignX509Certificate(ctx context.Context, prov provisioner.Interface, constraintsEngine *constraints.Engine, cert *x509.Certificate) error {
+	if err := constraintsEngine.ValidateCertificate(cert); err != nil {
 		return err
 	}
-	return a.policyEngine.IsX509CertificateAllowed(cert)
+	err := a.policyEngine.IsX509CertificateAllowed(cert)
+	if a.policyEngine.IsX509Shadow() {
+		a.meter.X509PolicyShadowed(prov, err)
+		if err != nil {
+			log.Printf("x509 policy in shadow mode would have denied the certificate for %q: %v", cert.Subject.CommonName, err)
+			addWarning(ctx, "x509 policy in shadow mode would have denied the certificate: %v", err)
+		}
+		return nil
+	}
+	return err
 }
 
 // AreSANsAllowed evaluates the provided sans against the
-// authority X.509 policy.
+// authority X.509 policy. A policy in shadow mode allows all the sans; the
+// result is recorded when the certificate is signed.
 func (a *Authority) AreSANsAllowed(_ context.Context, sans []string) error {
+	if a.policyEngine.IsX509Shadow() {
+		return nil
+	}
 	return a.policyEngine.AreSANsAllowed(sans)
 }
 
@@ -376,10 +806,16 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
+	// Renew the certificate with the same signer that issued it.
+	x509CAService, constraintsEngine, issuer := a.getX509SignerByIssuer(oldCert)
+
 	// Durations
-	backdate := a.config.AuthorityConfig.Backdate.Duration
+	backdate := renewalBackdate(prov, a.config.AuthorityConfig.Backdate.Duration)
 	duration := oldCert.NotAfter.Sub(oldCert.NotBefore)
-	lifetime := duration - backdate
+	lifetime := renewalLifetime(prov, issuer, duration-backdate)
+	if lifetime < duration-backdate {
+		addWarning(ctx, "certificate validity was clamped to %v", lifetime)
+	}
 
 	// Create new certificate from previous values.
 	// Issuer, NotBefore, NotAfter and SubjectKeyId will be set by the CAS.
@@ -412,12 +848,24 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		PolicyIdentifiers:           oldCert.PolicyIdentifiers,
 	}
 
+	// Sign the renewal with the signature algorithm of the provisioner, if
+	// configured.
+	if ctl := getController(prov); ctl != nil {
+		newCert.SignatureAlgorithm = ctl.GetSignatureAlgorithm()
+	}
+
 	if isRekey {
 		newCert.PublicKey = pk
 	} else {
 		newCert.PublicKey = oldCert.PublicKey
 	}
 
+	// Reject the new key, or the old one if it has been added to the blocklist
+	// after the certificate was issued.
+	if err := a.checkKeyBlocklist(newCert.PublicKey); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+	}
+
 	// Copy all extensions except:
 	//
 	//  1. Authority Key Identifier - This one might be different if we rotate
@@ -427,14 +875,77 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	//  2. Subject Key Identifier, if rekey - For rekey, SubjectKeyIdentifier
 	//  extension will be calculated for the new public key by
 	//  x509util.CreateCertificate()
+	//
+	//  3. The recommended renewal time, if the provisioner adds it, it is
+	//  computed again for the validity of the new certificate.
+	//
+	//  4. The renewal budget, if the provisioner limits the number of
+	//  renewals, it is incremented in the new certificate.
+	//
+	//  5. The embedded SCTs, they are only valid for the old certificate. If
+	//  the provisioner submits its certificates to CT logs, the renewal is
+	//  submitted too.
+	//
+	//  6. The result of the key attestation, if rekey - The new public key has
+	//  not been attested.
+	renewAfter := getController(prov).GetRenewAfter()
+	maxRenewals := getMaxRenewals(prov)
+	hasOriginalNotBefore := false
 	for _, ext := range oldCert.Extensions {
-		if ext.Id.Equal(oidAuthorityKeyIdentifier) {
+		if ext.Id.Equal(oidAuthorityKeyIdentifier) || ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		if renewAfter != nil && ext.Id.Equal(renewAfter.GetOID()) {
+			continue
+		}
+		if maxRenewals > 0 && ext.Id.Equal(provisioner.StepOIDRenewalBudget) {
 			continue
 		}
 		if ext.Id.Equal(oidSubjectKeyIdentifier) && isRekey {
 			newCert.SubjectKeyId = nil
 			continue
 		}
+		if ext.Id.Equal(provisioner.StepOIDKeyAttestation) && isRekey {
+			continue
+		}
+		if ext.Id.Equal(provisioner.StepOIDOriginalNotBefore) {
+			hasOriginalNotBefore = true
+		}
+		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
+	}
+
+	// Record the notBefore of the first certificate of the chain of renewals,
+	// the provisioner can use it to limit the time a certificate is renewed.
+	if !hasOriginalNotBefore && !isSmallstepExtensionsDisabled(prov) {
+		ext, err := provisioner.NewOriginalNotBeforeExtension(oldCert.NotBefore)
+		if err != nil {
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
+		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
+	}
+
+	// Count the renewal, the provisioner uses it to limit the number of times
+	// a certificate is renewed.
+	if maxRenewals > 0 {
+		budget, _ := provisioner.GetRenewalBudget(oldCert)
+		ext, err := provisioner.NewRenewalBudgetExtension(provisioner.RenewalBudget{
+			Renewals:    budget.Renewals + 1,
+			MaxRenewals: maxRenewals,
+		})
+		if err != nil {
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
+		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
+	}
+
+	// The CAS sets the validity of the new certificate using the lifetime and
+	// backdate, the renewal time is computed with the same values.
+	if renewAfter != nil {
+		now := time.Now()
+		ext, err := renewAfter.NewExtension(now.Add(-backdate), now.Add(lifetime))
+		if err != nil {
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
 		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
 	}
 
@@ -443,7 +954,7 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	//
 	// TODO(hslatman,maraino): consider adding policies too and consider if
 	// RenewSSH should check policies.
-	if err = a.constraintsEngine.ValidateCertificate(newCert); err != nil {
+	if err = constraintsEngine.ValidateCertificate(newCert); err != nil {
 		var ee *errs.Error
 		switch {
 		case errors.As(err, &ee):
@@ -456,29 +967,345 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		}
 	}
 
+	// Set serial number if the authority is configured with a custom length
+	if err := a.setSerialNumber(newCert); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+	}
+
 	// The token can optionally be in the context. If the CA is running in RA
 	// mode, this can be used to renew a certificate.
 	token, _ := TokenFromContext(ctx)
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
-		Template: newCert,
-		Lifetime: lifetime,
-		Backdate: backdate,
-		Token:    token,
-	})
+	// Serialize the renewals of the certificate if the provisioner requires it.
+	// A retry of a recent renewal gets the same certificate.
+	locked, renewed, err := a.lockRenewal(prov, oldCert, newCert.PublicKey, opts...)
+	if err != nil {
+		return nil, prov, err
+	}
+	if renewed != nil {
+		return renewed, prov, nil
+	}
+
+	release, err := a.acquireSignSlot(ctx, nil, nil)
+	if err != nil {
+		a.unlockRenewal(locked, oldCert)
+		return nil, prov, err
+	}
+	defer release()
+
+	renewCertificate := func(template *x509.Certificate) (*casapi.CreateCertificateResponse, error) {
+		resp, err := x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
+			Template: template,
+			Lifetime: lifetime,
+			Backdate: backdate,
+			Token:    token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &casapi.CreateCertificateResponse{
+			Certificate:      resp.Certificate,
+			CertificateChain: resp.CertificateChain,
+		}, nil
+	}
+
+	// Embed the SCTs of a precertificate if the provisioner submits its
+	// certificates to certificate transparency logs.
+	var precert *x509.Certificate
+	ctLogs := getCertificateTransparency(prov)
+	if ctLogs != nil {
+		if precert, err = a.addSCTs(ctx, ctLogs, newCert, renewCertificate); err != nil {
+			a.unlockRenewal(locked, oldCert)
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
+	}
+
+	resp, err := renewCertificate(newCert)
 	if err != nil {
+		a.unlockRenewal(locked, oldCert)
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
+	if precert != nil {
+		if err := ctLogs.CheckPrecertificate(resp.Certificate, precert); err != nil {
+			a.unlockRenewal(locked, oldCert)
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
+	}
 
 	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
 
 	if err = a.storeRenewedCertificate(oldCert, chain); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		a.unlockRenewal(locked, oldCert)
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
+	a.finishRenewal(locked, oldCert, chain[0])
 	return chain, prov, nil
 }
 
+// getController returns the controller of the provisioner, or nil if it does
+// not have one. The methods of the controller can be called on nil.
+func getController(prov provisioner.Interface) *provisioner.Controller {
+	if cg, ok := prov.(provisioner.ControllerGetter); ok {
+		return cg.GetController()
+	}
+	return nil
+}
+
+// getCertificateTransparency returns the CT logs where the provisioner submits
+// its certificates, or nil if it does not submit them.
+func getCertificateTransparency(prov provisioner.Interface) *provisioner.X509CertificateTransparency {
+	return getController(prov).GetCertificateTransparency()
+}
+
+// isSmallstepExtensionsDisabled returns true if the provisioner does not allow
+// the smallstep extensions in its certificates.
+func isSmallstepExtensionsDisabled(prov provisioner.Interface) bool {
+	cg, ok := prov.(provisioner.ClaimerGetter)
+	return ok && cg.GetClaimer() != nil && cg.GetClaimer().IsDisableSmallstepExtensions()
+}
+
+// getMaxRenewals returns the maximum number of renewals allowed by the
+// provisioner. It returns 0 if the renewals are not limited or if the
+// provisioner does not allow the smallstep extensions in its certificates.
+func getMaxRenewals(prov provisioner.Interface) int {
+	cg, ok := prov.(provisioner.ClaimerGetter)
+	if !ok || cg.GetClaimer() == nil || cg.GetClaimer().IsDisableSmallstepExtensions() {
+		return 0
+	}
+	return cg.GetClaimer().MaxRenewals()
+}
+
+// acquireSignSlot waits for a free slot in the limit of concurrent sign
+// operations of the provisioner, if not nil, and then in the one of the
+// authority, so a busy provisioner does not hold the slots of the authority
+// while it waits. It returns the function that releases both slots, or a 503
+// error if the operation cannot be queued, waits for too long or the request
+// is canceled.
+func (a *Authority) acquireSignSlot(ctx context.Context, prov provisioner.Interface, limiter *provisioner.ConcurrencyLimiter) (func(), error) {
+	release, err := limiter.Acquire(ctx, func(inFlight, queued int) {
+		a.meter.SignConcurrency(prov, inFlight, queued)
+	})
+	if err != nil {
+		return nil, signSlotError(err)
+	}
+	releaseGlobal, err := a.signConcurrency.Acquire(ctx, func(inFlight, queued int) {
+		a.meter.SignConcurrency(nil, inFlight, queued)
+	})
+	if err != nil {
+		release()
+		return nil, signSlotError(err)
+	}
+	return func() {
+		releaseGlobal()
+		release()
+	}, nil
+}
+
+// signSlotError converts the errors of the limiters to a 503 error. Errors
+// other than the limiter ones are caused by the cancellation of the request.
+func signSlotError(err error) error {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return errs.Wrap(http.StatusServiceUnavailable, err, "authority.Sign; error waiting for a sign slot")
+}
+
+// renewalLockTTL is the time after which the renewal lock of a certificate
+// that was never renewed or released can be taken over. It is also the time
+// during which a retry of a renewal gets the certificate already renewed.
+const renewalLockTTL = time.Minute
+
+// lockRenewal locks the renewal of the given certificate if the provisioner
+// serializes renewals and the database supports it. If the certificate was
+// renewed less than renewalLockTTL ago with the same public key, it returns the
+// chain of the renewed certificate. It returns a conflict error if the
+// certificate is being renewed, or if it was renewed with a different key.
+func (a *Authority) lockRenewal(prov provisioner.Interface, cert *x509.Certificate, pub crypto.PublicKey, opts ...errs.Option) (bool, []*x509.Certificate, error) {
+	cg, ok := prov.(provisioner.ClaimerGetter)
+	if !ok || cg.GetClaimer() == nil || !cg.GetClaimer().IsRenewalSerialized() {
+		return false, nil, nil
+	}
+	rdb, ok := a.db.(db.CertificateRenewalDB)
+	if !ok {
+		return false, nil, nil
+	}
+	sn := cert.SerialNumber.String()
+	locked, renewedSerial, err := rdb.LockRenewal(sn, renewalLockTTL)
+	if err != nil {
+		return false, nil, errs.StatusCodeError(http.StatusInternalServerError, errors.Wrap(err, "error locking renewal"), opts...)
+	}
+	if locked {
+		return true, nil, nil
+	}
+	if renewedSerial != "" {
+		renewed, err := a.db.GetCertificate(renewedSerial)
+		if err != nil {
+			return false, nil, errs.StatusCodeError(http.StatusInternalServerError, errors.Wrap(err, "error loading renewed certificate"), opts...)
+		}
+		if k, ok := renewed.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(pub) {
+			return false, append([]*x509.Certificate{renewed}, a.getX509ChainByIssuer(renewed)...), nil
+		}
+	}
+	msg := fmt.Sprintf("certificate %s has already been renewed or is being renewed", sn)
+	return false, nil, errs.NewErr(http.StatusConflict, errors.New(msg), append(opts, errs.WithMessage(msg))...)
+}
+
+// unlockRenewal releases the renewal lock of the given certificate after a
+// failed renewal.
+func (a *Authority) unlockRenewal(locked bool, cert *x509.Certificate) {
+	if !locked {
+		return
+	}
+	if err := a.db.(db.CertificateRenewalDB).UnlockRenewal(cert.SerialNumber.String()); err != nil {
+		log.Printf("error unlocking renewal of certificate %s: %v", cert.SerialNumber, err)
+	}
+}
+
+// finishRenewal marks the given certificate as renewed by the new one.
+func (a *Authority) finishRenewal(locked bool, oldCert, newCert *x509.Certificate) {
+	if !locked {
+		return
+	}
+	if err := a.db.(db.CertificateRenewalDB).FinishRenewal(oldCert.SerialNumber.String(), newCert.SerialNumber.String()); err != nil {
+		log.Printf("error finishing renewal of certificate %s: %v", oldCert.SerialNumber, err)
+	}
+}
+
+// setSerialNumber sets a random serial number in the certificate template if
+// the authority is configured with a custom serial number length and the
+// template does not have one. Otherwise, the serial number is generated by the
+// CAS.
+func (a *Authority) setSerialNumber(cert *x509.Certificate) error {
+	length := a.config.AuthorityConfig.SerialNumberLength
+	if length == 0 || cert.SerialNumber != nil {
+		return nil
+	}
+	sn, err := generateSerialNumber(length)
+	if err != nil {
+		return err
+	}
+	cert.SerialNumber = sn
+	return nil
+}
+
+// maxSerialNumberAttempts is the maximum number of serial numbers generated by
+// a provisioner generator before giving up because all of them are in use.
+const maxSerialNumberAttempts = 10
+
+// setGeneratedSerialNumber sets the serial number in the certificate template
+// using the given generator, unless the template already has one. Serial
+// numbers that are already in the database are discarded.
+func (a *Authority) setGeneratedSerialNumber(cert *x509.Certificate, gen provisioner.SerialGenerator) error {
+	if cert.SerialNumber != nil {
+		return nil
+	}
+	for i := 0; i < maxSerialNumberAttempts; i++ {
+		sn, err := gen.GenerateSerial()
+		if err != nil {
+			return errors.Wrap(err, "error generating serial number")
+		}
+		if sn == nil || sn.Sign() <= 0 {
+			return errors.New("error generating serial number: serial number must be positive")
+		}
+		inUse, err := a.isSerialNumberInUse(sn)
+		if err != nil {
+			return err
+		}
+		if !inUse {
+			cert.SerialNumber = sn
+			return nil
+		}
+	}
+	return errors.Errorf("error generating serial number: %d serial numbers already in use", maxSerialNumberAttempts)
+}
+
+// isSerialNumberInUse returns true if a certificate with the given serial
+// number is in the database. Databases that do not store certificates cannot
+// detect duplicates.
+func (a *Authority) isSerialNumberInUse(sn *big.Int) (bool, error) {
+	_, err := a.db.GetCertificate(sn.String())
+	switch {
+	case err == nil:
+		return true, nil
+	case database.IsErrNotFound(err), errors.Is(err, db.ErrNotImplemented):
+		return false, nil
+	default:
+		return false, errors.Wrapf(err, "error checking serial number %s", sn)
+	}
+}
+
+// generateSerialNumber returns a random positive serial number that is DER
+// encoded with at most the given number of octets.
+func generateSerialNumber(length int) (*big.Int, error) {
+	// The high bit is not used, so the encoding does not need a leading zero.
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(length*8-1))
+	for {
+		sn, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, errors.Wrap(err, "error generating serial number")
+		}
+		if sn.Sign() > 0 {
+			return sn, nil
+		}
+	}
+}
+
+// renewalLifetime returns the lifetime of a renewed certificate. If the
+// provisioner defines a minimum renewal duration, the lifetime will be at least
+// that one, regardless of how close to the expiration the renewal happens. If
+// it defines a maximum renewal duration, the lifetime will be at most that one.
+// The lifetime is always truncated so the certificate does not outlive its
+// issuer.
+func renewalLifetime(prov provisioner.Interface, issuer *x509.Certificate, lifetime time.Duration) time.Duration {
+	if cg, ok := prov.(provisioner.ClaimerGetter); ok {
+		if claimer := cg.GetClaimer(); claimer != nil {
+			if d := claimer.MinRenewalTLSCertDuration(); lifetime < d {
+				lifetime = d
+			}
+			if d := claimer.MaxRenewalTLSCertDuration(); d > 0 && lifetime > d {
+				lifetime = d
+			}
+		}
+	}
+	if issuer != nil {
+		if remaining := time.Until(issuer.NotAfter).Truncate(time.Second); remaining > 0 && lifetime > remaining {
+			lifetime = remaining
+		}
+	}
+	return lifetime
+}
+
+// renewalBackdate returns the backdate configured in the provisioner, or the
+// given backdate of the authority if the provisioner does not set one.
+func renewalBackdate(prov provisioner.Interface, backdate time.Duration) time.Duration {
+	if cg, ok := prov.(provisioner.ClaimerGetter); ok {
+		if claimer := cg.GetClaimer(); claimer != nil {
+			if d, ok := claimer.TLSBackdate(); ok {
+				return d
+			}
+		}
+	}
+	return backdate
+}
+
+// checkIssuerNotBefore makes sure that the certificate does not appear valid
+// before its issuer existed. A notBefore explicitly requested before the
+// notBefore of the issuer is rejected, the one set by the authority, e.g.
+// with the backdate, is clamped to the notBefore of the issuer.
+func checkIssuerNotBefore(leaf, issuer *x509.Certificate, signOpts provisioner.SignOptions) error {
+	if issuer == nil || !leaf.NotBefore.Before(issuer.NotBefore) {
+		return nil
+	}
+	if !signOpts.NotBefore.IsZero() {
+		return errors.Errorf("requested notBefore is before the validity of the issuer, valid from %s",
+			issuer.NotBefore.UTC().Format(time.RFC3339))
+	}
+	leaf.NotBefore = issuer.NotBefore
+	return nil
+}
+
 // storeCertificate allows to use an extension of the db.AuthDB interface that
 // can log the full chain of certificates.
 //
@@ -621,6 +1448,20 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			errs.WithKeyVal("provisionerID", rci.ProvisionerID),
 			errs.WithKeyVal("tokenID", rci.TokenID),
 		)
+
+		// Some provisioners cannot bind the token to a serial number, so they
+		// need to check the certificate.
+		if ra, ok := p.(provisioner.RevokeCertificateAuthorizer); ok && provisioner.MethodFromContext(ctx) == provisioner.RevokeMethod {
+			cert := revokeOpts.Crt
+			if cert == nil {
+				if cert, err = a.db.GetCertificate(revokeOpts.Serial); err != nil {
+					return errs.Wrap(http.StatusUnauthorized, err, "authority.Revoke; error loading certificate", opts...)
+				}
+			}
+			if err := ra.AuthorizeRevokeCertificate(ctx, revokeOpts.OTT, cert); err != nil {
+				return errs.Wrap(http.StatusUnauthorized, err, "authority.Revoke", opts...)
+			}
+		}
 	} else if p, err := a.LoadProvisionerByCertificate(revokeOpts.Crt); err == nil {
 		// Load the Certificate provisioner if one exists.
 		rci.ProvisionerID = p.GetID()
@@ -687,7 +1528,10 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 	return nil
 }
 
+// revoke stores the revocation of the given certificate and removes its cached
+// OCSP response.
 func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
+	defer a.clearOCSPResponse(rci.Serial)
 	if lca, ok := a.adminDB.(interface {
 		Revoke(*x509.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
@@ -750,9 +1594,10 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		return errors.Errorf("Database does not support CRL generation")
 	}
 
-	// some CAS may not implement the CRLGenerator interface, so check before we proceed
+	// some CAS may not implement the CRLGenerator interface, so check before we
+	// proceed, the delegated CRL signer does not need it
 	caCRLGenerator, ok := a.x509CAService.(casapi.CertificateAuthorityCRLGenerator)
-	if !ok {
+	if !ok && a.crlSigner == nil {
 		return errors.Errorf("CA does not support CRL Generation")
 	}
 
@@ -833,9 +1678,18 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		}
 	}
 
-	certificateRevocationList, err := caCRLGenerator.CreateCRL(&casapi.CreateCRLRequest{RevocationList: &revocationList})
-	if err != nil {
-		return errors.Wrap(err, "could not create CRL")
+	var crlDER []byte
+	if a.crlSigner != nil {
+		crlDER, err = x509.CreateRevocationList(rand.Reader, &revocationList, a.crlSigner.cert, a.crlSigner.signer)
+		if err != nil {
+			return errors.Wrap(err, "could not create CRL")
+		}
+	} else {
+		certificateRevocationList, err := caCRLGenerator.CreateCRL(&casapi.CreateCRLRequest{RevocationList: &revocationList})
+		if err != nil {
+			return errors.Wrap(err, "could not create CRL")
+		}
+		crlDER = certificateRevocationList.CRL
 	}
 
 	// Create a new db.CertificateRevocationListInfo, which stores the new Number we just generated, the
@@ -843,7 +1697,7 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 	newCRLInfo := db.CertificateRevocationListInfo{
 		Number:    bn.Int64(),
 		ExpiresAt: revocationList.NextUpdate,
-		DER:       certificateRevocationList.CRL,
+		DER:       crlDER,
 		Duration:  updateDuration,
 	}
 
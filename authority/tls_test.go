@@ -6,18 +6,27 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1" //nolint:gosec // used to create the Subject Key Identifier by RFC 5280
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/ocsp"
+
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
@@ -29,6 +38,7 @@ import (
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/cas/softcas"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
@@ -489,6 +499,20 @@ ZYtQ9Ot36qc=
 				code:      http.StatusInternalServerError,
 			}
 		},
+		"fail CA certificate request": func(t *testing.T) *signTest {
+			bcExt := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 19}}
+			bcExt.Value, err = asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: 0})
+			require.NoError(t, err)
+			csr := getCSR(t, priv, setExtraExtsCSR([]pkix.Extension{bcExt}))
+			return &signTest{
+				auth:      a,
+				csr:       csr,
+				extraOpts: extraOpts,
+				signOpts:  signOpts,
+				err:       errors.New("certificate request for a CA certificate is not allowed"),
+				code:      http.StatusForbidden,
+			}
+		},
 		"fail with provisioner enforcer": func(t *testing.T) *signTest {
 			csr := getCSR(t, priv)
 			aa := testAuthority(t)
@@ -618,7 +642,7 @@ ZYtQ9Ot36qc=
 			bcExt := pkix.Extension{}
 			bcExt.Id = asn1.ObjectIdentifier{2, 5, 29, 19}
 			bcExt.Critical = false
-			bcExt.Value, err = asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: 4})
+			bcExt.Value, err = asn1.Marshal(basicConstraints{IsCA: false, MaxPathLen: 4})
 			require.NoError(t, err)
 
 			csr := getCSR(t, priv, setExtraExtsCSR([]pkix.Extension{
@@ -1107,6 +1131,7 @@ func TestAuthority_Renew(t *testing.T) {
 					sassert.Equals(t, leaf.ExtKeyUsage,
 						[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
 					sassert.Equals(t, leaf.DNSNames, []string{"test.smallstep.com", "test"})
+					assert.True(t, provisioner.GetOriginalNotBefore(leaf).Equal(tc.cert.NotBefore))
 
 					subjectKeyID, err := generateSubjectKeyID(leaf.PublicKey)
 					require.NoError(t, err)
@@ -1171,6 +1196,13 @@ func TestAuthority_Renew(t *testing.T) {
 	}
 }
 
+// blockedKeys is a KeyBlocklist with the given fingerprints.
+type blockedKeys map[string]bool
+
+func (b blockedKeys) IsBlocked(fp string) (bool, error) {
+	return b[fp], nil
+}
+
 func TestAuthority_Rekey(t *testing.T) {
 	pub, _, err := keyutil.GenerateDefaultKeyPair()
 	require.NoError(t, err)
@@ -1246,6 +1278,31 @@ func TestAuthority_Rekey(t *testing.T) {
 				pk:   pub,
 			}, nil
 		},
+		"fail/rekey-key-blocklist": func() (*renewTest, error) {
+			fp, err := provisioner.KeyFingerprint(pub)
+			require.NoError(t, err)
+			_a := testAuthority(t)
+			_a.keyBlocklist = blockedKeys{fp: true}
+			return &renewTest{
+				auth: _a,
+				cert: cert,
+				pk:   pub,
+				err:  errors.New("certificate public key is in the key blocklist"),
+				code: http.StatusForbidden,
+			}, nil
+		},
+		"fail/renew-key-blocklist": func() (*renewTest, error) {
+			fp, err := provisioner.KeyFingerprint(cert.PublicKey)
+			require.NoError(t, err)
+			_a := testAuthority(t)
+			_a.keyBlocklist = blockedKeys{fp: true}
+			return &renewTest{
+				auth: _a,
+				cert: cert,
+				err:  errors.New("certificate public key is in the key blocklist"),
+				code: http.StatusForbidden,
+			}, nil
+		},
 		"ok/renew/success-new-intermediate": func() (*renewTest, error) {
 			rootCert, rootSigner := generateRootCertificate(t)
 			intCert, intSigner := generateIntermidiateCertificate(t, rootCert, rootSigner)
@@ -1952,3 +2009,1660 @@ func TestAuthority_CRL(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_x509Signers(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	bu, err := minica.New()
+	require.NoError(t, err)
+
+	auth, err := NewEmbedded(WithX509RootCerts(ca.Root, bu.Root), WithX509Signer(ca.Intermediate, ca.Signer))
+	require.NoError(t, err)
+	svc, err := softcas.New(context.Background(), casapi.Options{
+		CertificateChain: []*x509.Certificate{bu.Intermediate},
+		Signer:           bu.Signer,
+	})
+	require.NoError(t, err)
+	auth.x509Signers = map[string]*x509Signer{
+		"bu": {name: "bu", chain: []*x509.Certificate{bu.Intermediate}, service: svc},
+	}
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	require.NoError(t, err)
+	templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		signerName provisioner.X509SignerName
+		want       *x509.Certificate
+		wantErr    bool
+	}{
+		{"ok default", "", ca.Intermediate, false},
+		{"ok named", "bu", bu.Intermediate, false},
+		{"fail unknown", "foo", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := auth.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, templateOption, tt.signerName)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chain[1])
+			assert.Equal(t, tt.want.RawSubject, chain[0].RawIssuer)
+
+			// Certificates cannot outlive the signer.
+			_, err = auth.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, templateOption, tt.signerName,
+				withNotBeforeNotAfter(time.Now(), tt.want.NotAfter.Add(time.Hour)))
+			var sc render.StatusCodedError
+			require.ErrorAs(t, err, &sc)
+			assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+
+			// Renewals use the signer that issued the certificate.
+			renewed, err := auth.Renew(chain[0])
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, renewed[1])
+		})
+	}
+}
+
+func TestAuthority_Sign_allowedSigners(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	bu, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+
+	auth, err := NewEmbedded(WithX509RootCerts(ca.Root, bu.Root, other.Root), WithX509Signer(ca.Intermediate, ca.Signer))
+	require.NoError(t, err)
+	newSigner := func(name string, c *minica.CA) *x509Signer {
+		svc, err := softcas.New(context.Background(), casapi.Options{
+			CertificateChain: []*x509.Certificate{c.Intermediate},
+			Signer:           c.Signer,
+		})
+		require.NoError(t, err)
+		return &x509Signer{name: name, chain: []*x509.Certificate{c.Intermediate}, service: svc}
+	}
+	auth.x509Signers = map[string]*x509Signer{
+		"bu":    newSigner("bu", bu),
+		"other": newSigner("other", other),
+	}
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	require.NoError(t, err)
+	templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+	require.NoError(t, err)
+	// The authority key identifier set by a template is replaced.
+	akiModifier := provisioner.CertificateModifierFunc(func(crt *x509.Certificate, _ provisioner.SignOptions) error {
+		crt.AuthorityKeyId = []byte{1, 2, 3, 4}
+		return nil
+	})
+
+	tests := []struct {
+		name       string
+		signerName provisioner.X509SignerName
+		requested  string
+		want       *x509.Certificate
+		wantErr    bool
+	}{
+		{"ok default", "", "", ca.Intermediate, false},
+		{"ok requested", "", "bu", bu.Intermediate, false},
+		{"ok provisioner signer", "bu", "", bu.Intermediate, false},
+		{"ok requested provisioner signer", "other", "other", other.Intermediate, false},
+		{"fail not allowed", "", "other", nil, true},
+		{"fail unknown", "", "foo", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := auth.SignWithContext(context.Background(), csr, provisioner.SignOptions{Signer: tt.requested},
+				templateOption, akiModifier, tt.signerName, provisioner.X509AllowedSigners{"bu"})
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chain[1])
+			assert.Equal(t, tt.want.RawSubject, chain[0].RawIssuer)
+			assert.Equal(t, tt.want.SubjectKeyId, chain[0].AuthorityKeyId)
+			require.NoError(t, chain[0].CheckSignatureFrom(tt.want))
+		})
+	}
+}
+
+func TestAuthority_provisionerSigner(t *testing.T) {
+	bu, err := minica.New()
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{X509: &provisioner.X509Options{Signer: "bu"}}
+
+	// Unknown signers are rejected when the provisioner is loaded.
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	assert.EqualError(t, p.Init(config), `x509.signer "bu" is not configured`)
+
+	a.x509Signers = map[string]*x509Signer{
+		"bu": {name: "bu", chain: []*x509.Certificate{bu.Intermediate}},
+	}
+	config, err = a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, p.Init(config))
+}
+
+func TestAuthority_Authorize_rateLimitReload(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{
+		RateLimit: &provisioner.RateLimitOptions{RequestsPerSecond: 1.0 / 3600, Burst: 1},
+	}
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	authorize := func() error {
+		token, err := generateToken("test.smallstep.com", p.Name, testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), jwk)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		_, err = a.Authorize(ctx, token)
+		return err
+	}
+
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+	require.NoError(t, authorize())
+
+	// Reloading the provisioner does not reset its rate limit.
+	config, err = a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+	var sc render.StatusCodedError
+	err = authorize()
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusTooManyRequests, sc.StatusCode())
+}
+
+func TestAuthority_Sign_backdate(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		backdate *provisioner.Duration
+		want     time.Duration
+	}{
+		{"ok authority", nil, a.config.AuthorityConfig.Backdate.Duration},
+		{"ok provisioner", &provisioner.Duration{Duration: time.Hour}, time.Hour},
+		{"ok provisioner zero", &provisioner.Duration{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.Claims.TLSBackdate = tt.backdate
+			t.Cleanup(func() {
+				p.Claims.TLSBackdate = nil
+			})
+
+			now := time.Now()
+			token, err := generateToken("test.smallstep.com", p.Name, testAudiences.Sign[0], []string{"test.smallstep.com"}, now, jwk)
+			require.NoError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			signOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			chain, err := a.SignWithContext(ctx, csr, provisioner.SignOptions{}, signOpts...)
+			require.NoError(t, err)
+			assert.WithinDuration(t, now.Add(-tt.want), chain[0].NotBefore, 2*time.Second)
+			assert.WithinDuration(t, now.Add(24*time.Hour), chain[0].NotAfter, 2*time.Second)
+		})
+	}
+}
+
+func TestAuthority_Renew_backdate(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Claims.TLSBackdate = &provisioner.Duration{Duration: time.Hour}
+	t.Cleanup(func() {
+		p.Claims.TLSBackdate = nil
+	})
+
+	now := time.Now()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-2*time.Hour), now.Add(-time.Hour+2*time.Hour)),
+		withProvisionerOID("step-cli", p.Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	chain, err := a.Renew(cert)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), chain[0].NotBefore, time.Minute)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), chain[0].NotAfter, time.Minute)
+}
+
+func TestAuthority_Renew_renewAfter(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{X509: &provisioner.X509Options{
+		RenewAfter: &provisioner.RenewAfterOptions{Fraction: 0.5},
+	}}
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+
+	now := time.Now()
+	stale, err := p.GetController().GetRenewAfter().NewExtension(now.Add(-24*time.Hour), now.Add(-12*time.Hour))
+	require.NoError(t, err)
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Hour), now.Add(time.Hour)),
+		withProvisionerOID("step-cli", p.Key.KeyID),
+		provisioner.CertificateModifierFunc(func(crt *x509.Certificate, _ provisioner.SignOptions) error {
+			crt.ExtraExtensions = append(crt.ExtraExtensions, stale)
+			return nil
+		}),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	chain, err := a.Renew(cert)
+	require.NoError(t, err)
+	leaf := chain[0]
+	renewAfter, ok := provisioner.GetRenewAfter(leaf, provisioner.StepOIDRenewAfter)
+	require.True(t, ok)
+	want := leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2)
+	assert.WithinDuration(t, want, renewAfter, 2*time.Second)
+
+	var count int
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(provisioner.StepOIDRenewAfter) {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
+
+// renewalDB is an in-memory CertificateRenewalDB without lock expiration.
+type renewalDB struct {
+	db.MockAuthDB
+	mu    sync.Mutex
+	locks map[string]string
+	certs map[string]*x509.Certificate
+}
+
+func (d *renewalDB) LockRenewal(sn string, _ time.Duration) (bool, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if renewed, ok := d.locks[sn]; ok {
+		return false, renewed, nil
+	}
+	d.locks[sn] = ""
+	return true, "", nil
+}
+
+func (d *renewalDB) FinishRenewal(sn, renewedSerialNumber string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.locks[sn] = renewedSerialNumber
+	return nil
+}
+
+func (d *renewalDB) UnlockRenewal(sn string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.locks, sn)
+	return nil
+}
+
+func (d *renewalDB) StoreRenewedCertificate(_ *x509.Certificate, chain ...*x509.Certificate) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.certs[chain[0].SerialNumber.String()] = chain[0]
+	return nil
+}
+
+func (d *renewalDB) GetCertificate(sn string) (*x509.Certificate, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.certs[sn], nil
+}
+
+func TestAuthority_Renew_serializeRenewals(t *testing.T) {
+	a := testAuthority(t)
+	a.db = &renewalDB{
+		MockAuthDB: db.MockAuthDB{MIsRevoked: func(string) (bool, error) { return false, nil }},
+		locks:      make(map[string]string),
+		certs:      make(map[string]*x509.Certificate),
+	}
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	serialize := true
+	p.Claims.SerializeRenewals = &serialize
+	t.Cleanup(func() {
+		p.Claims.SerializeRenewals = nil
+	})
+
+	now := time.Now()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Hour), now.Add(time.Hour)),
+		withProvisionerOID("step-cli", p.Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	chain, err := a.Renew(cert)
+	require.NoError(t, err)
+
+	// A retry gets the same certificate.
+	retry, err := a.Renew(cert)
+	require.NoError(t, err)
+	assert.Equal(t, chain[0].Raw, retry[0].Raw)
+	assert.Equal(t, len(chain), len(retry))
+
+	// A rekey with another key is a conflict.
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = a.Rekey(cert, priv.Public())
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusConflict, sc.StatusCode())
+
+	// The renewed certificate can be renewed.
+	_, err = a.Renew(chain[0])
+	require.NoError(t, err)
+}
+
+func TestAuthority_Renew_maxRenewals(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	maxRenewals := 2
+	p.Claims.MaxRenewals = &maxRenewals
+	t.Cleanup(func() {
+		p.Claims.MaxRenewals = nil
+	})
+
+	now := time.Now()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Hour), now.Add(time.Hour)),
+		withProvisionerOID("step-cli", p.Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	_, ok := provisioner.GetRenewalBudget(cert)
+	require.False(t, ok)
+
+	// The renewal budget is counted on each renewal of the chain.
+	for i := 1; i <= maxRenewals; i++ {
+		chain, err := a.Renew(cert)
+		require.NoError(t, err)
+		cert = chain[0]
+		budget, ok := provisioner.GetRenewalBudget(cert)
+		require.True(t, ok)
+		assert.Equal(t, provisioner.RenewalBudget{Renewals: i, MaxRenewals: maxRenewals}, budget)
+		assert.Equal(t, maxRenewals-i, budget.Remaining())
+
+		var count int
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(provisioner.StepOIDRenewalBudget) {
+				count++
+			}
+		}
+		assert.Equal(t, 1, count)
+	}
+
+	// The budget is exhausted.
+	_, err := a.Renew(cert)
+	var sc render.StatusCodedError
+	require.True(t, errors.As(err, &sc))
+	assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+}
+
+func TestAuthority_Renew_minRenewalDuration(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Claims.MinRenewalTLSDur = &provisioner.Duration{Duration: 24 * time.Hour}
+	t.Cleanup(func() {
+		p.Claims.MinRenewalTLSDur = nil
+	})
+
+	issuer := getDefaultIssuer(a)
+	signer := getDefaultSigner(a)
+	now := time.Now()
+	lifetime := 2 * time.Hour
+
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		want      time.Duration
+	}{
+		{"ok 1% of lifetime", now.Add(-lifetime / 100), 24 * time.Hour},
+		{"ok 99% of lifetime", now.Add(-lifetime * 99 / 100), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+				withNotBeforeNotAfter(tt.notBefore, tt.notBefore.Add(lifetime)),
+				withProvisionerOID("step-cli", p.Key.KeyID),
+				withSigner(issuer, signer))
+
+			chain, err := a.Renew(cert)
+			require.NoError(t, err)
+			leaf := chain[0]
+			assert.WithinDuration(t, time.Now().Add(tt.want), leaf.NotAfter, time.Minute)
+			assert.WithinDuration(t, time.Now().Add(-a.config.AuthorityConfig.Backdate.Duration), leaf.NotBefore, time.Minute)
+		})
+	}
+}
+
+func TestAuthority_Renew_maxRenewalDuration(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Claims.MaxRenewalTLSDur = &provisioner.Duration{Duration: 30 * time.Minute}
+	t.Cleanup(func() {
+		p.Claims.MaxRenewalTLSDur = nil
+	})
+
+	issuer := getDefaultIssuer(a)
+	signer := getDefaultSigner(a)
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		lifetime     time.Duration
+		want         time.Duration
+		wantWarnings []string
+	}{
+		{"ok shorter", 10 * time.Minute, 10*time.Minute - a.config.AuthorityConfig.Backdate.Duration, nil},
+		{"ok truncated", 2 * time.Hour, 30 * time.Minute, []string{"certificate validity was clamped to 30m0s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+				withNotBeforeNotAfter(now, now.Add(tt.lifetime)),
+				withProvisionerOID("step-cli", p.Key.KeyID),
+				withSigner(issuer, signer))
+
+			ctx := NewWarningsContext(context.Background())
+			chain, err := a.RenewContext(ctx, cert, nil)
+			require.NoError(t, err)
+			leaf := chain[0]
+			assert.WithinDuration(t, time.Now().Add(tt.want), leaf.NotAfter, 5*time.Second)
+			assert.Equal(t, tt.wantWarnings, WarningsFromContext(ctx))
+		})
+	}
+}
+
+func Test_renewalLifetime(t *testing.T) {
+	a := testAuthority(t)
+	jwk := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		prov     provisioner.Interface
+		issuer   *x509.Certificate
+		lifetime time.Duration
+		want     time.Duration
+	}{
+		{"ok no floor", jwk, nil, time.Hour, time.Hour},
+		{"ok noop", &provisioner.MockProvisioner{}, nil, time.Hour, time.Hour},
+		{"ok issuer", jwk, &x509.Certificate{NotAfter: now.Add(30 * time.Minute)}, time.Hour, 29 * time.Minute},
+		{"ok issuer expired", jwk, &x509.Certificate{NotAfter: now.Add(-time.Minute)}, time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renewalLifetime(tt.prov, tt.issuer, tt.lifetime)
+			assert.InDelta(t, tt.want, got, float64(time.Minute))
+		})
+	}
+}
+
+func Test_generateSerialNumber(t *testing.T) {
+	for _, length := range []int{9, 16, 20} {
+		t.Run(fmt.Sprintf("length-%d", length), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				sn, err := generateSerialNumber(length)
+				require.NoError(t, err)
+				require.Equal(t, 1, sn.Sign())
+				b, err := asn1.Marshal(sn)
+				require.NoError(t, err)
+				// Tag and length take two octets.
+				require.LessOrEqual(t, len(b)-2, length)
+			}
+		})
+	}
+}
+
+func TestAuthority_Sign_serialNumberLength(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	a.config.AuthorityConfig.SerialNumberLength = 10
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	now := time.Now()
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}, extraOpts...)
+	require.NoError(t, err)
+	b, err := asn1.Marshal(chain[0].SerialNumber)
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(b)-2, 10)
+}
+
+type signConcurrencyMeter struct {
+	noopMeter
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func (m *signConcurrencyMeter) SignConcurrency(p provisioner.Interface, inFlight, _ int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var name string
+	if p != nil {
+		name = p.GetName()
+	}
+	m.inFlight[name] = inFlight
+}
+
+func TestAuthority_Sign_signConcurrency(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	meter := &signConcurrencyMeter{inFlight: map[string]int{}}
+	a := testAuthority(t)
+	a.meter = meter
+	a.signConcurrency = provisioner.NewConcurrencyLimiter(&provisioner.SignConcurrencyOptions{MaxConcurrent: 1})
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	sign := func(opts ...provisioner.SignOption) error {
+		now := time.Now()
+		_, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+			NotBefore: provisioner.NewTimeDuration(now),
+			NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+		}, opts...)
+		return err
+	}
+	assertUnavailable := func(t *testing.T, err error) {
+		t.Helper()
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc)) {
+			assert.Equal(t, http.StatusServiceUnavailable, sc.StatusCode())
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, sign(extraOpts...))
+		assert.Equal(t, map[string]int{"": 0}, meter.inFlight)
+	})
+
+	t.Run("fail authority limit", func(t *testing.T) {
+		release, err := a.signConcurrency.Acquire(context.Background(), nil)
+		require.NoError(t, err)
+		defer release()
+		assertUnavailable(t, sign(extraOpts...))
+	})
+
+	t.Run("fail authority limit with provisioner limit", func(t *testing.T) {
+		release, err := a.signConcurrency.Acquire(context.Background(), nil)
+		require.NoError(t, err)
+		defer release()
+		limiter := provisioner.NewConcurrencyLimiter(&provisioner.SignConcurrencyOptions{MaxConcurrent: 1})
+		assertUnavailable(t, sign(append(extraOpts, limiter)...))
+
+		// The slot of the provisioner must be released.
+		inFlight, queued := limiter.Stats()
+		assert.Equal(t, 0, inFlight)
+		assert.Equal(t, 0, queued)
+	})
+
+	t.Run("fail provisioner limit", func(t *testing.T) {
+		limiter := provisioner.NewConcurrencyLimiter(&provisioner.SignConcurrencyOptions{MaxConcurrent: 1})
+		release, err := limiter.Acquire(context.Background(), nil)
+		require.NoError(t, err)
+		defer release()
+		assertUnavailable(t, sign(append(extraOpts, limiter)...))
+
+		// The slot of the authority must not be taken while waiting for the
+		// provisioner.
+		inFlight, queued := a.signConcurrency.Stats()
+		assert.Equal(t, 0, inFlight)
+		assert.Equal(t, 0, queued)
+	})
+}
+
+type fixedSerialGenerator struct {
+	serials []*big.Int
+	err     error
+}
+
+func (g *fixedSerialGenerator) GenerateSerial() (*big.Int, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	sn := g.serials[0]
+	if len(g.serials) > 1 {
+		g.serials = g.serials[1:]
+	}
+	return sn, nil
+}
+
+func TestAuthority_setGeneratedSerialNumber(t *testing.T) {
+	inUse := map[string]bool{"1": true, "2": true}
+	getCertificate := func(sn string) (*x509.Certificate, error) {
+		if inUse[sn] {
+			return &x509.Certificate{}, nil
+		}
+		return nil, database.ErrNotFound
+	}
+
+	tests := []struct {
+		name    string
+		db      db.AuthDB
+		gen     *fixedSerialGenerator
+		cert    *x509.Certificate
+		want    *big.Int
+		wantErr bool
+	}{
+		{"ok", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(3)}}, &x509.Certificate{}, big.NewInt(3), false},
+		{"ok collision", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}}, &x509.Certificate{}, big.NewInt(3), false},
+		{"ok template", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(3)}}, &x509.Certificate{SerialNumber: big.NewInt(10)}, big.NewInt(10), false},
+		{"ok simple db", &db.SimpleDB{}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(1)}}, &x509.Certificate{}, big.NewInt(1), false},
+		{"fail all in use", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(1), big.NewInt(2)}}, &x509.Certificate{}, nil, true},
+		{"fail db", &db.MockAuthDB{MGetCertificate: func(string) (*x509.Certificate, error) {
+			return nil, errors.New("force")
+		}}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(3)}}, &x509.Certificate{}, nil, true},
+		{"fail generator", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{err: errors.New("force")}, &x509.Certificate{}, nil, true},
+		{"fail negative", &db.MockAuthDB{MGetCertificate: getCertificate}, &fixedSerialGenerator{serials: []*big.Int{big.NewInt(-3)}}, &x509.Certificate{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{db: tt.db}
+			err := a.setGeneratedSerialNumber(tt.cert, tt.gen)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, tt.cert.SerialNumber)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tt.cert.SerialNumber)
+		})
+	}
+}
+
+func TestAuthority_Sign_serialGenerator(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	sn := big.NewInt(0x0a1b2c3d)
+	extraOpts = append(extraOpts, provisioner.X509SerialGenerator{
+		SerialGenerator: &fixedSerialGenerator{serials: []*big.Int{sn}},
+	})
+	now := time.Now()
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}, extraOpts...)
+	require.NoError(t, err)
+	assert.Equal(t, sn, chain[0].SerialNumber)
+}
+
+func TestAuthority_Sign_crlDistributionPoints(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	withCRLDPs := func(urls ...string) provisioner.CertificateModifierFunc {
+		return func(crt *x509.Certificate, _ provisioner.SignOptions) error {
+			crt.CRLDistributionPoints = urls
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		crl       *config.CRLConfig
+		extraOpts []provisioner.SignOption
+		want      []string
+	}{
+		{"ok no crl", nil, nil, nil},
+		{"ok default", &config.CRLConfig{DistributionPoints: []string{"https://ca.smallstep.com/1.0/crl"}}, nil, []string{"https://ca.smallstep.com/1.0/crl"}},
+		{"ok provisioner", nil, []provisioner.SignOption{withCRLDPs("https://crl.smallstep.com")}, []string{"https://crl.smallstep.com"}},
+		{"ok provisioner override", &config.CRLConfig{DistributionPoints: []string{"https://ca.smallstep.com/1.0/crl"}}, []provisioner.SignOption{withCRLDPs("https://crl.smallstep.com")}, []string{"https://crl.smallstep.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.CRL = tt.crl
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+			require.NoError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			now := time.Now()
+			chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+				NotBefore: provisioner.NewTimeDuration(now),
+				NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+			}, append(extraOpts, tt.extraOpts...)...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chain[0].CRLDistributionPoints)
+		})
+	}
+}
+
+func TestAuthority_Sign_alternateChain(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	issuer := getDefaultIssuer(a)
+	old, err := minica.New()
+	require.NoError(t, err)
+	cross, err := old.Sign(&x509.Certificate{
+		Subject:               issuer.Subject,
+		PublicKey:             issuer.PublicKey,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		requested    bool
+		extraOpts    []provisioner.SignOption
+		want         []*x509.Certificate
+		wantWarnings []string
+	}{
+		{"ok not requested", false, []provisioner.SignOption{provisioner.X509AlternateChain{cross, old.Intermediate}}, []*x509.Certificate{issuer}, nil},
+		{"ok requested", true, []provisioner.SignOption{provisioner.X509AlternateChain{cross, old.Intermediate}}, []*x509.Certificate{cross, old.Intermediate}, nil},
+		{"ok no alternate chain", true, nil, []*x509.Certificate{issuer}, []string{"provisioner does not have an alternate chain"}},
+		{"ok other issuer", true, []provisioner.SignOption{provisioner.X509AlternateChain{other.Intermediate}}, []*x509.Certificate{issuer}, []string{"alternate chain does not match the issuer of the certificate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+			require.NoError(t, err)
+			ctx := NewWarningsContext(provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod))
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			now := time.Now()
+			chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+				NotBefore:      provisioner.NewTimeDuration(now),
+				NotAfter:       provisioner.NewTimeDuration(now.Add(time.Hour)),
+				AlternateChain: tt.requested,
+			}, append(extraOpts, tt.extraOpts...)...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chain[1:])
+			assert.Equal(t, tt.wantWarnings, WarningsFromContext(ctx))
+		})
+	}
+}
+
+// removeCTPoison returns the TBSCertificate of a precertificate without the
+// poison extension, the data signed by the CT logs.
+func removeCTPoison(tbs []byte) ([]byte, error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(tbs, &seq); err != nil {
+		return nil, err
+	}
+	var fields []byte
+	for b := seq.Bytes; len(b) > 0; {
+		var field asn1.RawValue
+		var err error
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return nil, err
+		}
+		if field.Class == asn1.ClassContextSpecific && field.Tag == 3 {
+			var exts []pkix.Extension
+			if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+				return nil, err
+			}
+			var kept []pkix.Extension
+			for _, ext := range exts {
+				if !ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}) {
+					kept = append(kept, ext)
+				}
+			}
+			if field.Bytes, err = asn1.Marshal(kept); err != nil {
+				return nil, err
+			}
+			field.FullBytes = nil
+		}
+		b, err := asn1.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, b...)
+	}
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+}
+
+// newCTLogServer returns a CT log that signs SCTs for the precertificates
+// submitted to its add-pre-chain endpoint, or that fails with the given status.
+func newCTLogServer(t *testing.T, status int) (*httptest.Server, provisioner.CTLog, chan *x509.Certificate) {
+	t.Helper()
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key, err := x509.MarshalPKIXPublicKey(signer.Public())
+	require.NoError(t, err)
+	id := sha256.Sum256(key)
+
+	submitted := make(chan *x509.Certificate, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var req struct {
+			Chain [][]byte `json:"chain"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Chain) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		precert, err := x509.ParseCertificate(req.Chain[0])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		issuer, err := x509.ParseCertificate(req.Chain[1])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tbs, err := removeCTPoison(precert.RawTBSCertificate)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		submitted <- precert
+
+		timestamp := uint64(time.Now().UnixMilli())
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		signed := binary.BigEndian.AppendUint64([]byte{0, 0}, timestamp)
+		signed = append(signed, 0, 1)
+		signed = append(signed, issuerKeyHash[:]...)
+		signed = append(signed, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+		signed = append(signed, tbs...)
+		signed = append(signed, 0, 0)
+		digest := sha256.Sum256(signed)
+		sig, err := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"sct_version": 0,
+			"id":          id[:],
+			"timestamp":   timestamp,
+			"signature":   append([]byte{4, 3, byte(len(sig) >> 8), byte(len(sig))}, sig...),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, provisioner.CTLog{URL: srv.URL, Key: key}, submitted
+}
+
+func TestAuthority_Sign_certificateTransparency(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	_, log1, submitted := newCTLogServer(t, http.StatusOK)
+	_, log2, _ := newCTLogServer(t, http.StatusOK)
+	_, failing, _ := newCTLogServer(t, http.StatusServiceUnavailable)
+
+	countExtensions := func(cert *x509.Certificate, oid asn1.ObjectIdentifier) (count int) {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oid) {
+				count++
+			}
+		}
+		return
+	}
+	oidCTPoison := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+	tests := []struct {
+		name         string
+		options      *provisioner.CertificateTransparencyOptions
+		wantSCTs     bool
+		wantWarnings []string
+		wantErr      bool
+	}{
+		{"ok", &provisioner.CertificateTransparencyOptions{Logs: []provisioner.CTLog{log1, log2}}, true, nil, false},
+		{"ok fail open", &provisioner.CertificateTransparencyOptions{Logs: []provisioner.CTLog{log1, failing}, FailOpen: true}, true, []string{"certificate transparency logs returned 1 of the 2 required SCTs"}, false},
+		{"ok fail open without SCTs", &provisioner.CertificateTransparencyOptions{Logs: []provisioner.CTLog{failing}, FailOpen: true}, false, []string{"certificate transparency logs returned 0 of the 1 required SCTs"}, false},
+		{"fail closed", &provisioner.CertificateTransparencyOptions{Logs: []provisioner.CTLog{log1, failing}}, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+			p.Options = &provisioner.Options{X509: &provisioner.X509Options{
+				CertificateTransparency: tt.options,
+			}}
+			config, err := a.generateProvisionerConfig(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, p.Init(config))
+
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+			require.NoError(t, err)
+			ctx := NewWarningsContext(provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod))
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			now := time.Now()
+			chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+				NotBefore: provisioner.NewTimeDuration(now),
+				NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+			}, extraOpts...)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				if assert.ErrorAs(t, err, &sc) {
+					assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			leaf := chain[0]
+			assert.Equal(t, 0, countExtensions(leaf, oidCTPoison))
+			if tt.wantSCTs {
+				assert.Equal(t, 1, countExtensions(leaf, oidSCTList))
+			} else {
+				assert.Equal(t, 0, countExtensions(leaf, oidSCTList))
+			}
+			warnings := WarningsFromContext(ctx)
+			require.Len(t, warnings, len(tt.wantWarnings))
+			for i, w := range tt.wantWarnings {
+				assert.Contains(t, warnings[i], w)
+			}
+
+			// The precertificate submitted is the poisoned certificate.
+			if tt.wantSCTs {
+				precert := <-submitted
+				assert.Equal(t, leaf.SerialNumber, precert.SerialNumber)
+				assert.Equal(t, leaf.NotBefore, precert.NotBefore)
+				assert.Equal(t, leaf.NotAfter, precert.NotAfter)
+				assert.Equal(t, 1, countExtensions(precert, oidCTPoison))
+				assert.Equal(t, 0, countExtensions(precert, oidSCTList))
+			}
+			for len(submitted) > 0 {
+				<-submitted
+			}
+
+			// The renewed certificate does not keep the SCTs, it gets new ones.
+			if tt.wantSCTs {
+				renewed, err := a.Renew(leaf)
+				require.NoError(t, err)
+				assert.Equal(t, 0, countExtensions(renewed[0], oidCTPoison))
+				assert.Equal(t, 1, countExtensions(renewed[0], oidSCTList))
+				precert := <-submitted
+				assert.Equal(t, renewed[0].SerialNumber, precert.SerialNumber)
+				assert.NotEqual(t, leaf.SerialNumber, precert.SerialNumber)
+				for _, ext := range renewed[0].Extensions {
+					if ext.Id.Equal(oidSCTList) {
+						for _, old := range leaf.Extensions {
+							if old.Id.Equal(oidSCTList) {
+								assert.NotEqual(t, old.Value, ext.Value)
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_Sign_keyAttestation(t *testing.T) {
+	pub, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	attestation, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Attested Key"},
+		PublicKey: pub,
+	})
+	require.NoError(t, err)
+	ext, err := provisioner.NewKeyAttestationStatementExtension([]*x509.Certificate{attestation, ca.Intermediate})
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{X509: &provisioner.X509Options{
+		KeyAttestation: &provisioner.KeyAttestationOptions{
+			Roots:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+			Required: true,
+		},
+	}}
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}
+
+	// Requests without a key attestation are rejected.
+	_, err = a.SignWithContext(ctx, getCSR(t, priv), signOpts, extraOpts...)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+
+	// The certificate records the result of the attestation.
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv, setExtraExtsCSR([]pkix.Extension{ext})), signOpts, extraOpts...)
+	require.NoError(t, err)
+	fingerprint := sha256.Sum256(attestation.Raw)
+	ka, ok := provisioner.GetKeyAttestation(chain[0])
+	require.True(t, ok)
+	assert.Equal(t, provisioner.KeyAttestation{Result: provisioner.AttestationPass, Fingerprint: fingerprint[:]}, ka)
+
+	// Renewals keep the attestation, the new key of a rekey is not attested.
+	renewed, err := a.Renew(chain[0])
+	require.NoError(t, err)
+	ka, ok = provisioner.GetKeyAttestation(renewed[0])
+	require.True(t, ok)
+	assert.Equal(t, provisioner.AttestationPass, ka.Result)
+
+	newPub, _, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	rekeyed, err := a.Rekey(chain[0], newPub)
+	require.NoError(t, err)
+	_, ok = provisioner.GetKeyAttestation(rekeyed[0])
+	assert.False(t, ok)
+
+	// Trust anchors are validated on Init.
+	p.Options.X509.KeyAttestation.Roots = []byte("not a certificate")
+	assert.Error(t, p.Init(config))
+}
+
+func TestAuthority_Sign_signatureAlgorithm(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	ca, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}))
+	require.NoError(t, err)
+
+	a := testAuthority(t, WithX509Signer(ca.Intermediate, ca.Signer))
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{X509: &provisioner.X509Options{
+		SignatureAlgorithm: "SHA256-RSAPSS",
+	}}
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	now := time.Now()
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}, extraOpts...)
+	require.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSAPSS, chain[0].SignatureAlgorithm)
+	require.NoError(t, chain[0].CheckSignatureFrom(ca.Intermediate))
+
+	// Requests cannot select another algorithm.
+	_, err = a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+		NotBefore:          provisioner.NewTimeDuration(now),
+		NotAfter:           provisioner.NewTimeDuration(now.Add(time.Hour)),
+		SignatureAlgorithm: "SHA256-RSA",
+	}, extraOpts...)
+	assert.Error(t, err)
+
+	// Renewals use the same algorithm.
+	renewed, err := a.Renew(chain[0])
+	require.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSAPSS, renewed[0].SignatureAlgorithm)
+	require.NoError(t, renewed[0].CheckSignatureFrom(ca.Intermediate))
+
+	// The algorithm must be supported by the key of the signer.
+	p.Options.X509.SignatureAlgorithm = "ECDSA-SHA256"
+	assert.Error(t, p.Init(config))
+}
+
+func TestAuthority_Sign_forbidCommonName(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	p.Options = &provisioner.Options{X509: &provisioner.X509Options{
+		ForbidCommonName: true,
+	}}
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}
+
+	// Requests with a common name are rejected.
+	_, err = a.SignWithContext(ctx, getCSR(t, priv), signOpts, extraOpts...)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+
+	// The common name set by the template from the token is removed.
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv, func(csr *x509.CertificateRequest) {
+		csr.Subject.CommonName = ""
+	}), signOpts, extraOpts...)
+	require.NoError(t, err)
+	assert.Empty(t, chain[0].Subject.CommonName)
+	assert.Equal(t, []string{"test.smallstep.com"}, chain[0].DNSNames)
+	for _, ext := range chain[0].Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 17}) {
+			assert.True(t, ext.Critical, "subject alternative name extension is not critical")
+		}
+	}
+}
+
+func TestAuthority_Sign_intermediateCA(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	bcExt := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Critical: true}
+	bcExt.Value, err = asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: 4})
+	require.NoError(t, err)
+
+	intermediateCA := provisioner.X509IntermediateCA{
+		MaxPathLen: 0,
+		NameConstraints: &x509util.NameConstraints{
+			Critical:            true,
+			PermittedDNSDomains: []string{".smallstep.com"},
+			ExcludedDNSDomains:  []string{"internal.smallstep.com"},
+		},
+	}
+
+	a := testAuthority(t)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	now := time.Now()
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv, setExtraExtsCSR([]pkix.Extension{bcExt})), provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}, append(extraOpts, intermediateCA)...)
+	require.NoError(t, err)
+
+	crt := chain[0]
+	assert.True(t, crt.BasicConstraintsValid)
+	assert.True(t, crt.IsCA)
+	assert.Equal(t, 0, crt.MaxPathLen)
+	assert.True(t, crt.MaxPathLenZero)
+	assert.True(t, crt.PermittedDNSDomainsCritical)
+	assert.Equal(t, []string{".smallstep.com"}, crt.PermittedDNSDomains)
+	assert.Equal(t, []string{"internal.smallstep.com"}, crt.ExcludedDNSDomains)
+	assert.Equal(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign|x509.KeyUsageDigitalSignature, crt.KeyUsage)
+	assert.Empty(t, crt.ExtKeyUsage)
+
+	// The same request without the option is rejected.
+	_, err = a.SignWithContext(ctx, getCSR(t, priv, setExtraExtsCSR([]pkix.Extension{bcExt})), provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}, extraOpts...)
+	require.Error(t, err)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+
+	// The template of other provisioners cannot create CA certificates.
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	for _, tmpl := range []string{
+		`{"subject": {{ toJson .Subject }}, "basicConstraints": {"isCA": true, "maxPathLen": 0}}`,
+		`{"subject": {{ toJson .Subject }}, "keyUsage": ["certSign"]}`,
+		`{"subject": {{ toJson .Subject }}, "extensions": [{"id": "2.5.29.19", "critical": true, "value": "MAMBAf8="}]}`,
+	} {
+		p.Options = &provisioner.Options{X509: &provisioner.X509Options{Template: tmpl}}
+		require.NoError(t, p.Init(config))
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		extraOpts, err := a.Authorize(ctx, token)
+		require.NoError(t, err)
+		_, err = a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+			NotBefore: provisioner.NewTimeDuration(now),
+			NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+		}, extraOpts...)
+		require.ErrorContains(t, err, "certificate template for a CA certificate is not allowed", tmpl)
+		require.ErrorAs(t, err, &sc, tmpl)
+		assert.Equal(t, http.StatusForbidden, sc.StatusCode(), tmpl)
+	}
+}
+
+func TestAuthority_PreviewSign(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MUseToken: func(id, tok string) (bool, error) {
+			t.Error("UseToken should not be called")
+			return false, nil
+		},
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			t.Error("StoreCertificate should not be called")
+			return nil
+		},
+	}
+
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, now, key)
+		require.NoError(t, err)
+		crt, err := a.PreviewSign(context.Background(), token, getCSR(t, priv), signOpts)
+		require.NoError(t, err)
+		assert.Equal(t, "smallstep test", crt.Subject.CommonName)
+		assert.Equal(t, []string{"test.smallstep.com"}, crt.DNSNames)
+		assert.WithinDuration(t, now, crt.NotBefore, time.Second)
+		assert.WithinDuration(t, now.Add(time.Hour), crt.NotAfter, time.Second)
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, crt.ExtKeyUsage)
+		assert.Nil(t, crt.SerialNumber)
+		assert.Nil(t, crt.Raw)
+
+		// The token can still be used to sign a certificate.
+		_, err = a.PreviewSign(context.Background(), token, getCSR(t, priv), signOpts)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail too many previews", func(t *testing.T) {
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, now, key)
+		require.NoError(t, err)
+		for i := 0; i < maxTokenPreviews; i++ {
+			_, err := a.PreviewSign(context.Background(), token, getCSR(t, priv), signOpts)
+			require.NoError(t, err)
+		}
+		_, err = a.PreviewSign(context.Background(), token, getCSR(t, priv), signOpts)
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusTooManyRequests, sc.StatusCode())
+	})
+
+	t.Run("fail token", func(t *testing.T) {
+		_, err := a.PreviewSign(context.Background(), "foo", getCSR(t, priv), signOpts)
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+	})
+
+	t.Run("fail sans", func(t *testing.T) {
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"other.smallstep.com"}, now, key)
+		require.NoError(t, err)
+		_, err = a.PreviewSign(context.Background(), token, getCSR(t, priv), signOpts)
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+	})
+}
+
+func TestAuthority_Sign_ocspServer(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		ocsp *config.OCSPConfig
+		want []string
+	}{
+		{"ok no ocsp", nil, nil},
+		{"ok no url", &config.OCSPConfig{}, nil},
+		{"ok url", &config.OCSPConfig{URL: "https://ca.smallstep.com/1.0/ocsp"}, []string{"https://ca.smallstep.com/1.0/ocsp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.OCSP = tt.ocsp
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+			require.NoError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			now := time.Now()
+			chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+				NotBefore: provisioner.NewTimeDuration(now),
+				NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+			}, extraOpts...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, chain[0].OCSPServer)
+		})
+	}
+}
+
+type duplicateDNSNamesDB struct {
+	certificateChainDB
+	certs    map[string][]*x509.Certificate
+	disabled bool
+}
+
+func (d *duplicateDNSNamesDB) HasDNSNamesIndex() bool {
+	return !d.disabled
+}
+
+func (d *duplicateDNSNamesDB) GetCertificatesByDNSName(name string) ([]*x509.Certificate, error) {
+	return d.certs[name], nil
+}
+
+func TestAuthority_Sign_duplicateDNSNames(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	require.NoError(t, err)
+	templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+	require.NoError(t, err)
+
+	now := time.Now()
+	validity := withNotBeforeNotAfter(now, now.Add(time.Hour))
+	newDB := func(revoked map[string]bool, revokeErr error) *duplicateDNSNamesDB {
+		d := &duplicateDNSNamesDB{certs: map[string][]*x509.Certificate{}}
+		d.MStoreCertificateChain = func(_ provisioner.Interface, certs ...*x509.Certificate) error {
+			for _, name := range certs[0].DNSNames {
+				d.certs[name] = append(d.certs[name], certs[0])
+			}
+			return nil
+		}
+		d.MIsRevoked = func(sn string) (bool, error) {
+			return revoked[sn], nil
+		}
+		d.MRevoke = func(rci *db.RevokedCertificateInfo) error {
+			if revokeErr != nil {
+				return revokeErr
+			}
+			assert.Equal(t, ocsp.Superseded, rci.ReasonCode)
+			revoked[rci.Serial] = true
+			return nil
+		}
+		return d
+	}
+
+	tests := []struct {
+		name         string
+		policy       provisioner.DuplicateDNSNamesPolicy
+		existing     int
+		isRevoked    bool
+		revokeErr    error
+		wantErr      bool
+		wantRevoked  bool
+		wantWarnings int
+	}{
+		{"ok allow", "", 1, false, nil, false, false, 0},
+		{"ok revoke", provisioner.DuplicateDNSNamesRevoke, 1, false, nil, false, true, 0},
+		{"ok revoke multiple", provisioner.DuplicateDNSNamesRevoke, 3, false, nil, false, true, 0},
+		{"ok revoke error", provisioner.DuplicateDNSNamesRevoke, 2, false, errors.New("force"), false, false, 2},
+		{"ok reject revoked", provisioner.DuplicateDNSNamesReject, 2, true, nil, false, true, 0},
+		{"fail reject", provisioner.DuplicateDNSNamesReject, 1, false, nil, true, false, 0},
+		{"fail reject multiple", provisioner.DuplicateDNSNamesReject, 2, false, nil, true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked := map[string]bool{}
+			auth, err := NewEmbedded(WithX509RootCerts(ca.Root), WithX509Signer(ca.Intermediate, ca.Signer), WithDatabase(newDB(revoked, tt.revokeErr)))
+			require.NoError(t, err)
+
+			var existing []*x509.Certificate
+			for i := 0; i < tt.existing; i++ {
+				chain, err := auth.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, templateOption, validity)
+				require.NoError(t, err)
+				revoked[chain[0].SerialNumber.String()] = tt.isRevoked
+				existing = append(existing, chain[0])
+			}
+
+			ctx := NewWarningsContext(context.Background())
+			chain, err := auth.SignWithContext(ctx, csr, provisioner.SignOptions{}, templateOption, validity, tt.policy)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			for _, crt := range existing {
+				assert.NotEqual(t, crt.SerialNumber, chain[0].SerialNumber)
+				assert.Equal(t, tt.wantRevoked, revoked[crt.SerialNumber.String()])
+			}
+			assert.False(t, revoked[chain[0].SerialNumber.String()])
+			assert.Len(t, WarningsFromContext(ctx), tt.wantWarnings)
+		})
+	}
+}
+
+func TestAuthority_duplicateDNSNamesIndex(t *testing.T) {
+	a := testAuthority(t)
+	newProvisioner := func() *provisioner.JWK {
+		p := *a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+		p.Options = &provisioner.Options{
+			X509: &provisioner.X509Options{DuplicateDNSNames: provisioner.DuplicateDNSNamesRevoke},
+		}
+		return &p
+	}
+
+	a.db = &duplicateDNSNamesDB{}
+	config, err := a.generateProvisionerConfig(context.Background())
+	require.NoError(t, err)
+	assert.True(t, config.DNSNamesIndex)
+	require.NoError(t, newProvisioner().Init(config))
+
+	for _, d := range []db.AuthDB{&certificateChainDB{}, &duplicateDNSNamesDB{disabled: true}} {
+		a.db = d
+		config, err = a.generateProvisionerConfig(context.Background())
+		require.NoError(t, err)
+		assert.False(t, config.DNSNamesIndex)
+		assert.EqualError(t, newProvisioner().Init(config), "x509.duplicateDNSNames requires the database index of DNS names, enable it with db.indexDNSNames")
+	}
+}
+
+type shadowPolicyMeter struct {
+	noopMeter
+	errs []error
+}
+
+func (m *shadowPolicyMeter) X509PolicyShadowed(_ provisioner.Interface, err error) {
+	m.errs = append(m.errs, err)
+}
+
+func TestAuthority_Sign_shadowPolicy(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	templateOption := func(name string) provisioner.SignOption {
+		opt, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData(name, []string{name}))
+		require.NoError(t, err)
+		return opt
+	}
+
+	now := time.Now()
+	validity := withNotBeforeNotAfter(now, now.Add(time.Hour))
+
+	meter := new(shadowPolicyMeter)
+	auth, err := NewEmbedded(WithX509RootCerts(ca.Root), WithX509Signer(ca.Intermediate, ca.Signer),
+		WithDatabase(&db.MockAuthDB{}), WithMeter(meter))
+	require.NoError(t, err)
+	auth.policyEngine, err = policy.New(&policy.Options{
+		X509: &policy.X509PolicyOptions{
+			DeniedNames: &policy.X509NameOptions{
+				DNSDomains: []string{"denied.smallstep.com"},
+			},
+			Shadow: true,
+		},
+	})
+	require.NoError(t, err)
+
+	var warnings [][]string
+	for _, name := range []string{"allowed.smallstep.com", "denied.smallstep.com"} {
+		csr, err := x509util.CreateCertificateRequest(name, []string{name}, signer)
+		require.NoError(t, err)
+		ctx := NewWarningsContext(context.Background())
+		chain, err := auth.SignWithContext(ctx, csr, provisioner.SignOptions{}, templateOption(name), validity)
+		require.NoError(t, err)
+		assert.Equal(t, []string{name}, chain[0].DNSNames)
+		warnings = append(warnings, WarningsFromContext(ctx))
+	}
+
+	require.Len(t, meter.errs, 2)
+	assert.NoError(t, meter.errs[0])
+	assert.EqualError(t, meter.errs[1], `dns name "denied.smallstep.com" not allowed`)
+	assert.Empty(t, warnings[0])
+	assert.Equal(t, []string{`x509 policy in shadow mode would have denied the certificate: dns name "denied.smallstep.com" not allowed`}, warnings[1])
+	assert.NoError(t, auth.AreSANsAllowed(context.Background(), []string{"denied.smallstep.com"}))
+}
+
+func TestAuthority_Sign_csrLimits(t *testing.T) {
+	a := testAuthority(t)
+	p := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+	one := 1
+	p.Claims.MaxCSRExtensions = &one
+	t.Cleanup(func() {
+		p.Claims.MaxCSRExtensions = nil
+	})
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	templateOption, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData("test.smallstep.com", []string{"test.smallstep.com"}))
+	require.NoError(t, err)
+	now := time.Now()
+	validity := withNotBeforeNotAfter(now, now.Add(time.Hour))
+
+	csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+	require.NoError(t, err)
+	_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, p, templateOption, validity)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames: []string{"test.smallstep.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}, Value: []byte{0x05, 0x00}},
+		},
+	}, signer)
+	require.NoError(t, err)
+	csr, err = x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, p, templateOption, validity)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+	assert.Contains(t, err.Error(), "certificate request with 2 extensions is more than the allowed maximum of 1 extensions")
+}
+
+func Test_checkIssuerNotBefore(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	issuer := &x509.Certificate{NotBefore: now, NotAfter: now.Add(24 * time.Hour)}
+	requested := provisioner.SignOptions{NotBefore: provisioner.NewTimeDuration(now.Add(-time.Second))}
+
+	tests := []struct {
+		name          string
+		notBefore     time.Time
+		issuer        *x509.Certificate
+		signOpts      provisioner.SignOptions
+		wantNotBefore time.Time
+		wantErr       bool
+	}{
+		{"ok no issuer", now.Add(-time.Minute), nil, provisioner.SignOptions{}, now.Add(-time.Minute), false},
+		{"ok after issuer", now.Add(time.Second), issuer, provisioner.SignOptions{}, now.Add(time.Second), false},
+		{"ok at issuer start", now, issuer, requested, now, false},
+		{"ok backdate clamped", now.Add(-time.Minute), issuer, provisioner.SignOptions{Backdate: time.Minute}, now, false},
+		{"fail requested before issuer", now.Add(-time.Second), issuer, requested, now.Add(-time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaf := &x509.Certificate{NotBefore: tt.notBefore, NotAfter: now.Add(time.Hour)}
+			err := checkIssuerNotBefore(leaf, tt.issuer, tt.signOpts)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantNotBefore, leaf.NotBefore)
+		})
+	}
+}
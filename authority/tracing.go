@@ -0,0 +1,70 @@
+package authority
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// tracerName is the name of the tracer used to instrument the authority.
+const tracerName = "github.com/smallstep/certificates/authority"
+
+// Attributes added to the spans created by the authority. The tokens are never
+// recorded, only the provisioner that was used and the result of the
+// authorization.
+const (
+	provisionerTypeAttribute = attribute.Key("step.provisioner.type")
+	provisionerNameAttribute = attribute.Key("step.provisioner.name")
+	decisionAttribute        = attribute.Key("step.authorization.decision")
+)
+
+const (
+	decisionAllow = "allow"
+	decisionDeny  = "deny"
+)
+
+// startSpan starts a span with the given name using the tracer provider of the
+// authority. If no tracer provider has been set, the span is a no-op.
+func (a *Authority) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	tp := a.tracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName).Start(ctx, name)
+}
+
+// setSpanProvisioner adds the type and the name of the provisioner to the span.
+func setSpanProvisioner(span trace.Span, p provisioner.Interface) {
+	if p == nil {
+		return
+	}
+	span.SetAttributes(
+		provisionerTypeAttribute.String(p.GetType().String()),
+		provisionerNameAttribute.String(p.GetName()),
+	)
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endAuthorizationSpan adds the decision of an authorization to the span and
+// ends it.
+func endAuthorizationSpan(span trace.Span, err error) {
+	decision := decisionAllow
+	if err != nil {
+		decision = decisionDeny
+	}
+	span.SetAttributes(decisionAttribute.String(decision))
+	endSpan(span, err)
+}
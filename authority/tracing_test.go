@@ -0,0 +1,152 @@
+package authority
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// recordingTracerProvider is a trace.TracerProvider that keeps the spans
+// created.
+type recordingTracerProvider struct {
+	embedded.TracerProvider
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (tp *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{tp: tp}
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	tp *recordingTracerProvider
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	tp := t.tp
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	s := &recordingSpan{name: name, attributes: map[attribute.Key]attribute.Value{}}
+	tp.spans = append(tp.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (tp *recordingTracerProvider) span(name string) *recordingSpan {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, s := range tp.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type recordingSpan struct {
+	noop.Span
+	name       string
+	attributes map[attribute.Key]attribute.Value
+	status     codes.Code
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, v := range kv {
+		s.attributes[v.Key] = v.Value
+	}
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+func (s *recordingSpan) End(...trace.SpanEndOption)          { s.ended = true }
+
+func TestAuthority_tracing(t *testing.T) {
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		tp := new(recordingTracerProvider)
+		a := testAuthority(t, WithTracerProvider(tp))
+
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		extraOpts, err := a.Authorize(ctx, token)
+		require.NoError(t, err)
+
+		now := time.Now()
+		_, err = a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+			NotBefore: provisioner.NewTimeDuration(now),
+			NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+		}, extraOpts...)
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			"authority.authorizeSign", "authority.authorizeToken", "provisioner.AuthorizeSign",
+			"authority.Sign", "authority.isAllowedToSignX509Certificate", "authority.createCertificate",
+		} {
+			s := tp.span(name)
+			if assert.NotNil(t, s, name) {
+				assert.True(t, s.ended, name)
+				assert.Equal(t, codes.Unset, s.status, name)
+			}
+		}
+
+		s := tp.span("authority.authorizeSign")
+		assert.Equal(t, map[attribute.Key]attribute.Value{
+			provisionerTypeAttribute: attribute.StringValue("JWK"),
+			provisionerNameAttribute: attribute.StringValue("step-cli"),
+			decisionAttribute:        attribute.StringValue(decisionAllow),
+		}, s.attributes)
+		assert.Equal(t, attribute.StringValue("JWK"), tp.span("authority.Sign").attributes[provisionerTypeAttribute])
+		for _, s := range tp.spans {
+			for _, v := range s.attributes {
+				assert.NotEqual(t, token, v.AsString())
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		tp := new(recordingTracerProvider)
+		a := testAuthority(t, WithTracerProvider(tp))
+
+		token, err := generateToken("smallstep test", "step-cli", "https://example.com/revoke", []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		_, err = a.Authorize(ctx, token)
+		require.Error(t, err)
+
+		s := tp.span("authority.authorizeSign")
+		require.NotNil(t, s)
+		assert.True(t, s.ended)
+		assert.Equal(t, codes.Error, s.status)
+		assert.Equal(t, attribute.StringValue(decisionDeny), s.attributes[decisionAttribute])
+		assert.Equal(t, attribute.StringValue("step-cli"), s.attributes[provisionerNameAttribute])
+		assert.Equal(t, codes.Error, tp.span("provisioner.AuthorizeSign").status)
+	})
+
+	t.Run("ok no tracer provider", func(t *testing.T) {
+		a := testAuthority(t, WithTracerProvider(nil))
+		assert.NotNil(t, a.tracerProvider)
+
+		a.tracerProvider = nil
+		_, span := a.startSpan(context.Background(), "authority.Sign")
+		assert.False(t, span.IsRecording())
+		endAuthorizationSpan(span, nil)
+	})
+}
@@ -0,0 +1,130 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+// warmupMessage is the message signed by the KMS signers on warm-up.
+const warmupMessage = "step-ca kms warm-up"
+
+// warmupMinBackoff and warmupMaxBackoff are the minimum and maximum delays
+// between the retries of a failed warm-up.
+const (
+	warmupMinBackoff = time.Second
+	warmupMaxBackoff = time.Minute
+)
+
+// kmsSigner is a signer created with the key manager.
+type kmsSigner struct {
+	name   string
+	signer crypto.Signer
+}
+
+// createSigner creates a signer with the key manager and keeps a reference to
+// it so it can be warmed up on initialization.
+func (a *Authority) createSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	signer, err := a.keyManager.CreateSigner(req)
+	if err != nil {
+		return nil, err
+	}
+	a.kmsSigners = append(a.kmsSigners, &kmsSigner{
+		name:   req.SigningKey,
+		signer: signer,
+	})
+	return signer, nil
+}
+
+// warmupSigners signs a test digest with each KMS signer if the warm-up is
+// configured. On failure, it returns an error if the warm-up is fatal, or logs
+// a warning and leaves the authority as not ready while the warm-up is retried
+// in the background, with an exponential backoff.
+func (a *Authority) warmupSigners() error {
+	if a.config.KMSWarmup == nil {
+		a.ready.Store(true)
+		return nil
+	}
+
+	if err := a.warmupAll(); err != nil {
+		if a.config.KMSWarmup.Fatal {
+			return err
+		}
+		log.Printf("warning: %v", err)
+		a.warmupStopper = make(chan struct{})
+		go a.retryWarmup(a.warmupStopper, warmupMinBackoff, warmupMaxBackoff)
+		return nil
+	}
+
+	a.ready.Store(true)
+	return nil
+}
+
+// warmupAll warms up all the KMS signers, it stops on the first error.
+func (a *Authority) warmupAll() error {
+	for _, s := range a.kmsSigners {
+		if err := warmupSigner(s.signer); err != nil {
+			return errors.Wrapf(err, "error warming up signer %q", s.name)
+		}
+	}
+	return nil
+}
+
+// retryWarmup retries the warm-up of the KMS signers until it succeeds or the
+// stop channel is closed. The delay between retries starts at minBackoff and
+// doubles on each failure up to maxBackoff. The authority is marked as ready
+// when the warm-up succeeds.
+func (a *Authority) retryWarmup(stop <-chan struct{}, minBackoff, maxBackoff time.Duration) {
+	backoff := minBackoff
+	for {
+		t := time.NewTimer(backoff)
+		select {
+		case <-stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := a.warmupAll(); err != nil {
+			log.Printf("warning: %v", err)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		log.Printf("kms signers warmed up, the authority is ready")
+		a.ready.Store(true)
+		return
+	}
+}
+
+// stopWarmup stops the retries of the warm-up, if any.
+func (a *Authority) stopWarmup() {
+	if a.warmupStopper != nil {
+		close(a.warmupStopper)
+		a.warmupStopper = nil
+	}
+}
+
+// warmupSigner signs the warm-up message with the given signer.
+func warmupSigner(signer crypto.Signer) error {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		_, err := signer.Sign(rand.Reader, []byte(warmupMessage), crypto.Hash(0))
+		return err
+	}
+	sum := sha256.Sum256([]byte(warmupMessage))
+	_, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	return err
+}
+
+// IsReady returns true if the authority is ready to sign certificates. An
+// authority is not ready while the warm-up of the KMS signers fails.
+func (a *Authority) IsReady() bool {
+	return a.ready.Load()
+}
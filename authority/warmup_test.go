@@ -0,0 +1,124 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/authority/config"
+)
+
+type failSigner struct {
+	crypto.Signer
+}
+
+func (s *failSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("kms is not available")
+}
+
+func TestAuthority_warmupSigners(t *testing.T) {
+	ecSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	_, edSigner, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	okSigners := []*kmsSigner{
+		{"ec.key", ecSigner},
+		{"ed.key", edSigner},
+	}
+	failSigners := append([]*kmsSigner{}, okSigners[0], &kmsSigner{"fail.key", &failSigner{ecSigner}})
+
+	tests := []struct {
+		name      string
+		warmup    *config.KMSWarmupConfig
+		signers   []*kmsSigner
+		wantReady bool
+		wantErr   bool
+	}{
+		{"ok disabled", nil, failSigners, true, false},
+		{"ok", &config.KMSWarmupConfig{}, okSigners, true, false},
+		{"ok fatal", &config.KMSWarmupConfig{Fatal: true}, okSigners, true, false},
+		{"ok warn", &config.KMSWarmupConfig{}, failSigners, false, false},
+		{"fail fatal", &config.KMSWarmupConfig{Fatal: true}, failSigners, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config:     &config.Config{KMSWarmup: tt.warmup},
+				kmsSigners: tt.signers,
+			}
+			err := a.warmupSigners()
+			t.Cleanup(a.stopWarmup)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, `error warming up signer "fail.key"`)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantReady, a.IsReady())
+		})
+	}
+}
+
+// flakySigner fails until ok is set.
+type flakySigner struct {
+	crypto.Signer
+	ok    atomic.Bool
+	calls atomic.Int32
+}
+
+func (s *flakySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls.Add(1)
+	if !s.ok.Load() {
+		return nil, errors.New("kms is not available")
+	}
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestAuthority_retryWarmup(t *testing.T) {
+	ecSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		signer := &flakySigner{Signer: ecSigner}
+		a := &Authority{
+			config:     &config.Config{KMSWarmup: &config.KMSWarmupConfig{}},
+			kmsSigners: []*kmsSigner{{"flaky.key", signer}},
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			a.retryWarmup(make(chan struct{}), time.Millisecond, 4*time.Millisecond)
+		}()
+		require.Eventually(t, func() bool { return signer.calls.Load() >= 3 }, time.Second, time.Millisecond)
+		assert.False(t, a.IsReady())
+		signer.ok.Store(true)
+		<-done
+		assert.True(t, a.IsReady())
+	})
+
+	t.Run("ok stop", func(t *testing.T) {
+		signer := &flakySigner{Signer: ecSigner}
+		a := &Authority{
+			config:     &config.Config{KMSWarmup: &config.KMSWarmupConfig{}},
+			kmsSigners: []*kmsSigner{{"flaky.key", signer}},
+		}
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			a.retryWarmup(stop, time.Millisecond, time.Millisecond)
+		}()
+		require.Eventually(t, func() bool { return signer.calls.Load() >= 1 }, time.Second, time.Millisecond)
+		close(stop)
+		<-done
+		assert.False(t, a.IsReady())
+	})
+}
@@ -0,0 +1,42 @@
+package authority
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type warningsKey struct{}
+
+// warnings holds the non-fatal actions taken while signing a certificate.
+type warnings struct {
+	mu   sync.Mutex
+	list []string
+}
+
+// NewWarningsContext returns a context that collects the warnings produced
+// while a certificate is signed or renewed. Warnings describe non-fatal policy
+// actions, like a clamped validity or a denial of a policy in shadow mode.
+func NewWarningsContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, warningsKey{}, &warnings{})
+}
+
+// WarningsFromContext returns the warnings collected in the given context.
+func WarningsFromContext(ctx context.Context) []string {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.list...)
+}
+
+// addWarning adds a warning to the context if the context collects them.
+func addWarning(ctx context.Context, format string, args ...interface{}) {
+	if w, ok := ctx.Value(warningsKey{}).(*warnings); ok {
+		w.mu.Lock()
+		w.list = append(w.list, fmt.Sprintf(format, args...))
+		w.mu.Unlock()
+	}
+}
@@ -256,12 +256,17 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// ACME Router is only available if we have a database.
 	var acmeDB acme.DB
 	var acmeLinker acme.Linker
+	var acmeClient acme.Client
 	if cfg.DB != nil {
 		acmeDB, err = acmeNoSQL.New(auth.GetDatabase().(nosql.DB))
 		if err != nil {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
 		acmeLinker = acme.NewLinker(dns, "acme")
+		acmeClient, err = newACMEClient(cfg.ACME)
+		if err != nil {
+			return nil, err
+		}
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -346,7 +351,7 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	insecureHandler = requestid.New(legacyTraceHeader).Middleware(insecureHandler)
 
 	// Create context with all the necessary values.
-	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
+	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker, acmeClient)
 
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
 	ca.srv.BaseContext = func(net.Listener) context.Context {
@@ -393,8 +398,21 @@ func (ca *CA) shouldServeInsecureServer() bool {
 	}
 }
 
+// newACMEClient returns the client used to validate ACME challenges. If a
+// validation source address is configured, it must be available on the host.
+func newACMEClient(cfg *config.ACMEConfig) (acme.Client, error) {
+	ip := cfg.GetValidationSourceAddress()
+	if ip == nil {
+		return acme.NewClient(), nil
+	}
+	if err := acme.CheckSourceAddress(ip); err != nil {
+		return nil, err
+	}
+	return acme.NewClient(acme.WithSourceAddress(ip)), nil
+}
+
 // buildContext builds the server base context.
-func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
+func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker, acmeClient acme.Client) context.Context {
 	ctx := authority.NewContext(context.Background(), a)
 	if authDB := a.GetDatabase(); authDB != nil {
 		ctx = db.NewContext(ctx, authDB)
@@ -406,7 +424,10 @@ func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB
 		ctx = scep.NewContext(ctx, scepAuthority)
 	}
 	if acmeDB != nil {
-		ctx = acme.NewContext(ctx, acmeDB, acme.NewClient(), acmeLinker, nil)
+		if acmeClient == nil {
+			acmeClient = acme.NewClient()
+		}
+		ctx = acme.NewContext(ctx, acmeDB, acmeClient, acmeLinker, nil)
 	}
 	return ctx
 }
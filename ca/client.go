@@ -758,6 +758,77 @@ retry:
 	return &sign, nil
 }
 
+// Validate performs the validate request to the CA with an empty context and
+// returns the api.ValidateResponse struct.
+func (c *Client) Validate(req *api.ValidateRequest) (*api.ValidateResponse, error) {
+	return c.ValidateWithContext(context.Background(), req)
+}
+
+// ValidateWithContext performs the validate request to the CA with the
+// provided context and returns the api.ValidateResponse struct. The token is
+// not marked as used by the CA.
+func (c *Client) ValidateWithContext(ctx context.Context, req *api.ValidateRequest) (*api.ValidateResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.Validate; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/validate"})
+retry:
+	resp, err := c.client.PostWithContext(ctx, u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var validate api.ValidateResponse
+	if err := readJSON(resp.Body, &validate); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Validate; error reading %s", u)
+	}
+	return &validate, nil
+}
+
+// PreviewSign performs the sign preview request to the CA with an empty
+// context and returns the api.PreviewSignResponse struct.
+func (c *Client) PreviewSign(req *api.SignRequest) (*api.PreviewSignResponse, error) {
+	return c.PreviewSignWithContext(context.Background(), req)
+}
+
+// PreviewSignWithContext performs the sign preview request to the CA with the
+// provided context and returns the api.PreviewSignResponse struct with the
+// certificate that would be issued for the request. The token is not marked
+// as used by the CA.
+func (c *Client) PreviewSignWithContext(ctx context.Context, req *api.SignRequest) (*api.PreviewSignResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.PreviewSign; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign/preview"})
+retry:
+	resp, err := c.client.PostWithContext(ctx, u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var preview api.PreviewSignResponse
+	if err := readJSON(resp.Body, &preview); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.PreviewSign; error reading %s", u)
+	}
+	return &preview, nil
+}
+
 // Renew performs the renew request to the CA with an empty context and
 // returns the api.SignResponse struct.
 func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
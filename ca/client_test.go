@@ -27,6 +27,7 @@ import (
 	"github.com/smallstep/certificates/errs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
 )
@@ -357,6 +358,116 @@ func TestClient_Sign(t *testing.T) {
 	}
 }
 
+func TestClient_Validate(t *testing.T) {
+	ok := &api.ValidateResponse{
+		Provisioner:     "jwk",
+		ProvisionerType: "JWK",
+		Claims: &authority.Claims{
+			Claims: jose.Claims{Subject: "test.smallstep.com", Issuer: "jwk"},
+			SANs:   []string{"test.smallstep.com"},
+		},
+	}
+	request := &api.ValidateRequest{OTT: "the-ott"}
+
+	tests := []struct {
+		name         string
+		request      *api.ValidateRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		expectedErr  error
+	}{
+		{"ok", request, ok, 200, false, nil},
+		{"unauthorized", request, errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+		{"empty request", &api.ValidateRequest{}, errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestPrefix + "force.")},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/validate", req.URL.Path)
+				body := new(api.ValidateRequest)
+				require.NoError(t, read.JSON(req.Body, body))
+				assert.Equal(t, tt.request, body)
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.Validate(tt.request)
+			if tt.wantErr {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.response, got)
+		})
+	}
+}
+
+func TestClient_PreviewSign(t *testing.T) {
+	ok := &api.PreviewSignResponse{
+		Subject:            x509util.Subject{CommonName: "test.smallstep.com"},
+		DNSNames:           []string{"test.smallstep.com"},
+		NotBefore:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:           time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		KeyUsage:           x509util.KeyUsage(x509.KeyUsageDigitalSignature),
+		ExtKeyUsage:        x509util.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		PublicKeyAlgorithm: "ECDSA",
+	}
+	request := &api.SignRequest{
+		CsrPEM: api.CertificateRequest{CertificateRequest: parseCertificateRequest(t, csrPEM)},
+		OTT:    "the-ott",
+	}
+
+	tests := []struct {
+		name         string
+		request      *api.SignRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		expectedErr  error
+	}{
+		{"ok", request, ok, 200, false, nil},
+		{"unauthorized", request, errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+		{"empty request", &api.SignRequest{}, errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestPrefix + "force.")},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/sign/preview", req.URL.Path)
+				body := new(api.SignRequest)
+				require.NoError(t, read.JSON(req.Body, body))
+				assert.Equal(t, tt.request.OTT, body.OTT)
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.PreviewSign(tt.request)
+			if tt.wantErr {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.response, got)
+		})
+	}
+}
+
 func TestClient_Revoke(t *testing.T) {
 	ok := &api.RevokeResponse{Status: "ok"}
 	request := &api.RevokeRequest{
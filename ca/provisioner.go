@@ -188,12 +188,18 @@ func loadProvisionerJWKByName(client *Client, name string, password []byte) (*jo
 		return nil, errors.Wrap(err, "error getting the provisioners")
 	}
 
-	for _, provisioner := range provisioners {
-		if provisioner.GetName() == name {
-			if _, encryptedKey, ok := provisioner.GetEncryptedKey(); ok {
-				if key, err := decryptProvisionerJWK(encryptedKey, password); err == nil {
-					return key, nil
-				}
+	for _, p := range provisioners {
+		if p.GetName() != name {
+			continue
+		}
+		// JWK provisioners can use a KMS key instead of the password.
+		if jwk, ok := p.(*provisioner.JWK); ok && jwk.DecrypterKeyURI != "" {
+			if key, err := jwk.DecryptKey(nil); err == nil {
+				return key, nil
+			}
+		} else if _, encryptedKey, ok := p.GetEncryptedKey(); ok {
+			if key, err := decryptProvisionerJWK(encryptedKey, password); err == nil {
+				return key, nil
 			}
 		}
 	}
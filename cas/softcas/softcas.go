@@ -81,6 +81,8 @@ func (c *SoftCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1
 	if err != nil {
 		return nil, err
 	}
+	// The issuer in the certificate is always the raw subject of the
+	// intermediate, so DN-based chain building works with any encoding.
 	req.Template.Issuer = chain[0].Subject
 
 	cert, err := createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
@@ -10,6 +10,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"io"
 	"math/big"
@@ -518,6 +519,73 @@ func TestSoftCAS_CreateCertificate_ec_rsa(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CreateCertificate_rawIssuer(t *testing.T) {
+	// A legacy subject using a PrintableString country, a T61String
+	// organization and a multi-valued RDN, in an order that Go would not use
+	// when encoding a pkix.Name.
+	rawSubject, err := asn1.Marshal([]pkix.RelativeDistinguishedNameSET{
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 6}, Value: asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte("US")}}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: asn1.RawValue{Tag: asn1.TagT61String, Bytes: []byte("Smallstep")}}},
+		{
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte("Legacy Intermediate CA")}},
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 11}, Value: asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte("Unit Test")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509util.CreateCertificate(&x509.Certificate{
+		RawSubject:            rawSubject,
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             testNow,
+		NotAfter:              testNow.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, testIssuer, testSigner.Public(), testSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure that the name would not be the same if it is re-encoded.
+	reencoded, err := asn1.Marshal(issuer.Subject.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(reencoded, issuer.RawSubject) {
+		t.Fatal("re-encoded subject is equal to the raw subject")
+	}
+
+	c := &SoftCAS{
+		CertificateChain: []*x509.Certificate{issuer},
+		Signer:           testSigner,
+	}
+
+	tmpl := *testTemplate
+	got, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &tmpl,
+		Lifetime: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCertificate() error = %v", err)
+	}
+	if !bytes.Equal(got.Certificate.RawIssuer, issuer.RawSubject) {
+		t.Errorf("SoftCAS.CreateCertificate() issuer = %x, want %x", got.Certificate.RawIssuer, issuer.RawSubject)
+	}
+
+	renewTmpl := *testTemplate
+	renewed, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: &renewTmpl,
+		Lifetime: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.RenewCertificate() error = %v", err)
+	}
+	if !bytes.Equal(renewed.Certificate.RawIssuer, issuer.RawSubject) {
+		t.Errorf("SoftCAS.RenewCertificate() issuer = %x, want %x", renewed.Certificate.RawIssuer, issuer.RawSubject)
+	}
+}
+
 func TestSoftCAS_RenewCertificate(t *testing.T) {
 	mockNow(t)
 
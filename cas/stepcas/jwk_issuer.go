@@ -36,7 +36,12 @@ func newJWKIssuer(ctx context.Context, caURL *url.URL, client *ca.Client, cfg *a
 		if !ok {
 			return nil, errors.Errorf("provisioner with name %s does not have an encrypted key", cfg.Provisioner)
 		}
-		signer, err = newJWKSignerFromEncryptedKey(kid, key, cfg.Password)
+		// The key of a JWK provisioner can be encrypted with a KMS key.
+		if jp, ok := p.(*provisioner.JWK); ok && jp.DecrypterKeyURI != "" {
+			signer, err = newJWKSignerFromKMS(jp)
+		} else {
+			signer, err = newJWKSignerFromEncryptedKey(kid, key, cfg.Password)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -145,6 +150,23 @@ func newJWKSignerFromEncryptedKey(kid, key, password string) (jose.Signer, error
 	return newJoseSigner(signer, so)
 }
 
+func newJWKSignerFromKMS(p *provisioner.JWK) (jose.Signer, error) {
+	jwk, err := p.DecryptKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := jwk.Key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("error parsing provisioner key: key is not a crypto.Signer")
+	}
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", p.Key.KeyID)
+	return newJoseSigner(signer, so)
+}
+
 func findProvisioner(ctx context.Context, client *ca.Client, typ provisioner.Type, name string) (provisioner.Interface, error) {
 	cursor := ""
 	for {
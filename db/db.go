@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +27,9 @@ var (
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	certsDNSNamesTable     = []byte("x509_certs_dns_names")
+	renewalsTable          = []byte("x509_renewals")
+	freezesTable           = []byte("provisioner_freezes")
 )
 
 // TODO: at the moment we store a single CRL in the database, in a dedicated table.
@@ -47,6 +51,11 @@ type Config struct {
 	// 'MemoryMap') to avoid memory-mapping log files. This can be useful
 	// in environments with low RAM
 	BadgerFileLoadingMode string `json:"badgerFileLoadingMode"`
+
+	// IndexDNSNames enables the index of the active certificates by DNS
+	// name. It is required by the provisioners that check duplicated DNS
+	// names.
+	IndexDNSNames bool `json:"indexDNSNames,omitempty"`
 }
 
 // AuthDB is an interface over an Authority DB client that implements a nosql.DB interface.
@@ -95,6 +104,29 @@ type CertificateStorer interface {
 	StoreSSHCertificate(crt *ssh.Certificate) error
 }
 
+// CertificateDNSNameDB is an interface to indicate whether the DB supports
+// looking up the active certificates issued for a DNS name.
+type CertificateDNSNameDB interface {
+	HasDNSNamesIndex() bool
+	GetCertificatesByDNSName(name string) ([]*x509.Certificate, error)
+}
+
+// CertificateRenewalDB is an interface to indicate whether the DB supports
+// locking the renewal of a certificate.
+type CertificateRenewalDB interface {
+	LockRenewal(serialNumber string, ttl time.Duration) (bool, string, error)
+	FinishRenewal(serialNumber, renewedSerialNumber string) error
+	UnlockRenewal(serialNumber string) error
+}
+
+// ProvisionerFreezeDB is an interface to indicate whether the DB supports
+// storing the freezes of the provisioners.
+type ProvisionerFreezeDB interface {
+	GetProvisionerFreezes() (map[string]*provisioner.Freeze, error)
+	StoreProvisionerFreeze(provisionerID string, f *provisioner.Freeze) error
+	DeleteProvisionerFreeze(provisionerID string) error
+}
+
 // CertificateRevocationListDB is an interface to indicate whether the DB supports CRL generation
 type CertificateRevocationListDB interface {
 	GetRevokedCertificates() (*[]RevokedCertificateInfo, error)
@@ -102,10 +134,17 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// RevokedCertificateDB is an interface to indicate whether the DB supports
+// returning the revocation information of a certificate.
+type RevokedCertificateDB interface {
+	GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error)
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
-	isUp bool
+	isUp          bool
+	dnsNamesIndex bool
 }
 
 // New returns a new database client that implements the AuthDB interface.
@@ -128,7 +167,8 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable, crlTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, certsDNSNamesTable,
+		renewalsTable, freezesTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -137,7 +177,7 @@ func New(c *Config) (AuthDB, error) {
 		}
 	}
 
-	return &DB{db, true}, nil
+	return &DB{DB: db, isUp: true, dnsNamesIndex: c.IndexDNSNames}, nil
 }
 
 // RevokedCertificateInfo contains information regarding the certificate
@@ -262,6 +302,21 @@ func (db *DB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	return &revokedCerts, nil
 }
 
+// GetRevokedCertificate returns the revocation information of the certificate
+// with the given serial number. It returns a not found error if the
+// certificate has not been revoked.
+func (db *DB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(serialNumber))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var rci RevokedCertificateInfo
+	if err := json.Unmarshal(b, &rci); err != nil {
+		return nil, errors.Wrap(err, "json Unmarshal error")
+	}
+	return &rci, nil
+}
+
 // StoreCRL stores a CRL in the DB
 func (db *DB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
 	crlInfoBytes, err := json.Marshal(crlInfo)
@@ -370,6 +425,7 @@ func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Cert
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
+	db.storeDNSNames(leaf)
 	return nil
 }
 
@@ -395,6 +451,213 @@ func (db *DB) StoreRenewedCertificate(oldCert *x509.Certificate, chain ...*x509.
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
+	db.storeDNSNames(leaf)
+	return nil
+}
+
+// dnsNameEntry is an entry of the index of DNS names, it is stored as a JSON
+// array with all the active certificates with a DNS name.
+type dnsNameEntry struct {
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// HasDNSNamesIndex returns true if the database keeps an index of the active
+// certificates by DNS name.
+func (db *DB) HasDNSNamesIndex() bool {
+	return db.dnsNamesIndex
+}
+
+// storeDNSNames adds the given certificate to the index of DNS names if it's
+// enabled. The certificate is already stored, so errors are only logged.
+func (db *DB) storeDNSNames(leaf *x509.Certificate) {
+	if !db.dnsNamesIndex {
+		return
+	}
+	if err := db.indexDNSNames(leaf); err != nil {
+		log.Printf("error indexing DNS names of certificate %s: %v", leaf.SerialNumber, err)
+	}
+}
+
+// indexDNSNames adds the given certificate to the index of each of its DNS
+// names. The expired certificates are removed from the index when it's
+// updated.
+func (db *DB) indexDNSNames(leaf *x509.Certificate) error {
+	serialNumber := leaf.SerialNumber.String()
+	seen := make(map[string]bool, len(leaf.DNSNames))
+	for _, name := range leaf.DNSNames {
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		old, err := db.Get(certsDNSNamesTable, []byte(key))
+		if err != nil && !database.IsErrNotFound(err) {
+			return errors.Wrap(err, "database Get error")
+		}
+		for {
+			var entries []dnsNameEntry
+			if old != nil {
+				if err := json.Unmarshal(old, &entries); err != nil {
+					return errors.Wrapf(err, "error unmarshaling certificates with DNS name %s", key)
+				}
+			}
+			now := time.Now()
+			active := []dnsNameEntry{{SerialNumber: serialNumber, NotAfter: leaf.NotAfter}}
+			for _, e := range entries {
+				if e.SerialNumber != serialNumber && now.Before(e.NotAfter) {
+					active = append(active, e)
+				}
+			}
+			b, err := json.Marshal(active)
+			if err != nil {
+				return errors.Wrap(err, "error marshaling json")
+			}
+			current, swapped, err := db.CmpAndSwap(certsDNSNamesTable, []byte(key), old, b)
+			if err != nil {
+				return errors.Wrap(err, "database CmpAndSwap error")
+			}
+			if swapped {
+				break
+			}
+			old = current
+		}
+	}
+	return nil
+}
+
+// GetCertificatesByDNSName returns the active certificates stored with the
+// given DNS name, the last one first. It returns an empty list if there are
+// no certificates with that name.
+func (db *DB) GetCertificatesByDNSName(name string) ([]*x509.Certificate, error) {
+	b, err := db.Get(certsDNSNamesTable, []byte(strings.ToLower(name)))
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var entries []dnsNameEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling certificates with DNS name %s", name)
+	}
+
+	now := time.Now()
+	certs := make([]*x509.Certificate, 0, len(entries))
+	for _, e := range entries {
+		if !now.Before(e.NotAfter) {
+			continue
+		}
+		crt, err := db.GetCertificate(e.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, crt)
+	}
+	return certs, nil
+}
+
+// renewalLock is the value stored in the renewals table. The renewed serial
+// number is empty while the renewal is in progress.
+type renewalLock struct {
+	RenewedSerialNumber string    `json:"renewedSerialNumber,omitempty"`
+	LockedAt            time.Time `json:"lockedAt"`
+}
+
+// LockRenewal returns true if the renewal of the certificate with the given
+// serial number has been locked. It returns false if the certificate is being
+// renewed, or if it has been renewed, less than ttl ago. In the latter case it
+// also returns the serial number of the renewed certificate. Locks and renewals
+// older than ttl are taken over.
+func (db *DB) LockRenewal(serialNumber string, ttl time.Duration) (bool, string, error) {
+	now := time.Now().UTC()
+	b, err := json.Marshal(renewalLock{LockedAt: now})
+	if err != nil {
+		return false, "", errors.Wrap(err, "error marshaling renewal lock")
+	}
+	old, swapped, err := db.CmpAndSwap(renewalsTable, []byte(serialNumber), nil, b)
+	if err != nil {
+		return false, "", errors.Wrap(err, "database CmpAndSwap error")
+	}
+	if swapped {
+		return true, "", nil
+	}
+
+	var lock renewalLock
+	if err := json.Unmarshal(old, &lock); err != nil {
+		return false, "", errors.Wrap(err, "error unmarshaling renewal lock")
+	}
+	if now.Sub(lock.LockedAt) < ttl {
+		return false, lock.RenewedSerialNumber, nil
+	}
+	if _, swapped, err = db.CmpAndSwap(renewalsTable, []byte(serialNumber), old, b); err != nil {
+		return false, "", errors.Wrap(err, "database CmpAndSwap error")
+	}
+	return swapped, "", nil
+}
+
+// FinishRenewal marks the certificate with the given serial number as renewed
+// by the certificate with the renewed serial number.
+func (db *DB) FinishRenewal(serialNumber, renewedSerialNumber string) error {
+	b, err := json.Marshal(renewalLock{
+		RenewedSerialNumber: renewedSerialNumber,
+		LockedAt:            time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling renewal lock")
+	}
+	if err := db.Set(renewalsTable, []byte(serialNumber), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// UnlockRenewal releases the renewal lock of the certificate with the given
+// serial number.
+func (db *DB) UnlockRenewal(serialNumber string) error {
+	if err := db.Del(renewalsTable, []byte(serialNumber)); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
+	return nil
+}
+
+// GetProvisionerFreezes returns the stored freezes indexed by provisioner ID.
+func (db *DB) GetProvisionerFreezes() (map[string]*provisioner.Freeze, error) {
+	entries, err := db.List(freezesTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	freezes := make(map[string]*provisioner.Freeze, len(entries))
+	for _, e := range entries {
+		var f provisioner.Freeze
+		if err := json.Unmarshal(e.Value, &f); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling freeze of provisioner %s", e.Key)
+		}
+		freezes[string(e.Key)] = &f
+	}
+	return freezes, nil
+}
+
+// StoreProvisionerFreeze stores the freeze of the provisioner with the given
+// ID.
+func (db *DB) StoreProvisionerFreeze(provisionerID string, f *provisioner.Freeze) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling provisioner freeze")
+	}
+	if err := db.Set(freezesTable, []byte(provisionerID), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// DeleteProvisionerFreeze deletes the freeze of the provisioner with the given
+// ID.
+func (db *DB) DeleteProvisionerFreeze(provisionerID string) error {
+	if err := db.Del(freezesTable, []byte(provisionerID)); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
 	return nil
 }
 
@@ -500,6 +763,7 @@ type MockAuthDB struct {
 	MGetSSHHostPrincipals   func() ([]string, error)
 	MShutdown               func() error
 	MGetRevokedCertificates func() (*[]RevokedCertificateInfo, error)
+	MGetRevokedCertificate  func(serialNumber string) (*RevokedCertificateInfo, error)
 	MGetCRL                 func() (*CertificateRevocationListInfo, error)
 	MStoreCRL               func(*CertificateRevocationListInfo) error
 }
@@ -511,6 +775,13 @@ func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error)
 	return m.Ret1.(*[]RevokedCertificateInfo), m.Err
 }
 
+func (m *MockAuthDB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificate != nil {
+		return m.MGetRevokedCertificate(serialNumber)
+	}
+	return m.Ret1.(*RevokedCertificateInfo), m.Err
+}
+
 func (m *MockAuthDB) GetCRL() (*CertificateRevocationListInfo, error) {
 	if m.MGetCRL != nil {
 		return m.MGetCRL()
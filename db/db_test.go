@@ -2,11 +2,16 @@ package db
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -26,16 +31,16 @@ func TestIsRevoked(t *testing.T) {
 		},
 		"false/ErrNotFound": {
 			key: "sn",
-			db:  &DB{&MockNoSQLDB{Err: database.ErrNotFound, Ret1: nil}, true},
+			db:  &DB{&MockNoSQLDB{Err: database.ErrNotFound, Ret1: nil}, true, false},
 		},
 		"error/checking bucket": {
 			key: "sn",
-			db:  &DB{&MockNoSQLDB{Err: errors.New("force"), Ret1: nil}, true},
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force"), Ret1: nil}, true, false},
 			err: errors.New("error checking revocation bucket: force"),
 		},
 		"true": {
 			key:       "sn",
-			db:        &DB{&MockNoSQLDB{Ret1: []byte("value")}, true},
+			db:        &DB{&MockNoSQLDB{Ret1: []byte("value")}, true, false},
 			isRevoked: true,
 		},
 	}
@@ -66,7 +71,7 @@ func TestRevoke(t *testing.T) {
 				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
 					return nil, false, errors.New("force")
 				},
-			}, true},
+			}, true, false},
 			err: errors.New("error AuthDB CmpAndSwap: force"),
 		},
 		"error/was already revoked": {
@@ -75,7 +80,7 @@ func TestRevoke(t *testing.T) {
 				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
 					return []byte("foo"), false, nil
 				},
-			}, true},
+			}, true, false},
 			err: ErrAlreadyExists,
 		},
 		"ok": {
@@ -84,7 +89,7 @@ func TestRevoke(t *testing.T) {
 				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
 					return []byte("foo"), true, nil
 				},
-			}, true},
+			}, true, false},
 		},
 	}
 	for name, tc := range tests {
@@ -100,6 +105,50 @@ func TestRevoke(t *testing.T) {
 	}
 }
 
+func TestDB_GetRevokedCertificate(t *testing.T) {
+	rci := &RevokedCertificateInfo{Serial: "sn", ReasonCode: 1, Reason: "key compromise"}
+	b, err := json.Marshal(rci)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db   *DB
+		want *RevokedCertificateInfo
+		err  error
+	}{
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, revokedCertsTable, bucket)
+					assert.Equals(t, []byte("sn"), key)
+					return b, nil
+				},
+			}, true, false},
+			want: rci,
+		},
+		"error/not found": {
+			db:  &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true, false},
+			err: errors.New("database Get error: not found"),
+		},
+		"error/unmarshal": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("not-json")}, true, false},
+			err: errors.New("json Unmarshal error: invalid character 'o' in literal null (expecting 'u')"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetRevokedCertificate("sn")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
 func TestUseToken(t *testing.T) {
 	type result struct {
 		err error
@@ -117,7 +166,7 @@ func TestUseToken(t *testing.T) {
 				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
 					return nil, false, errors.New("force")
 				},
-			}, true},
+			}, true, false},
 			want: result{
 				ok:  false,
 				err: errors.New("error storing used token used_ott/id"),
@@ -130,7 +179,7 @@ func TestUseToken(t *testing.T) {
 				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
 					return []byte("foo"), false, nil
 				},
-			}, true},
+			}, true, false},
 			want: result{
 				ok: false,
 			},
@@ -142,7 +191,7 @@ func TestUseToken(t *testing.T) {
 				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
 					return []byte("bar"), true, nil
 				},
-			}, true},
+			}, true, false},
 			want: result{
 				ok: true,
 			},
@@ -165,6 +214,140 @@ func TestUseToken(t *testing.T) {
 	}
 }
 
+func TestDB_ProvisionerFreezes(t *testing.T) {
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	freeze := &provisioner.Freeze{Until: &until, AllowRenewal: true}
+	b, err := json.Marshal(freeze)
+	assert.FatalError(t, err)
+
+	stored := map[string][]byte{}
+	d := DB{DB: &MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, freezesTable, bucket)
+			stored[string(key)] = value
+			return nil
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, freezesTable, bucket)
+			delete(stored, string(key))
+			return nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, freezesTable, bucket)
+			var entries []*database.Entry
+			for k, v := range stored {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+	}}
+
+	assert.FatalError(t, d.StoreProvisionerFreeze("prov-1", freeze))
+	assert.FatalError(t, d.StoreProvisionerFreeze("prov-2", &provisioner.Freeze{}))
+	assert.Equals(t, b, stored["prov-1"])
+
+	freezes, err := d.GetProvisionerFreezes()
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]*provisioner.Freeze{
+		"prov-1": freeze,
+		"prov-2": {},
+	}, freezes)
+
+	assert.FatalError(t, d.DeleteProvisionerFreeze("prov-2"))
+	freezes, err = d.GetProvisionerFreezes()
+	assert.FatalError(t, err)
+	assert.Equals(t, map[string]*provisioner.Freeze{"prov-1": freeze}, freezes)
+
+	stored["bad"] = []byte("{")
+	_, err = d.GetProvisionerFreezes()
+	assert.Error(t, err)
+}
+
+func TestDB_LockRenewal(t *testing.T) {
+	pending, err := json.Marshal(renewalLock{LockedAt: time.Now().UTC()})
+	assert.FatalError(t, err)
+	stale, err := json.Marshal(renewalLock{LockedAt: time.Now().UTC().Add(-2 * time.Minute)})
+	assert.FatalError(t, err)
+	renewed, err := json.Marshal(renewalLock{RenewedSerialNumber: "5678", LockedAt: time.Now().UTC()})
+	assert.FatalError(t, err)
+	staleRenewed, err := json.Marshal(renewalLock{RenewedSerialNumber: "5678", LockedAt: time.Now().UTC().Add(-2 * time.Minute)})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		db         nosql.DB
+		want       bool
+		wantSerial string
+		wantErr    bool
+	}{
+		{"ok", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, renewalsTable)
+				assert.Equals(t, key, []byte("1234"))
+				assert.Nil(t, old)
+				return newval, true, nil
+			},
+		}, true, "", false},
+		{"ok stale", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				if old == nil {
+					return stale, false, nil
+				}
+				assert.Equals(t, old, stale)
+				return newval, true, nil
+			},
+		}, true, "", false},
+		{"ok stale renewed", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				if old == nil {
+					return staleRenewed, false, nil
+				}
+				assert.Equals(t, old, staleRenewed)
+				return newval, true, nil
+			},
+		}, true, "", false},
+		{"ok pending", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				if old != nil {
+					return nil, false, errors.New("unexpected swap")
+				}
+				return pending, false, nil
+			},
+		}, false, "", false},
+		{"ok renewed", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				if old != nil {
+					return nil, false, errors.New("unexpected swap")
+				}
+				return renewed, false, nil
+			},
+		}, false, "5678", false},
+		{"fail db", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, false, "", true},
+		{"fail unmarshal", &MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("not-json"), false, nil
+			},
+		}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{DB: tt.db, isUp: true}
+			got, gotSerial, err := db.LockRenewal("1234", time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.LockRenewal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want || gotSerial != tt.wantSerial {
+				t.Errorf("DB.LockRenewal() = %v, %v, want %v, %v", got, gotSerial, tt.want, tt.wantSerial)
+			}
+		})
+	}
+}
+
 // wrappedProvisioner implements raProvisioner and attProvisioner.
 type wrappedProvisioner struct {
 	provisioner.Interface
@@ -249,6 +432,40 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 				return nil
 			},
 		}, true}, args{nil, chain}, false},
+		{"ok dns names", fields{&MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				if len(tx.Operations) != 2 {
+					t.Fatal("unexpected number of operations")
+				}
+				return nil
+			},
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, []byte("x509_certs_dns_names"), bucket)
+				return nil, database.ErrNotFound
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, []byte("x509_certs_dns_names"), bucket)
+				assert.True(t, string(key) == "foo.example.com" || string(key) == "bar.example.com")
+				assert.Nil(t, old)
+				assert.Equals(t, `[{"serialNumber":"1234","notAfter":"2030-01-01T00:00:00Z"}]`, string(newval))
+				return newval, true, nil
+			},
+		}, true}, args{p, []*x509.Certificate{
+			{Raw: []byte("the certificate"), SerialNumber: big.NewInt(1234), DNSNames: []string{"Foo.Example.com", "bar.example.com", "foo.example.com"}, NotAfter: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		}}, false},
+		{"ok dns names not indexed", fields{&MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				return nil
+			},
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("test error")
+			},
+		}, true}, args{p, []*x509.Certificate{
+			{Raw: []byte("the certificate"), SerialNumber: big.NewInt(1234), DNSNames: []string{"foo.example.com"}},
+		}}, false},
 		{"fail store certificate", fields{&MockNoSQLDB{
 			MUpdate: func(tx *database.Tx) error {
 				return errors.New("test error")
@@ -328,6 +545,161 @@ func TestDB_GetCertificateData(t *testing.T) {
 	}
 }
 
+// newDNSNamesDB returns a MockNoSQLDB that keeps the certificates and the
+// index of DNS names in memory. The first CmpAndSwap of each key fails, as if
+// another certificate with the same name was stored at the same time.
+func newDNSNamesDB(t *testing.T) *MockNoSQLDB {
+	t.Helper()
+	var mu sync.Mutex
+	data := map[string][]byte{}
+	conflicts := map[string]bool{}
+	return &MockNoSQLDB{
+		MUpdate: func(tx *database.Tx) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, op := range tx.Operations {
+				data[string(op.Bucket)+"/"+string(op.Key)] = op.Value
+			}
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if v, ok := data[string(bucket)+"/"+string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			k := string(bucket) + "/" + string(key)
+			if !conflicts[k] {
+				conflicts[k] = true
+				return data[k], false, nil
+			}
+			if current := data[k]; !bytes.Equal(current, old) {
+				return current, false, nil
+			}
+			data[k] = newval
+			return newval, true, nil
+		},
+	}
+}
+
+func TestDB_GetCertificatesByDNSName(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	newCert := func(serial int64, notAfter time.Time, dnsNames ...string) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			DNSNames:     dnsNames,
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(der)
+		assert.FatalError(t, err)
+		return crt
+	}
+
+	expired := newCert(1, now.Add(-time.Minute), "foo.example.com")
+	first := newCert(2, now.Add(time.Hour), "foo.example.com", "bar.example.com")
+	second := newCert(3, now.Add(time.Hour), "Foo.Example.com")
+	renewed := newCert(4, now.Add(2*time.Hour), "bar.example.com")
+
+	d := &DB{DB: newDNSNamesDB(t), isUp: true, dnsNamesIndex: true}
+	for _, crt := range []*x509.Certificate{expired, first, second} {
+		assert.FatalError(t, d.StoreCertificateChain(nil, crt))
+	}
+	assert.FatalError(t, d.StoreRenewedCertificate(first, renewed))
+
+	tests := []struct {
+		name string
+		want []*x509.Certificate
+	}{
+		{"foo.example.com", []*x509.Certificate{second, first}},
+		{"FOO.example.com", []*x509.Certificate{second, first}},
+		{"bar.example.com", []*x509.Certificate{renewed, first}},
+		{"zar.example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.GetCertificatesByDNSName(tt.name)
+			assert.FatalError(t, err)
+			assert.Len(t, len(tt.want), got)
+			for i := range tt.want {
+				assert.Equals(t, tt.want[i].SerialNumber, got[i].SerialNumber)
+			}
+		})
+	}
+
+	// Expired certificates are removed from the index.
+	b, err := d.Get(certsDNSNamesTable, []byte("foo.example.com"))
+	assert.FatalError(t, err)
+	var entries []dnsNameEntry
+	assert.FatalError(t, json.Unmarshal(b, &entries))
+	assert.Len(t, 2, entries)
+
+	// Errors
+	d = &DB{DB: &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("an error")
+		},
+	}, isUp: true}
+	_, err = d.GetCertificatesByDNSName("foo.example.com")
+	assert.Error(t, err)
+
+	d = &DB{DB: &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return []byte("1234"), nil
+		},
+	}, isUp: true}
+	_, err = d.GetCertificatesByDNSName("foo.example.com")
+	assert.Error(t, err)
+
+	d = &DB{DB: &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if string(bucket) == "x509_certs_dns_names" {
+				return []byte(`[{"serialNumber":"1234","notAfter":"2999-01-01T00:00:00Z"}]`), nil
+			}
+			return nil, database.ErrNotFound
+		},
+	}, isUp: true}
+	_, err = d.GetCertificatesByDNSName("foo.example.com")
+	assert.Error(t, err)
+}
+
+func TestDB_StoreCertificateChain_dnsNamesIndex(t *testing.T) {
+	crt := &x509.Certificate{SerialNumber: big.NewInt(1), DNSNames: []string{"foo.example.com"}, NotAfter: time.Now().Add(time.Hour)}
+
+	// The index is disabled by default.
+	var indexed bool
+	d := &DB{DB: &MockNoSQLDB{
+		MUpdate: func(tx *database.Tx) error { return nil },
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			indexed = true
+			return newval, true, nil
+		},
+	}, isUp: true}
+	assert.FatalError(t, d.StoreCertificateChain(nil, crt))
+	assert.False(t, indexed)
+	assert.False(t, d.HasDNSNamesIndex())
+
+	// Errors indexing the names do not fail the request.
+	d = &DB{DB: &MockNoSQLDB{
+		MUpdate: func(tx *database.Tx) error { return nil },
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("an error")
+		},
+	}, isUp: true, dnsNamesIndex: true}
+	assert.NoError(t, d.StoreCertificateChain(nil, crt))
+	assert.NoError(t, d.StoreRenewedCertificate(crt, crt))
+	assert.True(t, d.HasDNSNamesIndex())
+}
+
 func TestDB_StoreRenewedCertificate(t *testing.T) {
 	oldCert := &x509.Certificate{SerialNumber: big.NewInt(1)}
 	chain := []*x509.Certificate{
@@ -49,17 +49,21 @@ func WithKeyVal(key string, val interface{}) Option {
 
 // Error represents the CA API errors.
 type Error struct {
-	Status    int
-	Err       error
-	Msg       string
-	Details   map[string]interface{}
-	RequestID string `json:"-"`
+	Status  int
+	Err     error
+	Msg     string
+	Details map[string]interface{}
+	// ResponseDetails, unlike Details, are sent to the client in the JSON
+	// response.
+	ResponseDetails interface{}
+	RequestID       string `json:"-"`
 }
 
 // ErrorResponse represents an error in JSON format.
 type ErrorResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // Cause implements the errors.Causer interface and returns the original error.
@@ -67,6 +71,11 @@ func (e *Error) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // Error implements the error interface and returns the error string.
 func (e *Error) Error() string {
 	return e.Err.Error()
@@ -128,7 +137,7 @@ func (e *Error) MarshalJSON() ([]byte, error) {
 	} else {
 		msg = http.StatusText(e.Status)
 	}
-	return json.Marshal(&ErrorResponse{Status: e.Status, Message: msg})
+	return json.Marshal(&ErrorResponse{Status: e.Status, Message: msg, Details: e.ResponseDetails})
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface for the Error struct.
@@ -9,8 +9,9 @@ import (
 
 func TestError_MarshalJSON(t *testing.T) {
 	type fields struct {
-		Status int
-		Err    error
+		Status          int
+		Err             error
+		ResponseDetails interface{}
 	}
 	tests := []struct {
 		name    string
@@ -18,14 +19,16 @@ func TestError_MarshalJSON(t *testing.T) {
 		want    []byte
 		wantErr bool
 	}{
-		{"ok", fields{400, fmt.Errorf("bad request")}, []byte(`{"status":400,"message":"Bad Request"}`), false},
-		{"ok no error", fields{500, nil}, []byte(`{"status":500,"message":"Internal Server Error"}`), false},
+		{"ok", fields{400, fmt.Errorf("bad request"), nil}, []byte(`{"status":400,"message":"Bad Request"}`), false},
+		{"ok no error", fields{500, nil, nil}, []byte(`{"status":500,"message":"Internal Server Error"}`), false},
+		{"ok response details", fields{403, fmt.Errorf("forbidden"), map[string]any{"foo": "bar"}}, []byte(`{"status":403,"message":"Forbidden","details":{"foo":"bar"}}`), false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := &Error{
-				Status: tt.fields.Status,
-				Err:    tt.fields.Err,
+				Status:          tt.fields.Status,
+				Err:             tt.fields.Err,
+				ResponseDetails: tt.fields.ResponseDetails,
 			}
 			got, err := e.MarshalJSON()
 			if tt.wantErr {
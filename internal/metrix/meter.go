@@ -2,6 +2,7 @@
 package metrix
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -29,10 +30,31 @@ func New() (m *Meter) {
 		),
 		ssh:  newProvisionerInstruments("ssh"),
 		x509: newProvisionerInstruments("x509"),
+		authorize: &authorizeInstruments{
+			authorized: newCounterVec("provisioner", "authorized_total", "Number of requests authorized by provisioners",
+				"method",
+				"type",
+				"outcome",
+				"reason",
+			),
+			duration: newHistogramVec("provisioner", "authorize_duration_seconds", "Time spent by provisioners authorizing requests",
+				"method",
+				"type",
+				"outcome",
+			),
+		},
 		kms: &kms{
 			signed: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "signed", "Number of KMS-backed signatures"))),
 			errors: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "errors", "Number of KMS-related errors"))),
 		},
+		concurrency: &concurrencyInstruments{
+			inFlight: newGaugeVec("sign", "in_flight", "Number of sign operations in progress",
+				"provisioner",
+			),
+			queued: newGaugeVec("sign", "queued", "Number of sign operations waiting for a free slot",
+				"provisioner",
+			),
+		},
 	}
 
 	reg := prometheus.NewRegistry()
@@ -44,13 +66,19 @@ func New() (m *Meter) {
 		m.ssh.signed,
 		m.ssh.webhookAuthorized,
 		m.ssh.webhookEnriched,
+		m.ssh.policyShadowed,
 		m.x509.rekeyed,
 		m.x509.renewed,
 		m.x509.signed,
 		m.x509.webhookAuthorized,
 		m.x509.webhookEnriched,
+		m.x509.policyShadowed,
+		m.authorize.authorized,
+		m.authorize.duration,
 		m.kms.signed,
 		m.kms.errors,
+		m.concurrency.inFlight,
+		m.concurrency.queued,
 	)
 
 	h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
@@ -70,10 +98,12 @@ func New() (m *Meter) {
 type Meter struct {
 	http.Handler
 
-	uptime prometheus.GaugeFunc
-	ssh    *provisionerInstruments
-	x509   *provisionerInstruments
-	kms    *kms
+	uptime      prometheus.GaugeFunc
+	ssh         *provisionerInstruments
+	x509        *provisionerInstruments
+	authorize   *authorizeInstruments
+	kms         *kms
+	concurrency *concurrencyInstruments
 }
 
 // SSHRekeyed implements [authority.Meter] for [Meter].
@@ -101,6 +131,11 @@ func (m *Meter) SSHWebhookEnriched(p provisioner.Interface, err error) {
 	incrProvisionerCounter(m.ssh.webhookEnriched, p, err)
 }
 
+// SSHPolicyShadowed implements [authority.Meter] for [Meter].
+func (m *Meter) SSHPolicyShadowed(p provisioner.Interface, err error) {
+	incrProvisionerCounter(m.ssh.policyShadowed, p, err)
+}
+
 // X509Rekeyed implements [authority.Meter] for [Meter].
 func (m *Meter) X509Rekeyed(p provisioner.Interface, err error) {
 	incrProvisionerCounter(m.x509.rekeyed, p, err)
@@ -126,6 +161,11 @@ func (m *Meter) X509WebhookEnriched(p provisioner.Interface, err error) {
 	incrProvisionerCounter(m.x509.webhookEnriched, p, err)
 }
 
+// X509PolicyShadowed implements [authority.Meter] for [Meter].
+func (m *Meter) X509PolicyShadowed(p provisioner.Interface, err error) {
+	incrProvisionerCounter(m.x509.policyShadowed, p, err)
+}
+
 func incrProvisionerCounter(cv *prometheus.CounterVec, p provisioner.Interface, err error) {
 	var name string
 	if p != nil {
@@ -135,6 +175,28 @@ func incrProvisionerCounter(cv *prometheus.CounterVec, p provisioner.Interface,
 	cv.WithLabelValues(name, strconv.FormatBool(err == nil)).Inc()
 }
 
+// ProvisionerAuthorized implements [authority.Meter] for [Meter]. The metrics
+// are labeled by the provisioner type, not by its name, and the failures by
+// the reason of the error, to keep the cardinality low.
+func (m *Meter) ProvisionerAuthorized(method string, p provisioner.Interface, d time.Duration, err error) {
+	var typ string
+	if p != nil {
+		typ = p.GetType().String()
+	}
+
+	outcome, reason := "success", ""
+	if err != nil {
+		outcome, reason = "failure", provisioner.ReasonUnknown.String()
+		var ae *provisioner.AuthorizeError
+		if errors.As(err, &ae) {
+			reason = ae.Reason.String()
+		}
+	}
+
+	m.authorize.authorized.WithLabelValues(method, typ, outcome, reason).Inc()
+	m.authorize.duration.WithLabelValues(method, typ, outcome).Observe(d.Seconds())
+}
+
 // KMSSigned implements [authority.Meter] for [Meter].
 func (m *Meter) KMSSigned(err error) {
 	if err == nil {
@@ -144,6 +206,18 @@ func (m *Meter) KMSSigned(err error) {
 	}
 }
 
+// SignConcurrency implements [authority.Meter] for [Meter]. The limit of the
+// authority is reported with an empty provisioner label.
+func (m *Meter) SignConcurrency(p provisioner.Interface, inFlight, queued int) {
+	var name string
+	if p != nil {
+		name = p.GetName()
+	}
+
+	m.concurrency.inFlight.WithLabelValues(name).Set(float64(inFlight))
+	m.concurrency.queued.WithLabelValues(name).Set(float64(queued))
+}
+
 // provisionerInstruments wraps the counters exported by provisioners.
 type provisionerInstruments struct {
 	rekeyed *prometheus.CounterVec
@@ -152,6 +226,8 @@ type provisionerInstruments struct {
 
 	webhookAuthorized *prometheus.CounterVec
 	webhookEnriched   *prometheus.CounterVec
+
+	policyShadowed *prometheus.CounterVec
 }
 
 func newProvisionerInstruments(subsystem string) *provisionerInstruments {
@@ -176,20 +252,55 @@ func newProvisionerInstruments(subsystem string) *provisionerInstruments {
 			"provisioner",
 			"success",
 		),
+		policyShadowed: newCounterVec(subsystem, "policy_shadowed_total", "Number of certificates evaluated by policies in shadow mode",
+			"provisioner",
+			"allowed",
+		),
 	}
 }
 
+// authorizeInstruments wraps the instruments of the provisioner
+// authorizations.
+type authorizeInstruments struct {
+	authorized *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
 type kms struct {
 	signed prometheus.Counter
 	errors prometheus.Counter
 }
 
+// concurrencyInstruments wraps the gauges of the sign concurrency limits.
+type concurrencyInstruments struct {
+	inFlight *prometheus.GaugeVec
+	queued   *prometheus.GaugeVec
+}
+
 func newCounterVec(subsystem, name, help string, labels ...string) *prometheus.CounterVec {
 	opts := opts(subsystem, name, help)
 
 	return prometheus.NewCounterVec(prometheus.CounterOpts(opts), labels)
 }
 
+func newGaugeVec(subsystem, name, help string, labels ...string) *prometheus.GaugeVec {
+	opts := opts(subsystem, name, help)
+
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labels)
+}
+
+func newHistogramVec(subsystem, name, help string, labels ...string) *prometheus.HistogramVec {
+	opts := opts(subsystem, name, help)
+
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: opts.Namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+		Buckets:   prometheus.DefBuckets,
+	}, labels)
+}
+
 func opts(subsystem, name, help string) prometheus.Opts {
 	return prometheus.Opts{
 		Namespace: "step_ca",
@@ -31,6 +31,26 @@ const (
 	CannotMatchNameToConstraint
 )
 
+// NamePolicyRule is the category of the rule that rejected a name.
+type NamePolicyRule string
+
+const (
+	// NotAllowedRule is the rule used when allowed names are configured, but
+	// the name doesn't match any of them.
+	NotAllowedRule NamePolicyRule = "notAllowed"
+	// DeniedRule is the rule used when the name matches one of the denied
+	// names.
+	DeniedRule NamePolicyRule = "denied"
+)
+
+// NameViolation describes a name rejected by the policy.
+type NameViolation struct {
+	NameType   NameType       `json:"type"`
+	Name       string         `json:"name"`
+	Rule       NamePolicyRule `json:"rule"`
+	Constraint string         `json:"constraint,omitempty"`
+}
+
 type NameType string
 
 const (
@@ -46,7 +66,14 @@ type NamePolicyError struct {
 	Reason   NamePolicyReason
 	NameType NameType
 	Name     string
-	detail   string
+	// Rule and Constraint are set for NotAllowed errors. Constraint is only
+	// set if the name was rejected by a denied name.
+	Rule       NamePolicyRule
+	Constraint string
+	// Violations contains all the names rejected in the same validation,
+	// including the one described by the error.
+	Violations []NameViolation
+	detail     string
 }
 
 func (e *NamePolicyError) Error() string {
@@ -73,6 +100,9 @@ func (e *NamePolicyError) As(v any) bool {
 				Status: http.StatusForbidden,
 				Msg:    fmt.Sprintf("The request was forbidden by the certificate authority: %s", e.Error()),
 				Err:    e,
+				ResponseDetails: map[string]any{
+					"violations": e.GetViolations(),
+				},
 			}
 			return true
 		}
@@ -84,6 +114,24 @@ func (e *NamePolicyError) Detail() string {
 	return e.detail
 }
 
+// GetViolations returns the names rejected by the policy. If no violations
+// were collected, it returns the one described by the error.
+func (e *NamePolicyError) GetViolations() []NameViolation {
+	if len(e.Violations) > 0 {
+		return e.Violations
+	}
+	return []NameViolation{e.violation()}
+}
+
+func (e *NamePolicyError) violation() NameViolation {
+	return NameViolation{
+		NameType:   e.NameType,
+		Name:       e.Name,
+		Rule:       e.Rule,
+		Constraint: e.Constraint,
+	}
+}
+
 // NamePolicyEngine can be used to check that a CSR or Certificate meets all allowed and
 // denied names before a CA creates and/or signs the Certificate.
 // TODO(hs): the X509 RFC also defines name checks on directory name; support that?
@@ -3399,3 +3399,49 @@ func TestNamePolicyError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestNamePolicyEngine_violations(t *testing.T) {
+	engine, err := New(
+		WithPermittedDNSDomains("*.local"),
+		WithExcludedDNSDomains("bad.local"),
+		WithPermittedCIDRs("10.0.0.0/8"),
+	)
+	assert.NoError(t, err)
+
+	err = engine.AreSANsAllowed([]string{"foo.local", "www.example.com", "bad.local", "10.0.0.1", "192.168.0.1"})
+	var npe *NamePolicyError
+	if assert.True(t, errors.As(err, &npe)) {
+		assert.Equal(t, NotAllowed, npe.Reason)
+		assert.Equal(t, DNSNameType, npe.NameType)
+		assert.Equal(t, "www.example.com", npe.Name)
+		assert.Equal(t, NotAllowedRule, npe.Rule)
+		assert.Equal(t, []NameViolation{
+			{NameType: DNSNameType, Name: "www.example.com", Rule: NotAllowedRule},
+			{NameType: DNSNameType, Name: "bad.local", Rule: DeniedRule, Constraint: "bad.local"},
+			{NameType: IPNameType, Name: "192.168.0.1", Rule: NotAllowedRule},
+		}, npe.GetViolations())
+	}
+
+	// parsing errors are still returned if no names are rejected before
+	err = engine.AreSANsAllowed([]string{"foo.local", "*.*.local"})
+	if assert.True(t, errors.As(err, &npe)) {
+		assert.Equal(t, CannotParseDomain, npe.Reason)
+	}
+	err = engine.AreSANsAllowed([]string{"bad.local", "*.*.local"})
+	if assert.True(t, errors.As(err, &npe)) {
+		assert.Equal(t, NotAllowed, npe.Reason)
+		assert.Len(t, npe.GetViolations(), 1)
+	}
+
+	// common names are reported with the cn type
+	engine, err = New(WithExcludedDNSDomains("bad.local"), WithSubjectCommonNameVerification())
+	assert.NoError(t, err)
+	err = engine.IsX509CertificateAllowed(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "bad.local"},
+	})
+	if assert.True(t, errors.As(err, &npe)) {
+		assert.Equal(t, []NameViolation{
+			{NameType: CNNameType, Name: "bad.local", Rule: DeniedRule, Constraint: "bad.local"},
+		}, npe.GetViolations())
+	}
+}
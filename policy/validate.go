@@ -32,152 +32,196 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 	// this number as a total of all checks and keeps a (pointer to a) counter of the number of checks
 	// executed so far.
 
-	// TODO: gather all errors, or return early? Currently we return early on the first wrong name; check might fail for multiple names.
-	// Perhaps make that an option?
-	for _, dns := range dnsNames {
-		// if there are DNS names to check, no DNS constraints set, but there are other permitted constraints,
-		// then return error, because DNS should be explicitly configured to be allowed in that case. In case there are
-		// (other) excluded constraints, we'll allow a DNS (implicit allow; currently).
-		if e.numberOfDNSDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("dns %q is not explicitly permitted by any constraint", dns),
-			}
-		}
-		didCutWildcard := false
-		parsedDNS := dns
-		if strings.HasPrefix(parsedDNS, "*.") {
-			parsedDNS = parsedDNS[1:]
-			didCutWildcard = true
-		}
-		// TODO(hs): fix this above; we need separate rule for Subject Common Name?
-		parsedDNS, err := idna.Lookup.ToASCII(parsedDNS)
-		if err != nil {
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("dns %q cannot be converted to ASCII", dns),
+	var policyErr *NamePolicyError
+	check := func(err error) error {
+		var pe *NamePolicyError
+		if errors.As(err, &pe) && pe.Reason == NotAllowed {
+			if policyErr == nil {
+				policyErr = pe
 			}
+			policyErr.Violations = append(policyErr.Violations, pe.violation())
+			return nil
 		}
-		if didCutWildcard {
-			parsedDNS = "*" + parsedDNS
-		}
-		if _, ok := domainToReverseLabels(parsedDNS); !ok { // TODO(hs): this also fails with spaces
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: DNSNameType,
-				Name:     dns,
-				detail:   fmt.Sprintf("cannot parse dns %q", dns),
-			}
+		// other errors stop the validation, unless a violation was found before
+		if err != nil && policyErr != nil {
+			return policyErr
 		}
-		if err := checkNameConstraints(DNSNameType, dns, parsedDNS,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchDomainConstraint(parsedName.(string), constraint.(string))
-			}, e.permittedDNSDomains, e.excludedDNSDomains); err != nil {
+		return err
+	}
+
+	for _, dns := range dnsNames {
+		if err := check(e.validateDNSName(dns)); err != nil {
 			return err
 		}
 	}
-
 	for _, ip := range ips {
-		if e.numberOfIPRangeConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: IPNameType,
-				Name:     ip.String(),
-				detail:   fmt.Sprintf("ip %q is not explicitly permitted by any constraint", ip.String()),
-			}
-		}
-		if err := checkNameConstraints(IPNameType, ip.String(), ip,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return matchIPConstraint(parsedName.(net.IP), constraint.(*net.IPNet))
-			}, e.permittedIPRanges, e.excludedIPRanges); err != nil {
+		if err := check(e.validateIP(ip)); err != nil {
 			return err
 		}
 	}
-
 	for _, email := range emailAddresses {
-		if e.numberOfEmailAddressConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Sprintf("email %q is not explicitly permitted by any constraint", email),
-			}
-		}
-		mailbox, ok := parseRFC2821Mailbox(email)
-		if !ok {
-			return &NamePolicyError{
-				Reason:   CannotParseRFC822Name,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Sprintf("invalid rfc822Name %q", mailbox),
-			}
+		if err := check(e.validateEmailAddress(email)); err != nil {
+			return err
 		}
-		// According to RFC 5280, section 7.5, emails are considered to match if the local part is
-		// an exact match and the host (domain) part matches the ASCII representation (case-insensitive):
-		// https://datatracker.ietf.org/doc/html/rfc5280#section-7.5
-		domainASCII, err := idna.ToASCII(mailbox.domain)
-		if err != nil {
-			return &NamePolicyError{
-				Reason:   CannotParseDomain,
-				NameType: EmailNameType,
-				Name:     email,
-				detail:   fmt.Errorf("cannot parse email domain %q: %w", email, err).Error(),
-			}
+	}
+	for _, uri := range uris {
+		if err := check(e.validateURI(uri)); err != nil {
+			return err
 		}
-		mailbox.domain = domainASCII
-		if err := checkNameConstraints(EmailNameType, email, mailbox,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchEmailConstraint(parsedName.(rfc2821Mailbox), constraint.(string))
-			}, e.permittedEmailAddresses, e.excludedEmailAddresses); err != nil {
+	}
+	for _, principal := range principals {
+		if err := check(e.validatePrincipal(principal)); err != nil {
 			return err
 		}
 	}
 
-	// TODO(hs): fix internationalization for URIs (IRIs)
+	if policyErr != nil {
+		return policyErr
+	}
 
-	for _, uri := range uris {
-		if e.numberOfURIDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: URINameType,
-				Name:     uri.String(),
-				detail:   fmt.Sprintf("uri %q is not explicitly permitted by any constraint", uri.String()),
-			}
+	// if all checks out, all SANs are allowed
+	return nil
+}
+
+// validateDNSName verifies that a DNS name is allowed.
+func (e *NamePolicyEngine) validateDNSName(dns string) error {
+	// if there are DNS names to check, no DNS constraints set, but there are other permitted constraints,
+	// then return error, because DNS should be explicitly configured to be allowed in that case. In case there are
+	// (other) excluded constraints, we'll allow a DNS (implicit allow; currently).
+	if e.numberOfDNSDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: DNSNameType,
+			Name:     dns,
+			Rule:     NotAllowedRule,
+			detail:   fmt.Sprintf("dns %q is not explicitly permitted by any constraint", dns),
 		}
-		// TODO(hs): ideally we'd like the uri.String() to be the original contents; now
-		// it's transformed into ASCII. Prevent that here?
-		if err := checkNameConstraints(URINameType, uri.String(), uri,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return e.matchURIConstraint(parsedName.(*url.URL), constraint.(string))
-			}, e.permittedURIDomains, e.excludedURIDomains); err != nil {
-			return err
+	}
+	didCutWildcard := false
+	parsedDNS := dns
+	if strings.HasPrefix(parsedDNS, "*.") {
+		parsedDNS = parsedDNS[1:]
+		didCutWildcard = true
+	}
+	// TODO(hs): fix this above; we need separate rule for Subject Common Name?
+	parsedDNS, err := idna.Lookup.ToASCII(parsedDNS)
+	if err != nil {
+		return &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: DNSNameType,
+			Name:     dns,
+			detail:   fmt.Sprintf("dns %q cannot be converted to ASCII", dns),
+		}
+	}
+	if didCutWildcard {
+		parsedDNS = "*" + parsedDNS
+	}
+	if _, ok := domainToReverseLabels(parsedDNS); !ok { // TODO(hs): this also fails with spaces
+		return &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: DNSNameType,
+			Name:     dns,
+			detail:   fmt.Sprintf("cannot parse dns %q", dns),
 		}
 	}
+	return checkNameConstraints(DNSNameType, dns, parsedDNS,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchDomainConstraint(parsedName.(string), constraint.(string))
+		}, e.permittedDNSDomains, e.excludedDNSDomains)
+}
 
-	for _, principal := range principals {
-		if e.numberOfPrincipalConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
-			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: PrincipalNameType,
-				Name:     principal,
-				detail:   fmt.Sprintf("username principal %q is not explicitly permitted by any constraint", principal),
-			}
+// validateIP verifies that an IP address is allowed.
+func (e *NamePolicyEngine) validateIP(ip net.IP) error {
+	if e.numberOfIPRangeConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: IPNameType,
+			Name:     ip.String(),
+			Rule:     NotAllowedRule,
+			detail:   fmt.Sprintf("ip %q is not explicitly permitted by any constraint", ip.String()),
 		}
-		// TODO: some validation? I.e. allowed characters?
-		if err := checkNameConstraints(PrincipalNameType, principal, principal,
-			func(parsedName, constraint interface{}) (bool, error) {
-				return matchPrincipalConstraint(parsedName.(string), constraint.(string))
-			}, e.permittedPrincipals, e.excludedPrincipals); err != nil {
-			return err
+	}
+	return checkNameConstraints(IPNameType, ip.String(), ip,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return matchIPConstraint(parsedName.(net.IP), constraint.(*net.IPNet))
+		}, e.permittedIPRanges, e.excludedIPRanges)
+}
+
+// validateEmailAddress verifies that an email address is allowed.
+func (e *NamePolicyEngine) validateEmailAddress(email string) error {
+	if e.numberOfEmailAddressConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: EmailNameType,
+			Name:     email,
+			Rule:     NotAllowedRule,
+			detail:   fmt.Sprintf("email %q is not explicitly permitted by any constraint", email),
+		}
+	}
+	mailbox, ok := parseRFC2821Mailbox(email)
+	if !ok {
+		return &NamePolicyError{
+			Reason:   CannotParseRFC822Name,
+			NameType: EmailNameType,
+			Name:     email,
+			detail:   fmt.Sprintf("invalid rfc822Name %q", mailbox),
+		}
+	}
+	// According to RFC 5280, section 7.5, emails are considered to match if the local part is
+	// an exact match and the host (domain) part matches the ASCII representation (case-insensitive):
+	// https://datatracker.ietf.org/doc/html/rfc5280#section-7.5
+	domainASCII, err := idna.ToASCII(mailbox.domain)
+	if err != nil {
+		return &NamePolicyError{
+			Reason:   CannotParseDomain,
+			NameType: EmailNameType,
+			Name:     email,
+			detail:   fmt.Errorf("cannot parse email domain %q: %w", email, err).Error(),
 		}
 	}
+	mailbox.domain = domainASCII
+	return checkNameConstraints(EmailNameType, email, mailbox,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchEmailConstraint(parsedName.(rfc2821Mailbox), constraint.(string))
+		}, e.permittedEmailAddresses, e.excludedEmailAddresses)
+}
 
-	// if all checks out, all SANs are allowed
-	return nil
+// validateURI verifies that a URI is allowed.
+func (e *NamePolicyEngine) validateURI(uri *url.URL) error {
+	// TODO(hs): fix internationalization for URIs (IRIs)
+	if e.numberOfURIDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: URINameType,
+			Name:     uri.String(),
+			Rule:     NotAllowedRule,
+			detail:   fmt.Sprintf("uri %q is not explicitly permitted by any constraint", uri.String()),
+		}
+	}
+	// TODO(hs): ideally we'd like the uri.String() to be the original contents; now
+	// it's transformed into ASCII. Prevent that here?
+	return checkNameConstraints(URINameType, uri.String(), uri,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return e.matchURIConstraint(parsedName.(*url.URL), constraint.(string))
+		}, e.permittedURIDomains, e.excludedURIDomains)
+}
+
+// validatePrincipal verifies that an SSH principal is allowed.
+func (e *NamePolicyEngine) validatePrincipal(principal string) error {
+	if e.numberOfPrincipalConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		return &NamePolicyError{
+			Reason:   NotAllowed,
+			NameType: PrincipalNameType,
+			Name:     principal,
+			Rule:     NotAllowedRule,
+			detail:   fmt.Sprintf("username principal %q is not explicitly permitted by any constraint", principal),
+		}
+	}
+	// TODO: some validation? I.e. allowed characters?
+	return checkNameConstraints(PrincipalNameType, principal, principal,
+		func(parsedName, constraint interface{}) (bool, error) {
+			return matchPrincipalConstraint(parsedName.(string), constraint.(string))
+		}, e.permittedPrincipals, e.excludedPrincipals)
 }
 
 // validateCommonName verifies that the Subject Common Name is allowed
@@ -215,6 +259,9 @@ func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 	if errors.As(err, &pe) {
 		// override the name type with CN
 		pe.NameType = CNNameType
+		for i := range pe.Violations {
+			pe.Violations[i].NameType = CNNameType
+		}
 	}
 
 	return err
@@ -245,10 +292,12 @@ func checkNameConstraints(
 
 		if match {
 			return &NamePolicyError{
-				Reason:   NotAllowed,
-				NameType: nameType,
-				Name:     name,
-				detail:   fmt.Sprintf("%s %q is excluded by constraint %q", nameType, name, constraint),
+				Reason:     NotAllowed,
+				NameType:   nameType,
+				Name:       name,
+				Rule:       DeniedRule,
+				Constraint: fmt.Sprint(constraint),
+				detail:     fmt.Sprintf("%s %q is excluded by constraint %q", nameType, name, constraint),
 			}
 		}
 	}
@@ -278,6 +327,7 @@ func checkNameConstraints(
 			Reason:   NotAllowed,
 			NameType: nameType,
 			Name:     name,
+			Rule:     NotAllowedRule,
 			detail:   fmt.Sprintf("%s %q is not permitted by any constraint", nameType, name),
 		}
 	}